@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+var (
+	adminMutex  sync.RWMutex
+	adminEmails = map[string]bool{}
+)
+
+// SetAdminEmails configures the accounts allowed to use admin endpoints
+func SetAdminEmails(emails []string) {
+	admins := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			admins[email] = true
+		}
+	}
+
+	adminMutex.Lock()
+	defer adminMutex.Unlock()
+	adminEmails = admins
+}
+
+// IsAdmin reports whether the user may use admin endpoints: users of
+// ADMIN_EMAILS and users assigned the admin role are admins. Users
+// authenticated with an API key also need its admin scope; service accounts
+// are admins by that scope alone.
+func IsAdmin(user *User) bool {
+	if user == nil {
+		return false
+	}
+	if user.TokenID != "" {
+		if !slices.Contains(user.TokenScopes, models.TokenScopeAdmin) {
+			return false
+		}
+		if user.Service {
+			return true
+		}
+	}
+	adminMutex.RLock()
+	listed := adminEmails[strings.ToLower(user.Email)]
+	adminMutex.RUnlock()
+	return listed || storedRole(context.Background(), user.Email) == models.RoleAdmin
+}
+
+// RequireAdmin writes an error response and returns false unless the request
+// comes from an admin. When authentication is disabled the service runs in
+// anonymous mode without identities, so admin endpoints are open like every
+// other endpoint.
+func RequireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !authEnabled {
+		return true
+	}
+	user, err := GetCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if !IsAdmin(user) {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
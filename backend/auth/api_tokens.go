@@ -0,0 +1,594 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+)
+
+// apiTokenPrefix starts every API token, so leaked tokens are easy to spot
+const apiTokenPrefix = "glk_"
+
+// usageMonthLayout formats the calendar months usage is counted in
+const usageMonthLayout = "2006-01"
+
+// Default limits of API tokens whose scopes have none configured
+const (
+	DefaultTokenRequestsPerMinute = 60
+	DefaultTokenMonthlyQuota      = 100000
+)
+
+var (
+	// API token store; nil disables API tokens
+	apiTokenStore interfaces.APITokenStore
+	// Limits applied to API tokens
+	apiTokenLimits TokenLimits
+	// Per-minute request counters of API tokens
+	apiTokenLimiter ratelimit.Store
+)
+
+// TokenTier is the rate limit and monthly quota of API tokens. Zero leaves
+// the limit out.
+type TokenTier struct {
+	RequestsPerMinute int
+	MonthlyQuota      int
+}
+
+// TokenLimits are the tiers API tokens are limited by
+type TokenLimits struct {
+	// Scopes holds the tier of each scope; a token gets the tier of its
+	// broadest scope
+	Scopes map[string]TokenTier
+	// Default is the tier of tokens whose scopes have none
+	Default TokenTier
+}
+
+// DefaultTokenLimits returns the limits used when none are configured
+func DefaultTokenLimits() TokenLimits {
+	return TokenLimits{Default: TokenTier{
+		RequestsPerMinute: DefaultTokenRequestsPerMinute,
+		MonthlyQuota:      DefaultTokenMonthlyQuota,
+	}}
+}
+
+// For returns the tier of token. The token's own limits take precedence over
+// the ones of its scopes.
+func (l TokenLimits) For(token *models.APIToken) TokenTier {
+	tier := l.Default
+	for _, scope := range []string{models.TokenScopeAdmin, models.TokenScopeWrite, models.TokenScopeRead} {
+		if scopeTier, ok := l.Scopes[scope]; ok && token.HasScope(scope) {
+			tier = scopeTier
+			break
+		}
+	}
+	if token.RequestsPerMinute > 0 {
+		tier.RequestsPerMinute = token.RequestsPerMinute
+	}
+	if token.MonthlyQuota > 0 {
+		tier.MonthlyQuota = token.MonthlyQuota
+	}
+	return tier
+}
+
+// ParseTokenTiers parses the tiers of scopes from entries such as
+// "read=120/100000": the requests per minute and the monthly quota of
+// tokens with the scope
+func ParseTokenTiers(entries []string) (map[string]TokenTier, error) {
+	tiers := make(map[string]TokenTier, len(entries))
+	for _, entry := range entries {
+		scope, limits, found := strings.Cut(entry, "=")
+		scope = strings.TrimSpace(scope)
+		if !found || !models.IsTokenScope(scope) {
+			return nil, fmt.Errorf("invalid API token tier %q: expected read=REQUESTS_PER_MINUTE/MONTHLY_QUOTA, write=... or admin=...", entry)
+		}
+		perMinute, quota, found := strings.Cut(limits, "/")
+		if !found {
+			return nil, fmt.Errorf("invalid API token tier %q: expected %s=REQUESTS_PER_MINUTE/MONTHLY_QUOTA", entry, scope)
+		}
+		var tier TokenTier
+		var err error
+		if tier.RequestsPerMinute, err = strconv.Atoi(strings.TrimSpace(perMinute)); err != nil || tier.RequestsPerMinute < 0 {
+			return nil, fmt.Errorf("invalid requests per minute in API token tier %q", entry)
+		}
+		if tier.MonthlyQuota, err = strconv.Atoi(strings.TrimSpace(quota)); err != nil || tier.MonthlyQuota < 0 {
+			return nil, fmt.Errorf("invalid monthly quota in API token tier %q", entry)
+		}
+		tiers[scope] = tier
+	}
+	return tiers, nil
+}
+
+// SetAPITokenStore enables API tokens. Requests made with a token are limited
+// by the tier of the token, counting requests per minute in limiter and per
+// month in store. Passing a nil store disables API tokens.
+func SetAPITokenStore(store interfaces.APITokenStore, limits TokenLimits, limiter ratelimit.Store) {
+	apiTokenStore = store
+	apiTokenLimits = limits
+	apiTokenLimiter = limiter
+}
+
+// generateAPIToken creates a random token ID and secret
+func generateAPIToken() (id, secret string, err error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", err
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(idBytes), base64.RawURLEncoding.EncodeToString(secretBytes), nil
+}
+
+// hashTokenSecret returns the hash under which a token secret is stored
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyHeader carries API keys, as an alternative to the Authorization header
+const APIKeyHeader = "X-API-Key"
+
+// serviceUserPrefix starts the user IDs of service accounts, so they never
+// collide with the IDs of people
+const serviceUserPrefix = "service:"
+
+// serviceNamePattern matches the names of service accounts
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,62}$`)
+
+// requestAPIToken returns the API token of the request's X-API-Key header,
+// or else of its Authorization header
+func requestAPIToken(r *http.Request) (string, bool) {
+	raw := r.Header.Get(APIKeyHeader)
+	if raw == "" {
+		var found bool
+		if raw, found = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); !found {
+			return "", false
+		}
+	}
+	if !strings.HasPrefix(raw, apiTokenPrefix) {
+		return "", false
+	}
+	return raw, true
+}
+
+// authenticateAPIToken returns the active token that raw is the secret of
+func authenticateAPIToken(ctx context.Context, raw string) (*models.APIToken, error) {
+	id, secret, found := strings.Cut(strings.TrimPrefix(raw, apiTokenPrefix), "_")
+	if !found || id == "" || secret == "" {
+		return nil, errors.New("invalid API token format")
+	}
+	token, err := apiTokenStore.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("API token lookup failed: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(token.SecretHash), []byte(hashTokenSecret(secret))) != 1 {
+		return nil, errors.New("invalid API token secret")
+	}
+	if !token.IsActive() {
+		return nil, errors.New("API token revoked")
+	}
+	return token, nil
+}
+
+// requiredScope returns the scope a request needs: admin endpoints need the
+// admin scope, other reading requests the read scope and all others the
+// write scope
+func requiredScope(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/api/admin/") {
+		return models.TokenScopeAdmin
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.TokenScopeRead
+	default:
+		return models.TokenScopeWrite
+	}
+}
+
+// usageMonth returns the calendar month usage at t is counted in, and when
+// the next one starts
+func usageMonth(t time.Time) (month string, next time.Time) {
+	t = t.UTC()
+	return t.Format(usageMonthLayout), time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// APITokenMiddleware authenticates requests made with an API token in the
+// X-API-Key header or the Authorization header ("Bearer glk_...") as the
+// token's owner, or as its service account for service tokens. Every request
+// counts against the token's rate limit and monthly quota; requests over
+// either are rejected with 429, and the X-RateLimit-* and X-Quota-* headers
+// tell clients how much is left. Requests without a token pass through.
+func APITokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := requestAPIToken(r)
+		if !ok || apiTokenStore == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		token, err := authenticateAPIToken(ctx, raw)
+		if err != nil {
+			APITokenRequestsTotal.WithLabelValues(tokenResultInvalid).Inc()
+			authLog.Warn("Rejected API token", logger.Fields{"error": err.Error()})
+			http.Error(w, "Invalid API token", http.StatusUnauthorized)
+			return
+		}
+		if scope := requiredScope(r); !token.HasScope(scope) {
+			APITokenRequestsTotal.WithLabelValues(tokenResultForbidden).Inc()
+			http.Error(w, fmt.Sprintf("API token lacks the %s scope", scope), http.StatusForbidden)
+			return
+		}
+
+		now := time.Now()
+		tier := apiTokenLimits.For(token)
+		if !allowTokenRate(w, r, token, tier, now) || !allowTokenQuota(w, r, token, tier, now) {
+			return
+		}
+
+		APITokenRequestsTotal.WithLabelValues(tokenResultAllowed).Inc()
+		user := tokenUser(token)
+		ctx = context.WithValue(ContextWithUser(ctx, user), "user", user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tokenUser returns the identity an API token authenticates as
+func tokenUser(token *models.APIToken) *User {
+	user := &User{
+		ID:          token.UserID,
+		Email:       token.Email,
+		Name:        token.Name,
+		TokenID:     token.ID,
+		TokenScopes: token.Scopes,
+	}
+	if token.Service != "" {
+		user.ID = serviceUserPrefix + token.Service
+		user.Email = ""
+		user.Name = token.Service
+		user.Service = true
+	}
+	return user
+}
+
+// allowTokenRate counts the request against the token's requests of the
+// current minute, writing a 429 response and returning false over the limit
+func allowTokenRate(w http.ResponseWriter, r *http.Request, token *models.APIToken, tier TokenTier, now time.Time) bool {
+	if tier.RequestsPerMinute <= 0 || apiTokenLimiter == nil {
+		return true
+	}
+	minute := now.Truncate(time.Minute)
+	count, err := apiTokenLimiter.Incr(r.Context(), "apitoken:"+token.ID+":"+strconv.FormatInt(minute.Unix(), 10), time.Minute)
+	if err != nil {
+		// Fail open: a broken limiter must not take the API down
+		authLog.Error("Failed to update API token rate limit counter", err, logger.Fields{"tokenID": token.ID})
+		return true
+	}
+
+	reset := minute.Add(time.Minute)
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(tier.RequestsPerMinute))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(tier.RequestsPerMinute-count, 0)))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	if count <= tier.RequestsPerMinute {
+		return true
+	}
+
+	APITokenRequestsTotal.WithLabelValues(tokenResultRateLimited).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+	http.Error(w, "API token rate limit exceeded", http.StatusTooManyRequests)
+	return false
+}
+
+// allowTokenQuota counts the request against the token's requests of the
+// current month, writing a 429 response and returning false over the quota
+func allowTokenQuota(w http.ResponseWriter, r *http.Request, token *models.APIToken, tier TokenTier, now time.Time) bool {
+	month, next := usageMonth(now)
+	count, err := apiTokenStore.AddUsage(r.Context(), token.ID, month)
+	if err != nil {
+		authLog.Error("Failed to record API token usage", err, logger.Fields{"tokenID": token.ID})
+		return true
+	}
+	if tier.MonthlyQuota <= 0 {
+		return true
+	}
+
+	w.Header().Set("X-Quota-Limit", strconv.Itoa(tier.MonthlyQuota))
+	w.Header().Set("X-Quota-Remaining", strconv.Itoa(max(tier.MonthlyQuota-count, 0)))
+	w.Header().Set("X-Quota-Reset", strconv.FormatInt(next.Unix(), 10))
+	if count <= tier.MonthlyQuota {
+		return true
+	}
+
+	APITokenRequestsTotal.WithLabelValues(tokenResultQuotaExceeded).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(next.Sub(now).Seconds())+1))
+	http.Error(w, "API token monthly quota exceeded", http.StatusTooManyRequests)
+	return false
+}
+
+// apiTokenCreated is the response to creating an API token. The token itself
+// is only ever shown here.
+type apiTokenCreated struct {
+	*models.APIToken
+	Token string `json:"token"`
+}
+
+// HandleAPITokens lists the current user's active API tokens (GET) and
+// issues new ones (POST /api/auth/tokens, or /api/apikeys)
+func HandleAPITokens(w http.ResponseWriter, r *http.Request) {
+	if apiTokenStore == nil {
+		http.Error(w, "API tokens are disabled", http.StatusNotImplemented)
+		return
+	}
+	user, err := GetCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listAPITokens(w, r, user)
+	case http.MethodPost:
+		createAPIToken(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listAPITokens writes the user's active API tokens, newest first
+func listAPITokens(w http.ResponseWriter, r *http.Request, user *User) {
+	tokens, err := apiTokenStore.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list API tokens", http.StatusInternalServerError)
+		authLog.Error("Failed to list API tokens", err, logger.Fields{"userID": user.ID})
+		return
+	}
+
+	result := make([]*models.APIToken, 0, len(tokens))
+	for _, token := range tokens {
+		if token.IsActive() {
+			result = append(result, token)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		authLog.Error("Failed to encode API tokens", err, nil)
+	}
+}
+
+// createAPIToken issues an API token to the user. Only admins may grant the
+// admin scope, issue tokens for service accounts or give a token limits of
+// its own.
+func createAPIToken(w http.ResponseWriter, r *http.Request, user *User) {
+	if user.TokenID != "" {
+		http.Error(w, "API tokens cannot issue API tokens", http.StatusForbidden)
+		return
+	}
+
+	var requestBody struct {
+		Name              string   `json:"name"`
+		Service           string   `json:"service"`
+		Scopes            []string `json:"scopes"`
+		RequestsPerMinute int      `json:"requests_per_minute"`
+		MonthlyQuota      int      `json:"monthly_quota"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(requestBody.Name)
+	if name == "" {
+		http.Error(w, "Token name is required", http.StatusBadRequest)
+		return
+	}
+	scopes := requestBody.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{models.TokenScopeRead}
+	}
+	for _, scope := range scopes {
+		if !models.IsTokenScope(scope) {
+			http.Error(w, fmt.Sprintf("Unknown scope '%s'", scope), http.StatusBadRequest)
+			return
+		}
+	}
+	service := strings.TrimSpace(requestBody.Service)
+	if service != "" && !serviceNamePattern.MatchString(service) {
+		http.Error(w, "Service names use lowercase letters, digits, '.', '_' and '-'", http.StatusBadRequest)
+		return
+	}
+	if requestBody.RequestsPerMinute < 0 || requestBody.MonthlyQuota < 0 {
+		http.Error(w, "Limits must not be negative", http.StatusBadRequest)
+		return
+	}
+	if authEnabled && !IsAdmin(user) {
+		switch {
+		case requestBody.RequestsPerMinute > 0 || requestBody.MonthlyQuota > 0:
+			http.Error(w, "Only admins may set the limits of a token", http.StatusForbidden)
+			return
+		case slices.Contains(scopes, models.TokenScopeAdmin):
+			http.Error(w, "Only admins may grant the admin scope", http.StatusForbidden)
+			return
+		case service != "":
+			http.Error(w, "Only admins may issue tokens for service accounts", http.StatusForbidden)
+			return
+		}
+	}
+
+	id, secret, err := generateAPIToken()
+	if err != nil {
+		http.Error(w, "Failed to create API token", http.StatusInternalServerError)
+		authLog.Error("Failed to generate API token", err, nil)
+		return
+	}
+	token := &models.APIToken{
+		ID:                id,
+		UserID:            user.ID,
+		Email:             user.Email,
+		Name:              name,
+		Service:           service,
+		SecretHash:        hashTokenSecret(secret),
+		Scopes:            scopes,
+		RequestsPerMinute: requestBody.RequestsPerMinute,
+		MonthlyQuota:      requestBody.MonthlyQuota,
+		CreatedAt:         time.Now(),
+	}
+	if err := apiTokenStore.Create(r.Context(), token); err != nil {
+		http.Error(w, "Failed to create API token", http.StatusInternalServerError)
+		authLog.Error("Failed to store API token", err, logger.Fields{"userID": user.ID})
+		return
+	}
+
+	authLog.Info("API token created", logger.Fields{
+		"userID":  user.ID,
+		"tokenID": id,
+		"scopes":  scopes,
+		"service": service,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(apiTokenCreated{APIToken: token, Token: apiTokenPrefix + id + "_" + secret}); err != nil {
+		authLog.Error("Failed to encode API token", err, nil)
+	}
+}
+
+// HandleAPIToken revokes one of the current user's API tokens
+// (DELETE /api/auth/tokens/{id}) and reports its usage
+// (GET /api/auth/tokens/{id}/usage). The same routes are served under
+// /api/apikeys/.
+func HandleAPIToken(w http.ResponseWriter, r *http.Request) {
+	if apiTokenStore == nil {
+		http.Error(w, "API tokens are disabled", http.StatusNotImplemented)
+		return
+	}
+	user, err := GetCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path, found := strings.CutPrefix(r.URL.Path, "/api/auth/tokens/")
+	if !found {
+		path = strings.TrimPrefix(r.URL.Path, "/api/apikeys/")
+	}
+	id, usage := strings.CutSuffix(path, "/usage")
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "Token ID is required", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case usage && r.Method == http.MethodGet:
+		reportAPITokenUsage(w, r, user, id)
+	case !usage && r.Method == http.MethodDelete:
+		revokeAPIToken(w, r, user, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ownAPIToken returns the token with id if the user may manage it: its owner
+// and admins may. It writes a 404 response otherwise.
+func ownAPIToken(w http.ResponseWriter, r *http.Request, user *User, id string) (*models.APIToken, bool) {
+	token, err := apiTokenStore.Get(r.Context(), id)
+	if err != nil || (token.UserID != user.ID && !IsAdmin(user)) {
+		// Do not reveal whether another user's token exists
+		http.Error(w, "API token not found", http.StatusNotFound)
+		return nil, false
+	}
+	return token, true
+}
+
+// revokeAPIToken revokes the token with id
+func revokeAPIToken(w http.ResponseWriter, r *http.Request, user *User, id string) {
+	if _, ok := ownAPIToken(w, r, user, id); !ok {
+		return
+	}
+	if err := apiTokenStore.Revoke(r.Context(), id); err != nil {
+		http.Error(w, "Failed to revoke API token", http.StatusInternalServerError)
+		authLog.Error("Failed to revoke API token", err, logger.Fields{"tokenID": id})
+		return
+	}
+
+	authLog.Info("API token revoked", logger.Fields{
+		"userID":  user.ID,
+		"tokenID": id,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TokenUsage is the response of GET /api/auth/tokens/{id}/usage
+type TokenUsage struct {
+	ResetsAt time.Time `json:"resets_at"`
+	TokenID  string    `json:"token_id"`
+	Month    string    `json:"month"`
+	Requests int       `json:"requests"`
+	// MonthlyQuota and RequestsPerMinute are the token's limits; zero is unlimited
+	MonthlyQuota      int `json:"monthly_quota"`
+	Remaining         int `json:"remaining"`
+	RequestsPerMinute int `json:"requests_per_minute"`
+}
+
+// reportAPITokenUsage writes the requests of the token with id in a month:
+// ?month=YYYY-MM, the current one by default
+func reportAPITokenUsage(w http.ResponseWriter, r *http.Request, user *User, id string) {
+	token, ok := ownAPIToken(w, r, user, id)
+	if !ok {
+		return
+	}
+
+	month, next := usageMonth(time.Now())
+	if param := r.URL.Query().Get("month"); param != "" {
+		start, err := time.Parse(usageMonthLayout, param)
+		if err != nil {
+			http.Error(w, "month must be a month such as 2026-01", http.StatusBadRequest)
+			return
+		}
+		month, next = usageMonth(start)
+	}
+	requests, err := apiTokenStore.Usage(r.Context(), id, month)
+	if err != nil {
+		http.Error(w, "Failed to get API token usage", http.StatusInternalServerError)
+		authLog.Error("Failed to get API token usage", err, logger.Fields{"tokenID": id})
+		return
+	}
+
+	tier := apiTokenLimits.For(token)
+	usage := TokenUsage{
+		TokenID:           id,
+		Month:             month,
+		Requests:          requests,
+		MonthlyQuota:      tier.MonthlyQuota,
+		RequestsPerMinute: tier.RequestsPerMinute,
+		ResetsAt:          next,
+	}
+	if tier.MonthlyQuota > 0 {
+		usage.Remaining = max(tier.MonthlyQuota-requests, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		authLog.Error("Failed to encode API token usage", err, nil)
+	}
+}
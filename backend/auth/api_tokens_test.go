@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAPITokens enables auth and API tokens limited by limits for the test
+func setupAPITokens(t *testing.T, limits TokenLimits) {
+	t.Setenv("AUTH_DISABLED", "false")
+	trustTestProxy(t)
+	t.Setenv("SESSION_SECRET_KEY", "test-secret-key")
+	t.Setenv("GOOGLE_CLIENT_ID", "test-client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
+	require.NoError(t, InitSessionManager())
+	require.NoError(t, InitAuth())
+
+	SetAPITokenStore(repositories.NewMemoryAPITokenStore(), limits, ratelimit.NewMemoryStore())
+	SetAdminEmails([]string{"admin@example.com"})
+	t.Cleanup(func() {
+		SetAPITokenStore(nil, TokenLimits{}, nil)
+		SetAdminEmails(nil)
+	})
+}
+
+// issueAPIToken creates an API token as the user and returns the response
+func issueAPIToken(t *testing.T, userID, email string, body map[string]any) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/tokens", bytes.NewReader(payload))
+	signInAs(req, userID, email)
+	rr := httptest.NewRecorder()
+	HandleAPITokens(rr, req)
+	return rr
+}
+
+// tokenRequest sends a request made with the API token through the middleware
+func tokenRequest(method, token string) *httptest.ResponseRecorder {
+	handler := APITokenMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := GetCurrentUser(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(user.ID))
+	}))
+	req := httptest.NewRequest(method, "/api/links", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPITokenLimits(t *testing.T) {
+	setupAPITokens(t, TokenLimits{Default: TokenTier{RequestsPerMinute: 2, MonthlyQuota: 3}})
+
+	rr := issueAPIToken(t, "user-1", "user1@example.com", map[string]any{"name": "ci"})
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var created struct {
+		models.APIToken
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, []string{models.TokenScopeRead}, created.Scopes)
+	assert.NotContains(t, rr.Body.String(), "secret_hash")
+
+	// Requests are made as the token's owner until the rate limit
+	rr = tokenRequest(http.MethodGet, created.Token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "user-1", rr.Body.String())
+	assert.Equal(t, "2", rr.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "2", rr.Header().Get("X-Quota-Remaining"))
+	assert.Equal(t, http.StatusOK, tokenRequest(http.MethodGet, created.Token).Code)
+	rr = tokenRequest(http.MethodGet, created.Token)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+	// A read token cannot change anything, and a wrong secret is no token
+	assert.Equal(t, http.StatusForbidden, tokenRequest(http.MethodPost, created.Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, tokenRequest(http.MethodGet, "glk_"+created.ID+"_wrong").Code)
+
+	// Only admins may lift the limits of a token
+	rr = issueAPIToken(t, "user-1", "user1@example.com", map[string]any{"name": "bulk", "requests_per_minute": 100})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = issueAPIToken(t, "admin", "admin@example.com", map[string]any{
+		"name":                "bulk",
+		"scopes":              []string{models.TokenScopeWrite},
+		"requests_per_minute": 100,
+	})
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var bulk struct {
+		models.APIToken
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &bulk))
+
+	// The monthly quota still applies
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, tokenRequest(http.MethodPost, bulk.Token).Code)
+	}
+	rr = tokenRequest(http.MethodGet, bulk.Token)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "3", rr.Header().Get("X-Quota-Limit"))
+	assert.Equal(t, "0", rr.Header().Get("X-Quota-Remaining"))
+
+	// The usage is reported to the token's owner only
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/tokens/"+bulk.ID+"/usage", nil)
+	signInAs(req, "admin", "admin@example.com")
+	rr = httptest.NewRecorder()
+	HandleAPIToken(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var usage TokenUsage
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &usage))
+	assert.Equal(t, 4, usage.Requests)
+	assert.Equal(t, 3, usage.MonthlyQuota)
+	assert.Equal(t, 0, usage.Remaining)
+	assert.Equal(t, 100, usage.RequestsPerMinute)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/tokens/"+bulk.ID+"/usage", nil)
+	signInAs(req, "user-1", "")
+	rr = httptest.NewRecorder()
+	HandleAPIToken(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// A revoked token no longer authenticates
+	req = httptest.NewRequest(http.MethodDelete, "/api/auth/tokens/"+created.ID, nil)
+	signInAs(req, "user-1", "")
+	rr = httptest.NewRecorder()
+	HandleAPIToken(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, http.StatusUnauthorized, tokenRequest(http.MethodGet, created.Token).Code)
+}
+
+func TestAPIKeys(t *testing.T) {
+	setupAPITokens(t, TokenLimits{})
+
+	// Only admins may grant the admin scope or issue keys for services
+	rr := issueAPIToken(t, "user-1", "user1@example.com", map[string]any{"name": "ops", "scopes": []string{models.TokenScopeAdmin}})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = issueAPIToken(t, "user-1", "user1@example.com", map[string]any{"name": "ci", "service": "ci"})
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = issueAPIToken(t, "admin", "admin@example.com", map[string]any{"name": "ci", "service": "CI Bot"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = issueAPIToken(t, "admin", "admin@example.com", map[string]any{
+		"name":    "deploy bot",
+		"service": "deploy-bot",
+		"scopes":  []string{models.TokenScopeAdmin},
+	})
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var service struct {
+		models.APIToken
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &service))
+	assert.Equal(t, "deploy-bot", service.Service)
+
+	// The X-API-Key header authenticates as the service account, whose admin
+	// scope lets it use admin endpoints
+	handler := APITokenMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !RequireAdmin(w, r) {
+			return
+		}
+		user, _ := GetCurrentUser(r)
+		_, _ = w.Write([]byte(user.ID))
+	}))
+	keyRequest := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/settings", nil)
+		req.Header.Set(APIKeyHeader, token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	rr = keyRequest(service.Token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "service:deploy-bot", rr.Body.String())
+
+	// Keys of admins need the admin scope for admin endpoints
+	rr = issueAPIToken(t, "admin", "admin@example.com", map[string]any{"name": "script", "scopes": []string{models.TokenScopeWrite}})
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var write struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &write))
+	assert.Equal(t, http.StatusForbidden, keyRequest(write.Token).Code)
+	assert.Equal(t, http.StatusOK, tokenRequest(http.MethodPost, write.Token).Code)
+}
+
+func TestParseTokenTiers(t *testing.T) {
+	tiers, err := ParseTokenTiers([]string{"read=120/100000", "write=30/0"})
+	require.NoError(t, err)
+	assert.Equal(t, TokenTier{RequestsPerMinute: 120, MonthlyQuota: 100000}, tiers[models.TokenScopeRead])
+	assert.Equal(t, TokenTier{RequestsPerMinute: 30}, tiers[models.TokenScopeWrite])
+
+	limits := TokenLimits{Default: TokenTier{RequestsPerMinute: 1, MonthlyQuota: 1}, Scopes: tiers}
+	assert.Equal(t, TokenTier{RequestsPerMinute: 30}, limits.For(&models.APIToken{Scopes: []string{"read", "write"}}))
+	assert.Equal(t, TokenTier{RequestsPerMinute: 120, MonthlyQuota: 5},
+		limits.For(&models.APIToken{Scopes: []string{"read"}, MonthlyQuota: 5}))
+
+	for _, entry := range []string{"owner=1/1", "read=1", "read=x/1", "read=1/-1"} {
+		_, err := ParseTokenTiers([]string{entry})
+		assert.Error(t, err, entry)
+	}
+}
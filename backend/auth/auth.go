@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
@@ -24,8 +26,19 @@ var (
 	allowedDomain string
 	// Is authentication enabled
 	authEnabled = true
+	// Brute-force guard for the OAuth callback; nil disables throttling
+	loginGuard *ratelimit.Guard
+	// Endpoint returning the authenticated user's profile
+	userInfoURL = defaultUserInfoURL
+	// Client for calls to the OAuth provider; nil uses http.DefaultClient
+	httpClient *http.Client
+	// Logger for sign-in and session events
+	authLog = logger.For("auth")
 )
 
+// defaultUserInfoURL is Google's OAuth2 userinfo endpoint
+const defaultUserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+
 // generateStateToken creates a random state token
 func generateStateToken() (string, error) {
 	b := make([]byte, 32)
@@ -39,6 +52,9 @@ func generateStateToken() (string, error) {
 // stateCookieName is the name of the cookie that stores the OAuth state
 const stateCookieName = "oauth_state"
 
+// stateCookieTTL is how long a user has to complete the provider's login page
+const stateCookieTTL = 5 * time.Minute
+
 // User represents an authenticated user
 type User struct {
 	Email   string `json:"email"`
@@ -46,6 +62,18 @@ type User struct {
 	Name    string `json:"name"`
 	Picture string `json:"picture"`
 	Domain  string `json:"-"` // Domain extracted from email
+	// Role is the user's role, reported by /api/auth/user
+	Role string `json:"role,omitempty"`
+
+	// SessionID identifies the server-side session the user authenticated with
+	SessionID string `json:"-"`
+	// TokenID identifies the API token the user authenticated with
+	TokenID string `json:"-"`
+	// TokenScopes are the scopes of that API token
+	TokenScopes []string `json:"-"`
+	// Service is set when the API token authenticates a service account
+	// rather than a person
+	Service bool `json:"-"`
 
 	VerifiedEmail bool `json:"verified_email"`
 }
@@ -59,7 +87,19 @@ func InitAuth() error {
 	authDisabled := os.Getenv("AUTH_DISABLED")
 	if strings.ToLower(authDisabled) == "true" {
 		authEnabled = false
-		logger.Info("Authentication is disabled", nil)
+		authLog.Info("Authentication is disabled", nil)
+		return nil
+	}
+
+	// Local accounts and SAML identity providers replace Google
+	switch strings.ToLower(os.Getenv("AUTH_PROVIDER")) {
+	case ProviderLocal:
+		oauthConfig = nil
+		authLog.Info("Authentication uses local accounts", nil)
+		return nil
+	case ProviderSAML:
+		oauthConfig = nil
+		authLog.Info("Authentication uses a SAML identity provider", nil)
 		return nil
 	}
 
@@ -68,14 +108,14 @@ func InitAuth() error {
 	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
 	if clientID == "" || clientSecret == "" {
 		authEnabled = false
-		logger.Warn("Missing GOOGLE_CLIENT_ID or GOOGLE_CLIENT_SECRET environment variable, authentication will be disabled", nil)
+		authLog.Warn("Missing GOOGLE_CLIENT_ID or GOOGLE_CLIENT_SECRET environment variable, authentication will be disabled", nil)
 		return nil
 	}
 
 	// Get allowed domain from environment variable
 	allowedDomain = os.Getenv("GOOGLE_ALLOWED_DOMAIN")
 	if allowedDomain == "" {
-		logger.Warn("No GOOGLE_ALLOWED_DOMAIN set, all Google accounts will be allowed", nil)
+		authLog.Warn("No GOOGLE_ALLOWED_DOMAIN set, all Google accounts will be allowed", nil)
 	}
 
 	// Get redirect URL from environment variable or use default
@@ -88,6 +128,19 @@ func InitAuth() error {
 		redirectURL = fmt.Sprintf("http://%s/api/auth/callback", appDomain)
 	}
 
+	// Allow the provider endpoints to be overridden, e.g. for a test provider
+	endpoint := google.Endpoint
+	if authURL := os.Getenv("OAUTH_AUTH_URL"); authURL != "" {
+		endpoint.AuthURL = authURL
+	}
+	if tokenURL := os.Getenv("OAUTH_TOKEN_URL"); tokenURL != "" {
+		endpoint.TokenURL = tokenURL
+	}
+	userInfoURL = defaultUserInfoURL
+	if url := os.Getenv("OAUTH_USERINFO_URL"); url != "" {
+		userInfoURL = url
+	}
+
 	// Initialize OAuth config
 	oauthConfig = &oauth2.Config{
 		ClientID:     clientID,
@@ -97,10 +150,10 @@ func InitAuth() error {
 			"https://www.googleapis.com/auth/userinfo.email",
 			"https://www.googleapis.com/auth/userinfo.profile",
 		},
-		Endpoint: google.Endpoint,
+		Endpoint: endpoint,
 	}
 
-	logger.Info("Authentication system initialized successfully", logger.Fields{
+	authLog.Info("Authentication system initialized successfully", logger.Fields{
 		"allowedDomain": allowedDomain,
 		"redirectURL":   redirectURL,
 	})
@@ -108,6 +161,68 @@ func InitAuth() error {
 	return nil
 }
 
+// SetLoginGuard enables per-IP and per-account throttling of failed OAuth callbacks
+func SetLoginGuard(guard *ratelimit.Guard) {
+	loginGuard = guard
+}
+
+// SetHTTPClient sets the client used for token exchange and userinfo calls,
+// e.g. one that sends them through an egress proxy
+func SetHTTPClient(client *http.Client) {
+	httpClient = client
+}
+
+// withHTTPClient makes the oauth2 package use the configured client
+func withHTTPClient(ctx context.Context) context.Context {
+	if httpClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+}
+
+// recordLoginFailure counts a failed callback and feeds the brute-force guard.
+// identity is the account the attempt was made for, if known.
+func recordLoginFailure(r *http.Request, reason, identity string) {
+	LoginFailuresTotal.WithLabelValues(reason).Inc()
+	if loginGuard == nil {
+		return
+	}
+	if err := loginGuard.Fail(r.Context(), "ip:"+ClientIP(r), identityKey(identity)); err != nil {
+		authLog.Error("Failed to record login failure", err, nil)
+	}
+}
+
+// identityKey returns the guard key for an account, or "" if unknown
+func identityKey(identity string) string {
+	if identity == "" {
+		return ""
+	}
+	return "id:" + strings.ToLower(identity)
+}
+
+// rejectIfLockedOut writes a 429 response if any of the given guard keys is locked
+func rejectIfLockedOut(w http.ResponseWriter, r *http.Request, keys ...string) bool {
+	if loginGuard == nil {
+		return false
+	}
+	remaining, err := loginGuard.Check(r.Context(), keys...)
+	if err != nil {
+		authLog.Error("Failed to check login lockout", err, nil)
+		return false
+	}
+	if remaining <= 0 {
+		return false
+	}
+	LoginFailuresTotal.WithLabelValues(failureLockedOut).Inc()
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(remaining.Seconds())+1))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+	authLog.Warn("Login attempt rejected due to lockout", logger.Fields{
+		"ip":        ClientIP(r),
+		"remaining": remaining.String(),
+	})
+	return true
+}
+
 // IsAuthEnabled returns whether authentication is enabled
 func IsAuthEnabled() bool {
 	return authEnabled
@@ -127,20 +242,39 @@ func GetLoginURL() (string, string, error) {
 	return oauthConfig.AuthCodeURL(state), state, nil
 }
 
-// HandleLogin redirects the user to Google's OAuth login page
+// HandleLogin redirects the user to Google's OAuth login page or to the SAML
+// identity provider, or with a password provider signs them in with the
+// posted username and password
 func HandleLogin(w http.ResponseWriter, r *http.Request) {
 	if !authEnabled {
 		http.Error(w, "Authentication is disabled", http.StatusNotImplemented)
 		return
 	}
+	if samlProvider != nil {
+		handleSAMLLogin(w, r)
+		return
+	}
+	if passwordProvider != nil {
+		handlePasswordLogin(w, r)
+		return
+	}
+
+	_, span := startSpan(r, "auth.login")
+	defer span.End()
+
+	LoginAttemptsTotal.Inc()
 
 	url, state, err := GetLoginURL()
 	if err != nil {
+		endSpan(span, err)
 		http.Error(w, "Failed to generate login URL", http.StatusInternalServerError)
-		logger.Error("Failed to generate login URL", err, nil)
+		authLog.Error("Failed to generate login URL", err, nil)
 		return
 	}
 
+	// The fingerprint lets a failed callback be matched to the login that issued its state
+	span.SetAttributes(attribute.String("oauth.state_fingerprint", stateFingerprint(state)))
+
 	// Set the state cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     stateCookieName,
@@ -149,21 +283,28 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		Secure:   r.TLS != nil,
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   int(5 * time.Minute.Seconds()), // State cookie expires in 5 minutes
+		MaxAge:   int(stateCookieTTL.Seconds()),
 	})
 
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
 // HandleLogout clears the session_token cookie so the client is no longer authenticated.
-// The session token is stateless (HMAC-signed claims), so no server-side revocation is needed —
-// instructing the browser to drop the cookie is sufficient.
+// When a session store is configured the backing session is revoked as well, so a
+// copied token stops working; otherwise the token is stateless and dropping the
+// cookie is all that can be done.
 func HandleLogout(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if cookie, err := r.Cookie("session_token"); err == nil && sessionStore != nil {
+		if user, err := ValidateSessionToken(r.Context(), cookie.Value); err == nil {
+			revokeSession(r.Context(), user.SessionID, revocationLogout)
+		}
+	}
+
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
 		Value:    "",
@@ -179,16 +320,28 @@ func HandleLogout(w http.ResponseWriter, r *http.Request) {
 
 // HandleCallback processes the OAuth callback from Google
 func HandleCallback(w http.ResponseWriter, r *http.Request) {
-	if !authEnabled {
-		http.Error(w, "Authentication is disabled", http.StatusNotImplemented)
+	if !authEnabled || oauthConfig == nil {
+		http.Error(w, "Sign-in with Google is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	ctx, span := startSpan(r, "auth.callback")
+	defer span.End()
+	ctx = withHTTPClient(ctx)
+	diag := newCallbackDiagnostics(ctx, span, r)
+
+	// Reject clients that are locked out after repeated failures
+	if rejectIfLockedOut(w, r, "ip:"+ClientIP(r)) {
+		diag.record(failureLockedOut, "", "client IP is locked out", nil)
 		return
 	}
 
 	// Get state from cookie
 	stateCookie, err := r.Cookie(stateCookieName)
 	if err != nil {
+		diag.fail(r, failureMissingStateCookie, "",
+			"no state cookie: it expires after "+stateCookieTTL.String()+", or the browser did not send it back (check SameSite/Secure and the redirect URL host)", err)
 		http.Error(w, "State cookie not found", http.StatusBadRequest)
-		logger.Error("State cookie not found", err, nil)
 		return
 	}
 
@@ -205,67 +358,115 @@ func HandleCallback(w http.ResponseWriter, r *http.Request) {
 	// Verify state parameter
 	state := r.FormValue("state")
 	if state == "" || state != stateCookie.Value {
+		detail := "state parameter does not match the state cookie (stale tab or concurrent login)"
+		if state == "" {
+			detail = "state parameter missing from callback"
+		}
+		diag.fail(r, failureBadState, "", detail, nil)
 		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
-		logger.Error("Invalid OAuth state", nil, logger.Fields{
-			"expected": stateCookie.Value,
-			"received": state,
-		})
 		return
 	}
 
 	// Exchange authorization code for token
 	code := r.FormValue("code")
-	token, err := oauthConfig.Exchange(r.Context(), code)
+	exchangeCtx, exchangeSpan := startChildSpan(ctx, "auth.token_exchange")
+	start := time.Now()
+	token, err := oauthConfig.Exchange(exchangeCtx, code)
+	diag.setLatency("exchange", time.Since(start))
+	endSpan(exchangeSpan, err)
 	if err != nil {
+		diag.fail(r, failureTokenExchange, "", "token endpoint rejected the authorization code", err)
 		http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
-		logger.Error("Failed to exchange token", err, nil)
 		return
 	}
 
 	// Get user info
-	user, err := getUserInfo(r.Context(), token)
+	userInfoCtx, userInfoSpan := startChildSpan(ctx, "auth.userinfo")
+	start = time.Now()
+	user, err := getUserInfo(userInfoCtx, token)
+	diag.setLatency("userinfo", time.Since(start))
+	endSpan(userInfoSpan, err)
 	if err != nil {
+		diag.fail(r, failureUserInfo, "", "userinfo request failed", err)
 		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
-		logger.Error("Failed to get user info", err, nil)
+		return
+	}
+
+	// Reject accounts that are locked out after repeated failures
+	if rejectIfLockedOut(w, r, identityKey(user.Email)) {
+		diag.record(failureLockedOut, user.Email, "account is locked out", nil)
 		return
 	}
 
 	// Check if user's email domain is allowed
 	if allowedDomain != "" && user.Domain != allowedDomain {
+		diag.fail(r, failureBadDomain, user.Email, "email domain "+user.Domain+" is not "+allowedDomain, nil)
 		http.Error(w, "Unauthorized domain", http.StatusUnauthorized)
-		logger.Warn("Login attempt from unauthorized domain", logger.Fields{
-			"email":         user.Email,
-			"domain":        user.Domain,
-			"allowedDomain": allowedDomain,
-		})
 		return
 	}
 
-	// Create a session token
-	sessionToken, err := CreateSessionToken(user)
+	// Create the session and its token
+	sessionToken, detail, err := issueSessionToken(ctx, user, r)
 	if err != nil {
+		diag.fail(r, failureSession, user.Email, detail, err)
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
-		logger.Error("Failed to create session token", err, nil)
 		return
 	}
 
-	// Set cookie
+	LoginSuccessesTotal.Inc()
+	span.SetAttributes(attribute.String("enduser.id", user.ID))
+	resetLoginFailures(ctx, r, user.Email)
+	setSessionCookie(w, r, sessionToken)
+
+	// Redirect to frontend
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "/"
+	}
+	http.Redirect(w, r, frontendURL, http.StatusTemporaryRedirect)
+}
+
+// issueSessionToken records the session server-side if session tracking is
+// enabled and signs the token for the user's cookie. On failure detail says
+// which step failed.
+func issueSessionToken(ctx context.Context, user *User, r *http.Request) (token, detail string, err error) {
+	if sessionStore != nil {
+		sessionID, err := startSession(ctx, user, r)
+		if err != nil {
+			return "", "failed to record session", err
+		}
+		user.SessionID = sessionID
+	}
+
+	token, err = CreateSessionToken(user)
+	if err != nil {
+		return "", "failed to sign session token", err
+	}
+	return token, "", nil
+}
+
+// setSessionCookie sets the cookie carrying the session token
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
-		Value:    sessionToken,
+		Value:    token,
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   r.TLS != nil,
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   int(time.Hour * 24 * 7 / time.Second), // 7 days
+		MaxAge:   int(sessionTTL / time.Second),
 	})
+}
 
-	// Redirect to frontend
-	frontendURL := os.Getenv("FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "/"
+// resetLoginFailures clears the failures counted against the client and the
+// account after a successful sign-in
+func resetLoginFailures(ctx context.Context, r *http.Request, identity string) {
+	if loginGuard == nil {
+		return
+	}
+	if err := loginGuard.Reset(ctx, "ip:"+ClientIP(r), identityKey(identity)); err != nil {
+		authLog.Error("Failed to reset login failures", err, nil)
 	}
-	http.Redirect(w, r, frontendURL, http.StatusTemporaryRedirect)
 }
 
 // getUserInfo gets the user information from Google API
@@ -276,7 +477,7 @@ func getUserInfo(ctx context.Context, token *oauth2.Token) (*User, error) {
 
 	client := oauthConfig.Client(ctx, token)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", userInfoURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -287,6 +488,10 @@ func getUserInfo(ctx context.Context, token *oauth2.Token) (*User, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo endpoint returned status %d", resp.StatusCode)
+	}
+
 	var user User
 	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
 		return nil, err
@@ -311,32 +516,28 @@ func GetCurrentUser(r *http.Request) (*User, error) {
 		}, nil
 	}
 
-	// First try to get user from cookie
+	// Requests made with an API token are authenticated by APITokenMiddleware
+	if user, err := UserFromContext(r.Context()); err == nil && user.TokenID != "" {
+		return user, nil
+	}
+
+	// Then try to get user from cookie
 	cookie, err := r.Cookie("session_token")
 	if err == nil {
 		// Validate the session token
-		user, err := ValidateSessionToken(cookie.Value)
+		user, err := ValidateSessionToken(r.Context(), cookie.Value)
 		if err == nil {
 			return user, nil
 		}
 		// Log error but continue with other methods
-		logger.Warn("Failed to validate session token", logger.Fields{
+		authLog.Warn("Failed to validate session token", logger.Fields{
 			"error": err.Error(),
 		})
 	}
 
-	// Trust the X-User-ID header as identity ONLY in test mode. In production this
-	// header is attacker-controlled, so honoring it would let any unauthenticated
-	// client impersonate an arbitrary user (auth bypass).
-	if os.Getenv("TEST_MODE") == "true" {
-		userID := r.Header.Get("X-User-ID")
-		if userID != "" {
-			return &User{
-				ID:    userID,
-				Email: r.Header.Get("X-User-Email"),
-				Name:  r.Header.Get("X-User-Name"),
-			}, nil
-		}
+	// Then a user named by a trusted proxy, if proxy authentication is on
+	if user, ok := trustedProxyUser(r); ok {
+		return user, nil
 	}
 
 	return nil, errors.New("not authenticated")
@@ -363,8 +564,14 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Skip auth for inbound webhooks, which verify their own signatures
+		if strings.HasPrefix(r.URL.Path, "/api/hooks/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Skip auth for redirect paths
-		if r.URL.Path == "/" || r.URL.Path == "/favicon.ico" || r.URL.Path == "/health" {
+		if r.URL.Path == "/" || r.URL.Path == "/favicon.ico" || r.URL.Path == "/livez" || r.URL.Path == "/health" || r.URL.Path == "/readyz" {
 			next.ServeHTTP(w, r)
 			return
 		}
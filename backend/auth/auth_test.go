@@ -1,12 +1,15 @@
 package auth_test
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -218,38 +221,61 @@ func TestGetCurrentUser(t *testing.T) {
 	}
 }
 
-// TestGetCurrentUser_HeaderNotTrustedInProduction pins the fix for the auth-bypass
-// where GetCurrentUser trusted an attacker-controlled X-User-ID header. With auth
-// enabled and no session cookie, the header must NOT authenticate a user unless
-// TEST_MODE is explicitly set.
-func TestGetCurrentUser_HeaderNotTrustedInProduction(t *testing.T) {
+// TestGetCurrentUser_HeaderNotTrusted pins the fix for the auth-bypass where
+// GetCurrentUser trusted an attacker-controlled X-User-ID header. With auth
+// enabled and no session cookie, the header must NOT authenticate a user, not
+// even with TEST_MODE set.
+func TestGetCurrentUser_HeaderNotTrusted(t *testing.T) {
 	t.Setenv("AUTH_DISABLED", "false")
+	t.Setenv("TEST_MODE", "true")
 	t.Setenv("GOOGLE_CLIENT_ID", "test-client-id")
 	t.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
 	if err := auth.InitAuth(); err != nil {
 		t.Fatalf("InitAuth failed: %v", err)
 	}
 
-	newReq := func() *http.Request {
+	req := httptest.NewRequest("GET", "/api/links", nil)
+	req.Header.Set("X-User-ID", "victim@example.com")
+	req.Header.Set("X-User-Email", "victim@example.com")
+	user, err := auth.GetCurrentUser(req)
+	assert.Error(t, err)
+	assert.Nil(t, user)
+}
+
+func TestGetCurrentUser_TrustedProxy(t *testing.T) {
+	t.Setenv("AUTH_DISABLED", "false")
+	t.Setenv("GOOGLE_CLIENT_ID", "test-client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
+	if err := auth.InitAuth(); err != nil {
+		t.Fatalf("InitAuth failed: %v", err)
+	}
+	auth.SetTrustedProxyAuth([]string{"old-secret", "new-secret"})
+	t.Cleanup(func() { auth.SetTrustedProxyAuth(nil) })
+
+	newReq := func(secret string) *http.Request {
 		req := httptest.NewRequest("GET", "/api/links", nil)
-		req.Header.Set("X-User-ID", "victim@example.com")
+		req.Header.Set("X-User-ID", "user-1")
+		req.Header.Set("X-User-Email", "user1@example.com")
+		if secret != "" {
+			req.Header.Set(auth.ProxySecretHeader, secret)
+		}
 		return req
 	}
 
-	t.Run("production rejects the header", func(t *testing.T) {
-		t.Setenv("TEST_MODE", "")
-		user, err := auth.GetCurrentUser(newReq())
-		assert.Error(t, err)
-		assert.Nil(t, user)
-	})
-
-	t.Run("test mode still honors the header", func(t *testing.T) {
-		t.Setenv("TEST_MODE", "true")
-		user, err := auth.GetCurrentUser(newReq())
+	for _, secret := range []string{"old-secret", "new-secret"} {
+		user, err := auth.GetCurrentUser(newReq(secret))
 		assert.NoError(t, err)
-		assert.NotNil(t, user)
-		assert.Equal(t, "victim@example.com", user.ID)
-	})
+		if assert.NotNil(t, user) {
+			assert.Equal(t, "user-1", user.ID)
+			assert.Equal(t, "user1@example.com", user.Email)
+		}
+	}
+
+	// Without the proxy's secret the headers are the client's own claim
+	for _, secret := range []string{"", "wrong-secret"} {
+		_, err := auth.GetCurrentUser(newReq(secret))
+		assert.Error(t, err, secret)
+	}
 }
 
 func TestHandleLogout(t *testing.T) {
@@ -301,3 +327,46 @@ func TestHandleLogout(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleCallbackLockout(t *testing.T) {
+	setupAuthEnvironment(t)
+	defer cleanupAuthEnvironment()
+	assert.NoError(t, auth.InitSessionManager())
+	assert.NoError(t, auth.InitAuth())
+
+	auth.SetLoginGuard(ratelimit.NewGuard(ratelimit.NewMemoryStore(), "login", 3, time.Minute, time.Minute))
+	defer auth.SetLoginGuard(nil)
+
+	callback := func(remoteAddr string, forwardedFor ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/callback?state=forged", nil)
+		req.RemoteAddr = remoteAddr
+		for _, addr := range forwardedFor {
+			req.Header.Add("X-Forwarded-For", addr)
+		}
+		req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "expected"})
+		rr := httptest.NewRecorder()
+		auth.HandleCallback(rr, req)
+		return rr
+	}
+
+	// Spoofed X-Forwarded-For addresses neither spread the attempts over
+	// several buckets nor count them against the named address
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusBadRequest, callback("203.0.113.1", fmt.Sprintf("198.51.100.%d", i)).Code)
+	}
+
+	rr := callback("203.0.113.1", "198.51.100.9")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTooManyRequests, callback("203.0.113.1").Code)
+
+	// A different client is not affected by the lockout
+	assert.Equal(t, http.StatusBadRequest, callback("203.0.113.2").Code)
+	assert.Equal(t, http.StatusBadRequest, callback("198.51.100.0").Code)
+
+	// Behind a trusted proxy, its entry names the client instead
+	auth.SetTrustedProxyHops(1)
+	defer auth.SetTrustedProxyHops(0)
+	assert.Equal(t, http.StatusBadRequest, callback("203.0.113.1", "198.51.100.9").Code)
+	assert.Equal(t, http.StatusTooManyRequests, callback("10.0.0.1", "198.51.100.9, 203.0.113.1").Code)
+}
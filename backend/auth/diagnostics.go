@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRecentLoginFailures bounds the in-memory history of failed logins
+const maxRecentLoginFailures = 100
+
+// LoginFailure is a diagnostic record of a failed OAuth callback
+type LoginFailure struct {
+	Time              time.Time `json:"time"`
+	Reason            string    `json:"reason"`
+	Detail            string    `json:"detail,omitempty"`
+	Error             string    `json:"error,omitempty"`
+	Email             string    `json:"email,omitempty"`
+	IPAddress         string    `json:"ip_address"`
+	UserAgent         string    `json:"user_agent"`
+	TraceID           string    `json:"trace_id,omitempty"`
+	StateFingerprint  string    `json:"state_fingerprint,omitempty"`
+	CookieFingerprint string    `json:"cookie_fingerprint,omitempty"`
+	// Cookies lists the names (never values) of cookies the browser sent
+	Cookies           []string `json:"cookies"`
+	ExchangeLatencyMS int64    `json:"exchange_latency_ms,omitempty"`
+	UserInfoLatencyMS int64    `json:"userinfo_latency_ms,omitempty"`
+	StateCookieSent   bool     `json:"state_cookie_sent"`
+	StateParamSent    bool     `json:"state_param_sent"`
+}
+
+// loginFailureLog keeps the most recent login failures for the diagnostics endpoint
+var loginFailureLog = &failureRing{}
+
+// failureRing is a fixed-size ring buffer of login failures
+type failureRing struct {
+	entries []LoginFailure
+	next    int
+	mutex   sync.Mutex
+}
+
+// add stores a failure, evicting the oldest once full
+func (f *failureRing) add(failure LoginFailure) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.entries) < maxRecentLoginFailures {
+		f.entries = append(f.entries, failure)
+		return
+	}
+	f.entries[f.next] = failure
+	f.next = (f.next + 1) % maxRecentLoginFailures
+}
+
+// recent returns up to limit failures, newest first
+func (f *failureRing) recent(limit int) []LoginFailure {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	result := make([]LoginFailure, len(f.entries))
+	copy(result, f.entries)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.After(result[j].Time)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// callbackDiagnostics collects what is known about one OAuth callback so a
+// failure can be explained from a single log line, span or diagnostics entry
+type callbackDiagnostics struct {
+	span  trace.Span
+	ctx   context.Context
+	event LoginFailure
+}
+
+// newCallbackDiagnostics captures request details relevant to state problems
+func newCallbackDiagnostics(ctx context.Context, span trace.Span, r *http.Request) *callbackDiagnostics {
+	d := &callbackDiagnostics{
+		span: span,
+		ctx:  ctx,
+		event: LoginFailure{
+			IPAddress: ClientIP(r),
+			UserAgent: r.UserAgent(),
+			TraceID:   traceID(ctx),
+			Cookies:   []string{},
+		},
+	}
+
+	for _, c := range r.Cookies() {
+		d.event.Cookies = append(d.event.Cookies, c.Name)
+		if c.Name == stateCookieName {
+			d.event.StateCookieSent = true
+			d.event.CookieFingerprint = stateFingerprint(c.Value)
+		}
+	}
+	state := r.FormValue("state")
+	d.event.StateParamSent = state != ""
+	d.event.StateFingerprint = stateFingerprint(state)
+
+	span.SetAttributes(
+		attribute.Bool("oauth.state_cookie_sent", d.event.StateCookieSent),
+		attribute.Bool("oauth.state_param_sent", d.event.StateParamSent),
+		attribute.String("oauth.state_fingerprint", d.event.StateFingerprint),
+		attribute.Int("http.cookie_count", len(d.event.Cookies)),
+	)
+	return d
+}
+
+// setLatency records how long a call to the OAuth provider took
+func (d *callbackDiagnostics) setLatency(step string, latency time.Duration) {
+	switch step {
+	case "exchange":
+		d.event.ExchangeLatencyMS = latency.Milliseconds()
+	case "userinfo":
+		d.event.UserInfoLatencyMS = latency.Milliseconds()
+	}
+	d.span.SetAttributes(attribute.Int64("oauth."+step+"_latency_ms", latency.Milliseconds()))
+}
+
+// fail counts a failed callback towards metrics and lockouts and records its diagnostics
+func (d *callbackDiagnostics) fail(r *http.Request, reason, email, detail string, err error) {
+	if reason == failureSession {
+		// Server-side failures are not the client's fault and must not lock it out
+		LoginFailuresTotal.WithLabelValues(reason).Inc()
+	} else {
+		recordLoginFailure(r, reason, email)
+	}
+	d.record(reason, email, detail, err)
+}
+
+// record stores the failure in the recent-failures log, the span and the logs
+func (d *callbackDiagnostics) record(reason, email, detail string, err error) {
+	event := d.event
+	event.Time = time.Now()
+	event.Reason = reason
+	event.Email = email
+	event.Detail = detail
+	if err != nil {
+		event.Error = err.Error()
+	}
+	loginFailureLog.add(event)
+
+	d.span.SetAttributes(attribute.String("oauth.failure_reason", reason))
+	if err != nil {
+		d.span.RecordError(err)
+	}
+	d.span.SetStatus(codes.Error, reason)
+
+	authLog.Warn("OAuth login failed", logger.Fields{
+		"reason":              reason,
+		"detail":              detail,
+		"error":               event.Error,
+		"email":               email,
+		"ip":                  event.IPAddress,
+		"user_agent":          event.UserAgent,
+		"trace_id":            event.TraceID,
+		"cookies":             event.Cookies,
+		"state_cookie_sent":   event.StateCookieSent,
+		"state_param_sent":    event.StateParamSent,
+		"state_fingerprint":   event.StateFingerprint,
+		"cookie_fingerprint":  event.CookieFingerprint,
+		"exchange_latency_ms": event.ExchangeLatencyMS,
+		"userinfo_latency_ms": event.UserInfoLatencyMS,
+	})
+}
+
+// HandleRecentLoginFailures handles GET /api/admin/auth/failures, returning the
+// most recent failed OAuth callbacks with their diagnostics
+func HandleRecentLoginFailures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !RequireAdmin(w, r) {
+		return
+	}
+
+	limit := 50
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 {
+		limit = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(loginFailureLog.recent(limit)); err != nil {
+		authLog.Error("Failed to encode login failures", err, nil)
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider that records ended spans for the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestCallbackDiagnostics(t *testing.T) {
+	setupSessionStore(t, 0)
+	recorder := recordSpans(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/callback?state=from-provider", nil)
+	req.AddCookie(&http.Cookie{Name: stateCookieName, Value: "from-login"})
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+	rr := httptest.NewRecorder()
+	HandleCallback(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	failures := loginFailureLog.recent(1)
+	require.Len(t, failures, 1)
+	failure := failures[0]
+	assert.Equal(t, failureBadState, failure.Reason)
+	assert.True(t, failure.StateCookieSent)
+	assert.True(t, failure.StateParamSent)
+	assert.Equal(t, stateFingerprint("from-provider"), failure.StateFingerprint)
+	assert.Equal(t, stateFingerprint("from-login"), failure.CookieFingerprint)
+	assert.ElementsMatch(t, []string{stateCookieName, "theme"}, failure.Cookies)
+	assert.NotEmpty(t, failure.TraceID)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "auth.callback", spans[0].Name())
+	assert.Equal(t, failure.TraceID, spans[0].SpanContext().TraceID().String())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("oauth.failure_reason", failureBadState))
+}
+
+func TestFailureRingEviction(t *testing.T) {
+	ring := &failureRing{}
+	start := time.Now()
+	for i := 0; i < maxRecentLoginFailures+5; i++ {
+		ring.add(LoginFailure{Time: start.Add(time.Duration(i) * time.Second), Reason: "r"})
+	}
+
+	all := ring.recent(0)
+	require.Len(t, all, maxRecentLoginFailures)
+	assert.Equal(t, start.Add(time.Duration(maxRecentLoginFailures+4)*time.Second), all[0].Time, "newest first")
+	assert.Equal(t, start.Add(5*time.Second), all[len(all)-1].Time, "oldest entries evicted")
+	assert.Len(t, ring.recent(3), 3)
+}
+
+func TestHandleRecentLoginFailuresRequiresAdmin(t *testing.T) {
+	setupSessionStore(t, 0)
+	SetAdminEmails([]string{"Admin@example.com"})
+	t.Cleanup(func() { SetAdminEmails(nil) })
+
+	tests := []struct {
+		name   string
+		email  string
+		status int
+	}{
+		{name: "Anonymous", status: http.StatusUnauthorized},
+		{name: "Regular User", email: "user@example.com", status: http.StatusForbidden},
+		{name: "Admin", email: "admin@example.com", status: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/auth/failures", nil)
+			if tc.email != "" {
+				sessionID, err := startSession(req.Context(), &User{ID: tc.email, Email: tc.email}, req)
+				require.NoError(t, err)
+				token, err := CreateSessionToken(&User{ID: tc.email, Email: tc.email, SessionID: sessionID})
+				require.NoError(t, err)
+				req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+			}
+			rr := httptest.NewRecorder()
+			HandleRecentLoginFailures(rr, req)
+
+			assert.Equal(t, tc.status, rr.Code)
+			if tc.status == http.StatusOK {
+				var failures []LoginFailure
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &failures))
+			}
+		})
+	}
+}
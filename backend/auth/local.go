@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	pkgerrors "github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Sign-in providers selected with AUTH_PROVIDER
+const (
+	ProviderGoogle = "google"
+	ProviderLocal  = "local"
+	ProviderSAML   = "saml"
+)
+
+// ErrInvalidCredentials is returned for an unknown username, a wrong
+// password or a disabled account alike, so callers cannot tell them apart
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// PasswordProvider signs users in with a username and password
+type PasswordProvider interface {
+	Authenticate(ctx context.Context, username, password string) (*User, error)
+}
+
+// passwordProvider replaces the Google sign-in when set
+var passwordProvider PasswordProvider
+
+// SetPasswordProvider makes users sign in with a username and password
+// through provider instead of with Google. Passing nil restores Google.
+func SetPasswordProvider(provider PasswordProvider) {
+	passwordProvider = provider
+}
+
+// HashPassword returns the bcrypt hash of a password for a local account,
+// rejecting passwords that are too short
+func HashPassword(password string) (string, error) {
+	if len(password) < models.MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", models.MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// LocalProvider authenticates the accounts of a local user store, for
+// self-hosted deployments that run without Google
+type LocalProvider struct {
+	store interfaces.LocalUserStore
+	// decoy is compared against for unknown usernames, so they take as long
+	// to reject as wrong passwords
+	decoy []byte
+}
+
+// Ensure LocalProvider implements PasswordProvider
+var _ PasswordProvider = (*LocalProvider)(nil)
+
+// NewLocalProvider creates a provider for the accounts in store
+func NewLocalProvider(store interfaces.LocalUserStore) *LocalProvider {
+	decoy, _ := bcrypt.GenerateFromPassword([]byte("decoy password for unknown users"), bcrypt.DefaultCost)
+	return &LocalProvider{store: store, decoy: decoy}
+}
+
+// Authenticate checks a username and password. The user's email is their
+// account's email, or their username if it has none, so ADMIN_EMAILS can
+// name local accounts either way.
+func (p *LocalProvider) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	username, err := models.NormalizeUsername(username)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	account, err := p.store.Get(ctx, username)
+	if errors.Is(err, pkgerrors.ErrNotFound) {
+		_ = bcrypt.CompareHashAndPassword(p.decoy, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil || account.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+
+	user := &User{
+		ID:    account.Username,
+		Email: account.Email,
+		Name:  account.Name,
+	}
+	if user.Email == "" {
+		user.Email = account.Username
+	}
+	if user.Name == "" {
+		user.Name = account.Username
+	}
+	if _, domain, ok := strings.Cut(user.Email, "@"); ok {
+		user.Domain = domain
+	}
+	return user, nil
+}
+
+// handlePasswordLogin signs a user in with the username and password in the
+// JSON request body and sets their session cookie
+func handlePasswordLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Sign in by posting a username and password", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := startSpan(r, "auth.password_login")
+	defer span.End()
+	LoginAttemptsTotal.Inc()
+
+	if rejectIfLockedOut(w, r, "ip:"+ClientIP(r)) {
+		return
+	}
+
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil || credentials.Username == "" {
+		http.Error(w, "A username and password are required", http.StatusBadRequest)
+		return
+	}
+	if rejectIfLockedOut(w, r, identityKey(credentials.Username)) {
+		return
+	}
+
+	user, err := passwordProvider.Authenticate(ctx, credentials.Username, credentials.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		recordLoginFailure(r, failureBadCredentials, credentials.Username)
+		span.SetAttributes(attribute.String("auth.failure_reason", failureBadCredentials))
+		authLog.Warn("Password login failed", logger.Fields{
+			"username": credentials.Username,
+			"ip":       ClientIP(r),
+		})
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		endSpan(span, err)
+		http.Error(w, "Failed to sign in", http.StatusInternalServerError)
+		authLog.Error("Failed to check credentials", err, logger.Fields{"username": credentials.Username})
+		return
+	}
+
+	token, detail, err := issueSessionToken(ctx, user, r)
+	if err != nil {
+		endSpan(span, err)
+		LoginFailuresTotal.WithLabelValues(failureSession).Inc()
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		authLog.Error("Password login failed: "+detail, err, logger.Fields{"username": credentials.Username})
+		return
+	}
+
+	LoginSuccessesTotal.Inc()
+	span.SetAttributes(attribute.String("enduser.id", user.ID))
+	resetLoginFailures(ctx, r, credentials.Username)
+	setSessionCookie(w, r, token)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		authLog.Error("Failed to encode user", err, nil)
+	}
+}
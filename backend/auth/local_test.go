@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupLocalAccounts enables local sign-in with accounts alice, with an
+// email, and the disabled bob
+func setupLocalAccounts(t *testing.T) *repositories.MemoryLocalUserStore {
+	t.Setenv("AUTH_DISABLED", "false")
+	t.Setenv("AUTH_PROVIDER", "local")
+	t.Setenv("SESSION_SECRET_KEY", "test-secret-key")
+	require.NoError(t, auth.InitSessionManager())
+	require.NoError(t, auth.InitAuth())
+	require.True(t, auth.IsAuthEnabled(), "local accounts need no Google credentials")
+
+	store := repositories.NewMemoryLocalUserStore()
+	hash, err := auth.HashPassword("correct horse battery")
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, store.Save(ctx, &models.LocalUser{Username: "alice", Email: "alice@example.com", PasswordHash: hash}))
+	require.NoError(t, store.Save(ctx, &models.LocalUser{Username: "bob", PasswordHash: hash, Disabled: true}))
+
+	auth.SetPasswordProvider(auth.NewLocalProvider(store))
+	t.Cleanup(func() { auth.SetPasswordProvider(nil) })
+	return store
+}
+
+func TestLocalProvider(t *testing.T) {
+	store := setupLocalAccounts(t)
+	provider := auth.NewLocalProvider(store)
+	ctx := context.Background()
+
+	user, err := provider.Authenticate(ctx, "Alice", "correct horse battery")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.ID)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.Equal(t, "example.com", user.Domain)
+
+	for name, credentials := range map[string][2]string{
+		"wrong password":   {"alice", "wrong horse battery"},
+		"unknown user":     {"carol", "correct horse battery"},
+		"disabled account": {"bob", "correct horse battery"},
+		"invalid username": {"../alice", "correct horse battery"},
+	} {
+		_, err := provider.Authenticate(ctx, credentials[0], credentials[1])
+		assert.ErrorIs(t, err, auth.ErrInvalidCredentials, name)
+	}
+
+	_, err = auth.HashPassword("short")
+	assert.Error(t, err)
+}
+
+func TestHandlePasswordLogin(t *testing.T) {
+	setupLocalAccounts(t)
+	auth.SetLoginGuard(ratelimit.NewGuard(ratelimit.NewMemoryStore(), "login", 2, time.Minute, time.Minute))
+	defer auth.SetLoginGuard(nil)
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body))
+		req.RemoteAddr = "203.0.113.1:1234"
+		rr := httptest.NewRecorder()
+		auth.HandleLogin(rr, req)
+		return rr
+	}
+
+	rr := login(`{"username": "alice", "password": "correct horse battery"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var user auth.User
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &user))
+	assert.Equal(t, "alice", user.ID)
+
+	var token string
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			token = cookie.Value
+		}
+	}
+	require.NotEmpty(t, token)
+	signedIn, err := auth.ValidateSessionToken(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", signedIn.ID)
+
+	// The callback has nothing to do without Google
+	callback := httptest.NewRecorder()
+	auth.HandleCallback(callback, httptest.NewRequest(http.MethodGet, "/api/auth/callback", nil))
+	assert.Equal(t, http.StatusNotImplemented, callback.Code)
+
+	get := httptest.NewRecorder()
+	auth.HandleLogin(get, httptest.NewRequest(http.MethodGet, "/api/auth/login", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, get.Code)
+
+	// Failed logins lock the client out like failed callbacks do
+	assert.Equal(t, http.StatusUnauthorized, login(`{"username": "alice", "password": "wrong"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, login(`{"username": "bob", "password": "correct horse battery"}`).Code)
+	assert.Equal(t, http.StatusTooManyRequests, login(`{"username": "alice", "password": "correct horse battery"}`).Code)
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Login failure reasons used as the "reason" label of LoginFailuresTotal
+const (
+	failureMissingStateCookie = "missing_state_cookie"
+	failureBadState           = "bad_state"
+	failureTokenExchange      = "token_exchange_error"
+	failureUserInfo           = "userinfo_error"
+	failureBadDomain          = "bad_domain"
+	failureSession            = "session_error"
+	failureLockedOut          = "locked_out"
+	failureBadCredentials     = "bad_credentials"
+	failureStepUp             = "step_up"
+	failureBadAssertion       = "bad_assertion"
+)
+
+// API token request results used as the "result" label of APITokenRequestsTotal
+const (
+	tokenResultAllowed       = "allowed"
+	tokenResultInvalid       = "invalid"
+	tokenResultForbidden     = "forbidden"
+	tokenResultRateLimited   = "rate_limited"
+	tokenResultQuotaExceeded = "quota_exceeded"
+)
+
+// Session revocation reasons used as the "reason" label of SessionRevocationsTotal
+const (
+	revocationLogout = "logout"
+	revocationUser   = "user"
+	revocationLimit  = "session_limit"
+)
+
+var (
+	// LoginAttemptsTotal counts redirects to the OAuth provider
+	LoginAttemptsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "golink_auth_login_attempts_total",
+			Help: "Total number of login attempts started",
+		},
+	)
+
+	// LoginSuccessesTotal counts completed logins
+	LoginSuccessesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "golink_auth_login_successes_total",
+			Help: "Total number of successful logins",
+		},
+	)
+
+	// LoginFailuresTotal counts failed OAuth callbacks by reason
+	LoginFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_auth_login_failures_total",
+			Help: "Total number of failed logins by reason",
+		},
+		[]string{"reason"},
+	)
+
+	// TokenValidationsTotal counts session token validations by result
+	TokenValidationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_auth_token_validations_total",
+			Help: "Total number of session token validations by result",
+		},
+		[]string{"result"},
+	)
+
+	// SessionRevocationsTotal counts revoked sessions by reason
+	SessionRevocationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_auth_session_revocations_total",
+			Help: "Total number of revoked sessions by reason",
+		},
+		[]string{"reason"},
+	)
+
+	// APITokenRequestsTotal counts requests made with API tokens by result
+	APITokenRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_auth_api_token_requests_total",
+			Help: "Total number of requests made with API tokens by result",
+		},
+		[]string{"result"},
+	)
+)
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallbackFailureMetrics(t *testing.T) {
+	setupSessionStore(t, 0)
+
+	tests := []struct {
+		name   string
+		reason string
+		cookie string
+		state  string
+	}{
+		{name: "Missing State Cookie", reason: failureMissingStateCookie, state: "abc"},
+		{name: "State Mismatch", reason: failureBadState, cookie: "abc", state: "xyz"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			before := testutil.ToFloat64(LoginFailuresTotal.WithLabelValues(tc.reason))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/callback?state="+tc.state, nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: stateCookieName, Value: tc.cookie})
+			}
+			rr := httptest.NewRecorder()
+			HandleCallback(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, before+1, testutil.ToFloat64(LoginFailuresTotal.WithLabelValues(tc.reason)))
+		})
+	}
+}
+
+func TestTokenValidationMetrics(t *testing.T) {
+	setupSessionStore(t, 0)
+
+	before := testutil.ToFloat64(TokenValidationsTotal.WithLabelValues("invalid"))
+	_, err := ValidateSessionToken(context.Background(), "not-a-token")
+	assert.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(TokenValidationsTotal.WithLabelValues("invalid")))
+}
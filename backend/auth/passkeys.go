@@ -0,0 +1,681 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/Okabe-Junya/golink-backend/pkg/webauthn"
+)
+
+// DefaultStepUpTTL is how long a step-up authentication lasts by default
+const DefaultStepUpTTL = 10 * time.Minute
+
+// stepUpCookie carries the proof of a recent step-up authentication
+const stepUpCookie = "step_up_token"
+
+// recoveryCodeCount is how many recovery codes a user gets at once
+const recoveryCodeCount = 10
+
+// Purposes of WebAuthn challenges
+const (
+	challengeRegister = "register"
+	challengeStepUp   = "step-up"
+)
+
+// ErrStepUpRequired is the error code of requests needing a recent step-up
+// authentication
+const ErrStepUpRequired = "STEP_UP_REQUIRED"
+
+var (
+	// Passkey store; nil disables passkeys and step-up authentication
+	passkeyStore interfaces.PasskeyStore
+	// The relying party passkeys are registered with
+	relyingParty webauthn.RelyingParty
+	// Answered challenges, so each challenge is answered once
+	usedChallenges ratelimit.Store
+	// How long a step-up authentication lasts
+	stepUpTTL = DefaultStepUpTTL
+)
+
+// SetPasskeys enables passkeys as a second factor of admins. Once an admin
+// has registered one, destructive operations need a step-up authentication
+// with it, which lasts for ttl. Answered challenges are remembered in
+// challenges, so they can be shared with other instances. Passing a nil store
+// disables passkeys.
+func SetPasskeys(store interfaces.PasskeyStore, rp webauthn.RelyingParty, challenges ratelimit.Store, ttl time.Duration) {
+	passkeyStore = store
+	relyingParty = rp
+	usedChallenges = challenges
+	stepUpTTL = DefaultStepUpTTL
+	if ttl > 0 {
+		stepUpTTL = ttl
+	}
+}
+
+// challengeMAC authenticates a challenge issued to a user for a purpose
+func challengeMAC(purpose, userID string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secretKey)
+	fmt.Fprintf(mac, "webauthn:%s:%s:", purpose, userID)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// issueChallenge creates a challenge for the user. Challenges carry their
+// expiry and are signed, so any instance can check the answer without
+// keeping the challenge.
+func issueChallenge(purpose, userID string) ([]byte, error) {
+	if len(secretKey) == 0 {
+		return nil, errors.New("session manager not initialized")
+	}
+	body := make([]byte, 16, 24)
+	if _, err := rand.Read(body); err != nil {
+		return nil, err
+	}
+	body = binary.BigEndian.AppendUint64(body, uint64(time.Now().Add(webauthn.Timeout).Unix()))
+	return append(body, challengeMAC(purpose, userID, body)...), nil
+}
+
+// checkChallenge checks that challenge was issued to the user for purpose,
+// has not expired and has not been answered before
+func checkChallenge(ctx context.Context, challenge []byte, purpose, userID string) error {
+	if len(challenge) != 24+sha256.Size || len(secretKey) == 0 {
+		return errors.New("unknown challenge")
+	}
+	body, mac := challenge[:24], challenge[24:]
+	if !hmac.Equal(mac, challengeMAC(purpose, userID, body)) {
+		return errors.New("unknown challenge")
+	}
+	if time.Now().Unix() > int64(binary.BigEndian.Uint64(body[16:])) {
+		return errors.New("challenge expired")
+	}
+	answers, err := usedChallenges.Incr(ctx, "webauthn:challenge:"+hex.EncodeToString(body[:16]), webauthn.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to record challenge: %w", err)
+	}
+	if answers > 1 {
+		return errors.New("challenge already answered")
+	}
+	return nil
+}
+
+// stepUpClaims is the content of a step-up token
+type stepUpClaims struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	UserID    string    `json:"user_id"`
+	SessionID string    `json:"sid,omitempty"`
+}
+
+// setStepUpCookie records a step-up authentication of the user's session
+func setStepUpCookie(w http.ResponseWriter, r *http.Request, user *User) (time.Time, error) {
+	claims := stepUpClaims{UserID: user.ID, SessionID: user.SessionID, ExpiresAt: time.Now().Add(stepUpTTL)}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return time.Time{}, err
+	}
+	encoded := base64.URLEncoding.EncodeToString(data)
+	signature, err := createSignature("step-up:" + encoded)
+	if err != nil {
+		return time.Time{}, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     stepUpCookie,
+		Value:    encoded + "." + signature,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(stepUpTTL / time.Second),
+	})
+	return claims.ExpiresAt, nil
+}
+
+// steppedUp reports whether the request carries a current step-up
+// authentication of the user's session
+func steppedUp(r *http.Request, user *User) bool {
+	cookie, err := r.Cookie(stepUpCookie)
+	if err != nil {
+		return false
+	}
+	encoded, signature, found := strings.Cut(cookie.Value, ".")
+	if !found {
+		return false
+	}
+	expected, err := createSignature("step-up:" + encoded)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return false
+	}
+	data, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	var claims stepUpClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return false
+	}
+	return claims.UserID == user.ID && claims.SessionID == user.SessionID && time.Now().Before(claims.ExpiresAt)
+}
+
+// RequireStepUp writes an error response and returns false unless the
+// request may perform a destructive operation: users who registered a
+// passkey need to have authenticated with it, or with a recovery code,
+// within the step-up TTL. Users without passkeys, and every request while
+// passkeys are disabled, pass.
+func RequireStepUp(w http.ResponseWriter, r *http.Request) bool {
+	if !authEnabled || passkeyStore == nil {
+		return true
+	}
+	user, err := GetCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	passkeys, err := passkeyStore.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to check passkeys", http.StatusInternalServerError)
+		authLog.Error("Failed to list passkeys", err, logger.Fields{"userID": user.ID})
+		return false
+	}
+	if len(passkeys) == 0 || steppedUp(r, user) {
+		return true
+	}
+
+	message := "Confirm this operation with your passkey at /api/auth/step-up"
+	if user.TokenID != "" {
+		message = "This operation needs a passkey and cannot be done with an API token"
+	}
+	respondAuthError(w, http.StatusUnauthorized, ErrStepUpRequired, message)
+	return false
+}
+
+// respondAuthError writes a structured error response like
+// middleware.RespondWithError, which this package cannot import
+func respondAuthError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body := map[string]any{"error": map[string]string{"code": code, "message": message}}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		authLog.Error("Failed to encode error response", err, nil)
+	}
+}
+
+// passkeyUser returns the signed-in user managing passkeys, writing an error
+// response if there is none or passkeys are disabled
+func passkeyUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	if passkeyStore == nil || !authEnabled {
+		http.Error(w, "Passkeys are disabled", http.StatusNotImplemented)
+		return nil, false
+	}
+	user, err := GetCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if user.TokenID != "" {
+		http.Error(w, "Passkeys cannot be used with an API token", http.StatusForbidden)
+		return nil, false
+	}
+	return user, true
+}
+
+// credentialIDs returns the credential IDs of passkeys
+func credentialIDs(passkeys []*models.Passkey) [][]byte {
+	ids := make([][]byte, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		if id, err := webauthn.DecodeID(passkey.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// PasskeyList is the response of GET /api/auth/passkeys
+type PasskeyList struct {
+	Passkeys               []*models.Passkey `json:"passkeys"`
+	RecoveryCodesRemaining int               `json:"recovery_codes_remaining"`
+}
+
+// passkeyRegistered is the response to registering a passkey. Recovery codes
+// are only ever shown here, when the first passkey is registered.
+type passkeyRegistered struct {
+	*models.Passkey
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// HandlePasskeys lists the current user's passkeys (GET) and registers a new
+// one (POST /api/auth/passkeys) with a credential created from the options
+// of POST /api/auth/passkeys/options. Only admins may register passkeys; a
+// user who already has one needs a step-up authentication to add another.
+func HandlePasskeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := passkeyUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listPasskeys(w, r, user)
+	case http.MethodPost:
+		registerPasskey(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listPasskeys writes the user's passkeys, newest first
+func listPasskeys(w http.ResponseWriter, r *http.Request, user *User) {
+	passkeys, err := passkeyStore.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list passkeys", http.StatusInternalServerError)
+		authLog.Error("Failed to list passkeys", err, logger.Fields{"userID": user.ID})
+		return
+	}
+	remaining, err := passkeyStore.RemainingRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list passkeys", http.StatusInternalServerError)
+		authLog.Error("Failed to count recovery codes", err, logger.Fields{"userID": user.ID})
+		return
+	}
+	sort.Slice(passkeys, func(i, j int) bool {
+		return passkeys[i].CreatedAt.After(passkeys[j].CreatedAt)
+	})
+	if passkeys == nil {
+		passkeys = []*models.Passkey{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(PasskeyList{Passkeys: passkeys, RecoveryCodesRemaining: remaining}); err != nil {
+		authLog.Error("Failed to encode passkeys", err, nil)
+	}
+}
+
+// mayRegisterPasskey writes an error response and returns false unless the
+// user may register a passkey, returning the passkeys the user has
+func mayRegisterPasskey(w http.ResponseWriter, r *http.Request, user *User) ([]*models.Passkey, bool) {
+	if !IsAdmin(user) {
+		http.Error(w, "Passkeys are only available to admins", http.StatusForbidden)
+		return nil, false
+	}
+	passkeys, err := passkeyStore.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list passkeys", http.StatusInternalServerError)
+		authLog.Error("Failed to list passkeys", err, logger.Fields{"userID": user.ID})
+		return nil, false
+	}
+	if len(passkeys) > 0 && !RequireStepUp(w, r) {
+		return nil, false
+	}
+	return passkeys, true
+}
+
+// passkeyOptions writes the options creating a passkey for the user
+func passkeyOptions(w http.ResponseWriter, r *http.Request, user *User) {
+	passkeys, ok := mayRegisterPasskey(w, r, user)
+	if !ok {
+		return
+	}
+	challenge, err := issueChallenge(challengeRegister, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+		authLog.Error("Failed to create WebAuthn challenge", err, nil)
+		return
+	}
+	handle := sha256.Sum256([]byte(user.ID))
+	options := relyingParty.CreationOptions(challenge, webauthn.User{
+		ID:          handle[:],
+		Name:        user.Email,
+		DisplayName: user.Name,
+	}, credentialIDs(passkeys))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(options); err != nil {
+		authLog.Error("Failed to encode passkey options", err, nil)
+	}
+}
+
+// registerPasskey verifies and stores a passkey created by the user
+func registerPasskey(w http.ResponseWriter, r *http.Request, user *User) {
+	passkeys, ok := mayRegisterPasskey(w, r, user)
+	if !ok {
+		return
+	}
+
+	var requestBody struct {
+		Name       string                       `json:"name"`
+		Credential *webauthn.CredentialResponse `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Credential == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(requestBody.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	challenge, err := requestBody.Credential.Challenge()
+	if err == nil {
+		err = checkChallenge(r.Context(), challenge, challengeRegister, user.ID)
+	}
+	var credential *webauthn.Credential
+	if err == nil {
+		credential, err = relyingParty.VerifyRegistration(requestBody.Credential, challenge)
+	}
+	if err != nil {
+		http.Error(w, "Passkey registration failed: "+err.Error(), http.StatusBadRequest)
+		authLog.Warn("Passkey registration failed", logger.Fields{"userID": user.ID, "error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	passkey := &models.Passkey{
+		ID:        webauthn.EncodeID(credential.ID),
+		UserID:    user.ID,
+		Name:      name,
+		PublicKey: credential.PublicKey,
+		SignCount: credential.SignCount,
+		CreatedAt: now,
+	}
+	if err := passkeyStore.Create(r.Context(), passkey); err != nil {
+		http.Error(w, "Failed to register passkey", http.StatusConflict)
+		authLog.Error("Failed to store passkey", err, logger.Fields{"userID": user.ID})
+		return
+	}
+
+	response := passkeyRegistered{Passkey: passkey}
+	if len(passkeys) == 0 {
+		if response.RecoveryCodes, err = resetRecoveryCodes(r.Context(), user.ID); err != nil {
+			http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+			authLog.Error("Failed to create recovery codes", err, logger.Fields{"userID": user.ID})
+			return
+		}
+	}
+
+	authLog.Info("Passkey registered", logger.Fields{"userID": user.ID, "passkey": name})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		authLog.Error("Failed to encode passkey", err, nil)
+	}
+}
+
+// hashRecoveryCode returns the hash under which a recovery code is stored.
+// Codes are compared without case and dashes.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(hash[:])
+}
+
+// resetRecoveryCodes replaces the user's recovery codes with new ones,
+// returning them
+func resetRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(b)
+		code = code[:8] + "-" + code[8:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	err := passkeyStore.SetRecoveryCodes(ctx, &models.RecoveryCodes{UserID: userID, Hashes: hashes, CreatedAt: time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// HandlePasskey serves POST /api/auth/passkeys/options, the options of a new
+// passkey; POST /api/auth/passkeys/recovery-codes, which replaces the user's
+// recovery codes; and DELETE /api/auth/passkeys/{id}, which removes a
+// passkey. Replacing recovery codes and removing passkeys need a step-up
+// authentication.
+func HandlePasskey(w http.ResponseWriter, r *http.Request) {
+	user, ok := passkeyUser(w, r)
+	if !ok {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/auth/passkeys/")
+	switch {
+	case id == "options" && r.Method == http.MethodPost:
+		passkeyOptions(w, r, user)
+	case id == "recovery-codes" && r.Method == http.MethodPost:
+		regenerateRecoveryCodes(w, r, user)
+	case id != "" && !strings.Contains(id, "/") && r.Method == http.MethodDelete:
+		deletePasskey(w, r, user, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// regenerateRecoveryCodes replaces the user's recovery codes
+func regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, user *User) {
+	if !RequireStepUp(w, r) {
+		return
+	}
+	passkeys, err := passkeyStore.ListByUser(r.Context(), user.ID)
+	if err != nil || len(passkeys) == 0 {
+		http.Error(w, "Register a passkey first", http.StatusConflict)
+		return
+	}
+	codes, err := resetRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+		authLog.Error("Failed to create recovery codes", err, logger.Fields{"userID": user.ID})
+		return
+	}
+
+	authLog.Info("Recovery codes regenerated", logger.Fields{"userID": user.ID})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes}); err != nil {
+		authLog.Error("Failed to encode recovery codes", err, nil)
+	}
+}
+
+// deletePasskey removes one of the user's passkeys
+func deletePasskey(w http.ResponseWriter, r *http.Request, user *User, id string) {
+	passkeys, err := passkeyStore.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list passkeys", http.StatusInternalServerError)
+		authLog.Error("Failed to list passkeys", err, logger.Fields{"userID": user.ID})
+		return
+	}
+	found := false
+	for _, passkey := range passkeys {
+		found = found || passkey.ID == id
+	}
+	if !found {
+		http.Error(w, "Passkey not found", http.StatusNotFound)
+		return
+	}
+	if !RequireStepUp(w, r) {
+		return
+	}
+	if err := passkeyStore.Delete(r.Context(), id); err != nil {
+		http.Error(w, "Failed to delete passkey", http.StatusInternalServerError)
+		authLog.Error("Failed to delete passkey", err, logger.Fields{"userID": user.ID})
+		return
+	}
+
+	authLog.Info("Passkey deleted", logger.Fields{"userID": user.ID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StepUp is the response to a step-up authentication
+type StepUp struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	// RecoveryCodesRemaining is set when a recovery code was used
+	RecoveryCodesRemaining *int `json:"recovery_codes_remaining,omitempty"`
+}
+
+// HandleStepUp authenticates the current session with a passkey or a
+// recovery code (POST /api/auth/step-up) and serves the options asserting a
+// passkey (POST /api/auth/step-up/options). The request body holds either
+// the asserted "credential" or a "recovery_code"; a successful step-up lasts
+// for the step-up TTL.
+func HandleStepUp(w http.ResponseWriter, r *http.Request) {
+	user, ok := passkeyUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rejectIfLockedOut(w, r, identityKey(user.Email)) {
+		return
+	}
+	passkeys, err := passkeyStore.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list passkeys", http.StatusInternalServerError)
+		authLog.Error("Failed to list passkeys", err, logger.Fields{"userID": user.ID})
+		return
+	}
+	if len(passkeys) == 0 {
+		http.Error(w, "No passkey registered", http.StatusConflict)
+		return
+	}
+
+	if strings.TrimPrefix(r.URL.Path, "/api/auth/step-up") == "/options" {
+		stepUpOptions(w, user, passkeys)
+		return
+	}
+
+	var requestBody struct {
+		Credential   *webauthn.CredentialResponse `json:"credential"`
+		RecoveryCode string                       `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var result StepUp
+	switch {
+	case requestBody.Credential != nil:
+		err = assertPasskey(r.Context(), user, passkeys, requestBody.Credential)
+	case requestBody.RecoveryCode != "":
+		var remaining int
+		remaining, err = useRecoveryCode(r.Context(), user, requestBody.RecoveryCode)
+		result.RecoveryCodesRemaining = &remaining
+	default:
+		err = errors.New("a credential or a recovery code is required")
+	}
+	if err != nil {
+		recordLoginFailure(r, failureStepUp, user.Email)
+		http.Error(w, "Step-up authentication failed: "+err.Error(), http.StatusUnauthorized)
+		authLog.Warn("Step-up authentication failed", logger.Fields{"userID": user.ID, "error": err.Error()})
+		return
+	}
+
+	if result.ExpiresAt, err = setStepUpCookie(w, r, user); err != nil {
+		http.Error(w, "Failed to record step-up authentication", http.StatusInternalServerError)
+		authLog.Error("Failed to sign step-up token", err, nil)
+		return
+	}
+	authLog.Info("Step-up authentication succeeded", logger.Fields{
+		"userID":       user.ID,
+		"recoveryCode": result.RecoveryCodesRemaining != nil,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		authLog.Error("Failed to encode step-up response", err, nil)
+	}
+}
+
+// stepUpOptions writes the options asserting one of the user's passkeys
+func stepUpOptions(w http.ResponseWriter, user *User, passkeys []*models.Passkey) {
+	challenge, err := issueChallenge(challengeStepUp, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+		authLog.Error("Failed to create WebAuthn challenge", err, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(relyingParty.RequestOptions(challenge, credentialIDs(passkeys))); err != nil {
+		authLog.Error("Failed to encode step-up options", err, nil)
+	}
+}
+
+// assertPasskey verifies an assertion made with one of the user's passkeys
+// and records its use
+func assertPasskey(ctx context.Context, user *User, passkeys []*models.Passkey, response *webauthn.CredentialResponse) error {
+	id, err := response.CredentialID()
+	if err != nil {
+		return err
+	}
+	var passkey *models.Passkey
+	for _, candidate := range passkeys {
+		if subtle.ConstantTimeCompare([]byte(candidate.ID), []byte(webauthn.EncodeID(id))) == 1 {
+			passkey = candidate
+		}
+	}
+	if passkey == nil {
+		return errors.New("unknown passkey")
+	}
+
+	challenge, err := response.Challenge()
+	if err != nil {
+		return err
+	}
+	if err := checkChallenge(ctx, challenge, challengeStepUp, user.ID); err != nil {
+		return err
+	}
+	signCount, err := relyingParty.VerifyAssertion(response, challenge, webauthn.Credential{
+		ID:        id,
+		PublicKey: passkey.PublicKey,
+		SignCount: passkey.SignCount,
+	})
+	if err != nil {
+		return err
+	}
+
+	passkey.SignCount = signCount
+	passkey.LastUsedAt = time.Now()
+	if err := passkeyStore.RecordUse(ctx, passkey); err != nil {
+		authLog.Error("Failed to record passkey use", err, logger.Fields{"userID": user.ID})
+	}
+	return nil
+}
+
+// useRecoveryCode uses up one of the user's recovery codes, returning how
+// many remain
+func useRecoveryCode(ctx context.Context, user *User, code string) (int, error) {
+	used, err := passkeyStore.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return 0, err
+	}
+	if !used {
+		return 0, errors.New("invalid recovery code")
+	}
+	remaining, err := passkeyStore.RemainingRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if remaining == 0 {
+		authLog.Warn("Last recovery code used", logger.Fields{"userID": user.ID})
+	}
+	return remaining, nil
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/Okabe-Junya/golink-backend/pkg/webauthn"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupPasskeys enables auth and passkeys for the test
+func setupPasskeys(t *testing.T) *repositories.MemoryPasskeyStore {
+	t.Setenv("AUTH_DISABLED", "false")
+	trustTestProxy(t)
+	t.Setenv("SESSION_SECRET_KEY", "test-secret-key")
+	t.Setenv("GOOGLE_CLIENT_ID", "test-client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
+	require.NoError(t, InitSessionManager())
+	require.NoError(t, InitAuth())
+
+	store := repositories.NewMemoryPasskeyStore()
+	SetPasskeys(store, webauthn.RelyingParty{
+		ID:      "go.example.com",
+		Name:    "GoLink",
+		Origins: []string{"https://go.example.com"},
+	}, ratelimit.NewMemoryStore(), 0)
+	SetAdminEmails([]string{"admin@example.com"})
+	t.Cleanup(func() {
+		SetPasskeys(nil, webauthn.RelyingParty{}, nil, 0)
+		SetAdminEmails(nil)
+	})
+	return store
+}
+
+// adminRequest creates a request made by the admin, carrying cookies
+func adminRequest(method, target, body string, cookies ...*http.Cookie) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	signInAs(req, "admin", "admin@example.com")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestRequireStepUp(t *testing.T) {
+	store := setupPasskeys(t)
+	ctx := context.Background()
+
+	rr := httptest.NewRecorder()
+	assert.True(t, RequireStepUp(rr, adminRequest(http.MethodDelete, "/api/webhooks/1", "")),
+		"admins without passkeys need no step-up")
+
+	require.NoError(t, store.Create(ctx, &models.Passkey{ID: "cred", UserID: "admin", Name: "Laptop", CreatedAt: time.Now()}))
+	codes, err := resetRecoveryCodes(ctx, "admin")
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+
+	rr = httptest.NewRecorder()
+	assert.False(t, RequireStepUp(rr, adminRequest(http.MethodDelete, "/api/webhooks/1", "")))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), ErrStepUpRequired)
+
+	// Recovery codes are accepted without case and dashes, once
+	code := strings.ToLower(strings.ReplaceAll(codes[0], "-", ""))
+	rr = httptest.NewRecorder()
+	HandleStepUp(rr, adminRequest(http.MethodPost, "/api/auth/step-up", `{"recovery_code":"`+code+`"}`))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var result StepUp
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+	require.NotNil(t, result.RecoveryCodesRemaining)
+	assert.Equal(t, recoveryCodeCount-1, *result.RecoveryCodesRemaining)
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	rr = httptest.NewRecorder()
+	assert.True(t, RequireStepUp(rr, adminRequest(http.MethodDelete, "/api/webhooks/1", "", cookies...)))
+
+	t.Run("Cookie of another user", func(t *testing.T) {
+		req := adminRequest(http.MethodDelete, "/api/webhooks/1", "", cookies...)
+		req.Header.Set("X-User-ID", "someone-else")
+		require.NoError(t, store.Create(ctx, &models.Passkey{ID: "other", UserID: "someone-else", CreatedAt: time.Now()}))
+		assert.False(t, RequireStepUp(httptest.NewRecorder(), req))
+	})
+
+	t.Run("Tampered cookie", func(t *testing.T) {
+		tampered := *cookies[0]
+		tampered.Value = "x" + tampered.Value
+		assert.False(t, RequireStepUp(httptest.NewRecorder(), adminRequest(http.MethodDelete, "/api/webhooks/1", "", &tampered)))
+	})
+
+	t.Run("Used recovery code", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		HandleStepUp(rr, adminRequest(http.MethodPost, "/api/auth/step-up", `{"recovery_code":"`+codes[0]+`"}`))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestCheckChallenge(t *testing.T) {
+	setupPasskeys(t)
+	ctx := context.Background()
+
+	challenge, err := issueChallenge(challengeStepUp, "admin")
+	require.NoError(t, err)
+
+	assert.Error(t, checkChallenge(ctx, challenge, challengeRegister, "admin"), "challenges are bound to their purpose")
+	assert.Error(t, checkChallenge(ctx, challenge, challengeStepUp, "someone-else"), "challenges are bound to their user")
+	require.NoError(t, checkChallenge(ctx, challenge, challengeStepUp, "admin"))
+	assert.ErrorContains(t, checkChallenge(ctx, challenge, challengeStepUp, "admin"), "already answered")
+
+	tampered, err := issueChallenge(challengeStepUp, "admin")
+	require.NoError(t, err)
+	tampered[0] ^= 1
+	assert.Error(t, checkChallenge(ctx, tampered, challengeStepUp, "admin"))
+}
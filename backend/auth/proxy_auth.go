@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+)
+
+// ProxySecretHeader carries the shared secret a trusted proxy proves itself
+// with. The proxy must strip it, and the X-User-* headers, from the requests
+// of clients.
+const ProxySecretHeader = "X-Proxy-Secret"
+
+var (
+	proxyAuthMutex sync.RWMutex
+	// Secrets of the trusted proxies; none disables proxy authentication
+	proxyAuthSecrets [][]byte
+)
+
+// SetTrustedProxyAuth lets an authenticating proxy in front of the service
+// name the user of a request in the X-User-ID, X-User-Email and X-User-Name
+// headers. Only requests carrying one of secrets in the X-Proxy-Secret header
+// are trusted; several secrets allow rotating them. No secrets disables it.
+func SetTrustedProxyAuth(secrets []string) {
+	trusted := make([][]byte, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret != "" {
+			trusted = append(trusted, []byte(secret))
+		}
+	}
+
+	proxyAuthMutex.Lock()
+	defer proxyAuthMutex.Unlock()
+	proxyAuthSecrets = trusted
+}
+
+// trustedProxyUser returns the user named by the X-User-* headers of a
+// request sent by a trusted proxy
+func trustedProxyUser(r *http.Request) (*User, bool) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return nil, false
+	}
+
+	proxyAuthMutex.RLock()
+	defer proxyAuthMutex.RUnlock()
+	if len(proxyAuthSecrets) == 0 {
+		return nil, false
+	}
+	secret := []byte(r.Header.Get(ProxySecretHeader))
+	for _, trusted := range proxyAuthSecrets {
+		if subtle.ConstantTimeCompare(secret, trusted) == 1 {
+			return &User{
+				ID:    userID,
+				Email: r.Header.Get("X-User-Email"),
+				Name:  r.Header.Get("X-User-Name"),
+			}, true
+		}
+	}
+
+	authLog.Warn("Ignored user headers without a trusted proxy secret", logger.Fields{
+		"ip": ClientIP(r),
+	})
+	return nil, false
+}
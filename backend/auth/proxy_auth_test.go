@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+)
+
+// testProxySecret is the secret of the authenticating proxy trusted by tests
+const testProxySecret = "test-proxy-secret"
+
+// trustTestProxy trusts the user headers of requests signed in with signInAs
+func trustTestProxy(t *testing.T) {
+	SetTrustedProxyAuth([]string{testProxySecret})
+	t.Cleanup(func() { SetTrustedProxyAuth(nil) })
+}
+
+// signInAs makes req a request of the user, sent through the trusted test proxy
+func signInAs(req *http.Request, userID, email string) {
+	req.Header.Set("X-User-ID", userID)
+	if email != "" {
+		req.Header.Set("X-User-Email", email)
+	}
+	req.Header.Set(ProxySecretHeader, testProxySecret)
+}
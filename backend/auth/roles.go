@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	pkgerrors "github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// roleCacheTTL is how long a role read from the store is reused, so checking
+// the role of every request does not read the store every time. Changes made
+// on another instance take up to this long to apply.
+const roleCacheTTL = time.Minute
+
+var (
+	roleMutex sync.RWMutex
+	// Store of the roles assigned to users; nil gives everyone the default role
+	roleStore interfaces.UserRoleStore
+	// Role of users without one assigned
+	defaultRole = models.RoleEditor
+	// Roles recently read from the store by email; "" means none is assigned
+	roleCache = map[string]cachedRole{}
+)
+
+// cachedRole is a role read from the store, and when to read it again
+type cachedRole struct {
+	expires time.Time
+	role    string
+}
+
+// SetRoleStore enables role assignments kept in store. Users without an
+// assigned role get role, which must be viewer or editor; admins are the
+// users assigned the admin role and those of ADMIN_EMAILS. Passing a nil store
+// gives every user the default role.
+func SetRoleStore(store interfaces.UserRoleStore, role string) {
+	roleMutex.Lock()
+	defer roleMutex.Unlock()
+	roleStore = store
+	defaultRole = role
+	roleCache = map[string]cachedRole{}
+}
+
+// storedRole returns the role assigned to the user with email, or "" when
+// none is
+func storedRole(ctx context.Context, email string) string {
+	email = strings.ToLower(email)
+	roleMutex.RLock()
+	store := roleStore
+	cached, found := roleCache[email]
+	roleMutex.RUnlock()
+	if store == nil || email == "" {
+		return ""
+	}
+	if found && time.Now().Before(cached.expires) {
+		return cached.role
+	}
+
+	var role string
+	assigned, err := store.Get(ctx, email)
+	switch {
+	case err == nil:
+		role = assigned.Role
+	case !pkgerrors.Is(err, pkgerrors.ErrNotFound):
+		// Fall back to the default role, without caching the failure
+		authLog.Error("Failed to look up user role", err, logger.Fields{"email": email})
+		return ""
+	}
+
+	roleMutex.Lock()
+	roleCache[email] = cachedRole{role: role, expires: time.Now().Add(roleCacheTTL)}
+	roleMutex.Unlock()
+	return role
+}
+
+// forgetRole drops the cached role of the user with email
+func forgetRole(email string) {
+	roleMutex.Lock()
+	defer roleMutex.Unlock()
+	delete(roleCache, email)
+}
+
+// RoleOf returns the role of user. With authentication disabled there are no
+// identities, so everyone is an admin.
+func RoleOf(ctx context.Context, user *User) string {
+	if !authEnabled {
+		return models.RoleAdmin
+	}
+	if user == nil {
+		return ""
+	}
+	if IsAdmin(user) {
+		return models.RoleAdmin
+	}
+
+	switch role := storedRole(ctx, user.Email); role {
+	case "":
+		roleMutex.RLock()
+		defer roleMutex.RUnlock()
+		return defaultRole
+	case models.RoleAdmin:
+		// An admin's API key without the admin scope
+		return models.RoleEditor
+	default:
+		return role
+	}
+}
+
+// RequireRole writes an error response and returns false unless the request
+// comes from a user with role, or a role above it
+func RequireRole(w http.ResponseWriter, r *http.Request, role string) bool {
+	if !authEnabled {
+		return true
+	}
+	user, err := GetCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if !models.RoleIncludes(RoleOf(r.Context(), user), role) {
+		http.Error(w, fmt.Sprintf("The %s role is required", role), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// HandleUserRoles lists the roles assigned to users
+// (GET /api/admin/users). Only admins may use it.
+func HandleUserRoles(w http.ResponseWriter, r *http.Request) {
+	store := currentRoleStore()
+	if store == nil {
+		http.Error(w, "Roles are disabled", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	roles, err := store.List(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		authLog.Error("Failed to list user roles", err, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(roles); err != nil {
+		authLog.Error("Failed to encode user roles", err, nil)
+	}
+}
+
+// HandleUserRole assigns a role to a user (PUT /api/admin/users/{email} with
+// {"role": "viewer"}) and removes it, giving the user the default role again
+// (DELETE). Only admins may use it.
+func HandleUserRole(w http.ResponseWriter, r *http.Request) {
+	store := currentRoleStore()
+	if store == nil {
+		http.Error(w, "Roles are disabled", http.StatusNotImplemented)
+		return
+	}
+	email := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/admin/users/"))
+	if email == "" || strings.Contains(email, "/") {
+		http.Error(w, "User email is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		setUserRole(w, r, store, email)
+	case http.MethodDelete:
+		removeUserRole(w, r, store, email)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// currentRoleStore returns the store of roles, nil when roles are disabled
+func currentRoleStore() interfaces.UserRoleStore {
+	roleMutex.RLock()
+	defer roleMutex.RUnlock()
+	return roleStore
+}
+
+// setUserRole assigns the role of the request body to the user with email
+func setUserRole(w http.ResponseWriter, r *http.Request, store interfaces.UserRoleStore, email string) {
+	var requestBody struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !models.IsRole(requestBody.Role) {
+		http.Error(w, fmt.Sprintf("Unknown role '%s'", requestBody.Role), http.StatusBadRequest)
+		return
+	}
+	if !RequireStepUp(w, r) {
+		return
+	}
+
+	var updatedBy string
+	if user, err := GetCurrentUser(r); err == nil {
+		updatedBy = user.ID
+	}
+	role := &models.UserRole{
+		Email:     email,
+		Role:      requestBody.Role,
+		UpdatedBy: updatedBy,
+		UpdatedAt: time.Now(),
+	}
+	if err := store.Set(r.Context(), role); err != nil {
+		http.Error(w, "Failed to assign role", http.StatusInternalServerError)
+		authLog.Error("Failed to store user role", err, logger.Fields{"email": email})
+		return
+	}
+	forgetRole(email)
+
+	authLog.Info("User role assigned", logger.Fields{
+		"email":     email,
+		"role":      role.Role,
+		"updatedBy": updatedBy,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(role); err != nil {
+		authLog.Error("Failed to encode user role", err, nil)
+	}
+}
+
+// removeUserRole removes the role assigned to the user with email
+func removeUserRole(w http.ResponseWriter, r *http.Request, store interfaces.UserRoleStore, email string) {
+	if !RequireStepUp(w, r) {
+		return
+	}
+	if err := store.Delete(r.Context(), email); err != nil {
+		if pkgerrors.Is(err, pkgerrors.ErrNotFound) {
+			http.Error(w, "User has no role assigned", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to remove role", http.StatusInternalServerError)
+		authLog.Error("Failed to delete user role", err, logger.Fields{"email": email})
+		return
+	}
+	forgetRole(email)
+
+	authLog.Info("User role removed", logger.Fields{"email": email})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupRoles enables auth and roles kept in memory for the test
+func setupRoles(t *testing.T, defaultRole string) *repositories.MemoryUserRoleStore {
+	t.Setenv("AUTH_DISABLED", "false")
+	trustTestProxy(t)
+	t.Setenv("GOOGLE_CLIENT_ID", "test-client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
+	require.NoError(t, InitAuth())
+
+	store := repositories.NewMemoryUserRoleStore()
+	SetRoleStore(store, defaultRole)
+	SetAdminEmails([]string{"root@example.com"})
+	t.Cleanup(func() {
+		SetRoleStore(nil, models.RoleEditor)
+		SetAdminEmails(nil)
+	})
+	return store
+}
+
+// roleRequest sends a request to the user role handlers as the user with email
+func roleRequest(method, email string, body any) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, "/api/admin/users/"+"Ann@Example.com", bytes.NewReader(payload))
+	signInAs(req, email, email)
+	rr := httptest.NewRecorder()
+	if RequireRole(rr, req, models.RoleAdmin) {
+		HandleUserRole(rr, req)
+	}
+	return rr
+}
+
+func TestRoleOf(t *testing.T) {
+	store := setupRoles(t, models.RoleViewer)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, &models.UserRole{Email: "ed@example.com", Role: models.RoleEditor}))
+	require.NoError(t, store.Set(ctx, &models.UserRole{Email: "boss@example.com", Role: models.RoleAdmin}))
+
+	assert.Equal(t, models.RoleViewer, RoleOf(ctx, &User{Email: "new@example.com"}))
+	assert.Equal(t, models.RoleEditor, RoleOf(ctx, &User{Email: "Ed@example.com"}))
+	assert.Equal(t, models.RoleAdmin, RoleOf(ctx, &User{Email: "boss@example.com"}))
+	assert.Equal(t, models.RoleAdmin, RoleOf(ctx, &User{Email: "root@example.com"}))
+	assert.True(t, IsAdmin(&User{Email: "boss@example.com"}))
+
+	// API keys of admins act as editors without the admin scope
+	key := &User{Email: "boss@example.com", TokenID: "t1", TokenScopes: []string{models.TokenScopeWrite}}
+	assert.False(t, IsAdmin(key))
+	assert.Equal(t, models.RoleEditor, RoleOf(ctx, key))
+}
+
+func TestHandleUserRole(t *testing.T) {
+	setupRoles(t, models.RoleEditor)
+
+	// Only admins manage roles
+	assert.Equal(t, http.StatusForbidden, roleRequest(http.MethodPut, "ed@example.com", map[string]string{"role": "admin"}).Code)
+	assert.Equal(t, http.StatusBadRequest, roleRequest(http.MethodPut, "root@example.com", map[string]string{"role": "owner"}).Code)
+
+	rr := roleRequest(http.MethodPut, "root@example.com", map[string]string{"role": models.RoleViewer})
+	require.Equal(t, http.StatusOK, rr.Code)
+	var role models.UserRole
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &role))
+	assert.Equal(t, "ann@example.com", role.Email)
+	assert.Equal(t, "root@example.com", role.UpdatedBy)
+
+	// The new role applies at once, and removing it restores the default
+	ann := &User{Email: "ann@example.com"}
+	assert.Equal(t, models.RoleViewer, RoleOf(context.Background(), ann))
+	assert.Equal(t, http.StatusNoContent, roleRequest(http.MethodDelete, "root@example.com", nil).Code)
+	assert.Equal(t, models.RoleEditor, RoleOf(context.Background(), ann))
+	assert.Equal(t, http.StatusNotFound, roleRequest(http.MethodDelete, "root@example.com", nil).Code)
+}
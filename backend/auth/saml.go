@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/saml"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// samlRequestCookieName is the cookie holding the ID of the authentication
+// request a SAML response must answer
+const samlRequestCookieName = "saml_request"
+
+// Attributes the email and name of SAML users are read from by default
+var (
+	defaultSAMLEmailAttributes = []string{"email", "mail", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"}
+	defaultSAMLNameAttributes  = []string{"displayName", "name", "http://schemas.microsoft.com/identity/claims/displayname"}
+)
+
+var (
+	// SAML service provider replacing the Google sign-in when set
+	samlProvider *saml.ServiceProvider
+	// Assertion attributes holding the email and the name of users, tried in order
+	samlEmailAttributes []string
+	samlNameAttributes  []string
+)
+
+// SAMLAttributes names the assertion attributes users are read from. The
+// first attribute of each list the assertion has is used.
+type SAMLAttributes struct {
+	Email []string
+	Name  []string
+}
+
+// SetSAMLProvider makes users sign in through the SAML identity provider of
+// sp instead of with Google, reading them from the attributes. Empty
+// attribute lists use common attribute names. Passing nil restores Google.
+func SetSAMLProvider(sp *saml.ServiceProvider, attributes SAMLAttributes) {
+	samlProvider = sp
+	samlEmailAttributes = attributes.Email
+	if len(samlEmailAttributes) == 0 {
+		samlEmailAttributes = defaultSAMLEmailAttributes
+	}
+	samlNameAttributes = attributes.Name
+	if len(samlNameAttributes) == 0 {
+		samlNameAttributes = defaultSAMLNameAttributes
+	}
+}
+
+// samlCookie returns a cookie for the SAML flow. Identity providers post
+// their responses from another site, so over HTTPS the request cookie must
+// be SameSite=None to come back with them.
+func samlCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	secure := r.TLS != nil || strings.HasPrefix(samlProvider.ACSURL, "https://")
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	return &http.Cookie{
+		Name:     samlRequestCookieName,
+		Value:    value,
+		Path:     "/api/auth/saml",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+		MaxAge:   maxAge,
+	}
+}
+
+// handleSAMLLogin redirects the user to the identity provider with an
+// authentication request
+func handleSAMLLogin(w http.ResponseWriter, r *http.Request) {
+	_, span := startSpan(r, "auth.saml_login")
+	defer span.End()
+	LoginAttemptsTotal.Inc()
+
+	redirectURL, requestID, err := samlProvider.AuthnRequestURL("")
+	if err != nil {
+		endSpan(span, err)
+		http.Error(w, "Failed to generate login URL", http.StatusInternalServerError)
+		authLog.Error("Failed to create SAML authentication request", err, nil)
+		return
+	}
+	http.SetCookie(w, samlCookie(r, requestID, int(stateCookieTTL.Seconds())))
+	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+}
+
+// HandleSAMLMetadata serves the service provider metadata identity providers
+// are configured with (GET /api/auth/saml/metadata)
+func HandleSAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	if !authEnabled || samlProvider == nil {
+		http.Error(w, "SAML sign-in is not enabled", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metadata, err := samlProvider.Metadata()
+	if err != nil {
+		http.Error(w, "Failed to generate metadata", http.StatusInternalServerError)
+		authLog.Error("Failed to generate SAML metadata", err, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	if _, err := w.Write(metadata); err != nil {
+		authLog.Error("Failed to write SAML metadata", err, nil)
+	}
+}
+
+// HandleSAMLACS is the assertion consumer service: it signs in the user of
+// the response the identity provider posts (POST /api/auth/saml/acs) and
+// redirects them to the frontend
+func HandleSAMLACS(w http.ResponseWriter, r *http.Request) {
+	if !authEnabled || samlProvider == nil {
+		http.Error(w, "SAML sign-in is not enabled", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := startSpan(r, "auth.saml_acs")
+	defer span.End()
+
+	if rejectIfLockedOut(w, r, "ip:"+ClientIP(r)) {
+		return
+	}
+
+	requestCookie, err := r.Cookie(samlRequestCookieName)
+	if err != nil {
+		recordLoginFailure(r, failureMissingStateCookie, "")
+		span.SetAttributes(attribute.String("auth.failure_reason", failureMissingStateCookie))
+		http.Error(w, "No sign-in in progress", http.StatusBadRequest)
+		return
+	}
+	// A request is answered once
+	http.SetCookie(w, samlCookie(r, "", -1))
+
+	assertion, err := samlProvider.ParseResponse(r.PostFormValue("SAMLResponse"), requestCookie.Value)
+	if err != nil {
+		recordLoginFailure(r, failureBadAssertion, "")
+		span.SetAttributes(attribute.String("auth.failure_reason", failureBadAssertion))
+		authLog.Warn("Rejected SAML response", logger.Fields{
+			"error": err.Error(),
+			"ip":    ClientIP(r),
+		})
+		http.Error(w, "Invalid SAML response", http.StatusUnauthorized)
+		return
+	}
+
+	user := samlUser(assertion)
+	if user.Email == "" {
+		recordLoginFailure(r, failureBadAssertion, user.ID)
+		authLog.Warn("SAML assertion has no email", logger.Fields{"nameID": user.ID})
+		http.Error(w, "The identity provider did not send an email address", http.StatusUnauthorized)
+		return
+	}
+	if rejectIfLockedOut(w, r, identityKey(user.Email)) {
+		return
+	}
+
+	token, detail, err := issueSessionToken(ctx, user, r)
+	if err != nil {
+		endSpan(span, err)
+		LoginFailuresTotal.WithLabelValues(failureSession).Inc()
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		authLog.Error("SAML login failed: "+detail, err, logger.Fields{"email": user.Email})
+		return
+	}
+
+	LoginSuccessesTotal.Inc()
+	span.SetAttributes(attribute.String("enduser.id", user.ID))
+	resetLoginFailures(ctx, r, user.Email)
+	setSessionCookie(w, r, token)
+
+	// The response was posted, so the browser is sent on with a GET
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "/"
+	}
+	http.Redirect(w, r, frontendURL, http.StatusSeeOther)
+}
+
+// samlUser maps an assertion to the user it signs in. The user is
+// identified by their NameID; the email falls back to a NameID that is one.
+func samlUser(assertion *saml.Assertion) *User {
+	user := &User{
+		ID:            assertion.NameID,
+		Email:         assertion.Attribute(samlEmailAttributes...),
+		Name:          assertion.Attribute(samlNameAttributes...),
+		VerifiedEmail: true,
+	}
+	if user.Email == "" && strings.Contains(assertion.NameID, "@") {
+		user.Email = assertion.NameID
+	}
+	if user.Name == "" {
+		user.Name = user.Email
+	}
+	if _, domain, ok := strings.Cut(user.Email, "@"); ok {
+		user.Domain = domain
+	}
+	return user
+}
@@ -0,0 +1,111 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/pkg/saml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSAML enables sign-in through a SAML identity provider
+func setupSAML(t *testing.T) {
+	t.Setenv("AUTH_DISABLED", "false")
+	t.Setenv("AUTH_PROVIDER", "saml")
+	t.Setenv("SESSION_SECRET_KEY", "test-secret-key")
+	require.NoError(t, auth.InitSessionManager())
+	require.NoError(t, auth.InitAuth())
+	require.True(t, auth.IsAuthEnabled(), "SAML sign-in needs no Google credentials")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	idp := &saml.IdentityProvider{
+		EntityID:     "https://idp.example.com/metadata",
+		SSOURL:       "https://idp.example.com/sso",
+		Certificates: []*x509.Certificate{certificate},
+	}
+	auth.SetSAMLProvider(saml.New("https://go.example.com/api/auth/saml/metadata", "https://go.example.com/api/auth/saml/acs", idp), auth.SAMLAttributes{})
+	t.Cleanup(func() { auth.SetSAMLProvider(nil, auth.SAMLAttributes{}) })
+}
+
+func TestSAMLLogin(t *testing.T) {
+	setupSAML(t)
+
+	rr := httptest.NewRecorder()
+	auth.HandleSAMLMetadata(rr, httptest.NewRequest(http.MethodGet, "/api/auth/saml/metadata", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/samlmetadata+xml", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), `Location="https://go.example.com/api/auth/saml/acs"`)
+
+	// Signing in redirects to the identity provider, remembering the request
+	rr = httptest.NewRecorder()
+	auth.HandleLogin(rr, httptest.NewRequest(http.MethodGet, "/api/auth/login", nil))
+	require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "idp.example.com", location.Host)
+	assert.NotEmpty(t, location.Query().Get("SAMLRequest"))
+	cookies := rr.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, http.SameSiteNoneMode, cookies[0].SameSite, "the response is posted from the identity provider's site")
+	assert.True(t, cookies[0].Secure)
+
+	// Responses need a sign-in in progress and a valid signature
+	post := func(cookie *http.Cookie, response string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/saml/acs",
+			strings.NewReader(url.Values{"SAMLResponse": {response}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		auth.HandleSAMLACS(rr, req)
+		return rr
+	}
+	assert.Equal(t, http.StatusBadRequest, post(nil, "").Code)
+	rr = post(cookies[0], "PHNhbWxwOlJlc3BvbnNlLz4=")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Empty(t, sessionCookie(rr), "no session without a valid response")
+}
+
+func TestSAMLDisabled(t *testing.T) {
+	rr := httptest.NewRecorder()
+	auth.HandleSAMLMetadata(rr, httptest.NewRequest(http.MethodGet, "/api/auth/saml/metadata", nil))
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+
+	rr = httptest.NewRecorder()
+	auth.HandleSAMLACS(rr, httptest.NewRequest(http.MethodPost, "/api/auth/saml/acs", nil))
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+}
+
+// sessionCookie returns the session token set by a response, or ""
+func sessionCookie(rr *httptest.ResponseRecorder) string {
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == "session_token" && cookie.MaxAge >= 0 {
+			return cookie.Value
+		}
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -11,8 +12,6 @@ import (
 	"os"
 	"strings"
 	"time"
-
-	"github.com/Okabe-Junya/golink-backend/logger"
 )
 
 var (
@@ -20,14 +19,18 @@ var (
 	secretKey []byte
 )
 
+// sessionTTL is how long a session token remains valid
+const sessionTTL = 7 * 24 * time.Hour
+
 // SessionClaims represents the data stored in a session token
 type SessionClaims struct {
 	ExpiresAt time.Time `json:"expires_at"`
 
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Name   string `json:"name"`
-	Domain string `json:"domain"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	Domain    string `json:"domain"`
+	SessionID string `json:"sid,omitempty"`
 }
 
 // InitSessionManager initializes the session management system
@@ -35,7 +38,7 @@ func InitSessionManager() error {
 	// Skip if auth is disabled
 	authDisabled := os.Getenv("AUTH_DISABLED")
 	if strings.ToLower(authDisabled) == "true" {
-		logger.Info("Session management is disabled as authentication is disabled", nil)
+		authLog.Info("Session management is disabled as authentication is disabled", nil)
 		return nil
 	}
 
@@ -48,7 +51,7 @@ func InitSessionManager() error {
 			return fmt.Errorf("failed to generate secret key: %w", err)
 		}
 		secretKey = key
-		logger.Warn("Generated random SESSION_SECRET_KEY; sessions will be invalidated on restart", nil)
+		authLog.Warn("Generated random SESSION_SECRET_KEY; sessions will be invalidated on restart", nil)
 	} else {
 		// Use the provided secret key
 		secretKey = []byte(keyString)
@@ -75,7 +78,8 @@ func CreateSessionToken(user *User) (string, error) {
 		Email:     user.Email,
 		Name:      user.Name,
 		Domain:    user.Domain,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 7), // 7 days
+		SessionID: user.SessionID,
+		ExpiresAt: time.Now().Add(sessionTTL),
 	}
 
 	// Serialize claims
@@ -98,8 +102,20 @@ func CreateSessionToken(user *User) (string, error) {
 	return token, nil
 }
 
-// ValidateSessionToken validates a session token and returns the user
-func ValidateSessionToken(token string) (*User, error) {
+// ValidateSessionToken validates a session token and returns the user. ctx
+// bounds the session store lookup of the token's session.
+func ValidateSessionToken(ctx context.Context, token string) (*User, error) {
+	user, err := validateSessionToken(ctx, token)
+	if err != nil {
+		TokenValidationsTotal.WithLabelValues("invalid").Inc()
+		return nil, err
+	}
+	TokenValidationsTotal.WithLabelValues("valid").Inc()
+	return user, nil
+}
+
+// validateSessionToken performs the signature, expiry and session checks of a token
+func validateSessionToken(ctx context.Context, token string) (*User, error) {
 	// Check if auth is disabled
 	if !IsAuthEnabled() {
 		return nil, errors.New("authentication is disabled")
@@ -145,12 +161,20 @@ func ValidateSessionToken(token string) (*User, error) {
 		return nil, errors.New("token expired")
 	}
 
+	// Check the server-side session record if session tracking is enabled
+	if sessionStore != nil {
+		if err := checkSession(ctx, claims.SessionID); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create user
 	user := &User{
-		ID:     claims.UserID,
-		Email:  claims.Email,
-		Name:   claims.Name,
-		Domain: claims.Domain,
+		ID:        claims.UserID,
+		Email:     claims.Email,
+		Name:      claims.Name,
+		Domain:    claims.Domain,
+		SessionID: claims.SessionID,
 	}
 
 	return user, nil
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/cache"
+)
+
+const (
+	// activeSessionTTL is how long a session found active is trusted without
+	// reading the session store again. Revocations through this replica take
+	// effect at once, those through other replicas within this time.
+	activeSessionTTL = 30 * time.Second
+	// activeSessionCacheSize bounds the number of sessions remembered
+	activeSessionCacheSize = 10000
+)
+
+var (
+	// Server-side session store; nil keeps sessions stateless
+	sessionStore interfaces.SessionStore
+	// Maximum number of concurrent sessions per user (0 = unlimited)
+	maxSessionsPerUser int
+	// Sessions recently found active, so that each request does not cost a
+	// session store read
+	activeSessions cache.Store = cache.NewMemoryStore(activeSessionCacheSize)
+)
+
+// SetSessionStore enables server-side session tracking. When a store is set,
+// every issued token carries a session ID that must refer to an active record,
+// which makes revocation and device listing possible. Passing nil restores
+// stateless sessions.
+func SetSessionStore(store interfaces.SessionStore, maxSessions int) {
+	sessionStore = store
+	maxSessionsPerUser = maxSessions
+	activeSessions = cache.NewMemoryStore(activeSessionCacheSize)
+}
+
+// generateSessionID creates a random session identifier
+func generateSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// startSession records a new session for the user and enforces the concurrent-session limit
+func startSession(ctx context.Context, user *User, r *http.Request) (string, error) {
+	id, err := generateSessionID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	session := models.NewSession(id, user.ID, user.Email, sessionTTL)
+	session.UserAgent = r.UserAgent()
+	session.IPAddress = ClientIP(r)
+
+	if err := sessionStore.Create(ctx, session); err != nil {
+		return "", fmt.Errorf("failed to store session: %w", err)
+	}
+
+	if maxSessionsPerUser > 0 {
+		enforceSessionLimit(ctx, user.ID)
+	}
+
+	return id, nil
+}
+
+// enforceSessionLimit revokes the oldest active sessions of a user above the limit
+func enforceSessionLimit(ctx context.Context, userID string) {
+	sessions, err := sessionStore.ListByUser(ctx, userID)
+	if err != nil {
+		authLog.Error("Failed to list sessions for limit enforcement", err, logger.Fields{"userID": userID})
+		return
+	}
+
+	var active []*models.Session
+	for _, s := range sessions {
+		if s.IsActive() {
+			active = append(active, s)
+		}
+	}
+	if len(active) <= maxSessionsPerUser {
+		return
+	}
+
+	// Oldest first
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.Before(active[j].CreatedAt)
+	})
+
+	for _, s := range active[:len(active)-maxSessionsPerUser] {
+		forgetSession(ctx, s.ID)
+		if err := sessionStore.Revoke(ctx, s.ID); err != nil {
+			authLog.Error("Failed to revoke session over limit", err, logger.Fields{"sessionID": s.ID})
+			continue
+		}
+		SessionRevocationsTotal.WithLabelValues(revocationLimit).Inc()
+		authLog.Info("Revoked session over concurrent-session limit", logger.Fields{
+			"userID":    userID,
+			"sessionID": s.ID,
+		})
+	}
+}
+
+// checkSession verifies that a session ID refers to an active session
+func checkSession(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("token is not bound to a session")
+	}
+	if _, ok, _ := activeSessions.Get(ctx, id); ok {
+		return nil
+	}
+	session, err := sessionStore.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("session lookup failed: %w", err)
+	}
+	if !session.IsActive() {
+		return errors.New("session revoked or expired")
+	}
+	if ttl := min(activeSessionTTL, time.Until(session.ExpiresAt)); ttl > 0 {
+		_ = activeSessions.Set(ctx, id, []byte{1}, ttl)
+	}
+	return nil
+}
+
+// forgetSession drops a session from the sessions known to be active, so
+// that its revocation takes effect at once
+func forgetSession(ctx context.Context, id string) {
+	_ = activeSessions.Delete(ctx, id)
+}
+
+// revokeSession revokes the session with the given ID if session tracking is enabled
+func revokeSession(ctx context.Context, id, reason string) {
+	if sessionStore == nil || id == "" {
+		return
+	}
+	forgetSession(ctx, id)
+	if err := sessionStore.Revoke(ctx, id); err != nil {
+		authLog.Error("Failed to revoke session", err, logger.Fields{"sessionID": id})
+		return
+	}
+	SessionRevocationsTotal.WithLabelValues(reason).Inc()
+}
+
+// trustedProxyHops is the number of proxies in front of the service that
+// append the address they received a request from to X-Forwarded-For
+var trustedProxyHops atomic.Int32
+
+// SetTrustedProxyHops sets the number of trusted proxies in front of the
+// service. Zero, the default, ignores X-Forwarded-For altogether.
+func SetTrustedProxyHops(hops int) {
+	trustedProxyHops.Store(int32(max(hops, 0)))
+}
+
+// ClientIP returns the originating client IP of the request, without the
+// port so that all connections from one client share the same identity.
+// Clients may put anything in X-Forwarded-For, so only the entry appended by
+// the outermost trusted proxy, as many hops from the right as there are
+// trusted proxies, is used. Otherwise the peer address is the client's.
+func ClientIP(r *http.Request) string {
+	if hops := int(trustedProxyHops.Load()); hops > 0 {
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, addr := range strings.Split(header, ",") {
+				forwarded = append(forwarded, strings.TrimSpace(addr))
+			}
+		}
+		if len(forwarded) >= hops {
+			return forwarded[len(forwarded)-hops]
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// sessionInfo is the view of a session returned to its owner
+type sessionInfo struct {
+	*models.Session
+	Current bool `json:"current"`
+}
+
+// HandleListSessions returns the active sessions of the current user
+func HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if sessionStore == nil {
+		http.Error(w, "Session tracking is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	user, err := GetCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := sessionStore.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		authLog.Error("Failed to list sessions", err, logger.Fields{"userID": user.ID})
+		return
+	}
+
+	result := make([]sessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		if !s.IsActive() {
+			continue
+		}
+		result = append(result, sessionInfo{Session: s, Current: s.ID == user.SessionID})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		authLog.Error("Failed to encode sessions", err, nil)
+	}
+}
+
+// HandleRevokeSession revokes one of the current user's sessions (DELETE /api/auth/sessions/{id})
+func HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if sessionStore == nil {
+		http.Error(w, "Session tracking is disabled", http.StatusNotImplemented)
+		return
+	}
+
+	user, err := GetCurrentUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/auth/sessions/")
+	if id == "" {
+		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+
+	session, err := sessionStore.Get(r.Context(), id)
+	if err != nil || session.UserID != user.ID {
+		// Do not reveal whether another user's session exists
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	forgetSession(r.Context(), id)
+	if err := sessionStore.Revoke(r.Context(), id); err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		authLog.Error("Failed to revoke session", err, logger.Fields{"sessionID": id})
+		return
+	}
+	SessionRevocationsTotal.WithLabelValues(revocationUser).Inc()
+
+	authLog.Info("Session revoked", logger.Fields{
+		"userID":    user.ID,
+		"sessionID": id,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
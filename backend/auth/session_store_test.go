@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSessionStore enables auth with an in-memory session store for the test
+func setupSessionStore(t *testing.T, maxSessions int) *repositories.MemorySessionStore {
+	t.Setenv("AUTH_DISABLED", "false")
+	t.Setenv("SESSION_SECRET_KEY", "test-secret-key")
+	t.Setenv("GOOGLE_CLIENT_ID", "test-client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
+	require.NoError(t, InitSessionManager())
+	require.NoError(t, InitAuth())
+
+	store := repositories.NewMemorySessionStore()
+	SetSessionStore(store, maxSessions)
+	t.Cleanup(func() { SetSessionStore(nil, 0) })
+	return store
+}
+
+func TestSessionStoreRevocation(t *testing.T) {
+	store := setupSessionStore(t, 0)
+	ctx := context.Background()
+
+	user := &User{ID: "user-1", Email: "user1@example.com"}
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/callback", nil)
+	sessionID, err := startSession(ctx, user, req)
+	require.NoError(t, err)
+	user.SessionID = sessionID
+
+	token, err := CreateSessionToken(user)
+	require.NoError(t, err)
+
+	validated, err := ValidateSessionToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, sessionID, validated.SessionID)
+
+	// Revoked through another replica, the session is rejected once this one
+	// no longer remembers it as active
+	require.NoError(t, store.Revoke(ctx, sessionID))
+	forgetSession(ctx, sessionID)
+	_, err = ValidateSessionToken(ctx, token)
+	assert.Error(t, err, "revoked session must not validate")
+}
+
+// countingSessionStore counts the reads of sessions and keeps the error of
+// the context of the last one
+type countingSessionStore struct {
+	*repositories.MemorySessionStore
+	lastErr error
+	reads   int
+}
+
+func (s *countingSessionStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	s.reads++
+	s.lastErr = ctx.Err()
+	return s.MemorySessionStore.Get(ctx, id)
+}
+
+func TestSessionStoreActiveSessionCache(t *testing.T) {
+	setupSessionStore(t, 0)
+	store := &countingSessionStore{MemorySessionStore: repositories.NewMemorySessionStore()}
+	SetSessionStore(store, 0)
+	ctx := context.Background()
+
+	user := &User{ID: "user-1"}
+	sessionID, err := startSession(ctx, user, httptest.NewRequest(http.MethodGet, "/api/auth/callback", nil))
+	require.NoError(t, err)
+	user.SessionID = sessionID
+	token, err := CreateSessionToken(user)
+	require.NoError(t, err)
+
+	// A session found active is trusted for a while without reading it again
+	for i := 0; i < 3; i++ {
+		_, err = ValidateSessionToken(ctx, token)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, store.reads)
+
+	// Revoking it takes effect at once
+	revokeSession(ctx, sessionID, revocationLogout)
+	_, err = ValidateSessionToken(ctx, token)
+	assert.Error(t, err)
+
+	// The lookup is bounded by the caller's context
+	other, err := startSession(ctx, user, httptest.NewRequest(http.MethodGet, "/api/auth/callback", nil))
+	require.NoError(t, err)
+	user.SessionID = other
+	token, err = CreateSessionToken(user)
+	require.NoError(t, err)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _ = ValidateSessionToken(cancelled, token)
+	assert.ErrorIs(t, store.lastErr, context.Canceled)
+}
+
+func TestSessionStoreRejectsUntrackedTokens(t *testing.T) {
+	setupSessionStore(t, 0)
+
+	token, err := CreateSessionToken(&User{ID: "user-1"})
+	require.NoError(t, err)
+
+	_, err = ValidateSessionToken(context.Background(), token)
+	assert.Error(t, err, "tokens without a session ID must be rejected when tracking is enabled")
+}
+
+func TestSessionStoreConcurrentLimit(t *testing.T) {
+	store := setupSessionStore(t, 2)
+	ctx := context.Background()
+
+	user := &User{ID: "user-1"}
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/callback", nil)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := startSession(ctx, user, req)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	sessions, err := store.ListByUser(ctx, user.ID)
+	require.NoError(t, err)
+
+	active := map[string]bool{}
+	for _, s := range sessions {
+		active[s.ID] = s.IsActive()
+	}
+	assert.Len(t, active, 3)
+	assert.False(t, active[ids[0]], "oldest session should be revoked")
+	assert.True(t, active[ids[1]])
+	assert.True(t, active[ids[2]])
+}
+
+func TestHandleRevokeSession(t *testing.T) {
+	store := setupSessionStore(t, 0)
+	ctx := context.Background()
+
+	require.NoError(t, store.Create(ctx, models.NewSession("own", "user-1", "", sessionTTL)))
+	require.NoError(t, store.Create(ctx, models.NewSession("other", "user-2", "", sessionTTL)))
+
+	token, err := CreateSessionToken(&User{ID: "user-1", SessionID: "own"})
+	require.NoError(t, err)
+
+	revoke := func(id string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/auth/sessions/"+id, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		rr := httptest.NewRecorder()
+		HandleRevokeSession(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, revoke("other"), "must not revoke another user's session")
+	assert.Equal(t, http.StatusNoContent, revoke("own"))
+
+	session, err := store.Get(ctx, "own")
+	require.NoError(t, err)
+	assert.False(t, session.IsActive())
+}
@@ -1,6 +1,7 @@
 package auth_test
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -101,7 +102,7 @@ func TestSessionTokenCreationAndValidation(t *testing.T) {
 	assert.NotEmpty(t, token)
 
 	// Validate session token
-	validatedUser, err := auth.ValidateSessionToken(token)
+	validatedUser, err := auth.ValidateSessionToken(context.Background(), token)
 	assert.NoError(t, err)
 	assert.NotNil(t, validatedUser)
 	assert.Equal(t, testUser.ID, validatedUser.ID)
@@ -146,7 +147,7 @@ func TestInvalidSessionToken(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			user, err := auth.ValidateSessionToken(tc.token)
+			user, err := auth.ValidateSessionToken(context.Background(), tc.token)
 			if tc.expectError {
 				assert.Error(t, err)
 				assert.Nil(t, user)
@@ -184,7 +185,7 @@ func TestSessionTokenExpiration(t *testing.T) {
 	assert.NotEmpty(t, token)
 
 	// Validate token immediately (should work)
-	validatedUser, err := auth.ValidateSessionToken(token)
+	validatedUser, err := auth.ValidateSessionToken(context.Background(), token)
 	assert.NoError(t, err)
 	assert.NotNil(t, validatedUser)
 
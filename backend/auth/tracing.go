@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies spans created by the auth package
+const tracerName = "github.com/Okabe-Junya/golink-backend/auth"
+
+// startSpan starts a span for an auth step, continuing any trace propagated in
+// the request headers. Spans go to the globally registered tracer provider.
+func startSpan(r *http.Request, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// startChildSpan starts a span for a sub-step of an auth step
+func startChildSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name)
+}
+
+// endSpan records err on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceID returns the trace ID of the span in ctx, or "" if there is none
+func traceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// stateFingerprint returns a short, non-reversible identifier for an OAuth
+// state value so login and callback can be correlated without logging the state
+func stateFingerprint(state string) string {
+	if state == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:4])
+}
@@ -8,17 +8,29 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/retention"
 	"github.com/Okabe-Junya/golink-backend/repositories"
 )
 
 func main() {
 	dryRun := flag.Bool("dry-run", false, "Perform a dry run without actually deleting any links")
-	olderThan := flag.Int("older-than", 30, "Delete expired links older than this many days")
+	olderThan := flag.Int("older-than", 30, "Move links expired longer than this many days to the trash")
+	purgeAfter := flag.Int("purge-after", 30, "Permanently delete links that have been in the trash this many days (0 disables purging)")
+	undoWindow := flag.Duration("undo-window", models.DefaultDeleteUndoWindow, "Finalize deletions that can no longer be undone; should match DELETE_UNDO_WINDOW")
+	historyRetention := flag.Duration("click-history-retention", models.DefaultClickHistoryRetention, "Forget per-user clicks older than this (0 disables); should match CLICK_HISTORY_RETENTION")
+	dailyStatsRetention := flag.Duration("daily-stats-retention", 0, "Roll the daily clicks of link stats older than this up into monthly totals (0 disables); should match DAILY_STATS_RETENTION")
+	clickEventRetention := flag.Duration("click-event-retention", 0, "Delete click events older than this (0 disables); should match CLICK_EVENT_RETENTION")
 	flag.Parse()
 
 	logger.Info("Starting cleanup job", logger.Fields{
-		"dryRun":    *dryRun,
-		"olderThan": *olderThan,
+		"dryRun":              *dryRun,
+		"olderThan":           *olderThan,
+		"purgeAfter":          *purgeAfter,
+		"undoWindow":          undoWindow.String(),
+		"historyRetention":    historyRetention.String(),
+		"dailyStatsRetention": dailyStatsRetention.String(),
+		"clickEventRetention": clickEventRetention.String(),
 	})
 
 	// Initialize Firestore client
@@ -30,8 +42,12 @@ func main() {
 	}
 	defer client.Close()
 
-	// Initialize repository
+	// Initialize repositories
 	repo := repositories.NewLinkRepository(client)
+	versions := repositories.NewLinkVersionRepository(client)
+	snapshots := repositories.NewLinkSnapshotRepository(client)
+	aliases := repositories.NewLinkAliasRepository(client)
+	clicks := repositories.NewClickEventRepository(client)
 
 	// Get all links
 	links, err := repo.GetAll(ctx)
@@ -59,7 +75,7 @@ func main() {
 		expiredCount++
 
 		if *dryRun {
-			logger.Info("Would delete expired link", logger.Fields{
+			logger.Info("Would move expired link to trash", logger.Fields{
 				"short":     link.Short,
 				"url":       link.URL,
 				"expiredAt": link.ExpiresAt,
@@ -67,7 +83,7 @@ func main() {
 			continue
 		}
 
-		// Delete the link
+		// Move the link to the trash; it is purged once it has been there long enough
 		if err := repo.Delete(ctx, link.Short); err != nil {
 			logger.Error("Failed to delete expired link", err, logger.Fields{
 				"short": link.Short,
@@ -75,16 +91,156 @@ func main() {
 			continue
 		}
 
-		logger.Info("Deleted expired link", logger.Fields{
+		logger.Info("Moved expired link to trash", logger.Fields{
 			"short":     link.Short,
 			"url":       link.URL,
 			"expiredAt": link.ExpiresAt,
 		})
 	}
 
+	finalizedCount := finalizeDeletions(ctx, repo, aliases, *undoWindow, *dryRun)
+
+	var purgedCount int
+	if *purgeAfter > 0 {
+		purgedCount = purgeTrash(ctx, repo, versions, snapshots, aliases, clicks, time.Now().AddDate(0, 0, -*purgeAfter), *dryRun)
+	}
+
+	var forgottenCount int
+	if *historyRetention > 0 && !*dryRun {
+		// Entries past the retention no longer affect search, so they go without a dry-run report
+		forgottenCount, err = repositories.NewUserClickRepository(client).DeleteBefore(ctx, time.Now().Add(-*historyRetention))
+		if err != nil {
+			logger.Error("Failed to delete expired click history", err, nil)
+		}
+	}
+
+	var retained retention.Result
+	if !*dryRun {
+		// Like the click history, analytics past their retention go without a dry-run report
+		policy := retention.Policy{DailyStats: *dailyStatsRetention, ClickEvents: *clickEventRetention}
+		retained, err = retention.NewJob(repo, policy, retention.WithClickEvents(clicks)).Run(ctx)
+		if err != nil {
+			logger.Error("Failed to apply analytics retention", err, nil)
+		}
+	}
+
 	logger.Info("Cleanup job completed", logger.Fields{
 		"processed": processedCount,
 		"expired":   expiredCount,
+		"finalized": finalizedCount,
+		"purged":    purgedCount,
+		"forgotten": forgottenCount,
+		"rolledUp":  retained.RolledUpDays,
+		"deleted":   retained.DeletedEvents,
 		"dryRun":    *dryRun,
 	})
 }
+
+// finalizeDeletions releases the aliases of links whose deletion can no longer
+// be undone, so their codes can be claimed again, and returns how many links
+// were (or, in a dry run, would have been) finalized. Links without aliases
+// need no finalizing.
+func finalizeDeletions(ctx context.Context, repo *repositories.LinkRepository, aliases *repositories.LinkAliasRepository, undoWindow time.Duration, dryRun bool) int {
+	deleted, err := repo.GetDeleted(ctx)
+	if err != nil {
+		logger.Error("Failed to get deleted links", err, nil)
+		return 0
+	}
+
+	var finalizedCount int
+	for _, link := range deleted {
+		if link.IsPendingDelete(undoWindow) {
+			continue
+		}
+		linkAliases, err := aliases.ListByShort(ctx, link.Short)
+		if err != nil {
+			logger.Error("Failed to get link aliases", err, logger.Fields{"short": link.Short})
+			continue
+		}
+		if len(linkAliases) == 0 {
+			continue
+		}
+
+		if dryRun {
+			logger.Info("Would finalize deleted link", logger.Fields{
+				"short":   link.Short,
+				"aliases": len(linkAliases),
+			})
+			finalizedCount++
+			continue
+		}
+
+		if err := aliases.DeleteByShort(ctx, link.Short); err != nil {
+			logger.Error("Failed to release aliases of deleted link", err, logger.Fields{"short": link.Short})
+			continue
+		}
+		finalizedCount++
+		logger.Info("Finalized deleted link", logger.Fields{
+			"short":     link.Short,
+			"aliases":   len(linkAliases),
+			"deletedAt": link.DeletedAt,
+		})
+	}
+	return finalizedCount
+}
+
+// purgeTrash permanently deletes links that were moved to the trash before cutoff
+// and returns how many were (or, in a dry run, would have been) purged
+func purgeTrash(ctx context.Context, repo *repositories.LinkRepository, versions *repositories.LinkVersionRepository, snapshots *repositories.LinkSnapshotRepository, aliases *repositories.LinkAliasRepository, clicks *repositories.ClickEventRepository, cutoff time.Time, dryRun bool) int {
+	deleted, err := repo.GetDeleted(ctx)
+	if err != nil {
+		logger.Error("Failed to get deleted links", err, nil)
+		return 0
+	}
+
+	var purgedCount int
+	for _, link := range deleted {
+		if link.DeletedAt.After(cutoff) {
+			continue
+		}
+
+		if dryRun {
+			logger.Info("Would purge deleted link", logger.Fields{
+				"short":     link.Short,
+				"deletedAt": link.DeletedAt,
+			})
+			purgedCount++
+			continue
+		}
+
+		if err := repo.Purge(ctx, link.Short); err != nil {
+			logger.Error("Failed to purge deleted link", err, logger.Fields{
+				"short": link.Short,
+			})
+			continue
+		}
+		purgedCount++
+		if err := versions.DeleteByShort(ctx, link.Short); err != nil {
+			logger.Error("Failed to purge link history", err, logger.Fields{
+				"short": link.Short,
+			})
+		}
+		if err := snapshots.DeleteByShort(ctx, link.Short); err != nil {
+			logger.Error("Failed to purge link snapshots", err, logger.Fields{
+				"short": link.Short,
+			})
+		}
+		if err := aliases.DeleteByShort(ctx, link.Short); err != nil {
+			logger.Error("Failed to purge link aliases", err, logger.Fields{
+				"short": link.Short,
+			})
+		}
+		if err := clicks.DeleteByShort(ctx, link.Short); err != nil {
+			logger.Error("Failed to purge link click events", err, logger.Fields{
+				"short": link.Short,
+			})
+		}
+
+		logger.Info("Purged deleted link", logger.Fields{
+			"short":     link.Short,
+			"url":       link.URL,
+			"deletedAt": link.DeletedAt,
+		})
+	}
+	return purgedCount
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/coldstorage"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+)
+
+// The stats compaction job moves the statistics of links that expired long
+// ago to cold storage: their daily clicks are folded into yearly totals, which
+// GetLinkStats keeps returning, and with -bucket the full statistics are first
+// exported to Cloud Storage. Run it periodically (daily or weekly).
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Log the links whose stats would be compacted without changing them")
+	olderThan := flag.Int("older-than", 90, "Compact the stats of links expired longer than this many days")
+	bucket := flag.String("bucket", os.Getenv("STATS_ARCHIVE_BUCKET"), "Cloud Storage bucket to export full stats to before compacting (empty disables exporting)")
+	prefix := flag.String("prefix", coldstorage.DefaultPrefix, "Object name prefix for exported stats")
+	flag.Parse()
+
+	logger.Info("Starting stats compaction job", logger.Fields{
+		"dryRun":    *dryRun,
+		"olderThan": *olderThan,
+		"bucket":    *bucket,
+	})
+
+	// Initialize Firestore client
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, os.Getenv("PROJECT_ID"))
+	if err != nil {
+		logger.Error("Failed to initialize Firestore client", err, nil)
+		return
+	}
+	defer client.Close()
+
+	var archive repositories.StatsArchiveFunc
+	if *bucket != "" {
+		storageClient, err := storage.NewClient(ctx)
+		if err != nil {
+			logger.Error("Failed to initialize Cloud Storage client", err, nil)
+			return
+		}
+		defer storageClient.Close()
+		archive = coldstorage.NewGCSArchive(storageClient, *bucket, *prefix).Put
+	}
+
+	repo := repositories.NewLinkRepository(client)
+	links, err := repo.GetAll(ctx)
+	if err != nil {
+		logger.Error("Failed to get links", err, nil)
+		return
+	}
+
+	now := time.Now()
+	cutoffDate := now.AddDate(0, 0, -*olderThan)
+	var candidateCount, compactedCount, failedCount int
+	for _, link := range links {
+		if !link.IsLinkExpired() || link.ExpiresAt.After(cutoffDate) {
+			continue
+		}
+		candidateCount++
+
+		if *dryRun {
+			logger.Info("Would compact link stats", logger.Fields{
+				"short":     link.Short,
+				"expiredAt": link.ExpiresAt,
+			})
+			continue
+		}
+
+		stats, err := repo.CompactLinkStats(ctx, link.Short, now, archive)
+		if err != nil {
+			// Links that were never clicked may have no stats at all
+			if errors.Is(err, errors.ErrNotFound) {
+				continue
+			}
+			logger.Error("Failed to compact link stats", err, logger.Fields{"short": link.Short})
+			failedCount++
+			continue
+		}
+		if stats.CompactedAt.Equal(now) {
+			compactedCount++
+			logger.Info("Compacted link stats", logger.Fields{
+				"short":   link.Short,
+				"archive": stats.ArchiveURI,
+			})
+		}
+	}
+
+	logger.Info("Stats compaction job completed", logger.Fields{
+		"processed":  len(links),
+		"candidates": candidateCount,
+		"compacted":  compactedCount,
+		"failed":     failedCount,
+		"dryRun":     *dryRun,
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkmerge"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlnorm"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+)
+
+// The duplicate merge tool finds links whose destinations are equivalent and
+// merges each group into its most clicked link: the other links become its
+// aliases, so their short codes keep working, and their clicks and statistics
+// are added to its own. Without -apply it only prints what would change.
+func main() {
+	apply := flag.Bool("apply", false, "Merge the duplicates instead of only printing the diff")
+	only := flag.String("only", "", "Comma-separated canonical short codes whose groups to merge (empty merges every group)")
+	ignoreScheme := flag.Bool("ignore-scheme", true, "Treat http and https destinations as the same")
+	ignoreTrailingSlash := flag.Bool("ignore-trailing-slash", true, "Treat paths with and without a trailing slash as the same")
+	stripTracking := flag.Bool("strip-tracking", true, "Ignore tracking query parameters when comparing destinations")
+	trackingParams := flag.String("tracking-params", os.Getenv("URL_TRACKING_PARAMS"), "Comma-separated tracking parameters; a trailing * matches a prefix (empty uses the defaults)")
+	flag.Parse()
+
+	eq := urlnorm.Equivalence{
+		Normalizer:          urlnorm.Default(),
+		IgnoreScheme:        *ignoreScheme,
+		IgnoreTrailingSlash: *ignoreTrailingSlash,
+	}
+	eq.StripTracking = *stripTracking
+	if *trackingParams != "" {
+		eq.TrackingParams = splitList(*trackingParams)
+	}
+
+	// Initialize Firestore client
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, os.Getenv("PROJECT_ID"))
+	if err != nil {
+		logger.Error("Failed to initialize Firestore client", err, nil)
+		return
+	}
+	defer client.Close()
+
+	repo := repositories.NewLinkRepository(client)
+	versions := repositories.NewLinkVersionRepository(client)
+	snapshots := repositories.NewLinkSnapshotRepository(client)
+	aliases := repositories.NewLinkAliasRepository(client)
+
+	links, err := repo.GetAll(ctx)
+	if err != nil {
+		logger.Error("Failed to get links", err, nil)
+		return
+	}
+
+	selected := make(map[string]bool)
+	for _, short := range splitList(*only) {
+		selected[short] = true
+	}
+
+	var groupCount, mergedCount, failedCount int
+	for _, group := range linkmerge.Find(links, eq) {
+		if len(selected) > 0 && !selected[group.Canonical.Short] {
+			continue
+		}
+		groupCount++
+		if err := group.WriteDiff(os.Stdout); err != nil {
+			logger.Error("Failed to print diff", err, nil)
+			return
+		}
+		if !*apply {
+			continue
+		}
+
+		for _, duplicate := range group.Duplicates {
+			if err := mergeLink(ctx, repo, versions, snapshots, aliases, group.Canonical, duplicate); err != nil {
+				failedCount++
+				logger.Error("Failed to merge duplicate link", err, logger.Fields{
+					"canonical": group.Canonical.Short,
+					"duplicate": duplicate.Short,
+				})
+				continue
+			}
+			mergedCount++
+			logger.Info("Merged duplicate link", logger.Fields{
+				"canonical": group.Canonical.Short,
+				"duplicate": duplicate.Short,
+			})
+		}
+	}
+
+	logger.Info("Duplicate merge completed", logger.Fields{
+		"groups": groupCount,
+		"merged": mergedCount,
+		"failed": failedCount,
+		"apply":  *apply,
+	})
+	if !*apply && groupCount > 0 {
+		fmt.Fprintln(os.Stderr, "Dry run: rerun with -apply to merge these links")
+	}
+}
+
+// mergeLink turns duplicate into an alias of canonical. Its statistics are
+// consolidated first, so a failure later leaves at worst a link whose clicks
+// already count towards the canonical one, and rerunning the tool finishes
+// the merge.
+func mergeLink(ctx context.Context, repo *repositories.LinkRepository, versions *repositories.LinkVersionRepository, snapshots *repositories.LinkSnapshotRepository, aliases *repositories.LinkAliasRepository, canonical, duplicate *models.Link) error {
+	if err := repo.MergeLinkStats(ctx, canonical.Short, duplicate.Short); err != nil {
+		return err
+	}
+
+	// The duplicate's own aliases move to the canonical link
+	existing, err := aliases.ListByShort(ctx, duplicate.Short)
+	if err != nil {
+		return err
+	}
+	if err := repo.Purge(ctx, duplicate.Short); err != nil {
+		return err
+	}
+	if err := versions.DeleteByShort(ctx, duplicate.Short); err != nil {
+		return err
+	}
+	if err := snapshots.DeleteByShort(ctx, duplicate.Short); err != nil {
+		return err
+	}
+	if err := aliases.DeleteByShort(ctx, duplicate.Short); err != nil {
+		return err
+	}
+
+	moved := []*models.LinkAlias{{
+		CreatedAt: time.Now(),
+		Alias:     duplicate.Short,
+		Short:     canonical.Short,
+		CreatedBy: duplicate.CreatedBy,
+	}}
+	for _, alias := range existing {
+		alias.Short = canonical.Short
+		moved = append(moved, alias)
+	}
+	for _, alias := range moved {
+		if err := aliases.Create(ctx, alias); err != nil {
+			return fmt.Errorf("failed to create alias %s: %w", alias.Alias, err)
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
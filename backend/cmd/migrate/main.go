@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -11,7 +12,14 @@ import (
 	"github.com/Okabe-Junya/golink-backend/logger"
 	"github.com/Okabe-Junya/golink-backend/models"
 	"github.com/Okabe-Junya/golink-backend/pkg/config"
+	"github.com/Okabe-Junya/golink-backend/pkg/firestoreindex"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlnorm"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func main() {
@@ -19,17 +27,50 @@ func main() {
 	var (
 		createStatsCollection bool
 		migrateExpiredLinks   bool
+		upgradeSchema         bool
+		normalizeURLs         bool
+		assignLinkIDs         bool
+		migratePostgres       bool
+		printIndexes          bool
 		dryRun                bool
 	)
 
 	flag.BoolVar(&createStatsCollection, "create-stats", false, "Create link_stats collection")
 	flag.BoolVar(&migrateExpiredLinks, "migrate-expired", false, "Migrate expired links")
+	flag.BoolVar(&upgradeSchema, "upgrade-schema", false, "Rewrite links and link stats stored with an older schema version")
+	flag.BoolVar(&normalizeURLs, "normalize-urls", false, "Rewrite link destinations in canonical form, as new links are stored")
+	flag.BoolVar(&assignLinkIDs, "assign-link-ids", false, "Move links keyed by their short code to documents keyed by a stable ID, claiming their short codes")
+	flag.BoolVar(&migratePostgres, "postgres", false, "Apply the pending schema migrations of the PostgreSQL storage at POSTGRES_URL")
+	flag.BoolVar(&printIndexes, "firestore-indexes", false, "Print the Firestore composite indexes the repositories need, as firestore.indexes.json, and exit")
 	flag.BoolVar(&dryRun, "dry-run", false, "Run in dry-run mode (no changes)")
 	flag.Parse()
 
+	if printIndexes {
+		data, err := firestoreindex.FirebaseJSON(repositories.FirestoreIndexes)
+		if err != nil {
+			logger.Fatal("Failed to encode the Firestore indexes", err, nil)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
 	// Load config
 	cfg := config.New()
 
+	// Context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if migratePostgres {
+		if err := migratePostgresSchema(ctx, cfg.Storage.PostgresURL, dryRun); err != nil {
+			logger.Fatal("Failed to migrate the PostgreSQL schema", err, nil)
+		}
+		if !createStatsCollection && !migrateExpiredLinks && !upgradeSchema && !normalizeURLs && !assignLinkIDs {
+			logger.Info("Migration completed successfully", nil)
+			return
+		}
+	}
+
 	// Initialize Firebase
 	client, err := initFirebase(cfg.Firebase)
 	if err != nil {
@@ -37,10 +78,6 @@ func main() {
 	}
 	defer client.Close()
 
-	// Context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
 	// Run migrations
 	if createStatsCollection {
 		if err := createLinkStatsCollection(ctx, client, dryRun); err != nil {
@@ -54,6 +91,28 @@ func main() {
 		}
 	}
 
+	if upgradeSchema {
+		if err := upgradeDocumentSchemas(ctx, client, dryRun); err != nil {
+			logger.Fatal("Failed to upgrade document schemas", err, nil)
+		}
+	}
+
+	if normalizeURLs {
+		normalizer := urlnorm.Normalizer{
+			TrackingParams: cfg.URL.TrackingParams,
+			StripTracking:  cfg.URL.StripTrackingParams,
+		}
+		if err := normalizeLinkURLs(ctx, client, normalizer, dryRun); err != nil {
+			logger.Fatal("Failed to normalize link URLs", err, nil)
+		}
+	}
+
+	if assignLinkIDs {
+		if err := assignLinkDocumentIDs(ctx, client, dryRun); err != nil {
+			logger.Fatal("Failed to assign link IDs", err, nil)
+		}
+	}
+
 	logger.Info("Migration completed successfully", nil)
 }
 
@@ -84,6 +143,53 @@ func initFirebase(cfg config.FirebaseConfig) (*firestore.Client, error) {
 	return client, nil
 }
 
+// migratePostgresSchema applies the pending schema migrations of the
+// PostgreSQL storage, or lists them in dry-run mode
+func migratePostgresSchema(ctx context.Context, url string, dryRun bool) error {
+	if url == "" {
+		return fmt.Errorf("POSTGRES_URL is not set")
+	}
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	defer pool.Close()
+
+	if dryRun {
+		pending, err := repositories.PendingPostgresMigrations(ctx, pool)
+		if err != nil {
+			return err
+		}
+		for _, migration := range pending {
+			logger.Info("Would apply migration", logger.Fields{
+				"version": migration.Version,
+				"name":    migration.Name,
+			})
+		}
+		logger.Info("PostgreSQL schema migration completed", logger.Fields{
+			"count":   len(pending),
+			"dry_run": dryRun,
+		})
+		return nil
+	}
+
+	applied, err := repositories.MigratePostgres(ctx, pool)
+	for _, migration := range applied {
+		logger.Info("Applied migration", logger.Fields{
+			"version": migration.Version,
+			"name":    migration.Name,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("PostgreSQL schema migration completed", logger.Fields{
+		"count":   len(applied),
+		"dry_run": dryRun,
+	})
+	return nil
+}
+
 // createLinkStatsCollection creates the link_stats collection
 func createLinkStatsCollection(ctx context.Context, client *firestore.Client, dryRun bool) error {
 	logger.Info("Creating link_stats collection", logger.Fields{
@@ -101,8 +207,8 @@ func createLinkStatsCollection(ctx context.Context, client *firestore.Client, dr
 			break
 		}
 
-		var link models.Link
-		if err := doc.DataTo(&link); err != nil {
+		link, _, err := models.DecodeLink(doc.Data())
+		if err != nil {
 			logger.Error("Failed to parse link", err, logger.Fields{
 				"document_id": doc.Ref.ID,
 			})
@@ -110,7 +216,7 @@ func createLinkStatsCollection(ctx context.Context, client *firestore.Client, dr
 		}
 
 		// Check if stats already exist
-		statsRef := client.Collection("link_stats").Doc(link.Short)
+		statsRef := client.Collection("link_stats").Doc(repositories.ShortDocID(link.Short))
 		_, err = statsRef.Get(ctx)
 		if err == nil {
 			// Stats exist, skip
@@ -181,8 +287,8 @@ func updateExpiredLinks(ctx context.Context, client *firestore.Client, dryRun bo
 			break
 		}
 
-		var link models.Link
-		if err := doc.DataTo(&link); err != nil {
+		link, _, err := models.DecodeLink(doc.Data())
+		if err != nil {
 			logger.Error("Failed to parse link", err, logger.Fields{
 				"document_id": doc.Ref.ID,
 			})
@@ -234,3 +340,258 @@ func updateExpiredLinks(ctx context.Context, client *firestore.Client, dryRun bo
 
 	return nil
 }
+
+// upgradeDocumentSchemas rewrites link and link stats documents stored with an
+// older schema version in the current shape. Reads upgrade old documents on the
+// fly, so this only makes the stored data uniform.
+func upgradeDocumentSchemas(ctx context.Context, client *firestore.Client, dryRun bool) error {
+	logger.Info("Upgrading document schemas", logger.Fields{
+		"dry_run":                   dryRun,
+		"link_schema_version":       models.LinkSchemaVersion,
+		"link_stats_schema_version": models.LinkStatsSchemaVersion,
+	})
+
+	collections := []struct {
+		decode  func(map[string]interface{}) (interface{}, int, error)
+		name    string
+		current int
+	}{
+		{
+			name:    "links",
+			current: models.LinkSchemaVersion,
+			decode: func(data map[string]interface{}) (interface{}, int, error) {
+				return models.DecodeLink(data)
+			},
+		},
+		{
+			name:    "link_stats",
+			current: models.LinkStatsSchemaVersion,
+			decode: func(data map[string]interface{}) (interface{}, int, error) {
+				return models.DecodeLinkStats(data)
+			},
+		},
+	}
+
+	for _, c := range collections {
+		iter := client.Collection(c.name).Documents(ctx)
+		batch := client.Batch()
+		count := 0
+
+		for {
+			doc, err := iter.Next()
+			if err != nil {
+				break
+			}
+
+			upgraded, version, err := c.decode(doc.Data())
+			if err != nil {
+				logger.Error("Failed to parse document", err, logger.Fields{
+					"collection":  c.name,
+					"document_id": doc.Ref.ID,
+				})
+				continue
+			}
+			if version >= c.current {
+				continue
+			}
+
+			if dryRun {
+				logger.Info("Would upgrade document", logger.Fields{
+					"collection":  c.name,
+					"document_id": doc.Ref.ID,
+					"from":        version,
+					"to":          c.current,
+				})
+				count++
+				continue
+			}
+
+			batch.Set(doc.Ref, upgraded)
+			count++
+
+			// Execute batch when it reaches 500 operations (Firestore limit)
+			if count%500 == 0 {
+				if _, err := batch.Commit(ctx); err != nil {
+					return fmt.Errorf("failed to commit batch: %w", err)
+				}
+				batch = client.Batch()
+				logger.Info("Batch committed", logger.Fields{
+					"collection": c.name,
+					"count":      count,
+				})
+			}
+		}
+
+		// Commit any remaining operations
+		if !dryRun && count%500 != 0 {
+			if _, err := batch.Commit(ctx); err != nil {
+				return fmt.Errorf("failed to commit final batch: %w", err)
+			}
+		}
+
+		logger.Info("Schema upgrade completed", logger.Fields{
+			"collection": c.name,
+			"count":      count,
+			"dry_run":    dryRun,
+		})
+	}
+
+	return nil
+}
+
+// normalizeLinkURLs rewrites the destinations of links stored before URLs
+// were normalized, so duplicate detection finds them. Only the url field is
+// written; the links are otherwise left as they are.
+func normalizeLinkURLs(ctx context.Context, client *firestore.Client, normalizer urlnorm.Normalizer, dryRun bool) error {
+	logger.Info("Normalizing link URLs", logger.Fields{
+		"dry_run": dryRun,
+	})
+
+	linksIter := client.Collection("links").Documents(ctx)
+	batch := client.Batch()
+	count := 0
+
+	for {
+		doc, err := linksIter.Next()
+		if err != nil {
+			break
+		}
+
+		link, _, err := models.DecodeLink(doc.Data())
+		if err != nil {
+			logger.Error("Failed to parse link", err, logger.Fields{
+				"document_id": doc.Ref.ID,
+			})
+			continue
+		}
+		normalized := normalizer.Normalize(link.URL)
+		if normalized == link.URL {
+			continue
+		}
+
+		if dryRun {
+			logger.Info("Would normalize link URL", logger.Fields{
+				"short": link.Short,
+				"from":  link.URL,
+				"to":    normalized,
+			})
+			count++
+			continue
+		}
+
+		batch.Update(doc.Ref, []firestore.Update{{Path: "url", Value: normalized}})
+		count++
+
+		// Execute batch when it reaches 500 operations (Firestore limit)
+		if count%500 == 0 {
+			if _, err := batch.Commit(ctx); err != nil {
+				return fmt.Errorf("failed to commit batch: %w", err)
+			}
+			batch = client.Batch()
+			logger.Info("Batch committed", logger.Fields{
+				"count": count,
+			})
+		}
+	}
+
+	// Commit any remaining operations
+	if !dryRun && count%500 != 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit final batch: %w", err)
+		}
+	}
+
+	logger.Info("Link URL normalization completed", logger.Fields{
+		"count":   count,
+		"dry_run": dryRun,
+	})
+
+	return nil
+}
+
+// assignLinkDocumentIDs moves links stored before IDs were assigned, whose
+// documents are keyed by their short code, to documents keyed by a new
+// random ID, and claims the short code of every link lacking a claim. Links
+// keyed by their short code keep working until they are moved, but an edit
+// racing the move may be lost, so run it while links are not being edited.
+func assignLinkDocumentIDs(ctx context.Context, client *firestore.Client, dryRun bool) error {
+	logger.Info("Assigning link IDs", logger.Fields{"dry_run": dryRun})
+
+	links := client.Collection("links")
+	shorts := client.Collection("link_shorts")
+	iter := links.Documents(ctx)
+	defer iter.Stop()
+	moved, claimed := 0, 0
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read links: %w", err)
+		}
+
+		short, _ := doc.Data()["short"].(string)
+		if short == "" {
+			logger.Warn("Skipping link without a short code", logger.Fields{"document_id": doc.Ref.ID})
+			continue
+		}
+		claimRef := shorts.Doc(repositories.ShortDocID(short))
+		legacy := doc.Ref.ID == repositories.ShortDocID(short)
+		if !legacy {
+			if _, err := claimRef.Get(ctx); err == nil {
+				continue
+			} else if status.Code(err) != codes.NotFound {
+				return fmt.Errorf("failed to read claim of %s: %w", short, err)
+			}
+		}
+
+		if dryRun {
+			logger.Info("Would assign link ID", logger.Fields{"short": short, "document_id": doc.Ref.ID, "move": legacy})
+			if legacy {
+				moved++
+			} else {
+				claimed++
+			}
+			continue
+		}
+
+		// Move the link and claim its short code together, so it is found
+		// either under its old document or its new one
+		err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			current, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			id := doc.Ref.ID
+			if legacy {
+				id = models.NewLinkID()
+				data := current.Data()
+				data["id"] = id
+				if err := tx.Create(links.Doc(id), data); err != nil {
+					return err
+				}
+				if err := tx.Delete(doc.Ref); err != nil {
+					return err
+				}
+			}
+			return tx.Set(claimRef, map[string]interface{}{"link_id": id, "short": short})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to assign ID to link %s: %w", short, err)
+		}
+		if legacy {
+			moved++
+		} else {
+			claimed++
+		}
+	}
+
+	logger.Info("Link IDs assigned", logger.Fields{
+		"moved":   moved,
+		"claimed": claimed,
+		"dry_run": dryRun,
+	})
+	return nil
+}
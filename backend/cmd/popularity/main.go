@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+)
+
+// The popularity job brings every link's time-decayed popularity score up to
+// date. Run it periodically (hourly or daily); listings ordered by popularity
+// decay scores that are out of date themselves, so a missed run only delays
+// newly counted clicks.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Log the new scores without storing them")
+	halfLife := flag.Duration("half-life", models.DefaultPopularityHalfLife, "How long it takes for a click's weight to halve; should match POPULARITY_HALF_LIFE")
+	flag.Parse()
+
+	if *halfLife <= 0 {
+		logger.Error("Half-life must be positive", nil, logger.Fields{"halfLife": halfLife.String()})
+		return
+	}
+
+	logger.Info("Starting popularity scoring job", logger.Fields{
+		"dryRun":   *dryRun,
+		"halfLife": halfLife.String(),
+	})
+
+	// Initialize Firestore client
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, os.Getenv("PROJECT_ID"))
+	if err != nil {
+		logger.Error("Failed to initialize Firestore client", err, nil)
+		return
+	}
+	defer client.Close()
+
+	repo := repositories.NewLinkRepository(client)
+	links, err := repo.GetAll(ctx)
+	if err != nil {
+		logger.Error("Failed to get links", err, nil)
+		return
+	}
+
+	now := time.Now()
+	var scoredCount, failedCount int
+	for _, link := range links {
+		link.Rescore(now, *halfLife)
+
+		if *dryRun {
+			logger.Info("Would update popularity score", logger.Fields{
+				"short": link.Short,
+				"score": link.PopularityScore,
+			})
+			scoredCount++
+			continue
+		}
+
+		if err := repo.UpdatePopularity(ctx, link); err != nil {
+			logger.Error("Failed to update popularity score", err, logger.Fields{"short": link.Short})
+			failedCount++
+			continue
+		}
+		scoredCount++
+	}
+
+	logger.Info("Popularity scoring job completed", logger.Fields{
+		"processed": len(links),
+		"scored":    scoredCount,
+		"failed":    failedCount,
+		"dryRun":    *dryRun,
+	})
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,10 +17,50 @@ import (
 	firebase "firebase.google.com/go"
 	"github.com/Okabe-Junya/golink-backend/auth"
 	"github.com/Okabe-Junya/golink-backend/handlers"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
 	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/cache"
+	"github.com/Okabe-Junya/golink-backend/pkg/capture"
+	"github.com/Okabe-Junya/golink-backend/pkg/classification"
+	"github.com/Okabe-Junya/golink-backend/pkg/clickstats"
+	"github.com/Okabe-Junya/golink-backend/pkg/clickstream"
+	"github.com/Okabe-Junya/golink-backend/pkg/config"
+	"github.com/Okabe-Junya/golink-backend/pkg/doctor"
+	"github.com/Okabe-Junya/golink-backend/pkg/egress"
+	"github.com/Okabe-Junya/golink-backend/pkg/expiry"
+	"github.com/Okabe-Junya/golink-backend/pkg/export"
+	"github.com/Okabe-Junya/golink-backend/pkg/firestoreindex"
+	"github.com/Okabe-Junya/golink-backend/pkg/geoip"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/lifecycle"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcheck"
+	"github.com/Okabe-Junya/golink-backend/pkg/preview"
+	"github.com/Okabe-Junya/golink-backend/pkg/privacy"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/Okabe-Junya/golink-backend/pkg/region"
+	"github.com/Okabe-Junya/golink-backend/pkg/retention"
+	"github.com/Okabe-Junya/golink-backend/pkg/safehttp"
+	"github.com/Okabe-Junya/golink-backend/pkg/saml"
+	"github.com/Okabe-Junya/golink-backend/pkg/sandbox"
+	"github.com/Okabe-Junya/golink-backend/pkg/shortcode"
+	"github.com/Okabe-Junya/golink-backend/pkg/storagestats"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlnorm"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlpolicy"
+	"github.com/Okabe-Junya/golink-backend/pkg/usage"
+	"github.com/Okabe-Junya/golink-backend/pkg/webauthn"
+	"github.com/Okabe-Junya/golink-backend/pkg/webhook"
 	"github.com/Okabe-Junya/golink-backend/repositories"
 	"github.com/Okabe-Junya/golink-backend/routes"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/cors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -26,25 +70,31 @@ const (
 	writeTimeout    = 10 * time.Second
 	idleTimeout     = 120 * time.Second
 	shutdownTimeout = 30 * time.Second
+	oauthTimeout    = 10 * time.Second
+	doctorTimeout   = 30 * time.Second
 )
 
-// initFirebase initializes the Firebase app and Firestore client
-func initFirebase() (*firestore.Client, error) {
-	ctx := context.Background()
-	var opt option.ClientOption
+// firebaseCredentials returns the credentials Google API clients authenticate with
+func firebaseCredentials() option.ClientOption {
 	credJSON := os.Getenv("FIREBASE_CREDENTIALS_JSON")
 	credFile := os.Getenv("FIREBASE_CREDENTIALS_FILE")
 
 	// Rewritten using switch
 	switch {
 	case credJSON != "":
-		opt = option.WithCredentialsJSON([]byte(credJSON))
+		return option.WithCredentialsJSON([]byte(credJSON))
 	case credFile != "":
-		opt = option.WithCredentialsFile(credFile)
+		return option.WithCredentialsFile(credFile)
 	default:
 		credFile = "path/to/serviceAccountKey.json"
-		opt = option.WithCredentialsFile(credFile)
+		return option.WithCredentialsFile(credFile)
 	}
+}
+
+// initFirebase initializes the Firebase app and Firestore client
+func initFirebase() (*firestore.Client, error) {
+	ctx := context.Background()
+	opt := firebaseCredentials()
 
 	// Initialize Firebase app
 	app, err := firebase.NewApp(ctx, nil, opt)
@@ -61,13 +111,621 @@ func initFirebase() (*firestore.Client, error) {
 	return client, nil
 }
 
+// usesFirestore reports whether the storage backend keeps data in Firestore:
+// the firestore backend, and the redis one writing through to Firestore.
+// Other backends keep the data besides links and their statistics in memory.
+func usesFirestore(cfg config.StorageConfig) bool {
+	return cfg.Backend == "" || cfg.Backend == "firestore" || (cfg.Backend == "redis" && cfg.RedisWriteThrough)
+}
+
+// storageClients are the connections to the databases of the storage
+// backend; those it does not use are nil
+type storageClients struct {
+	firestore *firestore.Client
+	postgres  *pgxpool.Pool
+	sqlite    *sql.DB
+	redis     redis.UniversalClient
+}
+
+// newPostgresPool connects to the PostgreSQL database of the postgres
+// storage backend
+func newPostgresPool(cfg config.StorageConfig) *pgxpool.Pool {
+	if cfg.PostgresURL == "" {
+		logger.Fatal("POSTGRES_URL is required with STORAGE_BACKEND=postgres", nil, nil)
+	}
+	pool, err := pgxpool.New(context.Background(), cfg.PostgresURL)
+	if err != nil {
+		logger.Fatal("Invalid POSTGRES_URL", err, nil)
+	}
+	return pool
+}
+
+// newLinkRepository creates the link repository for the configured storage backend
+func newLinkRepository(cfg config.StorageConfig, clients storageClients) interfaces.LinkRepositoryInterface {
+	switch cfg.Backend {
+	case "memory":
+		logger.Warn("Using in-memory storage; links are lost on restart", nil)
+		return repositories.NewMemoryLinkRepository()
+	case "postgres":
+		logger.Warn("Links are stored in PostgreSQL; link history, aliases, webhooks and click events are kept in memory and lost on restart", nil)
+		return repositories.NewPostgresLinkRepository(clients.postgres)
+	case "sqlite":
+		logger.Warn("Links are stored in SQLite; link history, aliases, webhooks and click events are kept in memory and lost on restart", logger.Fields{
+			"path": cfg.SQLitePath,
+		})
+		return repositories.NewSQLiteLinkRepository(clients.sqlite)
+	case "redis":
+		if !cfg.RedisWriteThrough {
+			logger.Warn("Links are stored in Redis without write-through; link history, aliases, webhooks and click events are kept in memory and lost on restart", nil)
+			return repositories.NewRedisLinkRepository(clients.redis, repositories.DefaultRedisKeyPrefix)
+		}
+		logger.Info("Links are stored in Redis and written through to Firestore", nil)
+		return repositories.NewRedisLinkRepository(clients.redis, repositories.DefaultRedisKeyPrefix,
+			repositories.WithWriteThrough(repositories.NewLinkRepository(clients.firestore)))
+	case "", "firestore":
+		return repositories.NewLinkRepository(clients.firestore)
+	default:
+		logger.Fatal("Unknown STORAGE_BACKEND", nil, logger.Fields{"storage_backend": cfg.Backend})
+		return nil
+	}
+}
+
+// newLinkVersionStore creates the link history store for the configured storage backend
+func newLinkVersionStore(cfg config.StorageConfig, client *firestore.Client) interfaces.LinkVersionStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryLinkVersionStore()
+	}
+	return repositories.NewLinkVersionRepository(client)
+}
+
+// newLinkSnapshotStore creates the link snapshot store for the configured storage backend
+func newLinkSnapshotStore(cfg config.StorageConfig, client *firestore.Client) interfaces.LinkSnapshotStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryLinkSnapshotStore()
+	}
+	return repositories.NewLinkSnapshotRepository(client)
+}
+
+// newLinkAliasStore creates the link alias store for the configured storage backend
+func newLinkAliasStore(cfg config.StorageConfig, client *firestore.Client) interfaces.LinkAliasStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryLinkAliasStore()
+	}
+	return repositories.NewLinkAliasRepository(client)
+}
+
+// newWebhookStore creates the store of webhooks for the configured storage backend
+func newWebhookStore(cfg config.StorageConfig, client *firestore.Client) interfaces.WebhookStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryWebhookStore()
+	}
+	return repositories.NewWebhookRepository(client)
+}
+
+// newProductMetricsStore creates the product metrics store for the configured storage backend
+func newProductMetricsStore(cfg config.StorageConfig, client *firestore.Client) interfaces.ProductMetricsStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryProductMetricsStore()
+	}
+	return repositories.NewProductMetricsRepository(client)
+}
+
+// newLinkReferenceStore creates the link reference store for the configured storage backend
+func newLinkReferenceStore(cfg config.StorageConfig, client *firestore.Client) interfaces.LinkReferenceStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryLinkReferenceStore()
+	}
+	return repositories.NewLinkReferenceRepository(client)
+}
+
+// newUserClickStore creates the per-user click history store for the configured backend
+func newUserClickStore(cfg config.StorageConfig, client *firestore.Client) interfaces.UserClickStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryUserClickStore()
+	}
+	return repositories.NewUserClickRepository(client)
+}
+
+// newUserFavoriteStore creates the store of users' favorite links for the configured backend
+func newUserFavoriteStore(cfg config.StorageConfig, client *firestore.Client) interfaces.UserFavoriteStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryUserFavoriteStore()
+	}
+	return repositories.NewUserFavoriteRepository(client)
+}
+
+// newRegionResolver creates the resolver of the region each redirect is
+// served for: the load balancer's header if set, then the client's country.
+// It returns nil when neither is configured.
+func newRegionResolver(cfg config.RegionConfig) (region.Resolver, error) {
+	var chain region.Chain
+	if cfg.Header != "" {
+		chain = append(chain, region.Header(cfg.Header))
+	}
+	if len(cfg.Countries) > 0 {
+		countries, err := region.ParseCountries(cfg.Countries)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, countries)
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// newClickEventStore creates the store of link click streams for the configured backend
+func newClickEventStore(cfg config.StorageConfig, client *firestore.Client) interfaces.ClickEventStore {
+	if !usesFirestore(cfg) {
+		return repositories.NewMemoryClickEventStore()
+	}
+	return repositories.NewClickEventRepository(client)
+}
+
+// newAnonymizer creates the anonymization stage every click event passes
+// before it is stored or exported
+func newAnonymizer(cfg config.PrivacyConfig) (*privacy.Anonymizer, error) {
+	return privacy.New(privacy.Options{
+		Secret:         []byte(cfg.HashSecret),
+		GeoPrecision:   cfg.GeoPrecision,
+		SaltRotation:   cfg.SaltRotation,
+		IPv4PrefixBits: cfg.IPv4PrefixBits,
+		IPv6PrefixBits: cfg.IPv6PrefixBits,
+	})
+}
+
+// newClickExporter creates the exporter click events are streamed to for
+// analysts. BigQuery uses the Firebase credentials when they are configured
+// and the application default credentials otherwise.
+func newClickExporter(cfg config.ExportConfig) (export.Exporter, error) {
+	switch cfg.Exporter {
+	case export.ExporterNone, "":
+		return export.Nop{}, nil
+	case export.ExporterBigQuery:
+		var opts []option.ClientOption
+		if os.Getenv("FIREBASE_CREDENTIALS_JSON") != "" || os.Getenv("FIREBASE_CREDENTIALS_FILE") != "" {
+			opts = append(opts, firebaseCredentials())
+		}
+		ctx := context.Background()
+		exporter, err := export.NewBigQuery(ctx, export.BigQueryConfig{
+			ProjectID: cfg.BigQueryProject,
+			Dataset:   cfg.BigQueryDataset,
+			Table:     cfg.BigQueryTable,
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := exporter.EnsureTable(ctx); err != nil {
+			logger.Warn("BigQuery click event table unavailable; exports will fail until it exists", logger.Fields{
+				"error": err.Error(),
+			})
+		}
+		return exporter, nil
+	default:
+		return nil, fmt.Errorf("unknown click exporter %q", cfg.Exporter)
+	}
+}
+
+// openGeoIPDatabase opens the GeoIP database clicks are located with. Clicks
+// are still recorded without one, located by the proxy's country header only.
+func openGeoIPDatabase(path string) *geoip.Database {
+	if path == "" {
+		return nil
+	}
+	db, err := geoip.Open(path)
+	if err != nil {
+		logger.Warn("GeoIP database unavailable; locating clicks by proxy headers only", logger.Fields{
+			"path":  path,
+			"error": err.Error(),
+		})
+		return nil
+	}
+	logger.Info("GeoIP database loaded", logger.Fields{"path": path, "type": db.Type()})
+	return db
+}
+
+// newURLNormalizer creates the normalizer destinations are stored with
+func newURLNormalizer(cfg config.URLConfig) urlnorm.Normalizer {
+	return urlnorm.Normalizer{
+		TrackingParams: cfg.TrackingParams,
+		StripTracking:  cfg.StripTrackingParams,
+	}
+}
+
+// newSessionStore creates the server-side session store selected in the config
+func newSessionStore(cfg config.AuthConfig, client *firestore.Client) interfaces.SessionStore {
+	switch cfg.SessionStore {
+	case "firestore":
+		if client == nil {
+			logger.Warn("Firestore session store requires Firestore storage, falling back to memory", nil)
+			return repositories.NewMemorySessionStore()
+		}
+		return repositories.NewSessionRepository(client)
+	case "memory":
+		return repositories.NewMemorySessionStore()
+	case "", "none":
+		return nil
+	default:
+		logger.Warn("Unknown SESSION_STORE, session tracking disabled", logger.Fields{
+			"session_store": cfg.SessionStore,
+		})
+		return nil
+	}
+}
+
+// newAPITokenStore creates the API token store selected in the config
+func newAPITokenStore(cfg config.AuthConfig, client *firestore.Client) interfaces.APITokenStore {
+	switch cfg.APITokenStore {
+	case "firestore":
+		if client == nil {
+			logger.Warn("Firestore API token store requires Firestore storage, falling back to memory", nil)
+			return repositories.NewMemoryAPITokenStore()
+		}
+		return repositories.NewAPITokenRepository(client)
+	case "memory":
+		return repositories.NewMemoryAPITokenStore()
+	case "", "none":
+		return nil
+	default:
+		logger.Warn("Unknown API_TOKEN_STORE, API tokens disabled", logger.Fields{
+			"api_token_store": cfg.APITokenStore,
+		})
+		return nil
+	}
+}
+
+// newRoleStore creates the store of user roles selected in the config
+func newRoleStore(cfg config.AuthConfig, client *firestore.Client) interfaces.UserRoleStore {
+	switch cfg.RoleStore {
+	case "firestore":
+		if client == nil {
+			logger.Warn("Firestore role store requires Firestore storage, falling back to memory", nil)
+			return repositories.NewMemoryUserRoleStore()
+		}
+		return repositories.NewUserRoleRepository(client)
+	case "memory":
+		return repositories.NewMemoryUserRoleStore()
+	case "", "none":
+		return nil
+	default:
+		logger.Warn("Unknown ROLE_STORE, role assignments disabled", logger.Fields{
+			"role_store": cfg.RoleStore,
+		})
+		return nil
+	}
+}
+
+// newGroupsService creates the service looking up the groups of users from
+// the source selected in the config, or nil when groups are disabled
+func newGroupsService(ctx context.Context, cfg config.AuthConfig) (*groups.Service, error) {
+	var source groups.Source
+	switch cfg.GroupsSource {
+	case "static":
+		static, err := groups.LoadStaticSource(cfg.GroupsFile)
+		if err != nil {
+			return nil, err
+		}
+		source = static
+	case "directory":
+		credentials, err := directoryCredentials(ctx, cfg.GroupsDirectorySubject)
+		if err != nil {
+			return nil, err
+		}
+		service, err := admin.NewService(ctx, credentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create directory client: %w", err)
+		}
+		source = groups.NewDirectorySource(service)
+	case "", "none":
+		return nil, nil
+	default:
+		logger.Warn("Unknown GROUPS_SOURCE, group sharing disabled", logger.Fields{
+			"groups_source": cfg.GroupsSource,
+		})
+		return nil, nil
+	}
+	return groups.NewService(source, groups.WithTTL(cfg.GroupsCacheTTL)), nil
+}
+
+// directoryCredentials returns the credentials the Directory API is read
+// with. Reading groups needs a Workspace admin, so with subject the service
+// account of the Firebase credentials impersonates it through domain-wide
+// delegation.
+func directoryCredentials(ctx context.Context, subject string) (option.ClientOption, error) {
+	if subject == "" {
+		return option.WithScopes(admin.AdminDirectoryGroupReadonlyScope), nil
+	}
+	credJSON := []byte(os.Getenv("FIREBASE_CREDENTIALS_JSON"))
+	if len(credJSON) == 0 {
+		var err error
+		if credJSON, err = os.ReadFile(os.Getenv("FIREBASE_CREDENTIALS_FILE")); err != nil {
+			return nil, fmt.Errorf("failed to read service account key: %w", err)
+		}
+	}
+	jwtConfig, err := google.JWTConfigFromJSON(credJSON, admin.AdminDirectoryGroupReadonlyScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %w", err)
+	}
+	jwtConfig.Subject = subject
+	return option.WithTokenSource(jwtConfig.TokenSource(ctx)), nil
+}
+
+// newPasskeyStore creates the passkey store selected in the config
+func newPasskeyStore(cfg config.AuthConfig, client *firestore.Client) interfaces.PasskeyStore {
+	switch cfg.PasskeyStore {
+	case "firestore":
+		if client == nil {
+			logger.Warn("Firestore passkey store requires Firestore storage, falling back to memory", nil)
+			return repositories.NewMemoryPasskeyStore()
+		}
+		return repositories.NewPasskeyRepository(client)
+	case "memory":
+		return repositories.NewMemoryPasskeyStore()
+	case "", "none":
+		return nil
+	default:
+		logger.Warn("Unknown PASSKEY_STORE, passkeys disabled", logger.Fields{
+			"passkey_store": cfg.PasskeyStore,
+		})
+		return nil
+	}
+}
+
+// rateLimitStore keeps the counters and lockouts of the brute-force guards
+// and the token buckets of the rate limiter
+type rateLimitStore interface {
+	ratelimit.Store
+	ratelimit.Limiter
+}
+
+// newRateLimitStore returns the rate-limit store of the config: in Redis,
+// shared by every replica, or in process memory
+func newRateLimitStore(cfg config.RateLimitConfig, redisClient redis.UniversalClient) rateLimitStore {
+	switch cfg.Store {
+	case "redis":
+		logger.Info("Rate limits are shared in Redis", nil)
+		return ratelimit.NewRedisStore(redisClient, "golink:ratelimit:")
+	case "memory", "":
+	default:
+		logger.Warn("Unknown rate limit store; using memory", logger.Fields{"store": cfg.Store})
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+// newRateLimitPolicy builds the rate limit policy of the config: the API
+// and redirect classes, further classes, and the routes assigned to them
+// on top of the routes exempt by default
+func newRateLimitPolicy(cfg config.RateLimitConfig) (middleware.RateLimitPolicy, error) {
+	policy := middleware.RateLimitPolicy{Routes: middleware.DefaultExemptRoutes()}
+	var err error
+	if policy.Classes, err = middleware.ParseRateLimitClasses(cfg.Classes); err != nil {
+		return policy, err
+	}
+	for name, rates := range map[string][2]string{
+		middleware.RouteClassAPI:      {cfg.API, cfg.APIPerUser},
+		middleware.RouteClassRedirect: {cfg.Redirect, cfg.RedirectPerUser},
+	} {
+		var class middleware.RateLimitClass
+		if class.PerIP, err = ratelimit.ParseRate(rates[0]); err != nil {
+			return policy, err
+		}
+		if class.PerUser, err = ratelimit.ParseRate(rates[1]); err != nil {
+			return policy, err
+		}
+		policy.Classes[name] = class
+	}
+	routes, err := middleware.ParseRateLimitRoutes(cfg.Routes)
+	if err != nil {
+		return policy, err
+	}
+	for route, class := range routes {
+		if _, ok := policy.Classes[class]; !ok && class != middleware.RouteClassExempt {
+			return policy, fmt.Errorf("rate limit route %s has no class %q", route, class)
+		}
+		policy.Routes[route] = class
+	}
+	return policy, nil
+}
+
+// newLeaseStore returns the store of the leases servers take turns with, or
+// nil for every server to run shared background work itself
+func newLeaseStore(backend string, client *firestore.Client, redisClient redis.UniversalClient) interfaces.LeaseStore {
+	switch backend {
+	case "firestore":
+		if client != nil {
+			return repositories.NewLeaseRepository(client)
+		}
+		logger.Warn("Firestore leases need Firestore; every server sweeps expired links", nil)
+	case "redis":
+		return repositories.NewRedisLeaseRepository(redisClient, repositories.DefaultRedisKeyPrefix)
+	case "none", "":
+	default:
+		logger.Warn("Unknown lease backend; every server sweeps expired links", logger.Fields{"lease": backend})
+	}
+	return nil
+}
+
+// leaseHolder names this server as the holder of leases
+func leaseHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "golink"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// newRedisClient creates a client of the Redis servers in the config.
+// Several addresses connect to a Redis cluster.
+func newRedisClient(cfg config.RedisConfig) redis.UniversalClient {
+	options := &redis.UniversalOptions{
+		Addrs:        cfg.Addrs,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+	}
+	if cfg.TLS {
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				logger.Fatal("Failed to read REDIS_TLS_CA_FILE", err, nil)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				logger.Fatal("No certificates in REDIS_TLS_CA_FILE", nil, logger.Fields{"file": cfg.CAFile})
+			}
+			options.TLSConfig.RootCAs = pool
+		}
+	}
+	return redis.NewUniversalClient(options)
+}
+
+// newIndexLister creates a lister of the Firestore database's indexes, or
+// returns nil when links are not stored in Firestore or the project is unknown
+func newIndexLister(cfg config.StorageConfig) firestoreindex.Lister {
+	if !usesFirestore(cfg) || cfg.ProjectID == "" {
+		return nil
+	}
+	lister, err := firestoreindex.NewAdminLister(context.Background(), cfg.ProjectID, firebaseCredentials())
+	if err != nil {
+		logger.Warn("Firestore indexes will not be checked", logger.Fields{"error": err.Error()})
+		return nil
+	}
+	return lister
+}
+
+// verifyIndexes checks the repositories' index manifest. Missing indexes are
+// logged with the command that creates them, and fail the startup when
+// FIRESTORE_INDEX_CHECK is "fail".
+func verifyIndexes(ctx context.Context, lister firestoreindex.Lister, mode string) error {
+	verification, err := firestoreindex.Verify(ctx, lister, repositories.FirestoreIndexes)
+	if err != nil {
+		logger.Warn("Failed to verify Firestore indexes", logger.Fields{"error": err.Error()})
+		return nil
+	}
+	for _, index := range verification.Missing {
+		logger.Error("Missing Firestore index", nil, logger.Fields{
+			"index":   index.String(),
+			"query":   index.Query,
+			"command": index.CreateCommand(),
+		})
+	}
+	for _, index := range verification.Building {
+		logger.Warn("Firestore index is still building", logger.Fields{
+			"index": index.String(),
+			"query": index.Query,
+		})
+	}
+	if len(verification.Missing) > 0 && mode == "fail" {
+		return fmt.Errorf("%d Firestore indexes are missing", len(verification.Missing))
+	}
+	return nil
+}
+
+// newDoctor creates the configuration checks of `server doctor` and
+// /api/admin/doctor. Firestore indexes are only checked when the project is known.
+func newDoctor(cfg *config.Config, client *http.Client) *doctor.Doctor {
+	opts := []doctor.Option{
+		doctor.WithHTTPClient(client),
+		doctor.WithRequiredIndexes(repositories.FirestoreIndexes),
+	}
+	if lister := newIndexLister(cfg.Storage); lister != nil {
+		opts = append(opts, doctor.WithIndexLister(lister))
+	}
+	return doctor.New(doctor.Settings{
+		AppDomain:        cfg.Server.Domain,
+		AuthProvider:     cfg.Auth.Provider,
+		OAuthRedirectURL: cfg.Auth.OAuthRedirectURL,
+		SessionDomain:    cfg.Auth.SessionDomain,
+		CORSOrigin:       cfg.CORS.Origin,
+		FrontendURL:      cfg.Auth.FrontendURL,
+		StorageBackend:   cfg.Storage.Backend,
+	}, opts...)
+}
+
+// runDoctor checks the configuration, prints the results with remediation
+// steps and returns the exit code: 1 when any check failed
+func runDoctor(cfg *config.Config) int {
+	client, err := egress.NewClient(egress.Config{
+		ProxyURL: cfg.Egress.ProxyURL,
+		NoProxy:  cfg.Egress.NoProxy,
+	}, doctor.DefaultTimeout)
+	if err != nil {
+		logger.Error("Invalid outbound proxy configuration", err, nil)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	report := newDoctor(cfg, client).Run(ctx)
+	if err := report.Write(os.Stdout); err != nil || !report.OK {
+		return 1
+	}
+	return 0
+}
+
+// registerComponent adds a component to the server's lifecycle
+func registerComponent(components *lifecycle.Manager, c lifecycle.Component) {
+	if err := components.Register(c); err != nil {
+		logger.Fatal("Invalid server component", err, nil)
+	}
+}
+
 func main() {
-	// Initialize Firebase
-	client, err := initFirebase()
+	// Load config
+	cfg := config.New()
+
+	// `server doctor` checks the configuration and exits instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(cfg))
+	}
+
+	// Initialize Firebase unless links are stored elsewhere
+	var client *firestore.Client
+	if usesFirestore(cfg.Storage) {
+		var err error
+		client, err = initFirebase()
+		if err != nil {
+			logger.Fatal("Failed to initialize Firebase", err, nil)
+		}
+	}
+	var postgresPool *pgxpool.Pool
+	if cfg.Storage.Backend == "postgres" {
+		postgresPool = newPostgresPool(cfg.Storage)
+	}
+	var sqliteDB *sql.DB
+	if cfg.Storage.Backend == "sqlite" {
+		// The schema is migrated as the database is opened
+		var err error
+		sqliteDB, err = repositories.OpenSQLite(context.Background(), cfg.Storage.SQLitePath)
+		if err != nil {
+			logger.Fatal("Failed to open the SQLite database", err, logger.Fields{"path": cfg.Storage.SQLitePath})
+		}
+	}
+	var redisClient redis.UniversalClient
+	if cfg.Storage.Backend == "redis" || cfg.Cache.Backend == "redis" || cfg.Expiry.Lease == "redis" || cfg.RateLimit.Store == "redis" {
+		redisClient = newRedisClient(cfg.Redis)
+	}
+
+	// Outbound calls go through the egress proxy, if any
+	egressConfig := egress.Config{
+		ProxyURL: cfg.Egress.ProxyURL,
+		NoProxy:  cfg.Egress.NoProxy,
+	}
+	egressProxy, err := egressConfig.Proxy()
+	if err != nil {
+		logger.Fatal("Invalid outbound proxy configuration", err, nil)
+	}
+	oauthHTTPClient, err := egress.NewClient(egressConfig, oauthTimeout)
 	if err != nil {
-		logger.Fatal("Failed to initialize Firebase", err, nil)
+		logger.Fatal("Invalid outbound proxy configuration", err, nil)
 	}
-	defer client.Close()
 
 	// Initialize authentication system
 	if err := auth.InitSessionManager(); err != nil {
@@ -76,8 +734,109 @@ func main() {
 	if err := auth.InitAuth(); err != nil {
 		logger.Warn("Failed to initialize authentication", logger.Fields{"error": err.Error()})
 	}
+	if cfg.Auth.Provider == auth.ProviderLocal && auth.IsAuthEnabled() {
+		auth.SetPasswordProvider(auth.NewLocalProvider(repositories.NewFileLocalUserStore(cfg.Auth.LocalUsersFile)))
+		logger.Info("Local accounts enabled", logger.Fields{"users_file": cfg.Auth.LocalUsersFile})
+	}
+	if cfg.Auth.Provider == auth.ProviderSAML && auth.IsAuthEnabled() {
+		idp, err := saml.LoadIdentityProvider(cfg.Auth.SAMLMetadataFile)
+		if err != nil {
+			logger.Fatal("Failed to load SAML identity provider", err, logger.Fields{"metadata_file": cfg.Auth.SAMLMetadataFile})
+		}
+		auth.SetSAMLProvider(saml.New(cfg.Auth.SAMLEntityID, cfg.Auth.SAMLACSURL, idp), auth.SAMLAttributes{
+			Email: cfg.Auth.SAMLEmailAttributes,
+			Name:  cfg.Auth.SAMLNameAttributes,
+		})
+		logger.Info("SAML sign-in enabled", logger.Fields{
+			"idp_entity_id": idp.EntityID,
+			"entity_id":     cfg.Auth.SAMLEntityID,
+			"acs_url":       cfg.Auth.SAMLACSURL,
+		})
+	}
+	if store := newSessionStore(cfg.Auth, client); store != nil {
+		auth.SetSessionStore(store, cfg.Auth.SessionMaxPerUser)
+		logger.Info("Server-side session tracking enabled", logger.Fields{
+			"session_store": cfg.Auth.SessionStore,
+			"max_per_user":  cfg.Auth.SessionMaxPerUser,
+		})
+	}
+
+	// Rate limits, lockouts and click events key on the client address
+	if cfg.Server.TrustedProxyHops < 0 {
+		logger.Fatal("Invalid trusted proxy configuration", fmt.Errorf("TRUSTED_PROXY_HOPS must not be negative"), nil)
+	}
+	auth.SetTrustedProxyHops(cfg.Server.TrustedProxyHops)
+
+	// Shared store for rate limiting and brute-force lockouts
+	rateLimitStore := newRateLimitStore(cfg.RateLimit, redisClient)
+	rateLimitPolicy, err := newRateLimitPolicy(cfg.RateLimit)
+	if err != nil {
+		logger.Fatal("Invalid rate limit configuration", err, nil)
+	}
+	if cfg.Auth.LoginMaxFailures > 0 {
+		auth.SetLoginGuard(ratelimit.NewGuard(rateLimitStore, "login",
+			cfg.Auth.LoginMaxFailures, cfg.Auth.LoginFailureWindow, cfg.Auth.LoginLockoutDuration))
+	}
+	if store := newAPITokenStore(cfg.Auth, client); store != nil {
+		tiers, err := auth.ParseTokenTiers(cfg.Auth.APITokenTiers)
+		if err != nil {
+			logger.Fatal("Invalid API token configuration", err, nil)
+		}
+		auth.SetAPITokenStore(store, auth.TokenLimits{
+			Default: auth.TokenTier{
+				RequestsPerMinute: cfg.Auth.APITokenRequestsPerMinute,
+				MonthlyQuota:      cfg.Auth.APITokenMonthlyQuota,
+			},
+			Scopes: tiers,
+		}, rateLimitStore)
+		logger.Info("API tokens enabled", logger.Fields{
+			"api_token_store": cfg.Auth.APITokenStore,
+		})
+	}
+	if store := newPasskeyStore(cfg.Auth, client); store != nil {
+		auth.SetPasskeys(store, webauthn.RelyingParty{
+			ID:      cfg.Auth.PasskeyRPID,
+			Name:    cfg.Auth.PasskeyRPName,
+			Origins: cfg.Auth.PasskeyOrigins,
+		}, rateLimitStore, cfg.Auth.StepUpTTL)
+		logger.Info("Admin passkeys enabled", logger.Fields{
+			"passkey_store": cfg.Auth.PasskeyStore,
+			"rp_id":         cfg.Auth.PasskeyRPID,
+			"step_up_ttl":   cfg.Auth.StepUpTTL.String(),
+		})
+	}
+	auth.SetAdminEmails(cfg.Auth.AdminEmails)
+	if cfg.Auth.DefaultRole != models.RoleViewer && cfg.Auth.DefaultRole != models.RoleEditor {
+		logger.Fatal("Invalid role configuration", fmt.Errorf("DEFAULT_ROLE must be viewer or editor, not %q", cfg.Auth.DefaultRole), nil)
+	}
+	auth.SetRoleStore(newRoleStore(cfg.Auth, client), cfg.Auth.DefaultRole)
+	logger.Info("User roles configured", logger.Fields{
+		"role_store":   cfg.Auth.RoleStore,
+		"default_role": cfg.Auth.DefaultRole,
+	})
+	groupsService, err := newGroupsService(context.Background(), cfg.Auth)
+	if err != nil {
+		logger.Fatal("Failed to set up groups", err, logger.Fields{"groups_source": cfg.Auth.GroupsSource})
+	}
+	if groupsService != nil {
+		logger.Info("Group sharing enabled", logger.Fields{
+			"groups_source":    cfg.Auth.GroupsSource,
+			"groups_cache_ttl": cfg.Auth.GroupsCacheTTL.String(),
+		})
+	}
+	if cfg.Auth.TrustedProxyAuth {
+		if len(cfg.Auth.TrustedProxySecrets) == 0 {
+			logger.Fatal("Invalid trusted proxy configuration", fmt.Errorf("TRUSTED_PROXY_AUTH requires TRUSTED_PROXY_SECRET"), nil)
+		}
+		auth.SetTrustedProxyAuth(cfg.Auth.TrustedProxySecrets)
+		logger.Info("Trusted proxy authentication enabled", nil)
+	}
+	auth.SetHTTPClient(oauthHTTPClient)
 	logger.Info("Authentication system initialized successfully", nil)
 
+	// Continue traces started by upstream proxies (W3C traceparent) in auth spans
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
 	// Get domain from environment variable or use default
 	domain := os.Getenv("APP_DOMAIN")
 	if domain == "" {
@@ -89,15 +848,244 @@ func main() {
 	}
 
 	// Create repository
-	linkRepo := repositories.NewLinkRepository(client)
+	linkRepo := newLinkRepository(cfg.Storage, storageClients{
+		firestore: client,
+		postgres:  postgresPool,
+		sqlite:    sqliteDB,
+		redis:     redisClient,
+	})
+	redisLinks, _ := linkRepo.(*repositories.RedisLinkRepository)
+
+	// Replicas share cached responses, and the links redirects look up, in Redis
+	switch cfg.Cache.Backend {
+	case "redis":
+		store := cache.NewRedisStore(redisClient, "golink:cache:")
+		middleware.SetResponseStore(middleware.NewSharedCache(store))
+		if redisLinks == nil {
+			linkRepo = repositories.NewCachedLinkRepository(linkRepo, "shared", store, cfg.Cache.LinkTTL)
+		}
+		logger.Info("Caching responses and links in Redis", logger.Fields{
+			"redis_addr": cfg.Redis.Addrs,
+			"link_ttl":   cfg.Cache.LinkTTL.String(),
+		})
+	case "", "memory":
+	default:
+		logger.Warn("Unknown CACHE_BACKEND, caching responses in memory", logger.Fields{
+			"cache_backend": cfg.Cache.Backend,
+		})
+	}
+
+	// The hottest links redirects look up are also kept in memory, in front
+	// of the shared cache; other replicas' changes show once they expire
+	if cfg.Cache.HotLinkSize > 0 {
+		linkRepo = repositories.NewCachedLinkRepository(linkRepo, "hot", cache.NewMemoryStore(cfg.Cache.HotLinkSize), cfg.Cache.HotLinkTTL)
+	}
+
+	// Create short code generators for links created without a short code;
+	// requests may pick any strategy, and the configured one is the default
+	shortCodeGenerator, err := shortcode.NewStrategy(cfg.ShortCode.Strategy, cfg.ShortCode.Length, cfg.ShortCode.Alphabet)
+	if err != nil {
+		logger.Fatal("Invalid short code configuration", err, nil)
+	}
+	shortCodeStrategies := map[string]handlers.ShortCodeGenerator{cfg.ShortCode.Strategy: shortCodeGenerator}
+	for _, name := range shortcode.Strategies() {
+		if name == cfg.ShortCode.Strategy {
+			continue
+		}
+		strategy, err := shortcode.NewStrategy(name, cfg.ShortCode.Length, cfg.ShortCode.Alphabet)
+		if err != nil {
+			logger.Fatal("Invalid short code configuration", err, logger.Fields{"strategy": name})
+		}
+		shortCodeStrategies[name] = strategy
+	}
+
+	// Compile the destination blocklist
+	blockedPatterns, err := urlpolicy.CompilePatterns(cfg.URL.BlockedPatterns)
+	if err != nil {
+		logger.Fatal("Invalid URL blocklist configuration", err, nil)
+	}
+
+	// Check the classification policy
+	classificationPolicy := classification.Policy{
+		Default:      cfg.Classification.Default,
+		Interstitial: cfg.Classification.Interstitial,
+		Hidden:       cfg.Classification.Hidden,
+	}
+	if err := classificationPolicy.Validate(); err != nil {
+		logger.Fatal("Invalid classification configuration", err, nil)
+	}
+
+	// Anyone may try links out in the sandbox; they expire on their own
+	sandboxPolicy := sandbox.Policy{Namespace: cfg.Sandbox.Namespace, TTL: cfg.Sandbox.TTL}
 
 	// Create handlers
-	linkHandler := handlers.NewLinkHandler(linkRepo)
+	linkOptions := []handlers.LinkHandlerOption{
+		handlers.WithShortCodeGenerator(shortCodeGenerator),
+		handlers.WithShortCodeStrategies(shortCodeStrategies),
+		handlers.WithReservedShortCodes(cfg.ShortCode.Reserved),
+		handlers.WithVersionStore(newLinkVersionStore(cfg.Storage, client)),
+		handlers.WithAliasStore(newLinkAliasStore(cfg.Storage, client)),
+		handlers.WithSnapshotStore(newLinkSnapshotStore(cfg.Storage, client)),
+		handlers.WithUndoWindow(cfg.Trash.UndoWindow),
+		handlers.WithPopularityHalfLife(cfg.Ranking.PopularityHalfLife),
+		handlers.WithReferenceStore(newLinkReferenceStore(cfg.Storage, client)),
+		handlers.WithFavoriteStore(newUserFavoriteStore(cfg.Storage, client)),
+		handlers.WithLinkHosts(domain),
+		handlers.WithDuplicateURLRejection(cfg.URL.RejectDuplicates),
+		handlers.WithClassificationPolicy(classificationPolicy),
+		handlers.WithSandbox(sandboxPolicy),
+		handlers.WithURLNormalizer(newURLNormalizer(cfg.URL)),
+		handlers.WithURLPolicy(urlpolicy.Policy{
+			MaxLength:        cfg.URL.MaxLength,
+			MaxQueryLength:   cfg.URL.MaxQueryLength,
+			AllowCredentials: cfg.URL.AllowCredentials,
+			BlockedDomains:   cfg.URL.BlockedDomains,
+			BlockedPatterns:  blockedPatterns,
+		}),
+	}
+	if cfg.URL.HealthCheck {
+		fetchOptions := safehttp.DefaultOptions()
+		fetchOptions.Proxy = egressProxy
+		linkOptions = append(linkOptions, handlers.WithHealthChecker(linkcheck.New(safehttp.New(fetchOptions))))
+		logger.Info("Link destination health checks enabled", nil)
+	}
+	if cfg.Ranking.PersonalizedSearch {
+		linkOptions = append(linkOptions, handlers.WithClickHistory(newUserClickStore(cfg.Storage, client), cfg.Ranking.ClickHistoryRetention))
+	}
+	if cfg.URL.Previews {
+		fetchOptions := safehttp.DefaultOptions()
+		fetchOptions.Proxy = egressProxy
+		linkOptions = append(linkOptions, handlers.WithPreviewFetcher(preview.New(safehttp.New(fetchOptions),
+			preview.WithTTL(cfg.URL.PreviewTTL),
+		)))
+	}
+	// Every redirect queues a click event; the background recorder folds
+	// them into the link statistics and stores them, anonymized, in the
+	// click stream
+	var clickSinks []privacy.Sink
+	var analyticsOptions []handlers.AnalyticsHandlerOption
+	retentionOptions := []retention.Option{retention.WithInterval(cfg.Analytics.RetentionInterval)}
+	if cfg.Analytics.LinkStats {
+		clickSinks = append(clickSinks, clickstats.NewSink(linkRepo))
+	}
+	clickExporter, err := newClickExporter(cfg.Export)
+	if err != nil {
+		logger.Fatal("Invalid click export configuration", err, nil)
+	}
+	_, noExport := clickExporter.(export.Nop)
+	var anonymizer *privacy.Anonymizer
+	if cfg.Analytics.ClickEvents || !noExport {
+		if anonymizer, err = newAnonymizer(cfg.Privacy); err != nil {
+			logger.Fatal("Invalid privacy configuration", err, nil)
+		}
+	}
+	if !noExport {
+		// Analysts join the anonymized events with other warehouse data
+		clickSinks = append(clickSinks, anonymizer.Wrap(clickExporter))
+	}
+	if cfg.Analytics.ClickEvents {
+		clickEventStore := newClickEventStore(cfg.Storage, client)
+		clickSinks = append(clickSinks, anonymizer.Wrap(clickEventStore))
+		// Past click breakdowns are rebuilt from the click stream
+		analyticsOptions = append(analyticsOptions, handlers.WithClickStream(clickEventStore))
+		linkOptions = append(linkOptions, handlers.WithLinkClickStream(clickEventStore))
+		retentionOptions = append(retentionOptions, retention.WithClickEvents(clickEventStore))
+	}
+	regionResolver, err := newRegionResolver(cfg.Region)
+	if err != nil {
+		logger.Fatal("Invalid region configuration", err, nil)
+	}
+	if regionResolver != nil {
+		linkOptions = append(linkOptions, handlers.WithRegionResolver(regionResolver))
+	}
+	var clickRecorder *clickstream.Recorder
+	var geoDB *geoip.Database
+	// Clicks and regions are both located by GeoIP
+	if len(clickSinks) > 0 || len(cfg.Region.Countries) > 0 {
+		geoDB = openGeoIPDatabase(cfg.Analytics.GeoIPDatabase)
+		if geoDB != nil {
+			linkOptions = append(linkOptions, handlers.WithGeoIP(geoDB))
+		}
+	}
+	if len(clickSinks) > 0 {
+		clickRecorder = clickstream.New(clickstream.Tee(clickSinks...), clickstream.Options{
+			BufferSize: cfg.Analytics.ClickEventBuffer,
+		})
+		linkOptions = append(linkOptions, handlers.WithClickEvents(clickRecorder))
+	}
+	// Admins register webhooks that receive every change to a link, signed
+	// and retried in the background
+	var webhookStore interfaces.WebhookStore
+	var webhookDispatcher *webhook.Dispatcher
+	if cfg.Webhook.Outbound {
+		webhookStore = newWebhookStore(cfg.Storage, client)
+		fetchOptions := safehttp.DefaultOptions()
+		fetchOptions.Proxy = egressProxy
+		fetchOptions.Timeout = cfg.Webhook.Timeout
+		fetchOptions.MaxRedirects = 0
+		webhookDispatcher = webhook.NewDispatcher(webhookStore, safehttp.New(fetchOptions),
+			webhook.WithMaxAttempts(cfg.Webhook.MaxAttempts),
+			webhook.WithRetryBackoff(cfg.Webhook.RetryBackoff, cfg.Webhook.MaxRetryBackoff),
+		)
+		linkOptions = append(linkOptions, handlers.WithWebhooks(webhookDispatcher))
+	}
+	// Product feature usage is counted per day to guide the roadmap
+	var productMetricsStore interfaces.ProductMetricsStore
+	var usageRecorder *usage.Recorder
+	if cfg.Analytics.ProductMetrics {
+		productMetricsStore = newProductMetricsStore(cfg.Storage, client)
+		usageRecorder = usage.NewRecorder(productMetricsStore)
+		linkOptions = append(linkOptions, handlers.WithUsageRecorder(usageRecorder))
+	}
+	linkHandler := handlers.NewLinkHandler(linkRepo, linkOptions...)
 	healthHandler := handlers.NewHealthHandler(linkRepo)
-	analyticsHandler := handlers.NewAnalyticsHandler(linkRepo)
+	analyticsOptions = append(analyticsOptions,
+		handlers.WithTrendingHalfLife(cfg.Ranking.PopularityHalfLife),
+		handlers.WithAnalyticsClassificationPolicy(classificationPolicy),
+		handlers.WithAnalyticsSandbox(sandboxPolicy))
+	analyticsHandler := handlers.NewAnalyticsHandler(linkRepo, analyticsOptions...)
 
 	// Set up routes
-	router := routes.NewRouter(linkHandler, healthHandler, analyticsHandler)
+	routerOptions := []routes.RouterOption{routes.WithRateLimiter(rateLimitStore, rateLimitPolicy), routes.WithMaxLinks(cfg.Storage.MaxLinksPerRequest)}
+	if len(cfg.Webhook.IndexerSecrets) > 0 {
+		routerOptions = append(routerOptions, routes.WithIndexerVerifier(webhook.NewVerifier(cfg.Webhook.IndexerSecrets,
+			webhook.WithReplayWindow(cfg.Webhook.ReplayWindow),
+			webhook.WithNonceStore(rateLimitStore),
+		)))
+	}
+	if webhookStore != nil {
+		routerOptions = append(routerOptions, routes.WithWebhookStore(webhookStore))
+	}
+	if groupsService != nil {
+		routerOptions = append(routerOptions, routes.WithGroups(groupsService))
+	}
+	if productMetricsStore != nil {
+		routerOptions = append(routerOptions, routes.WithProductMetrics(productMetricsStore))
+	}
+	// Admins copy the settings of one environment to another
+	routerOptions = append(routerOptions, routes.WithSettings(config.PortableEnv()))
+	components := lifecycle.NewManager()
+	routerOptions = append(routerOptions, routes.WithLifecycle(components))
+	if doctorClient, err := egress.NewClient(egressConfig, doctor.DefaultTimeout); err == nil {
+		routerOptions = append(routerOptions, routes.WithDoctor(newDoctor(cfg, doctorClient)))
+	}
+	// Operators see how the storage grows without inspecting Firestore
+	var storageStats *storagestats.Collector
+	if client != nil && cfg.Storage.StatsInterval > 0 {
+		storageStats = storagestats.NewCollector(repositories.NewFirestoreStorageInspector(client),
+			storagestats.WithInterval(cfg.Storage.StatsInterval))
+		routerOptions = append(routerOptions, routes.WithStorageStats(storageStats))
+	}
+	// Admins can record one link's or one user's requests to diagnose them
+	if cfg.Debug.Capture {
+		routerOptions = append(routerOptions, routes.WithCapture(capture.NewRecorder(
+			capture.WithMaxTTL(cfg.Debug.CaptureMaxTTL),
+			capture.WithMaxEntries(cfg.Debug.CaptureMaxEntries),
+		)))
+	}
+	// Bound the memory held by cached responses
+	middleware.SetResponseCacheLimits(cfg.Cache.ResponseMaxEntries, cfg.Cache.ResponseMaxBytes)
+	router := routes.NewRouter(linkHandler, healthHandler, analyticsHandler, routerOptions...)
 	handler := router.SetupRoutes()
 
 	// Setup CORS
@@ -112,7 +1100,7 @@ func main() {
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{corsOrigin},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Cache-Control"},
 		AllowCredentials: true,
 	}).Handler(handler)
 
@@ -131,23 +1119,214 @@ func main() {
 		IdleTimeout:  idleTimeout,
 	}
 
+	// Components start in dependency order and stop in reverse: the server
+	// stops accepting requests, then background work drains, then storage closes
+	var storageDeps []string
+	if client != nil {
+		registerComponent(components, lifecycle.Component{
+			Name: "firestore",
+			Stop: func(ctx context.Context) error { return client.Close() },
+			Ready: func(ctx context.Context) error {
+				_, err := client.Collection("links").Limit(1).Documents(ctx).Next()
+				if err == iterator.Done {
+					return nil
+				}
+				return err
+			},
+		})
+		storageDeps = append(storageDeps, "firestore")
+		if lister := newIndexLister(cfg.Storage); lister != nil && cfg.Storage.IndexCheck != "off" {
+			registerComponent(components, lifecycle.Component{
+				Name:      "firestore-indexes",
+				DependsOn: []string{"firestore"},
+				Start: func(ctx context.Context) error {
+					return verifyIndexes(ctx, lister, cfg.Storage.IndexCheck)
+				},
+			})
+			storageDeps = append(storageDeps, "firestore-indexes")
+		}
+	}
+	if postgresPool != nil {
+		// The schema is migrated with cmd/migrate -postgres before the server starts
+		registerComponent(components, lifecycle.Component{
+			Name: "postgres",
+			Start: func(ctx context.Context) error {
+				pending, err := repositories.PendingPostgresMigrations(ctx, postgresPool)
+				if err != nil {
+					return err
+				}
+				if len(pending) > 0 {
+					return fmt.Errorf("%d PostgreSQL migrations are pending; run cmd/migrate -postgres", len(pending))
+				}
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				postgresPool.Close()
+				return nil
+			},
+			Ready: func(ctx context.Context) error { return postgresPool.Ping(ctx) },
+		})
+		storageDeps = append(storageDeps, "postgres")
+	}
+	if sqliteDB != nil {
+		registerComponent(components, lifecycle.Component{
+			Name:  "sqlite",
+			Stop:  func(ctx context.Context) error { return sqliteDB.Close() },
+			Ready: func(ctx context.Context) error { return sqliteDB.PingContext(ctx) },
+		})
+		storageDeps = append(storageDeps, "sqlite")
+	}
+	if redisClient != nil {
+		// Requests read and invalidate the caches until the server stops
+		registerComponent(components, lifecycle.Component{
+			Name:  "redis",
+			Stop:  func(ctx context.Context) error { return redisClient.Close() },
+			Ready: func(ctx context.Context) error { return redisClient.Ping(ctx).Err() },
+		})
+	}
+	if redisLinks != nil {
+		// A Redis that lost its links gets them back from Firestore first
+		registerComponent(components, lifecycle.Component{
+			Name:      "redis-links",
+			DependsOn: append(append([]string{}, storageDeps...), "redis"),
+			Start: func(ctx context.Context) error {
+				copied, err := redisLinks.Preload(ctx)
+				if copied > 0 {
+					logger.Info("Copied links from Firestore into Redis", logger.Fields{"links": copied})
+				}
+				return err
+			},
+		})
+		storageDeps = append(storageDeps, "redis-links")
+	}
+	if storageStats != nil {
+		registerComponent(components, lifecycle.Component{
+			Name:      "storage-stats",
+			DependsOn: storageDeps,
+			Start:     storageStats.Start,
+			Stop:      storageStats.Stop,
+		})
+	}
+	if cfg.Expiry.SweepInterval > 0 {
+		expiryOptions := []expiry.Option{
+			expiry.WithInterval(cfg.Expiry.SweepInterval),
+			expiry.WithJitter(cfg.Expiry.SweepJitter),
+			expiry.WithTrashAfter(cfg.Expiry.TrashAfter),
+		}
+		if leases := newLeaseStore(cfg.Expiry.Lease, client, redisClient); leases != nil {
+			expiryOptions = append(expiryOptions, expiry.WithLease(leases, leaseHolder()))
+		}
+		expirySweeper := expiry.NewSweeper(linkRepo, expiryOptions...)
+		registerComponent(components, lifecycle.Component{
+			Name:      "expiry-sweeper",
+			DependsOn: storageDeps,
+			Start:     expirySweeper.Start,
+			Stop:      expirySweeper.Stop,
+		})
+	}
+	if sandboxPolicy.Enabled() {
+		sweeper := sandbox.NewSweeper(linkRepo, sandboxPolicy, sandbox.WithInterval(cfg.Sandbox.SweepInterval))
+		registerComponent(components, lifecycle.Component{
+			Name:      "sandbox-sweeper",
+			DependsOn: storageDeps,
+			Start:     sweeper.Start,
+			Stop:      sweeper.Stop,
+		})
+	}
+	retentionPolicy := retention.Policy{
+		DailyStats:  cfg.Analytics.DailyStatsRetention,
+		ClickEvents: cfg.Analytics.ClickEventRetention,
+	}
+	if retentionPolicy.Enabled() {
+		retentionJob := retention.NewJob(linkRepo, retentionPolicy, retentionOptions...)
+		registerComponent(components, lifecycle.Component{
+			Name:      "analytics-retention",
+			DependsOn: storageDeps,
+			Start:     retentionJob.Start,
+			Stop:      retentionJob.Stop,
+		})
+	}
+	workerDeps := storageDeps
+	if clickRecorder != nil {
+		// Redirects queue click events until the server stops, and the queue
+		// is written out before storage closes
+		registerComponent(components, lifecycle.Component{
+			Name:      "click-events",
+			DependsOn: storageDeps,
+			Start:     clickRecorder.Start,
+			Stop:      clickRecorder.Stop,
+		})
+		workerDeps = append(append([]string{}, storageDeps...), "click-events")
+	}
+	if webhookDispatcher != nil {
+		// Link changes publish events until the server stops, and the queued
+		// ones are delivered before storage closes
+		registerComponent(components, lifecycle.Component{
+			Name:      "webhooks",
+			DependsOn: storageDeps,
+			Start:     webhookDispatcher.Start,
+			Stop:      webhookDispatcher.Stop,
+		})
+		workerDeps = append(append([]string{}, workerDeps...), "webhooks")
+	}
+	if usageRecorder != nil {
+		// Requests count feature usage until the server stops, and the
+		// counts are written before storage closes
+		registerComponent(components, lifecycle.Component{
+			Name:      "product-metrics",
+			DependsOn: storageDeps,
+			Start:     usageRecorder.Start,
+			Stop:      usageRecorder.Stop,
+		})
+		workerDeps = append(append([]string{}, workerDeps...), "product-metrics")
+	}
+	if geoDB != nil {
+		// Redirects look clients up until the server stops
+		registerComponent(components, lifecycle.Component{
+			Name: "geoip",
+			Stop: func(ctx context.Context) error { return geoDB.Close() },
+		})
+		workerDeps = append(append([]string{}, workerDeps...), "geoip")
+	}
+	if redisClient != nil {
+		workerDeps = append(append([]string{}, workerDeps...), "redis")
+	}
+	registerComponent(components, lifecycle.Component{
+		Name:      "link-workers",
+		DependsOn: workerDeps,
+		Stop:      linkHandler.Drain,
+	})
+	registerComponent(components, lifecycle.Component{
+		Name:      "http-server",
+		DependsOn: []string{"link-workers"},
+		Start: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+					logger.Fatal("Server error", err, nil)
+				}
+			}()
+			logger.Info("Server starting", logger.Fields{
+				"port":        port,
+				"domain":      domain,
+				"cors_origin": corsOrigin,
+				"version":     os.Getenv("APP_VERSION"),
+			})
+			return nil
+		},
+		Stop: server.Shutdown,
+	})
+
 	// Create a channel to listen for shutdown signals
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	// Start the server in a goroutine
-	go func() {
-		logger.Info("Server starting", logger.Fields{
-			"port":        port,
-			"domain":      domain,
-			"cors_origin": corsOrigin,
-			"version":     os.Getenv("APP_VERSION"),
-		})
-
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("Server error", err, nil)
-		}
-	}()
+	if err := components.Start(context.Background()); err != nil {
+		logger.Fatal("Failed to start server", err, nil)
+	}
 
 	// Wait for shutdown signal
 	<-stop
@@ -157,8 +1336,8 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
-	// Shutdown the server gracefully
-	if err := server.Shutdown(ctx); err != nil {
+	// Stop every component, even if some of them fail to stop in time
+	if err := components.Stop(ctx); err != nil {
 		logger.Fatal("Server forced to shutdown", err, nil)
 	}
 
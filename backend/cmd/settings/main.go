@@ -0,0 +1,141 @@
+// Command settings copies the settings of one environment to another.
+//
+//	settings export [-o settings.json]
+//	settings import [-dry-run] [-env-file staging.env] settings.json
+//
+// export writes the portable environment variables of the current
+// environment and the webhooks registered in its Firestore project as one
+// versioned JSON document. import registers the document's webhooks in the
+// current project, matching existing ones by URL, and writes its environment
+// variables to -env-file for the deployment to start the server with. Log
+// levels only live in a running server; use /api/admin/settings to copy them.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/pkg/config"
+	"github.com/Okabe-Junya/golink-backend/pkg/settings"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: settings export [-o file] | import [-dry-run] [-env-file file] <file>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(context.Background(), flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "settings:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes a subcommand
+func run(ctx context.Context, command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	output := flags.String("o", "", "File to write the exported document to instead of standard output")
+	dryRun := flags.Bool("dry-run", false, "Report what importing would change without changing anything")
+	envFile := flags.String("env-file", "", "File to write the imported environment variables to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, closeStore, err := openWebhookStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	switch command {
+	case "export":
+		doc, err := settings.Export(ctx, config.PortableEnv(), store)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		if *output == "" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return os.WriteFile(*output, data, 0o600)
+	case "import":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("import needs a settings document")
+		}
+		return importSettings(ctx, store, flags.Arg(0), *envFile, *dryRun)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// importSettings imports the document in path, writing its environment to
+// envFile when set
+func importSettings(ctx context.Context, store interfaces.WebhookStore, path, envFile string, dryRun bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc settings.Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid settings document: %w", err)
+	}
+	if err := doc.Validate(); err != nil {
+		return err
+	}
+
+	for _, change := range settings.DiffEnv(config.PortableEnv(), doc.Env) {
+		fmt.Printf("env %s: %q -> %q\n", change.Key, change.Current, change.Imported)
+	}
+	if envFile != "" && !dryRun {
+		if err := os.WriteFile(envFile, settings.EnvFile(doc.Env), 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %d environment variables to %s\n", len(doc.Env), envFile)
+	}
+
+	if store == nil {
+		if len(doc.Webhooks) > 0 {
+			fmt.Printf("skipped %d webhooks: no Firestore project configured\n", len(doc.Webhooks))
+		}
+		return nil
+	}
+	changes, err := settings.ImportWebhooks(ctx, store, doc.Webhooks, "settings-import", dryRun)
+	for _, change := range changes {
+		fmt.Printf("webhook %s: %s", change.URL, change.Action)
+		if change.Secret != "" {
+			fmt.Printf(", secret %s", change.Secret)
+		}
+		fmt.Println()
+	}
+	return err
+}
+
+// openWebhookStore opens the webhooks of the Firestore project in
+// PROJECT_ID. Without a project there is no store.
+func openWebhookStore(ctx context.Context) (interfaces.WebhookStore, func(), error) {
+	projectID := os.Getenv("PROJECT_ID")
+	if projectID == "" {
+		return nil, func() {}, nil
+	}
+	client, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize Firestore client: %w", err)
+	}
+	return repositories.NewWebhookRepository(client), func() { client.Close() }, nil
+}
@@ -0,0 +1,163 @@
+// Command users manages the local accounts users sign in with when the server
+// runs with AUTH_PROVIDER=local.
+//
+//	users [-file users.json] add [-email addr] [-name name] [-generate] <username>
+//	users [-file users.json] passwd [-generate] <username>
+//	users [-file users.json] disable|enable|remove <username>
+//	users [-file users.json] list
+//
+// Passwords are read from the first line of standard input, or generated and
+// printed with -generate.
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+)
+
+func main() {
+	file := flag.String("file", defaultUsersFile(), "JSON file holding the local accounts; should match LOCAL_USERS_FILE")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: users [-file path] add|passwd|disable|enable|remove|list [flags] [username]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store := repositories.NewFileLocalUserStore(*file)
+	if err := run(context.Background(), store, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "users:", err)
+		os.Exit(1)
+	}
+}
+
+// defaultUsersFile is LOCAL_USERS_FILE, as the server reads it
+func defaultUsersFile() string {
+	if file := os.Getenv("LOCAL_USERS_FILE"); file != "" {
+		return file
+	}
+	return "users.json"
+}
+
+// run executes a subcommand against the store
+func run(ctx context.Context, store *repositories.FileLocalUserStore, command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	email := flags.String("email", "", "Email of the account; ADMIN_EMAILS matches it, or the username without one")
+	name := flags.String("name", "", "Display name of the account")
+	generate := flags.Bool("generate", false, "Generate a random password and print it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if command == "list" {
+		return list(ctx, store)
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%s needs a username", command)
+	}
+	username, err := models.NormalizeUsername(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "add":
+		if _, err := store.Get(ctx, username); err == nil {
+			return fmt.Errorf("user %s already exists", username)
+		}
+		hash, err := newPasswordHash(*generate)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		return store.Save(ctx, &models.LocalUser{
+			CreatedAt:    now,
+			UpdatedAt:    now,
+			Username:     username,
+			Email:        *email,
+			Name:         *name,
+			PasswordHash: hash,
+		})
+	case "passwd":
+		user, err := store.Get(ctx, username)
+		if err != nil {
+			return err
+		}
+		if user.PasswordHash, err = newPasswordHash(*generate); err != nil {
+			return err
+		}
+		user.UpdatedAt = time.Now()
+		return store.Save(ctx, user)
+	case "disable", "enable":
+		user, err := store.Get(ctx, username)
+		if err != nil {
+			return err
+		}
+		user.Disabled = command == "disable"
+		user.UpdatedAt = time.Now()
+		return store.Save(ctx, user)
+	case "remove":
+		return store.Delete(ctx, username)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// list prints every account
+func list(ctx context.Context, store *repositories.FileLocalUserStore) error {
+	users, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tEMAIL\tNAME\tSTATUS\tUPDATED")
+	for _, user := range users {
+		status := "active"
+		if user.Disabled {
+			status = "disabled"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", user.Username, user.Email, user.Name, status, user.UpdatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// newPasswordHash hashes a generated password, printing it, or the one on
+// the first line of standard input
+func newPasswordHash(generate bool) (string, error) {
+	var password string
+	if generate {
+		b := make([]byte, 18)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		password = base64.RawURLEncoding.EncodeToString(b)
+		fmt.Println(password)
+	} else {
+		if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprint(os.Stderr, "Password: ")
+		}
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	return auth.HashPassword(password)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/clickstats"
+	"github.com/Okabe-Junya/golink-backend/pkg/useragent"
+)
+
+// WithClickStream reconstructs the click breakdowns of past dates from the
+// click stream in store. Without it, statistics as of a past date only
+// report the clicks.
+func WithClickStream(store interfaces.ClickEventStore) AnalyticsHandlerOption {
+	return func(h *AnalyticsHandler) {
+		h.clickStream = store
+	}
+}
+
+// parseAsOf parses the ?as_of= day statistics are requested for, which must
+// not lie in the future
+func parseAsOf(value string, now time.Time) (time.Time, error) {
+	day, err := time.Parse(models.StatsDateLayout, value)
+	if err != nil {
+		return day, fmt.Errorf("as_of must be a date such as 2025-03-31")
+	}
+	if day.After(now) {
+		return day, fmt.Errorf("as_of must not be in the future")
+	}
+	return day, nil
+}
+
+// linkStatsAsOf returns the statistics of a link as they stood at the end of
+// day: its clicks from the daily and yearly totals, and its breakdowns from
+// the click stream when one is kept
+func (h *AnalyticsHandler) linkStatsAsOf(ctx context.Context, link *models.Link, day time.Time) (map[string]interface{}, error) {
+	linkStats, err := h.repo.GetLinkStats(ctx, link.Short)
+	if err != nil {
+		return nil, err
+	}
+	clicks, exact := linkStats.ClicksAsOf(day)
+
+	stats := map[string]interface{}{
+		"link_id":      link.ID,
+		"short":        link.Short,
+		"url":          link.URL,
+		"click_count":  clicks,
+		"created_at":   link.CreatedAt,
+		"access_level": link.AccessLevel,
+		"as_of":        day.Format(models.StatsDateLayout),
+		"exact":        exact,
+		"is_expired":   !link.ExpiresAt.IsZero() && !link.ExpiresAt.After(day),
+	}
+	end := day.AddDate(0, 0, 1)
+	if !link.ExpiresAt.IsZero() {
+		stats["expires_at"] = link.ExpiresAt
+	}
+	if age := end.Sub(link.CreatedAt).Hours() / 24; age > 0 {
+		stats["age_days"] = age
+		stats["avg_clicks_per_day"] = float64(clicks) / age
+	} else {
+		stats["age_days"] = 0.0
+	}
+
+	if h.clickStream != nil {
+		events, err := h.clickStream.ListByShort(ctx, link.Short, time.Time{})
+		if err != nil {
+			logger.Warn("Failed to get the click stream", logger.Fields{
+				"short": link.Short,
+				"error": err.Error(),
+			})
+			return stats, nil
+		}
+		until := len(events)
+		for i, event := range events {
+			if !event.Time.Before(end) {
+				until = i
+				break
+			}
+		}
+		past := clickstats.Rebuild(link.Short, events[:until], useragent.Default)
+		stats["browsers"] = nonNilCounts(past.Browsers)
+		stats["operating_systems"] = nonNilCounts(past.OperatingSystems)
+		stats["device_types"] = nonNilCounts(past.DeviceTypes)
+		stats["countries"] = nonNilCounts(past.Countries)
+		stats["regions"] = nonNilCounts(past.Regions)
+	}
+	return stats, nil
+}
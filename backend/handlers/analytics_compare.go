@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// maxCompareLinks bounds how many links one comparison covers
+const maxCompareLinks = 10
+
+// maxCompareDays bounds how many days one comparison covers
+const maxCompareDays = 366
+
+// defaultStatsDays is how many days up to today statistics cover when the
+// request gives no range
+const defaultStatsDays = 30
+
+// CompareSeries is the clicks of one link in a comparison
+type CompareSeries struct {
+	Short string `json:"short"`
+	// Clicks holds the clicks of each day of the comparison, in order
+	Clicks []int `json:"clicks"`
+	// Total is the sum of Clicks
+	Total int `json:"total"`
+	// TotalClicks is the link's clicks of all time
+	TotalClicks int `json:"total_clicks"`
+}
+
+// CompareResult is the response of POST /api/analytics/compare. The series
+// of every link share the days in Dates.
+type CompareResult struct {
+	From  string          `json:"from"`
+	To    string          `json:"to"`
+	Dates []string        `json:"dates"`
+	Links []CompareSeries `json:"links"`
+}
+
+// CompareLinks handles POST /api/analytics/compare requests. It takes
+// {"shorts": [...], "from": "YYYY-MM-DD", "to": "YYYY-MM-DD"} and returns the
+// daily clicks of each link over the same days, so the adoption of links can
+// be compared, such as a new wiki's against the one it replaces.
+func (h *AnalyticsHandler) CompareLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		middleware.RespondWithError(w, http.StatusMethodNotAllowed, middleware.ErrBadRequest, "Method not allowed")
+		return
+	}
+
+	var requestBody struct {
+		From   string   `json:"from"`
+		To     string   `json:"to"`
+		Shorts []string `json:"shorts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "Invalid request body")
+		return
+	}
+	shorts := uniqueStrings(requestBody.Shorts)
+	if len(shorts) == 0 || len(shorts) > maxCompareLinks {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest,
+			fmt.Sprintf("Between 1 and %d short codes are required", maxCompareLinks))
+		return
+	}
+	from, to, err := parseStatsRange(requestBody.From, requestBody.To, time.Now().UTC())
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, err.Error())
+		return
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxCompareDays {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest,
+			fmt.Sprintf("At most %d days can be compared", maxCompareDays))
+		return
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := readContext(r)
+
+	result := CompareResult{
+		From:  from.Format(models.StatsDateLayout),
+		To:    to.Format(models.StatsDateLayout),
+		Dates: []string{},
+		Links: make([]CompareSeries, 0, len(shorts)),
+	}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		result.Dates = append(result.Dates, day.Format(models.StatsDateLayout))
+	}
+	links, err := h.repo.GetByShorts(ctx, shorts)
+	if err != nil {
+		respondRepositoryAPIError(w, err, "Failed to get links", logger.Fields{"shorts": shorts})
+		return
+	}
+	for _, short := range shorts {
+		link, found := links[short]
+		if !found {
+			middleware.RespondWithError(w, http.StatusNotFound, middleware.ErrNotFound, fmt.Sprintf("Link '%s' not found", short))
+			return
+		}
+		if !h.checkViewStats(w, ctx, link, userID) {
+			return
+		}
+		stats, err := h.repo.GetLinkStats(ctx, short)
+		if err != nil {
+			respondRepositoryAPIError(w, err, fmt.Sprintf("Link '%s' not found", short), logger.Fields{"short": short})
+			return
+		}
+
+		series := CompareSeries{
+			Short:       link.Short,
+			Clicks:      []int{},
+			TotalClicks: link.ClickCount,
+		}
+		for _, bucket := range stats.ClickSeries(from, to, models.IntervalDay) {
+			series.Clicks = append(series.Clicks, bucket.Clicks)
+			series.Total += bucket.Clicks
+		}
+		result.Links = append(result.Links, series)
+	}
+
+	logger.Info("Links compared", logger.Fields{
+		"userID": userID,
+		"shorts": shorts,
+		"from":   result.From,
+		"to":     result.To,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// parseStatsRange parses the days statistics are requested for. Without a
+// range they cover the defaultStatsDays up to today; without a start, the
+// defaultStatsDays up to the end.
+func parseStatsRange(fromParam, toParam string, now time.Time) (from, to time.Time, err error) {
+	to = now.Truncate(24 * time.Hour)
+	if toParam != "" {
+		if to, err = time.Parse(models.StatsDateLayout, toParam); err != nil {
+			return from, to, fmt.Errorf("to must be a date such as 2025-01-31")
+		}
+	}
+	from = to.AddDate(0, 0, 1-defaultStatsDays)
+	if fromParam != "" {
+		if from, err = time.Parse(models.StatsDateLayout, fromParam); err != nil {
+			return from, to, fmt.Errorf("from must be a date such as 2025-01-01")
+		}
+	}
+	if from.After(to) {
+		return from, to, fmt.Errorf("from must not be after to")
+	}
+	return from, to, nil
+}
+
+// uniqueStrings returns values without empty strings and repeats, in order
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := []string{}
+	for _, value := range values {
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// deprecatedRecentDays is how many days up to today the recent traffic of a
+// deprecated link covers
+const deprecatedRecentDays = 7
+
+// DeprecatedLinkTraffic is the traffic still arriving through a deprecated
+// link
+type DeprecatedLinkTraffic struct {
+	DeprecatedAt  time.Time `json:"deprecated_at"`
+	LastClickedAt time.Time `json:"last_clicked_at,omitzero"`
+	Short         string    `json:"short"`
+	Successor     string    `json:"successor,omitempty"`
+	Mode          string    `json:"mode"`
+	// ClicksSinceDeprecation counts the clicks from the day of deprecation on
+	ClicksSinceDeprecation int `json:"clicks_since_deprecation"`
+	// RecentClicks counts the clicks of the last deprecatedRecentDays days
+	RecentClicks int `json:"recent_clicks"`
+}
+
+// GetDeprecatedLinks handles GET /api/analytics/deprecated requests. It
+// returns the deprecated links of the caller, or of everyone for admins, with
+// the traffic that still arrives through them, busiest first, so owners can
+// tell when a link is safe to archive.
+func (h *AnalyticsHandler) GetDeprecatedLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		middleware.RespondWithError(w, http.StatusMethodNotAllowed, middleware.ErrBadRequest, "Method not allowed")
+		return
+	}
+
+	userID, _ := getUserFromContext(r)
+	admin := isAdminRequest(r)
+	ctx := readContext(r)
+	links, err := h.repo.GetAll(ctx)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, middleware.ErrInternalServerError, "Failed to retrieve links")
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	traffic := []DeprecatedLinkTraffic{}
+	for _, link := range links {
+		if !link.IsDeprecated() || (!admin && link.CreatedBy != userID) {
+			continue
+		}
+		entry := DeprecatedLinkTraffic{
+			DeprecatedAt:  link.Deprecation.DeprecatedAt,
+			LastClickedAt: link.LastClickedAt,
+			Short:         link.Short,
+			Successor:     link.Deprecation.Successor,
+			Mode:          link.Deprecation.Mode,
+		}
+		stats, err := h.repo.GetLinkStats(ctx, link.Short)
+		if err != nil {
+			logger.Warn("Failed to get link statistics for deprecated link", logger.Fields{
+				"short": link.Short,
+				"error": err.Error(),
+			})
+		} else {
+			since := link.Deprecation.DeprecatedAt.UTC().Truncate(24 * time.Hour)
+			recent := today.AddDate(0, 0, 1-deprecatedRecentDays)
+			for _, bucket := range stats.ClickSeries(since, today, models.IntervalDay) {
+				entry.ClicksSinceDeprecation += bucket.Clicks
+			}
+			for _, bucket := range stats.ClickSeries(recent, today, models.IntervalDay) {
+				entry.RecentClicks += bucket.Clicks
+			}
+		}
+		traffic = append(traffic, entry)
+	}
+	sort.SliceStable(traffic, func(i, j int) bool {
+		return traffic[i].RecentClicks > traffic[j].RecentClicks
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(traffic); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
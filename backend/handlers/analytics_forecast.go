@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/forecast"
+)
+
+// forecastHistoryDays is how many past days a forecast is based on
+const forecastHistoryDays = 90
+
+// defaultForecastDays and maxForecastDays bound how many days are projected
+const (
+	defaultForecastDays = 30
+	maxForecastDays     = 90
+)
+
+// ForecastDay is the projected clicks of one day
+type ForecastDay struct {
+	Date   string  `json:"date"`
+	Clicks float64 `json:"clicks"`
+}
+
+// Forecast is the response of GET /api/analytics/links/{short}/forecast
+type Forecast struct {
+	Short string `json:"short"`
+	// Method names the forecaster that made the projection
+	Method string `json:"method"`
+	// HistoryFrom and HistoryTo are the past days the projection is based on
+	HistoryFrom   string        `json:"history_from"`
+	HistoryTo     string        `json:"history_to"`
+	HistoryClicks int           `json:"history_clicks"`
+	Days          []ForecastDay `json:"days"`
+	// Total is the projected clicks of all days
+	Total float64 `json:"total"`
+}
+
+// WithForecaster sets how link usage forecasts are projected
+func WithForecaster(forecaster forecast.Forecaster) AnalyticsHandlerOption {
+	return func(h *AnalyticsHandler) {
+		if forecaster != nil {
+			h.forecaster = forecaster
+		}
+	}
+}
+
+// GetLinkForecast handles GET /api/analytics/links/{short}/forecast
+// requests, projecting a link's daily clicks over the next ?days= days (30
+// by default) from its clicks over the last 90 days, so owners can judge
+// whether to keep or retire it. Today's clicks are still coming in, so the
+// history ends yesterday.
+func (h *AnalyticsHandler) GetLinkForecast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		middleware.RespondWithError(w, http.StatusMethodNotAllowed, middleware.ErrBadRequest, "Method not allowed")
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/analytics/links/"):], "/forecast")
+	days := defaultForecastDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxForecastDays {
+			middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest,
+				fmt.Sprintf("days must be between 1 and %d", maxForecastDays))
+			return
+		}
+		days = parsed
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := readContext(r)
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if !h.checkViewStats(w, ctx, link, userID) {
+		return
+	}
+	stats, err := h.repo.GetLinkStats(ctx, short)
+	if err != nil {
+		respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+
+	// Days before the link existed would drag its projection down
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to := today.AddDate(0, 0, -1)
+	from := to.AddDate(0, 0, 1-forecastHistoryDays)
+	if created := link.CreatedAt.UTC().Truncate(24 * time.Hour); created.After(from) {
+		from = created
+	}
+	history := []int{}
+	if !from.After(to) {
+		for _, bucket := range stats.ClickSeries(from, to, models.IntervalDay) {
+			history = append(history, bucket.Clicks)
+		}
+	}
+
+	result := Forecast{
+		Short:       link.Short,
+		Method:      h.forecaster.Name(),
+		HistoryFrom: from.Format(models.StatsDateLayout),
+		HistoryTo:   to.Format(models.StatsDateLayout),
+		Days:        make([]ForecastDay, 0, days),
+	}
+	for _, clicks := range history {
+		result.HistoryClicks += clicks
+	}
+	for i, clicks := range h.forecaster.Forecast(history, days) {
+		clicks = math.Round(clicks*100) / 100
+		result.Days = append(result.Days, ForecastDay{
+			Date:   today.AddDate(0, 0, i).Format(models.StatsDateLayout),
+			Clicks: clicks,
+		})
+		result.Total += clicks
+	}
+	result.Total = math.Round(result.Total*100) / 100
+
+	logger.Info("Forecast computed for link", logger.Fields{
+		"short":  short,
+		"userID": userID,
+		"method": result.Method,
+		"days":   days,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -2,31 +2,71 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/interfaces"
 	"github.com/Okabe-Junya/golink-backend/logger"
 	"github.com/Okabe-Junya/golink-backend/middleware"
 	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/classification"
+	"github.com/Okabe-Junya/golink-backend/pkg/forecast"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/sandbox"
 )
 
 // AnalyticsHandler provides analytics endpoints for link usage
 type AnalyticsHandler struct {
-	repo interfaces.LinkRepositoryInterface
+	repo     interfaces.LinkRepositoryInterface
+	halfLife time.Duration
+	// classification decides which links top links leave out
+	classification classification.Policy
+	// sandbox links never appear in top links
+	sandbox sandbox.Policy
+	// clickStream is what past click breakdowns are rebuilt from
+	clickStream interfaces.ClickEventStore
+	// forecaster projects the future clicks of links
+	forecaster forecast.Forecaster
+	// lastSummary is the organization summary served until summaryTTL passes
+	lastSummary  *AnalyticsSummary
+	summaryTTL   time.Duration
+	summaryMutex sync.Mutex
+}
+
+// AnalyticsHandlerOption configures optional AnalyticsHandler settings
+type AnalyticsHandlerOption func(*AnalyticsHandler)
+
+// WithTrendingHalfLife sets the half-life of clicks when ranking trending
+// links. It should match the one the popularity scoring job runs with.
+func WithTrendingHalfLife(halfLife time.Duration) AnalyticsHandlerOption {
+	return func(h *AnalyticsHandler) {
+		h.halfLife = halfLife
+	}
 }
 
 // NewAnalyticsHandler creates a new analytics handler
-func NewAnalyticsHandler(repo interfaces.LinkRepositoryInterface) *AnalyticsHandler {
-	return &AnalyticsHandler{
-		repo: repo,
+func NewAnalyticsHandler(repo interfaces.LinkRepositoryInterface, opts ...AnalyticsHandlerOption) *AnalyticsHandler {
+	h := &AnalyticsHandler{
+		repo:           repo,
+		halfLife:       models.DefaultPopularityHalfLife,
+		classification: classification.DefaultPolicy(),
+		sandbox:        sandbox.DefaultPolicy(),
+		summaryTTL:     DefaultSummaryTTL,
+		forecaster:     forecast.Default,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
-// GetLinkStats handles GET /api/analytics/links/{short} requests
+// GetLinkStats handles GET /api/analytics/links/{short} requests. With
+// ?as_of=YYYY-MM-DD the statistics are reported as they stood at the end of
+// that day, for reports on past periods.
 func (h *AnalyticsHandler) GetLinkStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		middleware.RespondWithError(w, http.StatusMethodNotAllowed, middleware.ErrBadRequest, "Method not allowed")
@@ -39,26 +79,49 @@ func (h *AnalyticsHandler) GetLinkStats(w http.ResponseWriter, r *http.Request)
 		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "Short code is required")
 		return
 	}
+	selection, ok := selectFields(w, r, linkStatsFields)
+	if !ok {
+		return
+	}
+	var asOf time.Time
+	if value := r.URL.Query().Get("as_of"); value != "" {
+		day, err := parseAsOf(value, time.Now().UTC())
+		if err != nil {
+			middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, err.Error())
+			return
+		}
+		asOf = day
+	}
 
 	// Get user ID from context
 	userID, _ := getUserFromContext(r)
 
 	// Get the link
-	ctx := context.Background()
+	ctx := readContext(r)
 	link, err := h.repo.GetByShort(ctx, short)
 	if err != nil {
-		middleware.RespondWithError(w, http.StatusNotFound, middleware.ErrNotFound, "Link not found")
+		respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": short})
 		return
 	}
 
 	// Check if user has permission to view stats
-	// Only creator can view stats if link is not public
-	if link.AccessLevel != models.AccessLevels.Public && link.CreatedBy != userID {
-		hasAccess, err := h.repo.CheckAccess(ctx, short, userID)
-		if err != nil || !hasAccess {
-			middleware.RespondWithError(w, http.StatusForbidden, middleware.ErrForbidden, "Access denied")
+	if !h.checkViewStats(w, ctx, link, userID) {
+		return
+	}
+
+	if !asOf.IsZero() {
+		stats, err := h.linkStatsAsOf(ctx, link, asOf)
+		if err != nil {
+			respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": short})
 			return
 		}
+		logger.Info("Past analytics retrieved for link", logger.Fields{
+			"short":  short,
+			"userID": userID,
+			"asOf":   stats["as_of"],
+		})
+		encodeSelected(w, stats, selection)
+		return
 	}
 
 	// Prepare stats response
@@ -95,6 +158,20 @@ func (h *AnalyticsHandler) GetLinkStats(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	// Add the click breakdowns recorded in the link statistics
+	if linkStats, err := h.repo.GetLinkStats(ctx, short); err == nil {
+		stats["browsers"] = nonNilCounts(linkStats.Browsers)
+		stats["operating_systems"] = nonNilCounts(linkStats.OperatingSystems)
+		stats["device_types"] = nonNilCounts(linkStats.DeviceTypes)
+		stats["countries"] = nonNilCounts(linkStats.Countries)
+		stats["regions"] = nonNilCounts(linkStats.Regions)
+	} else {
+		logger.Warn("Failed to get link statistics", logger.Fields{
+			"short": short,
+			"error": err.Error(),
+		})
+	}
+
 	logger.Info("Analytics retrieved for link", logger.Fields{
 		"short":       short,
 		"userID":      userID,
@@ -102,13 +179,43 @@ func (h *AnalyticsHandler) GetLinkStats(w http.ResponseWriter, r *http.Request)
 	})
 
 	// Return the stats
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(stats); err != nil {
-		middleware.RespondWithError(w, http.StatusInternalServerError, middleware.ErrInternalServerError, "Failed to encode response")
+	encodeSelected(w, stats, selection)
+}
+
+// checkViewStats reports whether the user may see a link's statistics,
+// writing the error response if not. Only users with access to a link that
+// is not public may see them.
+func (h *AnalyticsHandler) checkViewStats(w http.ResponseWriter, ctx context.Context, link *models.Link, userID string) bool {
+	if link.AccessLevel == models.AccessLevels.Public || link.CreatedBy == userID {
+		return true
+	}
+	hasAccess, err := h.repo.CheckAccess(ctx, link.Short, userID)
+	if err != nil {
+		respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": link.Short, "userID": userID})
+		return false
 	}
+	if !hasAccess {
+		middleware.RespondWithError(w, http.StatusForbidden, middleware.ErrForbidden,
+			fmt.Sprintf("Access denied to link '%s'", link.Short))
+		return false
+	}
+	return true
 }
 
-// GetTopLinks handles GET /api/analytics/top requests
+// nonNilCounts returns counts, or an empty map when it is nil, so it is
+// encoded as an empty object
+func nonNilCounts(counts map[string]int) map[string]int {
+	if counts == nil {
+		return map[string]int{}
+	}
+	return counts
+}
+
+// GetTopLinks handles GET /api/analytics/top requests. Links are ranked by
+// total clicks, or with ?by=trending by their time-decayed popularity, which
+// favors links in use now over links that were popular long ago. With
+// ?period=today, 7d or 30d they are ranked by their clicks in that period
+// instead, leaving out links not clicked in it.
 func (h *AnalyticsHandler) GetTopLinks(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		middleware.RespondWithError(w, http.StatusMethodNotAllowed, middleware.ErrBadRequest, "Method not allowed")
@@ -127,8 +234,31 @@ func (h *AnalyticsHandler) GetTopLinks(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	by := r.URL.Query().Get("by")
+	if by != "" && by != "clicks" && by != "trending" {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "by must be 'clicks' or 'trending'")
+		return
+	}
+	period := r.URL.Query().Get("period")
+	var from, to time.Time
+	if period != "" {
+		if by == "trending" {
+			middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "period cannot be combined with by=trending")
+			return
+		}
+		var err error
+		if from, to, err = parseTopPeriod(period, time.Now().UTC()); err != nil {
+			middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, err.Error())
+			return
+		}
+	}
+	selection, ok := selectFields(w, r, linkFields)
+	if !ok {
+		return
+	}
+
 	// Get all links
-	ctx := context.Background()
+	ctx := readContext(r)
 	links, err := h.repo.GetAll(ctx)
 	if err != nil {
 		middleware.RespondWithError(w, http.StatusInternalServerError, middleware.ErrInternalServerError, "Failed to retrieve links")
@@ -137,7 +267,10 @@ func (h *AnalyticsHandler) GetTopLinks(w http.ResponseWriter, r *http.Request) {
 
 	// Filter links based on access control
 	var accessibleLinks []*models.Link
-	for _, link := range links {
+	for _, link := range models.FilterArchived(links, false) {
+		if !isDiscoverable(r, h.classification, link, userID) || h.sandbox.Contains(link.Short) {
+			continue
+		}
 		if link.AccessLevel == models.AccessLevels.Public {
 			accessibleLinks = append(accessibleLinks, link)
 			continue
@@ -148,20 +281,21 @@ func (h *AnalyticsHandler) GetTopLinks(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		if link.AccessLevel == models.AccessLevels.Restricted {
-			for _, allowedUser := range link.AllowedUsers {
-				if allowedUser == userID {
-					accessibleLinks = append(accessibleLinks, link)
-					break
-				}
-			}
+		if link.AccessLevel == models.AccessLevels.Restricted && link.CanAccessAs(userID, groups.FromContext(ctx)) {
+			accessibleLinks = append(accessibleLinks, link)
 		}
 	}
 
-	// Sort links by click count (descending)
-	sort.Slice(accessibleLinks, func(i, j int) bool {
-		return accessibleLinks[i].ClickCount > accessibleLinks[j].ClickCount
-	})
+	if period != "" {
+		accessibleLinks = h.rankByPeriod(ctx, accessibleLinks, from, to)
+	} else if by == "trending" {
+		models.SortByPopularity(accessibleLinks, time.Now(), h.halfLife)
+	} else {
+		// Sort links by click count (descending)
+		sort.Slice(accessibleLinks, func(i, j int) bool {
+			return accessibleLinks[i].ClickCount > accessibleLinks[j].ClickCount
+		})
+	}
 
 	// Limit the number of results
 	if len(accessibleLinks) > limit {
@@ -172,11 +306,10 @@ func (h *AnalyticsHandler) GetTopLinks(w http.ResponseWriter, r *http.Request) {
 		"userID": userID,
 		"count":  len(accessibleLinks),
 		"limit":  limit,
+		"by":     by,
+		"period": period,
 	})
 
 	// Return the top links
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(accessibleLinks); err != nil {
-		middleware.RespondWithError(w, http.StatusInternalServerError, middleware.ErrInternalServerError, "Failed to encode response")
-	}
+	encodeSelected(w, viewLinks(r, accessibleLinks), selection)
 }
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// defaultReferrersLimit and maxReferrersLimit bound how many referring sites
+// are listed
+const (
+	defaultReferrersLimit = 10
+	maxReferrersLimit     = 100
+)
+
+// TopReferrers is the response of GET /api/analytics/links/{short}/referrers
+type TopReferrers struct {
+	Short string `json:"short"`
+	// Referrers are the sites the link was followed from, most clicks first
+	Referrers []models.RankedCount `json:"referrers"`
+	// Sites counts every site the link was followed from, listed or not
+	Sites int `json:"sites"`
+}
+
+// GetLinkReferrers handles GET /api/analytics/links/{short}/referrers
+// requests, listing the ?limit= sites (10 by default) a link was followed
+// from most often. Sites come from the Referer header of redirects, reduced
+// to their host.
+func (h *AnalyticsHandler) GetLinkReferrers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		middleware.RespondWithError(w, http.StatusMethodNotAllowed, middleware.ErrBadRequest, "Method not allowed")
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/analytics/links/"):], "/referrers")
+	limit := defaultReferrersLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxReferrersLimit {
+			middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxReferrersLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := readContext(r)
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if !h.checkViewStats(w, ctx, link, userID) {
+		return
+	}
+	stats, err := h.repo.GetLinkStats(ctx, short)
+	if err != nil {
+		respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+
+	result := TopReferrers{
+		Short:     link.Short,
+		Referrers: stats.GetTopReferrers(limit),
+		Sites:     len(stats.ReferringSites),
+	}
+
+	logger.Info("Referrers retrieved for link", logger.Fields{
+		"short":  short,
+		"userID": userID,
+		"limit":  limit,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+)
+
+// summaryWindowDays is how many days up to today the summary's recent
+// activity covers
+const summaryWindowDays = 30
+
+// summaryTopCreators is how many creators the summary ranks
+const summaryTopCreators = 10
+
+// DefaultSummaryTTL is how long a computed summary is served before it is
+// computed again
+const DefaultSummaryTTL = 5 * time.Minute
+
+// CreatorSummary is how much one user has contributed to the organization's links
+type CreatorSummary struct {
+	UserID string `json:"user_id"`
+	Links  int    `json:"links"`
+	Clicks int    `json:"clicks"`
+}
+
+// AnalyticsSummary is the response of GET /api/analytics/summary
+type AnalyticsSummary struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// TopCreators ranks users by the clicks on the links they own
+	TopCreators []CreatorSummary `json:"top_creators"`
+	// ClicksByDay holds the clicks on all links on each of the last 30 days
+	ClicksByDay []models.ClickBucket `json:"clicks_by_day"`
+	Links       int                  `json:"links"`
+	// LinksCreated counts the links created in the last 30 days
+	LinksCreated int `json:"links_created"`
+	Clicks       int `json:"clicks"`
+	// ActiveUsers counts the users owning a link created or changed in the
+	// last 30 days
+	ActiveUsers int `json:"active_users"`
+	// Truncated reports that links were left out to stay within the cap on
+	// the links a request loads
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// WithSummaryTTL sets how long the organization summary is reused before it
+// is computed again
+func WithSummaryTTL(ttl time.Duration) AnalyticsHandlerOption {
+	return func(h *AnalyticsHandler) {
+		h.summaryTTL = ttl
+	}
+}
+
+// GetSummary handles GET /api/analytics/summary requests, reporting the
+// totals of the whole organization to admins. Computing it reads every link
+// and its statistics, so the result is reused for a few minutes.
+func (h *AnalyticsHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		middleware.RespondWithError(w, http.StatusMethodNotAllowed, middleware.ErrBadRequest, "Method not allowed")
+		return
+	}
+	if !auth.RequireAdmin(w, r) {
+		return
+	}
+
+	summary, err := h.summary(readContext(r), time.Now().UTC())
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, middleware.ErrInternalServerError, "Failed to compute the analytics summary")
+		logger.Error("Failed to compute the analytics summary", err, nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// summary returns the organization summary, computing it again when the
+// last one is older than the TTL
+func (h *AnalyticsHandler) summary(ctx context.Context, now time.Time) (*AnalyticsSummary, error) {
+	h.summaryMutex.Lock()
+	defer h.summaryMutex.Unlock()
+	if h.lastSummary != nil && now.Sub(h.lastSummary.GeneratedAt) < h.summaryTTL {
+		return h.lastSummary, nil
+	}
+
+	links, err := h.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summary := summarizeLinks(links, now)
+	summary.Truncated = linkcap.Truncated(ctx)
+
+	// Daily clicks are kept in each link's statistics
+	to := now.Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, 1-summaryWindowDays)
+	summary.ClicksByDay = (&models.LinkStats{}).ClickSeries(from, to, models.IntervalDay)
+	for _, link := range links {
+		stats, err := h.repo.GetLinkStats(ctx, link.Short)
+		if err != nil {
+			logger.Warn("Failed to get link statistics for the summary", logger.Fields{
+				"short": link.Short,
+				"error": err.Error(),
+			})
+			continue
+		}
+		for i, bucket := range stats.ClickSeries(from, to, models.IntervalDay) {
+			summary.ClicksByDay[i].Clicks += bucket.Clicks
+		}
+	}
+
+	h.lastSummary = summary
+	logger.Info("Analytics summary computed", logger.Fields{
+		"links":  summary.Links,
+		"clicks": summary.Clicks,
+	})
+	return summary, nil
+}
+
+// summarizeLinks computes the totals of a summary that the links themselves
+// hold, leaving the daily clicks to the caller
+func summarizeLinks(links []*models.Link, now time.Time) *AnalyticsSummary {
+	summary := &AnalyticsSummary{
+		GeneratedAt: now,
+		TopCreators: []CreatorSummary{},
+		Links:       len(links),
+	}
+	since := now.AddDate(0, 0, -summaryWindowDays)
+	creators := make(map[string]*CreatorSummary)
+	active := make(map[string]bool)
+	for _, link := range links {
+		summary.Clicks += link.ClickCount
+		if link.CreatedAt.After(since) {
+			summary.LinksCreated++
+		}
+		if link.CreatedAt.After(since) || link.UpdatedAt.After(since) {
+			active[link.CreatedBy] = true
+		}
+		creator, ok := creators[link.CreatedBy]
+		if !ok {
+			creator = &CreatorSummary{UserID: link.CreatedBy}
+			creators[link.CreatedBy] = creator
+		}
+		creator.Links++
+		creator.Clicks += link.ClickCount
+	}
+	summary.ActiveUsers = len(active)
+
+	for _, creator := range creators {
+		summary.TopCreators = append(summary.TopCreators, *creator)
+	}
+	sort.Slice(summary.TopCreators, func(i, j int) bool {
+		a, b := summary.TopCreators[i], summary.TopCreators[j]
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		if a.Links != b.Links {
+			return a.Links > b.Links
+		}
+		return a.UserID < b.UserID
+	})
+	if len(summary.TopCreators) > summaryTopCreators {
+		summary.TopCreators = summary.TopCreators[:summaryTopCreators]
+	}
+	return summary
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// maxSeriesBuckets bounds how many intervals one time series has
+const maxSeriesBuckets = 366
+
+// TimeSeries is the response of GET /api/analytics/links/{short}/timeseries
+type TimeSeries struct {
+	Short    string               `json:"short"`
+	From     string               `json:"from"`
+	To       string               `json:"to"`
+	Interval string               `json:"interval"`
+	Buckets  []models.ClickBucket `json:"buckets"`
+	// Total is the clicks of all buckets
+	Total int `json:"total"`
+}
+
+// GetLinkTimeSeries handles GET /api/analytics/links/{short}/timeseries
+// requests. ?from= and ?to= bound the days (YYYY-MM-DD, the last 30 days by
+// default) and ?interval= groups their clicks by day, week or month.
+func (h *AnalyticsHandler) GetLinkTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		middleware.RespondWithError(w, http.StatusMethodNotAllowed, middleware.ErrBadRequest, "Method not allowed")
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/analytics/links/"):], "/timeseries")
+	query := r.URL.Query()
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = models.IntervalDay
+	}
+	if interval != models.IntervalDay && interval != models.IntervalWeek && interval != models.IntervalMonth {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "interval must be 'day', 'week' or 'month'")
+		return
+	}
+	from, to, err := parseStatsRange(query.Get("from"), query.Get("to"), time.Now().UTC())
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, err.Error())
+		return
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := readContext(r)
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if !h.checkViewStats(w, ctx, link, userID) {
+		return
+	}
+	stats, err := h.repo.GetLinkStats(ctx, short)
+	if err != nil {
+		respondRepositoryAPIError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+
+	series := TimeSeries{
+		Short:    link.Short,
+		From:     from.Format(models.StatsDateLayout),
+		To:       to.Format(models.StatsDateLayout),
+		Interval: interval,
+		Buckets:  stats.ClickSeries(from, to, interval),
+	}
+	if len(series.Buckets) > maxSeriesBuckets {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest,
+			fmt.Sprintf("The range spans more than %d %ss", maxSeriesBuckets, interval))
+		return
+	}
+	for _, bucket := range series.Buckets {
+		series.Total += bucket.Clicks
+	}
+
+	logger.Info("Time series retrieved for link", logger.Fields{
+		"short":    short,
+		"userID":   userID,
+		"interval": interval,
+		"buckets":  len(series.Buckets),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(series); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
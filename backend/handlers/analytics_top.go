@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// topPeriodDays holds how many days up to today each ?period= of top links
+// covers
+var topPeriodDays = map[string]int{
+	"today": 1,
+	"7d":    7,
+	"30d":   30,
+}
+
+// parseTopPeriod returns the days a period of top links covers
+func parseTopPeriod(period string, now time.Time) (from, to time.Time, err error) {
+	days, ok := topPeriodDays[period]
+	if !ok {
+		return from, to, fmt.Errorf("period must be 'today', '7d' or '30d'")
+	}
+	to = now.Truncate(24 * time.Hour)
+	return to.AddDate(0, 0, 1-days), to, nil
+}
+
+// rankByPeriod returns the links clicked between from and to, ranked by
+// their clicks on those days. Ties go to the link with more clicks of all
+// time.
+func (h *AnalyticsHandler) rankByPeriod(ctx context.Context, links []*models.Link, from, to time.Time) []*models.Link {
+	clicks := make(map[string]int, len(links))
+	ranked := make([]*models.Link, 0, len(links))
+	for _, link := range links {
+		stats, err := h.repo.GetLinkStats(ctx, link.Short)
+		if err != nil {
+			logger.Warn("Failed to get link statistics for top links", logger.Fields{
+				"short": link.Short,
+				"error": err.Error(),
+			})
+			continue
+		}
+		for _, bucket := range stats.ClickSeries(from, to, models.IntervalDay) {
+			clicks[link.Short] += bucket.Clicks
+		}
+		if clicks[link.Short] > 0 {
+			ranked = append(ranked, link)
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if clicks[a.Short] != clicks[b.Short] {
+			return clicks[a.Short] > clicks[b.Short]
+		}
+		return a.ClickCount > b.ClickCount
+	})
+	return ranked
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/pkg/capture"
+)
+
+// CaptureLog is the response of GET /api/admin/captures/{id}
+type CaptureLog struct {
+	Session   capture.Session    `json:"session"`
+	Exchanges []capture.Exchange `json:"exchanges"`
+}
+
+// HandleCaptures returns the handler of /api/admin/captures. GET lists the
+// debug capture sessions; POST starts one from {"short", "user_id", "ttl"},
+// recording the requests for the short code, of the user, or of the user
+// for the short code until the TTL (such as "30m") passes. Admin access is
+// required.
+func HandleCaptures(recorder *capture.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.RequireAdmin(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeCaptureJSON(w, http.StatusOK, recorder.Sessions())
+		case http.MethodPost:
+			var requestBody struct {
+				capture.Target
+				TTL string `json:"ttl"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "Invalid request body")
+				return
+			}
+			var ttl time.Duration
+			if requestBody.TTL != "" {
+				parsed, err := time.ParseDuration(requestBody.TTL)
+				if err != nil {
+					middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "ttl must be a duration such as 30m")
+					return
+				}
+				ttl = parsed
+			}
+
+			userID, _ := getUserFromContext(r)
+			session, err := recorder.Start(requestBody.Target, ttl, userID)
+			if err != nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, err.Error())
+				return
+			}
+			logger.Info("Debug capture started", logger.Fields{
+				"userID":    userID,
+				"captureID": session.ID,
+				"short":     session.Short,
+				"target":    session.UserID,
+				"expiresAt": session.ExpiresAt,
+			})
+			writeCaptureJSON(w, http.StatusCreated, session)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleCapture returns the handler of /api/admin/captures/{id}. GET returns
+// the session with the requests it recorded, oldest first; DELETE stops it
+// and drops them. Admin access is required.
+func HandleCapture(recorder *capture.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.RequireAdmin(w, r) {
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/captures/")
+
+		switch r.Method {
+		case http.MethodGet:
+			session, exchanges, ok := recorder.Get(id)
+			if !ok {
+				middleware.RespondWithError(w, http.StatusNotFound, middleware.ErrNotFound, "Capture session not found")
+				return
+			}
+			writeCaptureJSON(w, http.StatusOK, CaptureLog{Session: session, Exchanges: exchanges})
+		case http.MethodDelete:
+			if !auth.RequireStepUp(w, r) {
+				return
+			}
+			if !recorder.Stop(id) {
+				middleware.RespondWithError(w, http.StatusNotFound, middleware.ErrNotFound, "Capture session not found")
+				return
+			}
+			userID, _ := getUserFromContext(r)
+			logger.Info("Debug capture stopped", logger.Fields{"userID": userID, "captureID": id})
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// writeCaptureJSON writes value as the JSON response with status
+func writeCaptureJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error("Failed to encode capture response", err, nil)
+	}
+}
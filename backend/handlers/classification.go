@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/classification"
+)
+
+//go:embed templates/interstitial.html
+var interstitialHTML string
+
+// interstitialTemplate is the page shown before redirecting to a classified
+// destination. html/template escapes the destination, so it cannot inject
+// markup or script into the page.
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(interstitialHTML))
+
+// WithClassificationPolicy sets how classified links are shown. Without it
+// the default policy applies: sensitive links show an interstitial and are
+// hidden from search and trending.
+func WithClassificationPolicy(policy classification.Policy) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.classification = policy
+	}
+}
+
+// WithAnalyticsClassificationPolicy sets which classified links trending and
+// top links leave out for users other than their owners and admins
+func WithAnalyticsClassificationPolicy(policy classification.Policy) AnalyticsHandlerOption {
+	return func(h *AnalyticsHandler) {
+		h.classification = policy
+	}
+}
+
+// isDiscoverable reports whether a link may appear in search and trending
+// for the caller. Links hidden by the classification policy only appear for
+// their owner and admins.
+func isDiscoverable(r *http.Request, policy classification.Policy, link *models.Link, userID string) bool {
+	if !policy.IsHidden(link.Classification) {
+		return true
+	}
+	return link.CreatedBy == userID || isAdminRequest(r)
+}
+
+// renderInterstitial writes the page reminding viewers that the destination
+// is confidential, with a link to continue to targetURL
+func renderInterstitial(w http.ResponseWriter, link *models.Link, targetURL string) {
+	var page bytes.Buffer
+	err := interstitialTemplate.Execute(&page, struct {
+		Short          string
+		Title          string
+		Classification string
+		URL            string
+	}{link.Short, link.Title, link.Classification, targetURL})
+	if err != nil {
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		logger.Error("Failed to render classification interstitial", err, logger.Fields{"short": link.Short})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The page names the destination, which shared caches must not keep
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Link-Classification", link.Classification)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(page.Bytes())
+}
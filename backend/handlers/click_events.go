@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/geoip"
+)
+
+// ClickRecorder takes the click event of each redirect. Recording must not
+// block; events are written to the click stream in the background.
+type ClickRecorder interface {
+	Record(event models.ClickEvent)
+}
+
+// countryHeaders carry the country of the client as set by the load
+// balancer or CDN in front of the server
+var countryHeaders = []string{"X-Appengine-Country", "X-Client-Geo-Country", "CF-IPCountry"}
+
+// WithGeoIP resolves the location of each click from the client address.
+// Clicks the resolver has no location for fall back to the country reported
+// by the proxy in front of the server.
+func WithGeoIP(resolver geoip.Resolver) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.geoip = resolver
+	}
+}
+
+// WithClickEvents records an event for every redirect, with the time, client
+// address, user agent, referrer and country, in addition to counting it
+func WithClickEvents(recorder ClickRecorder) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.clickEvents = recorder
+	}
+}
+
+// WithLinkClickStream names the store the click events end up in, so the
+// click stream of a renamed link follows it to its new short code
+func WithLinkClickStream(store interfaces.ClickEventStore) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.clickStream = store
+	}
+}
+
+// recordClickEvent hands the click event of a redirect served for
+// servedRegion to the recorder. The user is left out for anonymous requests
+// and those that opt out of tracking.
+func (h *LinkHandler) recordClickEvent(r *http.Request, userID, short, servedRegion string) {
+	if h.clickEvents == nil {
+		return
+	}
+	event := models.ClickEvent{
+		Time:      time.Now(),
+		Short:     short,
+		IPAddress: auth.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Referrer:  r.Referer(),
+		// The region is coarse enough to keep through anonymization
+		ServedRegion: servedRegion,
+	}
+	h.locateClick(r, &event)
+	if userID != anonymousUserID && r.Header.Get("DNT") != "1" && r.Header.Get("Sec-GPC") != "1" {
+		event.UserID = userID
+	}
+	h.clickEvents.Record(event)
+}
+
+// locateClick sets the location of a click event, preferring the GeoIP
+// database over the proxy's country header
+func (h *LinkHandler) locateClick(r *http.Request, event *models.ClickEvent) {
+	if h.geoip != nil {
+		if loc, ok := h.geoip.Lookup(net.ParseIP(event.IPAddress)); ok {
+			event.Country = loc.Country
+			event.Region = loc.Region
+			event.City = loc.City
+			event.Latitude = loc.Latitude
+			event.Longitude = loc.Longitude
+			return
+		}
+	}
+	event.Country = requestCountry(r)
+}
+
+// requestCountry returns the ISO country code of the client, if a proxy in
+// front of the server reported it
+func requestCountry(r *http.Request) string {
+	for _, header := range countryHeaders {
+		country := strings.ToUpper(strings.TrimSpace(r.Header.Get(header)))
+		// "ZZ" and "XX" stand for an unknown country
+		if len(country) == 2 && country != "ZZ" && country != "XX" {
+			return country
+		}
+	}
+	return ""
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+)
+
+const (
+	// maxDocBytes bounds the documents accepted for validation
+	maxDocBytes = 1 << 20 // 1 MiB
+	// maxSuggestions bounds the replacement short codes offered per reference
+	maxSuggestions = 3
+	// maxSuggestionDistance is the largest edit distance for a suggested short code
+	maxSuggestionDistance = 2
+)
+
+// defaultLinkHosts are the host names that always denote a go-link, as in "go/docs"
+var defaultLinkHosts = []string{"go"}
+
+// WithLinkHosts adds host names, such as the server's public domain, whose
+// URLs are recognized as go-links in validated documents
+func WithLinkHosts(hosts ...string) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		for _, host := range hosts {
+			if host = strings.TrimSpace(host); host != "" {
+				h.linkHosts = append(h.linkHosts, host)
+			}
+		}
+	}
+}
+
+// docLinkPattern matches go-link references such as "go/docs",
+// "http://go/docs", "https://<host>/docs" or "go/team/docs". The first group is the text
+// before the reference, which must not continue a word, path or domain.
+func docLinkPattern(hosts []string) *regexp.Regexp {
+	quoted := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		quoted = append(quoted, regexp.QuoteMeta(host))
+	}
+	return regexp.MustCompile(`(?i)(^|[^\w./:-])((?:https?://)?(?:` + strings.Join(quoted, "|") + `)/([a-z0-9-]+(?:/[a-z0-9-]+){0,2}))`)
+}
+
+// DocReference is a go-link found in a validated document
+type DocReference struct {
+	Text        string   `json:"text"`
+	Short       string   `json:"short"`
+	Status      string   `json:"status"`
+	URL         string   `json:"url,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Line        int      `json:"line"`
+	Column      int      `json:"column"`
+}
+
+// DocValidation is the result of validating a document's go-links
+type DocValidation struct {
+	References []DocReference `json:"references"`
+	Summary    map[string]int `json:"summary"`
+	Valid      bool           `json:"valid"`
+}
+
+// ValidateDoc handles POST /api/tools/validate-doc requests. The body is a
+// text or markdown document; every go-link it references is resolved with the
+// caller's access, and references that cannot be followed come with suggested
+// replacements. The response is 200 even for invalid documents so CI jobs can
+// report every problem; they should fail when "valid" is false.
+func (h *LinkHandler) ValidateDoc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		logger.Warn("Method not allowed for validate doc", logger.Fields{"method": r.Method})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDocBytes))
+	if err != nil {
+		http.Error(w, "Document too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := groups.Inherit(context.Background(), r.Context())
+
+	result := DocValidation{
+		References: []DocReference{},
+		Summary:    map[string]int{},
+		Valid:      true,
+	}
+	resolved := map[string]ResolvedLink{}
+	var candidates []string
+
+	for i, line := range strings.Split(string(body), "\n") {
+		for _, m := range h.docPattern.FindAllStringSubmatchIndex(line, -1) {
+			ref := DocReference{
+				Text:   line[m[4]:m[5]],
+				Short:  strings.TrimRight(line[m[6]:m[7]], "-"),
+				Line:   i + 1,
+				Column: m[4] + 1,
+			}
+
+			link, ok := resolved[ref.Short]
+			if !ok {
+				link = h.resolveLink(ctx, ref.Short, userID)
+				resolved[ref.Short] = link
+			}
+			ref.Status = link.Status
+			ref.URL = link.URL
+
+			if link.Status != ResolveStatusOK {
+				result.Valid = false
+				if candidates == nil {
+					candidates = h.suggestionCandidates(ctx, userID)
+				}
+				ref.Suggestions = suggestShortCodes(ref.Short, candidates)
+			}
+
+			result.Summary[ref.Status]++
+			result.References = append(result.References, ref)
+		}
+	}
+
+	logger.Info("Validated document go-links", logger.Fields{
+		"userID":     userID,
+		"references": len(result.References),
+		"valid":      result.Valid,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// suggestionCandidates lists the short codes the user could link to instead,
+// most popular first. It never returns nil so the caller loads the candidates
+// at most once.
+func (h *LinkHandler) suggestionCandidates(ctx context.Context, userID string) []string {
+	candidates := []string{}
+	links, err := h.repo.GetAll(ctx)
+	if err != nil {
+		logger.Error("Failed to load links for suggestions", err, nil)
+		return candidates
+	}
+	models.SortByPopularity(links, time.Now(), h.halfLife)
+	for _, link := range links {
+		if link.CanAccessAs(userID, groups.FromContext(ctx)) && !link.IsLinkExpired() && !link.IsArchived() {
+			candidates = append(candidates, link.Short)
+		}
+	}
+	return candidates
+}
+
+// suggestShortCodes returns the candidates closest to short, ignoring case,
+// nearest first; equally near candidates keep their order. The short code
+// itself is never suggested.
+func suggestShortCodes(short string, candidates []string) []string {
+	type scored struct {
+		short    string
+		distance int
+	}
+	var matches []scored
+	target := strings.ToLower(short)
+	for _, candidate := range candidates {
+		if candidate == short {
+			continue
+		}
+		if d := editDistance(target, strings.ToLower(candidate)); d <= maxSuggestionDistance {
+			matches = append(matches, scored{short: candidate, distance: d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, matches[i].short)
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
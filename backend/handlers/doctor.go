@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/doctor"
+)
+
+// Diagnoser checks the server's configuration against its environment
+type Diagnoser interface {
+	Run(ctx context.Context) doctor.Report
+}
+
+// HandleDoctor returns the handler of GET /api/admin/doctor, which runs the
+// same configuration checks as `server doctor` and returns every result with
+// its remediation. The response is 200 even when checks fail; "ok" tells
+// whether any did. Admin access is required.
+func HandleDoctor(d Diagnoser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !auth.RequireAdmin(w, r) {
+			return
+		}
+
+		report := d.Run(r.Context())
+		if !report.OK {
+			user, _ := getUserFromContext(r)
+			logger.Warn("Configuration checks failed", logger.Fields{"userID": user})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
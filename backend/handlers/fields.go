@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/fields"
+)
+
+// Fields that ?fields= can select on each kind of response
+var (
+	linkFields         = fields.Names(models.Link{})
+	searchResultFields = fields.Names(SearchResult{})
+	linkStatsFields    = []string{
+		"access_level", "age_days", "as_of", "avg_clicks_per_day", "browsers", "click_count", "countries",
+		"created_at", "device_types", "exact", "expires_at", "is_expired", "link_id", "operating_systems",
+		"regions", "short", "url",
+	}
+)
+
+// selectFields parses the ?fields= parameter against the fields the response
+// has. An invalid selection is answered with 400 and ok is false.
+func selectFields(w http.ResponseWriter, r *http.Request, available []string) (selection fields.Selection, ok bool) {
+	selection, err := fields.Parse(r.URL.Query().Get("fields"), available)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_FIELDS", err.Error())
+		return nil, false
+	}
+	return selection, true
+}
+
+// encodeSelected writes v as JSON with only the selected fields of its objects
+func encodeSelected(w http.ResponseWriter, v interface{}, selection fields.Selection) {
+	projected, err := selection.Apply(v)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(projected); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
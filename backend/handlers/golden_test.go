@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories/mocks"
+	"github.com/Okabe-Junya/golink-backend/tests/fixtures"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResponseGolden pins the JSON shape of API responses. Run
+// `go test ./handlers -update` after an intended response change.
+func TestResponseGolden(t *testing.T) {
+	trustTestProxy(t)
+
+	ctx := context.Background()
+	mockRepo := mocks.NewMockLinkRepository()
+	require.NoError(t, mockRepo.Create(ctx, fixtures.Link("docs").Clicks(12).Build()))
+	require.NoError(t, mockRepo.Create(ctx, fixtures.Link("team").Restricted("user2").Clicks(3).Title("Team", "Team landing page").Tags("eng", "onboarding").Build()))
+	require.NoError(t, mockRepo.Create(ctx, fixtures.Link("mine").CreatedBy("user2").Private().Build()))
+	require.NoError(t, mockRepo.UpdateLinkStats(ctx, "docs", func(stats *models.LinkStats) {
+		stats.RecordClickAt(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), "Firefox", "Linux", "JP", "github.com", "desktop")
+		stats.RecordClickAt(time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC), "Safari", "iOS", "", "", "mobile")
+	}))
+
+	linkHandler := NewLinkHandler(mockRepo)
+	analyticsHandler := NewAnalyticsHandler(mockRepo)
+
+	tests := []struct {
+		handler    http.HandlerFunc
+		body       interface{}
+		name       string
+		method     string
+		path       string
+		userID     string
+		redactKeys []string
+		status     int
+	}{
+		{
+			name:    "create_link",
+			handler: linkHandler.CreateLink,
+			method:  http.MethodPost,
+			path:    "/api/links",
+			userID:  "user3",
+			body: map[string]interface{}{
+				"short":         "new",
+				"url":           "https://example.com/new",
+				"access_level":  "Restricted",
+				"allowed_users": []string{"user2"},
+				"title":         "New page",
+				"tags":          []string{"Eng"},
+			},
+			redactKeys: []string{"id"},
+			status:     http.StatusCreated,
+		},
+		{
+			name:    "get_link",
+			handler: linkHandler.GetLink,
+			method:  http.MethodGet,
+			path:    "/api/links/team",
+			status:  http.StatusOK,
+		},
+		{
+			name:    "get_links_by_creator",
+			handler: linkHandler.GetLinks,
+			method:  http.MethodGet,
+			path:    "/api/links?created_by=user2",
+			status:  http.StatusOK,
+		},
+		{
+			name:    "get_links_by_tag",
+			handler: linkHandler.GetLinks,
+			method:  http.MethodGet,
+			path:    "/api/links?tag=onboarding",
+			status:  http.StatusOK,
+		},
+		{
+			name:       "link_stats",
+			handler:    analyticsHandler.GetLinkStats,
+			method:     http.MethodGet,
+			path:       "/api/analytics/links/docs",
+			redactKeys: []string{"age_days", "avg_clicks_per_day"},
+			status:     http.StatusOK,
+		},
+		{
+			name:    "link_stats_not_found",
+			handler: analyticsHandler.GetLinkStats,
+			method:  http.MethodGet,
+			path:    "/api/analytics/links/missing",
+			status:  http.StatusNotFound,
+		},
+		{
+			name:    "top_links",
+			handler: analyticsHandler.GetTopLinks,
+			method:  http.MethodGet,
+			path:    "/api/analytics/top?limit=2",
+			status:  http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tc.body != nil {
+				require.NoError(t, json.NewEncoder(&body).Encode(tc.body))
+			}
+			req := httptest.NewRequest(tc.method, tc.path, &body)
+			userID := tc.userID
+			if userID == "" {
+				userID = "user2"
+			}
+			signInAs(req, userID)
+			rr := httptest.NewRecorder()
+
+			tc.handler(rr, req)
+
+			require.Equal(t, tc.status, rr.Code, rr.Body.String())
+			fixtures.AssertGoldenJSON(t, tc.name, rr.Body.Bytes(), tc.redactKeys...)
+		})
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/logger"
-	"github.com/Okabe-Junya/golink-backend/models"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -32,18 +31,19 @@ var (
 	)
 )
 
+// Pinger checks that the link store answers, without reading every link
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
 // HealthHandler handles health check requests
 type HealthHandler struct {
 	startTime time.Time
-	repo      interface {
-		GetAll(ctx context.Context) ([]*models.Link, error)
-	}
+	repo      Pinger
 }
 
 // NewHealthHandler creates a new HealthHandler
-func NewHealthHandler(repo interface {
-	GetAll(ctx context.Context) ([]*models.Link, error)
-}) *HealthHandler {
+func NewHealthHandler(repo Pinger) *HealthHandler {
 	return &HealthHandler{
 		startTime: time.Now(),
 		repo:      repo,
@@ -94,7 +94,7 @@ func (h *HealthHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		"status": "connected",
 	}
 
-	_, err := h.repo.GetAll(ctx)
+	err := h.repo.Ping(ctx)
 	if err != nil {
 		dbStatus["status"] = "disconnected"
 		dbStatus["error"] = err.Error()
@@ -152,7 +152,28 @@ func (h *HealthHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// SimpleHealthCheck handles GET /health/simple requests for a simple health check
+// Liveness handles GET /livez requests. It reports that the process
+// serves requests without checking the link store, so a store outage
+// makes the server unready rather than restarting it.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := map[string]string{
+		"status":    "alive",
+		"timestamp": time.Now().Format(time.RFC3339),
+		"uptime":    time.Since(h.startTime).String(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "failed to encode liveness response", http.StatusInternalServerError)
+	}
+}
+
+// SimpleHealthCheck handles GET /health requests for a simple readiness
+// check, pinging the link store
 func (h *HealthHandler) SimpleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -163,7 +184,7 @@ func (h *HealthHandler) SimpleHealthCheck(w http.ResponseWriter, r *http.Request
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	_, err := h.repo.GetAll(ctx)
+	err := h.repo.Ping(ctx)
 
 	response := map[string]string{
 		"status":    "healthy",
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubPinger answers pings with a fixed error
+type stubPinger struct {
+	err error
+}
+
+func (p stubPinger) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func TestHealthHandlerPingsStore(t *testing.T) {
+	tests := []struct {
+		err        error
+		name       string
+		wantStatus string
+		wantCode   int
+	}{
+		{name: "store answers", wantCode: http.StatusOK, wantStatus: "healthy"},
+		{name: "store down", err: errors.New("unavailable"), wantCode: http.StatusServiceUnavailable, wantStatus: "unhealthy"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewHealthHandler(stubPinger{err: tc.err})
+			for path, serve := range map[string]http.HandlerFunc{
+				"/health":          handler.SimpleHealthCheck,
+				"/health/detailed": handler.HealthCheck,
+			} {
+				rr := httptest.NewRecorder()
+				serve(rr, httptest.NewRequest(http.MethodGet, path, nil))
+				assert.Equal(t, tc.wantCode, rr.Code, path)
+
+				var body struct {
+					Status string `json:"status"`
+				}
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body), path)
+				assert.Equal(t, tc.wantStatus, body.Status, path)
+			}
+		})
+	}
+}
+
+func TestLivenessIgnoresStore(t *testing.T) {
+	handler := NewHealthHandler(stubPinger{err: errors.New("unavailable")})
+
+	rr := httptest.NewRecorder()
+	handler.Liveness(rr, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, "alive", body["status"])
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+)
+
+// maxAliasesPerLink bounds how many aliases one link may have
+const maxAliasesPerLink = 10
+
+// WithAliasStore lets links be reached through additional short codes.
+// Without a store the alias endpoints are unavailable.
+func WithAliasStore(store interfaces.LinkAliasStore) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.aliases = store
+	}
+}
+
+// lookupLink retrieves the link a short code resolves to, following an alias
+// when no link has that short code
+func (h *LinkHandler) lookupLink(ctx context.Context, short string) (*models.Link, error) {
+	link, err := h.repo.GetByShort(ctx, short)
+	if err == nil || h.aliases == nil || !errors.Is(err, errors.ErrNotFound) {
+		return link, err
+	}
+
+	alias, aliasErr := h.aliases.Get(ctx, short)
+	if aliasErr != nil {
+		return nil, err
+	}
+	return h.repo.GetByShort(ctx, alias.Short)
+}
+
+// aliasExists reports whether short is taken by an alias
+func (h *LinkHandler) aliasExists(ctx context.Context, short string) bool {
+	if h.aliases == nil {
+		return false
+	}
+	_, err := h.aliases.Get(ctx, short)
+	return err == nil
+}
+
+// HandleLinkAliases handles /api/links/{short}/aliases and
+// /api/links/{short}/aliases/{alias} requests
+func (h *LinkHandler) HandleLinkAliases(w http.ResponseWriter, r *http.Request) {
+	if h.aliases == nil {
+		http.Error(w, "Link aliases are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	short, alias, _ := strings.Cut(r.URL.Path[len("/api/links/"):], "/aliases")
+	alias = strings.TrimPrefix(alias, "/")
+
+	switch {
+	case alias == "" && r.Method == http.MethodGet:
+		h.listAliases(w, r, short)
+	case alias == "" && r.Method == http.MethodPost:
+		h.createAlias(w, r, short)
+	case alias != "" && r.Method == http.MethodDelete:
+		h.deleteAlias(w, r, short, alias)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		logger.Warn("Method not allowed for link aliases", logger.Fields{"method": r.Method})
+	}
+}
+
+// listAliases lists the aliases of a link to anyone who can follow it
+func (h *LinkHandler) listAliases(w http.ResponseWriter, r *http.Request, short string) {
+	userID, _ := getUserFromContext(r)
+
+	ctx := readContext(r)
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if !link.CanAccessAs(userID, groups.FromContext(ctx)) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	aliases, err := h.aliases.ListByShort(ctx, short)
+	if err != nil {
+		http.Error(w, "Failed to get link aliases", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve link aliases", err, logger.Fields{"short": short})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(aliases); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// createAlias handles POST /api/links/{short}/aliases requests with a body
+// such as {"alias": "foobar"}. Only the link's creator may add aliases.
+func (h *LinkHandler) createAlias(w http.ResponseWriter, r *http.Request, short string) {
+	var requestBody struct {
+		Alias string `json:"alias"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		logger.Error("Failed to decode alias request body", err, nil)
+		return
+	}
+
+	code := strings.TrimSpace(requestBody.Alias)
+	if !shortCodePattern.MatchString(code) {
+		http.Error(w, "Alias must contain only letters, numbers, and hyphens, in at most three slash-separated segments", http.StatusBadRequest)
+		return
+	}
+	if h.isReservedShortCode(code) {
+		middleware.RespondWithError(w, http.StatusBadRequest, "SHORT_CODE_RESERVED",
+			fmt.Sprintf("Short code '%s' is reserved", code))
+		return
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := context.Background()
+
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the creator or an admin can manage aliases", http.StatusForbidden)
+		logger.Warn("Unauthorized alias creation attempt", logger.Fields{
+			"short":     short,
+			"userID":    userID,
+			"createdBy": link.CreatedBy,
+		})
+		return
+	}
+
+	if h.rejectNamespace(ctx, w, code, userID) {
+		return
+	}
+
+	// An alias must not shadow a link, including one waiting in the trash
+	for _, get := range []func(context.Context, string) (*models.Link, error){h.repo.GetByShort, h.repo.GetDeletedByShort} {
+		_, err := get(ctx, code)
+		if err == nil {
+			http.Error(w, "Short code already exists", http.StatusConflict)
+			return
+		}
+		if !errors.Is(err, errors.ErrNotFound) {
+			respondRepositoryError(w, err, "Link not found", logger.Fields{"short": code})
+			return
+		}
+	}
+
+	existing, err := h.aliases.ListByShort(ctx, short)
+	if err != nil {
+		http.Error(w, "Failed to get link aliases", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve link aliases", err, logger.Fields{"short": short})
+		return
+	}
+	if len(existing) >= maxAliasesPerLink {
+		middleware.RespondWithError(w, http.StatusBadRequest, "TOO_MANY_ALIASES",
+			fmt.Sprintf("A link may have at most %d aliases", maxAliasesPerLink))
+		return
+	}
+
+	alias := &models.LinkAlias{
+		CreatedAt: time.Now(),
+		Alias:     code,
+		Short:     short,
+		CreatedBy: userID,
+	}
+	if err := h.aliases.Create(ctx, alias); err != nil {
+		if errors.Is(err, errors.ErrAlreadyExists) {
+			http.Error(w, "Short code already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create alias", http.StatusInternalServerError)
+		logger.Error("Failed to create link alias", err, logger.Fields{"short": short, "alias": code})
+		return
+	}
+
+	logger.Info("Link alias created", logger.Fields{
+		"short":  short,
+		"alias":  code,
+		"userID": userID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(alias); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// deleteAlias handles DELETE /api/links/{short}/aliases/{alias} requests.
+// Only the link's creator may remove aliases.
+func (h *LinkHandler) deleteAlias(w http.ResponseWriter, r *http.Request, short, code string) {
+	userID, _ := getUserFromContext(r)
+	ctx := context.Background()
+
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the creator or an admin can manage aliases", http.StatusForbidden)
+		logger.Warn("Unauthorized alias deletion attempt", logger.Fields{
+			"short":     short,
+			"userID":    userID,
+			"createdBy": link.CreatedBy,
+		})
+		return
+	}
+
+	alias, err := h.aliases.Get(ctx, code)
+	if err != nil || alias.Short != short {
+		http.Error(w, "Alias not found", http.StatusNotFound)
+		return
+	}
+	if err := h.aliases.Delete(ctx, code); err != nil {
+		http.Error(w, "Failed to delete alias", http.StatusInternalServerError)
+		logger.Error("Failed to delete link alias", err, logger.Fields{"short": short, "alias": code})
+		return
+	}
+
+	logger.Info("Link alias deleted", logger.Fields{
+		"short":  short,
+		"alias":  code,
+		"userID": userID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// HandleLinkArchive handles /api/links/{short}/archive requests: POST
+// archives the link and DELETE unarchives it. An archived link is hidden from
+// listings and its redirects answer 410, but unlike an expired or deleted link
+// it keeps its history and stats and can be brought back at any time. Only
+// the owner or an admin may archive a link.
+func (h *LinkHandler) HandleLinkArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/archive")
+	userID, _ := getUserFromContext(r)
+	ctx := context.Background()
+
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the owner or an admin can archive this link", http.StatusForbidden)
+		logger.Warn("Unauthorized link archive", logger.Fields{
+			"short":       link.Short,
+			"requestUser": userID,
+			"ownerUser":   link.CreatedBy,
+		})
+		return
+	}
+
+	archive := r.Method == http.MethodPost
+	if link.IsArchived() == archive {
+		if archive {
+			middleware.RespondWithError(w, http.StatusConflict, "ALREADY_ARCHIVED", "The link is already archived")
+		} else {
+			middleware.RespondWithError(w, http.StatusConflict, "NOT_ARCHIVED", "The link is not archived")
+		}
+		return
+	}
+
+	if archive {
+		link.Archive(userID, time.Now())
+	} else {
+		link.Unarchive(time.Now())
+	}
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to update link", http.StatusInternalServerError)
+		logger.Error("Failed to store link archive state", err, logger.Fields{"short": link.Short})
+		return
+	}
+
+	logger.Info("Link archive state changed", logger.Fields{
+		"short":    link.Short,
+		"archived": archive,
+		"userID":   userID,
+	})
+	h.publishEvent(models.WebhookEvents.LinkUpdated, link, userID)
+	respondLink(w, r, http.StatusOK, link)
+}
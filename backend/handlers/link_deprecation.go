@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+//go:embed templates/deprecation.html
+var deprecationHTML string
+
+// deprecationTemplate is the notice shown before following a deprecated link
+// in notice mode
+var deprecationTemplate = template.Must(template.New("deprecation").Parse(deprecationHTML))
+
+// deprecationNoticeSeconds is how long the notice is shown before the
+// browser moves on by itself
+const deprecationNoticeSeconds = 5
+
+// deprecatedRedirects counts the redirects through deprecated links by mode
+var deprecatedRedirects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "golink_deprecated_link_redirects_total",
+	Help: "Total number of redirects through deprecated links, by deprecation mode",
+}, []string{"mode"})
+
+// HandleLinkDeprecation handles /api/links/{short}/deprecation requests: PUT
+// deprecates the link with {"successor", "mode", "message"} and DELETE makes
+// it a regular link again. Redirects through a deprecated link send visitors
+// on to its successor, showing a brief notice first in "notice" mode or
+// redirecting at once with Deprecation and Link headers in "redirect" mode.
+// Only the owner or an admin may deprecate a link.
+func (h *LinkHandler) HandleLinkDeprecation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/deprecation")
+	userID, _ := getUserFromContext(r)
+	ctx := context.Background()
+
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the owner or an admin can deprecate this link", http.StatusForbidden)
+		logger.Warn("Unauthorized link deprecation", logger.Fields{
+			"short":       link.Short,
+			"requestUser": userID,
+			"ownerUser":   link.CreatedBy,
+		})
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if !link.IsDeprecated() {
+			middleware.RespondWithError(w, http.StatusConflict, "NOT_DEPRECATED", "The link is not deprecated")
+			return
+		}
+		link.Undeprecate(time.Now())
+	} else {
+		var requestBody models.LinkDeprecation
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !h.validDeprecation(w, ctx, link, &requestBody) {
+			return
+		}
+		link.Deprecate(requestBody, userID, time.Now())
+	}
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to update link", http.StatusInternalServerError)
+		logger.Error("Failed to store link deprecation", err, logger.Fields{"short": link.Short})
+		return
+	}
+
+	fields := logger.Fields{"short": link.Short, "deprecated": link.IsDeprecated(), "userID": userID}
+	if link.IsDeprecated() {
+		fields["successor"] = link.Deprecation.Successor
+		fields["mode"] = link.Deprecation.Mode
+	}
+	logger.Info("Link deprecation changed", fields)
+	if link.IsDeprecated() {
+		h.publishEvent(models.WebhookEvents.LinkDeprecated, link, userID)
+	} else {
+		h.publishEvent(models.WebhookEvents.LinkUpdated, link, userID)
+	}
+	respondLink(w, r, http.StatusOK, link)
+}
+
+// validDeprecation checks a requested deprecation of link, answering 400 if
+// it is invalid. The successor must be another link that is not deprecated
+// itself, so deprecated links never send visitors around in a circle.
+func (h *LinkHandler) validDeprecation(w http.ResponseWriter, ctx context.Context, link *models.Link, deprecation *models.LinkDeprecation) bool {
+	deprecation.Successor = strings.Trim(strings.TrimSpace(deprecation.Successor), "/")
+	deprecation.Message = strings.TrimSpace(deprecation.Message)
+	if deprecation.Mode != "" && !models.IsDeprecationMode(deprecation.Mode) {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_DEPRECATION",
+			fmt.Sprintf("mode must be '%s' or '%s'", models.DeprecationModes.Notice, models.DeprecationModes.Redirect))
+		return false
+	}
+	if len(deprecation.Message) > models.MaxDeprecationMessageLength {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_DEPRECATION",
+			fmt.Sprintf("message must be at most %d characters", models.MaxDeprecationMessageLength))
+		return false
+	}
+	if deprecation.Successor == "" {
+		return true
+	}
+	if strings.EqualFold(deprecation.Successor, link.Short) {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_DEPRECATION", "A link cannot succeed itself")
+		return false
+	}
+
+	successor, err := h.repo.GetByShort(ctx, deprecation.Successor)
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_DEPRECATION",
+				fmt.Sprintf("Successor '%s' not found", deprecation.Successor))
+			return false
+		}
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": deprecation.Successor})
+		return false
+	}
+	if successor.IsDeprecated() {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_DEPRECATION",
+			fmt.Sprintf("Successor '%s' is deprecated itself; point to its successor instead", successor.Short))
+		return false
+	}
+	deprecation.Successor = successor.Short
+	return true
+}
+
+// successorURL returns where a deprecated link sends visitors: its
+// successor's redirect, passing on the path segments and query of the
+// request, or targetURL when it has no successor
+func successorURL(link *models.Link, segments []string, rawQuery, targetURL string) string {
+	if link.Deprecation.Successor == "" {
+		return targetURL
+	}
+	successor := (&url.URL{Path: "/" + link.Deprecation.Successor}).JoinPath(segments...)
+	successor.RawQuery = rawQuery
+	return successor.String()
+}
+
+// setDeprecationHeaders marks a redirect through a deprecated short code with
+// the Deprecation header of RFC 9745 and, with a successor, a Link to it
+func setDeprecationHeaders(w http.ResponseWriter, deprecation *models.LinkDeprecation) {
+	w.Header().Set("Deprecation", "@"+strconv.FormatInt(deprecation.DeprecatedAt.Unix(), 10))
+	if deprecation.Successor != "" {
+		w.Header().Set("Link", fmt.Sprintf(`</%s>; rel="successor-version"`, deprecation.Successor))
+	}
+}
+
+// renderDeprecationNotice writes the page telling visitors the short code is
+// deprecated, moving on to targetURL after a few seconds
+func renderDeprecationNotice(w http.ResponseWriter, short string, deprecation *models.LinkDeprecation, targetURL string) {
+	var page bytes.Buffer
+	err := deprecationTemplate.Execute(&page, struct {
+		Short     string
+		Successor string
+		Message   string
+		URL       string
+		Seconds   int
+	}{short, deprecation.Successor, deprecation.Message, targetURL, deprecationNoticeSeconds})
+	if err != nil {
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		logger.Error("Failed to render deprecation notice", err, logger.Fields{"short": short})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(page.Bytes())
+}
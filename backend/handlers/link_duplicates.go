@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+)
+
+// WithDuplicateURLRejection refuses to create a link whose destination
+// another link the creator can see already points at, answering 409 with the
+// existing short codes. Without it such links are created and the existing
+// short codes are reported alongside the new link.
+func WithDuplicateURLRejection(reject bool) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.rejectDuplicates = reject
+	}
+}
+
+// duplicateShorts returns the short codes of the links userID can see that
+// already point at url, in order. Failing to look them up does not prevent
+// creating a link, so errors only yield no duplicates.
+func (h *LinkHandler) duplicateShorts(ctx context.Context, url, userID string) []string {
+	links, err := h.repo.GetByURL(ctx, url)
+	if err != nil {
+		logger.Error("Failed to look up links with the same destination", err, logger.Fields{"url": url})
+		return nil
+	}
+	var shorts []string
+	for _, link := range links {
+		// Private links of other users must not be revealed
+		if link.CanAccessAs(userID, groups.FromContext(ctx)) {
+			shorts = append(shorts, link.Short)
+		}
+	}
+	sort.Strings(shorts)
+	return shorts
+}
+
+// respondDuplicateURL writes the 409 response for a destination that
+// existing links already point at
+func respondDuplicateURL(w http.ResponseWriter, shorts []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": middleware.APIError{
+			Code:    "DUPLICATE_DESTINATION",
+			Message: fmt.Sprintf("Links already point at this URL: %s", strings.Join(shorts, ", ")),
+		},
+		"duplicates": shorts,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
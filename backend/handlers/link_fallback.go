@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// FallbackHeader is set on redirects sent to a link's fallback URL because
+// its URL was found dead
+const FallbackHeader = "X-Golink-Fallback"
+
+// fallbackRedirects counts redirects sent to a fallback URL
+var fallbackRedirects = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "golink_redirect_fallbacks_total",
+	Help: "Total number of redirects sent to a fallback URL because the link's URL was found dead",
+})
+
+// rejectFallbackURL validates a link's fallback URL like its URL, answering
+// 400 for one that is invalid or the same as the URL itself
+func (h *LinkHandler) rejectFallbackURL(w http.ResponseWriter, fallback, url, short string) bool {
+	if fallback == "" {
+		return false
+	}
+	if fallback == url {
+		http.Error(w, "Fallback URL must differ from the link's URL", http.StatusBadRequest)
+		return true
+	}
+	return h.rejectTargetURL(w, fallback, short)
+}
+
+// fallbackDestination returns the link to redirect to in place of its
+// primary destination: the link itself, or a copy pointing at its fallback
+// URL while its URL is dead. A rollout's canary has a destination of its own
+// and is never replaced.
+func fallbackDestination(destination *models.Link, variant string) (*models.Link, bool) {
+	if variant == models.RolloutVariants.Canary || !destination.UsesFallback() {
+		return destination, false
+	}
+	fallback := destination.Clone()
+	fallback.URL = destination.FallbackURL
+	return fallback, true
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/fields"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+)
+
+// WithFavoriteStore lets signed-in users favorite links. Without a store the
+// favorite endpoints are unavailable and links are listed without is_favorite.
+func WithFavoriteStore(store interfaces.UserFavoriteStore) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.favorites = store
+	}
+}
+
+// ListedLink is a link listed for a signed-in user, flagged when they
+// favorited it
+type ListedLink struct {
+	*models.Link
+	IsFavorite bool `json:"is_favorite"`
+}
+
+// listedLinkFields are the fields ?fields= can select on listed links
+var listedLinkFields = fields.Names(ListedLink{})
+
+// favoriteShorts returns the set of short codes the user favorited, or nil
+// when favorites are disabled, the user is anonymous or they cannot be loaded
+func (h *LinkHandler) favoriteShorts(ctx context.Context, userID string) map[string]bool {
+	if h.favorites == nil || userID == anonymousUserID {
+		return nil
+	}
+	favorites, err := h.favorites.ListByUser(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to load favorites", err, logger.Fields{"userID": userID})
+		return nil
+	}
+	shorts := make(map[string]bool, len(favorites))
+	for _, favorite := range favorites {
+		shorts[favorite.Short] = true
+	}
+	return shorts
+}
+
+// withFavorites flags the user's favorites among links. Without favorites to
+// flag the links are returned as they are, so anonymous listings don't
+// claim that nothing is a favorite.
+func withFavorites(links []*models.Link, favorites map[string]bool) interface{} {
+	if favorites == nil {
+		return links
+	}
+	listed := make([]ListedLink, 0, len(links))
+	for _, link := range links {
+		listed = append(listed, ListedLink{Link: link, IsFavorite: favorites[link.Short]})
+	}
+	return listed
+}
+
+// HandleLinkFavorite handles /api/links/{short}/favorite requests: POST adds
+// the link to the caller's favorites and DELETE removes it. Only links the
+// caller can access may be favorited; both requests are idempotent.
+func (h *LinkHandler) HandleLinkFavorite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.favorites == nil {
+		http.Error(w, "Favorites are not enabled", http.StatusNotImplemented)
+		return
+	}
+	userID, _ := getUserFromContext(r)
+	if userID == anonymousUserID {
+		middleware.RespondWithError(w, http.StatusUnauthorized, middleware.ErrUnauthorized, "Sign in to manage your favorites")
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/favorite")
+	ctx := context.Background()
+
+	if r.Method == http.MethodDelete {
+		// The link may be gone already; its favorite can still be removed
+		if link, err := h.lookupLink(ctx, short); err == nil {
+			short = link.Short
+		}
+		if err := h.favorites.Remove(ctx, userID, short); err != nil {
+			http.Error(w, "Failed to remove favorite", http.StatusInternalServerError)
+			logger.Error("Failed to remove favorite", err, logger.Fields{"short": short, "userID": userID})
+			return
+		}
+		logger.Info("Favorite removed", logger.Fields{"short": short, "userID": userID})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	link, err := h.lookupLink(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if !link.CanAccessAs(userID, groups.FromContext(ctx)) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+	if err := h.favorites.Add(ctx, userID, link.Short, time.Now()); err != nil {
+		http.Error(w, "Failed to add favorite", http.StatusInternalServerError)
+		logger.Error("Failed to add favorite", err, logger.Fields{"short": link.Short, "userID": userID})
+		return
+	}
+	logger.Info("Favorite added", logger.Fields{"short": link.Short, "userID": userID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFavorites handles GET /api/links/favorites requests, listing the
+// caller's favorite links, most recently added first. Favorites of links
+// that were deleted, archived or are no longer accessible are left out.
+func (h *LinkHandler) GetFavorites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.favorites == nil {
+		http.Error(w, "Favorites are not enabled", http.StatusNotImplemented)
+		return
+	}
+	userID, _ := getUserFromContext(r)
+	if userID == anonymousUserID {
+		middleware.RespondWithError(w, http.StatusUnauthorized, middleware.ErrUnauthorized, "Sign in to see your favorites")
+		return
+	}
+	selection, ok := selectFields(w, r, listedLinkFields)
+	if !ok {
+		return
+	}
+
+	ctx := readContext(r)
+	favorites, err := h.favorites.ListByUser(ctx, userID)
+	if err != nil {
+		http.Error(w, "Failed to get favorites", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve favorites", err, logger.Fields{"userID": userID})
+		return
+	}
+
+	shorts := make([]string, len(favorites))
+	for i, favorite := range favorites {
+		shorts[i] = favorite.Short
+	}
+	favoriteLinks, err := h.repo.GetByShorts(ctx, shorts)
+	if err != nil {
+		http.Error(w, "Failed to get favorites", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve favorite links", err, logger.Fields{"userID": userID})
+		return
+	}
+
+	links := []ListedLink{}
+	for _, favorite := range favorites {
+		link, found := favoriteLinks[favorite.Short]
+		if !found || !link.CanAccessAs(userID, groups.FromContext(ctx)) || link.IsArchived() {
+			continue
+		}
+		links = append(links, ListedLink{Link: viewLink(r, link), IsFavorite: true})
+	}
+
+	encodeSelected(w, links, selection)
+}
@@ -3,31 +3,230 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
-	"net/url"
-	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/auth"
 	"github.com/Okabe-Junya/golink-backend/interfaces"
 	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
 	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/cache"
+	"github.com/Okabe-Junya/golink-backend/pkg/classification"
+	"github.com/Okabe-Junya/golink-backend/pkg/consistency"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/geoip"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+	"github.com/Okabe-Junya/golink-backend/pkg/region"
+	"github.com/Okabe-Junya/golink-backend/pkg/sandbox"
+	"github.com/Okabe-Junya/golink-backend/pkg/shortcode"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlnorm"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlpolicy"
+	"github.com/Okabe-Junya/golink-backend/pkg/usage"
 )
 
+// maxShortCodeAttempts bounds how often a colliding generated short code is retried
+const maxShortCodeAttempts = 5
+
+// shortCodePattern is the format of user-chosen short codes: letters, digits
+// and hyphens, optionally namespaced in up to three slash-separated segments
+// such as "team/docs"
+var shortCodePattern = regexp.MustCompile(`^[a-zA-Z0-9-]+(?:/[a-zA-Z0-9-]+){0,2}$`)
+
+// ShortCodeGenerator produces random short codes for links created without one
+type ShortCodeGenerator interface {
+	Generate() (string, error)
+}
+
 // LinkHandler handles HTTP requests for link operations
 type LinkHandler struct {
-	repo interfaces.LinkRepositoryInterface
+	repo       interfaces.LinkRepositoryInterface
+	generator  ShortCodeGenerator
+	strategies map[string]ShortCodeGenerator
+	versions   interfaces.LinkVersionStore
+	aliases    interfaces.LinkAliasStore
+	snapshots  interfaces.LinkSnapshotStore
+	references interfaces.LinkReferenceStore
+	// clickHistory records the links each user follows to personalize search
+	clickHistory interfaces.UserClickStore
+	favorites    interfaces.UserFavoriteStore
+	// clickEvents records the click stream of every redirect
+	clickEvents ClickRecorder
+	// clickStream is where clickEvents end up, moved along when a link is renamed
+	clickStream interfaces.ClickEventStore
+	// webhooks delivers an event for every change to a link
+	webhooks EventPublisher
+	// usage counts the use of product features
+	usage *usage.Recorder
+	// geoip locates the clients of redirects
+	geoip geoip.Resolver
+	// regions decides which regional destination a redirect goes to
+	regions    region.Resolver
+	health     HealthChecker
+	previews   PreviewFetcher
+	docPattern *regexp.Regexp
+	reserved   shortcode.Reserved
+	linkHosts  []string
+	urlPolicy  urlpolicy.Policy
+	// urlNormalizer canonicalizes destinations so duplicates compare equal
+	urlNormalizer urlnorm.Normalizer
+	// classification decides how links are shown by confidentiality
+	classification classification.Policy
+	// sandbox is the namespace anyone may try the service out in
+	sandbox    sandbox.Policy
+	undoWindow time.Duration
+	halfLife   time.Duration
+	// historyRetention is how long a user's clicks personalize their search
+	historyRetention time.Duration
+	// rejectDuplicates refuses links whose destination is already linked
+	rejectDuplicates bool
+	// background tracks work that outlives its request, such as click counting
+	background sync.WaitGroup
+}
+
+// LinkHandlerOption configures optional LinkHandler dependencies
+type LinkHandlerOption func(*LinkHandler)
+
+// WithShortCodeGenerator lets clients omit the short code when creating a link.
+// Without a generator the short code is required.
+func WithShortCodeGenerator(generator ShortCodeGenerator) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.generator = generator
+	}
+}
+
+// WithShortCodeStrategies lets clients pick how the short code of a link
+// created without one is generated, by naming one of the strategies as
+// "short_code_strategy". Links created without a name use the generator.
+func WithShortCodeStrategies(strategies map[string]ShortCodeGenerator) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.strategies = strategies
+	}
+}
+
+// shortCodeGenerator returns the generator of the named strategy, or the
+// default generator when no strategy is named. ok is false for an unknown
+// strategy.
+func (h *LinkHandler) shortCodeGenerator(strategy string) (generator ShortCodeGenerator, ok bool) {
+	if strategy == "" {
+		return h.generator, true
+	}
+	generator, ok = h.strategies[strategy]
+	return generator, ok
+}
+
+// WithURLPolicy overrides the limits applied to destination URLs
+func WithURLPolicy(policy urlpolicy.Policy) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.urlPolicy = policy
+	}
+}
+
+// WithURLNormalizer sets how destination URLs are put in canonical form
+// before they are validated and stored
+func WithURLNormalizer(normalizer urlnorm.Normalizer) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.urlNormalizer = normalizer
+	}
+}
+
+// WithReservedShortCodes reserves short codes in addition to the built-in ones
+func WithReservedShortCodes(codes []string) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.reserved = shortcode.NewReserved(codes...)
+	}
+}
+
+// WithVersionStore records every link update so it can be listed and rolled
+// back. Without a store the history endpoints are unavailable.
+func WithVersionStore(store interfaces.LinkVersionStore) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.versions = store
+	}
+}
+
+// WithUndoWindow sets how long after a delete its owner can undo it
+func WithUndoWindow(window time.Duration) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.undoWindow = window
+	}
+}
+
+// WithPopularityHalfLife sets the half-life of clicks in popularity scores.
+// It should match the one the scoring job runs with.
+func WithPopularityHalfLife(halfLife time.Duration) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.halfLife = halfLife
+	}
 }
 
 // NewLinkHandler creates a new LinkHandler
-func NewLinkHandler(repo interfaces.LinkRepositoryInterface) *LinkHandler {
-	return &LinkHandler{
-		repo: repo,
+func NewLinkHandler(repo interfaces.LinkRepositoryInterface, opts ...LinkHandlerOption) *LinkHandler {
+	h := &LinkHandler{
+		repo:           repo,
+		reserved:       shortcode.NewReserved(),
+		linkHosts:      append([]string{}, defaultLinkHosts...),
+		urlPolicy:      urlpolicy.Default(),
+		urlNormalizer:  urlnorm.Default(),
+		classification: classification.DefaultPolicy(),
+		sandbox:        sandbox.DefaultPolicy(),
+		undoWindow:     models.DefaultDeleteUndoWindow,
+		halfLife:       models.DefaultPopularityHalfLife,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.docPattern = docLinkPattern(h.linkHosts)
+	return h
+}
+
+// goBackground runs fn in a goroutine that Drain waits for
+func (h *LinkHandler) goBackground(fn func()) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		fn()
+	}()
+}
+
+// Drain waits for background work started by requests, such as click counts
+// and health checks, to finish. It gives up when ctx is done; call it after
+// the HTTP server has stopped accepting requests.
+func (h *LinkHandler) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
+// readContext returns the context of a handler's repository reads. Like the
+// background context handlers otherwise use it does not end with the
+// request, but it carries whether the client asked for strongly consistent
+// reads, the cap on the links the request loads and the groups of the user.
+func readContext(r *http.Request) context.Context {
+	ctx := consistency.Inherit(context.Background(), r.Context())
+	ctx = groups.Inherit(ctx, r.Context())
+	return linkcap.Inherit(ctx, r.Context())
+}
+
+// anonymousUserID is the user ID of requests without a signed-in user
+const anonymousUserID = "anonymous"
+
 // getUserFromContext extracts the user from request context
 func getUserFromContext(r *http.Request) (string, string) {
 	// Try to get authenticated user from context
@@ -35,29 +234,27 @@ func getUserFromContext(r *http.Request) (string, string) {
 		return user.ID, user.Email
 	}
 
-	// In production the AuthMiddleware always sets the context user before a handler
-	// runs, so reaching here means auth is disabled or we are under test. Only trust
-	// the X-User-ID header in test mode; otherwise it is attacker-controlled.
-	if os.Getenv("TEST_MODE") == "true" {
-		if userID := r.Header.Get("X-User-ID"); userID != "" {
-			return userID, ""
-		}
+	// Routes skipped by the AuthMiddleware, such as redirects, still carry the
+	// session cookie or the headers of a trusted proxy
+	if user, err := auth.GetCurrentUser(r); err == nil {
+		return user.ID, user.Email
 	}
-	return "anonymous", ""
+	return anonymousUserID, ""
 }
 
-// validateTargetURL ensures a link target is an absolute http(s) URL, rejecting
-// schemes such as javascript:, data:, or file: that would enable stored XSS when
-// the target is later rendered as an anchor href or emitted in a redirect Location.
-func validateTargetURL(raw string) bool {
-	u, err := url.Parse(raw)
-	if err != nil {
-		return false
-	}
-	if u.Scheme != "http" && u.Scheme != "https" {
+// rejectTargetURL validates a link target against the handler's URL policy and
+// writes a structured 400 response if it is not acceptable
+func (h *LinkHandler) rejectTargetURL(w http.ResponseWriter, raw, short string) bool {
+	verr := h.urlPolicy.Validate(raw)
+	if verr == nil {
 		return false
 	}
-	return u.Host != ""
+	middleware.RespondWithError(w, http.StatusBadRequest, verr.Code, verr.Message)
+	logger.Warn("Invalid target URL", logger.Fields{
+		"short": short,
+		"code":  verr.Code,
+	})
+	return true
 }
 
 // CreateLink handles POST /api/links requests
@@ -70,11 +267,22 @@ func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body: short code and target URL are expected
 	var requestBody struct {
-		Short        string   `json:"short"`
-		URL          string   `json:"url"`
-		AccessLevel  string   `json:"access_level,omitempty"`
-		ExpiresAt    string   `json:"expires_at,omitempty"`
-		AllowedUsers []string `json:"allowed_users,omitempty"`
+		Short          string   `json:"short"`
+		URL            string   `json:"url"`
+		AccessLevel    string   `json:"access_level,omitempty"`
+		ExpiresAt      string   `json:"expires_at,omitempty"`
+		Title          string   `json:"title,omitempty"`
+		Description    string   `json:"description,omitempty"`
+		AllowedUsers   []string `json:"allowed_users,omitempty"`
+		AllowedGroups  []string `json:"allowed_groups,omitempty"`
+		Tags           []string `json:"tags,omitempty"`
+		MaxClicks      int      `json:"max_clicks,omitempty"`
+		Classification string   `json:"classification,omitempty"`
+		FallbackURL    string   `json:"fallback_url,omitempty"`
+		// RegionalURLs are the destinations of visitors from each region
+		RegionalURLs map[string]string `json:"regional_urls,omitempty"`
+		// ShortCodeStrategy names how to generate a missing short code
+		ShortCodeStrategy string `json:"short_code_strategy,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -82,34 +290,68 @@ func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate required field
-	if requestBody.Short == "" {
+	// Validate required field; a short code is generated if the handler can
+	generator, ok := h.shortCodeGenerator(requestBody.ShortCodeStrategy)
+	if !ok {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_SHORT_CODE_STRATEGY",
+			fmt.Sprintf("Unknown short code strategy '%s'", requestBody.ShortCodeStrategy))
+		return
+	}
+	if requestBody.Short == "" && generator == nil {
 		http.Error(w, "Short code is required", http.StatusBadRequest)
 		logger.Warn("Missing short code in request", nil)
 		return
 	}
 
-	// If URL is not provided, set a default
-	targetURL := requestBody.URL
-	if targetURL == "" {
-		targetURL = "https://example.com"
-		logger.Info("No URL provided, using default", logger.Fields{
-			"short":      requestBody.Short,
-			"defaultURL": targetURL,
-		})
-	} else if !validateTargetURL(targetURL) {
-		http.Error(w, "URL must be an absolute http or https URL", http.StatusBadRequest)
-		logger.Warn("Invalid target URL", logger.Fields{"short": requestBody.Short})
+	// Validate the destination URL in canonical form
+	targetURL := h.urlNormalizer.Normalize(requestBody.URL)
+	if h.rejectTargetURL(w, targetURL, requestBody.Short) {
+		return
+	}
+	fallbackURL := h.urlNormalizer.Normalize(requestBody.FallbackURL)
+	if h.rejectFallbackURL(w, fallbackURL, targetURL, requestBody.Short) {
+		return
+	}
+	regionalURLs, ok := h.normalizeRegionalURLs(w, requestBody.RegionalURLs, requestBody.Short)
+	if !ok {
 		return
 	}
 
-	// Validate short code format (alphanumeric and hyphen only)
-	validShortCode := regexp.MustCompile(`^[a-zA-Z0-9-]+$`).MatchString(requestBody.Short)
-	if !validShortCode {
-		http.Error(w, "Short code must contain only letters, numbers, and hyphens", http.StatusBadRequest)
+	// Validate short code format (alphanumeric and hyphen segments)
+	validShortCode := shortCodePattern.MatchString(requestBody.Short)
+	if requestBody.Short != "" && !validShortCode {
+		http.Error(w, "Short code must contain only letters, numbers, and hyphens, in at most three slash-separated segments", http.StatusBadRequest)
 		logger.Warn("Invalid short code format", logger.Fields{"short": requestBody.Short})
 		return
 	}
+	if h.isReservedShortCode(requestBody.Short) {
+		middleware.RespondWithError(w, http.StatusBadRequest, "SHORT_CODE_RESERVED",
+			fmt.Sprintf("Short code '%s' is reserved", requestBody.Short))
+		logger.Warn("Attempted to create link with reserved short code", logger.Fields{"short": requestBody.Short})
+		return
+	}
+
+	// Validate descriptive metadata
+	if err := models.ValidateMetadata(requestBody.Title, requestBody.Description); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.Warn("Invalid link metadata", logger.Fields{"short": requestBody.Short, "error": err.Error()})
+		return
+	}
+	tags, err := models.NormalizeTags(requestBody.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.Warn("Invalid link tags", logger.Fields{"short": requestBody.Short, "error": err.Error()})
+		return
+	}
+	if requestBody.MaxClicks < 0 {
+		http.Error(w, "Max clicks must not be negative", http.StatusBadRequest)
+		return
+	}
+	level, err := h.classification.Parse(requestBody.Classification)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_CLASSIFICATION", err.Error())
+		return
+	}
 
 	// Get user ID from context
 	userID, userEmail := getUserFromContext(r)
@@ -119,21 +361,52 @@ func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
 		"short":  requestBody.Short,
 	})
 
-	ctx := context.Background()
+	ctx := groups.Inherit(context.Background(), r.Context())
+
+	// Namespaced short codes may only be added by the namespace's owner
+	if h.rejectNamespace(ctx, w, requestBody.Short, userID) {
+		return
+	}
 
 	// Check if short code already exists
-	existingLink, err := h.repo.GetByShort(ctx, requestBody.Short)
-	if err == nil && existingLink != nil {
-		http.Error(w, "Short code already exists", http.StatusConflict)
-		logger.Warn("Attempted to create link with existing short code", logger.Fields{
-			"short":  requestBody.Short,
-			"userID": userID,
+	if requestBody.Short != "" {
+		existingLink, err := h.repo.GetByShort(ctx, requestBody.Short)
+		if err != nil && !errors.Is(err, errors.ErrNotFound) {
+			respondRepositoryError(w, err, "Link not found", logger.Fields{"short": requestBody.Short})
+			return
+		}
+		if (err == nil && existingLink != nil) || h.aliasExists(ctx, requestBody.Short) {
+			http.Error(w, "Short code already exists", http.StatusConflict)
+			logger.Warn("Attempted to create link with existing short code", logger.Fields{
+				"short":  requestBody.Short,
+				"userID": userID,
+			})
+			return
+		}
+	}
+
+	// Point out links that already lead to the same destination
+	duplicates := h.duplicateShorts(ctx, targetURL, userID)
+	if len(duplicates) > 0 && h.rejectDuplicates {
+		respondDuplicateURL(w, duplicates)
+		logger.Warn("Attempted to create link with an already linked URL", logger.Fields{
+			"short":      requestBody.Short,
+			"url":        targetURL,
+			"duplicates": duplicates,
+			"userID":     userID,
 		})
 		return
 	}
 
 	// Create a new link with the target URL
 	link := models.NewLink(requestBody.Short, targetURL, userID)
+	link.Title = requestBody.Title
+	link.Description = requestBody.Description
+	link.Tags = tags
+	link.MaxClicks = requestBody.MaxClicks
+	link.Classification = level
+	link.FallbackURL = fallbackURL
+	link.RegionalURLs = regionalURLs
 
 	// Set access level if provided, otherwise use default
 	if requestBody.AccessLevel != "" &&
@@ -151,6 +424,9 @@ func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
 	} else {
 		link.AllowedUsers = []string{}
 	}
+	if link.AccessLevel == models.AccessLevels.Restricted && len(requestBody.AllowedGroups) > 0 {
+		link.AllowedGroups = groups.NormalizeAll(requestBody.AllowedGroups)
+	}
 
 	// Set expiry time if provided
 	if requestBody.ExpiresAt != "" {
@@ -180,9 +456,22 @@ func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
 			"expiryDate": expiryTime.String(),
 		})
 	}
+	// Sandbox links always expire
+	if h.sandbox.Contains(link.Short) {
+		link.SetExpiry(h.sandbox.Expiry(link.CreatedAt, link.ExpiresAt))
+	}
 
 	// Save the link
-	if err := h.repo.Create(ctx, link); err != nil {
+	checkHealth := h.markHealthPending(link)
+	if err := h.saveLink(ctx, link, generator); err != nil {
+		if errors.Is(err, errors.ErrAlreadyExists) {
+			http.Error(w, "Short code already exists", http.StatusConflict)
+			logger.Warn("Short code was taken while creating link", logger.Fields{
+				"short":  link.Short,
+				"userID": userID,
+			})
+			return
+		}
 		http.Error(w, "Failed to create link", http.StatusInternalServerError)
 		logger.Error("Failed to create link in database", err, logger.Fields{
 			"short":  requestBody.Short,
@@ -197,15 +486,54 @@ func (h *LinkHandler) CreateLink(w http.ResponseWriter, r *http.Request) {
 		"userID":      userID,
 		"accessLevel": link.AccessLevel,
 	})
+	h.publishEvent(models.WebhookEvents.LinkCreated, link, userID)
+	h.recordLinkCreated(r)
+	if checkHealth {
+		h.checkHealthAsync(link.Short, link.URL)
+	}
 
-	// Return the created link
+	// Return the created link, with the links sharing its destination
+	response := struct {
+		*models.Link
+		Duplicates []string `json:"duplicates,omitempty"`
+	}{Link: viewLink(r, link), Duplicates: duplicates}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(link); err != nil {
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "failed to encode response", http.StatusInternalServerError)
 	}
 }
 
+// saveLink stores the link, generating a short code with generator if none
+// was given. Generated codes that collide with an existing link are retried.
+func (h *LinkHandler) saveLink(ctx context.Context, link *models.Link, generator ShortCodeGenerator) error {
+	if link.Short != "" {
+		return h.repo.Create(ctx, link)
+	}
+
+	for attempt := 1; attempt <= maxShortCodeAttempts; attempt++ {
+		short, err := generator.Generate()
+		if err != nil {
+			return err
+		}
+		if h.reserved.Contains(short) || h.aliasExists(ctx, short) {
+			continue
+		}
+		link.Short = short
+
+		err = h.repo.Create(ctx, link)
+		if !errors.Is(err, errors.ErrAlreadyExists) {
+			return err
+		}
+		logger.Warn("Generated short code already exists, retrying", logger.Fields{
+			"short":   short,
+			"attempt": attempt,
+		})
+	}
+
+	return fmt.Errorf("no free short code after %d attempts", maxShortCodeAttempts)
+}
+
 // GetLinks handles GET /api/links requests
 func (h *LinkHandler) GetLinks(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET method
@@ -219,85 +547,88 @@ func (h *LinkHandler) GetLinks(w http.ResponseWriter, r *http.Request) {
 	userID, _ := getUserFromContext(r)
 
 	// Get query parameters
-	accessLevel := r.URL.Query().Get("access_level")
-	createdBy := r.URL.Query().Get("created_by")
+	params := r.URL.Query()
+	query := models.LinkQuery{
+		AccessLevel:     params.Get("access_level"),
+		CreatedBy:       params.Get("created_by"),
+		Tag:             params.Get("tag"),
+		Archived:        params.Get("archived") == "true",
+		VisibleTo:       userID,
+		VisibleToGroups: groups.FromContext(r.Context()),
+	}
+	order := params.Get("sort")
+	if order != "popular" && order != "" {
+		if !models.ValidLinkOrder(order) {
+			http.Error(w, "sort must be 'popular', 'newest' or 'clicks'", http.StatusBadRequest)
+			return
+		}
+		query.OrderBy = order
+	}
+	if value := params.Get("expired"); value != "" {
+		expired, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "expired must be 'true' or 'false'", http.StatusBadRequest)
+			return
+		}
+		query.Expired = &expired
+	}
+	limit := 0
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	// Links are ranked by popularity here, so the limit applies after ranking
+	if order != "popular" {
+		query.Limit = limit
+	}
+	selection, ok := selectFields(w, r, listedLinkFields)
+	if !ok {
+		return
+	}
 	logger.Info("Getting links with filters", logger.Fields{
 		"userID":      userID,
-		"accessLevel": accessLevel,
-		"createdBy":   createdBy,
+		"accessLevel": query.AccessLevel,
+		"createdBy":   query.CreatedBy,
+		"tag":         query.Tag,
+		"archived":    query.Archived,
+		"sort":        order,
+		"limit":       limit,
 	})
 
-	ctx := context.Background()
-	var links []*models.Link
-	var err error
-
-	// Filter by access level if provided
-	switch accessLevel {
-	case "":
-		if createdBy != "" {
-			// Filter by creator if provided
-			links, err = h.repo.GetByUser(ctx, createdBy)
-		} else {
-			// Get all links
-			links, err = h.repo.GetAll(ctx)
-		}
-	default:
-		links, err = h.repo.GetByAccessLevel(ctx, accessLevel)
-	}
-
+	ctx := readContext(r)
+	links, err := h.repo.List(ctx, query)
 	if err != nil {
 		http.Error(w, "Failed to get links", http.StatusInternalServerError)
 		logger.Error("Failed to retrieve links", err, logger.Fields{
 			"userID":      userID,
-			"accessLevel": accessLevel,
-			"createdBy":   createdBy,
+			"accessLevel": query.AccessLevel,
+			"createdBy":   query.CreatedBy,
 		})
 		return
 	}
 
-	// Filter links based on access control if user ID is provided
-	if userID != "" {
-		var filteredLinks []*models.Link
-		for _, link := range links {
-			// Check if the link is expired and update the flag if needed
-			if link.IsLinkExpired() && !link.IsExpired {
-				link.IsExpired = true
-				if err := h.repo.Update(ctx, link); err != nil {
-					logger.Error("Failed to update link expired status", err, logger.Fields{
-						"short": link.Short,
-					})
-				}
-			}
-
-			// Public links are accessible to everyone
-			if link.AccessLevel == models.AccessLevels.Public {
-				filteredLinks = append(filteredLinks, link)
-				continue
-			}
-
-			// Private links are only accessible to the creator
-			if link.AccessLevel == models.AccessLevels.Private && link.CreatedBy == userID {
-				filteredLinks = append(filteredLinks, link)
-				continue
+	// Flag links past their expiry
+	for _, link := range links {
+		if link.IsLinkExpired() && !link.IsExpired {
+			link.IsExpired = true
+			if err := h.repo.Update(ctx, link); err != nil {
+				logger.Error("Failed to update link expired status", err, logger.Fields{
+					"short": link.Short,
+				})
 			}
+		}
+	}
 
-			// Restricted links are accessible to the creator and allowed users
-			if link.AccessLevel == models.AccessLevels.Restricted {
-				if link.CreatedBy == userID {
-					filteredLinks = append(filteredLinks, link)
-					continue
-				}
-
-				// Check if the user is in the allowed users list
-				for _, allowedUser := range link.AllowedUsers {
-					if allowedUser == userID {
-						filteredLinks = append(filteredLinks, link)
-						break
-					}
-				}
-			}
+	// Rank links in use now above links that were popular long ago
+	if order == "popular" {
+		models.SortByPopularity(links, time.Now(), h.halfLife)
+		if limit > 0 && len(links) > limit {
+			links = links[:limit]
 		}
-		links = filteredLinks
 	}
 
 	logger.Info("Retrieved links", logger.Fields{
@@ -305,11 +636,8 @@ func (h *LinkHandler) GetLinks(w http.ResponseWriter, r *http.Request) {
 		"userID": userID,
 	})
 
-	// Return the links
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(links); err != nil {
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
-	}
+	// Return the links, flagging the user's favorites
+	encodeSelected(w, withFavorites(viewLinks(r, links), h.favoriteShorts(ctx, userID)), selection)
 }
 
 // GetLink handles GET /api/links/{short} requests
@@ -328,6 +656,10 @@ func (h *LinkHandler) GetLink(w http.ResponseWriter, r *http.Request) {
 		logger.Warn("Short code is missing in get link request", nil)
 		return
 	}
+	selection, ok := selectFields(w, r, linkFields)
+	if !ok {
+		return
+	}
 
 	// Get user ID from context
 	userID, _ := getUserFromContext(r)
@@ -338,11 +670,10 @@ func (h *LinkHandler) GetLink(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Get the link
-	ctx := context.Background()
+	ctx := readContext(r)
 	link, err := h.repo.GetByShort(ctx, short)
 	if err != nil {
-		http.Error(w, "Link not found", http.StatusNotFound)
-		logger.Error("Failed to find link", err, logger.Fields{"short": short})
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
 		return
 	}
 
@@ -374,10 +705,7 @@ func (h *LinkHandler) GetLink(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Return the link
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(link); err != nil {
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
-	}
+	encodeSelected(w, viewLink(r, link), selection)
 }
 
 // UpdateLink handles PUT /api/links/{short} requests
@@ -408,16 +736,17 @@ func (h *LinkHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	link, err := h.repo.GetByShort(ctx, short)
 	if err != nil {
-		http.Error(w, "Link not found", http.StatusNotFound)
-		logger.Error("Link not found for update", err, logger.Fields{"short": short})
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
 		return
 	}
-
-	// Only the creator can update this link. When auth is disabled the tool runs in
-	// anonymous mode and edits are open; when auth is enabled ownership is enforced
-	// (an "anonymous" userID must not be able to edit another user's link).
-	if auth.IsAuthEnabled() && link.CreatedBy != userID {
-		http.Error(w, "Only the creator can update this link", http.StatusForbidden)
+	previous := link.Clone()
+
+	// Only the creator and admins can update this link. When auth is disabled the
+	// tool runs in anonymous mode and edits are open; when auth is enabled
+	// ownership is enforced (an "anonymous" userID must not be able to edit
+	// another user's link).
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the creator or an admin can update this link", http.StatusForbidden)
 		logger.Warn("Unauthorized update attempt", logger.Fields{
 			"short":       short,
 			"requestUser": userID,
@@ -426,11 +755,22 @@ func (h *LinkHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Title, description, tags, the click limit, the fallback URL and the
+	// regional URLs are pointers so clients can clear them
 	var requestBody struct {
-		URL          string   `json:"url,omitempty"`
-		AccessLevel  string   `json:"access_level,omitempty"`
-		ExpiresAt    string   `json:"expires_at,omitempty"`
-		AllowedUsers []string `json:"allowed_users,omitempty"`
+		Title       *string   `json:"title,omitempty"`
+		Description *string   `json:"description,omitempty"`
+		Tags        *[]string `json:"tags,omitempty"`
+		MaxClicks   *int      `json:"max_clicks,omitempty"`
+		FallbackURL *string   `json:"fallback_url,omitempty"`
+		// RegionalURLs replaces all regional destinations; {} removes them
+		RegionalURLs   *map[string]string `json:"regional_urls,omitempty"`
+		URL            string             `json:"url,omitempty"`
+		Classification string             `json:"classification,omitempty"`
+		AccessLevel    string             `json:"access_level,omitempty"`
+		ExpiresAt      string             `json:"expires_at,omitempty"`
+		AllowedUsers   []string           `json:"allowed_users,omitempty"`
+		AllowedGroups  []string           `json:"allowed_groups,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -439,13 +779,68 @@ func (h *LinkHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update the link fields
-	if requestBody.URL != "" {
-		if !validateTargetURL(requestBody.URL) {
-			http.Error(w, "URL must be an absolute http or https URL", http.StatusBadRequest)
-			logger.Warn("Invalid target URL on update", logger.Fields{"short": short})
+	checkHealth := false
+	if url := h.urlNormalizer.Normalize(requestBody.URL); url != "" {
+		if h.rejectTargetURL(w, url, short) {
+			return
+		}
+		if url != link.URL {
+			link.URL = url
+			// A new URL settles any rollout, whichever way it went
+			link.Rollout = nil
+			checkHealth = h.markHealthPending(link)
+		}
+	}
+	if requestBody.FallbackURL != nil {
+		fallbackURL := h.urlNormalizer.Normalize(*requestBody.FallbackURL)
+		if h.rejectFallbackURL(w, fallbackURL, link.URL, short) {
+			return
+		}
+		link.FallbackURL = fallbackURL
+	}
+	if requestBody.RegionalURLs != nil {
+		regionalURLs, ok := h.normalizeRegionalURLs(w, *requestBody.RegionalURLs, short)
+		if !ok {
 			return
 		}
-		link.URL = requestBody.URL
+		link.RegionalURLs = regionalURLs
+	}
+
+	// Update descriptive metadata if provided
+	if requestBody.Title != nil {
+		link.Title = *requestBody.Title
+	}
+	if requestBody.Description != nil {
+		link.Description = *requestBody.Description
+	}
+	if err := models.ValidateMetadata(link.Title, link.Description); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.Warn("Invalid link metadata on update", logger.Fields{"short": short, "error": err.Error()})
+		return
+	}
+	if requestBody.Tags != nil {
+		tags, err := models.NormalizeTags(*requestBody.Tags)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			logger.Warn("Invalid link tags on update", logger.Fields{"short": short, "error": err.Error()})
+			return
+		}
+		link.Tags = tags
+	}
+	if requestBody.MaxClicks != nil {
+		if *requestBody.MaxClicks < 0 {
+			http.Error(w, "Max clicks must not be negative", http.StatusBadRequest)
+			return
+		}
+		link.MaxClicks = *requestBody.MaxClicks
+	}
+	if requestBody.Classification != "" {
+		level, err := h.classification.Parse(requestBody.Classification)
+		if err != nil {
+			middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_CLASSIFICATION", err.Error())
+			return
+		}
+		link.Classification = level
 	}
 
 	// Update access level if provided
@@ -464,6 +859,9 @@ func (h *LinkHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
 			logger.Error("Failed to update link allowed users", updateErr, logger.Fields{"short": short})
 		}
 	}
+	if link.AccessLevel == models.AccessLevels.Restricted && requestBody.AllowedGroups != nil {
+		link.AllowedGroups = groups.NormalizeAll(requestBody.AllowedGroups)
+	}
 
 	// Update expiry time if provided
 	if requestBody.ExpiresAt != "" {
@@ -500,6 +898,10 @@ func (h *LinkHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
 			"shortCode": short,
 		})
 	}
+	// Sandbox links cannot be kept past their lifetime
+	if h.sandbox.Contains(link.Short) {
+		link.ExpiresAt = h.sandbox.Expiry(link.CreatedAt, link.ExpiresAt)
+	}
 
 	link.UpdatedAt = time.Now()
 
@@ -519,15 +921,22 @@ func (h *LinkHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
 		"newURL":      link.URL,
 		"accessLevel": link.AccessLevel,
 	})
+	h.recordVersion(ctx, previous, link, userID)
+	h.publishEvent(models.WebhookEvents.LinkUpdated, link, userID)
+	if checkHealth {
+		h.checkHealthAsync(short, link.URL)
+	}
 
 	// Return the updated link
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(link); err != nil {
+	if err := json.NewEncoder(w).Encode(viewLink(r, link)); err != nil {
 		http.Error(w, "failed to encode response", http.StatusInternalServerError)
 	}
 }
 
-// DeleteLink handles DELETE /api/links/{short} requests
+// DeleteLink handles DELETE /api/links/{short} requests. Deleting a link that
+// was followed recently or is referenced by documents fails with a 409
+// describing the impact unless the request sets force=true.
 func (h *LinkHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
 	// Only allow DELETE method
 	if r.Method != http.MethodDelete {
@@ -551,8 +960,7 @@ func (h *LinkHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 	link, err := h.repo.GetByShort(ctx, short)
 	if err != nil {
-		http.Error(w, "Link not found", http.StatusNotFound)
-		logger.Error("Failed to find link for deletion", err, logger.Fields{
+		respondRepositoryError(w, err, "Link not found", logger.Fields{
 			"short":  short,
 			"userID": userID,
 		})
@@ -560,10 +968,10 @@ func (h *LinkHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// When auth is disabled the tool runs in anonymous mode and deletes are open;
-	// when auth is enabled only the creator can delete this link (an "anonymous"
-	// userID must not be able to delete another user's link).
-	if auth.IsAuthEnabled() && link.CreatedBy != userID {
-		http.Error(w, "Only the creator can delete this link", http.StatusForbidden)
+	// when auth is enabled only the creator and admins can delete this link (an
+	// "anonymous" userID must not be able to delete another user's link).
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the creator or an admin can delete this link", http.StatusForbidden)
 		logger.Warn("Unauthorized delete attempt", logger.Fields{
 			"short":       short,
 			"requestUser": userID,
@@ -572,6 +980,20 @@ func (h *LinkHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Links that are still followed or referenced need explicit confirmation
+	if r.URL.Query().Get("force") != "true" {
+		if impact := h.deletionImpact(ctx, link); impact.significant() {
+			respondDeletionImpact(w, short, impact)
+			logger.Info("Deletion of link in use needs confirmation", logger.Fields{
+				"short":     short,
+				"userID":    userID,
+				"clicks":    impact.ClickCount,
+				"documents": impact.Documents,
+			})
+			return
+		}
+	}
+
 	// Delete the link
 	if err := h.repo.Delete(ctx, short); err != nil {
 		http.Error(w, "Failed to delete link", http.StatusInternalServerError)
@@ -582,16 +1004,155 @@ func (h *LinkHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logger.Info("Link successfully deleted", logger.Fields{
+	logger.Info("Link moved to trash", logger.Fields{
 		"short":           short,
 		"userID":          userID,
 		"originalCreator": link.CreatedBy,
+		"undoWindow":      h.undoWindow.String(),
 	})
+	h.publishEvent(models.WebhookEvents.LinkDeleted, link, userID)
 
 	// Return success
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetTrash handles GET /api/links/trash requests, listing deleted links that
+// can still be restored, most recently deleted first
+func (h *LinkHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	selection, ok := selectFields(w, r, linkFields)
+	if !ok {
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := getUserFromContext(r)
+
+	ctx := readContext(r)
+	deleted, err := h.repo.GetDeleted(ctx)
+	if err != nil {
+		http.Error(w, "Failed to get deleted links", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve deleted links", err, logger.Fields{"userID": userID})
+		return
+	}
+
+	// Like deletes, the trash is scoped to the creator, while admins see it all
+	admin := isAdminRequest(r)
+	links := make([]*models.Link, 0, len(deleted))
+	for _, link := range deleted {
+		if link.CreatedBy != userID && !admin {
+			continue
+		}
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].DeletedAt.After(links[j].DeletedAt)
+	})
+
+	encodeSelected(w, viewLinks(r, links), selection)
+}
+
+// RestoreLink handles POST /api/links/{short}/restore requests
+func (h *LinkHandler) RestoreLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the short code from the URL path
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/restore")
+	h.restoreLink(w, r, short, false)
+}
+
+// UndoDelete handles POST /api/links/{short}/undo-delete requests. Within the
+// undo window after a delete the link comes back exactly as it was, aliases
+// included; afterwards it can only be restored from the trash.
+func (h *LinkHandler) UndoDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the short code from the URL path
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/undo-delete")
+	h.restoreLink(w, r, short, true)
+}
+
+// restoreLink takes a link out of the trash. An undo is refused once the
+// deletion's undo window has passed.
+func (h *LinkHandler) restoreLink(w http.ResponseWriter, r *http.Request, short string, undo bool) {
+	if short == "" {
+		http.Error(w, "Short code is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := getUserFromContext(r)
+
+	ctx := context.Background()
+	link, err := h.repo.GetDeletedByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found in trash", logger.Fields{
+			"short":  short,
+			"userID": userID,
+		})
+		return
+	}
+
+	// Only the creator and admins can restore, mirroring who can delete
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the creator or an admin can restore this link", http.StatusForbidden)
+		logger.Warn("Unauthorized restore attempt", logger.Fields{
+			"short":       short,
+			"requestUser": userID,
+			"creatorUser": link.CreatedBy,
+		})
+		return
+	}
+
+	if undo && !link.IsPendingDelete(h.undoWindow) {
+		middleware.RespondWithError(w, http.StatusGone, "UNDO_WINDOW_EXPIRED",
+			fmt.Sprintf("The deletion of '%s' can no longer be undone; restore it from the trash instead", short))
+		logger.Info("Undo requested after the undo window", logger.Fields{
+			"short":     short,
+			"userID":    userID,
+			"deletedAt": link.DeletedAt,
+		})
+		return
+	}
+
+	if err := h.repo.Restore(ctx, short); err != nil {
+		http.Error(w, "Failed to restore link", http.StatusInternalServerError)
+		logger.Error("Failed to restore link", err, logger.Fields{
+			"short":  short,
+			"userID": userID,
+		})
+		return
+	}
+
+	restored, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		http.Error(w, "Failed to get restored link", http.StatusInternalServerError)
+		logger.Error("Failed to get restored link", err, logger.Fields{"short": short})
+		return
+	}
+
+	logger.Info("Link restored from trash", logger.Fields{
+		"short":  short,
+		"userID": userID,
+		"undo":   undo,
+	})
+	h.publishEvent(models.WebhookEvents.LinkRestored, restored, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(viewLink(r, restored)); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
 // RedirectLink handles GET /{short} requests
 func (h *LinkHandler) RedirectLink(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET method
@@ -602,7 +1163,7 @@ func (h *LinkHandler) RedirectLink(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Skip static file requests and special paths
-	path := r.URL.Path[1:] // Remove leading slash
+	path := strings.TrimSuffix(r.URL.Path[1:], "/") // Remove leading and trailing slashes
 	if path == "" || path == "index.html" || path == "favicon.ico" ||
 		strings.HasPrefix(path, "static/") || strings.HasPrefix(path, "assets/") {
 		http.NotFound(w, r)
@@ -614,26 +1175,42 @@ func (h *LinkHandler) RedirectLink(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID, _ := getUserFromContext(r)
 
-	// Get the link
-	ctx := context.Background()
-	link, err := h.repo.GetByShort(ctx, path)
+	// Get the link, following an alias to the link it stands for. Segments
+	// after its short code fill template placeholders or are passed through.
+	// Redirects may be served links from the link cache, while writes go
+	// through writeCtx, which never allows it.
+	writeCtx := readContext(r)
+	ctx := cache.Allow(writeCtx)
+	link, extra, err := h.resolvePath(ctx, path)
 	if err != nil {
-		http.Error(w, "Link not found", http.StatusNotFound)
-		logger.Error("Link not found for redirect", err, logger.Fields{"short": path})
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": path})
+		return
+	}
+	renamedFrom := h.renamedAlias(ctx, path, extra, link)
+	if link.Short != path {
+		logger.Info("Redirect resolved to link", logger.Fields{"path": path, "short": link.Short})
+		path = link.Short
+	}
+
+	// An archived link stays on record but no longer redirects
+	if link.IsArchived() {
+		http.Error(w, "This link has been archived", http.StatusGone)
+		logger.Info("Archived link access attempt", logger.Fields{
+			"short":  path,
+			"userID": userID,
+		})
 		return
 	}
 
-	// Check if the link is expired
+	// Check if the link is expired. A cached link may be out of date, so the
+	// stored link has the final say.
 	if link.IsLinkExpired() {
-		// Mark the link as expired in the database if not already marked
-		if !link.IsExpired {
-			link.IsExpired = true
-			err := h.repo.Update(ctx, link)
-			if err != nil {
-				logger.Error("Failed to mark link as expired", err, logger.Fields{"short": path})
-			}
+		if link, err = h.expireLink(writeCtx, path); err != nil {
+			respondRepositoryError(w, err, "Link not found", logger.Fields{"short": path})
+			return
 		}
-
+	}
+	if link.IsLinkExpired() {
 		http.Error(w, "This link has expired", http.StatusGone)
 		logger.Info("Expired link access attempt", logger.Fields{
 			"short":     path,
@@ -670,23 +1247,145 @@ func (h *LinkHandler) RedirectLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Increment the click count in a background goroutine
-	go func() {
-		// Use a new context for the background operation
-		ctx := context.Background()
-		if err := h.repo.IncrementClickCount(ctx, path); err != nil {
+	// Build the destination before counting the click, so malformed
+	// requests for a template are not counted
+	// Visitors go to their region's destination, or to the fallback while
+	// the link's URL is dead
+	clientRegion := h.clientRegion(r)
+	destination, variant := rolloutDestination(r, link, userID)
+	destination, regional := regionalDestination(destination, variant, clientRegion)
+	fallback := false
+	if !regional {
+		destination, fallback = fallbackDestination(destination, variant)
+	}
+	targetURL, err := destination.ResolveURL(extra, r.URL.RawQuery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if targetURL != destination.URL {
+		// Filled-in and passed-through values must not lead past the URL policy
+		if verr := h.urlPolicy.Validate(targetURL); verr != nil {
+			middleware.RespondWithError(w, http.StatusBadRequest, verr.Code, verr.Message)
+			return
+		}
+	}
+
+	if link.MaxClicks > 0 {
+		// Count a click on a limited link before redirecting, so the repository
+		// can refuse clicks beyond the limit even when they arrive concurrently
+		if err := h.repo.IncrementClickCount(writeCtx, path); err != nil {
+			if errors.Is(err, errors.ErrGone) {
+				http.Error(w, "This link has reached its click limit", http.StatusGone)
+				logger.Info("Click-limited link access attempt", logger.Fields{
+					"short":     path,
+					"userID":    userID,
+					"maxClicks": link.MaxClicks,
+				})
+				return
+			}
+			http.Error(w, "Failed to record click", http.StatusInternalServerError)
 			logger.Error("Failed to increment click count", err, logger.Fields{"short": path})
+			return
 		}
-	}()
+	} else {
+		// Increment the click count in the background
+		h.goBackground(func() {
+			// Use a new context for the background operation
+			ctx := context.Background()
+			err := h.repo.IncrementClickCount(ctx, path)
+			jobs.Record("click-count", err)
+			if err != nil {
+				logger.Error("Failed to increment click count", err, logger.Fields{"job": "click-count", "short": path})
+			}
+		})
+	}
+	h.recordUserClick(r, userID, link.Short)
+	h.recordClickEvent(r, userID, link.Short, clientRegion)
+	if variant != "" {
+		h.goBackground(func() {
+			err := h.repo.RecordRolloutClick(context.Background(), path, variant)
+			jobs.Record("rollout-clicks", err)
+			if err != nil {
+				logger.Error("Failed to record rollout click", err, logger.Fields{"job": "rollout-clicks", "short": path, "variant": variant})
+			}
+		})
+	}
+
+	// A deprecated link sends visitors on to its successor, which counts
+	// the click again as its own
+	deprecated := link.IsDeprecated()
+	if deprecated {
+		targetURL = successorURL(link, extra, r.URL.RawQuery, targetURL)
+	}
 
 	logger.Info("Redirecting to target URL", logger.Fields{
 		"short":     path,
-		"targetURL": link.URL,
+		"targetURL": targetURL,
+		"variant":   variant,
+		"fallback":  fallback,
+		"region":    clientRegion,
 		"userID":    userID,
 	})
+	if regional {
+		regionalRedirects.WithLabelValues(clientRegion).Inc()
+	}
+	if fallback {
+		fallbackRedirects.Inc()
+		w.Header().Set(FallbackHeader, "primary-unavailable")
+	}
+
+	if deprecated {
+		deprecatedRedirects.WithLabelValues(link.Deprecation.Mode).Inc()
+		setDeprecationHeaders(w, link.Deprecation)
+		// The successor shows its own reminder, if any
+		hasSuccessor := link.Deprecation.Successor != ""
+		if link.Deprecation.Mode == models.DeprecationModes.Notice &&
+			(hasSuccessor || !h.classification.RequiresInterstitial(link.Classification)) {
+			renderDeprecationNotice(w, link.Short, link.Deprecation, targetURL)
+			return
+		}
+		if hasSuccessor {
+			http.Redirect(w, r, targetURL, http.StatusFound)
+			return
+		}
+	} else if renamedFrom != nil {
+		// Visitors of a renamed link's old code reach the link itself
+		notice := renamedFrom.Deprecation
+		deprecatedRedirects.WithLabelValues(notice.Mode).Inc()
+		setDeprecationHeaders(w, notice)
+		if notice.Mode == models.DeprecationModes.Notice && !h.classification.RequiresInterstitial(link.Classification) {
+			renderDeprecationNotice(w, renamedFrom.Alias, notice, targetURL)
+			return
+		}
+	}
+
+	// Confidential destinations are only reached through a reminder
+	if h.classification.RequiresInterstitial(link.Classification) {
+		renderInterstitial(w, link, targetURL)
+		return
+	}
 
 	// Redirect to the original URL
-	http.Redirect(w, r, link.URL, http.StatusFound)
+	http.Redirect(w, r, targetURL, http.StatusFound)
+}
+
+// expireLink reads the link with the short code from the store, bypassing
+// the link cache, and marks it as expired if it has expired but is not yet
+// marked. Reading it again keeps changes made on other replicas since the
+// link was cached from being written back over.
+func (h *LinkHandler) expireLink(ctx context.Context, short string) (*models.Link, error) {
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+	if link.IsLinkExpired() && !link.IsExpired {
+		link.IsExpired = true
+		if err := h.repo.Update(ctx, link); err != nil {
+			logger.Error("Failed to mark link as expired", err, logger.Fields{"short": short})
+		}
+	}
+	return link, nil
 }
 
 // HealthCheck handles GET /health requests
@@ -697,8 +1396,9 @@ func (h *LinkHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if we can connect to the database
-	ctx := context.Background()
-	_, err := h.repo.GetAll(ctx)
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	err := h.repo.Ping(ctx)
 
 	response := map[string]string{
 		"status":    "healthy",
@@ -739,10 +1439,11 @@ func (h *LinkHandler) DeleteExpiredLinks(w http.ResponseWriter, r *http.Request)
 	}
 
 	var deletedCount int
+	admin := isAdminRequest(r)
 	for _, link := range links {
-		// Only delete links the user owns. When auth is disabled (anonymous mode)
-		// all expired links are eligible; when enabled, ownership is enforced.
-		if auth.IsAuthEnabled() && link.CreatedBy != userID {
+		// Only delete links the user owns, unless they are an admin. When auth is
+		// disabled (anonymous mode) all expired links are eligible.
+		if link.CreatedBy != userID && !admin {
 			continue
 		}
 
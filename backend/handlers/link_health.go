@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+)
+
+// healthCheckTimeout bounds a background destination check, including the
+// store update that records its result
+const healthCheckTimeout = 30 * time.Second
+
+// HealthChecker probes whether a destination URL is reachable, returning one
+// of models.HealthStatuses
+type HealthChecker interface {
+	Check(ctx context.Context, url string) string
+}
+
+// WithHealthChecker checks the destination of every created link, and of
+// every link whose URL changes, in the background and records the result in
+// the link's health status
+func WithHealthChecker(checker HealthChecker) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.health = checker
+	}
+}
+
+// markHealthPending flags a link whose destination is about to be checked.
+// It returns false when checks are disabled or the link is a template.
+func (h *LinkHandler) markHealthPending(link *models.Link) bool {
+	if h.health == nil {
+		return false
+	}
+	// A template's destination only exists once its placeholders are filled
+	if link.IsTemplate() {
+		link.HealthStatus = ""
+		link.HealthCheckedAt = time.Time{}
+		return false
+	}
+	link.HealthStatus = models.HealthStatuses.Pending
+	link.HealthCheckedAt = time.Time{}
+	return true
+}
+
+// checkHealthAsync checks the link's current destination in the background.
+// The result is dropped if the URL has changed in the meantime, since the
+// change scheduled a check of its own.
+func (h *LinkHandler) checkHealthAsync(short, url string) {
+	h.goBackground(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		defer cancel()
+
+		status := h.health.Check(ctx, url)
+
+		link, err := h.repo.GetByShort(ctx, short)
+		if err != nil {
+			logger.Warn("Link disappeared before its health check finished", logger.Fields{
+				"short": short,
+				"error": err.Error(),
+			})
+			return
+		}
+		if link.URL != url {
+			return
+		}
+
+		link.HealthStatus = status
+		link.HealthCheckedAt = time.Now()
+		err = h.repo.Update(ctx, link)
+		jobs.Record("link-health", err)
+		if err != nil {
+			logger.Error("Failed to record link health", err, logger.Fields{"job": "link-health", "short": short})
+			return
+		}
+
+		fields := logger.Fields{"short": short, "url": url, "status": status}
+		if status == models.HealthStatuses.Dead {
+			logger.Warn("Link destination is unreachable", fields)
+			return
+		}
+		logger.Info("Link destination checked", fields)
+	})
+}
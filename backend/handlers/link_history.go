@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// recordVersion stores the change from previous to current in the link's
+// history. Failing to record history does not fail the update itself.
+func (h *LinkHandler) recordVersion(ctx context.Context, previous, current *models.Link, userID string) {
+	if h.versions == nil {
+		return
+	}
+	version := models.NewLinkVersion(previous, current, userID)
+	if version == nil {
+		return
+	}
+	if err := h.versions.Create(ctx, version); err != nil {
+		logger.Error("Failed to record link version", err, logger.Fields{
+			"short":  current.Short,
+			"userID": userID,
+		})
+	}
+}
+
+// historyLink loads the link for a history request and checks that the caller
+// may see its history. Like edits, history is limited to the creator and
+// admins. It writes the error response and returns nil on failure.
+func (h *LinkHandler) historyLink(w http.ResponseWriter, r *http.Request, ctx context.Context, short, userID string) *models.Link {
+	if h.versions == nil {
+		http.Error(w, "Link history is not enabled", http.StatusNotImplemented)
+		return nil
+	}
+
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return nil
+	}
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the creator or an admin can view or roll back this link's history", http.StatusForbidden)
+		logger.Warn("Unauthorized link history access", logger.Fields{
+			"short":       short,
+			"requestUser": userID,
+			"creatorUser": link.CreatedBy,
+		})
+		return nil
+	}
+	return link
+}
+
+// GetLinkHistory handles GET /api/links/{short}/history requests, listing the
+// link's recorded changes newest first
+func (h *LinkHandler) GetLinkHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/history")
+	userID, _ := getUserFromContext(r)
+
+	ctx := readContext(r)
+	if h.historyLink(w, r, ctx, short, userID) == nil {
+		return
+	}
+
+	versions, err := h.versions.ListByShort(ctx, short)
+	if err != nil {
+		http.Error(w, "Failed to get link history", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve link history", err, logger.Fields{"short": short})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// RollbackLink handles POST /api/links/{short}/rollback requests. The body
+// names a version, and the link is returned to how it was before that change.
+// The rollback is itself recorded as a new version, so it can be undone too.
+func (h *LinkHandler) RollbackLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/rollback")
+	userID, _ := getUserFromContext(r)
+
+	var requestBody struct {
+		Version int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Version < 1 {
+		http.Error(w, "Request body must name a version to roll back", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	link := h.historyLink(w, r, ctx, short, userID)
+	if link == nil {
+		return
+	}
+
+	version, err := h.versions.Get(ctx, short, requestBody.Version)
+	if err != nil || version.Previous == nil {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	previous := link.Clone()
+	link.RevertTo(version.Previous)
+	if link.URL != previous.URL {
+		link.Rollout = nil
+	}
+	checkHealth := link.URL != previous.URL && h.markHealthPending(link)
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to roll back link", http.StatusInternalServerError)
+		logger.Error("Failed to roll back link", err, logger.Fields{
+			"short":   short,
+			"version": requestBody.Version,
+		})
+		return
+	}
+
+	logger.Info("Link rolled back", logger.Fields{
+		"short":   short,
+		"userID":  userID,
+		"version": requestBody.Version,
+	})
+	h.recordVersion(ctx, previous, link, userID)
+	h.publishEvent(models.WebhookEvents.LinkUpdated, link, userID)
+	if checkHealth {
+		h.checkHealthAsync(short, link.URL)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(viewLink(r, link)); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
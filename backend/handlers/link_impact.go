@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+const (
+	// recentTrafficWindow is how recently a link must have been followed for
+	// its deletion to need confirmation
+	recentTrafficWindow = 30 * 24 * time.Hour
+	// maxImpactDocuments bounds the referencing documents listed in a
+	// deletion warning
+	maxImpactDocuments = 10
+)
+
+// DeletionImpact describes who would notice a link disappearing. References
+// lists the most frequent referencing documents, up to maxImpactDocuments.
+type DeletionImpact struct {
+	LastClickedAt   time.Time               `json:"last_clicked_at,omitzero"`
+	References      []*models.LinkReference `json:"references"`
+	ClickCount      int                     `json:"click_count"`
+	Documents       int                     `json:"documents"`
+	TotalReferences int                     `json:"total_references"`
+	RecentlyClicked bool                    `json:"recently_clicked"`
+}
+
+// significant reports whether deleting the link needs explicit confirmation
+func (i DeletionImpact) significant() bool {
+	return i.RecentlyClicked || i.Documents > 0
+}
+
+// deletionImpact gathers the traffic and references of a link about to be
+// deleted. References are left out when they cannot be loaded, so a failing
+// reference store never blocks deletes.
+func (h *LinkHandler) deletionImpact(ctx context.Context, link *models.Link) DeletionImpact {
+	impact := DeletionImpact{
+		LastClickedAt:   link.LastClickedAt,
+		References:      []*models.LinkReference{},
+		ClickCount:      link.ClickCount,
+		RecentlyClicked: !link.LastClickedAt.IsZero() && time.Since(link.LastClickedAt) < recentTrafficWindow,
+	}
+	if h.references == nil {
+		return impact
+	}
+
+	refs, err := h.references.ListByShort(ctx, link.Short)
+	if err != nil {
+		logger.Error("Failed to load link references for deletion impact", err, logger.Fields{"short": link.Short})
+		return impact
+	}
+	impact.Documents = len(refs)
+	for _, ref := range refs {
+		impact.TotalReferences += ref.Count
+	}
+	impact.References = refs[:min(len(refs), maxImpactDocuments)]
+	return impact
+}
+
+// respondDeletionImpact writes the 409 challenge returned when a link in use
+// is deleted without the force flag
+func respondDeletionImpact(w http.ResponseWriter, short string, impact DeletionImpact) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": middleware.APIError{
+			Code:    "DELETE_CONFIRMATION_REQUIRED",
+			Message: fmt.Sprintf("Link '%s' is still in use; repeat the request with force=true to delete it", short),
+		},
+		"impact": impact,
+	}); err != nil {
+		logger.Error("Failed to encode deletion impact", err, nil)
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// maxShortCodeSegments is the most slash-separated segments a short code has
+const maxShortCodeSegments = 3
+
+// resolvePath finds the link a request path such as "jira/PROJ-1" refers to:
+// the longest leading run of segments that names a link or alias. The
+// remaining segments are returned for template placeholders or passthrough.
+func (h *LinkHandler) resolvePath(ctx context.Context, path string) (*models.Link, []string, error) {
+	segments := strings.Split(path, "/")
+	var err error
+	for n := min(len(segments), maxShortCodeSegments); n >= 1; n-- {
+		var link *models.Link
+		link, err = h.lookupLink(ctx, strings.Join(segments[:n], "/"))
+		if err == nil {
+			return link, segments[n:], nil
+		}
+		if !errors.Is(err, errors.ErrNotFound) {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, err
+}
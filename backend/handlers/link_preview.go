@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+)
+
+// previewTimeout bounds fetching a destination for a preview
+const previewTimeout = 15 * time.Second
+
+// PreviewFetcher fetches the metadata of a destination page, such as its
+// title and favicon, for rendering rich cards
+type PreviewFetcher interface {
+	Preview(ctx context.Context, url string) (*models.LinkPreview, error)
+}
+
+// WithPreviewFetcher enables the link preview endpoint. Without a fetcher it
+// is unavailable.
+func WithPreviewFetcher(fetcher PreviewFetcher) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.previews = fetcher
+	}
+}
+
+// GetLinkPreview handles GET /api/links/{short}/preview requests, returning
+// the Open Graph metadata of the link's destination so the frontend can
+// render a rich card. Anyone who can follow the link may preview it.
+func (h *LinkHandler) GetLinkPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.previews == nil {
+		http.Error(w, "Link previews are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/preview")
+	userID, _ := getUserFromContext(r)
+
+	link, err := h.lookupLink(readContext(r), short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if !link.CanAccessAs(userID, groups.FromContext(r.Context())) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+	if link.IsArchived() {
+		http.Error(w, "Link has been archived", http.StatusGone)
+		return
+	}
+	if link.IsLinkExpired() {
+		http.Error(w, "Link has expired", http.StatusGone)
+		return
+	}
+	// A template's destination only exists once its placeholders are filled
+	if link.IsTemplate() {
+		middleware.RespondWithError(w, http.StatusUnprocessableEntity, "TEMPLATE_LINK", "Templated links have no single destination to preview")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), previewTimeout)
+	defer cancel()
+	preview, err := h.previews.Preview(ctx, link.URL)
+	if err != nil {
+		logger.Warn("Failed to fetch link preview", logger.Fields{
+			"short": link.Short,
+			"url":   link.URL,
+			"error": err.Error(),
+		})
+		middleware.RespondWithError(w, http.StatusBadGateway, "PREVIEW_UNAVAILABLE", "The link's destination could not be previewed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"short":   link.Short,
+		"preview": preview,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+)
+
+const (
+	// maxReferencesPerDocument bounds the links one document report may name
+	maxReferencesPerDocument = 400
+	// maxReferenceSourceLength bounds the indexer name stored with references
+	maxReferenceSourceLength = 100
+)
+
+// WithReferenceStore records where links are referenced, as reported by
+// external indexers. Without a store the reference endpoints are unavailable.
+func WithReferenceStore(store interfaces.LinkReferenceStore) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.references = store
+	}
+}
+
+// ReportReferences handles POST /api/hooks/references requests from external
+// indexers. Each request reports every go-link one document mentions, with
+// how often, and replaces what was previously reported for that document:
+//
+//	{"source": "wiki", "document_url": "https://wiki.example.com/Onboarding", "references": {"docs": 2}}
+//
+// Requests are authenticated by webhook signature rather than a user session.
+func (h *LinkHandler) ReportReferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.references == nil {
+		http.Error(w, "Link references are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var requestBody struct {
+		References  map[string]int `json:"references"`
+		Source      string         `json:"source"`
+		DocumentURL string         `json:"document_url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	documentURL := strings.TrimSpace(requestBody.DocumentURL)
+	if u, err := url.Parse(documentURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "document_url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	source := strings.TrimSpace(requestBody.Source)
+	if source == "" || len(source) > maxReferenceSourceLength {
+		http.Error(w, fmt.Sprintf("source is required and must be at most %d characters", maxReferenceSourceLength), http.StatusBadRequest)
+		return
+	}
+	if len(requestBody.References) > maxReferencesPerDocument {
+		http.Error(w, fmt.Sprintf("A document may report at most %d links", maxReferencesPerDocument), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	refs := make([]*models.LinkReference, 0, len(requestBody.References))
+	for short, count := range requestBody.References {
+		if !shortCodePattern.MatchString(short) {
+			http.Error(w, fmt.Sprintf("Invalid short code '%s'", short), http.StatusBadRequest)
+			return
+		}
+		// A zero count reports that the document no longer mentions the link
+		if count <= 0 {
+			continue
+		}
+		refs = append(refs, &models.LinkReference{
+			ReportedAt:  now,
+			Short:       short,
+			DocumentURL: documentURL,
+			Source:      source,
+			Count:       count,
+		})
+	}
+
+	if err := h.references.ReplaceDocument(context.Background(), documentURL, refs); err != nil {
+		http.Error(w, "Failed to store link references", http.StatusInternalServerError)
+		logger.Error("Failed to store link references", err, logger.Fields{
+			"document": documentURL,
+			"source":   source,
+		})
+		return
+	}
+
+	logger.Info("Link references reported", logger.Fields{
+		"document": documentURL,
+		"source":   source,
+		"links":    len(refs),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"document_url": documentURL,
+		"links":        len(refs),
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GetLinkReferences handles GET /api/links/{short}/references requests,
+// listing the documents that mention a link so its owner can judge the impact
+// of changing or deleting it. Anyone who can follow the link may see them.
+func (h *LinkHandler) GetLinkReferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.references == nil {
+		http.Error(w, "Link references are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/references")
+	userID, _ := getUserFromContext(r)
+
+	ctx := readContext(r)
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if !link.CanAccessAs(userID, groups.FromContext(ctx)) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	refs, err := h.references.ListByShort(ctx, short)
+	if err != nil {
+		http.Error(w, "Failed to get link references", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve link references", err, logger.Fields{"short": short})
+		return
+	}
+	total := 0
+	for _, ref := range refs {
+		total += ref.Count
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"short":            short,
+		"documents":        len(refs),
+		"total_references": total,
+		"references":       refs,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
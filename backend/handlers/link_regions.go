@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/region"
+)
+
+// maxRegionalURLs bounds how many regional destinations a link has
+const maxRegionalURLs = 20
+
+// regionalRedirects counts redirects sent to a regional destination
+var regionalRedirects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "golink_regional_redirects_total",
+	Help: "Total number of redirects sent to a link's regional destination",
+}, []string{"region"})
+
+// WithRegionResolver decides the region of each redirect, which sends
+// visitors to the link's destination for their region and labels their
+// click in the link statistics
+func WithRegionResolver(resolver region.Resolver) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.regions = resolver
+	}
+}
+
+// clientRegion returns the region the request is served for, or "" when
+// regions are not configured or the region is not known
+func (h *LinkHandler) clientRegion(r *http.Request) string {
+	if h.regions == nil {
+		return ""
+	}
+	return h.regions.Region(r, h.clientCountry(r))
+}
+
+// clientCountry returns the country of the client, preferring the GeoIP
+// database over the proxy's country header
+func (h *LinkHandler) clientCountry(r *http.Request) string {
+	if h.geoip != nil {
+		if loc, ok := h.geoip.Lookup(net.ParseIP(auth.ClientIP(r))); ok {
+			return loc.Country
+		}
+	}
+	return requestCountry(r)
+}
+
+// normalizeRegionalURLs validates the regional destinations of a link like
+// its URL, keyed by region name. An invalid map is answered with 400 and ok
+// is false.
+func (h *LinkHandler) normalizeRegionalURLs(w http.ResponseWriter, raw map[string]string, short string) (regional map[string]string, ok bool) {
+	if len(raw) == 0 {
+		return nil, true
+	}
+	if len(raw) > maxRegionalURLs {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_REGIONAL_URLS",
+			fmt.Sprintf("A link has at most %d regional URLs", maxRegionalURLs))
+		return nil, false
+	}
+	regional = make(map[string]string, len(raw))
+	for name, url := range raw {
+		normalized := region.Normalize(name)
+		if normalized == "" {
+			middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_REGIONAL_URLS",
+				fmt.Sprintf("Invalid region name '%s'", name))
+			return nil, false
+		}
+		url = h.urlNormalizer.Normalize(url)
+		if h.rejectTargetURL(w, url, short) {
+			return nil, false
+		}
+		regional[normalized] = url
+	}
+	return regional, true
+}
+
+// regionalDestination returns the link to redirect a visitor from the given
+// region to: a copy pointing at the link's destination for that region, or
+// the link itself when it has none. A rollout's canary is never replaced.
+func regionalDestination(destination *models.Link, variant, clientRegion string) (*models.Link, bool) {
+	url, ok := destination.RegionalURLs[clientRegion]
+	if !ok || clientRegion == "" || variant == models.RolloutVariants.Canary {
+		return destination, false
+	}
+	regional := destination.Clone()
+	regional.URL = url
+	return regional, true
+}
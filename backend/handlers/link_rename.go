@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/webhook"
+)
+
+// HandleLinkRename handles POST /api/links/{short}/rename requests with a body
+// such as {"short": "new-code"}. The link keeps its ID, settings and
+// statistics under the new short code, and its history, snapshots and click
+// stream follow it. With an alias store the old code becomes an alias of the
+// new one and the link's aliases follow it, so existing references keep
+// working. Adding {"deprecation": {"mode", "message"}} tells visitors of the
+// old code about the new one, as for a deprecated link. Only the owner or an
+// admin may rename a link.
+func (h *LinkHandler) HandleLinkRename(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/rename")
+	var requestBody struct {
+		Deprecation *models.LinkDeprecation `json:"deprecation"`
+		Short       string                  `json:"short"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	newShort := strings.TrimSpace(requestBody.Short)
+	if !shortCodePattern.MatchString(newShort) {
+		http.Error(w, "Short code must contain only letters, numbers, and hyphens, in at most three slash-separated segments", http.StatusBadRequest)
+		return
+	}
+	if h.isReservedShortCode(newShort) {
+		middleware.RespondWithError(w, http.StatusBadRequest, "SHORT_CODE_RESERVED",
+			fmt.Sprintf("Short code '%s' is reserved", newShort))
+		return
+	}
+	notice := requestBody.Deprecation
+	if notice != nil && h.aliases == nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_DEPRECATION",
+			"The old short code can only show a notice when link aliases are enabled")
+		return
+	}
+	if notice != nil {
+		notice.Message = strings.TrimSpace(notice.Message)
+		if notice.Mode != "" && !models.IsDeprecationMode(notice.Mode) {
+			middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_DEPRECATION",
+				fmt.Sprintf("mode must be '%s' or '%s'", models.DeprecationModes.Notice, models.DeprecationModes.Redirect))
+			return
+		}
+		if len(notice.Message) > models.MaxDeprecationMessageLength {
+			middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_DEPRECATION",
+				fmt.Sprintf("message must be at most %d characters", models.MaxDeprecationMessageLength))
+			return
+		}
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := context.Background()
+
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the owner or an admin can rename this link", http.StatusForbidden)
+		logger.Warn("Unauthorized link rename", logger.Fields{
+			"short":       link.Short,
+			"requestUser": userID,
+			"ownerUser":   link.CreatedBy,
+		})
+		return
+	}
+	if newShort == link.Short {
+		http.Error(w, "The link already has this short code", http.StatusBadRequest)
+		return
+	}
+	if h.rejectNamespace(ctx, w, newShort, userID) {
+		return
+	}
+
+	// An alias of the link itself may become its short code; other aliases
+	// keep theirs
+	ownAlias := false
+	if h.aliases != nil {
+		alias, err := h.aliases.Get(ctx, newShort)
+		if err == nil && alias.Short != link.Short {
+			http.Error(w, "Short code already exists", http.StatusConflict)
+			return
+		}
+		ownAlias = err == nil
+	}
+
+	renamed, err := h.repo.Rename(ctx, link.Short, newShort)
+	if err != nil {
+		if errors.Is(err, errors.ErrAlreadyExists) {
+			http.Error(w, "Short code already exists", http.StatusConflict)
+			return
+		}
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+	h.moveHistory(ctx, link.Short, newShort)
+	if h.aliases != nil {
+		h.moveAliases(ctx, link.Short, newShort, ownAlias, notice, userID)
+	}
+
+	logger.Info("Link renamed", logger.Fields{
+		"id":       renamed.ID,
+		"short":    link.Short,
+		"newShort": renamed.Short,
+		"userID":   userID,
+	})
+	if h.webhooks != nil {
+		event := webhook.NewEvent(models.WebhookEvents.LinkRenamed, renamed.Clone(), userID)
+		event.PreviousShort = link.Short
+		h.webhooks.Publish(event)
+	}
+	respondLink(w, r, http.StatusOK, renamed)
+}
+
+// moveHistory files the history, snapshots and click stream of a renamed
+// link under its new short code. The link is renamed by then, so failures are
+// logged rather than failing the request.
+func (h *LinkHandler) moveHistory(ctx context.Context, short, newShort string) {
+	fields := logger.Fields{"short": short, "newShort": newShort}
+	if h.versions != nil {
+		if err := h.versions.MoveShort(ctx, short, newShort); err != nil {
+			logger.Error("Failed to move history of renamed link", err, fields)
+		}
+	}
+	if h.snapshots != nil {
+		if err := h.snapshots.MoveShort(ctx, short, newShort); err != nil {
+			logger.Error("Failed to move snapshots of renamed link", err, fields)
+		}
+	}
+	if h.clickStream != nil {
+		if err := h.clickStream.MoveShort(ctx, short, newShort); err != nil {
+			logger.Error("Failed to move click stream of renamed link", err, fields)
+		}
+	}
+}
+
+// moveAliases points the aliases of a renamed link at its new short code and
+// keeps the old one as an alias, with notice if given. Aliases that are old
+// codes of the link keep telling their visitors about its current one.
+// Failures are logged rather than failing the request, like in moveHistory.
+func (h *LinkHandler) moveAliases(ctx context.Context, short, newShort string, ownAlias bool, notice *models.LinkDeprecation, userID string) {
+	fields := logger.Fields{"short": short, "newShort": newShort}
+	if ownAlias {
+		if err := h.aliases.Delete(ctx, newShort); err != nil {
+			logger.Error("Failed to delete alias that became the short code", err, fields)
+		}
+	}
+
+	aliases, err := h.aliases.ListByShort(ctx, short)
+	if err != nil {
+		logger.Error("Failed to retrieve aliases of renamed link", err, fields)
+		aliases = nil
+	}
+	now := time.Now()
+	old := &models.LinkAlias{CreatedAt: now, Alias: short, CreatedBy: userID}
+	if notice != nil {
+		old.Deprecation = notice
+		old.Deprecation.DeprecatedAt = now
+		old.Deprecation.DeprecatedBy = userID
+		if old.Deprecation.Mode == "" {
+			old.Deprecation.Mode = models.DeprecationModes.Notice
+		}
+	}
+	moved := []*models.LinkAlias{old}
+	for _, alias := range aliases {
+		if alias.Alias == newShort {
+			continue
+		}
+		if err := h.aliases.Delete(ctx, alias.Alias); err != nil {
+			logger.Error("Failed to move alias of renamed link", err, logger.Fields{"short": short, "alias": alias.Alias})
+			continue
+		}
+		moved = append(moved, alias)
+	}
+	for _, alias := range moved {
+		alias.Short = newShort
+		if alias.Deprecation != nil {
+			alias.Deprecation.Successor = newShort
+		}
+		if err := h.aliases.Create(ctx, alias); err != nil {
+			logger.Error("Failed to move alias of renamed link", err, logger.Fields{"short": newShort, "alias": alias.Alias})
+		}
+	}
+}
+
+// renamedAlias returns the alias a redirect for path came through, given the
+// link and the segments after its code, when it is an old short code of the
+// link that tells its visitors about the current one
+func (h *LinkHandler) renamedAlias(ctx context.Context, path string, extra []string, link *models.Link) *models.LinkAlias {
+	if h.aliases == nil {
+		return nil
+	}
+	segments := strings.Split(path, "/")
+	code := strings.Join(segments[:len(segments)-len(extra)], "/")
+	if code == link.Short {
+		return nil
+	}
+	alias, err := h.aliases.Get(ctx, code)
+	if err != nil || alias.Deprecation == nil {
+		return nil
+	}
+	return alias
+}
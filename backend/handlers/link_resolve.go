@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/usage"
+)
+
+// maxResolveShorts bounds how many short codes one resolve request may name
+const maxResolveShorts = 100
+
+// Statuses of an individual short code in a resolve response
+const (
+	ResolveStatusOK        = "ok"
+	ResolveStatusNotFound  = "not_found"
+	ResolveStatusForbidden = "forbidden"
+	ResolveStatusExpired   = "expired"
+	ResolveStatusArchived  = "archived"
+)
+
+// ResolvedLink is the outcome of resolving one short code. The destination
+// and metadata are only included when the caller may follow the link.
+type ResolvedLink struct {
+	Short       string `json:"short"`
+	Status      string `json:"status"`
+	URL         string `json:"url,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ResolveLinks handles POST /api/links/resolve requests. It resolves up to
+// maxResolveShorts short codes in one call, applying the same access rules as
+// a redirect to each of them, so tooling can expand every go-link in a
+// document at once. Results are returned in request order without duplicates.
+func (h *LinkHandler) ResolveLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		logger.Warn("Method not allowed for resolve links", logger.Fields{"method": r.Method})
+		return
+	}
+
+	var requestBody struct {
+		Shorts []string `json:"shorts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		logger.Error("Failed to decode resolve request body", err, nil)
+		return
+	}
+
+	shorts := make([]string, 0, len(requestBody.Shorts))
+	seen := make(map[string]bool, len(requestBody.Shorts))
+	for _, short := range requestBody.Shorts {
+		short = strings.TrimSpace(short)
+		if short == "" || seen[short] {
+			continue
+		}
+		seen[short] = true
+		shorts = append(shorts, short)
+	}
+	if len(shorts) == 0 {
+		middleware.RespondWithError(w, http.StatusBadRequest, "SHORTS_REQUIRED", "At least one short code is required")
+		return
+	}
+	if len(shorts) > maxResolveShorts {
+		middleware.RespondWithError(w, http.StatusBadRequest, "TOO_MANY_SHORTS",
+			fmt.Sprintf("At most %d short codes can be resolved at once", maxResolveShorts))
+		return
+	}
+	h.recordUsage(r, usage.EventBulkResolve)
+
+	userID, _ := getUserFromContext(r)
+	ctx := readContext(r)
+
+	results := make([]ResolvedLink, 0, len(shorts))
+	for _, short := range shorts {
+		results = append(results, h.resolveLink(ctx, short, userID))
+	}
+
+	logger.Info("Resolved links", logger.Fields{
+		"userID": userID,
+		"count":  len(results),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"results": results}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// resolveLink resolves a single short code for userID
+func (h *LinkHandler) resolveLink(ctx context.Context, short, userID string) ResolvedLink {
+	result := ResolvedLink{Short: short}
+
+	link, extra, err := h.resolvePath(ctx, short)
+	if err != nil {
+		result.Status = ResolveStatusNotFound
+		return result
+	}
+	if !link.CanAccessAs(userID, groups.FromContext(ctx)) {
+		result.Status = ResolveStatusForbidden
+		return result
+	}
+	if link.IsArchived() {
+		result.Status = ResolveStatusArchived
+		return result
+	}
+	if link.IsLinkExpired() || link.ClickLimitReached() {
+		result.Status = ResolveStatusExpired
+		return result
+	}
+
+	result.Status = ResolveStatusOK
+	result.URL = link.URL
+	// A template without its values resolves to the template itself
+	if target, err := link.ResolveURL(extra, ""); err == nil {
+		result.URL = target
+	}
+	result.Title = link.Title
+	result.Description = link.Description
+	return result
+}
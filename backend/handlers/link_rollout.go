@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+)
+
+// RolloutStatus is a link's rollout together with where it stands now
+type RolloutStatus struct {
+	*models.LinkRollout
+	PrimaryURL string `json:"primary_url"`
+	Percent    int    `json:"percent"`
+	Complete   bool   `json:"complete"`
+}
+
+// newRolloutStatus describes the link's rollout at now
+func newRolloutStatus(link *models.Link, now time.Time) RolloutStatus {
+	percent := link.Rollout.PercentAt(now)
+	return RolloutStatus{
+		LinkRollout: link.Rollout,
+		PrimaryURL:  link.URL,
+		Percent:     percent,
+		Complete:    percent == 100,
+	}
+}
+
+// HandleLinkRollout handles /api/links/{short}/rollout requests:
+//
+//	GET    shows the rollout, the share of traffic it currently receives and clicks per variant
+//	PUT    starts a rollout or changes its schedule
+//	DELETE rolls back at once, sending all traffic to the link's URL again
+//
+// A PUT body names the new destination and either a schedule or a single
+// percentage that applies immediately:
+//
+//	{"url": "https://new.example.com", "steps": [{"at": "2026-05-01T09:00:00Z", "percent": 10}, {"at": "2026-05-08T09:00:00Z", "percent": 100}]}
+//	{"url": "https://new.example.com", "percent": 50}
+//
+// The rollout ends when the owner sets the link's URL, typically to the new
+// destination once it receives all traffic.
+func (h *LinkHandler) HandleLinkRollout(w http.ResponseWriter, r *http.Request) {
+	short := strings.TrimSuffix(r.URL.Path[len("/api/links/"):], "/rollout")
+	userID, _ := getUserFromContext(r)
+	ctx := groups.Inherit(context.Background(), r.Context())
+
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !link.CanAccessAs(userID, groups.FromContext(ctx)) {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		if link.Rollout == nil {
+			http.Error(w, "Link has no rollout", http.StatusNotFound)
+			return
+		}
+		respondRollout(w, link)
+	case http.MethodPut:
+		if h.rejectRolloutChange(w, link, userID) {
+			return
+		}
+		h.startRollout(w, r, ctx, link, userID)
+	case http.MethodDelete:
+		if h.rejectRolloutChange(w, link, userID) {
+			return
+		}
+		h.rollBackRollout(w, r, ctx, link, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// rejectRolloutChange writes a 403 response and returns true unless userID
+// may change the link's rollout. Like edits, that is limited to the creator.
+func (h *LinkHandler) rejectRolloutChange(w http.ResponseWriter, link *models.Link, userID string) bool {
+	if !auth.IsAuthEnabled() || link.CreatedBy == userID {
+		return false
+	}
+	http.Error(w, "Only the creator can change this link's rollout", http.StatusForbidden)
+	logger.Warn("Unauthorized rollout change", logger.Fields{
+		"short":       link.Short,
+		"requestUser": userID,
+		"creatorUser": link.CreatedBy,
+	})
+	return true
+}
+
+// startRollout starts a rollout or replaces its schedule. Click counts are
+// kept while the destination stays the same.
+func (h *LinkHandler) startRollout(w http.ResponseWriter, r *http.Request, ctx context.Context, link *models.Link, userID string) {
+	var requestBody struct {
+		Percent *int                 `json:"percent,omitempty"`
+		URL     string               `json:"url"`
+		Steps   []models.RolloutStep `json:"steps,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	target := h.urlNormalizer.Normalize(requestBody.URL)
+	if target == "" {
+		middleware.RespondWithError(w, http.StatusBadRequest, "ROLLOUT_URL_REQUIRED", "The new destination URL is required")
+		return
+	}
+	if h.rejectTargetURL(w, target, link.Short) {
+		return
+	}
+	if target == link.URL {
+		middleware.RespondWithError(w, http.StatusBadRequest, "ROLLOUT_URL_UNCHANGED", "The new destination must differ from the link's URL")
+		return
+	}
+
+	now := time.Now()
+	steps := requestBody.Steps
+	if requestBody.Percent != nil {
+		if len(steps) > 0 {
+			middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_ROLLOUT_SCHEDULE", "Give either a percentage or a schedule, not both")
+			return
+		}
+		steps = []models.RolloutStep{{At: now, Percent: *requestBody.Percent}}
+	}
+	if err := validateRolloutSteps(steps); err != nil {
+		middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_ROLLOUT_SCHEDULE", err.Error())
+		return
+	}
+
+	rollout := &models.LinkRollout{
+		StartedAt: now,
+		URL:       target,
+		StartedBy: userID,
+		Steps:     steps,
+	}
+	if link.Rollout != nil && link.Rollout.URL == target {
+		rollout.StartedAt = link.Rollout.StartedAt
+		rollout.StartedBy = link.Rollout.StartedBy
+		rollout.PrimaryClicks = link.Rollout.PrimaryClicks
+		rollout.CanaryClicks = link.Rollout.CanaryClicks
+	}
+	link.Rollout = rollout
+
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to save rollout", http.StatusInternalServerError)
+		logger.Error("Failed to save link rollout", err, logger.Fields{"short": link.Short})
+		return
+	}
+
+	logger.Info("Link rollout scheduled", logger.Fields{
+		"short":  link.Short,
+		"userID": userID,
+		"url":    target,
+		"steps":  len(steps),
+	})
+	respondRollout(w, link)
+}
+
+// rollBackRollout removes the rollout, sending all traffic to the link's URL
+func (h *LinkHandler) rollBackRollout(w http.ResponseWriter, r *http.Request, ctx context.Context, link *models.Link, userID string) {
+	if link.Rollout == nil {
+		http.Error(w, "Link has no rollout", http.StatusNotFound)
+		return
+	}
+
+	rollout := link.Rollout
+	link.Rollout = nil
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to roll back rollout", http.StatusInternalServerError)
+		logger.Error("Failed to roll back link rollout", err, logger.Fields{"short": link.Short})
+		return
+	}
+
+	logger.Info("Link rollout rolled back", logger.Fields{
+		"short":         link.Short,
+		"userID":        userID,
+		"url":           rollout.URL,
+		"canaryClicks":  rollout.CanaryClicks,
+		"primaryClicks": rollout.PrimaryClicks,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(viewLink(r, link)); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// validateRolloutSteps checks that a schedule only ever sends more traffic to
+// the new destination, in steps of 1 to 100 percent
+func validateRolloutSteps(steps []models.RolloutStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("a rollout needs a percentage or at least one step")
+	}
+	if len(steps) > models.MaxRolloutSteps {
+		return fmt.Errorf("a rollout has at most %d steps", models.MaxRolloutSteps)
+	}
+	for i, step := range steps {
+		if step.At.IsZero() {
+			return fmt.Errorf("step %d needs a time", i+1)
+		}
+		if step.Percent < 1 || step.Percent > 100 {
+			return fmt.Errorf("step %d must send between 1 and 100 percent of traffic", i+1)
+		}
+		if i > 0 && (!step.At.After(steps[i-1].At) || step.Percent <= steps[i-1].Percent) {
+			return fmt.Errorf("step %d must come after step %d and send more traffic", i+1, i)
+		}
+	}
+	return nil
+}
+
+// respondRollout writes the link's rollout status
+func respondRollout(w http.ResponseWriter, link *models.Link) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newRolloutStatus(link, time.Now())); err != nil {
+		logger.Error("Failed to encode rollout", err, logger.Fields{"short": link.Short})
+	}
+}
+
+// rolloutDestination picks the variant of the link the request is sent to.
+// Signed-in visitors are bucketed by user, others by client IP. It returns
+// the link unchanged and no variant when the link has no rollout.
+func rolloutDestination(r *http.Request, link *models.Link, userID string) (*models.Link, string) {
+	if link.Rollout == nil {
+		return link, ""
+	}
+	key := userID
+	if key == "" {
+		key = auth.ClientIP(r)
+	}
+	variant := link.Rollout.Variant(link.Short, key, time.Now())
+	if variant == models.RolloutVariants.Primary {
+		return link, variant
+	}
+	canary := link.Clone()
+	canary.URL = link.Rollout.URL
+	return canary, variant
+}
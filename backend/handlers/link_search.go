@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+	"github.com/Okabe-Junya/golink-backend/pkg/usage"
+)
+
+const (
+	// defaultSearchLimit and maxSearchLimit bound the results of one search
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	// personalBoostWeight scales the boost a user's own clicks give a result
+	// relative to its overall popularity
+	personalBoostWeight = 2
+)
+
+// Match scores of a link for a search query, best first
+const (
+	matchExact       = 8
+	matchPrefix      = 4
+	matchShortCode   = 2
+	matchDescription = 1
+)
+
+// WithClickHistory records which links each signed-in user follows and boosts
+// them in that user's search results. Clicks older than retention no longer
+// count; zero keeps them until the cleanup job removes them. Requests that
+// send "DNT: 1" or "Sec-GPC: 1" are not recorded.
+func WithClickHistory(store interfaces.UserClickStore, retention time.Duration) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.clickHistory = store
+		h.historyRetention = retention
+	}
+}
+
+// SearchResult is a link matching a search query
+type SearchResult struct {
+	Short       string  `json:"short"`
+	URL         string  `json:"url"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Score       float64 `json:"score"`
+	// Personalized reports whether the caller's own clicks raised the score
+	Personalized bool `json:"personalized"`
+}
+
+// SearchLinks handles GET /api/links/search?q=...&limit=... requests for
+// search and autocomplete. Links the caller can follow are matched against
+// their short code, title and description and ranked by how well they match,
+// how popular they are and how often the caller follows them, so that
+// "dash" suggests the dashboard the caller actually uses. An empty query
+// ranks every link.
+func (h *LinkHandler) SearchLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	limit := defaultSearchLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 || n > maxSearchLimit {
+			middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest,
+				"limit must be between 1 and "+strconv.Itoa(maxSearchLimit))
+			return
+		}
+		limit = n
+	}
+	selection, ok := selectFields(w, r, searchResultFields)
+	if !ok {
+		return
+	}
+	h.recordUsage(r, usage.EventSearch)
+
+	userID, _ := getUserFromContext(r)
+	ctx := readContext(r)
+
+	links, err := h.repo.GetAll(ctx)
+	if err != nil {
+		middleware.RespondWithError(w, http.StatusInternalServerError, middleware.ErrInternalServerError, "Failed to search links")
+		logger.Error("Failed to load links for search", err, nil)
+		return
+	}
+
+	now := time.Now()
+	personal := h.personalWeights(ctx, userID, now)
+	results := []SearchResult{}
+	for _, link := range links {
+		if !link.CanAccessAs(userID, groups.FromContext(ctx)) || link.IsLinkExpired() || link.IsArchived() ||
+			!isDiscoverable(r, h.classification, link, userID) || h.sandbox.Contains(link.Short) {
+			continue
+		}
+		match := matchScore(link, query)
+		if match == 0 {
+			continue
+		}
+		result := SearchResult{
+			Short:       link.Short,
+			URL:         link.URL,
+			Title:       link.Title,
+			Description: link.Description,
+			Score:       float64(match) + math.Log1p(link.PopularityAt(now, h.halfLife)),
+		}
+		if weight := personal[link.Short]; weight > 0 {
+			result.Score += personalBoostWeight * math.Log1p(weight)
+			result.Personalized = true
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Short < results[j].Short
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	projected, err := selection.Apply(results)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"query":   query,
+		"results": projected,
+	}
+	// Links left out by the cap on the links a request loads were not searched
+	if linkcap.Truncated(ctx) {
+		response["truncated"] = true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// matchScore rates how well a link matches a lowercase query, or 0 if it
+// does not match at all
+func matchScore(link *models.Link, query string) int {
+	short := strings.ToLower(link.Short)
+	switch {
+	case query == "":
+		return matchDescription
+	case short == query:
+		return matchExact
+	case strings.HasPrefix(short, query):
+		return matchPrefix
+	case strings.Contains(short, query):
+		return matchShortCode
+	case strings.Contains(strings.ToLower(link.Title), query),
+		strings.Contains(strings.ToLower(link.Description), query):
+		return matchDescription
+	}
+	return 0
+}
+
+// personalWeights returns the decayed weight of the user's clicks per short
+// code, skipping clicks past the retention period. Search still works
+// without them if the history cannot be loaded.
+func (h *LinkHandler) personalWeights(ctx context.Context, userID string, now time.Time) map[string]float64 {
+	if h.clickHistory == nil || userID == anonymousUserID {
+		return nil
+	}
+	history, err := h.clickHistory.ListByUser(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to load click history for search", err, logger.Fields{"userID": userID})
+		return nil
+	}
+	weights := make(map[string]float64, len(history))
+	for _, entry := range history {
+		if h.historyRetention > 0 && now.Sub(entry.LastClickedAt) > h.historyRetention {
+			continue
+		}
+		weights[entry.Short] = entry.WeightAt(now, h.halfLife)
+	}
+	return weights
+}
+
+// recordUserClick adds a followed link to the user's click history in the
+// background, unless history is disabled or the client opted out of tracking
+func (h *LinkHandler) recordUserClick(r *http.Request, userID, short string) {
+	if h.clickHistory == nil || userID == anonymousUserID || r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1" {
+		return
+	}
+	at := time.Now()
+	h.goBackground(func() {
+		err := h.clickHistory.RecordClick(context.Background(), userID, short, at)
+		jobs.Record("click-history", err)
+		if err != nil {
+			logger.Error("Failed to record user click", err, logger.Fields{"job": "click-history", "short": short})
+		}
+	})
+}
+
+// HandleClickHistory handles /api/me/click-history requests, letting users
+// see (GET) and erase (DELETE) the click history that personalizes their
+// search results
+func (h *LinkHandler) HandleClickHistory(w http.ResponseWriter, r *http.Request) {
+	if h.clickHistory == nil {
+		http.Error(w, "Click history is not enabled", http.StatusNotImplemented)
+		return
+	}
+	userID, _ := getUserFromContext(r)
+	if userID == anonymousUserID {
+		middleware.RespondWithError(w, http.StatusUnauthorized, middleware.ErrUnauthorized, "Sign in to manage your click history")
+		return
+	}
+	ctx := context.Background()
+
+	switch r.Method {
+	case http.MethodGet:
+		history, err := h.clickHistory.ListByUser(ctx, userID)
+		if err != nil {
+			http.Error(w, "Failed to get click history", http.StatusInternalServerError)
+			logger.Error("Failed to retrieve click history", err, logger.Fields{"userID": userID})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"history":   history,
+			"retention": h.historyRetention.String(),
+		}); err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		}
+	case http.MethodDelete:
+		if err := h.clickHistory.DeleteByUser(ctx, userID); err != nil {
+			http.Error(w, "Failed to delete click history", http.StatusInternalServerError)
+			logger.Error("Failed to delete click history", err, logger.Fields{"userID": userID})
+			return
+		}
+		logger.Info("Click history deleted", logger.Fields{"userID": userID})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
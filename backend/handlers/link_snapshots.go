@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// maxSnapshotsPerLink bounds how many snapshots one link keeps; taking
+// another drops the oldest
+const maxSnapshotsPerLink = 20
+
+// maxSnapshotNameLength bounds the name of a snapshot
+const maxSnapshotNameLength = 100
+
+// WithSnapshotStore lets link owners save a link's configuration and restore
+// it later. Without a store the snapshot endpoints are unavailable.
+func WithSnapshotStore(store interfaces.LinkSnapshotStore) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.snapshots = store
+	}
+}
+
+// HandleLinkSnapshots handles /api/links/{short}/snapshot and
+// /api/links/{short}/snapshot/restore requests
+func (h *LinkHandler) HandleLinkSnapshots(w http.ResponseWriter, r *http.Request) {
+	if h.snapshots == nil {
+		http.Error(w, "Link snapshots are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	path := r.URL.Path[len("/api/links/"):]
+	restore := strings.HasSuffix(path, "/snapshot/restore")
+	short := strings.TrimSuffix(strings.TrimSuffix(path, "/restore"), "/snapshot")
+
+	switch {
+	case restore && r.Method == http.MethodPost:
+		h.restoreSnapshot(w, r, short)
+	case !restore && r.Method == http.MethodGet:
+		h.listSnapshots(w, r, short)
+	case !restore && r.Method == http.MethodPost:
+		h.createSnapshot(w, r, short)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		logger.Warn("Method not allowed for link snapshots", logger.Fields{"method": r.Method})
+	}
+}
+
+// snapshotLink loads the link for a snapshot request and checks that the
+// caller owns it or is an admin. It writes the error response and returns nil
+// on failure.
+func (h *LinkHandler) snapshotLink(w http.ResponseWriter, r *http.Request, ctx context.Context, short, userID string) *models.Link {
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return nil
+	}
+	if link.CreatedBy != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the creator or an admin can manage this link's snapshots", http.StatusForbidden)
+		logger.Warn("Unauthorized link snapshot access", logger.Fields{
+			"short":       short,
+			"requestUser": userID,
+			"creatorUser": link.CreatedBy,
+		})
+		return nil
+	}
+	return link
+}
+
+// listSnapshots lists a link's snapshots, newest first
+func (h *LinkHandler) listSnapshots(w http.ResponseWriter, r *http.Request, short string) {
+	userID, _ := getUserFromContext(r)
+	ctx := readContext(r)
+	if h.snapshotLink(w, r, ctx, short, userID) == nil {
+		return
+	}
+
+	snapshots, err := h.snapshots.ListByShort(ctx, short)
+	if err != nil {
+		http.Error(w, "Failed to get link snapshots", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve link snapshots", err, logger.Fields{"short": short})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshots); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// createSnapshot handles POST /api/links/{short}/snapshot requests, saving
+// the link's current configuration. The body may name the snapshot, as in
+// {"name": "before geo rules"}.
+func (h *LinkHandler) createSnapshot(w http.ResponseWriter, r *http.Request, short string) {
+	var requestBody struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(requestBody.Name)
+	if len(name) > maxSnapshotNameLength {
+		middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "Snapshot name is too long")
+		return
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := context.Background()
+	link := h.snapshotLink(w, r, ctx, short, userID)
+	if link == nil {
+		return
+	}
+
+	existing, err := h.snapshots.ListByShort(ctx, short)
+	if err != nil {
+		http.Error(w, "Failed to create link snapshot", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve link snapshots", err, logger.Fields{"short": short})
+		return
+	}
+
+	snapshot := models.NewLinkSnapshot(link, name, userID)
+	if err := h.snapshots.Create(ctx, snapshot); err != nil {
+		http.Error(w, "Failed to create link snapshot", http.StatusInternalServerError)
+		logger.Error("Failed to create link snapshot", err, logger.Fields{"short": short})
+		return
+	}
+
+	// Drop the oldest snapshots beyond the limit; a failure only leaves
+	// one too many
+	for i := maxSnapshotsPerLink - 1; i < len(existing); i++ {
+		if err := h.snapshots.Delete(ctx, short, existing[i].ID); err != nil {
+			logger.Error("Failed to delete old link snapshot", err, logger.Fields{
+				"short":    short,
+				"snapshot": existing[i].ID,
+			})
+		}
+	}
+
+	logger.Info("Link snapshot created", logger.Fields{
+		"short":    short,
+		"userID":   userID,
+		"snapshot": snapshot.ID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// restoreSnapshot handles POST /api/links/{short}/snapshot/restore requests.
+// The body may name a snapshot, as in {"id": 2}; without one the newest is
+// restored. The restore is recorded in the link's history like any edit.
+func (h *LinkHandler) restoreSnapshot(w http.ResponseWriter, r *http.Request, short string) {
+	var requestBody struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := context.Background()
+	link := h.snapshotLink(w, r, ctx, short, userID)
+	if link == nil {
+		return
+	}
+
+	snapshot, err := h.findSnapshot(ctx, short, requestBody.ID)
+	if err != nil {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	previous := link.Clone()
+	link.RestoreSnapshot(snapshot)
+	checkHealth := link.URL != previous.URL && h.markHealthPending(link)
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to restore link snapshot", http.StatusInternalServerError)
+		logger.Error("Failed to restore link snapshot", err, logger.Fields{
+			"short":    short,
+			"snapshot": snapshot.ID,
+		})
+		return
+	}
+
+	logger.Info("Link snapshot restored", logger.Fields{
+		"short":    short,
+		"userID":   userID,
+		"snapshot": snapshot.ID,
+	})
+	h.recordVersion(ctx, previous, link, userID)
+	h.publishEvent(models.WebhookEvents.LinkUpdated, link, userID)
+	if checkHealth {
+		h.checkHealthAsync(short, link.URL)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(viewLink(r, link)); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// findSnapshot returns the snapshot of a link with the given ID, or the
+// newest one when id is zero
+func (h *LinkHandler) findSnapshot(ctx context.Context, short string, id int) (*models.LinkSnapshot, error) {
+	if id != 0 {
+		return h.snapshots.Get(ctx, short, id)
+	}
+	snapshots, err := h.snapshots.ListByShort(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, errors.New("link has no snapshots")
+	}
+	return snapshots[0], nil
+}
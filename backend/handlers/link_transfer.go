@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// HandleLinkTransfer handles /api/links/{short}/transfer requests, which hand
+// a link over to another user so it is not orphaned when its owner leaves:
+//
+//   - POST {"to": "user"} offers the link to a user, who must accept it.
+//     Admins may pass "force": true to transfer it at once.
+//   - POST .../transfer/accept completes the offer; only the recipient may.
+//   - DELETE withdraws the offer (owner or admin) or declines it (recipient).
+func (h *LinkHandler) HandleLinkTransfer(w http.ResponseWriter, r *http.Request) {
+	rest := r.URL.Path[len("/api/links/"):]
+	accept := strings.HasSuffix(rest, "/transfer/accept")
+	short := strings.TrimSuffix(strings.TrimSuffix(rest, "/accept"), "/transfer")
+	userID, _ := getUserFromContext(r)
+	ctx := context.Background()
+
+	link, err := h.repo.GetByShort(ctx, short)
+	if err != nil {
+		respondRepositoryError(w, err, "Link not found", logger.Fields{"short": short})
+		return
+	}
+
+	switch {
+	case accept && r.Method == http.MethodPost:
+		h.acceptTransfer(w, r, ctx, link, userID)
+	case !accept && r.Method == http.MethodPost:
+		h.offerTransfer(w, r, ctx, link, userID)
+	case !accept && r.Method == http.MethodDelete:
+		h.cancelTransfer(w, r, ctx, link, userID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// offerTransfer records a pending transfer, or with an admin's "force"
+// transfers the link right away
+func (h *LinkHandler) offerTransfer(w http.ResponseWriter, r *http.Request, ctx context.Context, link *models.Link, userID string) {
+	var requestBody struct {
+		To    string `json:"to"`
+		Force bool   `json:"force,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	to := strings.TrimSpace(requestBody.To)
+	if to == "" || to == anonymousUserID {
+		http.Error(w, "The user to transfer the link to is required", http.StatusBadRequest)
+		return
+	}
+
+	admin := isAdminRequest(r)
+	if link.CreatedBy != userID && !admin {
+		http.Error(w, "Only the owner or an admin can transfer this link", http.StatusForbidden)
+		logger.Warn("Unauthorized link transfer", logger.Fields{
+			"short":       link.Short,
+			"requestUser": userID,
+			"ownerUser":   link.CreatedBy,
+		})
+		return
+	}
+	if to == link.CreatedBy {
+		http.Error(w, "The link already belongs to this user", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Force && !admin {
+		http.Error(w, "Only admins can transfer a link without the recipient's acceptance", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	status := http.StatusAccepted
+	if requestBody.Force {
+		link.TransferTo(to, userID, now)
+		status = http.StatusOK
+	} else {
+		link.PendingTransfer = &models.LinkTransfer{RequestedAt: now, To: to, RequestedBy: userID}
+	}
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to transfer link", http.StatusInternalServerError)
+		logger.Error("Failed to store link transfer", err, logger.Fields{"short": link.Short})
+		return
+	}
+
+	logger.Info("Link transfer requested", logger.Fields{
+		"short":  link.Short,
+		"to":     to,
+		"userID": userID,
+		"forced": requestBody.Force,
+	})
+	respondLink(w, r, status, link)
+}
+
+// acceptTransfer completes a pending transfer on behalf of its recipient
+func (h *LinkHandler) acceptTransfer(w http.ResponseWriter, r *http.Request, ctx context.Context, link *models.Link, userID string) {
+	if link.PendingTransfer == nil {
+		http.Error(w, "Link has no pending transfer", http.StatusNotFound)
+		return
+	}
+	if link.PendingTransfer.To != userID {
+		http.Error(w, "Only the recipient can accept this transfer", http.StatusForbidden)
+		return
+	}
+
+	from := link.CreatedBy
+	link.TransferTo(userID, userID, time.Now())
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to transfer link", http.StatusInternalServerError)
+		logger.Error("Failed to store link transfer", err, logger.Fields{"short": link.Short})
+		return
+	}
+
+	logger.Info("Link transferred", logger.Fields{
+		"short": link.Short,
+		"from":  from,
+		"to":    userID,
+	})
+	h.publishEvent(models.WebhookEvents.LinkUpdated, link, userID)
+	respondLink(w, r, http.StatusOK, link)
+}
+
+// cancelTransfer drops a pending transfer, either withdrawn by the owner or
+// an admin, or declined by the recipient
+func (h *LinkHandler) cancelTransfer(w http.ResponseWriter, r *http.Request, ctx context.Context, link *models.Link, userID string) {
+	if link.PendingTransfer == nil {
+		http.Error(w, "Link has no pending transfer", http.StatusNotFound)
+		return
+	}
+	if link.CreatedBy != userID && link.PendingTransfer.To != userID && !isAdminRequest(r) {
+		http.Error(w, "Only the owner or the recipient can cancel this transfer", http.StatusForbidden)
+		return
+	}
+
+	link.PendingTransfer = nil
+	if err := h.repo.Update(ctx, link); err != nil {
+		http.Error(w, "Failed to cancel link transfer", http.StatusInternalServerError)
+		logger.Error("Failed to cancel link transfer", err, logger.Fields{"short": link.Short})
+		return
+	}
+
+	logger.Info("Link transfer cancelled", logger.Fields{"short": link.Short, "userID": userID})
+	respondLink(w, r, http.StatusOK, link)
+}
+
+// isAdminRequest reports whether the request comes from an admin. With
+// authentication disabled there are no identities, so every caller is one.
+func isAdminRequest(r *http.Request) bool {
+	if !auth.IsAuthEnabled() {
+		return true
+	}
+	user, err := auth.GetCurrentUser(r)
+	return err == nil && auth.IsAdmin(user)
+}
+
+// respondLink writes the link, as the requester may see it, as the JSON
+// response with the given status
+func respondLink(w http.ResponseWriter, r *http.Request, status int, link *models.Link) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(viewLink(r, link)); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
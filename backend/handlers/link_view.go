@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// linkViewer returns who the request shows links to. Every response holding
+// links passes them through the viewer, so all endpoints redact them alike.
+func linkViewer(r *http.Request) models.LinkViewer {
+	userID, _ := getUserFromContext(r)
+	if userID == anonymousUserID {
+		userID = ""
+	}
+	return models.LinkViewer{UserID: userID, Admin: isAdminRequest(r)}
+}
+
+// viewLink returns the link as the requester may see it
+func viewLink(r *http.Request, link *models.Link) *models.Link {
+	return link.ViewFor(linkViewer(r))
+}
+
+// viewLinks returns the links as the requester may see each of them
+func viewLinks(r *http.Request, links []*models.Link) []*models.Link {
+	return models.ViewLinks(links, linkViewer(r))
+}
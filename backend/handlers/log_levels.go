@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// LogSettings describes the logger configuration. Components maps a component
+// to its level override; in updates an empty level removes the override.
+type LogSettings struct {
+	Components map[string]string `json:"components"`
+	Level      string            `json:"level,omitempty"`
+	Format     string            `json:"format,omitempty"`
+}
+
+// HandleLogLevels handles /api/admin/log-levels. GET returns the global level
+// and the per-component overrides; PUT changes them at runtime, for example
+// to debug the repository without restarting the server:
+//
+//	{"components": {"repository": "debug", "http": ""}}
+//
+// Changes last until the next restart. Admin access is required.
+func HandleLogLevels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !auth.RequireAdmin(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var update LogSettings
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := applyLogSettings(update); err != nil {
+			middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_LOG_LEVEL", err.Error())
+			return
+		}
+		user, _ := getUserFromContext(r)
+		logger.Info("Log levels changed", logger.Fields{
+			"userID":     user,
+			"level":      update.Level,
+			"format":     update.Format,
+			"components": update.Components,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(currentLogSettings()); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// currentLogSettings returns the logger configuration in effect
+func currentLogSettings() LogSettings {
+	settings := LogSettings{
+		Components: map[string]string{},
+		Level:      logger.GetLevel().String(),
+		Format:     logger.GetFormat(),
+	}
+	for component, level := range logger.ComponentLevels() {
+		settings.Components[component] = level.String()
+	}
+	return settings
+}
+
+// applyLogSettings validates every change before applying any of them
+func applyLogSettings(update LogSettings) error {
+	var global logrus.Level
+	if update.Level != "" {
+		level, err := logrus.ParseLevel(update.Level)
+		if err != nil {
+			return fmt.Errorf("invalid log level %q", update.Level)
+		}
+		global = level
+	}
+	overrides := make(map[string]logrus.Level, len(update.Components))
+	for component, name := range update.Components {
+		if component == "" {
+			return fmt.Errorf("component name is required")
+		}
+		if name == "" {
+			continue
+		}
+		level, err := logrus.ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("invalid log level %q for component %q", name, component)
+		}
+		overrides[component] = level
+	}
+	if update.Format != "" && update.Format != logger.GetFormat() {
+		if err := logger.SetFormat(update.Format); err != nil {
+			return err
+		}
+	}
+
+	if update.Level != "" {
+		logger.SetLevel(global)
+	}
+	for component, name := range update.Components {
+		if name == "" {
+			logger.ClearComponentLevel(component)
+			continue
+		}
+		logger.SetComponentLevel(component, overrides[component])
+	}
+	return nil
+}
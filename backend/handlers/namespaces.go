@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/sandbox"
+)
+
+// linkSubresources are the endpoints below /api/links/{short} and
+// /api/analytics/links/{short}. No segment of a namespaced short code after
+// the first may be one of them, or its API paths would be ambiguous.
+var linkSubresources = []string{"aliases", "archive", "deprecation", "favorite", "forecast", "history", "preview", "references", "referrers", "rename", "restore", "rollback", "rollout", "snapshot", "timeseries", "transfer", "undo-delete"}
+
+// WithSandbox sets the namespace anyone may create short-lived links in.
+// Without it the default sandbox applies; a zero policy disables it.
+func WithSandbox(policy sandbox.Policy) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.sandbox = policy
+	}
+}
+
+// WithAnalyticsSandbox sets the sandbox whose links trending and top links
+// leave out. It should match the one the link handler runs with.
+func WithAnalyticsSandbox(policy sandbox.Policy) AnalyticsHandlerOption {
+	return func(h *AnalyticsHandler) {
+		h.sandbox = policy
+	}
+}
+
+// linkNamespace returns the namespace of a short code, such as "team" for
+// "team/docs" and "team/infra/oncall", or "" for a short code without one
+func linkNamespace(short string) string {
+	namespace, _, found := strings.Cut(short, "/")
+	if !found {
+		return ""
+	}
+	return namespace
+}
+
+// isReservedShortCode reports whether short may not be used because it, its
+// namespace or one of its later segments is reserved
+func (h *LinkHandler) isReservedShortCode(short string) bool {
+	segments := strings.Split(short, "/")
+	if h.reserved.Contains(short) || h.reserved.Contains(segments[0]) {
+		return true
+	}
+	for _, segment := range segments[1:] {
+		if slices.Contains(linkSubresources, strings.ToLower(segment)) {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceOwner returns the user who created the earliest link in a
+// namespace, or "" while the namespace has no links
+func (h *LinkHandler) namespaceOwner(ctx context.Context, namespace string) (string, error) {
+	links, err := h.repo.GetByNamespace(ctx, namespace)
+	if err != nil {
+		return "", err
+	}
+	var first *models.Link
+	for _, link := range links {
+		if first == nil || link.CreatedAt.Before(first.CreatedAt) {
+			first = link
+		}
+	}
+	if first == nil {
+		return "", nil
+	}
+	return first.CreatedBy, nil
+}
+
+// rejectNamespace writes a 403 response when short lies in a namespace that
+// belongs to another user. A namespace belongs to whoever created its first
+// link; anyone may use a namespace that has no links yet, and the sandbox
+// belongs to no one.
+func (h *LinkHandler) rejectNamespace(ctx context.Context, w http.ResponseWriter, short, userID string) bool {
+	namespace := linkNamespace(short)
+	if namespace == "" || !auth.IsAuthEnabled() || h.sandbox.Contains(short) {
+		return false
+	}
+
+	owner, err := h.namespaceOwner(ctx, namespace)
+	if err != nil {
+		http.Error(w, "Failed to check namespace", http.StatusInternalServerError)
+		logger.Error("Failed to look up namespace owner", err, logger.Fields{"namespace": namespace})
+		return true
+	}
+	if owner != "" && owner != userID {
+		middleware.RespondWithError(w, http.StatusForbidden, "NAMESPACE_FORBIDDEN",
+			fmt.Sprintf("Namespace '%s' belongs to another user", namespace))
+		logger.Warn("Attempted to use another user's namespace", logger.Fields{
+			"short":  short,
+			"userID": userID,
+			"owner":  owner,
+		})
+		return true
+	}
+	return false
+}
+
+// ListNamespaceLinks handles GET /api/namespaces/{ns}/links requests, listing
+// the links below a namespace that the user can access, ordered by short code
+func (h *LinkHandler) ListNamespaceLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		logger.Warn("Method not allowed for namespace links", logger.Fields{"method": r.Method})
+		return
+	}
+
+	namespace, found := strings.CutSuffix(r.URL.Path[len("/api/namespaces/"):], "/links")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if !shortCodePattern.MatchString(namespace) {
+		http.Error(w, "Invalid namespace", http.StatusBadRequest)
+		return
+	}
+	selection, ok := selectFields(w, r, linkFields)
+	if !ok {
+		return
+	}
+
+	userID, _ := getUserFromContext(r)
+	ctx := readContext(r)
+
+	links, err := h.repo.GetByNamespace(ctx, namespace)
+	if err != nil {
+		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		logger.Error("Failed to retrieve namespace links", err, logger.Fields{"namespace": namespace})
+		return
+	}
+	owner, err := h.namespaceOwner(ctx, strings.Split(namespace, "/")[0])
+	if err != nil {
+		http.Error(w, "Failed to get links", http.StatusInternalServerError)
+		logger.Error("Failed to look up namespace owner", err, logger.Fields{"namespace": namespace})
+		return
+	}
+
+	visible := []*models.Link{}
+	for _, link := range links {
+		if link.CanAccessAs(userID, groups.FromContext(ctx)) && !link.IsArchived() {
+			visible = append(visible, link)
+		}
+	}
+	sort.Slice(visible, func(i, j int) bool { return visible[i].Short < visible[j].Short })
+
+	logger.Info("Retrieved namespace links", logger.Fields{
+		"namespace": namespace,
+		"userID":    userID,
+		"count":     len(visible),
+	})
+
+	projected, err := selection.Apply(viewLinks(r, visible))
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"namespace": namespace,
+		"owner":     owner,
+		"links":     projected,
+	}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/usage"
+)
+
+// Days of product metrics returned by default and at most
+const (
+	defaultProductMetricsDays = 30
+	maxProductMetricsDays     = 366
+)
+
+// WithUsageRecorder counts the use of product features, such as creating
+// links and searching, in the recorder
+func WithUsageRecorder(recorder *usage.Recorder) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.usage = recorder
+	}
+}
+
+// recordUsage counts one use of a product feature, unless the client opted
+// out of being counted
+func (h *LinkHandler) recordUsage(r *http.Request, event string) {
+	if h.usage != nil && !usage.OptedOut(r) {
+		h.usage.Record(event)
+	}
+}
+
+// recordLinkCreated counts a link created through the request's channel
+func (h *LinkHandler) recordLinkCreated(r *http.Request) {
+	user, err := auth.UserFromContext(r.Context())
+	h.recordUsage(r, usage.LinkCreatedEvent(r, err == nil && user.TokenID != ""))
+}
+
+// ProductMetrics is the response of GET /api/admin/product-metrics
+type ProductMetrics struct {
+	// Totals adds up the events of all days
+	Totals map[string]int64 `json:"totals"`
+	From   string           `json:"from"`
+	To     string           `json:"to"`
+	// Days lists the days with events, oldest first
+	Days []*models.ProductMetricsDay `json:"days"`
+}
+
+// HandleProductMetrics returns the handler of GET /api/admin/product-metrics,
+// which reports how often product features were used on each of the last
+// ?days=N days (30 by default), today included. Counts are written once a
+// minute, so the latest uses may not show yet. Admin access is required.
+func HandleProductMetrics(store interfaces.ProductMetricsStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !auth.RequireAdmin(w, r) {
+			return
+		}
+
+		days := defaultProductMetricsDays
+		if value := r.URL.Query().Get("days"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 || n > maxProductMetricsDays {
+				middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest,
+					"days must be between 1 and "+strconv.Itoa(maxProductMetricsDays))
+				return
+			}
+			days = n
+		}
+
+		now := time.Now().UTC()
+		response := ProductMetrics{
+			From:   now.AddDate(0, 0, 1-days).Format(usage.DateLayout),
+			To:     now.Format(usage.DateLayout),
+			Totals: map[string]int64{},
+		}
+		var err error
+		if response.Days, err = store.List(r.Context(), response.From, response.To); err != nil {
+			respondRepositoryAPIError(w, err, "Product metrics not found", nil)
+			return
+		}
+		for _, day := range response.Days {
+			for event, n := range day.Events {
+				response.Totals[event] += n
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logger.Error("Failed to encode product metrics", err, nil)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// repositoryErrorStatus maps an error returned by a repository or store to
+// the status and message of the response. Typed errors from pkg/errors keep
+// their status, with notFound as the message of a missing resource; any
+// other error is a 500, which is logged with fields since the client is not
+// told what went wrong.
+func repositoryErrorStatus(err error, notFound string, fields logger.Fields) (int, string) {
+	status := errors.GetStatusCode(err)
+	switch {
+	case status == http.StatusNotFound:
+		return status, notFound
+	case status >= http.StatusInternalServerError:
+		logger.Error("Repository request failed", err, fields)
+		return http.StatusInternalServerError, "Internal server error"
+	}
+	var typed *errors.Error
+	errors.As(err, &typed)
+	return status, typed.Message
+}
+
+// respondRepositoryError answers a request whose repository call failed with
+// a plain-text error
+func respondRepositoryError(w http.ResponseWriter, err error, notFound string, fields logger.Fields) {
+	status, message := repositoryErrorStatus(err, notFound, fields)
+	http.Error(w, message, status)
+}
+
+// respondRepositoryAPIError answers a request whose repository call failed
+// with the structured error of the API
+func respondRepositoryAPIError(w http.ResponseWriter, err error, notFound string, fields logger.Fields) {
+	status, message := repositoryErrorStatus(err, notFound, fields)
+	middleware.RespondWithError(w, status, middleware.ErrorCode(status), message)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/pkg/settings"
+)
+
+// maxSettingsBytes bounds the settings documents accepted for import
+const maxSettingsBytes = 1 << 20 // 1 MiB
+
+// SettingsImport is the response of importing a settings document
+type SettingsImport struct {
+	DryRun bool `json:"dry_run"`
+	// RestartRequired lists the settings that only take effect once the
+	// server runs with the imported environment
+	RestartRequired []settings.EnvChange     `json:"restart_required"`
+	Webhooks        []settings.WebhookChange `json:"webhooks"`
+	LogLevels       bool                     `json:"log_levels_applied"`
+}
+
+// HandleSettings returns the handler of /api/admin/settings. GET exports the
+// server's portable environment env, its webhooks and its log levels as one
+// versioned document; POST imports such a document, registering its webhooks
+// and applying its log levels at once and listing the environment variables
+// that differ, which need a restart. With ?dry_run=true the import only
+// reports what it would change. webhooks may be nil when webhooks are
+// disabled. Admin access is required.
+func HandleSettings(env map[string]string, webhooks interfaces.WebhookStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.RequireAdmin(w, r) {
+			return
+		}
+		ctx := context.Background()
+		userID, _ := getUserFromContext(r)
+
+		switch r.Method {
+		case http.MethodGet:
+			doc, err := settings.Export(ctx, env, webhooks)
+			if err != nil {
+				respondRepositoryAPIError(w, err, "Webhooks not found", nil)
+				return
+			}
+			levels := settings.LogLevels(currentLogSettings())
+			doc.LogLevels = &levels
+			logger.Info("Settings exported", logger.Fields{"userID": userID})
+			writeSettingsJSON(w, doc)
+		case http.MethodPost:
+			var doc settings.Document
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBytes)).Decode(&doc); err != nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "Invalid settings document")
+				return
+			}
+			if err := doc.Validate(); err != nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_SETTINGS", err.Error())
+				return
+			}
+			if len(doc.Webhooks) > 0 && webhooks == nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, "WEBHOOKS_DISABLED",
+					"The document registers webhooks, which are disabled on this server")
+				return
+			}
+
+			result := SettingsImport{
+				DryRun:          r.URL.Query().Get("dry_run") == "true",
+				RestartRequired: settings.DiffEnv(env, doc.Env),
+				Webhooks:        []settings.WebhookChange{},
+			}
+			if !result.DryRun && !auth.RequireStepUp(w, r) {
+				return
+			}
+			if doc.LogLevels != nil && !result.DryRun {
+				if err := applyLogSettings(LogSettings(*doc.LogLevels)); err != nil {
+					middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_LOG_LEVEL", err.Error())
+					return
+				}
+				result.LogLevels = true
+			}
+			if webhooks != nil {
+				changes, err := settings.ImportWebhooks(ctx, webhooks, doc.Webhooks, userID, result.DryRun)
+				if err != nil {
+					respondRepositoryAPIError(w, err, "Webhook not found", nil)
+					return
+				}
+				result.Webhooks = changes
+			}
+
+			logger.Info("Settings imported", logger.Fields{
+				"userID":          userID,
+				"dryRun":          result.DryRun,
+				"restartRequired": len(result.RestartRequired),
+				"webhooks":        len(result.Webhooks),
+				"logLevels":       result.LogLevels,
+			})
+			writeSettingsJSON(w, result)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// writeSettingsJSON writes value as the JSON response
+func writeSettingsJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error("Failed to encode settings response", err, nil)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/pkg/storagestats"
+)
+
+// StorageStatsSource serves the latest storage statistics
+type StorageStatsSource interface {
+	Snapshot() (storagestats.Snapshot, bool)
+}
+
+// HandleStorageStats returns the handler of GET /api/admin/storage/stats,
+// which reports the documents, estimated size and orphaned records of each
+// collection and the largest statistics documents. The numbers come from a
+// background job, so the request never reads the collections itself; until
+// the job has inspected a collection the response is 503. Admin access is
+// required.
+func HandleStorageStats(source StorageStatsSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !auth.RequireAdmin(w, r) {
+			return
+		}
+
+		snapshot, ok := source.Snapshot()
+		if !ok {
+			w.Header().Set("Retry-After", "60")
+			middleware.RespondWithError(w, http.StatusServiceUnavailable, "STATS_PENDING", "Storage statistics have not been computed yet")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
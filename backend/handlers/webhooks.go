@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/webhook"
+	"github.com/google/uuid"
+)
+
+// EventPublisher takes the link events delivered to webhooks. Publishing
+// must not block; events are delivered in the background.
+type EventPublisher interface {
+	Publish(event webhook.Event)
+}
+
+// WithWebhooks publishes an event for every change to a link, which is
+// delivered to the webhooks subscribed to its type
+func WithWebhooks(publisher EventPublisher) LinkHandlerOption {
+	return func(h *LinkHandler) {
+		h.webhooks = publisher
+	}
+}
+
+// publishEvent publishes an event of eventType about link, made by userID
+func (h *LinkHandler) publishEvent(eventType string, link *models.Link, userID string) {
+	if h.webhooks == nil {
+		return
+	}
+	h.webhooks.Publish(webhook.NewEvent(eventType, link.Clone(), userID))
+}
+
+// webhookCreated is the response of creating a webhook or rotating its
+// secret, the only times the secret is shown
+type webhookCreated struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// webhookRequest is the body of creating or updating a webhook. Omitted
+// fields are left unchanged by updates.
+type webhookRequest struct {
+	URL          *string  `json:"url"`
+	Events       []string `json:"events"`
+	Active       *bool    `json:"active"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
+// HandleWebhooks returns the handler of /api/webhooks. GET lists the
+// registered webhooks; POST registers one from {"url", "events"}, answering
+// with the secret its deliveries are signed with. Admin access is required.
+func HandleWebhooks(store interfaces.WebhookStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.RequireAdmin(w, r) {
+			return
+		}
+		ctx := context.Background()
+
+		switch r.Method {
+		case http.MethodGet:
+			webhooks, err := store.List(ctx)
+			if err != nil {
+				respondRepositoryAPIError(w, err, "Webhooks not found", nil)
+				return
+			}
+			writeWebhookJSON(w, http.StatusOK, webhooks)
+		case http.MethodPost:
+			var requestBody webhookRequest
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "Invalid request body")
+				return
+			}
+			if requestBody.URL == nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_WEBHOOK", "url is required")
+				return
+			}
+			userID, _ := getUserFromContext(r)
+			now := time.Now()
+			hook := &models.Webhook{
+				ID:        uuid.NewString(),
+				CreatedBy: userID,
+				CreatedAt: now,
+				UpdatedAt: now,
+				Active:    true,
+			}
+			if err := applyWebhookRequest(hook, requestBody); err != nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_WEBHOOK", err.Error())
+				return
+			}
+			secret, err := webhook.NewSecret()
+			if err != nil {
+				http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+				logger.Error("Failed to generate webhook secret", err, nil)
+				return
+			}
+			hook.Secret = secret
+			if err := store.Create(ctx, hook); err != nil {
+				respondRepositoryAPIError(w, err, "Webhook not found", logger.Fields{"webhookID": hook.ID})
+				return
+			}
+
+			logger.Info("Webhook registered", logger.Fields{
+				"userID":    userID,
+				"webhookID": hook.ID,
+				"url":       hook.URL,
+				"events":    hook.Events,
+			})
+			writeWebhookJSON(w, http.StatusCreated, webhookCreated{Webhook: hook, Secret: hook.Secret})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleWebhook returns the handler of /api/webhooks/{id}. GET returns the
+// webhook; PUT changes its url, events or active state, and with
+// {"rotate_secret": true} answers with a new secret; DELETE removes it.
+// Admin access is required.
+func HandleWebhook(store interfaces.WebhookStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.RequireAdmin(w, r) {
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/webhooks/")
+		userID, _ := getUserFromContext(r)
+		ctx := context.Background()
+
+		switch r.Method {
+		case http.MethodGet:
+			hook, err := store.Get(ctx, id)
+			if err != nil {
+				respondRepositoryAPIError(w, err, "Webhook not found", logger.Fields{"webhookID": id})
+				return
+			}
+			writeWebhookJSON(w, http.StatusOK, hook)
+		case http.MethodPut:
+			var requestBody webhookRequest
+			if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, middleware.ErrBadRequest, "Invalid request body")
+				return
+			}
+			hook, err := store.Get(ctx, id)
+			if err != nil {
+				respondRepositoryAPIError(w, err, "Webhook not found", logger.Fields{"webhookID": id})
+				return
+			}
+			if err := applyWebhookRequest(hook, requestBody); err != nil {
+				middleware.RespondWithError(w, http.StatusBadRequest, "INVALID_WEBHOOK", err.Error())
+				return
+			}
+			if requestBody.RotateSecret {
+				if hook.Secret, err = webhook.NewSecret(); err != nil {
+					http.Error(w, "Failed to update webhook", http.StatusInternalServerError)
+					logger.Error("Failed to generate webhook secret", err, nil)
+					return
+				}
+			}
+			hook.UpdatedAt = time.Now()
+			if err := store.Update(ctx, hook); err != nil {
+				respondRepositoryAPIError(w, err, "Webhook not found", logger.Fields{"webhookID": id})
+				return
+			}
+
+			logger.Info("Webhook updated", logger.Fields{
+				"userID":        userID,
+				"webhookID":     id,
+				"url":           hook.URL,
+				"events":        hook.Events,
+				"active":        hook.Active,
+				"rotatedSecret": requestBody.RotateSecret,
+			})
+			if requestBody.RotateSecret {
+				writeWebhookJSON(w, http.StatusOK, webhookCreated{Webhook: hook, Secret: hook.Secret})
+				return
+			}
+			writeWebhookJSON(w, http.StatusOK, hook)
+		case http.MethodDelete:
+			if !auth.RequireStepUp(w, r) {
+				return
+			}
+			if err := store.Delete(ctx, id); err != nil {
+				respondRepositoryAPIError(w, err, "Webhook not found", logger.Fields{"webhookID": id})
+				return
+			}
+			logger.Info("Webhook deleted", logger.Fields{"userID": userID, "webhookID": id})
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// applyWebhookRequest validates the fields set in req and applies them to hook
+func applyWebhookRequest(hook *models.Webhook, req webhookRequest) error {
+	if req.URL != nil {
+		target, err := url.Parse(strings.TrimSpace(*req.URL))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("url must be an absolute http or https URL")
+		}
+		hook.URL = target.String()
+	}
+	if req.Events != nil {
+		if len(req.Events) == 0 {
+			return fmt.Errorf("events must name at least one event type")
+		}
+		for _, event := range req.Events {
+			if !models.IsWebhookEvent(event) {
+				return fmt.Errorf("unknown event type '%s'", event)
+			}
+		}
+		hook.Events = req.Events
+	}
+	if len(hook.Events) == 0 {
+		return fmt.Errorf("events is required")
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	return nil
+}
+
+// writeWebhookJSON writes value as the JSON response with status
+func writeWebhookJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error("Failed to encode webhook response", err, nil)
+	}
+}
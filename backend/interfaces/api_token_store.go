@@ -0,0 +1,21 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// APITokenStore defines the interface for API token storage. Usage is
+// counted per token and calendar month, such as "2026-01".
+type APITokenStore interface {
+	Create(ctx context.Context, token *models.APIToken) error
+	Get(ctx context.Context, id string) (*models.APIToken, error)
+	ListByUser(ctx context.Context, userID string) ([]*models.APIToken, error)
+	Revoke(ctx context.Context, id string) error
+	// AddUsage counts one request of the token in month and returns the
+	// requests of the month so far
+	AddUsage(ctx context.Context, id, month string) (int, error)
+	// Usage returns the requests of the token in month
+	Usage(ctx context.Context, id, month string) (int, error)
+}
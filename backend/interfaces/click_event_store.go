@@ -0,0 +1,26 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// ClickEventStore defines the interface for storing the click stream of each
+// link: one event per redirect, anonymized before it is stored
+type ClickEventStore interface {
+	// Send stores a batch of click events
+	Send(ctx context.Context, events []models.ClickEvent) error
+	// ListByShort returns the click events of a link at or after since,
+	// oldest first
+	ListByShort(ctx context.Context, short string, since time.Time) ([]*models.ClickEvent, error)
+	// DeleteByShort forgets the click stream of a link
+	DeleteByShort(ctx context.Context, short string) error
+	// MoveShort files the click stream of a renamed link under its new short
+	// code
+	MoveShort(ctx context.Context, short, newShort string) error
+	// DeleteBefore deletes the click events of a link before before and
+	// returns how many it deleted
+	DeleteBefore(ctx context.Context, short string, before time.Time) (int, error)
+}
@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+// LeaseStore grants named leases, so that background work shared by every
+// server runs on one of them at a time. A lease is held until it expires;
+// its holder renews it by acquiring it again.
+type LeaseStore interface {
+	// Acquire takes the lease name for holder until ttl from now, reporting
+	// false while another holder has it. The holder of a lease renews it.
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+}
@@ -0,0 +1,18 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// LinkAliasStore defines the interface for link alias storage
+type LinkAliasStore interface {
+	// Create stores an alias, failing with an AlreadyExists error if it is taken
+	Create(ctx context.Context, alias *models.LinkAlias) error
+	Get(ctx context.Context, alias string) (*models.LinkAlias, error)
+	// ListByShort returns the aliases of a link, oldest first
+	ListByShort(ctx context.Context, short string) ([]*models.LinkAlias, error)
+	Delete(ctx context.Context, alias string) error
+	DeleteByShort(ctx context.Context, short string) error
+}
@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// LinkReferenceStore defines the interface for storing where links are referenced.
+// References outlive the links they name, since documents may still mention a deleted link.
+type LinkReferenceStore interface {
+	// ReplaceDocument sets the references made by one document, dropping its
+	// references to links it no longer mentions
+	ReplaceDocument(ctx context.Context, documentURL string, refs []*models.LinkReference) error
+	// ListByShort returns the references to a link, most frequent first
+	ListByShort(ctx context.Context, short string) ([]*models.LinkReference, error)
+}
@@ -0,0 +1,20 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// LinkSnapshotStore defines the interface for link snapshot storage
+type LinkSnapshotStore interface {
+	// Create stores a snapshot and assigns it the next ID for its link
+	Create(ctx context.Context, snapshot *models.LinkSnapshot) error
+	// ListByShort returns a link's snapshots, newest first
+	ListByShort(ctx context.Context, short string) ([]*models.LinkSnapshot, error)
+	Get(ctx context.Context, short string, id int) (*models.LinkSnapshot, error)
+	Delete(ctx context.Context, short string, id int) error
+	DeleteByShort(ctx context.Context, short string) error
+	// MoveShort files the snapshots of a renamed link under its new short code
+	MoveShort(ctx context.Context, short, newShort string) error
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// LinkVersionStore defines the interface for link edit history storage
+type LinkVersionStore interface {
+	// Create stores a version and assigns it the next version number for its link
+	Create(ctx context.Context, version *models.LinkVersion) error
+	// ListByShort returns a link's versions, newest first
+	ListByShort(ctx context.Context, short string) ([]*models.LinkVersion, error)
+	Get(ctx context.Context, short string, version int) (*models.LinkVersion, error)
+	DeleteByShort(ctx context.Context, short string) error
+	// MoveShort files the history of a renamed link under its new short code
+	MoveShort(ctx context.Context, short, newShort string) error
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// LocalUserStore keeps the accounts of the local user store
+type LocalUserStore interface {
+	// Get returns an account, or a not found error
+	Get(ctx context.Context, username string) (*models.LocalUser, error)
+	// Save creates an account or replaces the one with the same username
+	Save(ctx context.Context, user *models.LocalUser) error
+	// Delete removes an account, returning a not found error if there is none
+	Delete(ctx context.Context, username string) error
+	// List returns every account, ordered by username
+	List(ctx context.Context) ([]*models.LocalUser, error)
+}
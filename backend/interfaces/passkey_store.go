@@ -0,0 +1,24 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// PasskeyStore defines the interface for storing the passkeys and recovery
+// codes of second-factor authentication
+type PasskeyStore interface {
+	Create(ctx context.Context, passkey *models.Passkey) error
+	ListByUser(ctx context.Context, userID string) ([]*models.Passkey, error)
+	// RecordUse stores the signature count and last use of a passkey
+	RecordUse(ctx context.Context, passkey *models.Passkey) error
+	Delete(ctx context.Context, id string) error
+	// SetRecoveryCodes replaces the user's recovery codes
+	SetRecoveryCodes(ctx context.Context, codes *models.RecoveryCodes) error
+	// UseRecoveryCode removes the code with hash from the user's recovery
+	// codes, reporting whether it was one of them
+	UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error)
+	// RemainingRecoveryCodes returns how many unused recovery codes the user has
+	RemainingRecoveryCodes(ctx context.Context, userID string) (int, error)
+}
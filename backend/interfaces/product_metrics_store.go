@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// ProductMetricsStore defines the interface for storing the daily totals of
+// product feature usage
+type ProductMetricsStore interface {
+	// Add adds counts of events to the totals of a day (YYYY-MM-DD)
+	Add(ctx context.Context, day string, counts map[string]int64) error
+	// List returns the totals of the days from through to, oldest first;
+	// days without events are left out
+	List(ctx context.Context, from, to string) ([]*models.ProductMetricsDay, error)
+}
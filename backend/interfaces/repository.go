@@ -10,11 +10,31 @@ import (
 type LinkRepositoryInterface interface {
 	Create(ctx context.Context, link *models.Link) error
 	GetByShort(ctx context.Context, short string) (*models.Link, error)
+	GetByShorts(ctx context.Context, shorts []string) (map[string]*models.Link, error)
 	GetAll(ctx context.Context) ([]*models.Link, error)
+	List(ctx context.Context, query models.LinkQuery) ([]*models.Link, error)
 	Update(ctx context.Context, link *models.Link) error
 	Delete(ctx context.Context, short string) error
+	GetDeleted(ctx context.Context) ([]*models.Link, error)
+	GetDeletedByShort(ctx context.Context, short string) (*models.Link, error)
+	Restore(ctx context.Context, short string) error
+	Purge(ctx context.Context, short string) error
+	Rename(ctx context.Context, short, newShort string) (*models.Link, error)
 	IncrementClickCount(ctx context.Context, short string) error
+	RecordRolloutClick(ctx context.Context, short, variant string) error
+	UpdatePopularity(ctx context.Context, link *models.Link) error
 	GetByAccessLevel(ctx context.Context, accessLevel string) ([]*models.Link, error)
 	GetByUser(ctx context.Context, userID string) ([]*models.Link, error)
+	CountAll(ctx context.Context) (int, error)
+	CountByUser(ctx context.Context, userID string) (int, error)
+	CountByAccessLevel(ctx context.Context, accessLevel string) (int, error)
+	Ping(ctx context.Context) error
+	GetByTag(ctx context.Context, tag string) ([]*models.Link, error)
+	GetByURL(ctx context.Context, url string) ([]*models.Link, error)
+	GetByNamespace(ctx context.Context, namespace string) ([]*models.Link, error)
+	GetExpiredLinks(ctx context.Context) ([]*models.Link, error)
+	GetLinksByExpiryStatus(ctx context.Context, isExpired bool) ([]*models.Link, error)
 	CheckAccess(ctx context.Context, short string, userID string) (bool, error)
+	GetLinkStats(ctx context.Context, short string) (*models.LinkStats, error)
+	UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) error
 }
@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// SessionStore defines the interface for server-side session storage
+type SessionStore interface {
+	Create(ctx context.Context, session *models.Session) error
+	Get(ctx context.Context, id string) (*models.Session, error)
+	ListByUser(ctx context.Context, userID string) ([]*models.Session, error)
+	Revoke(ctx context.Context, id string) error
+}
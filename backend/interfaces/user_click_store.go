@@ -0,0 +1,23 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// UserClickStore defines the interface for storing how often each user
+// follows each link. The history only personalizes the user's own search
+// results and is never shown to anyone else.
+type UserClickStore interface {
+	// RecordClick counts a click by userID on the link short made at at
+	RecordClick(ctx context.Context, userID, short string, at time.Time) error
+	// ListByUser returns a user's click history, most recent first
+	ListByUser(ctx context.Context, userID string) ([]*models.UserLinkClicks, error)
+	// DeleteByUser forgets a user's whole click history
+	DeleteByUser(ctx context.Context, userID string) error
+	// DeleteBefore forgets every history entry last clicked before cutoff and
+	// returns how many were deleted
+	DeleteBefore(ctx context.Context, cutoff time.Time) (int, error)
+}
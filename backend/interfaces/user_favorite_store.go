@@ -0,0 +1,20 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// UserFavoriteStore defines the interface for storing each user's favorite
+// links. Favorites are private to the user who added them.
+type UserFavoriteStore interface {
+	// Add favorites the link short for userID; adding a favorite again keeps
+	// its original time
+	Add(ctx context.Context, userID, short string, at time.Time) error
+	// Remove unfavorites the link; removing a link that is no favorite is not an error
+	Remove(ctx context.Context, userID, short string) error
+	// ListByUser returns a user's favorites, most recently added first
+	ListByUser(ctx context.Context, userID string) ([]*models.UserFavorite, error)
+}
@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// UserRoleStore defines the interface for storing the roles assigned to
+// users, keyed by their lowercased email
+type UserRoleStore interface {
+	Get(ctx context.Context, email string) (*models.UserRole, error)
+	List(ctx context.Context) ([]*models.UserRole, error)
+	// Set creates or replaces the role of a user
+	Set(ctx context.Context, role *models.UserRole) error
+	Delete(ctx context.Context, email string) error
+}
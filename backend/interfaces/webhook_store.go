@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// WebhookStore defines the interface for storing the webhooks link events
+// are delivered to
+type WebhookStore interface {
+	Create(ctx context.Context, webhook *models.Webhook) error
+	Get(ctx context.Context, id string) (*models.Webhook, error)
+	List(ctx context.Context) ([]*models.Webhook, error)
+	Update(ctx context.Context, webhook *models.Webhook) error
+	Delete(ctx context.Context, id string) error
+}
@@ -2,8 +2,11 @@ package logger
 
 import (
 	"flag"
+	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
@@ -16,12 +19,33 @@ var output io.Writer = os.Stdout
 // Fields type for structured logging
 type Fields map[string]interface{}
 
+// Output formats accepted by SetFormat
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+const timestampFormat = "2006-01-02 15:04:05"
+
+// levels holds the global level and the per-component overrides. Filtering
+// happens here rather than in logrus so components can be more verbose than
+// the global level.
+var levels = struct {
+	components map[string]logrus.Level
+	format     string
+	global     logrus.Level
+	mu         sync.RWMutex
+}{components: map[string]logrus.Level{}}
+
 func init() {
 	log = logrus.New()
 	log.SetOutput(output)
-	log.SetFormatter(&logrus.JSONFormatter{
-		TimestampFormat: "2006-01-02 15:04:05",
-	})
+	log.SetLevel(logrus.TraceLevel)
+
+	formatErr := SetFormat(os.Getenv("LOG_FORMAT"))
+	if formatErr != nil {
+		_ = SetFormat(FormatJSON)
+	}
 
 	// Set log level based on environment
 	level := os.Getenv("LOG_LEVEL")
@@ -33,80 +57,230 @@ func init() {
 
 	switch level {
 	case "debug":
-		log.SetLevel(logrus.DebugLevel)
+		SetLevel(logrus.DebugLevel)
 	case "info":
-		log.SetLevel(logrus.InfoLevel)
+		SetLevel(logrus.InfoLevel)
 	case "warn":
-		log.SetLevel(logrus.WarnLevel)
+		SetLevel(logrus.WarnLevel)
 	case "error":
-		log.SetLevel(logrus.ErrorLevel)
+		SetLevel(logrus.ErrorLevel)
 	default:
-		log.SetLevel(logrus.InfoLevel)
+		SetLevel(logrus.InfoLevel)
 	}
 	if flag.Lookup("test.v") != nil {
 		log.ExitFunc = func(code int) {}
 	}
+
+	// Per-component overrides, such as "repository=debug,http=warn"
+	overrides, err := ParseComponentLevels(os.Getenv("LOG_LEVELS"))
+	for component, level := range overrides {
+		SetComponentLevel(component, level)
+	}
+
+	if formatErr != nil {
+		Warn("Ignoring invalid LOG_FORMAT", Fields{"error": formatErr.Error()})
+	}
+	if err != nil {
+		Warn("Ignoring invalid LOG_LEVELS", Fields{"error": err.Error()})
+	}
+}
+
+// SetFormat switches between JSON output and human-readable console output
+// for local development. An empty format selects JSON.
+func SetFormat(format string) error {
+	var formatter logrus.Formatter
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatJSON:
+		format = FormatJSON
+		formatter = &logrus.JSONFormatter{TimestampFormat: timestampFormat}
+	case FormatConsole, "text", "pretty":
+		format = FormatConsole
+		formatter = &logrus.TextFormatter{FullTimestamp: true, TimestampFormat: timestampFormat}
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.format = format
+	log.SetFormatter(formatter)
+	return nil
+}
+
+// GetFormat returns the current output format
+func GetFormat() string {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	return levels.format
 }
 
 // SetLevel sets the logging level
 func SetLevel(level logrus.Level) {
-	log.SetLevel(level)
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.global = level
 }
 
 // GetLevel returns the current logging level
 func GetLevel() logrus.Level {
-	return log.GetLevel()
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	return levels.global
+}
+
+// SetComponentLevel overrides the logging level of one component
+func SetComponentLevel(component string, level logrus.Level) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.components[component] = level
+}
+
+// ClearComponentLevel makes a component log at the global level again
+func ClearComponentLevel(component string) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	delete(levels.components, component)
+}
+
+// ComponentLevels returns the per-component overrides by component name
+func ComponentLevels() map[string]logrus.Level {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	overrides := make(map[string]logrus.Level, len(levels.components))
+	for component, level := range levels.components {
+		overrides[component] = level
+	}
+	return overrides
+}
+
+// ParseComponentLevels parses overrides written as comma-separated
+// component=level pairs, such as "repository=debug,http=info"
+func ParseComponentLevels(spec string) (map[string]logrus.Level, error) {
+	overrides := map[string]logrus.Level{}
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		component, name, ok := strings.Cut(pair, "=")
+		component = strings.TrimSpace(component)
+		if !ok || component == "" {
+			return nil, fmt.Errorf("invalid component log level %q, expected component=level", pair)
+		}
+		level, err := logrus.ParseLevel(strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level for component %q: %w", component, err)
+		}
+		overrides[component] = level
+	}
+	return overrides, nil
+}
+
+// Logger writes entries for one component, such as "http" or "repository",
+// whose level can be overridden independently of the global level
+type Logger struct {
+	component string
+}
+
+// root logs without a component, at the global level
+var root = &Logger{}
+
+// For returns the logger of a component. Its entries carry a "component" field.
+func For(component string) *Logger {
+	return &Logger{component: component}
+}
+
+// enabled reports whether entries of the given level are written
+func (l *Logger) enabled(level logrus.Level) bool {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+	threshold, ok := levels.components[l.component]
+	if !ok || l.component == "" {
+		threshold = levels.global
+	}
+	return level <= threshold
+}
+
+// entry prepares an entry with the component and the given fields
+func (l *Logger) entry(fields Fields) *logrus.Entry {
+	entry := logrus.NewEntry(log)
+	if len(fields) > 0 {
+		entry = entry.WithFields(logrus.Fields(fields))
+	}
+	if l.component != "" {
+		entry = entry.WithField("component", l.component)
+	}
+	return entry
 }
 
 // Info logs info level messages with structured fields
-func Info(msg string, fields Fields) {
-	if fields == nil {
-		log.Info(msg)
-	} else {
-		log.WithFields(logrus.Fields(fields)).Info(msg)
+func (l *Logger) Info(msg string, fields Fields) {
+	if l.enabled(logrus.InfoLevel) {
+		l.entry(fields).Info(msg)
 	}
 }
 
 // Debug logs debug level messages with structured fields
-func Debug(msg string, fields Fields) {
-	// Force debug level for ensuring debug messages are output during testing.
-	log.SetLevel(logrus.DebugLevel)
-	if fields == nil {
-		log.Debug(msg)
-	} else {
-		log.WithFields(logrus.Fields(fields)).Debug(msg)
+func (l *Logger) Debug(msg string, fields Fields) {
+	if l.enabled(logrus.DebugLevel) {
+		l.entry(fields).Debug(msg)
 	}
 }
 
 // Warn logs warning level messages with structured fields
-func Warn(msg string, fields Fields) {
-	if fields == nil {
-		log.Warn(msg)
-	} else {
-		log.WithFields(logrus.Fields(fields)).Warn(msg)
+func (l *Logger) Warn(msg string, fields Fields) {
+	if l.enabled(logrus.WarnLevel) {
+		l.entry(fields).Warn(msg)
 	}
 }
 
 // Error logs error level messages with structured fields
-func Error(msg string, err error, fields Fields) {
+func (l *Logger) Error(msg string, err error, fields Fields) {
+	if !l.enabled(logrus.ErrorLevel) {
+		return
+	}
 	if fields == nil {
 		fields = Fields{}
 	}
 	if err != nil {
 		fields["error"] = err.Error()
 	}
-	log.WithFields(logrus.Fields(fields)).Error(msg)
+	l.entry(fields).Error(msg)
 }
 
 // Fatal logs fatal level messages with structured fields and exits
-func Fatal(msg string, err error, fields Fields) {
+func (l *Logger) Fatal(msg string, err error, fields Fields) {
 	if fields == nil {
 		fields = Fields{}
 	}
 	if err != nil {
 		fields["error"] = err.Error()
 	}
-	log.WithFields(logrus.Fields(fields)).Fatal(msg)
+	l.entry(fields).Fatal(msg)
+}
+
+// Info logs info level messages with structured fields
+func Info(msg string, fields Fields) {
+	root.Info(msg, fields)
+}
+
+// Debug logs debug level messages with structured fields
+func Debug(msg string, fields Fields) {
+	root.Debug(msg, fields)
+}
+
+// Warn logs warning level messages with structured fields
+func Warn(msg string, fields Fields) {
+	root.Warn(msg, fields)
+}
+
+// Error logs error level messages with structured fields
+func Error(msg string, err error, fields Fields) {
+	root.Error(msg, err, fields)
+}
+
+// Fatal logs fatal level messages with structured fields and exits
+func Fatal(msg string, err error, fields Fields) {
+	root.Fatal(msg, err, fields)
 }
 
 // SetOutput changes the output writer - useful for testing
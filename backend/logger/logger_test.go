@@ -55,9 +55,9 @@ func TestInfo(t *testing.T) {
 
 func TestDebug(t *testing.T) {
 	// Set log level to debug for this test
-	originalLevel := logrus.GetLevel()
-	logrus.SetLevel(logrus.DebugLevel)
-	defer logrus.SetLevel(originalLevel)
+	originalLevel := logger.GetLevel()
+	logger.SetLevel(logrus.DebugLevel)
+	defer logger.SetLevel(originalLevel)
 
 	output := captureOutput(func() {
 		logger.Debug("test debug message", logger.Fields{"key": "value"})
@@ -131,3 +131,63 @@ func TestNilFields(t *testing.T) {
 	assert.Equal(t, "test nil fields", logEntry["msg"])
 	assert.Equal(t, "info", logEntry["level"])
 }
+
+func TestComponentLevels(t *testing.T) {
+	originalLevel := logger.GetLevel()
+	logger.SetLevel(logrus.InfoLevel)
+	defer logger.SetLevel(originalLevel)
+	defer logger.ClearComponentLevel("repository")
+
+	repoLog := logger.For("repository")
+	httpLog := logger.For("http")
+
+	assert.Empty(t, captureOutput(func() { repoLog.Debug("hidden", nil) }))
+
+	logger.SetComponentLevel("repository", logrus.DebugLevel)
+	output := captureOutput(func() {
+		repoLog.Debug("repository debug", logger.Fields{"key": "value"})
+		httpLog.Debug("http debug", nil)
+		logger.Debug("global debug", nil)
+	})
+	assert.NotContains(t, output, "http debug")
+	assert.NotContains(t, output, "global debug")
+
+	var logEntry map[string]interface{}
+	err := json.Unmarshal([]byte(strings.TrimSpace(output)), &logEntry)
+	assert.NoError(t, err)
+	assert.Equal(t, "repository debug", logEntry["msg"])
+	assert.Equal(t, "repository", logEntry["component"])
+	assert.Equal(t, "value", logEntry["key"])
+
+	logger.ClearComponentLevel("repository")
+	assert.Empty(t, captureOutput(func() { repoLog.Debug("hidden", nil) }))
+}
+
+func TestParseComponentLevels(t *testing.T) {
+	levels, err := logger.ParseComponentLevels(" repository=debug, http=WARN ,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]logrus.Level{
+		"repository": logrus.DebugLevel,
+		"http":       logrus.WarnLevel,
+	}, levels)
+
+	_, err = logger.ParseComponentLevels("repository")
+	assert.Error(t, err)
+	_, err = logger.ParseComponentLevels("repository=loud")
+	assert.Error(t, err)
+}
+
+func TestConsoleFormat(t *testing.T) {
+	assert.NoError(t, logger.SetFormat(logger.FormatConsole))
+	defer func() { _ = logger.SetFormat(logger.FormatJSON) }()
+
+	output := captureOutput(func() {
+		logger.For("http").Info("console message", logger.Fields{"key": "value"})
+	})
+	assert.Contains(t, output, `msg="console message"`)
+	assert.Contains(t, output, "component=http")
+	assert.Contains(t, output, "key=value")
+	assert.Equal(t, logger.FormatConsole, logger.GetFormat())
+
+	assert.Error(t, logger.SetFormat("xml"))
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"container/list"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -11,32 +12,152 @@ import (
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/consistency"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default response cache bounds
+const (
+	DefaultCacheMaxEntries = 10000
+	DefaultCacheMaxBytes   = 64 << 20
+)
+
+// Reasons cached responses are evicted
+const (
+	evictEntries = "entries"
+	evictBytes   = "bytes"
+	evictExpired = "expired"
+)
+
+var (
+	// CacheEvictionsTotal counts the responses evicted from the cache by reason
+	CacheEvictionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_response_cache_evictions_total",
+			Help: "Total number of responses evicted from the response cache, by reason",
+		},
+		[]string{"reason"},
+	)
+
+	// CacheRequestsTotal counts the cacheable requests by whether they were
+	// served from the cache
+	CacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_response_cache_requests_total",
+			Help: "Total number of cacheable requests by result (hit, miss or bypass)",
+		},
+		[]string{"result"},
+	)
+
+	// CacheEntries tracks the responses held in the cache
+	CacheEntries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "golink_response_cache_entries",
+			Help: "Number of responses held in the response cache",
+		},
+	)
+
+	// CacheBytes tracks the memory held by cached responses
+	CacheBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "golink_response_cache_bytes",
+			Help: "Approximate size in bytes of the responses held in the response cache",
+		},
+	)
 )
 
 // CacheItem represents a cached HTTP response
 type CacheItem struct {
 	CreatedAt   time.Time
 	ContentType string
+	Location    string
 	Content     []byte
 	Expiry      time.Duration
 	StatusCode  int
 }
 
-// Cache is a simple in-memory cache for HTTP responses
+// size approximates the memory an item holds under key
+func (item CacheItem) size(key string) int {
+	return len(key) + len(item.ContentType) + len(item.Location) + len(item.Content)
+}
+
+// cacheEntry is the value of an element of the recency list
+type cacheEntry struct {
+	key  string
+	item CacheItem
+	size int
+}
+
+// Cache is an in-memory LRU cache for HTTP responses, bounded by the number
+// of responses and their total size. All operations are O(1).
 type Cache struct {
-	items map[string]CacheItem
-	mutex sync.RWMutex
+	items *list.List
+	index map[string]*list.Element
+	// maxEntries and maxBytes bound the cache; zero or less means unbounded
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	mutex      sync.Mutex
+}
+
+// CacheOption configures a Cache
+type CacheOption func(*Cache)
+
+// WithMaxEntries bounds the number of cached responses
+func WithMaxEntries(n int) CacheOption {
+	return func(c *Cache) {
+		c.maxEntries = n
+	}
+}
+
+// WithMaxBytes bounds the total size of the cached responses
+func WithMaxBytes(n int) CacheOption {
+	return func(c *Cache) {
+		c.maxBytes = n
+	}
+}
+
+// ResponseStore keeps the responses cached by CacheMiddleware. A Cache
+// keeps them in memory; a SharedCache shares them between replicas.
+type ResponseStore interface {
+	Get(key string) (CacheItem, bool)
+	Set(key string, content []byte, contentType, location string, statusCode int, expiry time.Duration)
+	Delete(key string)
 }
 
-// Global cache instance
+// Ensure Cache implements ResponseStore
+var _ ResponseStore = (*Cache)(nil)
+
+// Global cache instances
 var (
-	responseCache = NewCache()
+	memoryCache                 = NewCache()
+	responseCache ResponseStore = memoryCache
 )
 
+// SetResponseCacheLimits bounds the in-memory response cache used by
+// CacheMiddleware, evicting the least recently used responses beyond the
+// new limits
+func SetResponseCacheLimits(maxEntries, maxBytes int) {
+	memoryCache.SetLimits(maxEntries, maxBytes)
+}
+
+// SetResponseStore makes CacheMiddleware keep responses in store instead of
+// the in-memory cache
+func SetResponseStore(store ResponseStore) {
+	responseCache = store
+}
+
 // NewCache creates a new cache
-func NewCache() *Cache {
+func NewCache(opts ...CacheOption) *Cache {
 	cache := &Cache{
-		items: make(map[string]CacheItem),
+		items:      list.New(),
+		index:      make(map[string]*list.Element),
+		maxEntries: DefaultCacheMaxEntries,
+		maxBytes:   DefaultCacheMaxBytes,
+	}
+	for _, opt := range opts {
+		opt(cache)
 	}
 
 	// Start background cleanup
@@ -51,57 +172,107 @@ func (c *Cache) periodicCleanup() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		now := time.Now()
-		c.mutex.Lock()
+		c.removeExpired(time.Now())
+	}
+}
 
-		for key, item := range c.items {
-			if now.Sub(item.CreatedAt) > item.Expiry {
-				delete(c.items, key)
-				logger.Info("Cache item expired and removed", logger.Fields{
-					"key": key,
-				})
-			}
-		}
+// removeExpired removes the items expired at now
+func (c *Cache) removeExpired(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-		c.mutex.Unlock()
+	var removed int
+	for e := c.items.Back(); e != nil; {
+		prev := e.Prev()
+		if entry := e.Value.(*cacheEntry); now.Sub(entry.item.CreatedAt) > entry.item.Expiry {
+			c.remove(e, evictExpired)
+			removed++
+		}
+		e = prev
+	}
+	if removed > 0 {
+		httpLog.Info("Expired items removed from cache", logger.Fields{
+			"removed": removed,
+		})
 	}
 }
 
-// Set adds an item to the cache
-func (c *Cache) Set(key string, content []byte, contentType string, statusCode int, expiry time.Duration) {
+// SetLimits changes the bounds of the cache, evicting the least recently
+// used items beyond them
+func (c *Cache) SetLimits(maxEntries, maxBytes int) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	c.items[key] = CacheItem{
+	c.maxEntries = maxEntries
+	c.maxBytes = maxBytes
+	c.evict()
+}
+
+// Len returns the number of cached items
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.items.Len()
+}
+
+// Set adds an item to the cache, evicting the least recently used items
+// when the cache is full. Items larger than the whole cache are not stored.
+func (c *Cache) Set(key string, content []byte, contentType, location string, statusCode int, expiry time.Duration) {
+	item := CacheItem{
 		Content:     content,
 		ContentType: contentType,
+		Location:    location,
 		StatusCode:  statusCode,
 		CreatedAt:   time.Now(),
 		Expiry:      expiry,
 	}
+	size := item.size(key)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, found := c.index[key]; found {
+		c.remove(e, "")
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		httpLog.Info("Response too large to cache", logger.Fields{
+			"key":  key,
+			"size": size,
+		})
+		return
+	}
+
+	c.index[key] = c.items.PushFront(&cacheEntry{key: key, item: item, size: size})
+	c.bytes += size
+	CacheEntries.Inc()
+	CacheBytes.Add(float64(size))
+	c.evict()
 
-	logger.Info("Added item to cache", logger.Fields{
+	httpLog.Info("Added item to cache", logger.Fields{
 		"key":    key,
 		"expiry": expiry.String(),
 	})
 }
 
-// Get retrieves an item from the cache
+// Get retrieves an item from the cache, marking it as recently used
 func (c *Cache) Get(key string) (CacheItem, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	item, found := c.items[key]
+	e, found := c.index[key]
 	if !found {
 		return CacheItem{}, false
 	}
 
 	// Check if the item is expired
-	if time.Since(item.CreatedAt) > item.Expiry {
+	entry := e.Value.(*cacheEntry)
+	if time.Since(entry.item.CreatedAt) > entry.item.Expiry {
+		c.remove(e, evictExpired)
 		return CacheItem{}, false
 	}
 
-	return item, true
+	c.items.MoveToFront(e)
+	return entry.item, true
 }
 
 // Delete removes an item from the cache
@@ -109,9 +280,33 @@ func (c *Cache) Delete(key string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	if _, found := c.items[key]; found {
-		delete(c.items, key)
-		logger.Info("Removed item from cache", logger.Fields{"key": key})
+	if e, found := c.index[key]; found {
+		c.remove(e, "")
+		httpLog.Info("Removed item from cache", logger.Fields{"key": key})
+	}
+}
+
+// evict removes the least recently used items until the cache is within
+// its bounds. The caller holds the lock.
+func (c *Cache) evict() {
+	for c.maxEntries > 0 && c.items.Len() > c.maxEntries {
+		c.remove(c.items.Back(), evictEntries)
+	}
+	for c.maxBytes > 0 && c.bytes > c.maxBytes {
+		c.remove(c.items.Back(), evictBytes)
+	}
+}
+
+// remove unlinks an element, counting it as an eviction when reason is set.
+// The caller holds the lock.
+func (c *Cache) remove(e *list.Element, reason string) {
+	entry := c.items.Remove(e).(*cacheEntry)
+	delete(c.index, entry.key)
+	c.bytes -= entry.size
+	CacheEntries.Dec()
+	CacheBytes.Sub(float64(entry.size))
+	if reason != "" {
+		CacheEvictionsTotal.WithLabelValues(reason).Inc()
 	}
 }
 
@@ -119,8 +314,11 @@ func (c *Cache) Delete(key string) {
 func createCacheKey(r *http.Request) string {
 	// For simplicity, we'll use the request path and query as the cache key
 	// In a real-world scenario, you might want to include other things like authorization headers
+	// Strongly consistent reads refresh the entry of the plain request
 	path := r.URL.Path
-	query := r.URL.Query().Encode()
+	values := r.URL.Query()
+	values.Del(consistency.QueryParam)
+	query := values.Encode()
 
 	// Combine path and query and create a hash
 	keyStr := fmt.Sprintf("%s?%s", path, query)
@@ -145,10 +343,19 @@ func CacheMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Clients that must see their own writes skip the cached response,
+		// and so do the caches in front of the repositories
+		strong := consistency.Requested(r)
+		if strong {
+			r = r.WithContext(consistency.WithStrong(r.Context()))
+		}
+
 		// Skip caching for certain paths
 		if strings.HasPrefix(r.URL.Path, "/api/auth") ||
+			r.URL.Path == "/livez" ||
 			r.URL.Path == "/health" ||
 			r.URL.Path == "/health/detailed" ||
+			r.URL.Path == "/readyz" ||
 			r.URL.Path == "/metrics" {
 			next.ServeHTTP(w, r)
 			return
@@ -167,22 +374,34 @@ func CacheMiddleware(next http.Handler) http.Handler {
 		// Generate cache key
 		key := createCacheKey(r)
 
+		if strong && consistency.NoStore(r) {
+			w.Header().Set("X-Cache", "BYPASS")
+			CacheRequestsTotal.WithLabelValues("bypass").Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Check if we have a cached response
-		if item, found := responseCache.Get(key); found {
+		if item, found := responseCache.Get(key); found && !strong {
 			// Set the content type and status code from the cached response
 			w.Header().Set("Content-Type", item.ContentType)
+			if item.Location != "" {
+				// Cached redirects are useless without their target
+				w.Header().Set("Location", item.Location)
+			}
 			w.Header().Set("X-Cache", "HIT")
+			CacheRequestsTotal.WithLabelValues("hit").Inc()
 			w.WriteHeader(item.StatusCode)
 
 			// Write the cached content
 			_, err := w.Write(item.Content)
 			if err != nil {
-				logger.Error("Failed to write cached response", err, logger.Fields{
+				httpLog.Error("Failed to write cached response", err, logger.Fields{
 					"key": key,
 				})
 			}
 
-			logger.Info("Cache hit", logger.Fields{
+			httpLog.Info("Cache hit", logger.Fields{
 				"path": r.URL.Path,
 				"key":  key,
 			})
@@ -198,8 +417,15 @@ func CacheMiddleware(next http.Handler) http.Handler {
 			path:           r.URL.Path,
 		}
 
-		// Set header to indicate cache miss
-		w.Header().Set("X-Cache", "MISS")
+		// Set header to indicate cache miss; a strong read replaces the
+		// cached response with the fresh one
+		if strong {
+			w.Header().Set("X-Cache", "BYPASS")
+			CacheRequestsTotal.WithLabelValues("bypass").Inc()
+		} else {
+			w.Header().Set("X-Cache", "MISS")
+			CacheRequestsTotal.WithLabelValues("miss").Inc()
+		}
 
 		// Call the next handler with our custom response writer
 		next.ServeHTTP(crw, r)
@@ -260,9 +486,10 @@ func (crw *cachingResponseWriter) Close() {
 			contentType = "application/json" // Default content type
 		}
 
-		responseCache.Set(crw.key, crw.content.Bytes(), contentType, crw.statusCode, expiry)
+		location := crw.ResponseWriter.Header().Get("Location")
+		responseCache.Set(crw.key, crw.content.Bytes(), contentType, location, crw.statusCode, expiry)
 
-		logger.Info("Cached response", logger.Fields{
+		httpLog.Info("Cached response", logger.Fields{
 			"path":      crw.path,
 			"key":       crw.key,
 			"expiry":    expiry.String(),
@@ -5,6 +5,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/cache"
+	"github.com/Okabe-Junya/golink-backend/pkg/consistency"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
 )
 
 // userScopedHandler writes a body that depends on the X-User-ID header, standing
@@ -77,3 +84,190 @@ func TestCacheMiddleware_AnonymousResponsesStillCached(t *testing.T) {
 		t.Fatalf("upstream handler called %d times, want 1 (second served from cache)", calls)
 	}
 }
+
+// TestCacheMiddleware_CountsRequests checks the hit and miss counters. It
+// does not run in parallel, as the counters are shared.
+func TestCacheMiddleware_CountsRequests(t *testing.T) {
+	handler := CacheMiddleware(userScopedHandler())
+	hits := testutil.ToFloat64(CacheRequestsTotal.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(CacheRequestsTotal.WithLabelValues("miss"))
+
+	for range 3 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/cache-metrics-probe", nil))
+	}
+
+	if got := testutil.ToFloat64(CacheRequestsTotal.WithLabelValues("miss")) - misses; got != 1 {
+		t.Fatalf("misses = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(CacheRequestsTotal.WithLabelValues("hit")) - hits; got != 2 {
+		t.Fatalf("hits = %v, want 2", got)
+	}
+}
+
+// TestCacheMiddleware_StrongConsistency checks that a client asking for a
+// fresh read gets one, that it replaces the stale cached response, and that
+// the repository layer is told through the request context.
+func TestCacheMiddleware_StrongConsistency(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+	var strongCalls int
+	counting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if consistency.IsStrong(r.Context()) {
+			strongCalls++
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"n":%d}`, calls)
+	})
+	handler := CacheMiddleware(counting)
+
+	get := func(target string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr
+	}
+
+	const path = "/api/links/strong-consistency-probe"
+	get(path, nil)
+
+	fresh := get(path+"?consistency=strong", nil)
+	if got := fresh.Header().Get("X-Cache"); got != "BYPASS" {
+		t.Fatalf("strong read X-Cache = %q, want BYPASS", got)
+	}
+	if want := `{"n":2}`; fresh.Body.String() != want {
+		t.Fatalf("strong read body = %q, want %q", fresh.Body.String(), want)
+	}
+
+	// The fresh response replaced the stale one for ordinary reads
+	if got := get(path, nil).Body.String(); got != `{"n":2}` {
+		t.Fatalf("cached body after strong read = %q, want {\"n\":2}", got)
+	}
+
+	// no-store reads are fresh and leave the cache alone
+	if got := get(path, map[string]string{"Cache-Control": "no-store"}).Body.String(); got != `{"n":3}` {
+		t.Fatalf("no-store body = %q, want {\"n\":3}", got)
+	}
+	if got := get(path, nil).Body.String(); got != `{"n":2}` {
+		t.Fatalf("cached body after no-store read = %q, want {\"n\":2}", got)
+	}
+
+	if calls != 3 || strongCalls != 2 {
+		t.Fatalf("handler calls = %d (strong %d), want 3 (strong 2)", calls, strongCalls)
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	cache := NewCache(WithMaxEntries(2), WithMaxBytes(0))
+	cache.Set("a", []byte("1"), "text/plain", "", http.StatusOK, time.Minute)
+	cache.Set("b", []byte("2"), "text/plain", "", http.StatusOK, time.Minute)
+
+	// Reading a makes b the least recently used
+	if _, found := cache.Get("a"); !found {
+		t.Fatalf("a missing before eviction")
+	}
+	cache.Set("c", []byte("3"), "text/plain", "", http.StatusOK, time.Minute)
+
+	if _, found := cache.Get("b"); found {
+		t.Fatalf("b still cached, want it evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, found := cache.Get(key); !found {
+			t.Fatalf("%s evicted, want it cached", key)
+		}
+	}
+	if got := cache.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+}
+
+func TestCache_MaxBytes(t *testing.T) {
+	t.Parallel()
+
+	// Each item holds its one-byte key and 9 bytes of content
+	cache := NewCache(WithMaxEntries(0), WithMaxBytes(25))
+	cache.Set("a", make([]byte, 9), "", "", http.StatusOK, time.Minute)
+	cache.Set("b", make([]byte, 9), "", "", http.StatusOK, time.Minute)
+	cache.Set("c", make([]byte, 9), "", "", http.StatusOK, time.Minute)
+	if _, found := cache.Get("a"); found {
+		t.Fatalf("a still cached beyond the byte limit")
+	}
+	if got := cache.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+
+	// Responses larger than the cache are not stored and evict nothing
+	cache.Set("big", make([]byte, 100), "", "", http.StatusOK, time.Minute)
+	if _, found := cache.Get("big"); found {
+		t.Fatalf("oversized response cached")
+	}
+	if got := cache.Len(); got != 2 {
+		t.Fatalf("Len() after oversized Set = %d, want 2", got)
+	}
+
+	// Tightening the limits evicts right away
+	cache.SetLimits(1, 0)
+	if _, found := cache.Get("c"); !found || cache.Len() != 1 {
+		t.Fatalf("SetLimits kept %d items, want only c", cache.Len())
+	}
+}
+
+func TestCache_ExpiredItemsRemoved(t *testing.T) {
+	t.Parallel()
+
+	cache := NewCache()
+	cache.Set("old", []byte("x"), "", "", http.StatusOK, -time.Second)
+	cache.Set("new", []byte("x"), "", "", http.StatusOK, time.Minute)
+	if _, found := cache.Get("old"); found {
+		t.Fatalf("expired item returned")
+	}
+	cache.removeExpired(time.Now())
+	if got := cache.Len(); got != 1 {
+		t.Fatalf("Len() = %d, want 1", got)
+	}
+}
+
+func TestCacheMiddleware_SharedStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	SetResponseStore(NewSharedCache(cache.NewRedisStore(client, "test:")))
+	t.Cleanup(func() { SetResponseStore(memoryCache) })
+
+	// Two replicas serving the same cache
+	var calls int
+	counting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"n":%d}`, calls)
+	})
+	replicas := []http.Handler{CacheMiddleware(counting), CacheMiddleware(counting)}
+	serve := func(replica int, method string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		replicas[replica].ServeHTTP(rr, httptest.NewRequest(method, "/api/links/shared", nil))
+		return rr
+	}
+
+	serve(0, http.MethodGet)
+	if got := serve(1, http.MethodGet); got.Header().Get("X-Cache") != "HIT" || got.Body.String() != `{"n":1}` {
+		t.Fatalf("second replica got %q (%s), want the first replica's cached response", got.Body.String(), got.Header().Get("X-Cache"))
+	}
+
+	// A write through one replica invalidates the response for both
+	serve(0, http.MethodPut)
+	if got := serve(1, http.MethodGet); got.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("X-Cache after a write = %q, want MISS", got.Header().Get("X-Cache"))
+	}
+
+	// Without Redis, responses are served fresh
+	server.Close()
+	if got := serve(0, http.MethodGet); got.Code != http.StatusOK || got.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("response with Redis down = %d (%s), want a fresh 200", got.Code, got.Header().Get("X-Cache"))
+	}
+}
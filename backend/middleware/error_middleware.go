@@ -3,8 +3,6 @@ package middleware
 import (
 	"encoding/json"
 	"net/http"
-
-	"github.com/Okabe-Junya/golink-backend/logger"
 )
 
 // APIError represents a standardized API error response
@@ -21,6 +19,7 @@ const (
 	ErrForbidden           = "FORBIDDEN"
 	ErrNotFound            = "NOT_FOUND"
 	ErrConflict            = "CONFLICT"
+	ErrGone                = "GONE"
 	ErrInternalServerError = "INTERNAL_SERVER_ERROR"
 )
 
@@ -65,7 +64,7 @@ func ErrorHandler(next http.Handler) http.Handler {
 			if err := json.NewEncoder(w).Encode(map[string]interface{}{
 				"error": apiErr,
 			}); err != nil {
-				logger.Error("Failed to encode error response", err, nil)
+				httpLog.Error("Failed to encode error response", err, nil)
 			}
 		}
 	})
@@ -91,6 +90,25 @@ func (crw *customResponseWriter) Write(b []byte) (int, error) {
 	return crw.ResponseWriter.Write(b)
 }
 
+// ErrorCode returns the API error code of an HTTP error status
+func ErrorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusGone:
+		return ErrGone
+	}
+	return ErrInternalServerError
+}
+
 // RespondWithError is a helper function to respond with a standardized error
 func RespondWithError(w http.ResponseWriter, status int, code string, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -105,6 +123,6 @@ func RespondWithError(w http.ResponseWriter, status int, code string, message st
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
 		"error": apiErr,
 	}); err != nil {
-		logger.Error("Failed to encode error response", err, nil)
+		httpLog.Error("Failed to encode error response", err, nil)
 	}
 }
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceIDLabel is the exemplar label Grafana follows to a trace
+const traceIDLabel = "trace_id"
+
+// traceExemplar returns the exemplar labels of a request's sampled trace, or
+// nil when it is not traced. The trace is the span in the request's context
+// or, failing that, one propagated by an upstream proxy in the request headers.
+func traceExemplar(r *http.Request) prometheus.Labels {
+	sc := trace.SpanContextFromContext(r.Context())
+	if !sc.IsValid() {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		sc = trace.SpanContextFromContext(ctx)
+	}
+	if !sc.IsValid() || !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{traceIDLabel: sc.TraceID().String()}
+}
+
+// observe records a value, attaching the exemplar if there is one
+func observe(observer prometheus.Observer, value float64, exemplar prometheus.Labels) {
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(value, exemplar)
+		return
+	}
+	observer.Observe(value)
+}
+
+// increment adds one to a counter, attaching the exemplar if there is one
+func increment(counter prometheus.Counter, exemplar prometheus.Labels) {
+	if ea, ok := counter.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		ea.AddWithExemplar(1, exemplar)
+		return
+	}
+	counter.Inc()
+}
+
+// MetricsHandler serves the registered metrics. Scrapers that accept the
+// OpenMetrics format also receive the exemplars linking latency buckets to
+// example traces; others get the classic text format without them.
+func MetricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}))
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestMetricsExemplars(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(previous)
+
+	const (
+		sampledTrace   = "4bf92f3577b34da6a3ce929d0e0e4736"
+		unsampledTrace = "0af7651916cd43dd8448eb211c80319c"
+	)
+	handler := Metrics()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method, traceparent string) {
+		req := httptest.NewRequest(method, "/health", nil)
+		req.Header.Set("traceparent", traceparent)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve(http.MethodGet, "00-"+sampledTrace+"-00f067aa0ba902b7-01")
+	serve(http.MethodHead, "00-"+unsampledTrace+"-00f067aa0ba902b7-00")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rr := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rr, req)
+
+	var sampled, unsampled bool
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "golink_request_duration_seconds_bucket{") || !strings.Contains(line, `path="/health"`) {
+			continue
+		}
+		if strings.Contains(line, `trace_id="`+sampledTrace+`"`) {
+			sampled = true
+		}
+		if strings.Contains(line, `trace_id="`+unsampledTrace+`"`) {
+			unsampled = true
+		}
+	}
+	if !sampled {
+		t.Error("expected an exemplar with the sampled trace ID")
+	}
+	if unsampled {
+		t.Error("unsampled traces must not become exemplars")
+	}
+}
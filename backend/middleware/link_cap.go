@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Headers of responses built from a listing of links cut short by the cap
+const (
+	LinksTruncatedHeader = "X-Links-Truncated"
+	LinksLimitHeader     = "X-Links-Limit"
+)
+
+// TruncatedListingsTotal counts the requests whose listing of links was cut
+// short by the cap, by path
+var TruncatedListingsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "golink_link_listings_truncated_total",
+		Help: "Total number of requests whose listing of links was cut short by MAX_LINKS_PER_REQUEST, by path",
+	},
+	[]string{"path"},
+)
+
+// LinkCap loads at most limit links in each listing of every link a request
+// makes (see package linkcap). Responses built from a listing that left
+// links out carry "X-Links-Truncated: true" and the cap in X-Links-Limit,
+// and are logged as warnings. A limit that is not positive disables the cap.
+func LinkCap(limit int) Middleware {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(linkcap.With(r.Context(), limit))
+			next.ServeHTTP(&linkCapResponseWriter{ResponseWriter: w, r: r, limit: limit}, r)
+
+			if linkcap.Truncated(r.Context()) {
+				path := normalizePath(r.URL.Path)
+				TruncatedListingsTotal.WithLabelValues(path).Inc()
+				httpLog.Warn("Listing of links truncated; raise MAX_LINKS_PER_REQUEST or paginate", logger.Fields{
+					"path":  path,
+					"limit": limit,
+				})
+			}
+		})
+	}
+}
+
+// linkCapResponseWriter flags the response as truncated when its headers
+// are written after a listing was cut short
+type linkCapResponseWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	limit       int
+	wroteHeader bool
+}
+
+func (w *linkCapResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if linkcap.Truncated(w.r.Context()) {
+			w.Header().Set(LinksTruncatedHeader, "true")
+			w.Header().Set(LinksLimitHeader, strconv.Itoa(w.limit))
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *linkCapResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *linkCapResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
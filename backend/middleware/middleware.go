@@ -7,7 +7,6 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/auth"
@@ -19,6 +18,9 @@ import (
 )
 
 var (
+	// httpLog logs requests and the middleware handling them
+	httpLog = logger.For("http")
+
 	// RequestsTotal counts total HTTP requests by path and method
 	RequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -54,6 +56,16 @@ var (
 		},
 	)
 
+	// RateLimitedTotal counts the requests rejected by the rate limiter, by
+	// route class and by whether the client IP or the user ran out of requests
+	RateLimitedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_rate_limited_requests_total",
+			Help: "Total number of requests rejected by the rate limiter, by route class and limit",
+		},
+		[]string{"class", "reason"},
+	)
+
 	// ErrorsTotal counts HTTP errors
 	ErrorsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -89,7 +101,7 @@ func Logging() Middleware {
 
 			// Log the request
 			duration := time.Since(start)
-			logger.Info("Request completed", logger.Fields{
+			httpLog.Info("Request completed", logger.Fields{
 				"method":     r.Method,
 				"path":       r.URL.Path,
 				"query":      r.URL.RawQuery,
@@ -109,7 +121,7 @@ func Recover() Middleware {
 				if err := recover(); err != nil {
 					// Log the error and stack trace
 					stackTrace := debug.Stack()
-					logger.Error("Request handler panic", fmt.Errorf("%v", err), logger.Fields{
+					httpLog.Error("Request handler panic", fmt.Errorf("%v", err), logger.Fields{
 						"path":        r.URL.Path,
 						"method":      r.Method,
 						"remoteAddr":  r.RemoteAddr,
@@ -128,59 +140,55 @@ func Recover() Middleware {
 	}
 }
 
-// Authenticate checks if the request is authenticated
+// Authenticate adds the user of authenticated requests to the context: the
+// one of a session token or API key, or the one a trusted proxy names when
+// TRUSTED_PROXY_AUTH is on. Other requests continue without a user.
 func Authenticate() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get user ID from header for backward compatibility
-			userID := r.Header.Get("X-User-ID")
-			if userID != "" {
-				// Create a minimal user with just the ID
-				user := &auth.User{
-					ID:    userID,
-					Email: r.Header.Get("X-User-Email"),
-					Name:  r.Header.Get("X-User-Name"),
-				}
-
-				// Add user to context
-				ctx := r.Context()
-				ctx = context.WithValue(ctx, "user", user)
-				next.ServeHTTP(w, r.WithContext(ctx))
+			user, err := auth.GetCurrentUser(r)
+			if err != nil {
+				// Continue without authentication for public endpoints
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Continue without authentication for public endpoints
-			next.ServeHTTP(w, r)
+			ctx := context.WithValue(r.Context(), "user", user)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// RequireAuth requires authentication for the handler
+// RequireAuth requires authentication for the handler, as Authenticate
+// recognizes it
 func RequireAuth() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get user from header
-			userID := r.Header.Get("X-User-ID")
-			if userID == "" {
+			user, err := auth.GetCurrentUser(r)
+			if err != nil {
 				response.Error(w, errors.NewUnauthorized("認証が必要です"))
 				return
 			}
 
-			// Create a minimal user with just the ID
-			user := &auth.User{
-				ID:    userID,
-				Email: r.Header.Get("X-User-Email"),
-				Name:  r.Header.Get("X-User-Name"),
-			}
-
-			// Add user to context
-			ctx := r.Context()
-			ctx = context.WithValue(ctx, "user", user)
+			ctx := context.WithValue(r.Context(), "user", user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// RequireRole lets only users with role, or a role above it, through:
+// others get a 401 when signed out and a 403 otherwise
+func RequireRole(role string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.RequireRole(w, r, role) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // CORS adds CORS headers to the response
 func CORS(allowedOrigins []string) Middleware {
 	return func(next http.Handler) http.Handler {
@@ -200,7 +208,7 @@ func CORS(allowedOrigins []string) Middleware {
 			if allowed {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID, X-User-Email, X-User-Name")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Cache-Control")
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
 			}
 
@@ -235,19 +243,20 @@ func Metrics() Middleware {
 			// Get normalized path for metrics (prevent cardinality explosion)
 			path := normalizePath(r.URL.Path)
 
-			// Record metrics
+			// Record metrics, linking them to the request's trace if it is traced
 			duration := time.Since(start).Seconds()
-			RequestDuration.WithLabelValues(path, r.Method).Observe(duration)
-			RequestsTotal.WithLabelValues(path, r.Method, strconv.Itoa(ww.status)).Inc()
+			exemplar := traceExemplar(r)
+			observe(RequestDuration.WithLabelValues(path, r.Method), duration, exemplar)
+			increment(RequestsTotal.WithLabelValues(path, r.Method, strconv.Itoa(ww.status)), exemplar)
 
 			// Record error metrics for 4xx and 5xx responses
 			if ww.status >= 400 {
-				ErrorsTotal.WithLabelValues(path, r.Method, strconv.Itoa(ww.status)).Inc()
+				increment(ErrorsTotal.WithLabelValues(path, r.Method, strconv.Itoa(ww.status)), exemplar)
 			}
 
 			// Track redirects
 			if path == "/{short}" {
-				RedirectsTotal.Inc()
+				increment(RedirectsTotal, exemplar)
 			}
 		})
 	}
@@ -284,79 +293,6 @@ func SecurityHeaders() Middleware {
 	}
 }
 
-// RateLimit limits the rate of requests per client IP
-func RateLimit() Middleware {
-	// Simple in-memory rate limiter
-	type client struct {
-		lastSeen     time.Time
-		blockedUntil time.Time
-		count        int
-	}
-	clients := make(map[string]*client)
-	var mu sync.Mutex
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get client IP
-			ip := r.RemoteAddr
-			if fwdIP := r.Header.Get("X-Forwarded-For"); fwdIP != "" {
-				ip = strings.Split(fwdIP, ",")[0]
-			}
-
-			// Check if client is rate limited
-			mu.Lock()
-			defer mu.Unlock()
-
-			now := time.Now()
-			// Clean up old clients every 100 requests, but only when we have clients
-			if len(clients) > 0 && len(clients)%100 == 0 {
-				for clientIP, c := range clients {
-					if now.Sub(c.lastSeen) > 5*time.Minute {
-						delete(clients, clientIP)
-					}
-				}
-			}
-
-			// Get or create client
-			c, exists := clients[ip]
-			if !exists {
-				c = &client{
-					lastSeen:     now,
-					count:        0,
-					blockedUntil: time.Time{},
-				}
-				clients[ip] = c
-			}
-
-			// Check if client is blocked
-			if !c.blockedUntil.IsZero() && now.Before(c.blockedUntil) {
-				w.Header().Set("Retry-After", strconv.Itoa(int(c.blockedUntil.Sub(now).Seconds())))
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-				return
-			}
-
-			// Reset counter if last request was more than a minute ago
-			if now.Sub(c.lastSeen) > time.Minute {
-				c.count = 0
-			}
-
-			// Increment counter
-			c.count++
-			c.lastSeen = now
-
-			// Block client if too many requests
-			if c.count > 100 { // 100 requests per minute
-				c.blockedUntil = now.Add(time.Minute)
-				w.Header().Set("Retry-After", "60")
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
 // ResponseWriter is a wrapper around http.ResponseWriter that captures the status code
 type ResponseWriter struct {
 	http.ResponseWriter
@@ -403,18 +339,92 @@ func (w *statusResponseWriter) WriteHeader(statusCode int) {
 // normalizePath returns a normalized path for metrics to prevent cardinality explosion
 func normalizePath(path string) string {
 	// Special case for redirects
-	if !strings.HasPrefix(path, "/api/") && path != "/health" && path != "/" {
+	if !strings.HasPrefix(path, "/api/") {
+		switch path {
+		case "/", "/livez", "/health", "/health/detailed", "/readyz", "/metrics":
+			return path
+		}
 		return "/{short}"
 	}
 
-	// Replace dynamic parts in API paths
+	// Replace dynamic parts in API paths. Short codes may contain slashes, so
+	// per-link endpoints are recognized by their last segments.
 	if strings.HasPrefix(path, "/api/links/") && len(path) > len("/api/links/") {
-		return "/api/links/{short}"
+		return normalizeLinkPath(path[len("/api/links/"):])
+	}
+
+	if strings.HasPrefix(path, "/api/namespaces/") && len(path) > len("/api/namespaces/") {
+		return "/api/namespaces/{ns}/links"
+	}
+
+	if strings.HasPrefix(path, "/api/auth/tokens/") && len(path) > len("/api/auth/tokens/") {
+		if strings.HasSuffix(path, "/usage") {
+			return "/api/auth/tokens/{id}/usage"
+		}
+		return "/api/auth/tokens/{id}"
+	}
+
+	if strings.HasPrefix(path, "/api/apikeys/") && len(path) > len("/api/apikeys/") {
+		if strings.HasSuffix(path, "/usage") {
+			return "/api/apikeys/{id}/usage"
+		}
+		return "/api/apikeys/{id}"
+	}
+
+	if strings.HasPrefix(path, "/api/auth/passkeys/") && len(path) > len("/api/auth/passkeys/") {
+		if path == "/api/auth/passkeys/options" || path == "/api/auth/passkeys/recovery-codes" {
+			return path
+		}
+		return "/api/auth/passkeys/{id}"
+	}
+
+	if strings.HasPrefix(path, "/api/admin/users/") && len(path) > len("/api/admin/users/") {
+		return "/api/admin/users/{email}"
+	}
+
+	if strings.HasPrefix(path, "/api/admin/captures/") && len(path) > len("/api/admin/captures/") {
+		return "/api/admin/captures/{id}"
+	}
+
+	if strings.HasPrefix(path, "/api/webhooks/") && len(path) > len("/api/webhooks/") {
+		return "/api/webhooks/{id}"
 	}
 
 	if strings.HasPrefix(path, "/api/analytics/links/") && len(path) > len("/api/analytics/links/") {
+		if strings.HasSuffix(path, "/timeseries") {
+			return "/api/analytics/links/{short}/timeseries"
+		}
+		if strings.HasSuffix(path, "/forecast") {
+			return "/api/analytics/links/{short}/forecast"
+		}
+		if strings.HasSuffix(path, "/referrers") {
+			return "/api/analytics/links/{short}/referrers"
+		}
 		return "/api/analytics/links/{short}"
 	}
 
 	return path
 }
+
+// normalizeLinkPath normalizes the part of a /api/links/ path after the prefix
+func normalizeLinkPath(rest string) string {
+	switch rest {
+	case "expired", "favorites", "resolve", "search", "trash":
+		return "/api/links/" + rest
+	}
+	if strings.Contains(rest, "/aliases/") {
+		return "/api/links/{short}/aliases/{alias}"
+	}
+	if strings.HasSuffix(rest, "/transfer/accept") {
+		return "/api/links/{short}/transfer/accept"
+	}
+	if strings.HasSuffix(rest, "/snapshot/restore") {
+		return "/api/links/{short}/snapshot/restore"
+	}
+	for _, sub := range []string{"aliases", "archive", "deprecation", "favorite", "history", "preview", "references", "rename", "restore", "rollback", "rollout", "snapshot", "transfer", "undo-delete"} {
+		if strings.HasSuffix(rest, "/"+sub) {
+			return "/api/links/{short}/" + sub
+		}
+	}
+	return "/api/links/{short}"
+}
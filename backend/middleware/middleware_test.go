@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+)
+
+func TestNormalizePath(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"/docs":                                 "/{short}",
+		"/team/docs":                            "/{short}",
+		"/health":                               "/health",
+		"/api/links":                            "/api/links",
+		"/api/links/trash":                      "/api/links/trash",
+		"/api/links/docs":                       "/api/links/{short}",
+		"/api/links/team/docs":                  "/api/links/{short}",
+		"/api/links/team/docs/history":          "/api/links/{short}/history",
+		"/api/links/team/docs/aliases/old-docs": "/api/links/{short}/aliases/{alias}",
+		"/api/links/team/docs/transfer/accept":  "/api/links/{short}/transfer/accept",
+		"/api/links/team/docs/favorite":         "/api/links/{short}/favorite",
+		"/api/links/team/docs/archive":          "/api/links/{short}/archive",
+		"/api/links/old-wiki/deprecation":       "/api/links/{short}/deprecation",
+		"/api/links/old-wiki/rename":            "/api/links/{short}/rename",
+		"/api/links/docs/snapshot/restore":      "/api/links/{short}/snapshot/restore",
+		"/api/links/favorites":                  "/api/links/favorites",
+		"/api/namespaces/team/links":            "/api/namespaces/{ns}/links",
+		"/api/analytics/links/team/docs":        "/api/analytics/links/{short}",
+		"/api/analytics/links/docs/timeseries":  "/api/analytics/links/{short}/timeseries",
+		"/api/analytics/links/docs/forecast":    "/api/analytics/links/{short}/forecast",
+		"/api/analytics/links/docs/referrers":   "/api/analytics/links/{short}/referrers",
+		"/api/auth/tokens/0a1b2c3d":             "/api/auth/tokens/{id}",
+		"/api/auth/tokens/0a1b2c3d/usage":       "/api/auth/tokens/{id}/usage",
+		"/api/apikeys/0a1b2c3d":                 "/api/apikeys/{id}",
+		"/api/apikeys/0a1b2c3d/usage":           "/api/apikeys/{id}/usage",
+		"/api/admin/captures/0a1b2c3d":          "/api/admin/captures/{id}",
+		"/api/admin/users/ann@example.com":      "/api/admin/users/{email}",
+		"/api/webhooks/0a1b2c3d":                "/api/webhooks/{id}",
+		"/api/auth/passkeys/Y3JlZGVudGlhbA":     "/api/auth/passkeys/{id}",
+		"/api/auth/passkeys/options":            "/api/auth/passkeys/options",
+	}
+
+	for path, want := range tests {
+		if got := normalizePath(path); got != want {
+			t.Errorf("normalizePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestLinkCap(t *testing.T) {
+	links := []*models.Link{
+		models.NewLink("a", "https://a.example.com", "user1"),
+		models.NewLink("b", "https://b.example.com", "user1"),
+	}
+	handler := LinkCap(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") == "true" {
+			linkcap.Apply(r.Context(), links)
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/links", nil))
+	if got := rr.Header().Get(LinksTruncatedHeader); got != "" {
+		t.Errorf("complete response has %s: %q", LinksTruncatedHeader, got)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/links?all=true", nil))
+	if got := rr.Header().Get(LinksTruncatedHeader); got != "true" {
+		t.Errorf("%s = %q, want true", LinksTruncatedHeader, got)
+	}
+	if got := rr.Header().Get(LinksLimitHeader); got != "1" {
+		t.Errorf("%s = %q, want 1", LinksLimitHeader, got)
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	t.Setenv("AUTH_DISABLED", "false")
+	t.Setenv("GOOGLE_CLIENT_ID", "test-client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
+	if err := auth.InitAuth(); err != nil {
+		t.Fatalf("InitAuth failed: %v", err)
+	}
+
+	var authenticated *auth.User
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated, _ = r.Context().Value("user").(*auth.User)
+	})
+
+	// A spoofed X-User-ID header neither authenticates nor names a user
+	req := httptest.NewRequest(http.MethodGet, "/api/links", nil)
+	req.Header.Set("X-User-ID", "victim")
+	rr := httptest.NewRecorder()
+	RequireAuth()(next).ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("RequireAuth with a spoofed header = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	rr = httptest.NewRecorder()
+	Authenticate()(next).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || authenticated != nil {
+		t.Errorf("Authenticate with a spoofed header = %d with user %v, want %d without one", rr.Code, authenticated, http.StatusOK)
+	}
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+)
+
+// Route classes requests are rate limited by
+const (
+	// RouteClassAPI is every request under /api/ by default
+	RouteClassAPI = "api"
+	// RouteClassRedirect is every other request by default, redirects above all
+	RouteClassRedirect = "redirect"
+	// RouteClassExempt is never rate limited: health checks and metrics by
+	// default
+	RouteClassExempt = "exempt"
+)
+
+// RateLimitClass limits the requests of one route class, per client IP
+// and per signed-in user. Zero rates limit nothing.
+type RateLimitClass struct {
+	PerIP   ratelimit.Rate
+	PerUser ratelimit.Rate
+}
+
+// RateLimitPolicy assigns requests to route classes by their normalized
+// route, such as "/api/links/{short}" or "/{short}", and limits each class
+type RateLimitPolicy struct {
+	// Classes limits each route class by name. Classes missing from it,
+	// such as RouteClassExempt, are not limited.
+	Classes map[string]RateLimitClass
+	// Routes assigns normalized routes to classes, overriding the class of
+	// their path. A route ending in "*" matches the routes it prefixes; the
+	// longest match wins.
+	Routes map[string]string
+}
+
+// DefaultRateLimitPolicy returns the policy used when none is configured.
+// Redirects come in bursts, when a link is shared in a meeting or a chat
+// behind one office IP, so they are allowed ten times the API's rate:
+// 1000 requests a minute per client IP and 3000 per user, against 100 and
+// 300. Health checks and metrics are exempt.
+func DefaultRateLimitPolicy() RateLimitPolicy {
+	return RateLimitPolicy{
+		Classes: map[string]RateLimitClass{
+			RouteClassAPI: {
+				PerIP:   ratelimit.Rate{Burst: 100, Period: time.Minute},
+				PerUser: ratelimit.Rate{Burst: 300, Period: time.Minute},
+			},
+			RouteClassRedirect: {
+				PerIP:   ratelimit.Rate{Burst: 1000, Period: time.Minute},
+				PerUser: ratelimit.Rate{Burst: 3000, Period: time.Minute},
+			},
+		},
+		Routes: DefaultExemptRoutes(),
+	}
+}
+
+// DefaultExemptRoutes returns the routes exempt from rate limits by
+// default: those probed by load balancers and scraped by Prometheus
+func DefaultExemptRoutes() map[string]string {
+	return map[string]string{
+		"/livez":           RouteClassExempt,
+		"/health":          RouteClassExempt,
+		"/health/detailed": RouteClassExempt,
+		"/readyz":          RouteClassExempt,
+		"/metrics":         RouteClassExempt,
+	}
+}
+
+// ParseRateLimitRoutes parses route classes such as
+// "/api/links/search=search,/api/admin/*=admin"
+func ParseRateLimitRoutes(entries []string) (map[string]string, error) {
+	routes := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		route, class, found := strings.Cut(entry, "=")
+		route, class = strings.TrimSpace(route), strings.TrimSpace(class)
+		if !found || !strings.HasPrefix(route, "/") || class == "" {
+			return nil, fmt.Errorf("invalid rate limit route %q: want route=class, such as /api/links/search=search", entry)
+		}
+		routes[route] = class
+	}
+	return routes, nil
+}
+
+// ParseRateLimitClasses parses the rates of route classes such as
+// "search=30/1m:60/1m", the rate per client IP and, optionally, per user
+func ParseRateLimitClasses(entries []string) (map[string]RateLimitClass, error) {
+	classes := make(map[string]RateLimitClass, len(entries))
+	for _, entry := range entries {
+		name, rates, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid rate limit class %q: want class=rate[:user rate], such as search=30/1m:60/1m", entry)
+		}
+		perIP, perUser, _ := strings.Cut(rates, ":")
+		var class RateLimitClass
+		var err error
+		if class.PerIP, err = ratelimit.ParseRate(perIP); err != nil {
+			return nil, fmt.Errorf("rate limit class %q: %w", name, err)
+		}
+		if class.PerUser, err = ratelimit.ParseRate(perUser); err != nil {
+			return nil, fmt.Errorf("rate limit class %q: %w", name, err)
+		}
+		classes[name] = class
+	}
+	return classes, nil
+}
+
+// Class returns the route class of a request
+func (p RateLimitPolicy) Class(r *http.Request) string {
+	route := normalizePath(r.URL.Path)
+	if class, ok := p.Routes[route]; ok {
+		return class
+	}
+	// The longest prefix wins, whatever order the map is read in
+	prefixes := make([]string, 0, len(p.Routes))
+	for pattern := range p.Routes {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(route, prefix) {
+			prefixes = append(prefixes, pattern)
+		}
+	}
+	if len(prefixes) > 0 {
+		sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+		return p.Routes[prefixes[0]]
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return RouteClassAPI
+	}
+	return RouteClassRedirect
+}
+
+// RateLimit limits the rate of requests per client IP using a process-local
+// limiter and the default policy
+func RateLimit() Middleware {
+	return RateLimitPerIP(ratelimit.NewMemoryStore(), DefaultRateLimitPolicy())
+}
+
+// RateLimitPerIP limits the rate of requests per client IP and route class,
+// taking tokens from the buckets of limiter. A limiter in Redis shares the
+// limits between replicas. The client IP is the one auth.ClientIP trusts, so
+// clients cannot pick a fresh bucket through X-Forwarded-For.
+func RateLimitPerIP(limiter ratelimit.Limiter, policy RateLimitPolicy) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			class := policy.Class(r)
+			if allowRequest(w, r, limiter, policy.Classes[class].PerIP, class, "ip", auth.ClientIP(r)) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// RateLimitPerUser limits the rate of requests per signed-in user and route
+// class, as userID tells them apart. It runs after authentication;
+// anonymous requests are left to RateLimitPerIP.
+func RateLimitPerUser(limiter ratelimit.Limiter, policy RateLimitPolicy, userID func(*http.Request) string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := userID(r)
+			if user == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			class := policy.Class(r)
+			if allowRequest(w, r, limiter, policy.Classes[class].PerUser, class, "user", user) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// allowRequest takes a token for the request from the bucket of the client
+// named id, setting the RateLimit-* headers. Out of tokens, it writes a 429
+// response and returns false.
+func allowRequest(w http.ResponseWriter, r *http.Request, limiter ratelimit.Limiter, rate ratelimit.Rate, class, reason, id string) bool {
+	if !rate.Enabled() {
+		return true
+	}
+	decision, err := limiter.Allow(r.Context(), "ratelimit:"+class+":"+reason+":"+id, rate)
+	if err != nil {
+		// Fail open: a broken limiter must not take the service down
+		httpLog.Error("Failed to check rate limit", err, logger.Fields{"class": class, "reason": reason})
+		return true
+	}
+	setRateLimitHeaders(w, rate, decision)
+	if decision.Allowed {
+		return true
+	}
+	RateLimitedTotal.WithLabelValues(class, reason).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+	http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+	return false
+}
+
+// setRateLimitHeaders describes the bucket a request took a token from in
+// the RateLimit-* headers of the IETF draft, unless a bucket with fewer
+// tokens left already did
+func setRateLimitHeaders(w http.ResponseWriter, rate ratelimit.Rate, decision ratelimit.Decision) {
+	header := w.Header()
+	if set, err := strconv.Atoi(header.Get("RateLimit-Remaining")); err == nil && set <= decision.Remaining {
+		return
+	}
+	header.Set("RateLimit-Limit", strconv.Itoa(rate.Burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+	header.Set("RateLimit-Policy", strconv.Itoa(rate.Burst)+";w="+strconv.Itoa(ceilSeconds(rate.Period)))
+}
+
+// ceilSeconds rounds d up to whole seconds, and at least one
+func ceilSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+)
+
+func TestRateLimitPerIP(t *testing.T) {
+	policy := RateLimitPolicy{Classes: map[string]RateLimitClass{
+		RouteClassAPI:      {PerIP: ratelimit.Rate{Burst: 2, Period: time.Minute}},
+		RouteClassRedirect: {PerIP: ratelimit.Rate{Burst: 1, Period: time.Minute}},
+	}}
+	handler := RateLimitPerIP(ratelimit.NewMemoryStore(), policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path, ip string, forwardedFor ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		for _, addr := range forwardedFor {
+			req.Header.Add("X-Forwarded-For", addr)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("/api/links", "192.0.2.1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", rr.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", rr.Header().Get("RateLimit-Policy"))
+	assert.Equal(t, http.StatusOK, serve("/api/links", "192.0.2.1").Code)
+
+	rr = serve("/api/links", "192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, serve("/docs", "192.0.2.1").Code, "redirects have their own bucket")
+	assert.Equal(t, http.StatusTooManyRequests, serve("/docs", "192.0.2.1").Code)
+	assert.Equal(t, http.StatusOK, serve("/api/links", "192.0.2.2").Code, "each client IP has its own bucket")
+
+	// A client cannot pick a fresh bucket through X-Forwarded-For
+	assert.Equal(t, http.StatusOK, serve("/api/links", "192.0.2.3", "198.51.100.1").Code)
+	assert.Equal(t, http.StatusOK, serve("/api/links", "192.0.2.3", "198.51.100.2").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/api/links", "192.0.2.3", "198.51.100.3").Code)
+
+	// Behind a trusted proxy, the address it appends names the client
+	auth.SetTrustedProxyHops(1)
+	t.Cleanup(func() { auth.SetTrustedProxyHops(0) })
+	assert.Equal(t, http.StatusOK, serve("/api/links", "10.0.0.1", "192.0.2.4").Code)
+	assert.Equal(t, http.StatusOK, serve("/api/links", "10.0.0.1", "203.0.113.9, 192.0.2.4").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/api/links", "10.0.0.1", "203.0.113.8, 192.0.2.4").Code)
+	assert.Equal(t, http.StatusOK, serve("/api/links", "10.0.0.1", "192.0.2.5").Code)
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	limiter := ratelimit.NewMemoryStore()
+	policy := RateLimitPolicy{Classes: map[string]RateLimitClass{
+		RouteClassAPI: {
+			PerIP:   ratelimit.Rate{Burst: 10, Period: time.Minute},
+			PerUser: ratelimit.Rate{Burst: 1, Period: time.Minute},
+		},
+	}}
+	userID := func(r *http.Request) string { return r.Header.Get("X-Test-User") }
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), RateLimitPerIP(limiter, policy), RateLimitPerUser(limiter, policy, userID))
+	serve := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/links", nil)
+		req.Header.Set("X-Test-User", user)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("alice")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Limit"), "the bucket with fewer tokens left is reported")
+	assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("alice").Code)
+	assert.Equal(t, http.StatusOK, serve("bob").Code, "each user has their own bucket")
+	assert.Equal(t, http.StatusOK, serve("").Code, "anonymous requests are only limited per IP")
+}
+
+func TestRateLimitPolicyClass(t *testing.T) {
+	policy := DefaultRateLimitPolicy()
+	routes, err := ParseRateLimitRoutes([]string{"/api/links/search=search", "/api/admin/*=admin", "/api/admin/doctor=exempt"})
+	require.NoError(t, err)
+	for route, class := range routes {
+		policy.Routes[route] = class
+	}
+
+	tests := map[string]string{
+		"/docs":                  RouteClassRedirect,
+		"/team/docs":             RouteClassRedirect,
+		"/api/links":             RouteClassAPI,
+		"/api/links/docs":        RouteClassAPI,
+		"/api/links/search":      "search",
+		"/api/admin/settings":    "admin",
+		"/api/admin/captures/42": "admin",
+		"/api/admin/doctor":      RouteClassExempt,
+		"/health":                RouteClassExempt,
+		"/health/detailed":       RouteClassExempt,
+		"/livez":                 RouteClassExempt,
+		"/readyz":                RouteClassExempt,
+		"/metrics":               RouteClassExempt,
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, policy.Class(httptest.NewRequest(http.MethodGet, path, nil)), path)
+	}
+
+	_, err = ParseRateLimitRoutes([]string{"search"})
+	assert.Error(t, err)
+}
+
+func TestParseRateLimitClasses(t *testing.T) {
+	classes, err := ParseRateLimitClasses([]string{"search=30/1m:60/1m", "admin=10/1m"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RateLimitClass{
+		"search": {PerIP: ratelimit.Rate{Burst: 30, Period: time.Minute}, PerUser: ratelimit.Rate{Burst: 60, Period: time.Minute}},
+		"admin":  {PerIP: ratelimit.Rate{Burst: 10, Period: time.Minute}},
+	}, classes)
+
+	for _, invalid := range []string{"search", "=30/1m", "search=30", "search=30/1m:x"} {
+		_, err := ParseRateLimitClasses([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRateLimitExemptRoutes(t *testing.T) {
+	policy := DefaultRateLimitPolicy()
+	policy.Classes[RouteClassRedirect] = RateLimitClass{PerIP: ratelimit.Rate{Burst: 1, Period: time.Minute}}
+	handler := RateLimitPerIP(ratelimit.NewMemoryStore(), policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for range 5 {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/cache"
+)
+
+// responseKeyPrefix namespaces cached responses in a shared store
+const responseKeyPrefix = "response:"
+
+// SharedCache keeps cached responses in a cache.Store, such as Redis, so
+// all replicas serve and invalidate the same responses. A store that fails
+// is treated as empty.
+type SharedCache struct {
+	store cache.Store
+}
+
+// Ensure SharedCache implements ResponseStore
+var _ ResponseStore = (*SharedCache)(nil)
+
+// NewSharedCache creates a response cache in store
+func NewSharedCache(store cache.Store) *SharedCache {
+	return &SharedCache{store: store}
+}
+
+// Get retrieves a cached response
+func (c *SharedCache) Get(key string) (CacheItem, bool) {
+	data, found, err := c.store.Get(context.Background(), responseKeyPrefix+key)
+	if err != nil {
+		httpLog.Warn("Failed to read shared response cache", logger.Fields{"key": key, "error": err.Error()})
+		return CacheItem{}, false
+	}
+	if !found {
+		return CacheItem{}, false
+	}
+	var item CacheItem
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&item); err != nil {
+		httpLog.Warn("Dropping undecodable cached response", logger.Fields{"key": key})
+		return CacheItem{}, false
+	}
+	return item, true
+}
+
+// Set caches a response for expiry
+func (c *SharedCache) Set(key string, content []byte, contentType, location string, statusCode int, expiry time.Duration) {
+	item := CacheItem{
+		Content:     content,
+		ContentType: contentType,
+		Location:    location,
+		StatusCode:  statusCode,
+		CreatedAt:   time.Now(),
+		Expiry:      expiry,
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(item); err != nil {
+		httpLog.Error("Failed to encode response for the cache", err, logger.Fields{"key": key})
+		return
+	}
+	if err := c.store.Set(context.Background(), responseKeyPrefix+key, data.Bytes(), expiry); err != nil {
+		httpLog.Warn("Failed to write shared response cache", logger.Fields{"key": key, "error": err.Error()})
+	}
+}
+
+// Delete removes a cached response
+func (c *SharedCache) Delete(key string) {
+	if err := c.store.Delete(context.Background(), responseKeyPrefix+key); err != nil {
+		httpLog.Error("Failed to invalidate shared response cache", err, logger.Fields{"key": key})
+	}
+}
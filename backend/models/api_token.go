@@ -0,0 +1,69 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// API token scopes
+const (
+	// TokenScopeRead allows reading requests such as GET
+	TokenScopeRead = "read"
+	// TokenScopeWrite allows every request, including ones that change links
+	TokenScopeWrite = "write"
+	// TokenScopeAdmin additionally allows admin endpoints
+	TokenScopeAdmin = "admin"
+)
+
+// tokenScopeRanks orders the scopes; a scope includes every lower one
+var tokenScopeRanks = map[string]int{
+	TokenScopeRead:  1,
+	TokenScopeWrite: 2,
+	TokenScopeAdmin: 3,
+}
+
+// APIToken is a long-lived credential a user issues for scripts and other
+// programmatic clients. Only a hash of the token's secret is stored.
+type APIToken struct {
+	CreatedAt  time.Time `json:"created_at" firestore:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty" firestore:"last_used_at,omitempty"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty" firestore:"revoked_at,omitempty"`
+	ID         string    `json:"id" firestore:"id"`
+	UserID     string    `json:"user_id" firestore:"user_id"`
+	Email      string    `json:"email" firestore:"email"`
+	Name       string    `json:"name" firestore:"name"`
+	// Service names the service account the token was issued for, such as a
+	// CI job; the token then authenticates as the service instead of its
+	// issuer
+	Service string `json:"service,omitempty" firestore:"service,omitempty"`
+	// SecretHash is the hex SHA-256 of the token's secret
+	SecretHash string   `json:"-" firestore:"secret_hash"`
+	Scopes     []string `json:"scopes" firestore:"scopes"`
+	// RequestsPerMinute and MonthlyQuota override the limits of the token's
+	// scopes when set
+	RequestsPerMinute int `json:"requests_per_minute,omitempty" firestore:"requests_per_minute,omitempty"`
+	MonthlyQuota      int `json:"monthly_quota,omitempty" firestore:"monthly_quota,omitempty"`
+}
+
+// IsActive reports whether the token has not been revoked
+func (t *APIToken) IsActive() bool {
+	return t.RevokedAt.IsZero()
+}
+
+// HasScope reports whether the token was granted scope. The admin scope
+// includes the write scope, which includes the read scope.
+func (t *APIToken) HasScope(scope string) bool {
+	rank, ok := tokenScopeRanks[scope]
+	if !ok {
+		return false
+	}
+	return slices.ContainsFunc(t.Scopes, func(granted string) bool {
+		return tokenScopeRanks[granted] >= rank
+	})
+}
+
+// IsTokenScope reports whether scope is a known API token scope
+func IsTokenScope(scope string) bool {
+	_, ok := tokenScopeRanks[scope]
+	return ok
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// ClickEvent is a single redirect through a link, as recorded in the link's
+// click stream and handed to analytics sinks such as exports. Raw
+// identifiers (IP address, user ID, precise location) are only present
+// before the privacy stage has anonymized it.
+type ClickEvent struct {
+	Time      time.Time `json:"time" firestore:"time"`
+	Short     string    `json:"short" firestore:"short"`
+	UserID    string    `json:"user_id,omitempty" firestore:"user_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty" firestore:"ip_address,omitempty"`
+	// IPHash is a keyed hash of the full IP address, so clicks from one
+	// address can be told apart within a salt period without storing it
+	IPHash    string  `json:"ip_hash,omitempty" firestore:"ip_hash,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty" firestore:"user_agent,omitempty"`
+	Referrer  string  `json:"referrer,omitempty" firestore:"referrer,omitempty"`
+	Country   string  `json:"country,omitempty" firestore:"country,omitempty"`
+	Region    string  `json:"region,omitempty" firestore:"region,omitempty"`
+	City      string  `json:"city,omitempty" firestore:"city,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty" firestore:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty" firestore:"longitude,omitempty"`
+	// ServedRegion is the deployment region the click was served for, such
+	// as "eu"; empty without region-aware redirects
+	ServedRegion string `json:"served_region,omitempty" firestore:"served_region,omitempty"`
+}
@@ -1,29 +1,72 @@
 package models
 
 import (
+	"maps"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Link represents a shortened URL with access control information
 type Link struct {
-	CreatedAt    time.Time `json:"created_at" firestore:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" firestore:"updated_at"`
-	ExpiresAt    time.Time `json:"expires_at,omitempty" firestore:"expires_at,omitempty"`
-	ID           string    `json:"id" firestore:"id"`
-	Short        string    `json:"short" firestore:"short"`
-	URL          string    `json:"url" firestore:"url"`
-	CreatedBy    string    `json:"created_by" firestore:"created_by"`
-	AccessLevel  string    `json:"access_level" firestore:"access_level"`
-	AllowedUsers []string  `json:"allowed_users" firestore:"allowed_users"`
-	ClickCount   int       `json:"click_count" firestore:"click_count"`
-	IsExpired    bool      `json:"is_expired" firestore:"is_expired"`
+	CreatedAt       time.Time `json:"created_at" firestore:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" firestore:"updated_at"`
+	ExpiresAt       time.Time `json:"expires_at,omitempty" firestore:"expires_at,omitempty"`
+	DeletedAt       time.Time `json:"deleted_at,omitzero" firestore:"deleted_at,omitempty"`
+	HealthCheckedAt time.Time `json:"health_checked_at,omitzero" firestore:"health_checked_at,omitempty"`
+	LastClickedAt   time.Time `json:"last_clicked_at,omitzero" firestore:"last_clicked_at,omitempty"`
+	// ArchivedAt is set while the link is archived
+	ArchivedAt time.Time `json:"archived_at,omitzero" firestore:"archived_at,omitempty"`
+	// ScoredAt is when the popularity score was last brought up to date
+	ScoredAt time.Time `json:"scored_at,omitzero" firestore:"scored_at,omitempty"`
+	// Deprecation is set while the link is superseded by another
+	Deprecation *LinkDeprecation `json:"deprecation,omitempty" firestore:"deprecation,omitempty"`
+	// Rollout is set while traffic is gradually moving to a new destination
+	Rollout *LinkRollout `json:"rollout,omitempty" firestore:"rollout,omitempty"`
+	// PendingTransfer is set while the owner offers the link to another user
+	PendingTransfer *LinkTransfer `json:"pending_transfer,omitempty" firestore:"pending_transfer,omitempty"`
+	ID              string        `json:"id" firestore:"id"`
+	Short           string        `json:"short" firestore:"short"`
+	URL             string        `json:"url" firestore:"url"`
+	CreatedBy       string        `json:"created_by,omitempty" firestore:"created_by"`
+	AccessLevel     string        `json:"access_level" firestore:"access_level"`
+	Title           string        `json:"title" firestore:"title"`
+	Description     string        `json:"description" firestore:"description"`
+	HealthStatus    string        `json:"health_status,omitempty" firestore:"health_status,omitempty"`
+	ArchivedBy      string        `json:"archived_by,omitempty" firestore:"archived_by,omitempty"`
+	// Classification is how confidential the destination is: "public",
+	// "internal" or "sensitive". Links stored without one are public.
+	Classification string `json:"classification,omitempty" firestore:"classification,omitempty"`
+	// FallbackURL is where visitors are sent while the health checker finds
+	// URL dead
+	FallbackURL string `json:"fallback_url,omitempty" firestore:"fallback_url,omitempty"`
+	// RegionalURLs are the destinations of visitors from each region, keyed
+	// by region name; visitors from other regions are sent to URL
+	RegionalURLs map[string]string `json:"regional_urls,omitempty" firestore:"regional_urls,omitempty"`
+	AllowedUsers []string          `json:"allowed_users" firestore:"allowed_users"`
+	// AllowedGroups are the Google Groups, by email, and teams whose members
+	// may access a restricted link
+	AllowedGroups []string `json:"allowed_groups,omitempty" firestore:"allowed_groups,omitempty"`
+	Tags          []string `json:"tags" firestore:"tags"`
+	// PreviousOwners lists every change of ownership, oldest first
+	PreviousOwners []OwnershipChange `json:"previous_owners,omitempty" firestore:"previous_owners,omitempty"`
+	ClickCount     int               `json:"click_count" firestore:"click_count"`
+	MaxClicks      int               `json:"max_clicks,omitempty" firestore:"max_clicks,omitempty"`
+	// ScoredClicks is the click count the popularity score includes
+	ScoredClicks int `json:"-" firestore:"scored_clicks,omitempty"`
+	// PopularityScore is the time-decayed click count as of ScoredAt
+	PopularityScore float64 `json:"popularity_score,omitempty" firestore:"popularity_score,omitempty"`
+	SchemaVersion   int     `json:"-" firestore:"schema_version"`
+	IsExpired       bool    `json:"is_expired" firestore:"is_expired"`
 }
 
 // NewLink creates a new Link with default values
 func NewLink(short, url, createdBy string) *Link {
 	now := time.Now()
 	return &Link{
-		ID:           short,
+		ID:           NewLinkID(),
 		Short:        short,
 		URL:          url,
 		CreatedAt:    now,
@@ -31,9 +74,95 @@ func NewLink(short, url, createdBy string) *Link {
 		CreatedBy:    createdBy,
 		AccessLevel:  "Public", // Default to public access
 		AllowedUsers: []string{},
+		Tags:         []string{},
 		ClickCount:   0,
 		IsExpired:    false, // Default to not expired
+
+		SchemaVersion: LinkSchemaVersion,
+	}
+}
+
+// NewLinkID returns a new, random link ID. Unlike its short code, the ID of a
+// link never changes, so it names the link's document.
+func NewLinkID() string {
+	return uuid.NewString()
+}
+
+// Clone returns a deep copy of the link that shares no mutable state with l
+func (l *Link) Clone() *Link {
+	if l == nil {
+		return nil
+	}
+	clone := *l
+	if l.AllowedUsers != nil {
+		clone.AllowedUsers = append([]string{}, l.AllowedUsers...)
 	}
+	if l.AllowedGroups != nil {
+		clone.AllowedGroups = append([]string{}, l.AllowedGroups...)
+	}
+	if l.Tags != nil {
+		clone.Tags = append([]string{}, l.Tags...)
+	}
+	if l.RegionalURLs != nil {
+		clone.RegionalURLs = maps.Clone(l.RegionalURLs)
+	}
+	clone.Rollout = l.Rollout.Clone()
+	clone.PendingTransfer = l.PendingTransfer.Clone()
+	clone.Deprecation = l.Deprecation.Clone()
+	if l.PreviousOwners != nil {
+		clone.PreviousOwners = append([]OwnershipChange{}, l.PreviousOwners...)
+	}
+	return &clone
+}
+
+// InNamespace reports whether the link's short code lies below namespace, as
+// "team/docs" and "team/infra/oncall" lie below "team"
+func (l *Link) InNamespace(namespace string) bool {
+	return strings.HasPrefix(l.Short, namespace+"/")
+}
+
+// UsesFallback reports whether visitors are sent to the fallback URL, as
+// they are while the link has one and its URL was found dead
+func (l *Link) UsesFallback() bool {
+	return l.FallbackURL != "" && l.HealthStatus == HealthStatuses.Dead
+}
+
+// IsDeleted reports whether the link has been moved to the trash
+func (l *Link) IsDeleted() bool {
+	return !l.DeletedAt.IsZero()
+}
+
+// DefaultDeleteUndoWindow is how long a deletion can be undone by default
+const DefaultDeleteUndoWindow = 15 * time.Minute
+
+// IsPendingDelete reports whether the link was deleted so recently that the
+// deletion can still be undone. Once the window has passed the deletion is
+// finalized, although the link stays in the trash until it is purged.
+func (l *Link) IsPendingDelete(window time.Duration) bool {
+	return l.IsDeleted() && time.Since(l.DeletedAt) < window
+}
+
+// CanAccess reports whether userID may follow or view the link: anyone for
+// public links, the creator for private links, and the creator or an allowed
+// user for restricted links
+func (l *Link) CanAccess(userID string) bool {
+	return l.CanAccessAs(userID, nil)
+}
+
+// CanAccessAs reports whether userID, a member of groups, may follow or view
+// the link: as CanAccess, and members of an allowed group may also access
+// restricted links
+func (l *Link) CanAccessAs(userID string, groups []string) bool {
+	switch l.AccessLevel {
+	case AccessLevels.Public:
+		return true
+	case AccessLevels.Private:
+		return l.CreatedBy == userID
+	case AccessLevels.Restricted:
+		return l.CreatedBy == userID || slices.Contains(l.AllowedUsers, userID) ||
+			slices.ContainsFunc(l.AllowedGroups, func(group string) bool { return slices.Contains(groups, group) })
+	}
+	return false
 }
 
 // SetExpiry sets the expiration time for a link
@@ -52,6 +181,12 @@ func (l *Link) IsLinkExpired() bool {
 	return time.Now().After(l.ExpiresAt)
 }
 
+// ClickLimitReached reports whether the link has been followed as often as
+// its MaxClicks allows. A zero MaxClicks means the link has no limit.
+func (l *Link) ClickLimitReached() bool {
+	return l.MaxClicks > 0 && l.ClickCount >= l.MaxClicks
+}
+
 // IsExpiringOrExpired checks if a link is expired or will expire soon
 func (l *Link) IsExpiringOrExpired() (bool, string) {
 	if l.ExpiresAt.IsZero() {
@@ -87,3 +222,17 @@ var AccessLevels = struct {
 	Private:    "Private",    // Only the creator can access
 	Restricted: "Restricted", // Only specific users can access
 }
+
+// HealthStatuses defines the results of a destination reachability check.
+// A link's HealthStatus is empty when checks are disabled.
+var HealthStatuses = struct {
+	Pending string
+	Healthy string
+	Dead    string
+	Unknown string
+}{
+	Pending: "pending", // A check is scheduled but has not finished
+	Healthy: "healthy", // The destination responded
+	Dead:    "dead",    // The destination is gone or does not resolve
+	Unknown: "unknown", // The destination could not be checked (internal host, timeout, server error)
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// LinkAlias is an additional short code that resolves to an existing link.
+// Redirects through an alias count towards the link's own click stats.
+type LinkAlias struct {
+	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
+	Alias     string    `json:"alias" firestore:"alias"`
+	Short     string    `json:"short" firestore:"short"`
+	CreatedBy string    `json:"created_by" firestore:"created_by"`
+	// Deprecation is set on the old short code of a renamed link when its
+	// visitors are to be told about the new one, its successor
+	Deprecation *LinkDeprecation `json:"deprecation,omitempty" firestore:"deprecation,omitempty"`
+}
+
+// Clone returns a copy of the alias that shares no mutable state with a
+func (a *LinkAlias) Clone() *LinkAlias {
+	clone := *a
+	clone.Deprecation = a.Deprecation.Clone()
+	return &clone
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// IsArchived reports whether the link is archived. Unlike expiry, archiving
+// is a manual decision that can be undone.
+func (l *Link) IsArchived() bool {
+	return !l.ArchivedAt.IsZero()
+}
+
+// Archive hides the link from listings and stops its redirects, keeping its
+// history and stats
+func (l *Link) Archive(by string, at time.Time) {
+	l.ArchivedAt = at
+	l.ArchivedBy = by
+	l.UpdatedAt = at
+}
+
+// Unarchive makes an archived link available again
+func (l *Link) Unarchive(at time.Time) {
+	l.ArchivedAt = time.Time{}
+	l.ArchivedBy = ""
+	l.UpdatedAt = at
+}
+
+// FilterArchived returns the links that are archived when archived is set,
+// and those that are not otherwise
+func FilterArchived(links []*Link, archived bool) []*Link {
+	filtered := make([]*Link, 0, len(links))
+	for _, link := range links {
+		if link.IsArchived() == archived {
+			filtered = append(filtered, link)
+		}
+	}
+	return filtered
+}
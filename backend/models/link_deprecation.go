@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// MaxDeprecationMessageLength bounds the note shown with a deprecated link
+const MaxDeprecationMessageLength = 280
+
+// DeprecationModes names how redirects through a deprecated link behave
+var DeprecationModes = struct {
+	Notice   string
+	Redirect string
+}{
+	Notice:   "notice",   // A brief page points visitors to the successor first
+	Redirect: "redirect", // Visitors are redirected at once, with headers marking the deprecation
+}
+
+// IsDeprecationMode reports whether mode is one of DeprecationModes
+func IsDeprecationMode(mode string) bool {
+	return mode == DeprecationModes.Notice || mode == DeprecationModes.Redirect
+}
+
+// LinkDeprecation marks a link as superseded. The link keeps working, but
+// visitors are sent on to its successor, so its owner can see how much
+// traffic still arrives through it before archiving it.
+type LinkDeprecation struct {
+	DeprecatedAt time.Time `json:"deprecated_at" firestore:"deprecated_at"`
+	DeprecatedBy string    `json:"deprecated_by,omitempty" firestore:"deprecated_by"`
+	// Successor is the short code of the link that replaces this one; without
+	// one visitors still reach the link's own destination
+	Successor string `json:"successor,omitempty" firestore:"successor,omitempty"`
+	Mode      string `json:"mode" firestore:"mode"`
+	Message   string `json:"message,omitempty" firestore:"message,omitempty"`
+}
+
+// Clone returns a copy of the deprecation
+func (d *LinkDeprecation) Clone() *LinkDeprecation {
+	if d == nil {
+		return nil
+	}
+	clone := *d
+	return &clone
+}
+
+// IsDeprecated reports whether the link has been superseded
+func (l *Link) IsDeprecated() bool {
+	return l.Deprecation != nil
+}
+
+// Deprecate marks the link as superseded by successor, replacing any earlier
+// deprecation
+func (l *Link) Deprecate(deprecation LinkDeprecation, by string, at time.Time) {
+	deprecation.DeprecatedBy = by
+	deprecation.DeprecatedAt = at
+	if deprecation.Mode == "" {
+		deprecation.Mode = DeprecationModes.Notice
+	}
+	l.Deprecation = &deprecation
+	l.UpdatedAt = at
+}
+
+// Undeprecate makes a deprecated link a regular one again
+func (l *Link) Undeprecate(at time.Time) {
+	l.Deprecation = nil
+	l.UpdatedAt = at
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultPopularityHalfLife is how long it takes by default for a click's
+// weight in a link's popularity score to halve
+const DefaultPopularityHalfLife = 7 * 24 * time.Hour
+
+// PopularityAt returns the link's popularity score at t: every click counts
+// for less the older it is, halving with each half-life, so links in use now
+// outrank links that were popular long ago. Clicks since the link was last
+// scored count in full. Links that were never scored fall back to their
+// click count.
+func (l *Link) PopularityAt(t time.Time, halfLife time.Duration) float64 {
+	if l.ScoredAt.IsZero() {
+		return float64(l.ClickCount)
+	}
+	score := l.PopularityScore * decayFactor(t.Sub(l.ScoredAt), halfLife)
+	if fresh := l.ClickCount - l.ScoredClicks; fresh > 0 {
+		score += float64(fresh)
+	}
+	return score
+}
+
+// Rescore brings the stored popularity score up to t
+func (l *Link) Rescore(t time.Time, halfLife time.Duration) {
+	if l.ScoredAt.IsZero() {
+		// Without history, treat all earlier clicks as made at creation
+		l.PopularityScore = float64(l.ClickCount) * decayFactor(t.Sub(l.CreatedAt), halfLife)
+	} else {
+		l.PopularityScore = l.PopularityAt(t, halfLife)
+	}
+	l.ScoredAt = t
+	l.ScoredClicks = l.ClickCount
+}
+
+// SortByPopularity orders links by their popularity at t, most popular
+// first, breaking ties by short code
+func SortByPopularity(links []*Link, t time.Time, halfLife time.Duration) {
+	scores := make(map[*Link]float64, len(links))
+	for _, link := range links {
+		scores[link] = link.PopularityAt(t, halfLife)
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		if scores[links[i]] != scores[links[j]] {
+			return scores[links[i]] > scores[links[j]]
+		}
+		return links[i].Short < links[j].Short
+	})
+}
+
+// decayFactor is the weight left after elapsed time
+func decayFactor(elapsed, halfLife time.Duration) float64 {
+	if elapsed <= 0 || halfLife <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(elapsed) / float64(halfLife))
+}
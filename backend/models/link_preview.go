@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// LinkPreview is the metadata of a link's destination page used to render a
+// rich card: its Open Graph title and description, falling back to the HTML
+// title and meta description, and its favicon
+type LinkPreview struct {
+	FetchedAt   time.Time `json:"fetched_at"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	SiteName    string    `json:"site_name,omitempty"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	FaviconURL  string    `json:"favicon_url,omitempty"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"slices"
+	"sort"
+)
+
+// Orders of a link listing
+const (
+	// LinkOrderShort orders links by short code, the default
+	LinkOrderShort = ""
+	// LinkOrderNewest orders the most recently created links first
+	LinkOrderNewest = "newest"
+	// LinkOrderClicks orders the most clicked links first
+	LinkOrderClicks = "clicks"
+)
+
+// LinkQuery selects, orders and limits the links of a listing. Filters left
+// empty select every link.
+type LinkQuery struct {
+	// Expired, when set, selects the links flagged expired (true) or not
+	// (false). Links past their expiry are only flagged once read.
+	Expired     *bool
+	CreatedBy   string
+	AccessLevel string
+	Tag         string
+	// VisibleTo, when set, selects the links that user, a member of
+	// VisibleToGroups, can access
+	VisibleTo       string
+	VisibleToGroups []string
+	// OrderBy is LinkOrderShort, LinkOrderNewest or LinkOrderClicks
+	OrderBy string
+	// Limit bounds the links listed; zero lists every selected link
+	Limit int
+	// Archived selects the archived links instead of the others
+	Archived bool
+}
+
+// ValidLinkOrder reports whether order is an order of LinkQuery
+func ValidLinkOrder(order string) bool {
+	return order == LinkOrderShort || order == LinkOrderNewest || order == LinkOrderClicks
+}
+
+// Matches reports whether the query selects link. Links in the trash are
+// never selected.
+func (q LinkQuery) Matches(link *Link) bool {
+	switch {
+	case link.IsDeleted() || link.IsArchived() != q.Archived:
+		return false
+	case q.CreatedBy != "" && link.CreatedBy != q.CreatedBy:
+		return false
+	case q.AccessLevel != "" && link.AccessLevel != q.AccessLevel:
+		return false
+	case q.Tag != "" && !slices.Contains(link.Tags, NormalizeTag(q.Tag)):
+		return false
+	case q.Expired != nil && link.IsExpired != *q.Expired:
+		return false
+	case q.VisibleTo != "" && !link.CanAccessAs(q.VisibleTo, q.VisibleToGroups):
+		return false
+	}
+	return true
+}
+
+// Sort orders links as the query asks, breaking ties by short code
+func (q LinkQuery) Sort(links []*Link) {
+	sort.SliceStable(links, func(i, j int) bool {
+		a, b := links[i], links[j]
+		switch {
+		case q.OrderBy == LinkOrderNewest && !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.After(b.CreatedAt)
+		case q.OrderBy == LinkOrderClicks && a.ClickCount != b.ClickCount:
+			return a.ClickCount > b.ClickCount
+		}
+		return a.Short < b.Short
+	})
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// LinkReference records that a document links to a go-link, as reported by an
+// external indexer (wiki, docs site, code search)
+type LinkReference struct {
+	ReportedAt  time.Time `json:"reported_at" firestore:"reported_at"`
+	Short       string    `json:"short" firestore:"short"`
+	DocumentURL string    `json:"document_url" firestore:"document_url"`
+	Source      string    `json:"source" firestore:"source"`
+	// Count is how often the document mentions the link
+	Count int `json:"count" firestore:"count"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// MaxRolloutSteps bounds the schedule of a rollout
+const MaxRolloutSteps = 10
+
+// RolloutVariants names the destinations traffic is split between during a rollout
+var RolloutVariants = struct {
+	Primary string
+	Canary  string
+}{
+	Primary: "primary", // The link's URL
+	Canary:  "canary",  // The rollout's new URL
+}
+
+// RolloutStep sends Percent of the traffic to the new destination from At on
+type RolloutStep struct {
+	At      time.Time `json:"at" firestore:"at"`
+	Percent int       `json:"percent" firestore:"percent"`
+}
+
+// LinkRollout gradually moves a link's traffic to a new destination following
+// a schedule, such as 10% now, 50% tomorrow and 100% next week. The link's URL
+// stays the primary destination until the owner makes the new one permanent
+// by updating the URL; removing the rollout sends all traffic back at once.
+type LinkRollout struct {
+	StartedAt time.Time     `json:"started_at" firestore:"started_at"`
+	URL       string        `json:"url" firestore:"url"`
+	StartedBy string        `json:"started_by" firestore:"started_by"`
+	Steps     []RolloutStep `json:"steps" firestore:"steps"`
+	// Clicks per variant since the rollout started
+	PrimaryClicks int `json:"primary_clicks" firestore:"primary_clicks"`
+	CanaryClicks  int `json:"canary_clicks" firestore:"canary_clicks"`
+}
+
+// Clone returns a deep copy of the rollout
+func (r *LinkRollout) Clone() *LinkRollout {
+	if r == nil {
+		return nil
+	}
+	clone := *r
+	clone.Steps = append([]RolloutStep{}, r.Steps...)
+	return &clone
+}
+
+// PercentAt returns the share of traffic sent to the new destination at t:
+// that of the latest step already reached, or 0 before the first step
+func (r *LinkRollout) PercentAt(t time.Time) int {
+	percent := 0
+	for _, step := range r.Steps {
+		if step.At.After(t) {
+			break
+		}
+		percent = step.Percent
+	}
+	return percent
+}
+
+// Variant picks the destination for a visitor of the link at t. Visitors are
+// placed in one of 100 buckets by key, so each keeps seeing the same
+// destination and only moves to the new one as the percentage grows.
+func (r *LinkRollout) Variant(short, key string, t time.Time) string {
+	h := fnv.New32a()
+	h.Write([]byte(short + "\x00" + key))
+	if int(h.Sum32()%100) < r.PercentAt(t) {
+		return RolloutVariants.Canary
+	}
+	return RolloutVariants.Primary
+}
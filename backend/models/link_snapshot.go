@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// LinkSnapshot is a saved copy of a link's configuration: its destination,
+// rollout, access control and metadata. Owners take one before experimenting
+// with a link and restore it to undo the experiment in one step.
+type LinkSnapshot struct {
+	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
+	Link      *Link     `json:"link" firestore:"link"`
+	Short     string    `json:"short" firestore:"short"`
+	Name      string    `json:"name,omitempty" firestore:"name,omitempty"`
+	CreatedBy string    `json:"created_by" firestore:"created_by"`
+	// ID numbers the snapshots of a link, starting at 1
+	ID int `json:"id" firestore:"id"`
+}
+
+// NewLinkSnapshot creates a snapshot of link's current configuration
+func NewLinkSnapshot(link *Link, name, createdBy string) *LinkSnapshot {
+	return &LinkSnapshot{
+		CreatedAt: time.Now(),
+		Link:      link.Clone(),
+		Short:     link.Short,
+		Name:      name,
+		CreatedBy: createdBy,
+	}
+}
+
+// RestoreSnapshot brings l back to the configuration of a snapshot, including
+// its rollout, keeping identity, ownership and counters
+func (l *Link) RestoreSnapshot(snapshot *LinkSnapshot) {
+	l.RevertTo(snapshot.Link)
+	l.Rollout = snapshot.Link.Rollout.Clone()
+}
@@ -1,23 +1,36 @@
 package models
 
 import (
+	"sort"
 	"time"
 )
 
 // LinkStats represents statistics for a link
 type LinkStats struct {
-	LastClickedAt    time.Time      `json:"last_clicked_at" firestore:"last_clicked_at"`
-	CreatedAt        time.Time      `json:"created_at" firestore:"created_at"`
+	LastClickedAt time.Time `json:"last_clicked_at" firestore:"last_clicked_at"`
+	CreatedAt     time.Time `json:"created_at" firestore:"created_at"`
+	// CompactedAt is when the daily clicks were last folded into ClicksByYear
+	CompactedAt      time.Time      `json:"compacted_at,omitempty" firestore:"compacted_at,omitempty"`
 	ReferringSites   map[string]int `json:"referring_sites" firestore:"referring_sites"`
 	Browsers         map[string]int `json:"browsers" firestore:"browsers"`
 	OperatingSystems map[string]int `json:"operating_systems" firestore:"operating_systems"`
 	Countries        map[string]int `json:"countries" firestore:"countries"`
 	ClicksByDate     map[string]int `json:"clicks_by_date" firestore:"clicks_by_date"`
-	DeviceTypes      map[string]int `json:"device_types" firestore:"device_types"`
-	Short            string         `json:"short" firestore:"short"`
-	Status           string         `json:"status" firestore:"status"`
-	TotalClicks      int            `json:"total_clicks" firestore:"total_clicks"`
-	UniqueClicks     int            `json:"unique_clicks" firestore:"unique_clicks"`
+	// ClicksByMonth holds the daily clicks rolled up once they were older
+	// than the retention, keyed by month
+	ClicksByMonth map[string]int `json:"clicks_by_month,omitempty" firestore:"clicks_by_month,omitempty"`
+	// ClicksByYear holds the compacted daily clicks, keyed by year
+	ClicksByYear map[string]int `json:"clicks_by_year,omitempty" firestore:"clicks_by_year,omitempty"`
+	DeviceTypes  map[string]int `json:"device_types" firestore:"device_types"`
+	// Regions counts clicks by the deployment region they were served for
+	Regions map[string]int `json:"regions,omitempty" firestore:"regions,omitempty"`
+	Short   string         `json:"short" firestore:"short"`
+	Status  string         `json:"status" firestore:"status"`
+	// ArchiveURI locates the full statistics exported before the last compaction
+	ArchiveURI    string `json:"archive_uri,omitempty" firestore:"archive_uri,omitempty"`
+	TotalClicks   int    `json:"total_clicks" firestore:"total_clicks"`
+	UniqueClicks  int    `json:"unique_clicks" firestore:"unique_clicks"`
+	SchemaVersion int    `json:"-" firestore:"schema_version"`
 }
 
 // NewLinkStats creates a new LinkStats with default values
@@ -36,11 +49,47 @@ func NewLinkStats(short string) *LinkStats {
 		LastClickedAt:    time.Time{}, // Zero time
 		CreatedAt:        now,
 		Status:           "active",
+		SchemaVersion:    LinkStatsSchemaVersion,
 	}
 }
 
+// Clone returns a deep copy of the statistics that shares no mutable state with s
+func (s *LinkStats) Clone() *LinkStats {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	clone.ReferringSites = cloneCounts(s.ReferringSites)
+	clone.Browsers = cloneCounts(s.Browsers)
+	clone.OperatingSystems = cloneCounts(s.OperatingSystems)
+	clone.Countries = cloneCounts(s.Countries)
+	clone.ClicksByDate = cloneCounts(s.ClicksByDate)
+	clone.ClicksByMonth = cloneCounts(s.ClicksByMonth)
+	clone.ClicksByYear = cloneCounts(s.ClicksByYear)
+	clone.DeviceTypes = cloneCounts(s.DeviceTypes)
+	clone.Regions = cloneCounts(s.Regions)
+	return &clone
+}
+
+// cloneCounts copies a counter map, preserving nil
+func cloneCounts(m map[string]int) map[string]int {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]int, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
 // RecordClick records a click on the link
 func (s *LinkStats) RecordClick(browser, os, country, referrer, deviceType string) {
+	s.RecordClickAt(time.Now(), browser, os, country, referrer, deviceType)
+}
+
+// RecordClickAt records a click on the link that happened at the given time
+func (s *LinkStats) RecordClickAt(at time.Time, browser, os, country, referrer, deviceType string) {
 	// Update total clicks
 	s.TotalClicks++
 
@@ -48,56 +97,334 @@ func (s *LinkStats) RecordClick(browser, os, country, referrer, deviceType strin
 	// For simplicity, we're incrementing by 1
 	s.UniqueClicks++
 
-	// Record the browser
-	if browser != "" {
-		s.Browsers[browser]++
+	// Record the browser, operating system, country, referring site and
+	// device type; stats read back from storage may lack some of the maps
+	countClick(&s.Browsers, browser)
+	countClick(&s.OperatingSystems, os)
+	countClick(&s.Countries, country)
+	countClick(&s.ReferringSites, referrer)
+	countClick(&s.DeviceTypes, deviceType)
+
+	// Record the date
+	countClick(&s.ClicksByDate, at.Format(StatsDateLayout))
+
+	// Update last clicked time
+	if at.After(s.LastClickedAt) {
+		s.LastClickedAt = at
 	}
+}
+
+// RecordRegion counts a click served for the given deployment region. Clicks
+// without a region are not counted.
+func (s *LinkStats) RecordRegion(region string) {
+	countClick(&s.Regions, region)
+}
+
+// StatsDateLayout is the layout of the days ClicksByDate is keyed by
+const StatsDateLayout = "2006-01-02"
 
-	// Record the operating system
-	if os != "" {
-		s.OperatingSystems[os]++
+// StatsMonthLayout is the layout of the months ClicksByMonth is keyed by
+const StatsMonthLayout = "2006-01"
+
+// countClick increments the counter of key, creating the map if needed.
+// Empty keys are not counted.
+func countClick(m *map[string]int, key string) {
+	if key == "" {
+		return
+	}
+	if *m == nil {
+		*m = make(map[string]int)
 	}
+	(*m)[key]++
+}
+
+// RankedCount is one entry of a click breakdown ranked by clicks
+type RankedCount struct {
+	Name   string `json:"name"`
+	Clicks int    `json:"clicks"`
+}
+
+// GetTopReferrers returns the referring sites with the most clicks, most
+// first. A limit of zero or less returns all of them.
+func (s *LinkStats) GetTopReferrers(limit int) []RankedCount {
+	return topCounts(s.ReferringSites, limit)
+}
+
+// LinkStatsStatusCompacted marks statistics whose daily clicks were compacted
+const LinkStatsStatusCompacted = "compacted"
 
-	// Record the country
-	if country != "" {
-		s.Countries[country]++
+// Compact folds the daily clicks into yearly totals, so the statistics of a
+// link that is no longer in use take little storage. Totals and breakdowns
+// other than clicks per day are kept. Compacting again folds in any clicks
+// recorded since.
+func (s *LinkStats) Compact(at time.Time, archiveURI string) {
+	s.ClicksByYear = s.yearlyClicks()
+	s.ClicksByDate = make(map[string]int)
+	s.ClicksByMonth = nil
+	s.CompactedAt = at
+	s.Status = LinkStatsStatusCompacted
+	if archiveURI != "" {
+		s.ArchiveURI = archiveURI
 	}
+}
 
-	// Record the referring site
-	if referrer != "" {
-		s.ReferringSites[referrer]++
+// RollUp folds the daily clicks of the days before day into monthly totals,
+// so the statistics of links in use for years stay small, and returns how
+// many days it folded. The month day falls in keeps its days, as do the
+// totals and the other breakdowns.
+func (s *LinkStats) RollUp(day time.Time) int {
+	cutoff := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC).Format(StatsDateLayout)
+	folded := 0
+	for date, clicks := range s.ClicksByDate {
+		if date >= cutoff || len(date) < len(StatsMonthLayout) {
+			continue
+		}
+		if s.ClicksByMonth == nil {
+			s.ClicksByMonth = make(map[string]int)
+		}
+		s.ClicksByMonth[date[:len(StatsMonthLayout)]] += clicks
+		delete(s.ClicksByDate, date)
+		folded++
 	}
+	return folded
+}
 
-	// Record the device type
-	if deviceType != "" {
-		s.DeviceTypes[deviceType]++
+// yearlyClicks returns the compacted clicks per year plus the monthly and
+// daily clicks not yet compacted
+func (s *LinkStats) yearlyClicks() map[string]int {
+	years := make(map[string]int, len(s.ClicksByYear)+1)
+	for year, clicks := range s.ClicksByYear {
+		years[year] += clicks
+	}
+	for month, clicks := range s.ClicksByMonth {
+		if len(month) >= 4 {
+			years[month[:4]] += clicks
+		}
+	}
+	for date, clicks := range s.ClicksByDate {
+		if len(date) >= 4 {
+			years[date[:4]] += clicks
+		}
 	}
+	return years
+}
 
-	// Record the date
-	today := time.Now().Format("2006-01-02")
-	s.ClicksByDate[today]++
+// Absorb adds the statistics of another link to these, when that link is
+// merged into this one. Clicks compacted on either side keep counting
+// towards the yearly totals.
+func (s *LinkStats) Absorb(other *LinkStats) {
+	if other == nil {
+		return
+	}
+	s.TotalClicks += other.TotalClicks
+	s.UniqueClicks += other.UniqueClicks
+	s.ReferringSites = addCounts(s.ReferringSites, other.ReferringSites)
+	s.Browsers = addCounts(s.Browsers, other.Browsers)
+	s.OperatingSystems = addCounts(s.OperatingSystems, other.OperatingSystems)
+	s.Countries = addCounts(s.Countries, other.Countries)
+	s.ClicksByDate = addCounts(s.ClicksByDate, other.ClicksByDate)
+	s.DeviceTypes = addCounts(s.DeviceTypes, other.DeviceTypes)
+	if len(other.Regions) > 0 {
+		s.Regions = addCounts(s.Regions, other.Regions)
+	}
+	if len(other.ClicksByMonth) > 0 {
+		s.ClicksByMonth = addCounts(s.ClicksByMonth, other.ClicksByMonth)
+	}
+	if len(other.ClicksByYear) > 0 {
+		s.ClicksByYear = addCounts(s.ClicksByYear, other.ClicksByYear)
+	}
+	if other.LastClickedAt.After(s.LastClickedAt) {
+		s.LastClickedAt = other.LastClickedAt
+	}
+	if !other.CreatedAt.IsZero() && (s.CreatedAt.IsZero() || other.CreatedAt.Before(s.CreatedAt)) {
+		s.CreatedAt = other.CreatedAt
+	}
+}
 
-	// Update last clicked time
-	s.LastClickedAt = time.Now()
+// addCounts adds the counters of b to a, allocating a if it is nil
+func addCounts(a, b map[string]int) map[string]int {
+	if a == nil {
+		a = make(map[string]int, len(b))
+	}
+	for k, v := range b {
+		a[k] += v
+	}
+	return a
 }
 
-// GetTopReferrers returns the top referring sites
-func (s *LinkStats) GetTopReferrers(limit int) map[string]int {
-	// In a real implementation, this would return the top N referrers
-	// For simplicity, we're just returning the map
-	return s.ReferringSites
+// Click series intervals
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+// ClickBucket is the clicks of one interval of a click series
+type ClickBucket struct {
+	// Start is the first day of the interval; weeks start on Monday
+	Start  string `json:"start"`
+	Clicks int    `json:"clicks"`
+}
+
+// intervalStart returns the first day of the interval that day falls in
+func intervalStart(day time.Time, interval string) time.Time {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case IntervalWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case IntervalMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case IntervalYear:
+		return time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
 }
 
-// GetClicksByPeriod returns the clicks grouped by period (day, week, month)
+// nextInterval returns the first day of the interval after the one starting at start
+func nextInterval(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	case IntervalYear:
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// ClickSeries returns the clicks from from to to, both days included, in
+// consecutive intervals. The first and last intervals only count the days in
+// the range. Days rolled up into months count towards monthly and yearly
+// intervals when the whole month lies in the range; otherwise, like days
+// compacted into yearly totals, they count as no clicks.
+func (s *LinkStats) ClickSeries(from, to time.Time, interval string) []ClickBucket {
+	buckets := []ClickBucket{}
+	index := make(map[string]int)
+	for start := intervalStart(from, interval); !start.After(to); start = nextInterval(start, interval) {
+		key := start.Format(StatsDateLayout)
+		index[key] = len(buckets)
+		buckets = append(buckets, ClickBucket{Start: key})
+	}
+	first := from.Format(StatsDateLayout)
+	last := to.Format(StatsDateLayout)
+	for date, clicks := range s.ClicksByDate {
+		if date < first || date > last {
+			continue
+		}
+		day, err := time.Parse(StatsDateLayout, date)
+		if err != nil {
+			continue
+		}
+		if i, ok := index[intervalStart(day, interval).Format(StatsDateLayout)]; ok {
+			buckets[i].Clicks += clicks
+		}
+	}
+	if interval == IntervalMonth || interval == IntervalYear {
+		for month, clicks := range s.ClicksByMonth {
+			start, err := time.Parse(StatsMonthLayout, month)
+			if err != nil || start.Before(from) || start.AddDate(0, 1, -1).After(to) {
+				continue
+			}
+			if i, ok := index[intervalStart(start, interval).Format(StatsDateLayout)]; ok {
+				buckets[i].Clicks += clicks
+			}
+		}
+	}
+	return buckets
+}
+
+// ClicksAsOf returns the clicks up to and including day. Rolled up and
+// compacted clicks count towards the months and years before day's; the
+// clicks rolled up into day's own month or compacted into its year cannot be
+// told apart by day, so they are left out and exact is false.
+func (s *LinkStats) ClicksAsOf(day time.Time) (clicks int, exact bool) {
+	exact = true
+	last := day.Format(StatsDateLayout)
+	for date, count := range s.ClicksByDate {
+		if date <= last {
+			clicks += count
+		}
+	}
+	month := day.Format(StatsMonthLayout)
+	for rolledUp, count := range s.ClicksByMonth {
+		switch {
+		case rolledUp < month:
+			clicks += count
+		case rolledUp == month && count > 0:
+			// The last day of a month includes all of it
+			if day.AddDate(0, 0, 1).Day() == 1 {
+				clicks += count
+			} else {
+				exact = false
+			}
+		}
+	}
+	year := day.Format("2006")
+	for compacted, count := range s.ClicksByYear {
+		switch {
+		case compacted < year:
+			clicks += count
+		case compacted == year && count > 0:
+			// The last day of a year includes all of it
+			if day.Month() == time.December && day.Day() == 31 {
+				clicks += count
+			} else {
+				exact = false
+			}
+		}
+	}
+	return clicks, exact
+}
+
+// GetClicksByPeriod returns the clicks grouped by period (day, week, month,
+// year), keyed by the first day of each period, or by year for years.
+// Monthly totals include rolled up clicks, and yearly totals compacted ones
+// as well.
 func (s *LinkStats) GetClicksByPeriod(period string) map[string]int {
-	// In a real implementation, this would aggregate the clicks by the requested period
-	// For simplicity, we're just returning the daily clicks
-	return s.ClicksByDate
+	if period == IntervalYear {
+		return s.yearlyClicks()
+	}
+	clicks := make(map[string]int, len(s.ClicksByDate))
+	for date, count := range s.ClicksByDate {
+		day, err := time.Parse(StatsDateLayout, date)
+		if err != nil {
+			continue
+		}
+		clicks[intervalStart(day, period).Format(StatsDateLayout)] += count
+	}
+	if period == IntervalMonth {
+		for month, count := range s.ClicksByMonth {
+			if start, err := time.Parse(StatsMonthLayout, month); err == nil {
+				clicks[start.Format(StatsDateLayout)] += count
+			}
+		}
+	}
+	return clicks
 }
 
-// GetTopCountries returns the top countries by clicks
-func (s *LinkStats) GetTopCountries(limit int) map[string]int {
-	// In a real implementation, this would return the top N countries
-	// For simplicity, we're just returning the map
-	return s.Countries
+// GetTopCountries returns the countries with the most clicks, most first. A
+// limit of zero or less returns all of them.
+func (s *LinkStats) GetTopCountries(limit int) []RankedCount {
+	return topCounts(s.Countries, limit)
+}
+
+// topCounts ranks the counters by clicks, breaking ties by name so the order
+// is stable, and keeps the first limit of them
+func topCounts(counts map[string]int, limit int) []RankedCount {
+	ranked := make([]RankedCount, 0, len(counts))
+	for name, clicks := range counts {
+		ranked = append(ranked, RankedCount{Name: name, Clicks: clicks})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Clicks != ranked[j].Clicks {
+			return ranked[i].Clicks > ranked[j].Clicks
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
 }
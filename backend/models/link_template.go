@@ -0,0 +1,84 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// templateParamPattern matches the placeholders of a link template, such as
+// {id} in "https://jira.example.com/browse/{id}"
+var templateParamPattern = regexp.MustCompile(`\{([a-zA-Z][a-zA-Z0-9_]*)\}`)
+
+// IsTemplate reports whether the link's URL has placeholders that are filled
+// from the path segments following its short code
+func (l *Link) IsTemplate() bool {
+	return templateParamPattern.MatchString(l.URL)
+}
+
+// TemplateParams returns the names of the link's placeholders in order
+func (l *Link) TemplateParams() []string {
+	matches := templateParamPattern.FindAllStringSubmatch(l.URL, -1)
+	params := make([]string, 0, len(matches))
+	for _, m := range matches {
+		params = append(params, m[1])
+	}
+	return params
+}
+
+// ResolveURL returns the destination of a request for the link followed by
+// extra path segments and a raw query string. Segments fill the template's
+// placeholders in order; any left over are appended to the destination path,
+// as they are for links without placeholders. The query is appended to the
+// destination's own.
+func (l *Link) ResolveURL(segments []string, rawQuery string) (string, error) {
+	params := l.TemplateParams()
+	if len(segments) < len(params) {
+		return "", fmt.Errorf("go/%s needs a value for {%s}", l.Short, params[len(segments)])
+	}
+
+	target := l.URL
+	if len(params) > 0 {
+		target = renderTemplate(l.URL, segments[:len(params)])
+		segments = segments[len(params):]
+	}
+	if len(segments) == 0 && rawQuery == "" {
+		return target, nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination for go/%s: %w", l.Short, err)
+	}
+	if len(segments) > 0 {
+		u = u.JoinPath(segments...)
+	}
+	if rawQuery != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&" + rawQuery
+		} else {
+			u.RawQuery = rawQuery
+		}
+	}
+	return u.String(), nil
+}
+
+// renderTemplate replaces the placeholders of template with values in order,
+// escaping each value for the part of the URL it lands in
+func renderTemplate(template string, values []string) string {
+	queryStart := strings.IndexByte(template, '?')
+	var b strings.Builder
+	last := 0
+	for i, m := range templateParamPattern.FindAllStringIndex(template, -1) {
+		b.WriteString(template[last:m[0]])
+		if queryStart >= 0 && m[0] > queryStart {
+			b.WriteString(url.QueryEscape(values[i]))
+		} else {
+			b.WriteString(url.PathEscape(values[i]))
+		}
+		last = m[1]
+	}
+	b.WriteString(template[last:])
+	return b.String()
+}
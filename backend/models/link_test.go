@@ -1,11 +1,15 @@
 package models_test
 
 import (
+	"fmt"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewLink(t *testing.T) {
@@ -16,8 +20,10 @@ func TestNewLink(t *testing.T) {
 
 	link := models.NewLink(short, url, userID)
 
-	// Verify all fields are set correctly
-	assert.Equal(t, short, link.ID)
+	// Verify all fields are set correctly; the ID is random and never the short code
+	assert.NotEmpty(t, link.ID)
+	assert.NotEqual(t, short, link.ID)
+	assert.NotEqual(t, link.ID, models.NewLink(short, url, userID).ID)
 	assert.Equal(t, short, link.Short)
 	assert.Equal(t, url, link.URL)
 	assert.Equal(t, userID, link.CreatedBy)
@@ -37,6 +43,22 @@ func TestAccessLevels(t *testing.T) {
 	assert.Equal(t, "Restricted", models.AccessLevels.Restricted)
 }
 
+func TestLinkCanAccessAs(t *testing.T) {
+	link := models.NewLink("roadmap", "https://example.com", "owner")
+	link.AccessLevel = models.AccessLevels.Restricted
+	link.AllowedUsers = []string{"ann"}
+	link.AllowedGroups = []string{"eng@example.com"}
+
+	assert.True(t, link.CanAccessAs("owner", nil))
+	assert.True(t, link.CanAccessAs("ann", nil))
+	assert.True(t, link.CanAccessAs("bob", []string{"all@example.com", "eng@example.com"}))
+	assert.False(t, link.CanAccessAs("bob", []string{"all@example.com"}))
+	assert.False(t, link.CanAccess("bob"))
+
+	link.AccessLevel = models.AccessLevels.Private
+	assert.False(t, link.CanAccessAs("bob", []string{"eng@example.com"}), "groups only open restricted links")
+}
+
 func TestLinkFields(t *testing.T) {
 	// Test that all fields are properly defined with the correct tags
 	link := &models.Link{
@@ -60,3 +82,349 @@ func TestLinkFields(t *testing.T) {
 	assert.Equal(t, []string{"user456", "user789"}, link.AllowedUsers)
 	assert.Equal(t, 42, link.ClickCount)
 }
+
+func TestLinkClone(t *testing.T) {
+	link := models.NewLink("team", "https://example.com", "user1")
+	link.AccessLevel = models.AccessLevels.Restricted
+	link.AllowedUsers = []string{"user2"}
+
+	clone := link.Clone()
+	assert.Equal(t, link, clone)
+
+	// Mutating the clone must not leak into the original
+	clone.URL = "https://evil.example.com"
+	clone.AllowedUsers[0] = "mallory"
+	assert.Equal(t, "https://example.com", link.URL)
+	assert.Equal(t, []string{"user2"}, link.AllowedUsers)
+
+	var nilLink *models.Link
+	assert.Nil(t, nilLink.Clone())
+}
+
+func TestLinkStatsClone(t *testing.T) {
+	stats := models.NewLinkStats("team")
+	stats.RecordClick("Firefox", "Linux", "JP", "github.com", "desktop")
+
+	clone := stats.Clone()
+	assert.Equal(t, stats, clone)
+
+	clone.Browsers["Firefox"] = 99
+	clone.ClicksByDate["2000-01-01"] = 1
+	assert.Equal(t, 1, stats.Browsers["Firefox"])
+	assert.NotContains(t, stats.ClicksByDate, "2000-01-01")
+}
+
+func TestLinkStatsCompact(t *testing.T) {
+	stats := models.NewLinkStats("team")
+	stats.ClicksByDate["2023-12-31"] = 2
+	stats.ClicksByDate["2024-01-01"] = 3
+	stats.ClicksByDate["2024-06-30"] = 4
+
+	at := time.Now()
+	stats.Compact(at, "gs://archive/team.json")
+	assert.Empty(t, stats.ClicksByDate)
+	assert.Equal(t, map[string]int{"2023": 2, "2024": 7}, stats.ClicksByYear)
+	assert.Equal(t, models.LinkStatsStatusCompacted, stats.Status)
+	assert.Equal(t, "gs://archive/team.json", stats.ArchiveURI)
+	assert.True(t, stats.CompactedAt.Equal(at))
+
+	// Clicks recorded later are folded in by the next compaction and count
+	// towards the yearly totals in the meantime
+	stats.ClicksByDate["2024-07-01"] = 1
+	assert.Equal(t, map[string]int{"2023": 2, "2024": 8}, stats.GetClicksByPeriod("year"))
+	stats.Compact(at.Add(time.Hour), "")
+	assert.Equal(t, map[string]int{"2023": 2, "2024": 8}, stats.ClicksByYear)
+	assert.Equal(t, "gs://archive/team.json", stats.ArchiveURI)
+}
+
+func TestLinkStatsTopReferrers(t *testing.T) {
+	stats := models.NewLinkStats("docs")
+	stats.ReferringSites = map[string]int{"github.com": 3, "slack.com": 5, "google.com": 3, "example.com": 1}
+
+	assert.Equal(t, []models.RankedCount{
+		{Name: "slack.com", Clicks: 5},
+		{Name: "github.com", Clicks: 3},
+	}, stats.GetTopReferrers(2))
+	assert.Len(t, stats.GetTopReferrers(0), 4)
+	assert.Equal(t, []models.RankedCount{}, models.NewLinkStats("new").GetTopReferrers(10))
+}
+
+func TestLinkStatsClickSeries(t *testing.T) {
+	stats := models.NewLinkStats("docs")
+	stats.ClicksByDate["2025-02-28"] = 1 // Friday
+	stats.ClicksByDate["2025-03-02"] = 2 // Sunday
+	stats.ClicksByDate["2025-03-03"] = 3 // Monday
+	stats.ClicksByDate["2025-04-10"] = 4
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 4, 30, 0, 0, 0, 0, time.UTC)
+	weeks := stats.ClickSeries(from, to, models.IntervalWeek)
+	require.Len(t, weeks, 10)
+	// The first week starts before the range but only counts days in it
+	assert.Equal(t, models.ClickBucket{Start: "2025-02-24", Clicks: 2}, weeks[0])
+	assert.Equal(t, models.ClickBucket{Start: "2025-03-03", Clicks: 3}, weeks[1])
+	assert.Equal(t, models.ClickBucket{Start: "2025-04-07", Clicks: 4}, weeks[6])
+
+	assert.Equal(t, []models.ClickBucket{
+		{Start: "2025-03-01", Clicks: 5},
+		{Start: "2025-04-01", Clicks: 4},
+	}, stats.ClickSeries(from, to, models.IntervalMonth))
+	assert.Len(t, stats.ClickSeries(from, to, models.IntervalDay), 61)
+
+	assert.Equal(t, map[string]int{"2025-02-01": 1, "2025-03-01": 5, "2025-04-01": 4}, stats.GetClicksByPeriod(models.IntervalMonth))
+	assert.Equal(t, map[string]int{"2025-02-24": 3, "2025-03-03": 3, "2025-04-07": 4}, stats.GetClicksByPeriod(models.IntervalWeek))
+}
+
+func TestLinkStatsClicksAsOf(t *testing.T) {
+	stats := models.NewLinkStats("docs")
+	stats.ClicksByYear = map[string]int{"2023": 7, "2024": 5}
+	stats.ClicksByDate["2025-03-31"] = 2
+	stats.ClicksByDate["2025-04-01"] = 3
+
+	day := func(date string) time.Time {
+		d, err := time.Parse(models.StatsDateLayout, date)
+		require.NoError(t, err)
+		return d
+	}
+	for _, tc := range []struct {
+		date   string
+		clicks int
+		exact  bool
+	}{
+		{"2022-12-31", 0, true},
+		{"2024-06-30", 7, false},
+		{"2024-12-31", 12, true},
+		{"2025-03-31", 14, true},
+		{"2025-04-01", 17, true},
+	} {
+		clicks, exact := stats.ClicksAsOf(day(tc.date))
+		assert.Equal(t, tc.clicks, clicks, tc.date)
+		assert.Equal(t, tc.exact, exact, tc.date)
+	}
+}
+
+func TestLinkStatsRollUp(t *testing.T) {
+	stats := models.NewLinkStats("docs")
+	stats.ClicksByDate = map[string]int{
+		"2025-01-05": 1,
+		"2025-01-20": 2,
+		"2025-02-10": 4,
+		"2025-03-01": 8,
+		"2025-03-15": 16,
+	}
+	day := func(date string) time.Time {
+		d, err := time.Parse(models.StatsDateLayout, date)
+		require.NoError(t, err)
+		return d
+	}
+
+	// Only whole months before the cutoff's month are rolled up
+	assert.Equal(t, 3, stats.RollUp(day("2025-03-10")))
+	assert.Equal(t, map[string]int{"2025-01": 3, "2025-02": 4}, stats.ClicksByMonth)
+	assert.Equal(t, map[string]int{"2025-03-01": 8, "2025-03-15": 16}, stats.ClicksByDate)
+	assert.Zero(t, stats.RollUp(day("2025-03-31")))
+
+	clicks, exact := stats.ClicksAsOf(day("2025-02-28"))
+	assert.Equal(t, 7, clicks)
+	assert.True(t, exact)
+	clicks, exact = stats.ClicksAsOf(day("2025-02-10"))
+	assert.Equal(t, 3, clicks)
+	assert.False(t, exact)
+
+	series := stats.ClickSeries(day("2025-01-01"), day("2025-03-31"), models.IntervalMonth)
+	assert.Equal(t, []int{3, 4, 24}, []int{series[0].Clicks, series[1].Clicks, series[2].Clicks})
+	series = stats.ClickSeries(day("2025-01-10"), day("2025-03-31"), models.IntervalMonth)
+	assert.Equal(t, 0, series[0].Clicks, "a month partly out of the range is left out")
+	assert.Equal(t, map[string]int{"2025": 31}, stats.GetClicksByPeriod(models.IntervalYear))
+	assert.Equal(t, 3, stats.GetClicksByPeriod(models.IntervalMonth)["2025-01-01"])
+
+	stats.Compact(day("2025-04-01"), "")
+	assert.Nil(t, stats.ClicksByMonth)
+	assert.Equal(t, map[string]int{"2025": 31}, stats.ClicksByYear)
+}
+
+func TestLinkStatsAbsorb(t *testing.T) {
+	stats := models.NewLinkStats("docs")
+	stats.RecordClick("Firefox", "Linux", "JP", "github.com", "desktop")
+	other := models.NewLinkStats("documentation")
+	other.RecordClick("Firefox", "macOS", "US", "", "desktop")
+	other.ClicksByYear = map[string]int{"2023": 5}
+	other.CreatedAt = stats.CreatedAt.Add(-time.Hour)
+
+	stats.Absorb(other)
+	assert.Equal(t, 2, stats.TotalClicks)
+	assert.Equal(t, map[string]int{"Firefox": 2}, stats.Browsers)
+	assert.Equal(t, map[string]int{"Linux": 1, "macOS": 1}, stats.OperatingSystems)
+	assert.Equal(t, map[string]int{"github.com": 1}, stats.ReferringSites)
+	assert.Equal(t, 5, stats.GetClicksByPeriod("year")["2023"])
+	assert.True(t, stats.CreatedAt.Equal(other.CreatedAt))
+
+	// The absorbed statistics are left untouched
+	assert.Equal(t, 1, other.Browsers["Firefox"])
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "Nil", tags: nil, want: []string{}},
+		{name: "Lowercase and dedupe", tags: []string{" Eng ", "eng", "on-call", "", "ENG"}, want: []string{"eng", "on-call"}},
+		{name: "Invalid characters", tags: []string{"no spaces"}, wantErr: true},
+		{name: "Too long", tags: []string{strings.Repeat("a", models.MaxTagLength+1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := models.NormalizeTags(tt.tags)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	tooMany := make([]string, models.MaxTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+	_, err := models.NormalizeTags(tooMany)
+	assert.Error(t, err)
+}
+
+func TestChangedLinkFields(t *testing.T) {
+	base := models.NewLink("docs", "https://example.com", "user1")
+	base.ExpiresAt = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	changed := base.Clone()
+	changed.URL = "https://example.org"
+	changed.Tags = []string{"eng"}
+	changed.ExpiresAt = base.ExpiresAt.In(time.FixedZone("JST", 9*60*60))
+	changed.ClickCount = 42
+
+	assert.Equal(t, []string{"url", "tags"}, models.ChangedLinkFields(base, changed),
+		"same instant in another zone and counters are not changes")
+	assert.Nil(t, models.NewLinkVersion(base, base.Clone(), "user1"))
+
+	version := models.NewLinkVersion(base, changed, "user2")
+	require.NotNil(t, version)
+	assert.Equal(t, "user2", version.ChangedBy)
+	assert.Equal(t, "https://example.com", version.Previous.URL)
+
+	changed.RevertTo(version.Previous)
+	assert.Empty(t, models.ChangedLinkFields(base, changed))
+	assert.Equal(t, 42, changed.ClickCount)
+}
+
+func TestLinkResolveURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		segments []string
+		query    string
+		want     string
+		wantErr  bool
+	}{
+		{name: "Plain link", url: "https://example.com/docs", want: "https://example.com/docs"},
+		{name: "Path passthrough", url: "https://example.com/docs", segments: []string{"setup", "go"}, want: "https://example.com/docs/setup/go"},
+		{name: "Query passthrough", url: "https://example.com/search?lang=en", query: "q=golink", want: "https://example.com/search?lang=en&q=golink"},
+		{name: "Template", url: "https://jira.example.com/browse/{id}", segments: []string{"PROJ-1"}, want: "https://jira.example.com/browse/PROJ-1"},
+		{name: "Template query value escaped", url: "https://example.com/search?q={term}", segments: []string{"a b&c"}, want: "https://example.com/search?q=a+b%26c"},
+		{name: "Template with leftover segments", url: "https://github.com/{org}", segments: []string{"acme", "golink"}, query: "tab=readme", want: "https://github.com/acme/golink?tab=readme"},
+		{name: "Template missing value", url: "https://jira.example.com/browse/{id}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := models.NewLink("test", tt.url, "user1")
+			got, err := link.ResolveURL(tt.segments, tt.query)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLinkRollout(t *testing.T) {
+	start := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	rollout := &models.LinkRollout{
+		URL: "https://new.example.com",
+		Steps: []models.RolloutStep{
+			{At: start, Percent: 10},
+			{At: start.Add(24 * time.Hour), Percent: 50},
+			{At: start.Add(48 * time.Hour), Percent: 100},
+		},
+	}
+
+	assert.Equal(t, 0, rollout.PercentAt(start.Add(-time.Minute)))
+	assert.Equal(t, 10, rollout.PercentAt(start))
+	assert.Equal(t, 50, rollout.PercentAt(start.Add(30*time.Hour)))
+	assert.Equal(t, 100, rollout.PercentAt(start.Add(72*time.Hour)))
+
+	// Visitors keep their variant, and only ever move to the new destination
+	countCanary := func(at time.Time) int {
+		canary := 0
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("user%d", i)
+			variant := rollout.Variant("docs", key, at)
+			assert.Equal(t, variant, rollout.Variant("docs", key, at))
+			if variant == models.RolloutVariants.Canary {
+				canary++
+				assert.Equal(t, models.RolloutVariants.Canary, rollout.Variant("docs", key, at.Add(24*time.Hour)))
+			}
+		}
+		return canary
+	}
+	assert.Zero(t, countCanary(start.Add(-time.Minute)))
+	assert.InDelta(t, 100, countCanary(start), 40)
+	assert.InDelta(t, 500, countCanary(start.Add(30*time.Hour)), 60)
+	assert.Equal(t, 1000, countCanary(start.Add(72*time.Hour)))
+
+	clone := rollout.Clone()
+	clone.Steps[0].Percent = 20
+	assert.Equal(t, 10, rollout.Steps[0].Percent)
+}
+
+func TestLinkPopularity(t *testing.T) {
+	now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	halfLife := 24 * time.Hour
+
+	// Popular long ago, no clicks since
+	dormant := models.NewLink("dormant", "https://example.com/old", "user1")
+	dormant.CreatedAt = now.Add(-30 * 24 * time.Hour)
+	dormant.ClickCount = 1000
+	dormant.Rescore(now.Add(-10*24*time.Hour), halfLife)
+
+	// Fewer clicks, but recent ones
+	active := models.NewLink("active", "https://example.com/new", "user1")
+	active.CreatedAt = now.Add(-2 * 24 * time.Hour)
+	active.ClickCount = 20
+	active.Rescore(now.Add(-time.Hour), halfLife)
+	active.ClickCount = 30
+
+	never := models.NewLink("never", "https://example.com/unscored", "user1")
+	never.ClickCount = 5
+
+	assert.InDelta(t, 1000*math.Exp2(-30), dormant.PopularityAt(now, halfLife), 1e-6)
+	assert.InDelta(t, 20*math.Exp2(-2)+10, active.PopularityAt(now, halfLife), 1e-6)
+	assert.Equal(t, 5.0, never.PopularityAt(now, halfLife))
+
+	// Rescoring is consistent with reading the decayed score
+	want := active.PopularityAt(now, halfLife)
+	active.Rescore(now, halfLife)
+	assert.InDelta(t, want, active.PopularityScore, 1e-9)
+	assert.Equal(t, 30, active.ScoredClicks)
+
+	links := []*models.Link{dormant, never, active}
+	models.SortByPopularity(links, now, halfLife)
+	assert.Equal(t, "active", links[0].Short)
+	assert.Equal(t, "never", links[1].Short)
+	assert.Equal(t, "dormant", links[2].Short)
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// LinkTransfer is an offer to hand a link over to another user, pending
+// until the recipient accepts or declines it
+type LinkTransfer struct {
+	RequestedAt time.Time `json:"requested_at" firestore:"requested_at"`
+	To          string    `json:"to" firestore:"to"`
+	RequestedBy string    `json:"requested_by" firestore:"requested_by"`
+}
+
+// OwnershipChange records that a link changed hands
+type OwnershipChange struct {
+	TransferredAt time.Time `json:"transferred_at" firestore:"transferred_at"`
+	From          string    `json:"from" firestore:"from"`
+	To            string    `json:"to" firestore:"to"`
+	// By is who completed the change: the recipient, or an admin overriding
+	By string `json:"by" firestore:"by"`
+}
+
+// Clone returns a copy of the transfer
+func (t *LinkTransfer) Clone() *LinkTransfer {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
+
+// TransferTo makes to the owner of the link, recording the previous owner in
+// the link's ownership trail and dropping any pending transfer
+func (l *Link) TransferTo(to, by string, at time.Time) {
+	l.PreviousOwners = append(l.PreviousOwners, OwnershipChange{
+		TransferredAt: at,
+		From:          l.CreatedBy,
+		To:            to,
+		By:            by,
+	})
+	l.CreatedBy = to
+	l.PendingTransfer = nil
+	l.UpdatedAt = at
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// LinkVersion records one update to a link: who made it, which fields changed
+// and the link as it was before the change, so the change can be rolled back
+type LinkVersion struct {
+	CreatedAt     time.Time `json:"created_at" firestore:"created_at"`
+	Previous      *Link     `json:"previous" firestore:"previous"`
+	Short         string    `json:"short" firestore:"short"`
+	ChangedBy     string    `json:"changed_by" firestore:"changed_by"`
+	ChangedFields []string  `json:"changed_fields" firestore:"changed_fields"`
+	Version       int       `json:"version" firestore:"version"`
+}
+
+// NewLinkVersion creates a version record for a change from previous to current
+// made by changedBy. It returns nil if no versioned field changed.
+func NewLinkVersion(previous, current *Link, changedBy string) *LinkVersion {
+	fields := ChangedLinkFields(previous, current)
+	if len(fields) == 0 {
+		return nil
+	}
+	return &LinkVersion{
+		CreatedAt:     time.Now(),
+		Previous:      previous.Clone(),
+		Short:         current.Short,
+		ChangedBy:     changedBy,
+		ChangedFields: fields,
+	}
+}
+
+// ChangedLinkFields returns the JSON names of the user-editable fields that
+// differ between two states of a link
+func ChangedLinkFields(a, b *Link) []string {
+	fields := []string{}
+	if a.URL != b.URL {
+		fields = append(fields, "url")
+	}
+	if a.AccessLevel != b.AccessLevel {
+		fields = append(fields, "access_level")
+	}
+	if !slices.Equal(a.AllowedUsers, b.AllowedUsers) {
+		fields = append(fields, "allowed_users")
+	}
+	if !slices.Equal(a.AllowedGroups, b.AllowedGroups) {
+		fields = append(fields, "allowed_groups")
+	}
+	if a.Title != b.Title {
+		fields = append(fields, "title")
+	}
+	if a.Description != b.Description {
+		fields = append(fields, "description")
+	}
+	if !slices.Equal(a.Tags, b.Tags) {
+		fields = append(fields, "tags")
+	}
+	if !a.ExpiresAt.Equal(b.ExpiresAt) {
+		fields = append(fields, "expires_at")
+	}
+	if a.MaxClicks != b.MaxClicks {
+		fields = append(fields, "max_clicks")
+	}
+	if a.Classification != b.Classification {
+		fields = append(fields, "classification")
+	}
+	if a.FallbackURL != b.FallbackURL {
+		fields = append(fields, "fallback_url")
+	}
+	if !maps.Equal(a.RegionalURLs, b.RegionalURLs) {
+		fields = append(fields, "regional_urls")
+	}
+	return fields
+}
+
+// RevertTo restores the user-editable fields of l from an earlier state,
+// keeping identity, ownership and counters
+func (l *Link) RevertTo(previous *Link) {
+	l.URL = previous.URL
+	l.AccessLevel = previous.AccessLevel
+	l.AllowedUsers = append([]string{}, previous.AllowedUsers...)
+	l.AllowedGroups = slices.Clone(previous.AllowedGroups)
+	l.Title = previous.Title
+	l.Description = previous.Description
+	l.Tags = append([]string{}, previous.Tags...)
+	l.ExpiresAt = previous.ExpiresAt
+	l.MaxClicks = previous.MaxClicks
+	l.Classification = previous.Classification
+	l.FallbackURL = previous.FallbackURL
+	l.RegionalURLs = maps.Clone(previous.RegionalURLs)
+	l.IsExpired = l.IsLinkExpired()
+	l.UpdatedAt = time.Now()
+}
@@ -0,0 +1,43 @@
+package models
+
+// LinkViewer is who a link is shown to
+type LinkViewer struct {
+	UserID string
+	// Admin is set for admins, who see every link in full
+	Admin bool
+}
+
+// Sees reports whether the viewer sees the link in full: its owner and
+// admins do
+func (v LinkViewer) Sees(l *Link) bool {
+	return v.Admin || (v.UserID != "" && l.CreatedBy == v.UserID)
+}
+
+// ViewFor returns the link as viewer may see it. Its owner and admins see the
+// link itself; anyone else sees a copy without who owns it, who it is shared
+// with and its ownership history.
+func (l *Link) ViewFor(viewer LinkViewer) *Link {
+	if l == nil || viewer.Sees(l) {
+		return l
+	}
+	view := l.Clone()
+	view.CreatedBy = ""
+	view.AllowedUsers = []string{}
+	view.AllowedGroups = nil
+	view.PreviousOwners = nil
+	view.PendingTransfer = nil
+	view.ArchivedBy = ""
+	if view.Deprecation != nil {
+		view.Deprecation.DeprecatedBy = ""
+	}
+	return view
+}
+
+// ViewLinks returns the links as viewer may see each of them
+func ViewLinks(links []*Link, viewer LinkViewer) []*Link {
+	views := make([]*Link, len(links))
+	for i, link := range links {
+		views[i] = link.ViewFor(viewer)
+	}
+	return views
+}
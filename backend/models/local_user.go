@@ -0,0 +1,37 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MinPasswordLength is the shortest password a local account may have
+const MinPasswordLength = 12
+
+// usernamePattern is the format of local account names
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// LocalUser is an account of the local user store, which lets self-hosted
+// deployments sign users in with a password instead of Google
+type LocalUser struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	// PasswordHash is the bcrypt hash of the password
+	PasswordHash string `json:"password_hash"`
+	// Disabled accounts cannot sign in
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// NormalizeUsername lowercases a username and checks its format
+func NormalizeUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return "", fmt.Errorf("username must be 1-64 lowercase letters, digits, dots, underscores or hyphens")
+	}
+	return username, nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential an admin registered as a second factor
+type Passkey struct {
+	CreatedAt  time.Time `json:"created_at" firestore:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty" firestore:"last_used_at,omitempty"`
+	// ID is the base64url credential ID
+	ID     string `json:"id" firestore:"id"`
+	UserID string `json:"user_id" firestore:"user_id"`
+	Name   string `json:"name" firestore:"name"`
+	// PublicKey is the COSE_Key the passkey signs with
+	PublicKey []byte `json:"-" firestore:"public_key"`
+	SignCount uint32 `json:"-" firestore:"sign_count"`
+}
+
+// RecoveryCodes are the one-time codes standing in for a user's passkeys
+// when none is at hand. Only hashes of the codes are stored.
+type RecoveryCodes struct {
+	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
+	UserID    string    `json:"user_id" firestore:"user_id"`
+	// Hashes holds the hex SHA-256 of each unused code
+	Hashes []string `json:"-" firestore:"hashes"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// ProductMetricsDay holds how often each product feature was used on one
+// day (UTC). Only event names and counts are kept, nothing about who used
+// a feature or on what.
+type ProductMetricsDay struct {
+	Events map[string]int64 `json:"events" firestore:"events"`
+	// Date is the day, as YYYY-MM-DD
+	Date string `json:"date" firestore:"date"`
+}
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Current schema versions of persisted documents. Bump a version together with
+// an upgrade step in the matching upgrades list whenever a stored shape changes.
+const (
+	LinkSchemaVersion      = 2
+	LinkStatsSchemaVersion = 1
+)
+
+// schemaVersionField is the document field holding the schema version.
+// Documents written before versioning have no such field and are version 0.
+const schemaVersionField = "schema_version"
+
+// documentUpgrade rewrites raw document data from one schema version to the next
+type documentUpgrade func(data map[string]interface{})
+
+// linkUpgrades[i] upgrades a link document from version i to i+1
+var linkUpgrades = []documentUpgrade{
+	upgradeLinkV0,
+	upgradeLinkV1,
+}
+
+// linkStatsUpgrades[i] upgrades a link stats document from version i to i+1
+var linkStatsUpgrades = []documentUpgrade{
+	upgradeLinkStatsV0,
+}
+
+// upgradeLinkV0 fills fields that early link documents could omit
+func upgradeLinkV0(data map[string]interface{}) {
+	if id, _ := data["id"].(string); id == "" {
+		data["id"] = data["short"]
+	}
+	if level, _ := data["access_level"].(string); level == "" {
+		data["access_level"] = AccessLevels.Public
+	}
+	if data["allowed_users"] == nil {
+		data["allowed_users"] = []interface{}{}
+	}
+}
+
+// upgradeLinkV1 adds the tags list introduced in version 2
+func upgradeLinkV1(data map[string]interface{}) {
+	if data["tags"] == nil {
+		data["tags"] = []interface{}{}
+	}
+}
+
+// upgradeLinkStatsV0 fills fields that early link stats documents could omit
+func upgradeLinkStatsV0(data map[string]interface{}) {
+	for _, key := range []string{"referring_sites", "browsers", "operating_systems", "countries", "clicks_by_date", "device_types"} {
+		if data[key] == nil {
+			data[key] = map[string]interface{}{}
+		}
+	}
+	if status, _ := data["status"].(string); status == "" {
+		data["status"] = "active"
+	}
+}
+
+// DecodeLink decodes raw link document data, upgrading older shapes to the
+// current schema. It returns the version the document was stored with.
+// Documents from a newer schema are decoded as far as this version understands
+// them; unknown fields are ignored.
+func DecodeLink(data map[string]interface{}) (*Link, int, error) {
+	version := upgradeDocument(data, linkUpgrades)
+
+	var link Link
+	if err := decodeDocument(data, &link); err != nil {
+		return nil, version, fmt.Errorf("decoding link (schema version %d): %w", version, err)
+	}
+	if version < LinkSchemaVersion {
+		link.SchemaVersion = LinkSchemaVersion
+	}
+	return &link, version, nil
+}
+
+// DecodeLinkStats decodes raw link stats document data, upgrading older shapes
+// to the current schema. It returns the version the document was stored with.
+func DecodeLinkStats(data map[string]interface{}) (*LinkStats, int, error) {
+	version := upgradeDocument(data, linkStatsUpgrades)
+
+	var stats LinkStats
+	if err := decodeDocument(data, &stats); err != nil {
+		return nil, version, fmt.Errorf("decoding link stats (schema version %d): %w", version, err)
+	}
+	if version < LinkStatsSchemaVersion {
+		stats.SchemaVersion = LinkStatsSchemaVersion
+	}
+	return &stats, version, nil
+}
+
+// upgradeDocument applies all upgrades from the document's version onwards and
+// returns the version the document had before upgrading
+func upgradeDocument(data map[string]interface{}, upgrades []documentUpgrade) int {
+	version := 0
+	switch v := data[schemaVersionField].(type) {
+	case int64:
+		version = int(v)
+	case int:
+		version = v
+	case float64:
+		version = int(v)
+	}
+
+	for i := version; i >= 0 && i < len(upgrades); i++ {
+		upgrades[i](data)
+	}
+	return version
+}
+
+// decodeDocument copies raw document data into the struct pointed to by dst,
+// matching fields by their firestore tag. Missing and unknown fields are ignored.
+func decodeDocument(data map[string]interface{}, dst interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("firestore"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		raw, ok := data[name]
+		if !ok || raw == nil {
+			continue
+		}
+		if err := assignValue(v.Field(i), raw); err != nil {
+			return fmt.Errorf("field %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// assignValue stores a raw Firestore value in dst, converting between the
+// numeric and collection types Firestore returns and the model's field types
+func assignValue(dst reflect.Value, raw interface{}) error {
+	src := reflect.ValueOf(raw)
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch n := raw.(type) {
+		case int64:
+			dst.SetInt(n)
+		case int:
+			dst.SetInt(int64(n))
+		case float64:
+			dst.SetInt(int64(n))
+		default:
+			return fmt.Errorf("cannot use %T as integer", raw)
+		}
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch n := raw.(type) {
+		case float64:
+			dst.SetFloat(n)
+		case int64:
+			dst.SetFloat(float64(n))
+		case int:
+			dst.SetFloat(float64(n))
+		default:
+			return fmt.Errorf("cannot use %T as number", raw)
+		}
+		return nil
+	case reflect.Slice:
+		if src.Kind() != reflect.Slice {
+			return fmt.Errorf("cannot use %T as list", raw)
+		}
+		list := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := assignValue(list.Index(i), src.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		dst.Set(list)
+		return nil
+	case reflect.Map:
+		if src.Kind() != reflect.Map {
+			return fmt.Errorf("cannot use %T as map", raw)
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignValue(elem, iter.Value().Interface()); err != nil {
+				return err
+			}
+			m.SetMapIndex(iter.Key().Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(m)
+		return nil
+	case reflect.Pointer:
+		elem := reflect.New(dst.Type().Elem())
+		if err := assignValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	case reflect.Struct:
+		// Nested documents such as a link's rollout arrive as maps
+		if m, ok := raw.(map[string]interface{}); ok {
+			return decodeDocument(m, dst.Addr().Interface())
+		}
+	}
+
+	if dst.Type() == reflect.TypeOf(time.Time{}) {
+		if _, ok := raw.(time.Time); !ok {
+			return fmt.Errorf("cannot use %T as timestamp", raw)
+		}
+	}
+	if !src.Type().AssignableTo(dst.Type()) {
+		return fmt.Errorf("cannot use %T as %s", raw, dst.Type())
+	}
+	dst.Set(src)
+	return nil
+}
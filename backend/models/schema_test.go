@@ -0,0 +1,217 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeLink(t *testing.T) {
+	created := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		data        map[string]interface{}
+		want        *models.Link
+		name        string
+		wantVersion int
+		wantErr     bool
+	}{
+		{
+			name: "Unversioned document is upgraded",
+			data: map[string]interface{}{
+				"short":       "docs",
+				"url":         "https://example.com",
+				"created_by":  "user1",
+				"created_at":  created,
+				"click_count": int64(7),
+			},
+			wantVersion: 0,
+			want: &models.Link{
+				ID:            "docs",
+				Short:         "docs",
+				URL:           "https://example.com",
+				CreatedBy:     "user1",
+				CreatedAt:     created,
+				AccessLevel:   models.AccessLevels.Public,
+				AllowedUsers:  []string{},
+				Tags:          []string{},
+				ClickCount:    7,
+				SchemaVersion: models.LinkSchemaVersion,
+			},
+		},
+		{
+			name: "Version 1 document gains tags",
+			data: map[string]interface{}{
+				"id":             "wiki",
+				"short":          "wiki",
+				"access_level":   models.AccessLevels.Public,
+				"allowed_users":  []interface{}{},
+				"schema_version": int64(1),
+			},
+			wantVersion: 1,
+			want: &models.Link{
+				ID:            "wiki",
+				Short:         "wiki",
+				AccessLevel:   models.AccessLevels.Public,
+				AllowedUsers:  []string{},
+				Tags:          []string{},
+				SchemaVersion: models.LinkSchemaVersion,
+			},
+		},
+		{
+			name: "Current document is decoded as stored",
+			data: map[string]interface{}{
+				"id":             "team",
+				"short":          "team",
+				"url":            "https://example.com",
+				"access_level":   models.AccessLevels.Restricted,
+				"allowed_users":  []interface{}{"user2"},
+				"tags":           []interface{}{"eng"},
+				"title":          "Team page",
+				"is_expired":     true,
+				"schema_version": int64(models.LinkSchemaVersion),
+			},
+			wantVersion: models.LinkSchemaVersion,
+			want: &models.Link{
+				ID:            "team",
+				Short:         "team",
+				URL:           "https://example.com",
+				AccessLevel:   models.AccessLevels.Restricted,
+				AllowedUsers:  []string{"user2"},
+				Tags:          []string{"eng"},
+				Title:         "Team page",
+				IsExpired:     true,
+				SchemaVersion: models.LinkSchemaVersion,
+			},
+		},
+		{
+			name: "Newer document keeps known fields and ignores unknown ones",
+			data: map[string]interface{}{
+				"id":             "next",
+				"short":          "next",
+				"url":            "https://example.com",
+				"access_level":   models.AccessLevels.Private,
+				"allowed_users":  []interface{}{},
+				"owner_team":     "platform",
+				"schema_version": int64(models.LinkSchemaVersion + 1),
+			},
+			wantVersion: models.LinkSchemaVersion + 1,
+			want: &models.Link{
+				ID:            "next",
+				Short:         "next",
+				URL:           "https://example.com",
+				AccessLevel:   models.AccessLevels.Private,
+				AllowedUsers:  []string{},
+				SchemaVersion: models.LinkSchemaVersion + 1,
+			},
+		},
+		{
+			name: "Nested rollout is decoded",
+			data: map[string]interface{}{
+				"id":             "jira",
+				"short":          "jira",
+				"url":            "https://old.example.com",
+				"access_level":   models.AccessLevels.Public,
+				"allowed_users":  []interface{}{},
+				"tags":           []interface{}{},
+				"schema_version": int64(models.LinkSchemaVersion),
+				"rollout": map[string]interface{}{
+					"url":           "https://new.example.com",
+					"started_at":    created,
+					"steps":         []interface{}{map[string]interface{}{"at": created, "percent": int64(10)}},
+					"canary_clicks": int64(3),
+				},
+			},
+			wantVersion: models.LinkSchemaVersion,
+			want: &models.Link{
+				ID:           "jira",
+				Short:        "jira",
+				URL:          "https://old.example.com",
+				AccessLevel:  models.AccessLevels.Public,
+				AllowedUsers: []string{},
+				Tags:         []string{},
+				Rollout: &models.LinkRollout{
+					StartedAt:    created,
+					URL:          "https://new.example.com",
+					Steps:        []models.RolloutStep{{At: created, Percent: 10}},
+					CanaryClicks: 3,
+				},
+				SchemaVersion: models.LinkSchemaVersion,
+			},
+		},
+		{
+			name: "Ownership trail is decoded",
+			data: map[string]interface{}{
+				"id":             "docs",
+				"short":          "docs",
+				"url":            "https://docs.example.com",
+				"created_by":     "bob",
+				"access_level":   models.AccessLevels.Public,
+				"allowed_users":  []interface{}{},
+				"tags":           []interface{}{},
+				"schema_version": int64(models.LinkSchemaVersion),
+				"pending_transfer": map[string]interface{}{
+					"requested_at": created,
+					"to":           "carol",
+					"requested_by": "bob",
+				},
+				"previous_owners": []interface{}{
+					map[string]interface{}{"transferred_at": created, "from": "alice", "to": "bob", "by": "bob"},
+				},
+			},
+			wantVersion: models.LinkSchemaVersion,
+			want: &models.Link{
+				ID:              "docs",
+				Short:           "docs",
+				URL:             "https://docs.example.com",
+				CreatedBy:       "bob",
+				AccessLevel:     models.AccessLevels.Public,
+				AllowedUsers:    []string{},
+				Tags:            []string{},
+				PendingTransfer: &models.LinkTransfer{RequestedAt: created, To: "carol", RequestedBy: "bob"},
+				PreviousOwners:  []models.OwnershipChange{{TransferredAt: created, From: "alice", To: "bob", By: "bob"}},
+				SchemaVersion:   models.LinkSchemaVersion,
+			},
+		},
+		{
+			name: "Mismatched field type",
+			data: map[string]interface{}{
+				"short":       "bad",
+				"click_count": "seven",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, version, err := models.DecodeLink(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, version)
+			assert.Equal(t, tt.want, link)
+		})
+	}
+}
+
+func TestDecodeLinkStats(t *testing.T) {
+	stats, version, err := models.DecodeLinkStats(map[string]interface{}{
+		"short":        "docs",
+		"total_clicks": int64(3),
+		"browsers":     map[string]interface{}{"Firefox": int64(3)},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, version)
+	assert.Equal(t, models.LinkStatsSchemaVersion, stats.SchemaVersion)
+	assert.Equal(t, 3, stats.TotalClicks)
+	assert.Equal(t, map[string]int{"Firefox": 3}, stats.Browsers)
+	assert.NotNil(t, stats.Countries, "missing maps are initialized")
+	assert.Equal(t, "active", stats.Status)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents a server-side record of an issued session token
+type Session struct {
+	CreatedAt  time.Time `json:"created_at" firestore:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" firestore:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at" firestore:"expires_at"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty" firestore:"revoked_at,omitempty"`
+	ID         string    `json:"id" firestore:"id"`
+	UserID     string    `json:"user_id" firestore:"user_id"`
+	Email      string    `json:"email" firestore:"email"`
+	UserAgent  string    `json:"user_agent" firestore:"user_agent"`
+	IPAddress  string    `json:"ip_address" firestore:"ip_address"`
+}
+
+// NewSession creates a new Session for a user that expires after ttl
+func NewSession(id, userID, email string, ttl time.Duration) *Session {
+	now := time.Now()
+	return &Session{
+		ID:         id,
+		UserID:     userID,
+		Email:      email,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+}
+
+// IsActive reports whether the session is neither revoked nor expired
+func (s *Session) IsActive() bool {
+	if !s.RevokedAt.IsZero() {
+		return false
+	}
+	return time.Now().Before(s.ExpiresAt)
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits for descriptive link metadata
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 2000
+	MaxTags              = 20
+	MaxTagLength         = 32
+)
+
+// validTag matches normalized tags: lowercase letters, digits, hyphens and underscores
+var validTag = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// NormalizeTag lowercases and trims a tag so lookups are case-insensitive
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// NormalizeTags normalizes, validates and deduplicates tags, preserving their order
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength {
+			return nil, fmt.Errorf("tag %q must be at most %d characters", tag, MaxTagLength)
+		}
+		if !validTag.MatchString(tag) {
+			return nil, fmt.Errorf("tag %q must contain only letters, numbers, hyphens, and underscores", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("a link can have at most %d tags", MaxTags)
+	}
+	return normalized, nil
+}
+
+// ValidateMetadata checks the length of a link's title and description
+func ValidateMetadata(title, description string) error {
+	if len(title) > MaxTitleLength {
+		return fmt.Errorf("title must be at most %d characters", MaxTitleLength)
+	}
+	if len(description) > MaxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", MaxDescriptionLength)
+	}
+	return nil
+}
+
+// HasTag reports whether the link is tagged with tag (compared case-insensitively)
+func (l *Link) HasTag(tag string) bool {
+	tag = NormalizeTag(tag)
+	for _, t := range l.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
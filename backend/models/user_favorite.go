@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// UserFavorite records that a user favorited a link, so they can find the
+// links they use most at the top of their lists
+type UserFavorite struct {
+	AddedAt time.Time `json:"added_at" firestore:"added_at"`
+	UserID  string    `json:"-" firestore:"user_id"`
+	Short   string    `json:"short" firestore:"short"`
+}
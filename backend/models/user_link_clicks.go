@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultClickHistoryRetention is how long by default a user's clicks on a
+// link keep personalizing their search results after the last one
+const DefaultClickHistoryRetention = 90 * 24 * time.Hour
+
+// UserLinkClicks aggregates one user's clicks on one link, so search can
+// boost the links a user actually follows
+type UserLinkClicks struct {
+	LastClickedAt time.Time `json:"last_clicked_at" firestore:"last_clicked_at"`
+	UserID        string    `json:"-" firestore:"user_id"`
+	Short         string    `json:"short" firestore:"short"`
+	Clicks        int       `json:"clicks" firestore:"clicks"`
+}
+
+// WeightAt returns the weight of the user's clicks at t. Like link
+// popularity it halves with each half-life, counted from the last click.
+func (c *UserLinkClicks) WeightAt(t time.Time, halfLife time.Duration) float64 {
+	return float64(c.Clicks) * decayFactor(t.Sub(c.LastClickedAt), halfLife)
+}
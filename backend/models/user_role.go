@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Roles users can be assigned
+const (
+	// RoleViewer may read and follow links. The role only limits changes to
+	// links under /api/links; viewers still keep their own favorites, click
+	// history, sessions, API tokens and passkeys.
+	RoleViewer = "viewer"
+	// RoleEditor may also create links and change, rename, archive, transfer,
+	// alias, snapshot and restore their own
+	RoleEditor = "editor"
+	// RoleAdmin may also change or delete every link, manage users and use
+	// the admin endpoints
+	RoleAdmin = "admin"
+)
+
+// roleRanks orders the roles; a role includes the power of every lower one
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// IsRole reports whether role is a known role
+func IsRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleIncludes reports whether role has at least the power of required
+func RoleIncludes(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// UserRole assigns a role to a user, identified by email. Users without one
+// get the default role.
+type UserRole struct {
+	UpdatedAt time.Time `json:"updated_at" firestore:"updated_at"`
+	// Email is the lowercased email of the user
+	Email string `json:"email" firestore:"email"`
+	Role  string `json:"role" firestore:"role"`
+	// UpdatedBy is the ID of the admin who assigned the role
+	UpdatedBy string `json:"updated_by" firestore:"updated_by"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// WebhookEvents names the link events webhooks can subscribe to
+var WebhookEvents = struct {
+	LinkCreated    string
+	LinkUpdated    string
+	LinkDeleted    string
+	LinkRestored   string
+	LinkRenamed    string
+	LinkDeprecated string
+}{
+	LinkCreated:    "link.created",
+	LinkUpdated:    "link.updated",
+	LinkDeleted:    "link.deleted",    // Moved to the trash
+	LinkRestored:   "link.restored",   // Restored from the trash
+	LinkRenamed:    "link.renamed",    // Given a new short code
+	LinkDeprecated: "link.deprecated", // Pointed at a successor
+}
+
+// IsWebhookEvent reports whether event is one of WebhookEvents
+func IsWebhookEvent(event string) bool {
+	switch event {
+	case WebhookEvents.LinkCreated, WebhookEvents.LinkUpdated, WebhookEvents.LinkDeleted,
+		WebhookEvents.LinkRestored, WebhookEvents.LinkRenamed, WebhookEvents.LinkDeprecated:
+		return true
+	}
+	return false
+}
+
+// Webhook is an endpoint admins registered to receive link events. Every
+// delivery is signed with the webhook's secret, which is only shown when the
+// webhook is created.
+type Webhook struct {
+	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" firestore:"updated_at"`
+	ID        string    `json:"id" firestore:"id"`
+	URL       string    `json:"url" firestore:"url"`
+	CreatedBy string    `json:"created_by" firestore:"created_by"`
+	// Secret signs deliveries; receivers verify them with the same secret
+	Secret string `json:"-" firestore:"secret"`
+	// Events lists the event types delivered to the webhook
+	Events []string `json:"events" firestore:"events"`
+	Active bool     `json:"active" firestore:"active"`
+}
+
+// Clone returns a copy of the webhook that shares no slices with it
+func (w *Webhook) Clone() *Webhook {
+	clone := *w
+	clone.Events = slices.Clone(w.Events)
+	return &clone
+}
+
+// Subscribes reports whether the webhook is active and receives event
+func (w *Webhook) Subscribes(event string) bool {
+	return w.Active && slices.Contains(w.Events, event)
+}
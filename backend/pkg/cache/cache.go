@@ -0,0 +1,52 @@
+// Package cache keeps short-lived copies of responses and links in a store
+// that several server replicas can share, so a change made through one
+// replica invalidates the copies of all of them.
+//
+// Caches are an optimization: a store that fails is counted in
+// golink_cache_errors_total and treated as empty, and the data is read
+// from its source instead.
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/consistency"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrorsTotal counts the failed operations of shared cache stores
+var ErrorsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "golink_cache_errors_total",
+		Help: "Total number of failed shared cache operations by operation (get, set or delete)",
+	},
+	[]string{"operation"},
+)
+
+// Store keeps values for a limited time
+type Store interface {
+	// Get returns the value of key, and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value of key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the keys
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// allowedKey marks contexts whose reads may be served from a cache
+type allowedKey struct{}
+
+// Allow returns a context whose reads may be served from a cache. Only
+// paths that tolerate slightly old data, such as redirects, ask for it.
+func Allow(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowedKey{}, true)
+}
+
+// Allowed reports whether reads with ctx may be served from a cache. A
+// strongly consistent read never is.
+func Allowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(allowedKey{}).(bool)
+	return allowed && !consistency.IsStrong(ctx)
+}
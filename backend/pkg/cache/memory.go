@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store in the memory of one process, keeping the most
+// recently used values. It needs no network round trip, but each replica
+// has its own, so changes made through another replica only show once the
+// values expire.
+type MemoryStore struct {
+	items *list.List
+	index map[string]*list.Element
+	now   func() time.Time
+	// maxEntries bounds the store; zero or less means unbounded
+	maxEntries int
+	mutex      sync.Mutex
+}
+
+// memoryEntry is the value of an element of the recency list
+type memoryEntry struct {
+	expires time.Time
+	key     string
+	value   []byte
+}
+
+// Ensure MemoryStore implements Store
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a store holding at most maxEntries values, evicting
+// the least recently used first
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		items:      list.New(),
+		index:      make(map[string]*list.Element),
+		now:        time.Now,
+		maxEntries: maxEntries,
+	}
+}
+
+// Get returns the value of key, marking it as recently used. Expired values
+// are removed as they are found.
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, found := s.index[key]
+	if !found {
+		return nil, false, nil
+	}
+	entry := e.Value.(*memoryEntry)
+	if !s.now().Before(entry.expires) {
+		s.remove(e)
+		return nil, false, nil
+	}
+	s.items.MoveToFront(e)
+	return entry.value, true, nil
+}
+
+// Set stores the value of key for ttl, evicting the least recently used
+// values when the store is full
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if e, found := s.index[key]; found {
+		s.remove(e)
+	}
+	s.index[key] = s.items.PushFront(&memoryEntry{key: key, value: value, expires: s.now().Add(ttl)})
+	for s.maxEntries > 0 && s.items.Len() > s.maxEntries {
+		s.remove(s.items.Back())
+	}
+	return nil
+}
+
+// Delete removes the keys
+func (s *MemoryStore) Delete(_ context.Context, keys ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		if e, found := s.index[key]; found {
+			s.remove(e)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of values held, expired ones included
+func (s *MemoryStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.items.Len()
+}
+
+// remove unlinks an element. The caller holds the lock.
+func (s *MemoryStore) remove(e *list.Element) {
+	entry := s.items.Remove(e).(*memoryEntry)
+	delete(s.index, entry.key)
+}
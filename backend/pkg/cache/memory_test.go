@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(2)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.NoError(t, store.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, store.Set(ctx, "b", []byte("2"), time.Minute))
+	value, found, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("1"), value)
+
+	// "b" is the least recently used once "a" was read
+	require.NoError(t, store.Set(ctx, "c", []byte("3"), time.Minute))
+	assert.Equal(t, 2, store.Len())
+	_, found, _ = store.Get(ctx, "b")
+	assert.False(t, found)
+	_, found, _ = store.Get(ctx, "a")
+	assert.True(t, found)
+
+	require.NoError(t, store.Delete(ctx, "a", "missing"))
+	_, found, _ = store.Get(ctx, "a")
+	assert.False(t, found)
+
+	now = now.Add(time.Minute)
+	_, found, _ = store.Get(ctx, "c")
+	assert.False(t, found, "values expire after their TTL")
+	assert.Equal(t, 0, store.Len())
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a Store in Redis, shared by every replica connected to it
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// Ensure RedisStore implements Store
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a Store keeping its keys under prefix in Redis
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Get returns the value of key, and whether it was found
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		ErrorsTotal.WithLabelValues("get").Inc()
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores the value of key for ttl
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := s.client.Set(ctx, s.prefix+key, value, ttl).Err(); err != nil {
+		ErrorsTotal.WithLabelValues("set").Inc()
+		return err
+	}
+	return nil
+}
+
+// Delete removes the keys. Each key is deleted on its own, since a Redis
+// cluster keeps them in different slots.
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, s.prefix+key)
+		}
+		return nil
+	})
+	if err != nil {
+		ErrorsTotal.WithLabelValues("delete").Inc()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/cache"
+	"github.com/Okabe-Junya/golink-backend/pkg/consistency"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	store := cache.NewRedisStore(client, "test:")
+	ctx := context.Background()
+
+	_, found, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	require.NoError(t, store.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, store.Set(ctx, "b", []byte("2"), time.Minute))
+	value, found, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("1"), value)
+	assert.True(t, server.Exists("test:a"), "keys are prefixed")
+
+	require.NoError(t, store.Delete(ctx, "a", "b"))
+	_, found, _ = store.Get(ctx, "b")
+	assert.False(t, found)
+
+	require.NoError(t, store.Set(ctx, "c", []byte("3"), time.Minute))
+	server.FastForward(2 * time.Minute)
+	_, found, _ = store.Get(ctx, "c")
+	assert.False(t, found, "values expire after their TTL")
+
+	server.Close()
+	_, _, err = store.Get(ctx, "a")
+	assert.Error(t, err)
+}
+
+func TestAllowed(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, cache.Allowed(ctx))
+	assert.True(t, cache.Allowed(cache.Allow(ctx)))
+	assert.False(t, cache.Allowed(cache.Allow(consistency.WithStrong(ctx))), "strong reads skip caches")
+}
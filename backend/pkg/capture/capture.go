@@ -0,0 +1,394 @@
+// Package capture records the requests of one link or one user, and the
+// responses to them, for debugging.
+//
+// When someone reports that a link behaves differently for them, an admin
+// starts a capture session for the link or the user. Until the session
+// expires, every matching request is recorded with its response in a
+// fixed-size log, so the admin can see what the server answered without
+// turning on verbose logging for everyone. Credentials are redacted and
+// bodies truncated before anything is kept, and the log is dropped a while
+// after the session ends.
+package capture
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Defaults of a Recorder
+const (
+	// DefaultTTL is how long a session captures when no duration is given
+	DefaultTTL = 30 * time.Minute
+	// DefaultMaxTTL is the longest a session may capture
+	DefaultMaxTTL = 24 * time.Hour
+	// DefaultMaxEntries is how many exchanges a session keeps; older ones
+	// are dropped first
+	DefaultMaxEntries = 100
+	// DefaultRetention is how long the log of a session is kept after it
+	// stops capturing
+	DefaultRetention = 24 * time.Hour
+	// maxSessions bounds how many sessions exist at once
+	maxSessions = 20
+	// maxBodyBytes bounds how much of each body is kept
+	maxBodyBytes = 4096
+)
+
+// redacted replaces the values of credentials
+const redacted = "[redacted]"
+
+var capturedExchanges = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "golink_debug_captured_requests_total",
+	Help: "Total number of requests recorded by debug capture sessions",
+})
+
+// Target selects the requests a session records: the ones for a short code,
+// the ones of a user, or with both only the user's requests for the short code
+type Target struct {
+	Short  string `json:"short,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+// Session is a capture of the requests matching its target until it expires
+type Session struct {
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Target
+	ID        string `json:"id"`
+	CreatedBy string `json:"created_by"`
+	// Captured counts the matching requests, including ones the log dropped
+	Captured int `json:"captured"`
+}
+
+// Active reports whether the session still captures at now
+func (s *Session) Active(now time.Time) bool {
+	return now.Before(s.ExpiresAt)
+}
+
+// Exchange is one recorded request and the response to it
+type Exchange struct {
+	Time            time.Time           `json:"time"`
+	RequestHeaders  map[string][]string `json:"request_headers"`
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	Method          string              `json:"method"`
+	// URL is the path and query of the request, with credentials redacted
+	URL          string `json:"url"`
+	UserID       string `json:"user_id,omitempty"`
+	RemoteAddr   string `json:"remote_addr"`
+	RequestBody  string `json:"request_body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	Status       int    `json:"status"`
+	DurationMS   int64  `json:"duration_ms"`
+}
+
+// Option configures a Recorder
+type Option func(*Recorder)
+
+// WithMaxTTL sets the longest a session may capture
+func WithMaxTTL(ttl time.Duration) Option {
+	return func(r *Recorder) {
+		if ttl > 0 {
+			r.maxTTL = ttl
+		}
+	}
+}
+
+// WithMaxEntries sets how many exchanges a session keeps
+func WithMaxEntries(n int) Option {
+	return func(r *Recorder) {
+		if n > 0 {
+			r.maxEntries = n
+		}
+	}
+}
+
+// Recorder keeps the capture sessions and their logs in memory
+type Recorder struct {
+	sessions map[string]*sessionLog
+	now      func() time.Time
+	// active counts the sessions that still capture, so requests skip the
+	// lock while there are none
+	active     atomic.Int32
+	mutex      sync.Mutex
+	maxTTL     time.Duration
+	maxEntries int
+}
+
+// sessionLog is a session and the ring of exchanges it recorded
+type sessionLog struct {
+	session Session
+	entries []Exchange
+	next    int
+}
+
+// NewRecorder creates a recorder without sessions
+func NewRecorder(opts ...Option) *Recorder {
+	r := &Recorder{
+		sessions:   make(map[string]*sessionLog),
+		now:        time.Now,
+		maxTTL:     DefaultMaxTTL,
+		maxEntries: DefaultMaxEntries,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Start starts capturing the requests of target for ttl, or DefaultTTL when
+// ttl is zero
+func (r *Recorder) Start(target Target, ttl time.Duration, createdBy string) (Session, error) {
+	if target.Short == "" && target.UserID == "" {
+		return Session{}, fmt.Errorf("a short code or a user ID is required")
+	}
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < 0 || ttl > r.maxTTL {
+		return Session{}, fmt.Errorf("ttl must be positive and at most %s", r.maxTTL)
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Session{}, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := r.now()
+	r.prune(now)
+	if len(r.sessions) >= maxSessions {
+		return Session{}, fmt.Errorf("at most %d capture sessions may exist at once", maxSessions)
+	}
+	log := &sessionLog{session: Session{
+		ID:        hex.EncodeToString(b),
+		Target:    target,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}}
+	r.sessions[log.session.ID] = log
+	r.countActive(now)
+	return log.session, nil
+}
+
+// Sessions returns the sessions whose logs are still kept, newest first
+func (r *Recorder) Sessions() []Session {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.prune(r.now())
+
+	sessions := make([]Session, 0, len(r.sessions))
+	for _, log := range r.sessions {
+		sessions = append(sessions, log.session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// Get returns the session with id and the exchanges it kept, oldest first
+func (r *Recorder) Get(id string) (Session, []Exchange, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.prune(r.now())
+
+	log, ok := r.sessions[id]
+	if !ok {
+		return Session{}, nil, false
+	}
+	exchanges := make([]Exchange, 0, len(log.entries))
+	exchanges = append(exchanges, log.entries[log.next:]...)
+	exchanges = append(exchanges, log.entries[:log.next]...)
+	return log.session, exchanges, true
+}
+
+// Stop ends the session with id and drops its log
+func (r *Recorder) Stop(id string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.sessions[id]; !ok {
+		return false
+	}
+	delete(r.sessions, id)
+	r.countActive(r.now())
+	return true
+}
+
+// prune drops the logs kept past their retention. The caller must hold the
+// mutex.
+func (r *Recorder) prune(now time.Time) {
+	for id, log := range r.sessions {
+		if now.After(log.session.ExpiresAt.Add(DefaultRetention)) {
+			delete(r.sessions, id)
+		}
+	}
+}
+
+// countActive counts the sessions that still capture. The caller must hold
+// the mutex.
+func (r *Recorder) countActive(now time.Time) {
+	var active int32
+	for _, log := range r.sessions {
+		if log.session.Active(now) {
+			active++
+		}
+	}
+	r.active.Store(active)
+}
+
+// matching returns the active sessions that record a request for short by
+// userID
+func (r *Recorder) matching(short, userID string, now time.Time) []*sessionLog {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var logs []*sessionLog
+	for _, log := range r.sessions {
+		target := log.session.Target
+		if !log.session.Active(now) ||
+			(target.Short != "" && !strings.EqualFold(target.Short, short)) ||
+			(target.UserID != "" && target.UserID != userID) {
+			continue
+		}
+		logs = append(logs, log)
+	}
+	if len(logs) == 0 {
+		r.countActive(now)
+	}
+	return logs
+}
+
+// record adds an exchange to the logs
+func (r *Recorder) record(logs []*sessionLog, exchange Exchange) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, log := range logs {
+		log.session.Captured++
+		if len(log.entries) < r.maxEntries {
+			log.entries = append(log.entries, exchange)
+			continue
+		}
+		log.entries[log.next] = exchange
+		log.next = (log.next + 1) % r.maxEntries
+	}
+	capturedExchanges.Inc()
+}
+
+// Middleware records the requests matching a session. userID returns the
+// user a request was authenticated as, so it must run after authentication.
+func (r *Recorder) Middleware(userID func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if r.active.Load() == 0 {
+				next.ServeHTTP(w, req)
+				return
+			}
+			start := r.now()
+			user := userID(req)
+			logs := r.matching(ShortOf(req.URL.Path), user, start)
+			if len(logs) == 0 {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			var requestBody []byte
+			if req.Body != nil {
+				requestBody, _ = io.ReadAll(io.LimitReader(req.Body, maxBodyBytes+1))
+				req.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(requestBody), req.Body), req.Body}
+			}
+			cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(cw, req)
+
+			r.record(logs, Exchange{
+				Time:            start,
+				Method:          req.Method,
+				URL:             redactURL(req),
+				UserID:          user,
+				RemoteAddr:      req.RemoteAddr,
+				RequestHeaders:  redactHeaders(req.Header),
+				RequestBody:     sanitizeBody(requestBody, req.Header.Get("Content-Type")),
+				Status:          cw.status,
+				ResponseHeaders: redactHeaders(w.Header()),
+				ResponseBody:    sanitizeBody(cw.body.Bytes(), w.Header().Get("Content-Type")),
+				DurationMS:      r.now().Sub(start).Milliseconds(),
+			})
+		})
+	}
+}
+
+// ShortOf returns the short code a request path is about: the code of a
+// redirect, or of a link's API endpoints. Other paths have none.
+func ShortOf(path string) string {
+	for _, prefix := range []string{"/api/links/", "/api/analytics/links/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			return trimSubresource(rest)
+		}
+	}
+	if strings.HasPrefix(path, "/api/") || path == "/" {
+		return ""
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+// linkSubresources are the endings of per-link API paths that follow the
+// short code, longest first
+var linkSubresources = []string{
+	"/snapshot/restore", "/transfer/accept", "/undo-delete", "/history",
+	"/rollback", "/snapshot", "/restore", "/references", "/rollout", "/preview",
+	"/transfer", "/favorite", "/archive", "/deprecation", "/rename", "/timeseries", "/forecast", "/referrers",
+}
+
+// trimSubresource cuts the subresource off a per-link API path the way the
+// router does
+func trimSubresource(rest string) string {
+	if short, _, ok := strings.Cut(rest, "/aliases"); ok {
+		return short
+	}
+	for _, suffix := range linkSubresources {
+		if short, ok := strings.CutSuffix(rest, suffix); ok {
+			return short
+		}
+	}
+	return rest
+}
+
+// captureWriter keeps the status and the start of the body of a response
+type captureWriter struct {
+	http.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if room := maxBodyBytes + 1 - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(room, len(b))])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,101 @@
+package capture
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userKey struct{}
+
+// serve sends a request by userID through the recorder's middleware
+func serve(r *Recorder, method, target, userID, body string) {
+	handler := r.Middleware(func(req *http.Request) string {
+		id, _ := req.Context().Value(userKey{}).(string)
+		return id
+	})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"short":"docs","api_key":"k"}`))
+	}))
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer glk_secret")
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, userID))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestRecorder(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRecorder(WithMaxEntries(2), WithMaxTTL(time.Hour))
+	r.now = func() time.Time { return now }
+
+	_, err := r.Start(Target{}, 0, "admin")
+	assert.Error(t, err)
+	_, err = r.Start(Target{Short: "docs"}, 2*time.Hour, "admin")
+	assert.Error(t, err)
+
+	session, err := r.Start(Target{Short: "docs", UserID: "user-1"}, 0, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(DefaultTTL), session.ExpiresAt)
+
+	// Only the user's requests for the link are recorded, credentials redacted
+	serve(r, http.MethodPost, "/api/links/docs/aliases?token=t&x=1", "user-1", `{"password":"p","short":"docs"}`)
+	serve(r, http.MethodGet, "/docs", "user-2", "")
+	serve(r, http.MethodGet, "/other", "user-1", "")
+	_, exchanges, ok := r.Get(session.ID)
+	require.True(t, ok)
+	require.Len(t, exchanges, 1)
+	exchange := exchanges[0]
+	assert.Equal(t, "/api/links/docs/aliases?token=%5Bredacted%5D&x=1", exchange.URL)
+	assert.Equal(t, []string{redacted}, exchange.RequestHeaders["Authorization"])
+	assert.JSONEq(t, `{"password":"[redacted]","short":"docs"}`, exchange.RequestBody)
+	assert.Equal(t, http.StatusCreated, exchange.Status)
+	assert.Equal(t, []string{redacted}, exchange.ResponseHeaders["Set-Cookie"])
+	assert.JSONEq(t, `{"short":"docs","api_key":"[redacted]"}`, exchange.ResponseBody)
+
+	// The log keeps the latest requests
+	for _, path := range []string{"/docs?n=1", "/docs?n=2"} {
+		serve(r, http.MethodGet, path, "user-1", "")
+	}
+	session, exchanges, _ = r.Get(session.ID)
+	assert.Equal(t, 3, session.Captured)
+	require.Len(t, exchanges, 2)
+	assert.Equal(t, "/docs?n=1", exchanges[0].URL)
+	assert.Equal(t, "/docs?n=2", exchanges[1].URL)
+
+	// An expired session stops recording, and its log is dropped later
+	now = now.Add(DefaultTTL)
+	serve(r, http.MethodGet, "/docs?n=3", "user-1", "")
+	session, _, _ = r.Get(session.ID)
+	assert.Equal(t, 3, session.Captured)
+	assert.Equal(t, int32(0), r.active.Load())
+	now = now.Add(DefaultRetention + time.Second)
+	_, _, ok = r.Get(session.ID)
+	assert.False(t, ok)
+	assert.Empty(t, r.Sessions())
+}
+
+func TestShortOf(t *testing.T) {
+	tests := map[string]string{
+		"/docs":                                "docs",
+		"/team/docs":                           "team/docs",
+		"/api/links/team/docs":                 "team/docs",
+		"/api/links/docs/snapshot/restore":     "docs",
+		"/api/links/docs/aliases/wiki":         "docs",
+		"/api/analytics/links/docs/timeseries": "docs",
+		"/api/links":                           "",
+		"/api/admin/captures":                  "",
+		"/":                                    "",
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, ShortOf(path), path)
+	}
+}
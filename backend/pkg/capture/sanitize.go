@@ -0,0 +1,118 @@
+package capture
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// sensitiveWords mark the names of headers, query parameters and JSON fields
+// whose values are credentials
+var sensitiveWords = []string{
+	"auth", "cookie", "token", "secret", "password", "key", "signature", "session", "csrf",
+}
+
+// sensitive reports whether the value named name must be redacted
+func sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range sensitiveWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeaders copies headers with the values of credentials redacted
+func redactHeaders(headers http.Header) map[string][]string {
+	redactedHeaders := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		if sensitive(name) {
+			redactedHeaders[name] = []string{redacted}
+			continue
+		}
+		redactedHeaders[name] = append([]string(nil), values...)
+	}
+	return redactedHeaders
+}
+
+// redactURL returns the path and query of a request with the values of
+// credentials redacted
+func redactURL(r *http.Request) string {
+	if r.URL.RawQuery == "" {
+		return r.URL.Path
+	}
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return r.URL.Path + "?" + redacted
+	}
+	for name := range query {
+		if sensitive(name) {
+			query[name] = []string{redacted}
+		}
+	}
+	return r.URL.Path + "?" + query.Encode()
+}
+
+// sanitizeBody returns the start of a body for the log. JSON has the values
+// of credentials redacted, form data too, and other bodies are kept only
+// when they are text.
+func sanitizeBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	truncated := len(body) > maxBodyBytes
+	if truncated {
+		body = body[:maxBodyBytes]
+	}
+
+	switch {
+	case strings.Contains(contentType, "json"):
+		var value any
+		if err := json.Unmarshal(body, &value); err == nil {
+			if redactedJSON, err := json.Marshal(redactJSON(value)); err == nil {
+				return string(redactedJSON)
+			}
+		}
+		// A truncated or invalid document cannot be redacted field by field
+		return "[unparsable JSON body redacted]"
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "[unparsable form body redacted]"
+		}
+		for name := range form {
+			if sensitive(name) {
+				form[name] = []string{redacted}
+			}
+		}
+		return form.Encode()
+	case !utf8.Valid(body):
+		return "[binary body omitted]"
+	}
+	if truncated {
+		return string(body) + "…"
+	}
+	return string(body)
+}
+
+// redactJSON redacts the values of credentials in a decoded JSON value
+func redactJSON(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for name, field := range v {
+			if sensitive(name) {
+				v[name] = redacted
+				continue
+			}
+			v[name] = redactJSON(field)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+// Package classification governs how links are treated according to the
+// confidentiality of the content they lead to.
+package classification
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Classifications a link can carry, from least to most confidential
+const (
+	Public    = "public"
+	Internal  = "internal"
+	Sensitive = "sensitive"
+)
+
+// Levels lists every classification, from least to most confidential
+var Levels = []string{Public, Internal, Sensitive}
+
+// Policy decides how classified links are shown. Links without a
+// classification, stored before classifications existed, are public.
+type Policy struct {
+	// Default is the classification of links created without one
+	Default string
+	// Interstitial lists the classifications whose redirects first show a
+	// page reminding viewers that the content is confidential
+	Interstitial []string
+	// Hidden lists the classifications left out of search and trending for
+	// users other than the link's owner and admins
+	Hidden []string
+}
+
+// DefaultPolicy returns the policy used when none is configured: links are
+// public unless marked otherwise, and sensitive links show an interstitial
+// and are hidden from discovery
+func DefaultPolicy() Policy {
+	return Policy{
+		Default:      Public,
+		Interstitial: []string{Sensitive},
+		Hidden:       []string{Sensitive},
+	}
+}
+
+// Parse normalizes a classification, returning the policy's default for an
+// empty one
+func (p Policy) Parse(raw string) (string, error) {
+	level := strings.ToLower(strings.TrimSpace(raw))
+	if level == "" {
+		level = p.Default
+	}
+	if level == "" {
+		return Public, nil
+	}
+	if !slices.Contains(Levels, level) {
+		return "", fmt.Errorf("classification must be one of %s", strings.Join(Levels, ", "))
+	}
+	return level, nil
+}
+
+// Validate reports the first classification the policy names that does not exist
+func (p Policy) Validate() error {
+	if p.Default != "" && !slices.Contains(Levels, p.Default) {
+		return fmt.Errorf("unknown default classification %q", p.Default)
+	}
+	for _, level := range append(append([]string{}, p.Interstitial...), p.Hidden...) {
+		if !slices.Contains(Levels, level) {
+			return fmt.Errorf("unknown classification %q", level)
+		}
+	}
+	return nil
+}
+
+// RequiresInterstitial reports whether redirects for links of this
+// classification show the confidentiality reminder first
+func (p Policy) RequiresInterstitial(level string) bool {
+	return level != "" && slices.Contains(p.Interstitial, level)
+}
+
+// IsHidden reports whether links of this classification are left out of
+// search and trending for users who are not privileged
+func (p Policy) IsHidden(level string) bool {
+	return level != "" && slices.Contains(p.Hidden, level)
+}
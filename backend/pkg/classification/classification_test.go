@@ -0,0 +1,53 @@
+package classification
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyParse(t *testing.T) {
+	policy := DefaultPolicy()
+
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "", want: Public},
+		{raw: " Internal ", want: Internal},
+		{raw: "sensitive", want: Sensitive},
+		{raw: "secret", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := policy.Parse(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	policy.Default = Internal
+	got, err := policy.Parse("")
+	require.NoError(t, err)
+	assert.Equal(t, Internal, got)
+}
+
+func TestPolicy(t *testing.T) {
+	policy := DefaultPolicy()
+	require.NoError(t, policy.Validate())
+
+	assert.True(t, policy.RequiresInterstitial(Sensitive))
+	assert.False(t, policy.RequiresInterstitial(Internal))
+	assert.False(t, policy.RequiresInterstitial(""), "unclassified links are public")
+	assert.True(t, policy.IsHidden(Sensitive))
+	assert.False(t, policy.IsHidden(Public))
+
+	assert.Error(t, Policy{Default: "secret"}.Validate())
+	assert.Error(t, Policy{Hidden: []string{"Sensitive"}}.Validate())
+}
@@ -0,0 +1,110 @@
+// Package clickstats folds click events into the per-link statistics: the
+// clicks by date, browser, operating system, device type, country, referring
+// site and served region.
+package clickstats
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	pkgerrors "github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/useragent"
+)
+
+// Store updates the statistics of a link
+type Store interface {
+	UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) error
+}
+
+// Option configures a Sink
+type Option func(*Sink)
+
+// WithParser sets how the User-Agent of each click is classified into its
+// browser, operating system and device type
+func WithParser(parser useragent.Parser) Option {
+	return func(s *Sink) {
+		if parser != nil {
+			s.parser = parser
+		}
+	}
+}
+
+// Sink records batches of click events in the link statistics. Only counts
+// are kept, so it may be handed events before they are anonymized.
+type Sink struct {
+	store  Store
+	parser useragent.Parser
+}
+
+// NewSink creates a sink updating the statistics in store
+func NewSink(store Store, opts ...Option) *Sink {
+	s := &Sink{store: store, parser: useragent.Default}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Send records the events with one update per link. Clicks on links that
+// were purged since are dropped.
+func (s *Sink) Send(ctx context.Context, events []models.ClickEvent) error {
+	byShort := make(map[string][]models.ClickEvent)
+	var order []string
+	for _, event := range events {
+		if _, seen := byShort[event.Short]; !seen {
+			order = append(order, event.Short)
+		}
+		byShort[event.Short] = append(byShort[event.Short], event)
+	}
+
+	var errs []error
+	for _, short := range order {
+		clicks := byShort[short]
+		err := s.store.UpdateLinkStats(ctx, short, func(stats *models.LinkStats) {
+			for _, click := range clicks {
+				s.Record(stats, click)
+			}
+		})
+		if err != nil && !pkgerrors.Is(err, pkgerrors.ErrNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Record adds a click event to the statistics
+func (s *Sink) Record(stats *models.LinkStats, event models.ClickEvent) {
+	record(stats, event, s.parser)
+}
+
+// Rebuild returns the statistics of a link as recorded from the given click
+// events alone, classifying their clients with parser
+func Rebuild(short string, events []*models.ClickEvent, parser useragent.Parser) *models.LinkStats {
+	stats := models.NewLinkStats(short)
+	for _, event := range events {
+		record(stats, *event, parser)
+	}
+	return stats
+}
+
+// record adds a click event to the statistics
+func record(stats *models.LinkStats, event models.ClickEvent, parser useragent.Parser) {
+	client := parser.Parse(event.UserAgent)
+	stats.RecordClickAt(event.Time, client.Browser, client.OS, event.Country, ReferringSite(event.Referrer), client.Device)
+	stats.RecordRegion(event.ServedRegion)
+}
+
+// ReferringSite reduces a referrer URL to its host, without a leading "www."
+func ReferringSite(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
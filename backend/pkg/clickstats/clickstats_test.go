@@ -0,0 +1,86 @@
+package clickstats
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	pkgerrors "github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/useragent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps the statistics of the links it knows
+type memoryStore struct {
+	stats   map[string]*models.LinkStats
+	updates int
+}
+
+func (s *memoryStore) UpdateLinkStats(_ context.Context, short string, update func(*models.LinkStats)) error {
+	stats, ok := s.stats[short]
+	if !ok {
+		return pkgerrors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	s.updates++
+	update(stats)
+	return nil
+}
+
+func TestSinkSend(t *testing.T) {
+	store := &memoryStore{stats: map[string]*models.LinkStats{
+		"docs": models.NewLinkStats("docs"),
+	}}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []models.ClickEvent{
+		{
+			Time:      at,
+			Short:     "docs",
+			UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			Referrer:  "https://www.github.com/org/repo",
+			Country:   "JP",
+			// Served for the region of the load balancer
+			ServedRegion: "apac",
+		},
+		{Time: at.Add(time.Hour), Short: "docs"},
+		// Clicks on purged links are dropped
+		{Time: at, Short: "purged"},
+	}
+
+	require.NoError(t, NewSink(store).Send(context.Background(), events))
+
+	stats := store.stats["docs"]
+	assert.Equal(t, 1, store.updates)
+	assert.Equal(t, 2, stats.TotalClicks)
+	assert.Equal(t, map[string]int{"2024-05-01": 2}, stats.ClicksByDate)
+	assert.Equal(t, map[string]int{"Firefox": 1}, stats.Browsers)
+	assert.Equal(t, map[string]int{"Linux": 1}, stats.OperatingSystems)
+	assert.Equal(t, map[string]int{"desktop": 1}, stats.DeviceTypes)
+	assert.Equal(t, map[string]int{"JP": 1}, stats.Countries)
+	assert.Equal(t, map[string]int{"github.com": 1}, stats.ReferringSites)
+	assert.Equal(t, map[string]int{"apac": 1}, stats.Regions)
+	assert.Equal(t, at.Add(time.Hour), stats.LastClickedAt)
+}
+
+// fixedParser classifies every client the same way
+type fixedParser struct{}
+
+func (fixedParser) Parse(string) useragent.Info {
+	return useragent.Info{Browser: "Lynx", OS: "Plan 9", Device: useragent.DeviceDesktop}
+}
+
+func TestSinkWithParser(t *testing.T) {
+	store := &memoryStore{stats: map[string]*models.LinkStats{
+		"docs": models.NewLinkStats("docs"),
+	}}
+	events := []models.ClickEvent{{Time: time.Now(), Short: "docs", UserAgent: "anything"}}
+
+	require.NoError(t, NewSink(store, WithParser(fixedParser{})).Send(context.Background(), events))
+
+	stats := store.stats["docs"]
+	assert.Equal(t, map[string]int{"Lynx": 1}, stats.Browsers)
+	assert.Equal(t, map[string]int{"Plan 9": 1}, stats.OperatingSystems)
+	assert.Equal(t, map[string]int{"desktop": 1}, stats.DeviceTypes)
+}
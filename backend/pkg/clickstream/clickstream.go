@@ -0,0 +1,206 @@
+// Package clickstream records one event per redirect without slowing the
+// redirect down: events are queued in memory and written in batches by a
+// background worker.
+package clickstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+	"github.com/Okabe-Junya/golink-backend/pkg/privacy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Defaults applied to zero options
+const (
+	DefaultBufferSize    = 1000
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 2 * time.Second
+)
+
+var (
+	// EventsRecordedTotal counts the click events written to the sink
+	EventsRecordedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "golink_click_events_recorded_total",
+			Help: "Total number of click events written to the click stream",
+		},
+	)
+
+	// EventsDroppedTotal counts the click events lost by reason
+	EventsDroppedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_click_events_dropped_total",
+			Help: "Total number of click events lost, by reason",
+		},
+		[]string{"reason"},
+	)
+)
+
+// Reasons click events are dropped
+const (
+	dropBufferFull = "buffer_full"
+	dropStopped    = "stopped"
+	dropSendFailed = "send_failed"
+)
+
+// jobName names the writer in the background job metrics
+const jobName = "click-events"
+
+var log = logger.For("clickstream")
+
+// Options configures a Recorder. Zero values select the defaults.
+type Options struct {
+	// BufferSize is how many events wait for the worker before new ones are dropped
+	BufferSize int
+	// BatchSize is the most events written at once
+	BatchSize int
+	// FlushInterval is the longest an event waits for its batch to fill
+	FlushInterval time.Duration
+}
+
+// Recorder queues click events and writes them to a sink in the background.
+// Recording never blocks: when the queue is full the event is dropped and
+// counted, since a redirect matters more than its analytics.
+type Recorder struct {
+	sink     privacy.Sink
+	queue    chan models.ClickEvent
+	done     chan struct{}
+	opts     Options
+	mutex    sync.RWMutex
+	started  bool
+	stopping bool
+}
+
+// New creates a recorder writing to sink, which should anonymize the events
+func New(sink privacy.Sink, opts Options) *Recorder {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	return &Recorder{
+		sink:  sink,
+		queue: make(chan models.ClickEvent, opts.BufferSize),
+		done:  make(chan struct{}),
+		opts:  opts,
+	}
+}
+
+// Record queues an event for the worker
+func (r *Recorder) Record(event models.ClickEvent) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.stopping {
+		EventsDroppedTotal.WithLabelValues(dropStopped).Inc()
+		return
+	}
+	select {
+	case r.queue <- event:
+	default:
+		EventsDroppedTotal.WithLabelValues(dropBufferFull).Inc()
+	}
+}
+
+// Start starts the worker
+func (r *Recorder) Start(context.Context) error {
+	r.mutex.Lock()
+	r.started = true
+	r.mutex.Unlock()
+	go r.run()
+	return nil
+}
+
+// Stop stops accepting events and waits for the worker to write the queued
+// ones, giving up when ctx is done
+func (r *Recorder) Stop(ctx context.Context) error {
+	r.mutex.Lock()
+	if r.stopping {
+		r.mutex.Unlock()
+		return nil
+	}
+	r.stopping = true
+	started := r.started
+	// No Record holds the read lock now, so closing the queue is safe
+	close(r.queue)
+	r.mutex.Unlock()
+
+	if !started {
+		return nil
+	}
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run writes queued events in batches until the queue is closed and drained
+func (r *Recorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ClickEvent, 0, r.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := r.sink.Send(context.Background(), batch)
+		jobs.Record(jobName, err)
+		if err != nil {
+			EventsDroppedTotal.WithLabelValues(dropSendFailed).Add(float64(len(batch)))
+			log.Error("Failed to record click events", err, logger.Fields{"job": jobName, "events": len(batch)})
+		} else {
+			EventsRecordedTotal.Add(float64(len(batch)))
+		}
+		batch = make([]models.ClickEvent, 0, r.opts.BatchSize)
+	}
+
+	for {
+		select {
+		case event, ok := <-r.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= r.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Tee returns a sink that sends every batch to each of sinks. A batch one
+// sink failed on is still sent to the others.
+func Tee(sinks ...privacy.Sink) privacy.Sink {
+	return teeSink(sinks)
+}
+
+// teeSink sends batches to several sinks
+type teeSink []privacy.Sink
+
+// Send sends the events to every sink
+func (t teeSink) Send(ctx context.Context, events []models.ClickEvent) error {
+	var errs []error
+	for _, sink := range t {
+		if err := sink.Send(ctx, events); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package clickstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink keeps every batch it is sent
+type recordingSink struct {
+	batches [][]models.ClickEvent
+	mutex   sync.Mutex
+}
+
+func (s *recordingSink) Send(_ context.Context, events []models.ClickEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.batches = append(s.batches, append([]models.ClickEvent{}, events...))
+	return nil
+}
+
+func (s *recordingSink) events() []models.ClickEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var events []models.ClickEvent
+	for _, batch := range s.batches {
+		events = append(events, batch...)
+	}
+	return events
+}
+
+func TestRecorderBatches(t *testing.T) {
+	sink := &recordingSink{}
+	r := New(sink, Options{BatchSize: 2, FlushInterval: time.Hour})
+	require.NoError(t, r.Start(context.Background()))
+
+	for _, short := range []string{"a", "b", "c"} {
+		r.Record(models.ClickEvent{Short: short})
+	}
+	// A full batch is written without waiting for the interval
+	assert.Eventually(t, func() bool { return len(sink.events()) == 2 }, time.Second, 5*time.Millisecond)
+
+	// Stopping writes the rest and drops later events
+	require.NoError(t, r.Stop(context.Background()))
+	r.Record(models.ClickEvent{Short: "d"})
+	events := sink.events()
+	require.Len(t, events, 3)
+	assert.Equal(t, "c", events[2].Short)
+}
+
+func TestRecorderFlushInterval(t *testing.T) {
+	sink := &recordingSink{}
+	r := New(sink, Options{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	require.NoError(t, r.Start(context.Background()))
+	defer r.Stop(context.Background())
+
+	r.Record(models.ClickEvent{Short: "a"})
+	assert.Eventually(t, func() bool { return len(sink.events()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestRecorderNeverBlocks(t *testing.T) {
+	sink := &recordingSink{}
+	// Not started, so nothing drains the queue
+	r := New(sink, Options{BufferSize: 1})
+	r.Record(models.ClickEvent{Short: "a"})
+	r.Record(models.ClickEvent{Short: "b"})
+	assert.Len(t, r.queue, 1)
+	require.NoError(t, r.Stop(context.Background()))
+}
+
+// failingSink rejects every batch
+type failingSink struct{}
+
+func (failingSink) Send(context.Context, []models.ClickEvent) error {
+	return errors.New("unavailable")
+}
+
+func TestTee(t *testing.T) {
+	first, second := &recordingSink{}, &recordingSink{}
+	events := []models.ClickEvent{{Short: "a"}}
+
+	require.NoError(t, Tee(first, second).Send(context.Background(), events))
+	assert.Equal(t, events, first.events())
+	assert.Equal(t, events, second.events())
+
+	// A failing sink does not keep the batch from the others
+	assert.Error(t, Tee(failingSink{}, first).Send(context.Background(), events))
+	assert.Len(t, first.events(), 2)
+}
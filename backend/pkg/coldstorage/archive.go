@@ -0,0 +1,73 @@
+// Package coldstorage exports the full statistics of links that are no
+// longer in use before their daily clicks are compacted into yearly totals.
+//
+// Each export is a JSON object named after the link and the time of export,
+// such as "link-stats/team%2Fdocs/20250102T030405Z.json", so a link that is
+// compacted more than once keeps one object per compaction.
+package coldstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// DefaultPrefix is the object name prefix used when none is configured
+const DefaultPrefix = "link-stats"
+
+// Archive writes link statistics to a Cloud Storage bucket
+type Archive struct {
+	// open creates the named object; replaced in tests
+	open   func(ctx context.Context, name string) io.WriteCloser
+	now    func() time.Time
+	bucket string
+	prefix string
+}
+
+// NewGCSArchive creates an Archive that writes below prefix in bucket
+func NewGCSArchive(client *storage.Client, bucket, prefix string) *Archive {
+	handle := client.Bucket(bucket)
+	return newArchive(bucket, prefix, func(ctx context.Context, name string) io.WriteCloser {
+		w := handle.Object(name).NewWriter(ctx)
+		w.ContentType = "application/json"
+		return w
+	})
+}
+
+// newArchive creates an Archive that writes objects with open
+func newArchive(bucket, prefix string, open func(ctx context.Context, name string) io.WriteCloser) *Archive {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return &Archive{open: open, now: time.Now, bucket: bucket, prefix: prefix}
+}
+
+// Put exports stats and returns the gs:// URI of the object written. Its
+// signature matches repositories.StatsArchiveFunc.
+func (a *Archive) Put(ctx context.Context, stats *models.LinkStats) (string, error) {
+	name := a.objectName(stats.Short)
+	w := a.open(ctx, name)
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		w.Close()
+		return "", fmt.Errorf("coldstorage: writing %s: %w", name, err)
+	}
+	// The object is only committed once the writer is closed
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("coldstorage: writing %s: %w", name, err)
+	}
+	return "gs://" + a.bucket + "/" + name, nil
+}
+
+// objectName returns the name of a new export of a link's statistics.
+// Namespaced short codes contain slashes, so the short code is escaped.
+func (a *Archive) objectName(short string) string {
+	return path.Join(a.prefix, url.PathEscape(short), a.now().UTC().Format("20060102T150405Z")+".json")
+}
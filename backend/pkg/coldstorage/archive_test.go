@@ -0,0 +1,57 @@
+package coldstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryObject collects what is written to one object
+type memoryObject struct {
+	bytes.Buffer
+	closeErr error
+	closed   bool
+}
+
+func (o *memoryObject) Close() error {
+	o.closed = true
+	return o.closeErr
+}
+
+func TestArchivePut(t *testing.T) {
+	objects := map[string]*memoryObject{}
+	var closeErr error
+	archive := newArchive("golink-archive", "", func(ctx context.Context, name string) io.WriteCloser {
+		objects[name] = &memoryObject{closeErr: closeErr}
+		return objects[name]
+	})
+	archive.now = func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	stats := models.NewLinkStats("team/docs")
+	stats.ClicksByDate["2024-12-31"] = 3
+
+	uri, err := archive.Put(context.Background(), stats)
+	require.NoError(t, err)
+	name := "link-stats/team%2Fdocs/20250102T030405Z.json"
+	assert.Equal(t, "gs://golink-archive/"+name, uri)
+	require.Contains(t, objects, name)
+	assert.True(t, objects[name].closed)
+
+	var exported models.LinkStats
+	require.NoError(t, json.Unmarshal(objects[name].Bytes(), &exported))
+	assert.Equal(t, "team/docs", exported.Short)
+	assert.Equal(t, 3, exported.ClicksByDate["2024-12-31"])
+
+	// A failed upload is reported so the stats are not compacted
+	closeErr = errors.New("bucket not found")
+	_, err = archive.Put(context.Background(), stats)
+	assert.Error(t, err)
+}
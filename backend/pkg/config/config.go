@@ -3,17 +3,163 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/capture"
+	"github.com/Okabe-Junya/golink-backend/pkg/classification"
+	"github.com/Okabe-Junya/golink-backend/pkg/clickstream"
+	"github.com/Okabe-Junya/golink-backend/pkg/expiry"
+	"github.com/Okabe-Junya/golink-backend/pkg/export"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+	"github.com/Okabe-Junya/golink-backend/pkg/preview"
+	"github.com/Okabe-Junya/golink-backend/pkg/privacy"
+	"github.com/Okabe-Junya/golink-backend/pkg/retention"
+	"github.com/Okabe-Junya/golink-backend/pkg/safehttp"
+	"github.com/Okabe-Junya/golink-backend/pkg/sandbox"
+	"github.com/Okabe-Junya/golink-backend/pkg/shortcode"
+	"github.com/Okabe-Junya/golink-backend/pkg/storagestats"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlnorm"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlpolicy"
+	"github.com/Okabe-Junya/golink-backend/pkg/webhook"
 )
 
 // Config holds all the configuration for the application
 type Config struct {
-	Auth     AuthConfig
-	Firebase FirebaseConfig
-	CORS     CORSConfig
-	Server   ServerConfig
+	Auth      AuthConfig
+	Firebase  FirebaseConfig
+	Storage   StorageConfig
+	Trash     TrashConfig
+	Sandbox   SandboxConfig
+	Expiry    ExpiryConfig
+	Ranking   RankingConfig
+	ShortCode ShortCodeConfig
+	URL       URLConfig
+	// Classification governs links by the confidentiality of their content
+	Classification ClassificationConfig
+	CORS           CORSConfig
+	Egress         EgressConfig
+	Webhook        WebhookConfig
+	Privacy        PrivacyConfig
+	Analytics      AnalyticsConfig
+	Export         ExportConfig
+	Region         RegionConfig
+	Cache          CacheConfig
+	Redis          RedisConfig
+	RateLimit      RateLimitConfig
+	Debug          DebugConfig
+	Server         ServerConfig
+}
+
+// URLConfig holds limits for link destination URLs
+type URLConfig struct {
+	// PreviewTTL is how long a destination's preview metadata is cached
+	PreviewTTL time.Duration
+	// BlockedDomains and BlockedPatterns (regular expressions) reject destinations
+	BlockedDomains   []string
+	BlockedPatterns  []string
+	MaxLength        int
+	MaxQueryLength   int
+	AllowCredentials bool
+	// HealthCheck probes new and changed destinations in the background
+	HealthCheck bool
+	// Previews fetches destination metadata for rich cards on request
+	Previews bool
+	// RejectDuplicates refuses new links whose destination is already linked
+	RejectDuplicates bool
+	// StripTrackingParams removes TrackingParams from destinations before they are stored
+	StripTrackingParams bool
+	TrackingParams      []string
+}
+
+// ClassificationConfig holds the policy for classified links
+type ClassificationConfig struct {
+	// Default is the classification of links created without one
+	Default string
+	// Interstitial lists the classifications whose redirects show a reminder first
+	Interstitial []string
+	// Hidden lists the classifications left out of search and trending
+	// for everyone but the link's owner and admins
+	Hidden []string
+}
+
+// ShortCodeConfig holds settings for generated short codes
+type ShortCodeConfig struct {
+	Alphabet string
+	// Strategy names how codes are generated unless a request picks another
+	Strategy string
+	// Reserved lists short codes users may not claim, in addition to the built-in ones
+	Reserved []string
+	Length   int
+}
+
+// StorageConfig holds storage backend configuration
+type StorageConfig struct {
+	// Backend selects the link storage: "firestore", "postgres", "sqlite",
+	// "redis" or "memory"
+	Backend string
+	// PostgresURL is the connection string of the PostgreSQL database
+	PostgresURL string
+	// SQLitePath is the database file of the sqlite backend
+	SQLitePath string
+	// RedisWriteThrough writes the changes of the redis backend through to
+	// Firestore, which also keeps the data besides links
+	RedisWriteThrough bool
+	// ProjectID is the Google Cloud project of the Firestore database
+	ProjectID string
+	// IndexCheck verifies the Firestore composite indexes at startup: "off",
+	// "warn" to log the missing ones or "fail" to refuse to start
+	IndexCheck string
+	// StatsInterval is how often one collection is inspected for the storage
+	// statistics; zero disables them
+	StatsInterval time.Duration
+	// MaxLinksPerRequest caps the links a request loads when it lists every
+	// link; zero removes the cap
+	MaxLinksPerRequest int
+}
+
+// TrashConfig holds settings for deleted links
+type TrashConfig struct {
+	// UndoWindow is how long after a delete its owner can undo it
+	UndoWindow time.Duration
+}
+
+// SandboxConfig holds settings for the namespace anyone may try links out in
+type SandboxConfig struct {
+	// Namespace is the sandbox namespace; empty disables the sandbox
+	Namespace string
+	// TTL is how long after its creation a sandbox link expires
+	TTL time.Duration
+	// SweepInterval is how often expired sandbox links are purged
+	SweepInterval time.Duration
+}
+
+// ExpiryConfig holds settings for the sweeper of expired links
+type ExpiryConfig struct {
+	// SweepInterval is how often expired links are flagged; zero disables
+	// the sweeper
+	SweepInterval time.Duration
+	// SweepJitter is the most each sweep is delayed at random
+	SweepJitter time.Duration
+	// TrashAfter moves links expired this long to the trash; zero only
+	// flags them
+	TrashAfter time.Duration
+	// Lease is where servers take turns sweeping: "none" to sweep on every
+	// server, "firestore" or "redis"
+	Lease string
+}
+
+// RankingConfig holds settings for ordering links by popularity
+type RankingConfig struct {
+	// PopularityHalfLife is how long it takes for a click's weight to halve
+	PopularityHalfLife time.Duration
+	// ClickHistoryRetention is how long a user's clicks personalize their search
+	ClickHistoryRetention time.Duration
+	// PersonalizedSearch records each user's clicks to boost their search results
+	PersonalizedSearch bool
 }
 
 // ServerConfig holds server-specific configuration
@@ -24,6 +170,9 @@ type ServerConfig struct {
 	WriteTimeout    time.Duration
 	IdleTimeout     time.Duration
 	ShutdownTimeout time.Duration
+	// TrustedProxyHops is the number of proxies in front of the service whose
+	// X-Forwarded-For entries name the client
+	TrustedProxyHops int
 }
 
 // FirebaseConfig holds Firebase-specific configuration
@@ -32,18 +181,236 @@ type FirebaseConfig struct {
 	CredentialsFile string
 }
 
+// EgressConfig holds the proxy settings for outbound HTTP calls
+type EgressConfig struct {
+	// ProxyURL overrides HTTPS_PROXY/HTTP_PROXY; "off" forces direct connections
+	ProxyURL string
+	// NoProxy lists destinations reached without the proxy, in addition to NO_PROXY
+	NoProxy []string
+}
+
+// WebhookConfig holds settings shared by inbound and outbound webhooks
+type WebhookConfig struct {
+	// IndexerSecrets authenticate link reference reports; reporting is disabled without one
+	IndexerSecrets []string
+	// ReplayWindow is how far a signed request's timestamp may be from now
+	ReplayWindow time.Duration
+	// Outbound enables delivering link events to the webhooks admins register
+	Outbound bool
+	// MaxAttempts is how many requests are made for a delivery before it is given up
+	MaxAttempts int
+	// RetryBackoff is the wait before the first retry, doubling up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// Timeout bounds each delivery request
+	Timeout time.Duration
+}
+
+// PrivacyConfig holds the anonymization applied to exported click events
+type PrivacyConfig struct {
+	// HashSecret keys user ID hashes; set it so every instance hashes alike
+	HashSecret string
+	// GeoPrecision is the most precise location exported: "city", "region", "country" or "none"
+	GeoPrecision   string
+	SaltRotation   time.Duration
+	IPv4PrefixBits int
+	IPv6PrefixBits int
+}
+
+// AnalyticsConfig holds settings for recording clicks
+type AnalyticsConfig struct {
+	// ClickEventBuffer is how many click events wait to be written before
+	// new ones are dropped
+	ClickEventBuffer int
+	// ClickEvents records an anonymized event for every redirect
+	ClickEvents bool
+	// GeoIPDatabase is the MaxMind GeoLite2 or GeoIP2 database clicks are
+	// located with; without one only the proxy's country header is used
+	GeoIPDatabase string
+	// LinkStats counts every redirect in the link statistics by date,
+	// browser, operating system, device type, country and referring site
+	LinkStats bool
+	// ProductMetrics counts how often product features are used, without
+	// anything about who used them, for /api/admin/product-metrics
+	ProductMetrics bool
+	// DailyStatsRetention is how long the clicks of each day are kept before
+	// they are rolled up into monthly totals; zero keeps them forever
+	DailyStatsRetention time.Duration
+	// ClickEventRetention is how long click events are kept; zero keeps them
+	// forever
+	ClickEventRetention time.Duration
+	// RetentionInterval is how often the retentions are applied
+	RetentionInterval time.Duration
+}
+
+// ExportConfig holds where click events are exported for analysts
+type ExportConfig struct {
+	// Exporter selects the destination: "none" or "bigquery"
+	Exporter string
+	// BigQueryProject, BigQueryDataset and BigQueryTable name the table
+	// click events are streamed to
+	BigQueryProject string
+	BigQueryDataset string
+	BigQueryTable   string
+}
+
+// RegionConfig holds how the region of a redirect is decided, which picks a
+// link's regional destination
+type RegionConfig struct {
+	// Header is the request header the load balancer reports the region in
+	Header string
+	// Countries maps client countries to regions as "DE=eu" pairs; clients
+	// are located by GeoIP or the proxy's country header
+	Countries []string
+}
+
+// CacheConfig holds the settings of the response and link caches
+type CacheConfig struct {
+	// Backend selects where responses are cached: "memory", per instance,
+	// or "redis", shared by all instances together with looked up links
+	Backend string
+	// LinkTTL is how long links looked up by redirects stay in the shared cache
+	LinkTTL time.Duration
+	// HotLinkSize is the most links looked up by redirects kept in memory;
+	// zero disables the in-memory link cache
+	HotLinkSize int
+	// HotLinkTTL is how long links stay in the in-memory link cache
+	HotLinkTTL time.Duration
+	// ResponseMaxEntries is the most responses cached in memory; zero or less is unbounded
+	ResponseMaxEntries int
+	// ResponseMaxBytes is the most memory cached responses hold; zero or less is unbounded
+	ResponseMaxBytes int
+}
+
+// RedisConfig holds the connection settings of Redis
+type RedisConfig struct {
+	// Addrs lists the servers; several addresses connect to a cluster
+	Addrs    []string
+	Username string
+	Password string
+	// CAFile is a PEM file of the certificates trusted for TLS; the system's
+	// are used when it is empty
+	CAFile string
+	DB     int
+	// PoolSize is the most connections per server; zero uses the client's default
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	// Timeout bounds reading and writing one command
+	Timeout time.Duration
+	TLS     bool
+}
+
+// RateLimitConfig holds the limits of request rates. Rates are token
+// buckets such as "100/1m", 100 requests refilled over a minute; "0"
+// removes a limit.
+type RateLimitConfig struct {
+	// Store keeps the counters: "memory", per replica, or "redis", shared
+	// by every replica
+	Store string
+	// API and Redirect limit each client IP, APIPerUser and RedirectPerUser
+	// each signed-in user, on /api/ and on every other path
+	API             string
+	APIPerUser      string
+	Redirect        string
+	RedirectPerUser string
+	// Classes lists further route classes and their rates, such as
+	// "search=30/1m:60/1m"
+	Classes []string
+	// Routes assigns normalized routes to classes, such as
+	// "/api/links/search=search"; "exempt" lifts every limit
+	Routes []string
+}
+
+// DebugConfig holds the tools admins diagnose single users' problems with
+type DebugConfig struct {
+	// Capture lets admins record the requests and responses of one link or
+	// one user at /api/admin/captures
+	Capture bool
+	// CaptureMaxTTL is the longest a capture session may record
+	CaptureMaxTTL time.Duration
+	// CaptureMaxEntries is how many requests a capture session keeps
+	CaptureMaxEntries int
+}
+
 // AuthConfig holds authentication-specific configuration
 type AuthConfig struct {
+	// Provider selects how users sign in: "google", "local" accounts or a
+	// "saml" identity provider
+	Provider string
+	// LocalUsersFile is the JSON file holding the local accounts
+	LocalUsersFile   string
 	JWTSecret        string
 	SessionDomain    string
 	SessionSameSite  string
 	SessionKey       string
 	SessionSignKey   string
 	SessionEncrypKey string
-	TokenExpiry      time.Duration
-	SessionMaxAge    int
-	SessionSecure    bool
-	SessionHttpOnly  bool
+	// SessionStore selects server-side session tracking: "none", "memory" or "firestore"
+	SessionStore string
+	// APITokenStore selects where API tokens are kept: "none", "memory" or
+	// "firestore"; "none" disables API tokens
+	APITokenStore string
+	// APITokenTiers lists the limits of API token scopes, such as "read=120/100000"
+	APITokenTiers []string
+	// PasskeyStore selects where admin passkeys are kept: "none", "memory" or
+	// "firestore"; "none" disables passkeys and step-up authentication
+	PasskeyStore string
+	// PasskeyRPID is the WebAuthn relying party ID, the domain passkeys are
+	// bound to, and PasskeyOrigins the origins allowed to use them
+	PasskeyRPID    string
+	PasskeyRPName  string
+	PasskeyOrigins []string
+	// StepUpTTL is how long a passkey check authorizes destructive operations
+	StepUpTTL time.Duration
+	// SAMLMetadataFile is the metadata of the SAML identity provider
+	SAMLMetadataFile string
+	// SAMLEntityID and SAMLACSURL identify this service to the identity
+	// provider and receive its responses
+	SAMLEntityID string
+	SAMLACSURL   string
+	// SAMLEmailAttributes and SAMLNameAttributes name the assertion
+	// attributes holding the email and name of users; empty uses common names
+	SAMLEmailAttributes []string
+	SAMLNameAttributes  []string
+	// OAuthRedirectURL is the OAuth callback registered with the provider
+	OAuthRedirectURL string
+	// FrontendURL is where users land after signing in
+	FrontendURL string
+	// AdminEmails lists the accounts allowed to use the /api/admin endpoints
+	AdminEmails []string
+	// RoleStore selects where the roles of users are kept: "none", "memory"
+	// or "firestore"; "none" gives every user DefaultRole
+	RoleStore string
+	// DefaultRole is the role of users without one assigned: "viewer" or "editor"
+	DefaultRole string
+	// TrustedProxyAuth trusts the X-User-* headers of requests carrying one
+	// of TrustedProxySecrets, set by an authenticating proxy
+	TrustedProxyAuth    bool
+	TrustedProxySecrets []string
+	// GroupsSource selects where the groups of users are looked up for links
+	// restricted to groups: "none", "static" or "directory"
+	GroupsSource string
+	// GroupsFile is the JSON file of the teams of the static groups source
+	GroupsFile string
+	// GroupsDirectorySubject is the Workspace admin the directory groups
+	// source impersonates; empty uses the default credentials as they are
+	GroupsDirectorySubject string
+	// GroupsCacheTTL is how long the groups of a user are reused
+	GroupsCacheTTL time.Duration
+	TokenExpiry    time.Duration
+	// Brute-force protection for the OAuth callback
+	LoginFailureWindow   time.Duration
+	LoginLockoutDuration time.Duration
+	LoginMaxFailures     int
+	SessionMaxAge        int
+	SessionMaxPerUser    int
+	SessionSecure        bool
+	SessionHttpOnly      bool
+
+	// Limits of API tokens whose scopes have no tier
+	APITokenRequestsPerMinute int
+	APITokenMonthlyQuota      int
 }
 
 // CORSConfig holds CORS-specific configuration
@@ -67,16 +434,158 @@ func New() *Config {
 		defaultTokenExpiry     = 24 * time.Hour
 		defaultSessionMaxAge   = 86400 // 1 day in seconds
 		defaultCORSMaxAge      = 300   // 5 minutes
+
+		defaultResponseCacheMaxEntries = 10000
+		defaultResponseCacheMaxBytes   = 64 << 20 // 64 MiB
+		defaultCacheLinkTTL            = 5 * time.Minute
+		defaultHotLinkCacheSize        = 10000
+		defaultHotLinkCacheTTL         = 30 * time.Second
+
+		defaultRedisDialTimeout = 5 * time.Second
+		defaultRedisTimeout     = time.Second
+
+		defaultLoginMaxFailures   = 10
+		defaultLoginFailureWindow = 15 * time.Minute
+		defaultLoginLockout       = 15 * time.Minute
+
+		defaultAPITokenRequestsPerMinute = 60
+		defaultAPITokenMonthlyQuota      = 100000
+
+		defaultStepUpTTL = 10 * time.Minute
 	)
 
 	// Get server configuration
 	port := getEnv("PORT", "8080")
 	domain := getEnv("APP_DOMAIN", "localhost:8080")
+	trustedProxyHops := getIntEnv("TRUSTED_PROXY_HOPS", 0)
 
 	// Get Firebase configuration
 	credJSON := getEnv("FIREBASE_CREDENTIALS_JSON", "")
 	credFile := getEnv("FIREBASE_CREDENTIALS_FILE", "")
 
+	// Get storage configuration
+	storageBackend := getEnv("STORAGE_BACKEND", "firestore")
+	postgresURL := getEnv("POSTGRES_URL", "")
+	sqlitePath := getEnv("SQLITE_PATH", "golink.db")
+	redisWriteThrough := getBoolEnv("REDIS_WRITE_THROUGH", false)
+	storageProjectID := os.Getenv("PROJECT_ID")
+	if storageProjectID == "" {
+		storageProjectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	storageIndexCheck := getEnv("FIRESTORE_INDEX_CHECK", "warn")
+	storageStatsInterval := getDurationEnv("STORAGE_STATS_INTERVAL", storagestats.DefaultInterval)
+	maxLinksPerRequest := getIntEnv("MAX_LINKS_PER_REQUEST", linkcap.DefaultMax)
+	trashUndoWindow := getDurationEnv("DELETE_UNDO_WINDOW", models.DefaultDeleteUndoWindow)
+	sandboxNamespace := getEnv("SANDBOX_NAMESPACE", sandbox.DefaultNamespace)
+	sandboxTTL := getDurationEnv("SANDBOX_TTL", sandbox.DefaultTTL)
+	sandboxSweepInterval := getDurationEnv("SANDBOX_SWEEP_INTERVAL", sandbox.DefaultSweepInterval)
+	expirySweepInterval := getDurationEnv("EXPIRY_SWEEP_INTERVAL", expiry.DefaultInterval)
+	expirySweepJitter := getDurationEnv("EXPIRY_SWEEP_JITTER", expiry.DefaultJitter)
+	expiryTrashAfter := getDurationEnv("EXPIRY_TRASH_AFTER", 0)
+	expiryLease := getEnv("EXPIRY_SWEEP_LEASE", "none")
+	popularityHalfLife := getDurationEnv("POPULARITY_HALF_LIFE", models.DefaultPopularityHalfLife)
+	personalizedSearch := getBoolEnv("SEARCH_PERSONALIZATION", true)
+	clickHistoryRetention := getDurationEnv("CLICK_HISTORY_RETENTION", models.DefaultClickHistoryRetention)
+	regionHeader := getEnv("REGION_HEADER", "")
+	regionCountries := getListEnv("REGION_COUNTRIES")
+
+	// Get short code generation configuration
+	shortCodeLength := getIntEnv("SHORT_CODE_LENGTH", shortcode.DefaultLength)
+	shortCodeAlphabet := getEnv("SHORT_CODE_ALPHABET", shortcode.DefaultAlphabet)
+	shortCodeStrategy := getEnv("SHORT_CODE_STRATEGY", shortcode.DefaultStrategy)
+	shortCodeReserved := getListEnv("RESERVED_SHORT_CODES")
+
+	// Get destination URL limits
+	urlMaxLength := getIntEnv("URL_MAX_LENGTH", urlpolicy.DefaultMaxLength)
+	urlMaxQueryLength := getIntEnv("URL_MAX_QUERY_LENGTH", urlpolicy.DefaultMaxQueryLength)
+	urlAllowCredentials := getBoolEnv("URL_ALLOW_CREDENTIALS", false)
+	urlHealthCheck := getBoolEnv("LINK_HEALTH_CHECK", false)
+	urlPreviews := getBoolEnv("LINK_PREVIEWS", true)
+	urlRejectDuplicates := getBoolEnv("REJECT_DUPLICATE_URLS", false)
+	urlStripTracking := getBoolEnv("URL_STRIP_TRACKING_PARAMS", false)
+	urlTrackingParams := getListEnvDefault("URL_TRACKING_PARAMS", urlnorm.DefaultTrackingParams)
+	urlPreviewTTL := getDurationEnv("LINK_PREVIEW_TTL", preview.DefaultTTL)
+	urlBlockedDomains := getListEnv("URL_BLOCKED_DOMAINS")
+	// Patterns are whitespace-separated since regular expressions may contain commas
+	urlBlockedPatterns := strings.Fields(os.Getenv("URL_BLOCKED_PATTERNS"))
+
+	// Get the classification policy
+	classificationDefault := getEnv("CLASSIFICATION_DEFAULT", classification.Public)
+	classificationInterstitial := getListEnvDefault("CLASSIFICATION_INTERSTITIAL", []string{classification.Sensitive})
+	classificationHidden := getListEnvDefault("CLASSIFICATION_HIDDEN", []string{classification.Sensitive})
+
+	// Get outbound proxy configuration
+	egressProxyURL := getEnv("OUTBOUND_PROXY", "")
+	egressNoProxy := getListEnv("OUTBOUND_NO_PROXY")
+
+	// Get webhook signature configuration
+	webhookReplayWindow := getDurationEnv("WEBHOOK_REPLAY_WINDOW", webhook.DefaultReplayWindow)
+	webhookIndexerSecrets := getListEnv("REFERENCE_INDEXER_SECRETS")
+	webhookOutbound := getBoolEnv("WEBHOOKS", true)
+	webhookMaxAttempts := getIntEnv("WEBHOOK_MAX_ATTEMPTS", webhook.DefaultMaxAttempts)
+	webhookRetryBackoff := getDurationEnv("WEBHOOK_RETRY_BACKOFF", webhook.DefaultRetryBackoff)
+	webhookMaxRetryBackoff := getDurationEnv("WEBHOOK_MAX_RETRY_BACKOFF", webhook.DefaultMaxRetryBackoff)
+	webhookTimeout := getDurationEnv("WEBHOOK_TIMEOUT", safehttp.DefaultTimeout)
+
+	// Get export anonymization configuration
+	privacyHashSecret := os.Getenv("PRIVACY_HASH_SECRET")
+	privacyGeoPrecision := getEnv("PRIVACY_GEO_PRECISION", privacy.DefaultGeoPrecision)
+	privacySaltRotation := getDurationEnv("PRIVACY_SALT_ROTATION", privacy.DefaultSaltRotation)
+	privacyIPv4Prefix := getIntEnv("PRIVACY_IPV4_PREFIX", privacy.DefaultIPv4PrefixBits)
+	privacyIPv6Prefix := getIntEnv("PRIVACY_IPV6_PREFIX", privacy.DefaultIPv6PrefixBits)
+
+	// Get click recording configuration
+	clickEvents := getBoolEnv("CLICK_EVENTS", true)
+	clickEventBuffer := getIntEnv("CLICK_EVENT_BUFFER", clickstream.DefaultBufferSize)
+	linkStats := getBoolEnv("LINK_STATS", true)
+	productMetrics := getBoolEnv("PRODUCT_METRICS", true)
+	dailyStatsRetention := getDurationEnv("DAILY_STATS_RETENTION", 0)
+	clickEventRetention := getDurationEnv("CLICK_EVENT_RETENTION", 0)
+	retentionInterval := getDurationEnv("RETENTION_INTERVAL", retention.DefaultInterval)
+	geoIPDatabase := getEnv("GEOIP_DATABASE", "")
+
+	// Get click export configuration
+	clickExporter := strings.ToLower(getEnv("CLICK_EXPORTER", export.ExporterNone))
+	bigQueryProject := getEnv("BIGQUERY_PROJECT", storageProjectID)
+	bigQueryDataset := getEnv("BIGQUERY_DATASET", "")
+	bigQueryTable := getEnv("BIGQUERY_TABLE", "click_events")
+
+	// Get response cache bounds
+	responseCacheMaxEntries := getIntEnv("RESPONSE_CACHE_MAX_ENTRIES", defaultResponseCacheMaxEntries)
+	responseCacheMaxBytes := getIntEnv("RESPONSE_CACHE_MAX_BYTES", defaultResponseCacheMaxBytes)
+	cacheBackend := strings.ToLower(getEnv("CACHE_BACKEND", "memory"))
+	cacheLinkTTL := getDurationEnv("CACHE_LINK_TTL", defaultCacheLinkTTL)
+	hotLinkCacheSize := getIntEnv("HOT_LINK_CACHE_SIZE", defaultHotLinkCacheSize)
+	hotLinkCacheTTL := getDurationEnv("HOT_LINK_CACHE_TTL", defaultHotLinkCacheTTL)
+
+	// Get Redis configuration
+	redisConfig := RedisConfig{
+		Addrs:        getListEnvDefault("REDIS_ADDR", []string{"localhost:6379"}),
+		Username:     os.Getenv("REDIS_USERNAME"),
+		Password:     os.Getenv("REDIS_PASSWORD"),
+		DB:           getIntEnv("REDIS_DB", 0),
+		TLS:          getBoolEnv("REDIS_TLS", false),
+		CAFile:       os.Getenv("REDIS_TLS_CA_FILE"),
+		PoolSize:     getIntEnv("REDIS_POOL_SIZE", 0),
+		MinIdleConns: getIntEnv("REDIS_MIN_IDLE_CONNS", 0),
+		DialTimeout:  getDurationEnv("REDIS_DIAL_TIMEOUT", defaultRedisDialTimeout),
+		Timeout:      getDurationEnv("REDIS_TIMEOUT", defaultRedisTimeout),
+	}
+
+	// Get debug capture configuration
+	debugCapture := getBoolEnv("DEBUG_CAPTURE", false)
+	rateLimitConfig := RateLimitConfig{
+		Store:           getEnv("RATE_LIMIT_STORE", "memory"),
+		API:             getEnv("RATE_LIMIT_API", "100/1m"),
+		APIPerUser:      getEnv("RATE_LIMIT_API_PER_USER", "300/1m"),
+		Redirect:        getEnv("RATE_LIMIT_REDIRECT", "1000/1m"),
+		RedirectPerUser: getEnv("RATE_LIMIT_REDIRECT_PER_USER", "3000/1m"),
+		Classes:         getListEnv("RATE_LIMIT_CLASSES"),
+		Routes:          getListEnv("RATE_LIMIT_ROUTES"),
+	}
+	debugCaptureMaxTTL := getDurationEnv("DEBUG_CAPTURE_MAX_TTL", capture.DefaultMaxTTL)
+	debugCaptureMaxEntries := getIntEnv("DEBUG_CAPTURE_MAX_ENTRIES", capture.DefaultMaxEntries)
+
 	// Get auth configuration
 	jwtSecret := getEnv("JWT_SECRET", "your-secret-key")
 	tokenExpiry := getDurationEnv("TOKEN_EXPIRY", defaultTokenExpiry)
@@ -88,39 +597,221 @@ func New() *Config {
 	sessionKey := getEnv("SESSION_KEY", "session")
 	sessionSignKey := getEnv("SESSION_SIGN_KEY", "sign-key")
 	sessionEncrypKey := getEnv("SESSION_ENCRYPT_KEY", "encr-key")
+	sessionStore := getEnv("SESSION_STORE", "none")
+	sessionMaxPerUser := getIntEnv("SESSION_MAX_PER_USER", 0)
+	apiTokenStore := getEnv("API_TOKEN_STORE", "none")
+	apiTokenRequestsPerMinute := getIntEnv("API_TOKEN_REQUESTS_PER_MINUTE", defaultAPITokenRequestsPerMinute)
+	apiTokenMonthlyQuota := getIntEnv("API_TOKEN_MONTHLY_QUOTA", defaultAPITokenMonthlyQuota)
+	apiTokenTiers := getListEnv("API_TOKEN_TIERS")
+	loginMaxFailures := getIntEnv("LOGIN_MAX_FAILURES", defaultLoginMaxFailures)
+	loginFailureWindow := getDurationEnv("LOGIN_FAILURE_WINDOW", defaultLoginFailureWindow)
+	loginLockoutDuration := getDurationEnv("LOGIN_LOCKOUT_DURATION", defaultLoginLockout)
+	adminEmails := getListEnv("ADMIN_EMAILS")
+	roleStore := getEnv("ROLE_STORE", "none")
+	defaultRole := strings.ToLower(getEnv("DEFAULT_ROLE", "editor"))
+	trustedProxyAuth := getBoolEnv("TRUSTED_PROXY_AUTH", false)
+	trustedProxySecrets := getListEnv("TRUSTED_PROXY_SECRET")
+	groupsSource := getEnv("GROUPS_SOURCE", "none")
+	groupsFile := getEnv("GROUPS_FILE", "")
+	groupsDirectorySubject := getEnv("GROUPS_DIRECTORY_SUBJECT", "")
+	groupsCacheTTL := getDurationEnv("GROUPS_CACHE_TTL", groups.DefaultTTL)
+	oauthRedirectURL := getEnv("OAUTH_REDIRECT_URL", "http://"+domain+"/api/auth/callback")
+	frontendURL := os.Getenv("FRONTEND_URL")
+	authProvider := strings.ToLower(getEnv("AUTH_PROVIDER", "google"))
+	localUsersFile := getEnv("LOCAL_USERS_FILE", "users.json")
+	samlMetadataFile := getEnv("SAML_IDP_METADATA_FILE", "")
+	samlEntityID := getEnv("SAML_ENTITY_ID", "http://"+domain+"/api/auth/saml/metadata")
+	samlACSURL := getEnv("SAML_ACS_URL", "http://"+domain+"/api/auth/saml/acs")
+	samlEmailAttributes := getListEnv("SAML_EMAIL_ATTRIBUTE")
+	samlNameAttributes := getListEnv("SAML_NAME_ATTRIBUTE")
 
 	// Get CORS configuration
 	corsOrigin := getEnv("CORS_ORIGIN", "http://localhost:3001")
+
+	// Passkeys are bound to the domain the frontend is served from
+	passkeyStore := getEnv("PASSKEY_STORE", "none")
+	passkeyOrigin := corsOrigin
+	if frontendURL != "" {
+		passkeyOrigin = frontendURL
+	}
+	passkeyOrigins := getListEnvDefault("PASSKEY_ORIGINS", []string{strings.TrimRight(passkeyOrigin, "/")})
+	passkeyRPID := getEnv("PASSKEY_RP_ID", strings.Split(domain, ":")[0])
+	passkeyRPName := getEnv("PASSKEY_RP_NAME", "GoLink")
+	stepUpTTL := getDurationEnv("STEP_UP_TTL", defaultStepUpTTL)
 	corsAllowedMethods := []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	corsAllowedHeaders := []string{"Content-Type", "Authorization"}
+	corsAllowedHeaders := []string{"Content-Type", "Authorization", "Cache-Control"}
 	corsAllowCredentials := true
 	corsOptionsPassthrough := false
 	corsMaxAge := getIntEnv("CORS_MAX_AGE", defaultCORSMaxAge)
 
 	return &Config{
 		Server: ServerConfig{
-			Port:            port,
-			Domain:          domain,
-			ReadTimeout:     defaultReadTimeout,
-			WriteTimeout:    defaultWriteTimeout,
-			IdleTimeout:     defaultIdleTimeout,
-			ShutdownTimeout: defaultShutdownTimeout,
+			Port:             port,
+			Domain:           domain,
+			ReadTimeout:      defaultReadTimeout,
+			WriteTimeout:     defaultWriteTimeout,
+			IdleTimeout:      defaultIdleTimeout,
+			ShutdownTimeout:  defaultShutdownTimeout,
+			TrustedProxyHops: trustedProxyHops,
 		},
 		Firebase: FirebaseConfig{
 			CredentialsJSON: credJSON,
 			CredentialsFile: credFile,
 		},
+		Storage: StorageConfig{
+			Backend:            storageBackend,
+			PostgresURL:        postgresURL,
+			SQLitePath:         sqlitePath,
+			RedisWriteThrough:  redisWriteThrough,
+			ProjectID:          storageProjectID,
+			IndexCheck:         storageIndexCheck,
+			StatsInterval:      storageStatsInterval,
+			MaxLinksPerRequest: maxLinksPerRequest,
+		},
+		Trash: TrashConfig{
+			UndoWindow: trashUndoWindow,
+		},
+		Sandbox: SandboxConfig{
+			Namespace:     sandboxNamespace,
+			TTL:           sandboxTTL,
+			SweepInterval: sandboxSweepInterval,
+		},
+		Expiry: ExpiryConfig{
+			SweepInterval: expirySweepInterval,
+			SweepJitter:   expirySweepJitter,
+			TrashAfter:    expiryTrashAfter,
+			Lease:         expiryLease,
+		},
+		Ranking: RankingConfig{
+			PopularityHalfLife:    popularityHalfLife,
+			ClickHistoryRetention: clickHistoryRetention,
+			PersonalizedSearch:    personalizedSearch,
+		},
+		ShortCode: ShortCodeConfig{
+			Length:   shortCodeLength,
+			Alphabet: shortCodeAlphabet,
+			Strategy: shortCodeStrategy,
+			Reserved: shortCodeReserved,
+		},
+		URL: URLConfig{
+			MaxLength:           urlMaxLength,
+			MaxQueryLength:      urlMaxQueryLength,
+			AllowCredentials:    urlAllowCredentials,
+			HealthCheck:         urlHealthCheck,
+			Previews:            urlPreviews,
+			RejectDuplicates:    urlRejectDuplicates,
+			StripTrackingParams: urlStripTracking,
+			TrackingParams:      urlTrackingParams,
+			PreviewTTL:          urlPreviewTTL,
+			BlockedDomains:      urlBlockedDomains,
+			BlockedPatterns:     urlBlockedPatterns,
+		},
+		Classification: ClassificationConfig{
+			Default:      classificationDefault,
+			Interstitial: classificationInterstitial,
+			Hidden:       classificationHidden,
+		},
+		Egress: EgressConfig{
+			ProxyURL: egressProxyURL,
+			NoProxy:  egressNoProxy,
+		},
+		Webhook: WebhookConfig{
+			ReplayWindow:    webhookReplayWindow,
+			IndexerSecrets:  webhookIndexerSecrets,
+			Outbound:        webhookOutbound,
+			MaxAttempts:     webhookMaxAttempts,
+			RetryBackoff:    webhookRetryBackoff,
+			MaxRetryBackoff: webhookMaxRetryBackoff,
+			Timeout:         webhookTimeout,
+		},
+		Privacy: PrivacyConfig{
+			HashSecret:     privacyHashSecret,
+			GeoPrecision:   privacyGeoPrecision,
+			SaltRotation:   privacySaltRotation,
+			IPv4PrefixBits: privacyIPv4Prefix,
+			IPv6PrefixBits: privacyIPv6Prefix,
+		},
+		Analytics: AnalyticsConfig{
+			ClickEventBuffer: clickEventBuffer,
+			ClickEvents:      clickEvents,
+			LinkStats:        linkStats,
+			ProductMetrics:   productMetrics,
+			GeoIPDatabase:    geoIPDatabase,
+
+			DailyStatsRetention: dailyStatsRetention,
+			ClickEventRetention: clickEventRetention,
+			RetentionInterval:   retentionInterval,
+		},
+		Export: ExportConfig{
+			Exporter:        clickExporter,
+			BigQueryProject: bigQueryProject,
+			BigQueryDataset: bigQueryDataset,
+			BigQueryTable:   bigQueryTable,
+		},
+		Region: RegionConfig{
+			Header:    regionHeader,
+			Countries: regionCountries,
+		},
+		Cache: CacheConfig{
+			Backend:            cacheBackend,
+			LinkTTL:            cacheLinkTTL,
+			HotLinkSize:        hotLinkCacheSize,
+			HotLinkTTL:         hotLinkCacheTTL,
+			ResponseMaxEntries: responseCacheMaxEntries,
+			ResponseMaxBytes:   responseCacheMaxBytes,
+		},
+		Redis:     redisConfig,
+		RateLimit: rateLimitConfig,
+		Debug: DebugConfig{
+			Capture:           debugCapture,
+			CaptureMaxTTL:     debugCaptureMaxTTL,
+			CaptureMaxEntries: debugCaptureMaxEntries,
+		},
 		Auth: AuthConfig{
-			JWTSecret:        jwtSecret,
-			TokenExpiry:      tokenExpiry,
-			SessionMaxAge:    sessionMaxAge,
-			SessionSecure:    sessionSecure,
-			SessionHttpOnly:  sessionHttpOnly,
-			SessionDomain:    sessionDomain,
-			SessionSameSite:  sessionSameSite,
-			SessionKey:       sessionKey,
-			SessionSignKey:   sessionSignKey,
-			SessionEncrypKey: sessionEncrypKey,
+			JWTSecret:              jwtSecret,
+			TokenExpiry:            tokenExpiry,
+			SessionMaxAge:          sessionMaxAge,
+			SessionSecure:          sessionSecure,
+			SessionHttpOnly:        sessionHttpOnly,
+			SessionDomain:          sessionDomain,
+			SessionSameSite:        sessionSameSite,
+			SessionKey:             sessionKey,
+			SessionSignKey:         sessionSignKey,
+			SessionEncrypKey:       sessionEncrypKey,
+			SessionStore:           sessionStore,
+			SessionMaxPerUser:      sessionMaxPerUser,
+			APITokenStore:          apiTokenStore,
+			APITokenTiers:          apiTokenTiers,
+			PasskeyStore:           passkeyStore,
+			PasskeyRPID:            passkeyRPID,
+			PasskeyRPName:          passkeyRPName,
+			PasskeyOrigins:         passkeyOrigins,
+			StepUpTTL:              stepUpTTL,
+			AdminEmails:            adminEmails,
+			RoleStore:              roleStore,
+			DefaultRole:            defaultRole,
+			TrustedProxyAuth:       trustedProxyAuth,
+			TrustedProxySecrets:    trustedProxySecrets,
+			GroupsSource:           groupsSource,
+			GroupsFile:             groupsFile,
+			GroupsDirectorySubject: groupsDirectorySubject,
+			GroupsCacheTTL:         groupsCacheTTL,
+			Provider:               authProvider,
+			LocalUsersFile:         localUsersFile,
+			SAMLMetadataFile:       samlMetadataFile,
+			SAMLEntityID:           samlEntityID,
+			SAMLACSURL:             samlACSURL,
+			SAMLEmailAttributes:    samlEmailAttributes,
+			SAMLNameAttributes:     samlNameAttributes,
+			OAuthRedirectURL:       oauthRedirectURL,
+			FrontendURL:            frontendURL,
+
+			LoginMaxFailures:     loginMaxFailures,
+			LoginFailureWindow:   loginFailureWindow,
+			LoginLockoutDuration: loginLockoutDuration,
+
+			APITokenRequestsPerMinute: apiTokenRequestsPerMinute,
+			APITokenMonthlyQuota:      apiTokenMonthlyQuota,
 		},
 		CORS: CORSConfig{
 			Origin:             corsOrigin,
@@ -133,6 +824,43 @@ func New() *Config {
 	}
 }
 
+// PortableSettings are the environment variables describing how the service
+// behaves rather than where it runs: policies, reserved short codes, feature
+// flags and tuning. They are exported with the settings of an environment so
+// another one can be set up alike. Secrets, credentials and addresses of the
+// deployment are left out.
+var PortableSettings = []string{
+	"API_TOKEN_MONTHLY_QUOTA", "API_TOKEN_REQUESTS_PER_MINUTE", "API_TOKEN_STORE", "API_TOKEN_TIERS",
+	"CACHE_BACKEND", "CACHE_LINK_TTL", "CLASSIFICATION_DEFAULT", "CLASSIFICATION_HIDDEN", "CLASSIFICATION_INTERSTITIAL",
+	"CLICK_EVENTS", "CLICK_EVENT_BUFFER", "CLICK_EVENT_RETENTION", "CLICK_EXPORTER", "CLICK_HISTORY_RETENTION",
+	"CORS_MAX_AGE", "DAILY_STATS_RETENTION", "DEBUG_CAPTURE", "DEBUG_CAPTURE_MAX_ENTRIES", "DEBUG_CAPTURE_MAX_TTL",
+	"DEFAULT_ROLE", "DELETE_UNDO_WINDOW", "EXPIRY_SWEEP_INTERVAL", "EXPIRY_SWEEP_JITTER", "EXPIRY_TRASH_AFTER", "GROUPS_CACHE_TTL", "GROUPS_SOURCE", "HOT_LINK_CACHE_SIZE", "HOT_LINK_CACHE_TTL", "LINK_HEALTH_CHECK", "LINK_PREVIEWS", "LINK_PREVIEW_TTL", "LINK_STATS",
+	"LOGIN_FAILURE_WINDOW", "LOGIN_LOCKOUT_DURATION", "LOGIN_MAX_FAILURES", "MAX_LINKS_PER_REQUEST", "PASSKEY_STORE",
+	"POPULARITY_HALF_LIFE", "PRIVACY_GEO_PRECISION", "PRIVACY_IPV4_PREFIX", "PRIVACY_IPV6_PREFIX", "PRIVACY_SALT_ROTATION",
+	"PRODUCT_METRICS",
+	"REGION_COUNTRIES", "REGION_HEADER", "REJECT_DUPLICATE_URLS", "RESERVED_SHORT_CODES", "ROLE_STORE",
+	"RATE_LIMIT_API", "RATE_LIMIT_API_PER_USER", "RATE_LIMIT_CLASSES", "RATE_LIMIT_REDIRECT", "RATE_LIMIT_REDIRECT_PER_USER", "RATE_LIMIT_ROUTES",
+	"RESPONSE_CACHE_MAX_BYTES", "RESPONSE_CACHE_MAX_ENTRIES", "RETENTION_INTERVAL",
+	"SANDBOX_NAMESPACE", "SANDBOX_SWEEP_INTERVAL", "SANDBOX_TTL", "SEARCH_PERSONALIZATION",
+	"SESSION_HTTP_ONLY", "SESSION_MAX_AGE", "SESSION_MAX_PER_USER", "SESSION_SAME_SITE", "SESSION_SECURE", "SESSION_STORE",
+	"SHORT_CODE_ALPHABET", "SHORT_CODE_LENGTH", "SHORT_CODE_STRATEGY", "STEP_UP_TTL", "STORAGE_STATS_INTERVAL", "TOKEN_EXPIRY",
+	"URL_ALLOW_CREDENTIALS", "URL_BLOCKED_DOMAINS", "URL_BLOCKED_PATTERNS", "URL_MAX_LENGTH", "URL_MAX_QUERY_LENGTH",
+	"URL_STRIP_TRACKING_PARAMS", "URL_TRACKING_PARAMS",
+	"WEBHOOKS", "WEBHOOK_MAX_ATTEMPTS", "WEBHOOK_MAX_RETRY_BACKOFF", "WEBHOOK_REPLAY_WINDOW", "WEBHOOK_RETRY_BACKOFF", "WEBHOOK_TIMEOUT",
+}
+
+// PortableEnv returns the portable settings set in the environment. Unset
+// ones are left out, since they take the same default everywhere.
+func PortableEnv() map[string]string {
+	env := make(map[string]string)
+	for _, key := range PortableSettings {
+		if value, ok := os.LookupEnv(key); ok {
+			env[key] = value
+		}
+	}
+	return env
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -200,3 +928,23 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return value
 }
+
+// getListEnv gets a comma-separated environment variable as a list, skipping empty items
+func getListEnv(key string) []string {
+	var values []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// getListEnvDefault gets a comma-separated environment variable as a list,
+// or defaultValue when it is not set. Setting it empty yields an empty list.
+func getListEnvDefault(key string, defaultValue []string) []string {
+	if _, ok := os.LookupEnv(key); !ok {
+		return defaultValue
+	}
+	return getListEnv(key)
+}
@@ -0,0 +1,68 @@
+// Package consistency lets a request ask for reads that reflect every write
+// committed before it, bypassing caches that may still hold older data. The
+// frontend asks for it right after editing a link, so the edit shows at once.
+//
+// A request asks with "Cache-Control: no-cache" (or "no-store", or
+// "Pragma: no-cache") or with the query parameter consistency=strong. The
+// HTTP cache then serves it fresh, and the request's context is marked so
+// that caches in front of the repositories skip their entries too.
+package consistency
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// QueryParam is the query parameter that asks for strong consistency
+const QueryParam = "consistency"
+
+// Strong is the value of QueryParam that asks for strong consistency
+const Strong = "strong"
+
+// strongKey marks contexts whose reads must be strongly consistent
+type strongKey struct{}
+
+// WithStrong returns a context whose reads must be strongly consistent
+func WithStrong(ctx context.Context) context.Context {
+	return context.WithValue(ctx, strongKey{}, true)
+}
+
+// IsStrong reports whether reads with ctx must be strongly consistent
+func IsStrong(ctx context.Context) bool {
+	strong, _ := ctx.Value(strongKey{}).(bool)
+	return strong
+}
+
+// Inherit returns ctx, marked strong if from is. Handlers use it to carry
+// the request's choice into contexts that outlive the request.
+func Inherit(ctx, from context.Context) context.Context {
+	if IsStrong(from) && !IsStrong(ctx) {
+		return WithStrong(ctx)
+	}
+	return ctx
+}
+
+// Requested reports whether a request asks for strong consistency
+func Requested(r *http.Request) bool {
+	if strings.EqualFold(r.URL.Query().Get(QueryParam), Strong) {
+		return true
+	}
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "no-store", "max-age=0":
+			return true
+		}
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Pragma")), "no-cache")
+}
+
+// NoStore reports whether a request forbids storing its response
+func NoStore(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package consistency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequested(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "Plain", target: "/api/links/docs", want: false},
+		{name: "Query", target: "/api/links/docs?consistency=strong", want: true},
+		{name: "Query case", target: "/api/links/docs?consistency=STRONG", want: true},
+		{name: "Other query", target: "/api/links/docs?consistency=eventual", want: false},
+		{name: "No-cache", target: "/api/links/docs", headers: map[string]string{"Cache-Control": "no-cache"}, want: true},
+		{name: "Among directives", target: "/", headers: map[string]string{"Cache-Control": "private, No-Store"}, want: true},
+		{name: "Max-age zero", target: "/", headers: map[string]string{"Cache-Control": "max-age=0"}, want: true},
+		{name: "Max-age", target: "/", headers: map[string]string{"Cache-Control": "max-age=60"}, want: false},
+		{name: "Pragma", target: "/", headers: map[string]string{"Pragma": "no-cache"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tt.target, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, Requested(req))
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, IsStrong(ctx))
+
+	strong := WithStrong(ctx)
+	assert.True(t, IsStrong(strong))
+	assert.True(t, IsStrong(Inherit(context.Background(), strong)))
+	assert.False(t, IsStrong(Inherit(context.Background(), ctx)))
+}
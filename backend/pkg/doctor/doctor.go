@@ -0,0 +1,322 @@
+// Package doctor checks a deployment's configuration against the environment
+// it runs in: whether the OAuth callback is reachable, whether the session
+// cookie, CORS and frontend settings agree with the application's domain, and
+// whether Firestore has the composite indexes the server's queries need. Each
+// problem comes with the steps that fix it.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/firestoreindex"
+)
+
+// DefaultTimeout bounds each network probe
+const DefaultTimeout = 5 * time.Second
+
+// Status is the outcome of a check
+type Status string
+
+// Check outcomes. Only failures make a report unhealthy.
+const (
+	StatusOK   Status = "ok"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// Names of the checks, in the order they run
+const (
+	CheckOAuthRedirect    = "oauth_redirect_url"
+	CheckCookieDomain     = "cookie_domain"
+	CheckCORSOrigin       = "cors_origin"
+	CheckFirestoreIndexes = "firestore_indexes"
+)
+
+// Result is the outcome of one check. Remediation says how to fix anything
+// that is not ok.
+type Result struct {
+	Name        string `json:"name"`
+	Status      Status `json:"status"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Report collects the results of every check
+type Report struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+	OK        bool      `json:"ok"`
+}
+
+// Settings are the configuration values under test
+type Settings struct {
+	// AppDomain is the public host (and port) the server is reached at
+	AppDomain string
+	// AuthProvider is "google", "local" or "saml"; the OAuth callback only
+	// matters for Google
+	AuthProvider     string
+	OAuthRedirectURL string
+	// SessionDomain is the domain of the session cookie
+	SessionDomain string
+	CORSOrigin    string
+	FrontendURL   string
+	// StorageBackend is "firestore", "postgres" or "memory"; indexes only
+	// matter for Firestore
+	StorageBackend string
+}
+
+// Doctor runs the configuration checks
+type Doctor struct {
+	settings Settings
+	client   *http.Client
+	indexes  firestoreindex.Lister
+	required []firestoreindex.Index
+}
+
+// Option configures a Doctor
+type Option func(*Doctor)
+
+// WithHTTPClient probes URLs with client, e.g. one that goes through the
+// egress proxy. Redirects are never followed.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Doctor) {
+		d.client = client
+	}
+}
+
+// New creates a Doctor for the given settings
+func New(settings Settings, opts ...Option) *Doctor {
+	d := &Doctor{settings: settings}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.client == nil {
+		d.client = &http.Client{Timeout: DefaultTimeout}
+	}
+	// Copy the client so disabling redirects doesn't affect its other users
+	client := *d.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	d.client = &client
+	return d
+}
+
+// Run runs every check
+func (d *Doctor) Run(ctx context.Context) Report {
+	report := Report{
+		CheckedAt: time.Now(),
+		Checks: []Result{
+			d.checkOAuthRedirect(ctx),
+			checkCookieDomain(d.settings),
+			checkCORSOrigin(d.settings),
+			d.checkIndexes(ctx),
+		},
+		OK: true,
+	}
+	for _, result := range report.Checks {
+		if result.Status == StatusFail {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+// Write prints the report for a terminal, one check per line followed by the
+// remediation of any check that is not ok
+func (r Report) Write(w io.Writer) error {
+	for _, result := range r.Checks {
+		if _, err := fmt.Fprintf(w, "[%-4s] %s: %s\n", strings.ToUpper(string(result.Status)), result.Name, result.Message); err != nil {
+			return err
+		}
+		if result.Remediation != "" {
+			if _, err := fmt.Fprintf(w, "       fix: %s\n", result.Remediation); err != nil {
+				return err
+			}
+		}
+	}
+	summary := "All checks passed"
+	if !r.OK {
+		summary = "Some checks failed"
+	}
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
+
+// checkOAuthRedirect verifies the redirect URL is an absolute URL on the
+// application's domain and that something answers there. Any response other
+// than a 404 counts as reachable: the callback rejects a request without an
+// OAuth state, but it is served.
+func (d *Doctor) checkOAuthRedirect(ctx context.Context) Result {
+	result := Result{Name: CheckOAuthRedirect}
+	switch d.settings.AuthProvider {
+	case "local":
+		result.Status = StatusSkip
+		result.Message = "Users sign in with local accounts"
+		return result
+	case "saml":
+		result.Status = StatusSkip
+		result.Message = "Users sign in with a SAML identity provider"
+		return result
+	}
+	raw := d.settings.OAuthRedirectURL
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("OAUTH_REDIRECT_URL %q is not an absolute http(s) URL", raw)
+		result.Remediation = "Set OAUTH_REDIRECT_URL to https://<APP_DOMAIN>/api/auth/callback and register the same URL with the OAuth client"
+		return result
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("Cannot request %s: %v", raw, err)
+		return result
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("%s is unreachable: %v", raw, err)
+		result.Remediation = "Check DNS and load balancer routing for " + u.Host + ", or correct OAUTH_REDIRECT_URL"
+		return result
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("%s answered 404; the callback is not served there", raw)
+		result.Remediation = "Route /api/auth/callback to the backend, or point OAUTH_REDIRECT_URL at the backend's callback"
+		return result
+	}
+
+	appHost := hostOnly(d.settings.AppDomain)
+	switch {
+	case appHost != "" && !strings.EqualFold(u.Hostname(), appHost):
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("%s is reachable but not on APP_DOMAIN %q; the session cookie is set on the callback's host", raw, d.settings.AppDomain)
+		result.Remediation = "Serve the callback on APP_DOMAIN, or set APP_DOMAIN to " + u.Host
+	case u.Scheme != "https" && !isLocal(u.Hostname()):
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("%s is reachable but not served over HTTPS", raw)
+		result.Remediation = "Use an https:// OAUTH_REDIRECT_URL; OAuth providers reject plain HTTP callbacks outside localhost"
+	default:
+		result.Status = StatusOK
+		result.Message = fmt.Sprintf("%s is reachable (HTTP %d)", raw, resp.StatusCode)
+	}
+	return result
+}
+
+// checkCookieDomain verifies browsers will accept the session cookie on the
+// application's domain: the cookie domain must be that host or a parent of it
+func checkCookieDomain(s Settings) Result {
+	result := Result{Name: CheckCookieDomain}
+	appHost := hostOnly(s.AppDomain)
+	cookieDomain := strings.TrimPrefix(strings.ToLower(s.SessionDomain), ".")
+
+	switch {
+	case cookieDomain == "":
+		result.Status = StatusOK
+		result.Message = "The session cookie is host-only"
+	// SESSION_DOMAIN defaults to APP_DOMAIN, port included; only its host matters
+	case strings.Contains(cookieDomain, ":") && cookieDomain != strings.ToLower(s.AppDomain):
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("SESSION_DOMAIN %q contains a port; cookie domains never do", s.SessionDomain)
+		result.Remediation = "Set SESSION_DOMAIN to " + appHost
+	case hostOnly(cookieDomain) == appHost || strings.HasSuffix(appHost, "."+cookieDomain):
+		result.Status = StatusOK
+		result.Message = fmt.Sprintf("SESSION_DOMAIN %q covers APP_DOMAIN %q", s.SessionDomain, s.AppDomain)
+	default:
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("SESSION_DOMAIN %q does not cover APP_DOMAIN %q; browsers will drop the session cookie", s.SessionDomain, s.AppDomain)
+		result.Remediation = "Set SESSION_DOMAIN to " + appHost + " or one of its parent domains"
+	}
+	return result
+}
+
+// checkCORSOrigin verifies the CORS origin is a bare origin that matches the
+// frontend users are sent to after signing in
+func checkCORSOrigin(s Settings) Result {
+	result := Result{Name: CheckCORSOrigin}
+
+	if s.CORSOrigin == "*" {
+		result.Status = StatusFail
+		result.Message = "CORS_ORIGIN is \"*\", which browsers refuse for credentialed requests"
+		result.Remediation = "Set CORS_ORIGIN to the frontend's origin, such as https://go.example.com"
+		return result
+	}
+	corsOrigin, err := origin(s.CORSOrigin)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("CORS_ORIGIN %q is not an origin: %v", s.CORSOrigin, err)
+		result.Remediation = "Set CORS_ORIGIN to scheme://host[:port] without a path or trailing slash"
+		return result
+	}
+	if !strings.EqualFold(corsOrigin, s.CORSOrigin) {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("CORS_ORIGIN %q has a path or trailing slash and never matches a browser's Origin header", s.CORSOrigin)
+		result.Remediation = "Set CORS_ORIGIN to " + corsOrigin
+		return result
+	}
+
+	if s.FrontendURL == "" {
+		result.Status = StatusWarn
+		result.Message = "FRONTEND_URL is not set; users land on the backend's / after signing in"
+		result.Remediation = "Set FRONTEND_URL to the frontend's URL, such as " + corsOrigin + "/"
+		return result
+	}
+	frontendOrigin, err := origin(s.FrontendURL)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("FRONTEND_URL %q is not an absolute URL: %v", s.FrontendURL, err)
+		result.Remediation = "Set FRONTEND_URL to an absolute http(s) URL"
+		return result
+	}
+	if frontendOrigin != corsOrigin {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("FRONTEND_URL origin %q differs from CORS_ORIGIN %q; the frontend's API calls will be blocked", frontendOrigin, corsOrigin)
+		result.Remediation = "Set CORS_ORIGIN to " + frontendOrigin + ", or FRONTEND_URL to a page on " + corsOrigin
+		return result
+	}
+
+	result.Status = StatusOK
+	result.Message = fmt.Sprintf("CORS_ORIGIN matches FRONTEND_URL's origin %q", corsOrigin)
+	return result
+}
+
+// origin returns scheme://host[:port] of an absolute http(s) URL
+func origin(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("expected an absolute http or https URL")
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// hostOnly strips the port from a host
+func hostOnly(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		hostport = host
+	}
+	return strings.ToLower(hostport)
+}
+
+// isLocal reports whether host is the local machine
+func isLocal(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
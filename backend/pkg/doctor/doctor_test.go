@@ -0,0 +1,165 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/firestoreindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeIndexLister struct {
+	indexes map[string][]firestoreindex.Index
+	err     error
+}
+
+func (f fakeIndexLister) ListIndexes(ctx context.Context, collection string) ([]firestoreindex.Index, error) {
+	return f.indexes[collection], f.err
+}
+
+func TestCheckOAuthRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/auth/callback":
+			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name        string
+		redirectURL string
+		appDomain   string
+		want        Status
+	}{
+		{"Callback served", server.URL + "/api/auth/callback", host, StatusOK},
+		{"Callback not routed", server.URL + "/callback", host, StatusFail},
+		{"Unreachable", closed.URL + "/api/auth/callback", host, StatusFail},
+		{"Relative URL", "/api/auth/callback", host, StatusFail},
+		{"Other domain", server.URL + "/api/auth/callback", "go.example.com", StatusWarn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(Settings{OAuthRedirectURL: tt.redirectURL, AppDomain: tt.appDomain})
+			result := d.checkOAuthRedirect(context.Background())
+			assert.Equal(t, tt.want, result.Status, result.Message)
+			if tt.want != StatusOK {
+				assert.NotEmpty(t, result.Remediation)
+			}
+		})
+	}
+}
+
+func TestCheckCookieDomain(t *testing.T) {
+	tests := []struct {
+		name          string
+		sessionDomain string
+		appDomain     string
+		want          Status
+	}{
+		{"Default matches APP_DOMAIN", "localhost:8080", "localhost:8080", StatusOK},
+		{"Same host", "go.example.com", "go.example.com", StatusOK},
+		{"Parent domain", ".example.com", "go.example.com", StatusOK},
+		{"Host-only", "", "go.example.com", StatusOK},
+		{"Other domain", "example.org", "go.example.com", StatusFail},
+		{"Suffix without dot", "ample.com", "go.example.com", StatusFail},
+		{"Port", "go.example.com:443", "go.example.com", StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkCookieDomain(Settings{SessionDomain: tt.sessionDomain, AppDomain: tt.appDomain})
+			assert.Equal(t, tt.want, result.Status, result.Message)
+		})
+	}
+}
+
+func TestCheckCORSOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		corsOrigin  string
+		frontendURL string
+		want        Status
+	}{
+		{"Matching origin", "https://go.example.com", "https://go.example.com/links", StatusOK},
+		{"Missing frontend", "https://go.example.com", "", StatusWarn},
+		{"Different origin", "https://go.example.com", "https://links.example.com/", StatusFail},
+		{"Different port", "http://localhost:3001", "http://localhost:3000/", StatusFail},
+		{"Trailing slash", "https://go.example.com/", "https://go.example.com/", StatusFail},
+		{"Wildcard", "*", "https://go.example.com/", StatusFail},
+		{"Not a URL", "go.example.com", "https://go.example.com/", StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkCORSOrigin(Settings{CORSOrigin: tt.corsOrigin, FrontendURL: tt.frontendURL})
+			assert.Equal(t, tt.want, result.Status, result.Message)
+		})
+	}
+}
+
+func TestCheckIndexes(t *testing.T) {
+	required := firestoreindex.Index{Collection: "links", Query: "GetExpiredLinks", Fields: []firestoreindex.Field{
+		{Path: "is_expired", Order: firestoreindex.OrderAscending},
+		{Path: "expires_at", Order: firestoreindex.OrderAscending},
+	}}
+	ready := required
+	ready.State = firestoreindex.StateReady
+	building := required
+	building.State = firestoreindex.StateCreating
+
+	tests := []struct {
+		name        string
+		backend     string
+		lister      firestoreindex.Lister
+		want        Status
+		remediation string
+	}{
+		{"Index exists", "firestore", fakeIndexLister{indexes: map[string][]firestoreindex.Index{"links": {ready}}}, StatusOK, ""},
+		{"Index building", "firestore", fakeIndexLister{indexes: map[string][]firestoreindex.Index{"links": {building}}}, StatusWarn, "Wait for the indexes to finish building"},
+		{"Index missing", "firestore", fakeIndexLister{}, StatusFail, required.CreateCommand()},
+		{"Listing fails", "firestore", fakeIndexLister{err: errors.New("permission denied")}, StatusFail, "Grant the server's service account roles/datastore.indexAdmin or roles/datastore.viewer"},
+		{"No lister", "firestore", nil, StatusSkip, "Set PROJECT_ID to check the indexes"},
+		{"Memory storage", "memory", fakeIndexLister{}, StatusSkip, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(Settings{StorageBackend: tt.backend}, WithIndexLister(tt.lister), WithRequiredIndexes([]firestoreindex.Index{required}))
+			result := d.checkIndexes(context.Background())
+			assert.Equal(t, tt.want, result.Status, result.Message)
+			assert.Equal(t, tt.remediation, result.Remediation)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	d := New(Settings{
+		OAuthRedirectURL: "not a url",
+		AppDomain:        "go.example.com",
+		SessionDomain:    "go.example.com",
+		CORSOrigin:       "https://go.example.com",
+		FrontendURL:      "https://go.example.com/",
+		StorageBackend:   "memory",
+	})
+	report := d.Run(context.Background())
+	require.Len(t, report.Checks, 4)
+	assert.False(t, report.OK)
+	assert.Equal(t, CheckOAuthRedirect, report.Checks[0].Name)
+
+	var out bytes.Buffer
+	require.NoError(t, report.Write(&out))
+	assert.Contains(t, out.String(), "[FAIL] oauth_redirect_url:")
+	assert.Contains(t, out.String(), "fix: Set OAUTH_REDIRECT_URL")
+	assert.Contains(t, out.String(), "[OK  ] cors_origin:")
+	assert.Contains(t, out.String(), "Some checks failed")
+}
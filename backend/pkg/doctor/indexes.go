@@ -0,0 +1,73 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/firestoreindex"
+)
+
+// WithIndexLister checks the required Firestore indexes against the ones the
+// lister reports. Without a lister the index check is skipped.
+func WithIndexLister(lister firestoreindex.Lister) Option {
+	return func(d *Doctor) {
+		d.indexes = lister
+	}
+}
+
+// WithRequiredIndexes sets the manifest of composite indexes the server needs
+func WithRequiredIndexes(manifest []firestoreindex.Index) Option {
+	return func(d *Doctor) {
+		d.required = manifest
+	}
+}
+
+// checkIndexes reports the required indexes that are missing or still building
+func (d *Doctor) checkIndexes(ctx context.Context) Result {
+	result := Result{Name: CheckFirestoreIndexes}
+	if backend := d.settings.StorageBackend; backend != "" && backend != "firestore" {
+		result.Status = StatusSkip
+		result.Message = "Links are not stored in Firestore (STORAGE_BACKEND=" + backend + ")"
+		return result
+	}
+	if d.indexes == nil {
+		result.Status = StatusSkip
+		result.Message = "Firestore indexes cannot be listed without a project ID"
+		result.Remediation = "Set PROJECT_ID to check the indexes"
+		return result
+	}
+
+	verification, err := firestoreindex.Verify(ctx, d.indexes, d.required)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = err.Error()
+		result.Remediation = "Grant the server's service account roles/datastore.indexAdmin or roles/datastore.viewer"
+		return result
+	}
+
+	switch {
+	case len(verification.Missing) > 0:
+		names := make([]string, 0, len(verification.Missing))
+		commands := make([]string, 0, len(verification.Missing))
+		for _, index := range verification.Missing {
+			names = append(names, fmt.Sprintf("%s for %s", index, index.Query))
+			commands = append(commands, index.CreateCommand())
+		}
+		result.Status = StatusFail
+		result.Message = "Missing Firestore indexes, whose queries fail: " + strings.Join(names, "; ")
+		result.Remediation = strings.Join(commands, "; ")
+	case len(verification.Building) > 0:
+		names := make([]string, 0, len(verification.Building))
+		for _, index := range verification.Building {
+			names = append(names, index.String())
+		}
+		result.Status = StatusWarn
+		result.Message = "Firestore indexes are still building: " + strings.Join(names, ", ")
+		result.Remediation = "Wait for the indexes to finish building"
+	default:
+		result.Status = StatusOK
+		result.Message = fmt.Sprintf("All %d required Firestore indexes exist", len(d.required))
+	}
+	return result
+}
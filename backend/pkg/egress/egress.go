@@ -0,0 +1,107 @@
+// Package egress builds HTTP clients for outbound calls that honour the
+// deployment's egress proxy settings.
+//
+// By default the standard HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment
+// variables apply. An explicit proxy URL replaces them, and "off" forces
+// direct connections even when the environment names a proxy. Destinations
+// listed in NoProxy are always reached directly.
+package egress
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyOff disables proxying regardless of the environment
+const ProxyOff = "off"
+
+// Config selects the proxy used for outbound calls
+type Config struct {
+	// ProxyURL overrides the proxy environment variables when set
+	ProxyURL string
+	// NoProxy lists destinations reached directly, in addition to those in
+	// NO_PROXY: host names (matching subdomains too), ".suffix" domains,
+	// IP addresses and CIDR ranges, each with an optional ":port"
+	NoProxy []string
+}
+
+// ProxyFunc is the proxy selector used by http.Transport
+type ProxyFunc func(*http.Request) (*url.URL, error)
+
+// Proxy returns the proxy selector for the configuration, or nil when every
+// destination is reached directly
+func (c Config) Proxy() (ProxyFunc, error) {
+	var proxy httpproxy.Config
+	switch strings.ToLower(strings.TrimSpace(c.ProxyURL)) {
+	case "":
+		proxy = *httpproxy.FromEnvironment()
+	case ProxyOff:
+		return nil, nil
+	default:
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", c.ProxyURL)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		proxy = httpproxy.Config{
+			HTTPProxy:  c.ProxyURL,
+			HTTPSProxy: c.ProxyURL,
+			NoProxy:    httpproxy.FromEnvironment().NoProxy,
+		}
+	}
+
+	if proxy.HTTPProxy == "" && proxy.HTTPSProxy == "" {
+		return nil, nil
+	}
+
+	noProxy := append(splitNoProxy(proxy.NoProxy), c.NoProxy...)
+	proxy.NoProxy = strings.Join(noProxy, ",")
+
+	forURL := proxy.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return forURL(req.URL)
+	}, nil
+}
+
+// NewTransport returns a transport with the default dial, TLS and pooling
+// settings that sends requests through the configured proxy
+func NewTransport(cfg Config) (*http.Transport, error) {
+	proxy, err := cfg.Proxy()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	return transport, nil
+}
+
+// NewClient returns an HTTP client for calls to trusted services, such as the
+// OAuth provider, that honours the proxy configuration. Fetches of
+// user-supplied URLs must use safehttp instead.
+func NewClient(cfg Config, timeout time.Duration) (*http.Client, error) {
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// splitNoProxy splits a comma-separated NO_PROXY value, dropping empty entries
+func splitNoProxy(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,121 @@
+package egress
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		config    Config
+		target    string
+		wantProxy string
+		wantErr   bool
+	}{
+		{
+			name:   "No proxy configured",
+			target: "https://accounts.example.com/token",
+		},
+		{
+			name:      "Proxy from environment",
+			env:       map[string]string{"HTTPS_PROXY": "http://env-proxy:3128"},
+			target:    "https://accounts.example.com/token",
+			wantProxy: "http://env-proxy:3128",
+		},
+		{
+			name:   "NO_PROXY from environment",
+			env:    map[string]string{"HTTPS_PROXY": "http://env-proxy:3128", "NO_PROXY": "example.com"},
+			target: "https://accounts.example.com/token",
+		},
+		{
+			name:      "Explicit proxy overrides environment",
+			env:       map[string]string{"HTTPS_PROXY": "http://env-proxy:3128"},
+			config:    Config{ProxyURL: "http://egress.corp:8080"},
+			target:    "https://accounts.example.com/token",
+			wantProxy: "http://egress.corp:8080",
+		},
+		{
+			name:      "Explicit proxy applies to plain HTTP",
+			config:    Config{ProxyURL: "http://egress.corp:8080"},
+			target:    "http://example.org/",
+			wantProxy: "http://egress.corp:8080",
+		},
+		{
+			name:   "Proxy turned off",
+			env:    map[string]string{"HTTPS_PROXY": "http://env-proxy:3128"},
+			config: Config{ProxyURL: "off"},
+			target: "https://accounts.example.com/token",
+		},
+		{
+			name:   "Per-destination exception",
+			config: Config{ProxyURL: "http://egress.corp:8080", NoProxy: []string{".corp.example", "10.0.0.0/8"}},
+			target: "https://wiki.corp.example/page",
+		},
+		{
+			name:   "CIDR exception",
+			config: Config{ProxyURL: "http://egress.corp:8080", NoProxy: []string{"10.0.0.0/8"}},
+			target: "http://10.1.2.3/",
+		},
+		{
+			name:      "Exception does not match other hosts",
+			config:    Config{ProxyURL: "http://egress.corp:8080", NoProxy: []string{".corp.example"}},
+			target:    "https://example.org/",
+			wantProxy: "http://egress.corp:8080",
+		},
+		{
+			name:      "Config exceptions add to NO_PROXY",
+			env:       map[string]string{"HTTPS_PROXY": "http://env-proxy:3128", "NO_PROXY": "example.com"},
+			config:    Config{NoProxy: []string{"example.net"}},
+			target:    "https://example.org/",
+			wantProxy: "http://env-proxy:3128",
+		},
+		{
+			name:    "Invalid proxy URL",
+			config:  Config{ProxyURL: "egress.corp:8080"},
+			wantErr: true,
+		},
+		{
+			name:    "Unsupported scheme",
+			config:  Config{ProxyURL: "ftp://egress.corp"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "NO_PROXY", "no_proxy", "REQUEST_METHOD"} {
+				t.Setenv(key, "")
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			proxy, err := tt.config.Proxy()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantProxy == "" && proxy == nil {
+				return
+			}
+			require.NotNil(t, proxy)
+
+			req, err := http.NewRequest(http.MethodGet, tt.target, nil)
+			require.NoError(t, err)
+			proxyURL, err := proxy(req)
+			require.NoError(t, err)
+			if tt.wantProxy == "" {
+				assert.Nil(t, proxyURL)
+				return
+			}
+			require.NotNil(t, proxyURL)
+			assert.Equal(t, tt.wantProxy, proxyURL.String())
+		})
+	}
+}
@@ -13,6 +13,7 @@ var (
 	ErrForbidden      = errors.New("forbidden")
 	ErrInternalServer = errors.New("internal server error")
 	ErrAlreadyExists  = errors.New("already exists")
+	ErrGone           = errors.New("gone")
 )
 
 // Error is a custom error type with status code
@@ -86,6 +87,15 @@ func NewAlreadyExists(message string) *Error {
 	}
 }
 
+// NewGone creates an error for a resource that existed but is no longer available
+func NewGone(message string) *Error {
+	return &Error{
+		Code:    410,
+		Message: message,
+		Err:     ErrGone,
+	}
+}
+
 // Wrap wraps an error with additional message
 func Wrap(err error, message string) error {
 	if err == nil {
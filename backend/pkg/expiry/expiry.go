@@ -0,0 +1,271 @@
+// Package expiry sweeps expired links in the background of the server.
+//
+// Links past their expiry are otherwise only flagged expired when someone
+// follows them, and moved to the trash by cmd/cleanup. A Sweeper flags
+// every link past its expiry, and optionally moves the links expired for
+// long enough to the trash, where cmd/cleanup purges them. With a lease,
+// only the server holding it sweeps, so several servers do not repeat the
+// same writes.
+package expiry
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+)
+
+// DefaultInterval is how often expired links are swept by default
+const DefaultInterval = 15 * time.Minute
+
+// DefaultJitter is the most a sweep is delayed at random by default
+const DefaultJitter = time.Minute
+
+// jobName names the sweeper in the background job metrics and its lease
+const jobName = "expiry-sweeper"
+
+var log = logger.For("expiry")
+
+var (
+	markedLinks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "golink_expiry_links_marked_total",
+		Help: "Total number of links flagged expired by the expiry sweeper",
+	})
+	trashedLinks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "golink_expiry_links_trashed_total",
+		Help: "Total number of expired links moved to the trash by the expiry sweeper",
+	})
+	sweeps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "golink_expiry_sweeps_total",
+		Help: "Total number of expiry sweeps, by result: swept, skipped while another server holds the lease, or failed",
+	}, []string{"result"})
+)
+
+// Store lists expired links, flags them and moves them to the trash
+type Store interface {
+	GetExpiredLinks(ctx context.Context) ([]*models.Link, error)
+	GetLinksByExpiryStatus(ctx context.Context, isExpired bool) ([]*models.Link, error)
+	Update(ctx context.Context, link *models.Link) error
+	Delete(ctx context.Context, short string) error
+}
+
+// Result counts what one sweep changed
+type Result struct {
+	Marked  int
+	Trashed int
+	// Skipped is set when another server held the lease
+	Skipped bool
+}
+
+// Option configures a Sweeper
+type Option func(*Sweeper)
+
+// WithInterval sets how often the sweeper runs in the background
+func WithInterval(interval time.Duration) Option {
+	return func(s *Sweeper) {
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+// WithJitter delays each background sweep by a random duration up to
+// jitter, so servers started together do not contend for the lease at once
+func WithJitter(jitter time.Duration) Option {
+	return func(s *Sweeper) {
+		s.jitter = max(jitter, 0)
+	}
+}
+
+// WithTrashAfter moves links expired longer than after to the trash. Zero,
+// the default, only flags them.
+func WithTrashAfter(after time.Duration) Option {
+	return func(s *Sweeper) {
+		s.trashAfter = max(after, 0)
+	}
+}
+
+// WithLease sweeps only while holder holds the sweeper's lease in leases.
+// The lease outlasts two sweeps, so the server holding it keeps it while
+// it runs, and another takes over once it stops.
+func WithLease(leases interfaces.LeaseStore, holder string) Option {
+	return func(s *Sweeper) {
+		s.leases = leases
+		s.holder = holder
+	}
+}
+
+// Sweeper flags expired links and moves old ones to the trash
+type Sweeper struct {
+	store      Store
+	leases     interfaces.LeaseStore
+	now        func() time.Time
+	cancel     context.CancelFunc
+	done       chan struct{}
+	holder     string
+	interval   time.Duration
+	jitter     time.Duration
+	trashAfter time.Duration
+}
+
+// NewSweeper creates a sweeper of the links of store
+func NewSweeper(store Store, opts ...Option) *Sweeper {
+	s := &Sweeper{
+		store:    store,
+		now:      time.Now,
+		interval: DefaultInterval,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Sweep flags the links past their expiry and, with WithTrashAfter, moves
+// those expired long enough to the trash. A link that fails is logged and
+// skipped, so one bad link does not hold back the others.
+func (s *Sweeper) Sweep(ctx context.Context) (Result, error) {
+	var result Result
+	if s.leases != nil {
+		acquired, err := s.leases.Acquire(ctx, jobName, s.holder, 2*(s.interval+s.jitter))
+		if err != nil {
+			return result, err
+		}
+		if !acquired {
+			result.Skipped = true
+			return result, nil
+		}
+	}
+
+	expired, err := s.store.GetExpiredLinks(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, link := range expired {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		link.IsExpired = true
+		if err := s.store.Update(ctx, link); err != nil {
+			if !errors.Is(err, errors.ErrNotFound) {
+				log.Error("Failed to mark link as expired", err, logger.Fields{"short": link.Short})
+			}
+			continue
+		}
+		result.Marked++
+		markedLinks.Inc()
+	}
+
+	if s.trashAfter > 0 {
+		trashed, err := s.trash(ctx, s.now().Add(-s.trashAfter))
+		result.Trashed = trashed
+		if err != nil {
+			return result, err
+		}
+	}
+
+	log.Info("Swept expired links", logger.Fields{
+		"marked":  result.Marked,
+		"trashed": result.Trashed,
+	})
+	return result, nil
+}
+
+// trash moves the links flagged expired before cutoff to the trash and
+// returns how many it moved
+func (s *Sweeper) trash(ctx context.Context, cutoff time.Time) (int, error) {
+	links, err := s.store.GetLinksByExpiryStatus(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+	trashed := 0
+	for _, link := range links {
+		if ctx.Err() != nil {
+			return trashed, ctx.Err()
+		}
+		if link.ExpiresAt.IsZero() || link.ExpiresAt.After(cutoff) {
+			continue
+		}
+		if err := s.store.Delete(ctx, link.Short); err != nil {
+			if !errors.Is(err, errors.ErrNotFound) {
+				log.Error("Failed to move expired link to trash", err, logger.Fields{"short": link.Short})
+			}
+			continue
+		}
+		trashed++
+		trashedLinks.Inc()
+		log.Info("Moved expired link to trash", logger.Fields{
+			"short":     link.Short,
+			"expiredAt": link.ExpiresAt,
+		})
+	}
+	return trashed, nil
+}
+
+// Start sweeps in the background until Stop. The first sweep runs right
+// away.
+func (s *Sweeper) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.run(ctx)
+	return nil
+}
+
+// Stop ends the background sweeps, waiting for the current one to finish
+func (s *Sweeper) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run sweeps once per interval, plus up to the jitter
+func (s *Sweeper) run(ctx context.Context) {
+	defer close(s.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		result, err := s.Sweep(ctx)
+		if ctx.Err() == nil {
+			jobs.Record(jobName, err)
+			switch {
+			case err != nil:
+				sweeps.WithLabelValues("failed").Inc()
+				log.Error("Failed to sweep expired links", err, logger.Fields{"job": jobName})
+			case result.Skipped:
+				sweeps.WithLabelValues("skipped").Inc()
+			default:
+				sweeps.WithLabelValues("swept").Inc()
+			}
+		}
+		timer.Reset(s.next())
+	}
+}
+
+// next returns how long to wait for the next sweep
+func (s *Sweeper) next() time.Duration {
+	if s.jitter <= 0 {
+		return s.interval
+	}
+	return s.interval + rand.N(s.jitter)
+}
@@ -0,0 +1,93 @@
+package expiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+)
+
+// fakeLeases grants every lease to one holder
+type fakeLeases struct {
+	holder string
+}
+
+func (f fakeLeases) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	return holder == f.holder, nil
+}
+
+// newStore returns a store of links expiring at the given times, keyed by
+// short code; the zero time never expires
+func newStore(t *testing.T, expiries map[string]time.Time) *repositories.MemoryLinkRepository {
+	t.Helper()
+	store := repositories.NewMemoryLinkRepository()
+	for short, expiresAt := range expiries {
+		link := models.NewLink(short, "https://example.com", "user1")
+		link.ExpiresAt = expiresAt
+		require.NoError(t, store.Create(context.Background(), link))
+	}
+	return store
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Now()
+	store := newStore(t, map[string]time.Time{
+		"live":    {},
+		"future":  now.Add(time.Hour),
+		"recent":  now.Add(-time.Hour),
+		"stale":   now.Add(-48 * time.Hour),
+		"ancient": now.Add(-30 * 24 * time.Hour),
+	})
+	ctx := context.Background()
+
+	result, err := NewSweeper(store).Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Marked: 3}, result)
+	expired, err := store.GetLinksByExpiryStatus(ctx, true)
+	require.NoError(t, err)
+	assert.Len(t, expired, 3)
+
+	result, err = NewSweeper(store).Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{}, result, "flagged links are not flagged again")
+
+	result, err = NewSweeper(store, WithTrashAfter(24*time.Hour)).Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Trashed: 2}, result)
+	trash, err := store.GetDeleted(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"stale", "ancient"}, []string{trash[0].Short, trash[1].Short})
+	_, err = store.GetByShort(ctx, "recent")
+	assert.NoError(t, err, "expired too recently to trash")
+}
+
+func TestSweepHoldsLease(t *testing.T) {
+	store := newStore(t, map[string]time.Time{"old": time.Now().Add(-time.Hour)})
+	leases := fakeLeases{holder: "server-a"}
+	ctx := context.Background()
+
+	result, err := NewSweeper(store, WithLease(leases, "server-b")).Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Skipped: true}, result)
+
+	result, err = NewSweeper(store, WithLease(leases, "server-a")).Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Marked: 1}, result)
+}
+
+func TestSweeperStartStop(t *testing.T) {
+	store := newStore(t, map[string]time.Time{"old": time.Now().Add(-time.Hour)})
+	sweeper := NewSweeper(store, WithInterval(time.Hour), WithJitter(time.Minute))
+	require.NoError(t, sweeper.Start(context.Background()))
+
+	assert.Eventually(t, func() bool {
+		expired, err := store.GetLinksByExpiryStatus(context.Background(), true)
+		return err == nil && len(expired) == 1
+	}, time.Second, 10*time.Millisecond, "the first sweep runs right away")
+	require.NoError(t, sweeper.Stop(context.Background()))
+}
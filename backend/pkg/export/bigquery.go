@@ -0,0 +1,191 @@
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// DefaultBigQueryBatchSize is the most rows streamed in one insert, the
+// size BigQuery recommends
+const DefaultBigQueryBatchSize = 500
+
+// BigQueryConfig selects the table click events are streamed to
+type BigQueryConfig struct {
+	ProjectID string
+	Dataset   string
+	Table     string
+	// BatchSize is the most rows streamed in one insert; zero selects
+	// DefaultBigQueryBatchSize
+	BatchSize int
+}
+
+// BigQuery streams click events into a BigQuery table, one row per event.
+// The table is created with BigQuerySchema by EnsureTable, partitioned by
+// the day of the click.
+type BigQuery struct {
+	service *bigquery.Service
+	cfg     BigQueryConfig
+}
+
+// NewBigQuery creates an exporter to the table of cfg. Without client
+// options it authenticates with the application default credentials.
+func NewBigQuery(ctx context.Context, cfg BigQueryConfig, opts ...option.ClientOption) (*BigQuery, error) {
+	if cfg.ProjectID == "" || cfg.Dataset == "" || cfg.Table == "" {
+		return nil, errors.New("a BigQuery project, dataset and table are required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBigQueryBatchSize
+	}
+	service, err := bigquery.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BigQuery client: %w", err)
+	}
+	return &BigQuery{service: service, cfg: cfg}, nil
+}
+
+// BigQuerySchema returns the columns of the click event table
+func BigQuerySchema() *bigquery.TableSchema {
+	field := func(name, fieldType, description string) *bigquery.TableFieldSchema {
+		return &bigquery.TableFieldSchema{Name: name, Type: fieldType, Mode: "NULLABLE", Description: description}
+	}
+	return &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "time", Type: "TIMESTAMP", Mode: "REQUIRED", Description: "When the link was followed"},
+		{Name: "short", Type: "STRING", Mode: "REQUIRED", Description: "Short code of the link"},
+		field("user_id", "STRING", "Salted hash of the user; the salt rotates"),
+		field("ip_hash", "STRING", "Salted hash of the client address"),
+		field("ip_address", "STRING", "Client address truncated to a network prefix"),
+		field("user_agent", "STRING", "Client user agent"),
+		field("referrer", "STRING", "Origin of the referring page"),
+		field("country", "STRING", "ISO country code of the client"),
+		field("region", "STRING", "Region of the client, at the configured precision"),
+		field("city", "STRING", "City of the client, at the configured precision"),
+		field("latitude", "FLOAT", "Latitude of the client, at the configured precision"),
+		field("longitude", "FLOAT", "Longitude of the client, at the configured precision"),
+		field("served_region", "STRING", "Deployment region the click was served for"),
+	}}
+}
+
+// EnsureTable creates the table with BigQuerySchema unless it exists. The
+// dataset must exist.
+func (b *BigQuery) EnsureTable(ctx context.Context) error {
+	_, err := b.service.Tables.Get(b.cfg.ProjectID, b.cfg.Dataset, b.cfg.Table).Context(ctx).Do()
+	if err == nil {
+		return nil
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+		return fmt.Errorf("failed to get BigQuery table: %w", err)
+	}
+
+	_, err = b.service.Tables.Insert(b.cfg.ProjectID, b.cfg.Dataset, &bigquery.Table{
+		TableReference: &bigquery.TableReference{
+			ProjectId: b.cfg.ProjectID,
+			DatasetId: b.cfg.Dataset,
+			TableId:   b.cfg.Table,
+		},
+		Schema:           BigQuerySchema(),
+		TimePartitioning: &bigquery.TimePartitioning{Type: "DAY", Field: "time"},
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to create BigQuery table: %w", err)
+	}
+	log.Info("BigQuery click event table created", logger.Fields{
+		"dataset": b.cfg.Dataset,
+		"table":   b.cfg.Table,
+	})
+	return nil
+}
+
+// Send streams the events in batches. Rows BigQuery rejects are counted and
+// reported in the error; the others are kept.
+func (b *BigQuery) Send(ctx context.Context, events []models.ClickEvent) error {
+	for start := 0; start < len(events); start += b.cfg.BatchSize {
+		batch := events[start:min(start+b.cfg.BatchSize, len(events))]
+		if err := b.insert(ctx, batch); err != nil {
+			EventsExportFailedTotal.WithLabelValues(ExporterBigQuery).Add(float64(len(events) - start))
+			return err
+		}
+	}
+	return nil
+}
+
+// insert streams one batch
+func (b *BigQuery) insert(ctx context.Context, events []models.ClickEvent) error {
+	rows := make([]*bigquery.TableDataInsertAllRequestRows, 0, len(events))
+	for _, event := range events {
+		rows = append(rows, &bigquery.TableDataInsertAllRequestRows{
+			InsertId: insertID(event),
+			Json:     bigQueryRow(event),
+		})
+	}
+
+	response, err := b.service.Tabledata.InsertAll(b.cfg.ProjectID, b.cfg.Dataset, b.cfg.Table,
+		&bigquery.TableDataInsertAllRequest{Rows: rows, SkipInvalidRows: true}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to stream click events to BigQuery: %w", err)
+	}
+	if rejected := len(response.InsertErrors); rejected > 0 {
+		EventsExportedTotal.WithLabelValues(ExporterBigQuery).Add(float64(len(events) - rejected))
+		EventsExportFailedTotal.WithLabelValues(ExporterBigQuery).Add(float64(rejected))
+		reason := "unknown"
+		if first := response.InsertErrors[0]; len(first.Errors) > 0 {
+			reason = first.Errors[0].Message
+		}
+		// The rest of the batch was kept, so the caller must not resend it
+		log.Warn("BigQuery rejected click events", logger.Fields{
+			"rejected": rejected,
+			"events":   len(events),
+			"reason":   reason,
+		})
+		return nil
+	}
+	EventsExportedTotal.WithLabelValues(ExporterBigQuery).Add(float64(len(events)))
+	return nil
+}
+
+// bigQueryRow returns the columns of an event, leaving out empty ones
+func bigQueryRow(event models.ClickEvent) map[string]bigquery.JsonValue {
+	row := map[string]bigquery.JsonValue{
+		"time":  event.Time.UTC().Format(time.RFC3339Nano),
+		"short": event.Short,
+	}
+	for column, value := range map[string]string{
+		"user_id":       event.UserID,
+		"ip_hash":       event.IPHash,
+		"ip_address":    event.IPAddress,
+		"user_agent":    event.UserAgent,
+		"referrer":      event.Referrer,
+		"country":       event.Country,
+		"region":        event.Region,
+		"city":          event.City,
+		"served_region": event.ServedRegion,
+	} {
+		if value != "" {
+			row[column] = value
+		}
+	}
+	if event.Latitude != 0 || event.Longitude != 0 {
+		row["latitude"] = event.Latitude
+		row["longitude"] = event.Longitude
+	}
+	return row
+}
+
+// insertID identifies an event so BigQuery drops it when a batch is retried
+func insertID(event models.ClickEvent) string {
+	sum := sha256.Sum256([]byte(event.Short + "\x00" + strconv.FormatInt(event.Time.UnixNano(), 10) +
+		"\x00" + event.IPHash + "\x00" + event.UserID + "\x00" + event.UserAgent))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,115 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+)
+
+// fakeBigQuery serves the BigQuery endpoints the exporter calls
+type fakeBigQuery struct {
+	tables  map[string]*bigquery.Table
+	inserts []bigquery.TableDataInsertAllRequest
+	// reject makes every insert reject its first row
+	reject bool
+}
+
+func (f *fakeBigQuery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/bigquery/v2")
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/insertAll"):
+		var request bigquery.TableDataInsertAllRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		f.inserts = append(f.inserts, request)
+		response := bigquery.TableDataInsertAllResponse{}
+		if f.reject {
+			response.InsertErrors = []*bigquery.TableDataInsertAllResponseInsertErrors{
+				{Index: 0, Errors: []*bigquery.ErrorProto{{Message: "no such field"}}},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/tables"):
+		var table bigquery.Table
+		_ = json.NewDecoder(r.Body).Decode(&table)
+		f.tables[table.TableReference.TableId] = &table
+		_ = json.NewEncoder(w).Encode(table)
+	case r.Method == http.MethodGet:
+		table, ok := f.tables[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"message":"Not found"}}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(table)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestBigQuery(t *testing.T, fake *fakeBigQuery, batchSize int) *BigQuery {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	exporter, err := NewBigQuery(context.Background(), BigQueryConfig{
+		ProjectID: "project",
+		Dataset:   "golink",
+		Table:     "click_events",
+		BatchSize: batchSize,
+	}, option.WithEndpoint(server.URL+"/bigquery/v2/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	return exporter
+}
+
+func TestBigQuery(t *testing.T) {
+	fake := &fakeBigQuery{tables: map[string]*bigquery.Table{}}
+	exporter := newTestBigQuery(t, fake, 2)
+	ctx := context.Background()
+
+	// The table is created once, partitioned by the click's day
+	require.NoError(t, exporter.EnsureTable(ctx))
+	require.Contains(t, fake.tables, "click_events")
+	assert.Equal(t, "time", fake.tables["click_events"].TimePartitioning.Field)
+	require.NoError(t, exporter.EnsureTable(ctx))
+
+	clickedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []models.ClickEvent{
+		{Time: clickedAt, Short: "docs", UserID: "anon-1", Country: "JP"},
+		{Time: clickedAt.Add(time.Second), Short: "docs"},
+		{Time: clickedAt.Add(2 * time.Second), Short: "wiki", Latitude: 35.6, Longitude: 139.7},
+	}
+	require.NoError(t, exporter.Send(ctx, events))
+
+	// Events are streamed in batches, without empty columns
+	require.Len(t, fake.inserts, 2)
+	assert.Len(t, fake.inserts[0].Rows, 2)
+	assert.Len(t, fake.inserts[1].Rows, 1)
+	first := fake.inserts[0].Rows[0]
+	assert.Equal(t, "2025-03-01T12:00:00Z", first.Json["time"])
+	assert.Equal(t, "anon-1", first.Json["user_id"])
+	assert.Equal(t, "JP", first.Json["country"])
+	assert.NotContains(t, first.Json, "referrer")
+	assert.Equal(t, 35.6, fake.inserts[1].Rows[0].Json["latitude"])
+
+	// A retried event keeps its insert ID, so BigQuery drops the duplicate
+	assert.Equal(t, insertID(events[0]), first.InsertId)
+	assert.NotEqual(t, first.InsertId, fake.inserts[0].Rows[1].InsertId)
+
+	// Rejected rows do not fail the batch the others were kept from
+	fake.reject = true
+	assert.NoError(t, exporter.Send(ctx, events[:1]))
+}
+
+func TestNewBigQueryRequiresTable(t *testing.T) {
+	_, err := NewBigQuery(context.Background(), BigQueryConfig{ProjectID: "project", Dataset: "golink"},
+		option.WithoutAuthentication())
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+// Package export streams click events to external analytics systems, such as
+// a BigQuery table analysts join with the rest of the warehouse.
+//
+// Exporters receive the batches of the click stream recorder. They must only
+// be handed events through privacy.Anonymizer.Wrap, so no raw identifier
+// leaves the service.
+package export
+
+import (
+	"context"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Exporters that can be configured
+const (
+	ExporterNone     = "none"
+	ExporterBigQuery = "bigquery"
+)
+
+var (
+	// EventsExportedTotal counts the click events accepted by an exporter
+	EventsExportedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_click_events_exported_total",
+			Help: "Total number of click events accepted by an exporter",
+		},
+		[]string{"exporter"},
+	)
+
+	// EventsExportFailedTotal counts the click events an exporter rejected
+	EventsExportFailedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_click_events_export_failed_total",
+			Help: "Total number of click events an exporter failed to export",
+		},
+		[]string{"exporter"},
+	)
+)
+
+var log = logger.For("export")
+
+// Exporter sends batches of anonymized click events to an external system.
+// It satisfies privacy.Sink, so it plugs into the click stream recorder.
+type Exporter interface {
+	Send(ctx context.Context, events []models.ClickEvent) error
+}
+
+// Nop is the exporter used when none is configured; it discards every batch
+type Nop struct{}
+
+// Send discards the events
+func (Nop) Send(context.Context, []models.ClickEvent) error {
+	return nil
+}
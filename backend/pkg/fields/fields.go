@@ -0,0 +1,124 @@
+// Package fields implements sparse responses: a client names the JSON fields
+// it needs, as in ?fields=short,url,click_count, and every other field is left
+// out of the objects in the response. Projection happens on the encoded
+// response, after access checks, which need whole documents from the store.
+package fields
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Selection is a set of JSON field names. The nil Selection selects every field.
+type Selection map[string]bool
+
+// Parse parses a comma-separated field list, rejecting fields not in allowed.
+// An empty list selects every field.
+func Parse(spec string, allowed []string) (Selection, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		known[name] = true
+	}
+
+	selection := Selection{}
+	var unknown []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !known[name] {
+			unknown = append(unknown, name)
+			continue
+		}
+		selection[name] = true
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown fields %s; available fields are %s",
+			strings.Join(unknown, ", "), strings.Join(allowed, ", "))
+	}
+	if len(selection) == 0 {
+		return nil, nil
+	}
+	return selection, nil
+}
+
+// Names returns the JSON field names of a struct value, including those of
+// embedded structs, sorted
+func Names(v interface{}) []string {
+	var names []string
+	collectNames(reflect.TypeOf(v), &names)
+	sort.Strings(names)
+	return names
+}
+
+// collectNames appends the JSON field names of struct type t
+func collectNames(t reflect.Type, names *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			collectNames(field.Type, names)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		*names = append(*names, name)
+	}
+}
+
+// Apply returns v with only the selected fields of each object. v is an
+// object or a list of objects; anything else is returned unchanged.
+func (s Selection) Apply(v interface{}) (interface{}, error) {
+	if s == nil {
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err == nil {
+		projected := make([]interface{}, 0, len(list))
+		for _, item := range list {
+			projected = append(projected, s.project(item))
+		}
+		return projected, nil
+	}
+	return s.project(data), nil
+}
+
+// project keeps the selected fields of a JSON object. Values that are not
+// objects are kept as they are.
+func (s Selection) project(data json.RawMessage) interface{} {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return data
+	}
+	for name := range object {
+		if !s[name] {
+			delete(object, name)
+		}
+	}
+	return object
+}
@@ -0,0 +1,62 @@
+package fields
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	Short  string `json:"short"`
+	URL    string `json:"url"`
+	Secret string `json:"-"`
+	Count  int    `json:"count,omitempty"`
+}
+
+type wrapped struct {
+	item
+	Extra string `json:"extra"`
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, []string{"count", "short", "url"}, Names(item{}))
+	assert.Equal(t, []string{"count", "extra", "short", "url"}, Names(&wrapped{}))
+}
+
+func TestParse(t *testing.T) {
+	allowed := []string{"count", "short", "url"}
+
+	selection, err := Parse("", allowed)
+	require.NoError(t, err)
+	assert.Nil(t, selection)
+
+	selection, err = Parse(" short, url ,", allowed)
+	require.NoError(t, err)
+	assert.Equal(t, Selection{"short": true, "url": true}, selection)
+
+	_, err = Parse("short,password", allowed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "password")
+}
+
+func TestApply(t *testing.T) {
+	items := []item{{Short: "docs", URL: "https://docs.example.com", Count: 2}, {Short: "wiki", URL: "https://wiki.example.com"}}
+
+	all, err := Selection(nil).Apply(items)
+	require.NoError(t, err)
+	assert.Equal(t, items, all)
+
+	projected, err := Selection{"short": true, "count": true}.Apply(items)
+	require.NoError(t, err)
+	data, err := json.Marshal(projected)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"short": "docs", "count": 2}, {"short": "wiki"}]`, string(data))
+
+	projected, err = Selection{"url": true}.Apply(&items[0])
+	require.NoError(t, err)
+	data, err = json.Marshal(projected)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"url": "https://docs.example.com"}`, string(data))
+}
@@ -0,0 +1,52 @@
+package firestoreindex
+
+import (
+	"context"
+	"fmt"
+
+	firestoreadmin "google.golang.org/api/firestore/v1"
+	"google.golang.org/api/option"
+)
+
+// AdminLister lists indexes with the Firestore admin API. The caller needs
+// roles/datastore.indexAdmin or roles/datastore.viewer.
+type AdminLister struct {
+	service   *firestoreadmin.Service
+	projectID string
+	database  string
+}
+
+// NewAdminLister creates a lister for the default database of a project
+func NewAdminLister(ctx context.Context, projectID string, opts ...option.ClientOption) (*AdminLister, error) {
+	service, err := firestoreadmin.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firestore admin client: %w", err)
+	}
+	return &AdminLister{
+		service:   service,
+		projectID: projectID,
+		database:  "(default)",
+	}, nil
+}
+
+// ListIndexes lists the composite indexes of a collection
+func (l *AdminLister) ListIndexes(ctx context.Context, collection string) ([]Index, error) {
+	parent := fmt.Sprintf("projects/%s/databases/%s/collectionGroups/%s", l.projectID, l.database, collection)
+	var indexes []Index
+	err := l.service.Projects.Databases.CollectionGroups.Indexes.List(parent).Pages(ctx,
+		func(resp *firestoreadmin.GoogleFirestoreAdminV1ListIndexesResponse) error {
+			for _, index := range resp.Indexes {
+				converted := Index{Collection: collection, State: index.State}
+				for _, field := range index.Fields {
+					converted.Fields = append(converted.Fields, Field{
+						Path:        field.FieldPath,
+						Order:       field.Order,
+						ArrayConfig: field.ArrayConfig,
+					})
+				}
+				indexes = append(indexes, converted)
+			}
+			return nil
+		})
+	return indexes, err
+}
@@ -0,0 +1,220 @@
+// Package firestoreindex describes the composite indexes Firestore queries
+// need and verifies that a database has them. Firestore only reports a
+// missing composite index when a query runs, so the indexes are declared in a
+// manifest next to the queries and checked at startup and by the doctor.
+package firestoreindex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Field orders, as named by the Firestore admin API
+const (
+	OrderAscending  = "ASCENDING"
+	OrderDescending = "DESCENDING"
+)
+
+// ArrayContains is the array config of a field serving array-contains filters
+const ArrayContains = "CONTAINS"
+
+// Index states reported by the Firestore admin API
+const (
+	StateReady    = "READY"
+	StateCreating = "CREATING"
+)
+
+// Field is one field of a composite index, either ordered or, for
+// array-contains filters, with ArrayConfig set
+type Field struct {
+	Path        string `json:"path"`
+	Order       string `json:"order,omitempty"`
+	ArrayConfig string `json:"array_config,omitempty"`
+}
+
+// mode returns how the field is indexed, its order or array config
+func (f Field) mode() string {
+	if f.ArrayConfig != "" {
+		return f.ArrayConfig
+	}
+	return f.Order
+}
+
+// Index is a composite index on a collection. Query names what needs it in
+// the manifest; State is only set on indexes read from a database.
+type Index struct {
+	Collection string  `json:"collection"`
+	Query      string  `json:"query,omitempty"`
+	State      string  `json:"state,omitempty"`
+	Fields     []Field `json:"fields"`
+}
+
+// String describes the index, such as "links(is_expired ASCENDING, expires_at ASCENDING)"
+func (i Index) String() string {
+	fields := make([]string, 0, len(i.Fields))
+	for _, field := range i.Fields {
+		fields = append(fields, field.Path+" "+field.mode())
+	}
+	return i.Collection + "(" + strings.Join(fields, ", ") + ")"
+}
+
+// CreateCommand returns the gcloud command that creates the index
+func (i Index) CreateCommand() string {
+	var b strings.Builder
+	b.WriteString("gcloud firestore indexes composite create --collection-group=" + i.Collection)
+	for _, field := range i.Fields {
+		b.WriteString(" --field-config=field-path=" + field.Path)
+		if field.ArrayConfig != "" {
+			b.WriteString(",array-config=" + strings.ToLower(field.ArrayConfig))
+		} else {
+			b.WriteString(",order=" + strings.ToLower(field.Order))
+		}
+	}
+	return b.String()
+}
+
+// firebaseIndexes is the format of firestore.indexes.json, which the
+// Firebase CLI deploys with "firebase deploy --only firestore:indexes"
+type firebaseIndexes struct {
+	Indexes        []firebaseIndex `json:"indexes"`
+	FieldOverrides []any           `json:"fieldOverrides"`
+}
+
+type firebaseIndex struct {
+	CollectionGroup string          `json:"collectionGroup"`
+	QueryScope      string          `json:"queryScope"`
+	Fields          []firebaseField `json:"fields"`
+}
+
+type firebaseField struct {
+	FieldPath   string `json:"fieldPath"`
+	Order       string `json:"order,omitempty"`
+	ArrayConfig string `json:"arrayConfig,omitempty"`
+}
+
+// FirebaseJSON returns the manifest in the format of firestore.indexes.json
+func FirebaseJSON(manifest []Index) ([]byte, error) {
+	file := firebaseIndexes{Indexes: []firebaseIndex{}, FieldOverrides: []any{}}
+	for _, index := range manifest {
+		converted := firebaseIndex{CollectionGroup: index.Collection, QueryScope: "COLLECTION"}
+		for _, field := range index.Fields {
+			converted.Fields = append(converted.Fields, firebaseField{
+				FieldPath:   field.Path,
+				Order:       field.Order,
+				ArrayConfig: field.ArrayConfig,
+			})
+		}
+		file.Indexes = append(file.Indexes, converted)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Matches reports whether other has the same collection and fields, in order.
+// Firestore appends __name__ to some indexes, which doesn't change what they serve.
+func (i Index) Matches(other Index) bool {
+	fields := other.Fields
+	if n := len(fields); n > 0 && fields[n-1].Path == "__name__" {
+		fields = fields[:n-1]
+	}
+	if i.Collection != other.Collection || len(fields) != len(i.Fields) {
+		return false
+	}
+	for j, field := range fields {
+		if field != i.Fields[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// Lister lists the composite indexes of a collection
+type Lister interface {
+	ListIndexes(ctx context.Context, collection string) ([]Index, error)
+}
+
+// Verification is the outcome of checking a manifest against a database
+type Verification struct {
+	// Missing indexes make their queries fail
+	Missing []Index
+	// Building indexes exist but cannot serve queries yet
+	Building []Index
+}
+
+// OK reports whether every required index is ready
+func (v Verification) OK() bool {
+	return len(v.Missing) == 0 && len(v.Building) == 0
+}
+
+// Verify checks that every index of the manifest exists, listing each
+// collection's indexes once
+func Verify(ctx context.Context, lister Lister, manifest []Index) (Verification, error) {
+	var result Verification
+	existing := map[string][]Index{}
+	for _, required := range manifest {
+		indexes, ok := existing[required.Collection]
+		if !ok {
+			var err error
+			indexes, err = lister.ListIndexes(ctx, required.Collection)
+			if err != nil {
+				return result, fmt.Errorf("failed to list the indexes of %q: %w", required.Collection, err)
+			}
+			existing[required.Collection] = indexes
+		}
+
+		found := find(indexes, required)
+		switch {
+		case found == nil:
+			result.Missing = append(result.Missing, required)
+		case found.State != "" && found.State != StateReady:
+			result.Building = append(result.Building, required)
+		}
+	}
+	return result, nil
+}
+
+// find returns the index among indexes that matches required
+func find(indexes []Index, required Index) *Index {
+	for i := range indexes {
+		if required.Matches(indexes[i]) {
+			return &indexes[i]
+		}
+	}
+	return nil
+}
+
+// MissingIndexError is returned by a query that failed because its composite
+// index does not exist (or is still building)
+type MissingIndexError struct {
+	Index Index
+	Err   error
+}
+
+// Error names the missing index and how to create it
+func (e *MissingIndexError) Error() string {
+	return fmt.Sprintf("query %q needs the Firestore index %s, which is missing or still building; create it with: %s",
+		e.Index.Query, e.Index, e.Index.CreateCommand())
+}
+
+// Unwrap returns the query's error
+func (e *MissingIndexError) Unwrap() error {
+	return e.Err
+}
+
+// CheckQueryError turns the error of a query served by index into a
+// MissingIndexError when Firestore rejected the query for lacking an index.
+// Other errors, and nil, are returned unchanged.
+func CheckQueryError(err error, index Index) error {
+	if err == nil || status.Code(err) != codes.FailedPrecondition {
+		return err
+	}
+	return &MissingIndexError{Index: index, Err: err}
+}
@@ -0,0 +1,120 @@
+package firestoreindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeLister struct {
+	indexes map[string][]Index
+	calls   int
+}
+
+func (f *fakeLister) ListIndexes(ctx context.Context, collection string) ([]Index, error) {
+	f.calls++
+	return f.indexes[collection], nil
+}
+
+var expired = Index{
+	Collection: "links",
+	Query:      "GetExpiredLinks",
+	Fields: []Field{
+		{Path: "is_expired", Order: OrderAscending},
+		{Path: "expires_at", Order: OrderAscending},
+	},
+}
+
+func TestIndexMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		other Index
+		want  bool
+	}{
+		{"Same fields", Index{Collection: "links", Fields: expired.Fields}, true},
+		{"Trailing __name__", Index{Collection: "links", Fields: append(append([]Field{}, expired.Fields...), Field{Path: "__name__", Order: OrderAscending})}, true},
+		{"Other order", Index{Collection: "links", Fields: []Field{expired.Fields[1], expired.Fields[0]}}, false},
+		{"Descending", Index{Collection: "links", Fields: []Field{expired.Fields[0], {Path: "expires_at", Order: OrderDescending}}}, false},
+		{"Other collection", Index{Collection: "link_stats", Fields: expired.Fields}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, expired.Matches(tt.other))
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tags := Index{Collection: "links", Fields: []Field{
+		{Path: "tags", Order: OrderAscending},
+		{Path: "created_at", Order: OrderDescending},
+	}}
+	building := tags
+	building.State = StateCreating
+	lister := &fakeLister{indexes: map[string][]Index{"links": {building}}}
+
+	verification, err := Verify(context.Background(), lister, []Index{expired, tags})
+	require.NoError(t, err)
+	assert.False(t, verification.OK())
+	assert.Equal(t, []Index{expired}, verification.Missing)
+	assert.Equal(t, []Index{tags}, verification.Building)
+	assert.Equal(t, 1, lister.calls, "each collection is listed once")
+}
+
+func TestIndexCreateCommand(t *testing.T) {
+	assert.Equal(t, "links(is_expired ASCENDING, expires_at ASCENDING)", expired.String())
+	assert.Equal(t, "gcloud firestore indexes composite create --collection-group=links"+
+		" --field-config=field-path=is_expired,order=ascending"+
+		" --field-config=field-path=expires_at,order=ascending", expired.CreateCommand())
+
+	tagged := Index{Collection: "links", Fields: []Field{
+		{Path: "tags", ArrayConfig: ArrayContains},
+		{Path: "created_at", Order: OrderDescending},
+	}}
+	assert.Equal(t, "links(tags CONTAINS, created_at DESCENDING)", tagged.String())
+	assert.Equal(t, "gcloud firestore indexes composite create --collection-group=links"+
+		" --field-config=field-path=tags,array-config=contains"+
+		" --field-config=field-path=created_at,order=descending", tagged.CreateCommand())
+}
+
+func TestFirebaseJSON(t *testing.T) {
+	tagged := Index{Collection: "links", Fields: []Field{
+		{Path: "tags", ArrayConfig: ArrayContains},
+		{Path: "short", Order: OrderAscending},
+	}}
+	data, err := FirebaseJSON([]Index{tagged})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"indexes": [{
+			"collectionGroup": "links",
+			"queryScope": "COLLECTION",
+			"fields": [
+				{"fieldPath": "tags", "arrayConfig": "CONTAINS"},
+				{"fieldPath": "short", "order": "ASCENDING"}
+			]
+		}],
+		"fieldOverrides": []
+	}`, string(data))
+}
+
+func TestCheckQueryError(t *testing.T) {
+	assert.NoError(t, CheckQueryError(nil, expired))
+
+	other := errors.New("unavailable")
+	assert.Equal(t, other, CheckQueryError(other, expired))
+
+	precondition := status.Error(codes.FailedPrecondition, "The query requires an index")
+	err := CheckQueryError(fmt.Errorf("Error retrieving expired links: %w", precondition), expired)
+	var missing *MissingIndexError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, expired, missing.Index)
+	assert.ErrorIs(t, err, precondition)
+	assert.Contains(t, err.Error(), "GetExpiredLinks")
+	assert.Contains(t, err.Error(), expired.CreateCommand())
+}
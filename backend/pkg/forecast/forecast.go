@@ -0,0 +1,88 @@
+// Package forecast projects the future daily clicks of a link from its past
+// daily clicks, so owners can judge whether a link is worth keeping.
+//
+// Forecasters are pluggable: each implements Forecaster, and the analytics
+// handler takes the one to use as an option.
+package forecast
+
+import "math"
+
+// Forecaster projects daily values from a history of daily values
+type Forecaster interface {
+	// Name identifies the method in responses, such as "linear_trend"
+	Name() string
+	// Forecast returns the projected values of the days following history,
+	// oldest first. history holds one value per day, oldest first, and may
+	// be empty. Projections are never negative.
+	Forecast(history []int, days int) []float64
+}
+
+// Default is the forecaster used unless another one is configured
+var Default Forecaster = LinearTrend{}
+
+// MovingAverage projects the average of the last Window days onto every
+// future day. A Window of zero or more than the history averages all of it.
+type MovingAverage struct {
+	Window int
+}
+
+// Name implements Forecaster
+func (m MovingAverage) Name() string {
+	return "moving_average"
+}
+
+// Forecast implements Forecaster
+func (m MovingAverage) Forecast(history []int, days int) []float64 {
+	window := history
+	if m.Window > 0 && m.Window < len(history) {
+		window = history[len(history)-m.Window:]
+	}
+	average := 0.0
+	for _, value := range window {
+		average += float64(value)
+	}
+	if len(window) > 0 {
+		average /= float64(len(window))
+	}
+	projected := make([]float64, days)
+	for i := range projected {
+		projected[i] = average
+	}
+	return projected
+}
+
+// LinearTrend fits a straight line to the history by least squares and
+// extends it into the future, so links gaining or losing use are projected
+// to keep doing so
+type LinearTrend struct{}
+
+// Name implements Forecaster
+func (LinearTrend) Name() string {
+	return "linear_trend"
+}
+
+// Forecast implements Forecaster
+func (LinearTrend) Forecast(history []int, days int) []float64 {
+	projected := make([]float64, days)
+	n := float64(len(history))
+	if n == 0 {
+		return projected
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, value := range history {
+		x, y := float64(i), float64(value)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	slope := 0.0
+	if denominator := n*sumXX - sumX*sumX; denominator != 0 {
+		slope = (n*sumXY - sumX*sumY) / denominator
+	}
+	intercept := (sumY - slope*sumX) / n
+	for i := range projected {
+		projected[i] = math.Max(0, intercept+slope*(n+float64(i)))
+	}
+	return projected
+}
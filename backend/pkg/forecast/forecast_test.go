@@ -0,0 +1,21 @@
+package forecast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMovingAverage(t *testing.T) {
+	assert.Equal(t, []float64{3, 3}, MovingAverage{Window: 2}.Forecast([]int{10, 2, 4}, 2))
+	assert.Equal(t, []float64{4, 4}, MovingAverage{}.Forecast([]int{10, 2, 0}, 2))
+	assert.Equal(t, []float64{0}, MovingAverage{Window: 7}.Forecast(nil, 1))
+}
+
+func TestLinearTrend(t *testing.T) {
+	assert.Equal(t, []float64{4, 5, 6}, LinearTrend{}.Forecast([]int{1, 2, 3}, 3))
+	assert.Equal(t, []float64{5, 5}, LinearTrend{}.Forecast([]int{5}, 2))
+	// A declining link is projected down to no clicks, never below
+	assert.Equal(t, []float64{0, 0, 0}, LinearTrend{}.Forecast([]int{4, 2, 0}, 3))
+	assert.Equal(t, []float64{}, LinearTrend{}.Forecast([]int{1, 2}, 0))
+}
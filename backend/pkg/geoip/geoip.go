@@ -0,0 +1,124 @@
+// Package geoip resolves client IP addresses to their location for click
+// analytics, using a MaxMind GeoLite2 or GeoIP2 City or Country database.
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// LookupsTotal counts address lookups by result
+var LookupsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "golink_geoip_lookups_total",
+		Help: "Total number of GeoIP lookups, by result",
+	},
+	[]string{"result"},
+)
+
+// Lookup results
+const (
+	resultFound    = "found"
+	resultNotFound = "not_found"
+	resultError    = "error"
+)
+
+// Location is where an address is. Country and Region are ISO codes and
+// City is the English name; fields the database lacks are empty.
+type Location struct {
+	Country   string
+	Region    string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+// Resolver looks up the location of an IP address. Unknown addresses
+// resolve to an empty location and false.
+type Resolver interface {
+	Lookup(ip net.IP) (Location, bool)
+}
+
+// Nop resolves every address to an unknown location. It stands in when no
+// database is configured.
+type Nop struct{}
+
+// Lookup returns an empty location
+func (Nop) Lookup(net.IP) (Location, bool) {
+	return Location{}, false
+}
+
+// Database resolves addresses with a MaxMind database
+type Database struct {
+	reader *maxminddb.Reader
+}
+
+// record holds the fields of a City or Country database record that are used
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// Open opens the MaxMind database at path
+func Open(path string) (*Database, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %w", path, err)
+	}
+	return &Database{reader: reader}, nil
+}
+
+// Lookup returns the location of ip. Lookup errors count as unknown
+// addresses, since a click is worth recording without its location.
+func (d *Database) Lookup(ip net.IP) (Location, bool) {
+	if ip == nil {
+		LookupsTotal.WithLabelValues(resultNotFound).Inc()
+		return Location{}, false
+	}
+	var rec record
+	if err := d.reader.Lookup(ip, &rec); err != nil {
+		LookupsTotal.WithLabelValues(resultError).Inc()
+		return Location{}, false
+	}
+	if rec.Country.ISOCode == "" {
+		LookupsTotal.WithLabelValues(resultNotFound).Inc()
+		return Location{}, false
+	}
+	LookupsTotal.WithLabelValues(resultFound).Inc()
+
+	loc := Location{
+		Country:   rec.Country.ISOCode,
+		City:      rec.City.Names["en"],
+		Latitude:  rec.Location.Latitude,
+		Longitude: rec.Location.Longitude,
+	}
+	if len(rec.Subdivisions) > 0 {
+		loc.Region = rec.Subdivisions[0].ISOCode
+	}
+	return loc, true
+}
+
+// Type returns the database type, such as "GeoLite2-City"
+func (d *Database) Type() string {
+	return d.reader.Metadata.DatabaseType
+}
+
+// Close releases the database
+func (d *Database) Close() error {
+	return d.reader.Close()
+}
@@ -0,0 +1,20 @@
+package geoip
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNop(t *testing.T) {
+	loc, ok := Nop{}.Lookup(net.ParseIP("203.0.113.57"))
+	assert.False(t, ok)
+	assert.Equal(t, Location{}, loc)
+}
+
+func TestOpenMissingDatabase(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "GeoLite2-City.mmdb"))
+	assert.Error(t, err)
+}
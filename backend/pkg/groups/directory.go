@@ -0,0 +1,36 @@
+package groups
+
+import (
+	"context"
+	"fmt"
+
+	admin "google.golang.org/api/admin/directory/v1"
+)
+
+// DirectorySource looks up the Google Groups of users in the Google
+// Workspace Directory. Groups are named by their email.
+type DirectorySource struct {
+	service *admin.Service
+}
+
+// NewDirectorySource creates a DirectorySource reading through service,
+// whose credentials need the admin.directory.group.readonly scope
+func NewDirectorySource(service *admin.Service) *DirectorySource {
+	return &DirectorySource{service: service}
+}
+
+// Groups returns the emails of the groups the user with email is a direct
+// member of
+func (s *DirectorySource) Groups(ctx context.Context, email string) ([]string, error) {
+	var groups []string
+	err := s.service.Groups.List().UserKey(email).Pages(ctx, func(page *admin.Groups) error {
+		for _, group := range page.Groups {
+			groups = append(groups, group.Email)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups of %s: %w", email, err)
+	}
+	return groups, nil
+}
@@ -0,0 +1,175 @@
+// Package groups resolves which groups users belong to, so restricted links
+// can be shared with whole teams instead of listing every member.
+//
+// Groups are Google Groups, looked up in the Google Workspace Directory, or
+// teams defined in a static file. A Service caches the groups of each user
+// for a while, and its middleware puts the groups of the signed-in user in
+// the request's context, where link access checks find them.
+package groups
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+)
+
+// DefaultTTL is how long the groups of a user are cached by default
+const DefaultTTL = 5 * time.Minute
+
+// maxCachedUsers bounds the cache; it is cleared when full
+const maxCachedUsers = 10000
+
+var log = logger.For("groups")
+
+var lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "golink_group_lookups_total",
+	Help: "Total number of group membership lookups by result (hit, miss, error)",
+}, []string{"result"})
+
+// Source looks up the groups a user belongs to
+type Source interface {
+	Groups(ctx context.Context, email string) ([]string, error)
+}
+
+// cached is the groups of a user, and when to look them up again
+type cached struct {
+	expires time.Time
+	groups  []string
+}
+
+// Service resolves the groups of users through a Source, caching them
+type Service struct {
+	source Source
+	now    func() time.Time
+	cache  map[string]cached
+	ttl    time.Duration
+	mutex  sync.Mutex
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithTTL sets how long the groups of a user are cached
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		if ttl > 0 {
+			s.ttl = ttl
+		}
+	}
+}
+
+// NewService creates a Service looking groups up in source
+func NewService(source Source, opts ...Option) *Service {
+	s := &Service{
+		source: source,
+		ttl:    DefaultTTL,
+		now:    time.Now,
+		cache:  make(map[string]cached),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Normalize returns the canonical form of a group name or email
+func Normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// NormalizeAll returns the canonical forms of names, sorted and without
+// blanks or duplicates
+func NormalizeAll(names []string) []string {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = Normalize(name); name != "" {
+			normalized = append(normalized, name)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// Groups returns the groups of the user with email, sorted
+func (s *Service) Groups(ctx context.Context, email string) ([]string, error) {
+	email = Normalize(email)
+	if email == "" {
+		return nil, nil
+	}
+
+	s.mutex.Lock()
+	entry, found := s.cache[email]
+	s.mutex.Unlock()
+	if found && s.now().Before(entry.expires) {
+		lookups.WithLabelValues("hit").Inc()
+		return entry.groups, nil
+	}
+
+	groups, err := s.source.Groups(ctx, email)
+	if err != nil {
+		lookups.WithLabelValues("error").Inc()
+		return nil, err
+	}
+	lookups.WithLabelValues("miss").Inc()
+	groups = NormalizeAll(groups)
+
+	s.mutex.Lock()
+	if len(s.cache) >= maxCachedUsers {
+		s.cache = make(map[string]cached)
+	}
+	s.cache[email] = cached{groups: groups, expires: s.now().Add(s.ttl)}
+	s.mutex.Unlock()
+	return groups, nil
+}
+
+// Middleware puts the groups of the request's user, whose email userEmail
+// returns, in the request's context. Requests without a user, and requests
+// whose user's groups cannot be looked up, go on without groups.
+func (s *Service) Middleware(userEmail func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			email := userEmail(r)
+			if email == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			groups, err := s.Groups(r.Context(), email)
+			if err != nil {
+				// Fail closed: the user is only denied links shared with groups
+				log.Error("Failed to look up groups", err, logger.Fields{"email": email})
+			}
+			next.ServeHTTP(w, r.WithContext(With(r.Context(), groups)))
+		})
+	}
+}
+
+// groupsKey carries the groups of a context's user
+type groupsKey struct{}
+
+// With returns a context whose user belongs to groups
+func With(ctx context.Context, groups []string) context.Context {
+	if len(groups) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, groupsKey{}, groups)
+}
+
+// FromContext returns the groups of the context's user
+func FromContext(ctx context.Context) []string {
+	groups, _ := ctx.Value(groupsKey{}).([]string)
+	return groups
+}
+
+// Inherit returns ctx with the groups of from's user. Handlers use it to
+// carry the request's groups into contexts that outlive the request.
+func Inherit(ctx, from context.Context) context.Context {
+	return With(ctx, FromContext(from))
+}
@@ -0,0 +1,101 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSource counts its lookups, failing while err is set
+type countingSource struct {
+	err     error
+	groups  []string
+	lookups int
+}
+
+func (s *countingSource) Groups(ctx context.Context, email string) ([]string, error) {
+	s.lookups++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return append([]string(nil), s.groups...), nil
+}
+
+func TestServiceGroups(t *testing.T) {
+	source := &countingSource{groups: []string{"Eng@Example.com ", "all@example.com", "eng@example.com"}}
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	service := NewService(source, WithTTL(time.Minute))
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	groups, err := service.Groups(ctx, "Ann@Example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"all@example.com", "eng@example.com"}, groups, "groups are normalized, sorted and deduplicated")
+
+	_, err = service.Groups(ctx, "ann@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 1, source.lookups, "groups are cached by normalized email")
+
+	now = now.Add(2 * time.Minute)
+	source.err = errors.New("directory unavailable")
+	_, err = service.Groups(ctx, "ann@example.com")
+	assert.Error(t, err, "expired groups are looked up again")
+	assert.Equal(t, 2, source.lookups)
+
+	groups, err = service.Groups(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+	assert.Equal(t, 2, source.lookups, "requests without a user are not looked up")
+}
+
+func TestStaticSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "teams.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"Platform": ["ann@example.com"], "sre": ["Ann@Example.com", "bob@example.com"]}`), 0o600))
+
+	source, err := LoadStaticSource(path)
+	require.NoError(t, err)
+	groups, err := NewService(source).Groups(context.Background(), "ann@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"platform", "sre"}, groups)
+
+	groups, err = source.Groups(context.Background(), "carol@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+
+	_, err = LoadStaticSource(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	source := &countingSource{groups: []string{"eng@example.com"}}
+	service := NewService(source)
+
+	var seen []string
+	handler := service.Middleware(func(r *http.Request) string {
+		return r.Header.Get("X-User-Email")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(Inherit(context.Background(), r.Context()))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/links", nil)
+	req.Header.Set("X-User-Email", "ann@example.com")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, []string{"eng@example.com"}, seen)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/links", nil))
+	assert.Empty(t, seen, "requests without a user have no groups")
+
+	source.err = errors.New("directory unavailable")
+	req = httptest.NewRequest(http.MethodGet, "/api/links", nil)
+	req.Header.Set("X-User-Email", "bob@example.com")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, seen, "failed lookups leave the user without groups")
+}
@@ -0,0 +1,46 @@
+package groups
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// StaticSource holds teams defined in configuration, by their members'
+// emails
+type StaticSource struct {
+	// byMember holds the teams of each member
+	byMember map[string][]string
+}
+
+// NewStaticSource creates a StaticSource from the members of each team
+func NewStaticSource(teams map[string][]string) *StaticSource {
+	s := &StaticSource{byMember: make(map[string][]string)}
+	for team, members := range teams {
+		for _, member := range members {
+			member = Normalize(member)
+			s.byMember[member] = append(s.byMember[member], Normalize(team))
+		}
+	}
+	return s
+}
+
+// LoadStaticSource reads teams from a JSON file mapping each team's name to
+// the emails of its members, such as {"platform": ["ann@example.com"]}
+func LoadStaticSource(path string) (*StaticSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read teams file: %w", err)
+	}
+	var teams map[string][]string
+	if err := json.Unmarshal(data, &teams); err != nil {
+		return nil, fmt.Errorf("failed to parse teams file %s: %w", path, err)
+	}
+	return NewStaticSource(teams), nil
+}
+
+// Groups returns the teams the user with email is a member of
+func (s *StaticSource) Groups(ctx context.Context, email string) ([]string, error) {
+	return append([]string(nil), s.byMember[Normalize(email)]...), nil
+}
@@ -0,0 +1,45 @@
+// Package jobs counts the outcome of background work: scheduled jobs such as
+// the sandbox sweeper and retention, and asynchronous writers such as the
+// click stream. Their errors never reach a client, so each run is recorded
+// here, letting silent data loss be alerted on:
+//
+//	increase(golink_background_job_failures_total[15m]) > 0
+//	time() - golink_background_job_last_success_timestamp_seconds > 3600
+package jobs
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// FailuresTotal counts the failed runs of background jobs
+	FailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_background_job_failures_total",
+			Help: "Total number of failed background job runs, by job",
+		},
+		[]string{"job"},
+	)
+
+	// LastSuccess holds when each background job last succeeded
+	LastSuccess = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "golink_background_job_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful run of each background job",
+		},
+		[]string{"job"},
+	)
+)
+
+// Record records a run of job that returned err. Callers log the error
+// themselves, with the job's name among the fields.
+func Record(job string, err error) {
+	if err != nil {
+		FailuresTotal.WithLabelValues(job).Inc()
+		return
+	}
+	LastSuccess.WithLabelValues(job).Set(float64(time.Now().Unix()))
+}
@@ -0,0 +1,21 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord(t *testing.T) {
+	Record("test-job", errors.New("commit failed"))
+	Record("test-job", errors.New("commit failed"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(FailuresTotal.WithLabelValues("test-job")))
+	assert.Zero(t, testutil.ToFloat64(LastSuccess.WithLabelValues("test-job")), "failures leave the last success alone")
+
+	Record("test-job", nil)
+	assert.InDelta(t, float64(time.Now().Unix()), testutil.ToFloat64(LastSuccess.WithLabelValues("test-job")), 1)
+	assert.Equal(t, 2.0, testutil.ToFloat64(FailuresTotal.WithLabelValues("test-job")))
+}
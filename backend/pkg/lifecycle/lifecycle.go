@@ -0,0 +1,278 @@
+// Package lifecycle starts and stops the server's components in dependency
+// order and reports whether each of them is ready to serve.
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+)
+
+// readyCheckTimeout bounds a single component's readiness check
+const readyCheckTimeout = 2 * time.Second
+
+// Component is a subsystem started and stopped with the server. Every hook is
+// optional.
+type Component struct {
+	// Start brings the component up and returns once it is running
+	Start func(ctx context.Context) error
+	// Stop shuts the component down, giving up when ctx is done
+	Stop func(ctx context.Context) error
+	// Ready reports why the component cannot serve; a running component
+	// without a check is always ready
+	Ready func(ctx context.Context) error
+	Name  string
+	// DependsOn names components that must start before this one and stop after it
+	DependsOn []string
+	// StopTimeout bounds Stop within the overall shutdown deadline
+	StopTimeout time.Duration
+}
+
+// Component states
+const (
+	statePending  = "pending"
+	stateRunning  = "running"
+	stateStopping = "stopping"
+	stateStopped  = "stopped"
+	stateFailed   = "failed"
+)
+
+// ComponentStatus is a component's readiness as reported by /readyz
+type ComponentStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+	Ready bool   `json:"ready"`
+}
+
+// Manager is a registry of components
+type Manager struct {
+	states     map[string]string
+	components []Component
+	started    []Component
+	mutex      sync.RWMutex
+	stopping   bool
+}
+
+// NewManager creates an empty Manager
+func NewManager() *Manager {
+	return &Manager{
+		states: make(map[string]string),
+	}
+}
+
+// Register adds a component. Names must be unique.
+func (m *Manager) Register(c Component) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if c.Name == "" {
+		return errors.New("component name is required")
+	}
+	if _, exists := m.states[c.Name]; exists {
+		return fmt.Errorf("component %q is already registered", c.Name)
+	}
+	m.components = append(m.components, c)
+	m.states[c.Name] = statePending
+	return nil
+}
+
+// Start starts every component after the components it depends on. If one
+// fails, those already started are stopped again and the error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mutex.RLock()
+	order, err := startOrder(m.components)
+	m.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range order {
+		begin := time.Now()
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				m.setState(c.Name, stateFailed)
+				logger.Error("Component failed to start", err, logger.Fields{"component": c.Name})
+				if stopErr := m.Stop(ctx); stopErr != nil {
+					err = errors.Join(err, stopErr)
+				}
+				return fmt.Errorf("start %s: %w", c.Name, err)
+			}
+		}
+
+		m.mutex.Lock()
+		m.states[c.Name] = stateRunning
+		m.started = append(m.started, c)
+		m.mutex.Unlock()
+		logger.Info("Component started", logger.Fields{
+			"component": c.Name,
+			"duration":  time.Since(begin).String(),
+		})
+	}
+	return nil
+}
+
+// Stop stops the started components in reverse start order, so each one
+// stops before the components it depends on. Every component is given the
+// chance to stop even if others fail or the deadline passes; the errors are
+// returned together.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mutex.Lock()
+	m.stopping = true
+	started := m.started
+	m.started = nil
+	m.mutex.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		m.setState(c.Name, stateStopping)
+		begin := time.Now()
+
+		if err := stopComponent(ctx, c); err != nil {
+			m.setState(c.Name, stateFailed)
+			logger.Error("Component failed to stop", err, logger.Fields{"component": c.Name})
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.Name, err))
+			continue
+		}
+		m.setState(c.Name, stateStopped)
+		logger.Info("Component stopped", logger.Fields{
+			"component": c.Name,
+			"duration":  time.Since(begin).String(),
+		})
+	}
+	return errors.Join(errs...)
+}
+
+// stopComponent runs a component's Stop hook within its own timeout
+func stopComponent(ctx context.Context, c Component) error {
+	if c.Stop == nil {
+		return nil
+	}
+	if c.StopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.StopTimeout)
+		defer cancel()
+	}
+	return c.Stop(ctx)
+}
+
+// Readiness reports the status of every component, in registration order,
+// and whether all of them are ready. Nothing is ready once shutdown begins.
+func (m *Manager) Readiness(ctx context.Context) ([]ComponentStatus, bool) {
+	m.mutex.RLock()
+	components := append([]Component{}, m.components...)
+	states := make(map[string]string, len(m.states))
+	for name, state := range m.states {
+		states[name] = state
+	}
+	stopping := m.stopping
+	m.mutex.RUnlock()
+
+	statuses := make([]ComponentStatus, 0, len(components))
+	allReady := !stopping
+	for _, c := range components {
+		status := ComponentStatus{Name: c.Name, State: states[c.Name]}
+		if status.State == stateRunning {
+			status.Ready = true
+			if c.Ready != nil {
+				checkCtx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+				if err := c.Ready(checkCtx); err != nil {
+					status.Ready = false
+					status.Error = err.Error()
+				}
+				cancel()
+			}
+		}
+		allReady = allReady && status.Ready
+		statuses = append(statuses, status)
+	}
+	return statuses, allReady
+}
+
+// ServeReadyz handles GET /readyz requests: 200 when every component is
+// ready, 503 otherwise, with the status of each component
+func (m *Manager) ServeReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	components, ready := m.Readiness(r.Context())
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     status,
+		"components": components,
+	}); err != nil {
+		logger.Error("Failed to encode readiness", err, nil)
+	}
+}
+
+func (m *Manager) setState(name, state string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.states[name] = state
+}
+
+// startOrder sorts components so each comes after its dependencies, keeping
+// registration order otherwise. Unknown dependencies and cycles are errors.
+func startOrder(components []Component) ([]Component, error) {
+	byName := make(map[string]Component, len(components))
+	for _, c := range components {
+		byName[c.Name] = c
+	}
+	for _, c := range components {
+		for _, dep := range c.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("component %q depends on unknown component %q", c.Name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int, len(components))
+	order := make([]Component, 0, len(components))
+
+	var visit func(c Component) error
+	visit = func(c Component) error {
+		switch marks[c.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle through component %q", c.Name)
+		}
+		marks[c.Name] = visiting
+		for _, dep := range c.DependsOn {
+			if err := visit(byName[dep]); err != nil {
+				return err
+			}
+		}
+		marks[c.Name] = visited
+		order = append(order, c)
+		return nil
+	}
+
+	for _, c := range components {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,141 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder records the order in which component hooks run
+type recorder struct {
+	events []string
+	mutex  sync.Mutex
+}
+
+func (r *recorder) component(name string, deps ...string) Component {
+	return Component{
+		Name:      name,
+		DependsOn: deps,
+		Start:     func(ctx context.Context) error { r.add("start " + name); return nil },
+		Stop:      func(ctx context.Context) error { r.add("stop " + name); return nil },
+	}
+}
+
+func (r *recorder) add(event string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func TestManagerOrder(t *testing.T) {
+	rec := &recorder{}
+	m := NewManager()
+	require.NoError(t, m.Register(rec.component("http", "workers")))
+	require.NoError(t, m.Register(rec.component("workers", "store")))
+	require.NoError(t, m.Register(rec.component("store")))
+	require.NoError(t, m.Register(rec.component("cache")))
+
+	require.NoError(t, m.Start(context.Background()))
+	require.NoError(t, m.Stop(context.Background()))
+
+	assert.Equal(t, []string{
+		"start store", "start workers", "start http", "start cache",
+		"stop cache", "stop http", "stop workers", "stop store",
+	}, rec.events)
+}
+
+func TestManagerRegisterErrors(t *testing.T) {
+	m := NewManager()
+	require.NoError(t, m.Register(Component{Name: "store"}))
+	assert.Error(t, m.Register(Component{Name: "store"}), "duplicate name")
+	assert.Error(t, m.Register(Component{}), "missing name")
+}
+
+func TestManagerInvalidDependencies(t *testing.T) {
+	unknown := NewManager()
+	require.NoError(t, unknown.Register(Component{Name: "http", DependsOn: []string{"store"}}))
+	assert.ErrorContains(t, unknown.Start(context.Background()), "unknown component")
+
+	cycle := NewManager()
+	require.NoError(t, cycle.Register(Component{Name: "a", DependsOn: []string{"b"}}))
+	require.NoError(t, cycle.Register(Component{Name: "b", DependsOn: []string{"a"}}))
+	assert.ErrorContains(t, cycle.Start(context.Background()), "cycle")
+}
+
+func TestManagerStartFailureStopsStarted(t *testing.T) {
+	rec := &recorder{}
+	m := NewManager()
+	require.NoError(t, m.Register(rec.component("store")))
+	broken := rec.component("http", "store")
+	broken.Start = func(ctx context.Context) error { return errors.New("address in use") }
+	require.NoError(t, m.Register(broken))
+
+	err := m.Start(context.Background())
+	require.ErrorContains(t, err, "address in use")
+	assert.Equal(t, []string{"start store", "stop store"}, rec.events)
+}
+
+func TestManagerStopTimeout(t *testing.T) {
+	rec := &recorder{}
+	m := NewManager()
+	require.NoError(t, m.Register(rec.component("store")))
+	require.NoError(t, m.Register(Component{
+		Name:        "workers",
+		DependsOn:   []string{"store"},
+		StopTimeout: 10 * time.Millisecond,
+		Stop: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	require.NoError(t, m.Start(context.Background()))
+
+	err := m.Stop(context.Background())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, rec.events, "stop store", "later components still stop")
+}
+
+func TestServeReadyz(t *testing.T) {
+	var storeErr error
+	m := NewManager()
+	require.NoError(t, m.Register(Component{Name: "store", Ready: func(ctx context.Context) error { return storeErr }}))
+	require.NoError(t, m.Register(Component{Name: "http", DependsOn: []string{"store"}}))
+
+	readyz := func() (int, []ComponentStatus) {
+		rr := httptest.NewRecorder()
+		m.ServeReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body struct {
+			Components []ComponentStatus `json:"components"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		return rr.Code, body.Components
+	}
+
+	code, components := readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code, "not started")
+	assert.Equal(t, statePending, components[0].State)
+
+	require.NoError(t, m.Start(context.Background()))
+	code, _ = readyz()
+	assert.Equal(t, http.StatusOK, code)
+
+	storeErr = errors.New("connection refused")
+	code, components = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, ComponentStatus{Name: "store", State: stateRunning, Error: "connection refused"}, components[0])
+	assert.True(t, components[1].Ready)
+
+	storeErr = nil
+	require.NoError(t, m.Stop(context.Background()))
+	code, components = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, stateStopped, components[1].State)
+}
@@ -0,0 +1,73 @@
+// Package linkcap caps how many links a request loads when it lists every
+// link. Several endpoints still load the whole links collection instead of
+// paginating; the cap keeps a collection of hundreds of thousands of links
+// from exhausting the server's memory.
+//
+// A request's context carries its cap. The repositories load at most that
+// many links and mark the context truncated when more exist, so the
+// response can say it is incomplete. Contexts without a cap, such as those
+// of background jobs and command-line tools, load every link.
+package linkcap
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// DefaultMax is the default cap on the links loaded by a request
+const DefaultMax = 50000
+
+// capKey carries the cap of a context
+type capKey struct{}
+
+// linkCap is the cap of a request and whether it was reached
+type linkCap struct {
+	limit     int
+	truncated atomic.Bool
+}
+
+// With returns a context loading at most limit links per listing. A limit
+// that is not positive leaves ctx uncapped.
+func With(ctx context.Context, limit int) context.Context {
+	if limit <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, capKey{}, &linkCap{limit: limit})
+}
+
+// Max returns the cap of ctx, or zero when it has none
+func Max(ctx context.Context) int {
+	if c, ok := ctx.Value(capKey{}).(*linkCap); ok {
+		return c.limit
+	}
+	return 0
+}
+
+// Inherit returns ctx with the cap of from, sharing whether it was reached.
+// Handlers use it to carry the request's cap into contexts that outlive the
+// request.
+func Inherit(ctx, from context.Context) context.Context {
+	if c, ok := from.Value(capKey{}).(*linkCap); ok {
+		return context.WithValue(ctx, capKey{}, c)
+	}
+	return ctx
+}
+
+// Apply returns the first links up to the cap of ctx, marking ctx truncated
+// when links were left out
+func Apply(ctx context.Context, links []*models.Link) []*models.Link {
+	c, ok := ctx.Value(capKey{}).(*linkCap)
+	if !ok || len(links) <= c.limit {
+		return links
+	}
+	c.truncated.Store(true)
+	return links[:c.limit]
+}
+
+// Truncated reports whether a listing of ctx left links out
+func Truncated(ctx context.Context) bool {
+	c, ok := ctx.Value(capKey{}).(*linkCap)
+	return ok && c.truncated.Load()
+}
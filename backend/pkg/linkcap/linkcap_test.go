@@ -0,0 +1,39 @@
+package linkcap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	links := []*models.Link{
+		models.NewLink("a", "https://a.example.com", "user1"),
+		models.NewLink("b", "https://b.example.com", "user1"),
+		models.NewLink("c", "https://c.example.com", "user1"),
+	}
+
+	ctx := context.Background()
+	assert.Len(t, Apply(ctx, links), 3, "contexts without a cap load every link")
+	assert.False(t, Truncated(ctx))
+	assert.Equal(t, ctx, With(ctx, 0))
+
+	capped := With(ctx, 3)
+	assert.Len(t, Apply(capped, links), 3)
+	assert.False(t, Truncated(capped), "a listing within the cap is complete")
+
+	capped = With(ctx, 2)
+	assert.Equal(t, 2, Max(capped))
+	assert.Equal(t, links[:2], Apply(capped, links))
+	assert.True(t, Truncated(capped))
+
+	// Inherited contexts share the cap and whether it was reached
+	request := With(ctx, 1)
+	read := Inherit(context.Background(), request)
+	assert.Equal(t, 1, Max(read))
+	Apply(read, links)
+	assert.True(t, Truncated(request))
+	assert.Equal(t, 0, Max(Inherit(ctx, ctx)))
+}
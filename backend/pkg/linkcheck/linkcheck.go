@@ -0,0 +1,83 @@
+// Package linkcheck probes link destinations to flag dead links.
+//
+// A destination is requested with HEAD (falling back to GET for servers that
+// do not support HEAD) through a safehttp client, so checks cannot reach the
+// server's own network. Destinations the client refuses to contact, such as
+// intranet hosts, are reported as unknown rather than dead.
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/safehttp"
+)
+
+// Checker probes destination URLs
+type Checker struct {
+	client *safehttp.Client
+}
+
+// New creates a Checker that fetches through client
+func New(client *safehttp.Client) *Checker {
+	return &Checker{client: client}
+}
+
+// Check returns one of models.HealthStatuses for rawURL
+func (c *Checker) Check(ctx context.Context, rawURL string) string {
+	resp, err := c.request(ctx, http.MethodHead, rawURL)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = c.request(ctx, http.MethodGet, rawURL)
+	}
+	if err != nil {
+		return statusForError(err)
+	}
+	resp.Body.Close()
+	return statusForCode(resp.StatusCode)
+}
+
+// request sends a body-less request to rawURL
+func (c *Checker) request(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// statusForCode classifies an HTTP response. A login wall still proves the
+// destination exists, while rate limiting and server errors may be transient.
+func statusForCode(code int) string {
+	switch {
+	case code < http.StatusBadRequest,
+		code == http.StatusUnauthorized,
+		code == http.StatusForbidden,
+		code == http.StatusProxyAuthRequired:
+		return models.HealthStatuses.Healthy
+	case code == http.StatusTooManyRequests, code >= http.StatusInternalServerError:
+		return models.HealthStatuses.Unknown
+	default:
+		return models.HealthStatuses.Dead
+	}
+}
+
+// statusForError classifies a failed request. Only failures that point at the
+// destination itself, such as an unknown host or a refused connection, are dead.
+func statusForError(err error) string {
+	if errors.Is(err, safehttp.ErrBlockedHost) ||
+		errors.Is(err, safehttp.ErrBlockedAddress) ||
+		errors.Is(err, safehttp.ErrSchemeNotAllowed) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) {
+		return models.HealthStatuses.Unknown
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return models.HealthStatuses.Unknown
+	}
+	return models.HealthStatuses.Dead
+}
@@ -0,0 +1,67 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/safehttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/login":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/get-only":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/flaky":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	opts := safehttp.DefaultOptions()
+	opts.AllowPrivateNetworks = true
+	checker := New(safehttp.New(opts))
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "Reachable", url: server.URL + "/ok", want: models.HealthStatuses.Healthy},
+		{name: "Redirect to reachable", url: server.URL + "/moved", want: models.HealthStatuses.Healthy},
+		{name: "Login wall", url: server.URL + "/login", want: models.HealthStatuses.Healthy},
+		{name: "HEAD not allowed", url: server.URL + "/get-only", want: models.HealthStatuses.Healthy},
+		{name: "Not found", url: server.URL + "/gone", want: models.HealthStatuses.Dead},
+		{name: "Server error", url: server.URL + "/flaky", want: models.HealthStatuses.Unknown},
+		{name: "Connection refused", url: closed.URL, want: models.HealthStatuses.Dead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, checker.Check(context.Background(), tt.url))
+		})
+	}
+}
+
+func TestCheckBlockedDestination(t *testing.T) {
+	checker := New(safehttp.New(safehttp.DefaultOptions()))
+
+	assert.Equal(t, models.HealthStatuses.Unknown, checker.Check(context.Background(), "http://intranet/wiki"))
+	assert.Equal(t, models.HealthStatuses.Unknown, checker.Check(context.Background(), "http://127.0.0.1/"))
+}
@@ -0,0 +1,111 @@
+// Package linkmerge finds links whose destinations are equivalent and plans
+// merging each group into one canonical link, the others becoming its
+// aliases.
+package linkmerge
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlnorm"
+)
+
+// Group is a set of links with equivalent destinations. Merging it turns
+// every duplicate into an alias of the canonical link.
+type Group struct {
+	// Canonical is the link that is kept
+	Canonical *models.Link
+	// Key is the destination the links share, as the equivalence sees it
+	Key        string
+	Duplicates []*models.Link
+}
+
+// Mergeable reports whether a link may take part in a merge. Links whose
+// behavior goes beyond their destination, such as expiring, click-limited,
+// archived or mid-rollout links, would lose it as an alias and are left alone.
+func Mergeable(link *models.Link) bool {
+	return !link.IsDeleted() &&
+		!link.IsArchived() &&
+		link.ExpiresAt.IsZero() &&
+		link.MaxClicks == 0 &&
+		link.Rollout == nil &&
+		link.PendingTransfer == nil
+}
+
+// Find groups the mergeable links whose destinations are equivalent. Links
+// are only grouped with links visible to the same users and of the same
+// classification, so merging never widens who can follow a link. Groups are
+// ordered by the canonical short code.
+func Find(links []*models.Link, eq urlnorm.Equivalence) []Group {
+	byKey := make(map[string][]*models.Link)
+	destinations := make(map[string]string)
+	for _, link := range links {
+		if !Mergeable(link) {
+			continue
+		}
+		destination := eq.Key(link.URL)
+		key := destination + "\x00" + audience(link) + "\x00" + link.Classification
+		byKey[key] = append(byKey[key], link)
+		destinations[key] = destination
+	}
+
+	var groups []Group
+	for key, members := range byKey {
+		if len(members) < 2 {
+			continue
+		}
+		sort.Slice(members, func(i, j int) bool { return preferred(members[i], members[j]) })
+		groups = append(groups, Group{
+			Canonical:  members[0],
+			Key:        destinations[key],
+			Duplicates: members[1:],
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Canonical.Short < groups[j].Canonical.Short })
+	return groups
+}
+
+// audience identifies who can follow a link
+func audience(link *models.Link) string {
+	switch link.AccessLevel {
+	case models.AccessLevels.Private:
+		return link.AccessLevel + ":" + link.CreatedBy
+	case models.AccessLevels.Restricted:
+		users := append([]string{link.CreatedBy}, link.AllowedUsers...)
+		slices.Sort(users)
+		return link.AccessLevel + ":" + strings.Join(slices.Compact(users), ",")
+	}
+	return link.AccessLevel
+}
+
+// preferred reports whether a should be kept rather than b: the link with
+// the most clicks, then the oldest, then the shortest short code
+func preferred(a, b *models.Link) bool {
+	if a.ClickCount != b.ClickCount {
+		return a.ClickCount > b.ClickCount
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	if len(a.Short) != len(b.Short) {
+		return len(a.Short) < len(b.Short)
+	}
+	return a.Short < b.Short
+}
+
+// WriteDiff describes what merging the group changes, one line per link
+func (g Group) WriteDiff(w io.Writer) error {
+	lines := []string{fmt.Sprintf("  %s -> %s (%d clicks, kept)", g.Canonical.Short, g.Canonical.URL, g.Canonical.ClickCount)}
+	for _, d := range g.Duplicates {
+		lines = append(lines,
+			fmt.Sprintf("- %s -> %s (%d clicks, owner %s)", d.Short, d.URL, d.ClickCount, d.CreatedBy),
+			fmt.Sprintf("+ %s alias of %s", d.Short, g.Canonical.Short),
+		)
+	}
+	_, err := fmt.Fprintf(w, "%s\n%s\n", g.Key, strings.Join(lines, "\n"))
+	return err
+}
@@ -0,0 +1,63 @@
+package linkmerge
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/urlnorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLink(short, url string, clicks int) *models.Link {
+	link := models.NewLink(short, url, "user1")
+	link.ClickCount = clicks
+	return link
+}
+
+func TestFind(t *testing.T) {
+	eq := urlnorm.Equivalence{Normalizer: urlnorm.Default(), IgnoreScheme: true, IgnoreTrailingSlash: true}
+	eq.StripTracking = true
+
+	docs := newLink("docs", "https://example.com/docs", 10)
+	documentation := newLink("documentation", "http://example.com/docs/", 3)
+	manual := newLink("manual", "https://example.com/docs?utm_source=wiki", 3)
+	manual.CreatedAt = documentation.CreatedAt.Add(-time.Hour)
+	other := newLink("other", "https://example.com/other", 50)
+
+	private := newLink("mine", "https://example.com/docs", 1)
+	private.AccessLevel = models.AccessLevels.Private
+	expiring := newLink("event", "https://example.com/docs", 1)
+	expiring.ExpiresAt = time.Now().Add(time.Hour)
+	sensitive := newLink("secret-docs", "https://example.com/docs", 1)
+	sensitive.Classification = "sensitive"
+
+	groups := Find([]*models.Link{documentation, other, manual, docs, private, expiring, sensitive}, eq)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "docs", groups[0].Canonical.Short)
+	require.Len(t, groups[0].Duplicates, 2)
+	// Equal clicks favor the older link
+	assert.Equal(t, "manual", groups[0].Duplicates[0].Short)
+	assert.Equal(t, "documentation", groups[0].Duplicates[1].Short)
+
+	var diff strings.Builder
+	require.NoError(t, groups[0].WriteDiff(&diff))
+	assert.Contains(t, diff.String(), "  docs -> https://example.com/docs (10 clicks, kept)")
+	assert.Contains(t, diff.String(), "- documentation -> http://example.com/docs/ (3 clicks, owner user1)")
+	assert.Contains(t, diff.String(), "+ documentation alias of docs")
+
+	// Private links of the same owner are merged with each other
+	private2 := newLink("mine2", "https://example.com/docs/", 0)
+	private2.AccessLevel = models.AccessLevels.Private
+	groups = Find([]*models.Link{private, private2}, eq)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "mine", groups[0].Canonical.Short)
+
+	private2.CreatedBy = "user2"
+	assert.Empty(t, Find([]*models.Link{private, private2}, eq))
+
+	// Stricter rules find fewer duplicates
+	assert.Empty(t, Find([]*models.Link{docs, documentation}, urlnorm.Equivalence{Normalizer: urlnorm.Default()}))
+}
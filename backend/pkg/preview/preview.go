@@ -0,0 +1,319 @@
+// Package preview fetches the metadata of link destinations for rich cards.
+//
+// Pages are fetched through a safehttp client, so previews cannot reach the
+// server's own network, and only the document head is parsed. Results are
+// cached per URL for a configurable time, failures for a shorter one, so a
+// popular card does not fetch its destination on every view.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/safehttp"
+)
+
+// Defaults for the preview cache
+const (
+	DefaultTTL        = time.Hour
+	DefaultFailureTTL = 5 * time.Minute
+	DefaultMaxEntries = 10000
+)
+
+const (
+	// maxHeadBytes bounds how much of a page is read looking for its metadata
+	maxHeadBytes = 256 << 10 // 256 KiB
+	// maxTitleLength and maxDescriptionLength bound the text kept per preview
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+)
+
+// ErrNotHTML is returned for destinations that are not HTML pages
+var ErrNotHTML = errors.New("preview: destination is not an HTML page")
+
+// Option configures a Fetcher
+type Option func(*Fetcher)
+
+// WithTTL sets how long a fetched preview is served from the cache
+func WithTTL(ttl time.Duration) Option {
+	return func(f *Fetcher) {
+		if ttl > 0 {
+			f.ttl = ttl
+		}
+	}
+}
+
+// WithFailureTTL sets how long a failed fetch is remembered before the
+// destination is tried again
+func WithFailureTTL(ttl time.Duration) Option {
+	return func(f *Fetcher) {
+		if ttl > 0 {
+			f.failureTTL = ttl
+		}
+	}
+}
+
+// WithMaxEntries bounds the number of cached previews
+func WithMaxEntries(n int) Option {
+	return func(f *Fetcher) {
+		if n > 0 {
+			f.maxEntries = n
+		}
+	}
+}
+
+// entry is a cached fetch result
+type entry struct {
+	expiresAt time.Time
+	preview   *models.LinkPreview
+	err       error
+}
+
+// Fetcher fetches and caches destination previews
+type Fetcher struct {
+	client     *safehttp.Client
+	now        func() time.Time
+	entries    map[string]entry
+	ttl        time.Duration
+	failureTTL time.Duration
+	maxEntries int
+	mu         sync.Mutex
+}
+
+// New creates a Fetcher that fetches through client
+func New(client *safehttp.Client, opts ...Option) *Fetcher {
+	f := &Fetcher{
+		client:     client,
+		now:        time.Now,
+		entries:    map[string]entry{},
+		ttl:        DefaultTTL,
+		failureTTL: DefaultFailureTTL,
+		maxEntries: DefaultMaxEntries,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Preview returns the preview of rawURL, from the cache while it is fresh
+func (f *Fetcher) Preview(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	if cached, ok := f.cached(rawURL); ok {
+		return cached.preview, cached.err
+	}
+
+	p, err := f.fetch(ctx, rawURL)
+	// A cancelled request says nothing about the destination
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+	ttl := f.ttl
+	if err != nil {
+		ttl = f.failureTTL
+	}
+	f.store(rawURL, entry{expiresAt: f.now().Add(ttl), preview: p, err: err})
+	return p, err
+}
+
+// cached returns the unexpired cache entry of rawURL
+func (f *Fetcher) cached(rawURL string) (entry, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.entries[rawURL]
+	if !ok || !f.now().Before(e.expiresAt) {
+		return entry{}, false
+	}
+	return e, true
+}
+
+// store caches e, evicting expired entries first and, if the cache is still
+// full, the entry closest to expiry
+func (f *Fetcher) store(rawURL string, e entry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.entries[rawURL]; !ok && len(f.entries) >= f.maxEntries {
+		now := f.now()
+		var oldest string
+		for key, cached := range f.entries {
+			if !now.Before(cached.expiresAt) {
+				delete(f.entries, key)
+				continue
+			}
+			if oldest == "" || cached.expiresAt.Before(f.entries[oldest].expiresAt) {
+				oldest = key
+			}
+		}
+		if len(f.entries) >= f.maxEntries {
+			delete(f.entries, oldest)
+		}
+	}
+	f.entries[rawURL] = e
+}
+
+// fetch requests rawURL and parses the metadata of the page it ends up on
+func (f *Fetcher) fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("preview: destination responded with status %d", resp.StatusCode)
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil ||
+		(mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return nil, ErrNotHTML
+	}
+
+	p, err := parse(io.LimitReader(resp.Body, maxHeadBytes), resp.Request.URL)
+	if err != nil {
+		return nil, err
+	}
+	p.URL = rawURL
+	p.FetchedAt = f.now()
+	return p, nil
+}
+
+// parse extracts the preview metadata from the head of an HTML document.
+// Relative image and icon URLs are resolved against base.
+func parse(r io.Reader, base *url.URL) (*models.LinkPreview, error) {
+	var (
+		p        models.LinkPreview
+		title    string
+		desc     string
+		icon     string
+		inTitle  bool
+		titleBuf strings.Builder
+	)
+
+	z := html.NewTokenizer(r)
+parsing:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			break parsing
+		case html.TextToken:
+			if inTitle {
+				titleBuf.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+				title = titleBuf.String()
+			case atom.Head:
+				break parsing
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Body:
+				break parsing
+			case atom.Title:
+				inTitle = tt == html.StartTagToken
+			case atom.Meta:
+				attrs := attributes(z, hasAttr)
+				key := strings.ToLower(attrs["property"])
+				if key == "" {
+					key = strings.ToLower(attrs["name"])
+				}
+				content := attrs["content"]
+				switch key {
+				case "og:title":
+					p.Title = content
+				case "og:description":
+					p.Description = content
+				case "og:site_name":
+					p.SiteName = content
+				case "og:image":
+					p.ImageURL = content
+				case "description":
+					desc = content
+				}
+			case atom.Link:
+				attrs := attributes(z, hasAttr)
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					// The first icon wins over later apple-touch-icons and the like
+					if rel == "icon" && icon == "" {
+						icon = attrs["href"]
+					}
+				}
+			}
+		}
+	}
+
+	if p.Title == "" {
+		p.Title = title
+	}
+	if p.Description == "" {
+		p.Description = desc
+	}
+	p.Title = clean(p.Title, maxTitleLength)
+	p.Description = clean(p.Description, maxDescriptionLength)
+	p.SiteName = clean(p.SiteName, maxTitleLength)
+	p.ImageURL = resolve(base, p.ImageURL)
+	if p.FaviconURL = resolve(base, icon); p.FaviconURL == "" {
+		// Browsers fall back to the conventional location
+		p.FaviconURL = resolve(base, "/favicon.ico")
+	}
+	return &p, nil
+}
+
+// attributes returns the attributes of the current tag by lowercase name
+func attributes(z *html.Tokenizer, more bool) map[string]string {
+	attrs := map[string]string{}
+	for more {
+		var key, val []byte
+		key, val, more = z.TagAttr()
+		attrs[strings.ToLower(string(key))] = string(val)
+	}
+	return attrs
+}
+
+// clean collapses whitespace and truncates s to at most limit runes
+func clean(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
+
+// resolve makes ref absolute against base. Only http(s) results are kept, so
+// a page cannot hand the frontend a javascript: or data: URL.
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,142 @@
+package preview
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/safehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreview(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/og":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<!doctype html><html><head>
+				<title>Fallback title</title>
+				<meta property="og:title" content="  Team   Docs ">
+				<meta property="og:description" content="Everything about the team">
+				<meta property="og:site_name" content="Example">
+				<meta property="og:image" content="/card.png">
+				<link rel="shortcut icon" href="/static/icon.png">
+				</head><body><meta property="og:title" content="ignored"></body></html>`))
+		case "/plain":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>Plain page</title>
+				<meta name="description" content="A page without Open Graph tags">
+				<link rel="icon" href="javascript:alert(1)">`))
+		case "/moved":
+			http.Redirect(w, r, "/sub/plain", http.StatusFound)
+		case "/sub/plain":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<title>Moved</title><link rel="icon" href="icon.svg">`))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	opts := safehttp.DefaultOptions()
+	opts.AllowPrivateNetworks = true
+	fetcher := New(safehttp.New(opts))
+
+	t.Run("Open Graph metadata", func(t *testing.T) {
+		p, err := fetcher.Preview(context.Background(), server.URL+"/og")
+		require.NoError(t, err)
+		assert.Equal(t, server.URL+"/og", p.URL)
+		assert.Equal(t, "Team Docs", p.Title)
+		assert.Equal(t, "Everything about the team", p.Description)
+		assert.Equal(t, "Example", p.SiteName)
+		assert.Equal(t, server.URL+"/card.png", p.ImageURL)
+		assert.Equal(t, server.URL+"/static/icon.png", p.FaviconURL)
+		assert.False(t, p.FetchedAt.IsZero())
+	})
+
+	t.Run("HTML fallbacks", func(t *testing.T) {
+		p, err := fetcher.Preview(context.Background(), server.URL+"/plain")
+		require.NoError(t, err)
+		assert.Equal(t, "Plain page", p.Title)
+		assert.Equal(t, "A page without Open Graph tags", p.Description)
+		assert.Equal(t, server.URL+"/favicon.ico", p.FaviconURL)
+	})
+
+	t.Run("Relative URLs follow redirects", func(t *testing.T) {
+		p, err := fetcher.Preview(context.Background(), server.URL+"/moved")
+		require.NoError(t, err)
+		assert.Equal(t, server.URL+"/moved", p.URL)
+		assert.Equal(t, server.URL+"/sub/icon.svg", p.FaviconURL)
+	})
+
+	t.Run("Not HTML", func(t *testing.T) {
+		_, err := fetcher.Preview(context.Background(), server.URL+"/image")
+		assert.ErrorIs(t, err, ErrNotHTML)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		_, err := fetcher.Preview(context.Background(), server.URL+"/missing")
+		assert.Error(t, err)
+	})
+
+	t.Run("Private networks are refused", func(t *testing.T) {
+		_, err := New(safehttp.New(safehttp.DefaultOptions())).Preview(context.Background(), server.URL+"/og")
+		assert.Error(t, err)
+	})
+}
+
+func TestPreviewCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<title>` + r.URL.Path + `</title>`))
+	}))
+	defer server.Close()
+
+	opts := safehttp.DefaultOptions()
+	opts.AllowPrivateNetworks = true
+	now := time.Now()
+	fetcher := New(safehttp.New(opts), WithTTL(time.Hour), WithFailureTTL(time.Minute), WithMaxEntries(2))
+	fetcher.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := fetcher.Preview(ctx, server.URL+"/a")
+	require.NoError(t, err)
+	_, err = fetcher.Preview(ctx, server.URL+"/a")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load(), "fresh previews are served from the cache")
+
+	_, err = fetcher.Preview(ctx, server.URL+"/down")
+	require.Error(t, err)
+	_, err = fetcher.Preview(ctx, server.URL+"/down")
+	require.Error(t, err)
+	assert.Equal(t, int32(2), requests.Load(), "failures are cached too")
+
+	now = now.Add(2 * time.Minute)
+	_, err = fetcher.Preview(ctx, server.URL+"/down")
+	require.Error(t, err)
+	assert.Equal(t, int32(3), requests.Load(), "failures are retried after their TTL")
+
+	// A third URL evicts the entry closest to expiry, the failure
+	_, err = fetcher.Preview(ctx, server.URL+"/b")
+	require.NoError(t, err)
+	assert.Len(t, fetcher.entries, 2)
+	assert.Contains(t, fetcher.entries, server.URL+"/a")
+
+	now = now.Add(time.Hour)
+	p, err := fetcher.Preview(ctx, server.URL+"/a")
+	require.NoError(t, err)
+	assert.Equal(t, "/a", p.Title)
+	assert.Equal(t, int32(5), requests.Load(), "expired previews are fetched again")
+}
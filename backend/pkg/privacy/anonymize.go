@@ -0,0 +1,244 @@
+// Package privacy anonymizes click events before they leave the service.
+//
+// Every sink that exports or streams events (BigQuery, webhooks) must receive
+// them through an Anonymizer, which
+//
+//   - truncates IP addresses to a network prefix, keeping a keyed hash of
+//     the full address with the same rotating salt as user IDs,
+//   - replaces user IDs with a keyed hash whose salt rotates periodically, so
+//     events can be grouped by user within a period but not linked across
+//     periods or back to the user,
+//   - coarsens the location to the configured precision, and
+//   - reduces referrers to their origin, dropping paths and queries that may
+//     carry identifiers.
+package privacy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// Precisions to which locations are coarsened
+const (
+	GeoCity    = "city"
+	GeoRegion  = "region"
+	GeoCountry = "country"
+	GeoNone    = "none"
+)
+
+// Defaults applied to zero options
+const (
+	DefaultIPv4PrefixBits = 24
+	DefaultIPv6PrefixBits = 48
+	DefaultSaltRotation   = 24 * time.Hour
+	DefaultGeoPrecision   = GeoCountry
+)
+
+// userHashPrefix marks hashed user IDs so they are never mistaken for real ones
+const userHashPrefix = "anon-"
+
+// Options configures an Anonymizer. Zero values select the defaults.
+type Options struct {
+	// Secret keys the user hashes; a random one is generated when empty, in
+	// which case hashes differ between server instances and restarts
+	Secret []byte
+	// GeoPrecision is the most precise location kept
+	GeoPrecision string
+	// SaltRotation is how long one user hash salt is used
+	SaltRotation time.Duration
+	// IPv4PrefixBits and IPv6PrefixBits are the leading bits of an address kept
+	IPv4PrefixBits int
+	IPv6PrefixBits int
+}
+
+// Anonymizer removes raw identifiers from click events
+type Anonymizer struct {
+	secret       []byte
+	geoPrecision string
+	saltRotation time.Duration
+	ipv4Mask     net.IPMask
+	ipv6Mask     net.IPMask
+}
+
+// New creates an Anonymizer, rejecting invalid options
+func New(opts Options) (*Anonymizer, error) {
+	if opts.GeoPrecision == "" {
+		opts.GeoPrecision = DefaultGeoPrecision
+	}
+	if opts.SaltRotation == 0 {
+		opts.SaltRotation = DefaultSaltRotation
+	}
+	if opts.IPv4PrefixBits == 0 {
+		opts.IPv4PrefixBits = DefaultIPv4PrefixBits
+	}
+	if opts.IPv6PrefixBits == 0 {
+		opts.IPv6PrefixBits = DefaultIPv6PrefixBits
+	}
+
+	switch opts.GeoPrecision {
+	case GeoCity, GeoRegion, GeoCountry, GeoNone:
+	default:
+		return nil, fmt.Errorf("unknown geo precision %q", opts.GeoPrecision)
+	}
+	if opts.SaltRotation < 0 {
+		return nil, fmt.Errorf("salt rotation must be positive, got %s", opts.SaltRotation)
+	}
+	// Keeping a full address would defeat truncation
+	if opts.IPv4PrefixBits < 0 || opts.IPv4PrefixBits > 24 {
+		return nil, fmt.Errorf("IPv4 prefix must be between 0 and 24 bits, got %d", opts.IPv4PrefixBits)
+	}
+	if opts.IPv6PrefixBits < 0 || opts.IPv6PrefixBits > 64 {
+		return nil, fmt.Errorf("IPv6 prefix must be between 0 and 64 bits, got %d", opts.IPv6PrefixBits)
+	}
+
+	secret := opts.Secret
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate anonymization secret: %w", err)
+		}
+	}
+
+	return &Anonymizer{
+		secret:       secret,
+		geoPrecision: opts.GeoPrecision,
+		saltRotation: opts.SaltRotation,
+		ipv4Mask:     net.CIDRMask(opts.IPv4PrefixBits, 32),
+		ipv6Mask:     net.CIDRMask(opts.IPv6PrefixBits, 128),
+	}, nil
+}
+
+// Anonymize returns a copy of the event without raw identifiers
+func (a *Anonymizer) Anonymize(event models.ClickEvent) models.ClickEvent {
+	if ip := net.ParseIP(event.IPAddress); ip != nil && event.IPHash == "" {
+		event.IPHash = a.hashIP(ip, event.Time)
+	}
+	event.IPAddress = a.truncateIP(event.IPAddress)
+	if event.UserID != "" {
+		event.UserID = a.hashUser(event.UserID, event.Time)
+	}
+	event.Referrer = referrerOrigin(event.Referrer)
+	a.coarsenGeo(&event)
+	return event
+}
+
+// AnonymizeAll anonymizes a batch of events, leaving the input untouched
+func (a *Anonymizer) AnonymizeAll(events []models.ClickEvent) []models.ClickEvent {
+	anonymized := make([]models.ClickEvent, len(events))
+	for i, event := range events {
+		anonymized[i] = a.Anonymize(event)
+	}
+	return anonymized
+}
+
+// truncateIP zeroes the host bits of an address. Unparseable values are
+// dropped rather than passed through.
+func (a *Anonymizer) truncateIP(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(a.ipv4Mask).String()
+	}
+	return ip.Mask(a.ipv6Mask).String()
+}
+
+// hashUser returns a keyed hash of the user ID with the salt of the period
+// the event happened in
+func (a *Anonymizer) hashUser(userID string, at time.Time) string {
+	mac := hmac.New(sha256.New, a.salt(at))
+	mac.Write([]byte(userID))
+	return userHashPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// hashIP returns a keyed hash of an address with the salt of the period the
+// event happened in
+func (a *Anonymizer) hashIP(ip net.IP, at time.Time) string {
+	mac := hmac.New(sha256.New, a.salt(at))
+	mac.Write([]byte("ip:"))
+	mac.Write([]byte(ip.String()))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// salt derives the salt of the rotation period containing at from the
+// secret, so every instance sharing the secret hashes alike
+func (a *Anonymizer) salt(at time.Time) []byte {
+	var period [8]byte
+	binary.BigEndian.PutUint64(period[:], uint64(at.UnixNano()/int64(a.saltRotation)))
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte("user-salt:"))
+	mac.Write(period[:])
+	return mac.Sum(nil)
+}
+
+// coarsenGeo drops location details finer than the configured precision.
+// Coordinates are rounded to about 10 km for cities and 100 km for regions.
+func (a *Anonymizer) coarsenGeo(event *models.ClickEvent) {
+	switch a.geoPrecision {
+	case GeoCity:
+		event.Latitude = roundTo(event.Latitude, 1)
+		event.Longitude = roundTo(event.Longitude, 1)
+	case GeoRegion:
+		event.City = ""
+		event.Latitude = roundTo(event.Latitude, 0)
+		event.Longitude = roundTo(event.Longitude, 0)
+	case GeoCountry:
+		event.Region, event.City = "", ""
+		event.Latitude, event.Longitude = 0, 0
+	default:
+		event.Country, event.Region, event.City = "", "", ""
+		event.Latitude, event.Longitude = 0, 0
+	}
+}
+
+// roundTo rounds v to the given number of decimal places
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// referrerOrigin reduces a referrer URL to its scheme and host
+func referrerOrigin(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Hostname()}).String()
+}
+
+// Sink receives batches of click events, such as an export or event stream
+type Sink interface {
+	Send(ctx context.Context, events []models.ClickEvent) error
+}
+
+// Wrap returns a sink that anonymizes every batch before passing it to next.
+// Exporters must only be handed wrapped sinks.
+func (a *Anonymizer) Wrap(next Sink) Sink {
+	return anonymizingSink{anonymizer: a, next: next}
+}
+
+// anonymizingSink is the anonymization stage in front of a sink
+type anonymizingSink struct {
+	anonymizer *Anonymizer
+	next       Sink
+}
+
+// Send anonymizes the events and forwards them
+func (s anonymizingSink) Send(ctx context.Context, events []models.ClickEvent) error {
+	return s.next.Send(ctx, s.anonymizer.AnonymizeAll(events))
+}
@@ -0,0 +1,179 @@
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSink keeps every batch it is sent
+type recordingSink struct {
+	batches [][]models.ClickEvent
+}
+
+func (s *recordingSink) Send(_ context.Context, events []models.ClickEvent) error {
+	s.batches = append(s.batches, events)
+	return nil
+}
+
+func rawEvent() models.ClickEvent {
+	return models.ClickEvent{
+		Time:      time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC),
+		Short:     "docs",
+		UserID:    "alice@example.com",
+		IPAddress: "203.0.113.57",
+		UserAgent: "Mozilla/5.0",
+		Referrer:  "https://wiki.example.com/people/alice?token=s3cr3t",
+		Country:   "JP",
+		Region:    "Tokyo",
+		City:      "Shibuya",
+		Latitude:  35.661777,
+		Longitude: 139.704051,
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	a, err := New(Options{Secret: []byte("test-secret")})
+	require.NoError(t, err)
+
+	got := a.Anonymize(rawEvent())
+	assert.Equal(t, "203.0.113.0", got.IPAddress)
+	assert.Regexp(t, `^[0-9a-f]{32}$`, got.IPHash)
+	assert.Regexp(t, `^anon-[0-9a-f]{32}$`, got.UserID)
+	assert.Equal(t, "https://wiki.example.com", got.Referrer)
+	assert.Equal(t, "JP", got.Country)
+	assert.Empty(t, got.Region)
+	assert.Empty(t, got.City)
+	assert.Zero(t, got.Latitude)
+	assert.Zero(t, got.Longitude)
+	assert.Equal(t, "docs", got.Short)
+	assert.Equal(t, "Mozilla/5.0", got.UserAgent)
+}
+
+func TestTruncateIP(t *testing.T) {
+	a, err := New(Options{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "198.51.100.23", want: "198.51.100.0"},
+		{addr: "::ffff:198.51.100.23", want: "198.51.100.0"},
+		{addr: "2001:db8:85a3:8d3:1319:8a2e:370:7348", want: "2001:db8:85a3::"},
+		{addr: "198.51.100.23:443", want: ""},
+		{addr: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, a.truncateIP(tt.addr))
+		})
+	}
+}
+
+func TestCoarsenGeo(t *testing.T) {
+	tests := []struct {
+		precision string
+		want      models.ClickEvent
+	}{
+		{precision: GeoCity, want: models.ClickEvent{Country: "JP", Region: "Tokyo", City: "Shibuya", Latitude: 35.7, Longitude: 139.7}},
+		{precision: GeoRegion, want: models.ClickEvent{Country: "JP", Region: "Tokyo", Latitude: 36, Longitude: 140}},
+		{precision: GeoCountry, want: models.ClickEvent{Country: "JP"}},
+		{precision: GeoNone, want: models.ClickEvent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.precision, func(t *testing.T) {
+			a, err := New(Options{GeoPrecision: tt.precision})
+			require.NoError(t, err)
+
+			event := rawEvent()
+			a.coarsenGeo(&event)
+			assert.Equal(t, tt.want.Country, event.Country)
+			assert.Equal(t, tt.want.Region, event.Region)
+			assert.Equal(t, tt.want.City, event.City)
+			assert.InDelta(t, tt.want.Latitude, event.Latitude, 1e-9)
+			assert.InDelta(t, tt.want.Longitude, event.Longitude, 1e-9)
+		})
+	}
+}
+
+func TestUserHashRotation(t *testing.T) {
+	a, err := New(Options{Secret: []byte("test-secret"), SaltRotation: 24 * time.Hour})
+	require.NoError(t, err)
+	day := time.Date(2026, 3, 14, 1, 0, 0, 0, time.UTC)
+
+	sameDay := a.hashUser("alice", day.Add(20*time.Hour))
+	assert.Equal(t, a.hashUser("alice", day), sameDay, "hashes are stable within a period")
+	assert.NotEqual(t, a.hashUser("bob", day), sameDay, "users are told apart")
+	assert.NotEqual(t, a.hashUser("alice", day.Add(24*time.Hour)), sameDay, "the salt rotates")
+
+	other, err := New(Options{Secret: []byte("other-secret")})
+	require.NoError(t, err)
+	assert.NotEqual(t, other.hashUser("alice", day), sameDay, "hashes depend on the secret")
+}
+
+func TestIPHash(t *testing.T) {
+	a, err := New(Options{Secret: []byte("test-secret")})
+	require.NoError(t, err)
+
+	first := a.Anonymize(rawEvent())
+	neighbor := rawEvent()
+	neighbor.IPAddress = "203.0.113.58"
+	second := a.Anonymize(neighbor)
+	// Addresses in one truncated network are still told apart
+	assert.Equal(t, first.IPAddress, second.IPAddress)
+	assert.NotEqual(t, first.IPHash, second.IPHash)
+	assert.Equal(t, first.IPHash, a.Anonymize(rawEvent()).IPHash)
+
+	nextDay := rawEvent()
+	nextDay.Time = nextDay.Time.Add(24 * time.Hour)
+	assert.NotEqual(t, first.IPHash, a.Anonymize(nextDay).IPHash, "the salt rotates")
+
+	unparseable := rawEvent()
+	unparseable.IPAddress = "unknown"
+	assert.Empty(t, a.Anonymize(unparseable).IPHash)
+}
+
+func TestWrapLeaksNoRawIdentifiers(t *testing.T) {
+	a, err := New(Options{GeoPrecision: GeoRegion})
+	require.NoError(t, err)
+	sink := &recordingSink{}
+
+	raw := rawEvent()
+	ipv6 := rawEvent()
+	ipv6.IPAddress = "2001:db8:85a3:8d3:1319:8a2e:370:7348"
+	events := []models.ClickEvent{raw, ipv6}
+	require.NoError(t, a.Wrap(sink).Send(context.Background(), events))
+
+	require.Len(t, sink.batches, 1)
+	sent, err := json.Marshal(sink.batches[0])
+	require.NoError(t, err)
+	for _, identifier := range []string{
+		"alice", "example.com/people", "s3cr3t", "203.0.113.57", "1319:8a2e", "Shibuya", "35.66", "139.70",
+	} {
+		assert.NotContains(t, string(sent), identifier)
+	}
+
+	// The caller's events are left untouched
+	assert.Equal(t, raw, events[0])
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"Unknown precision":  {GeoPrecision: "street"},
+		"Negative rotation":  {SaltRotation: -time.Hour},
+		"Full IPv4 address":  {IPv4PrefixBits: 32},
+		"Full IPv6 address":  {IPv6PrefixBits: 128},
+		"Negative IP prefix": {IPv4PrefixBits: -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(opts)
+			assert.Error(t, err)
+		})
+	}
+}
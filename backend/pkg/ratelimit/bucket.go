@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is a token bucket: up to Burst requests at once, refilled at Burst
+// requests per Period. The zero Rate limits nothing.
+type Rate struct {
+	Burst  int
+	Period time.Duration
+}
+
+// Enabled reports whether the rate limits anything
+func (r Rate) Enabled() bool {
+	return r.Burst > 0 && r.Period > 0
+}
+
+// String formats the rate as ParseRate reads it
+func (r Rate) String() string {
+	if !r.Enabled() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", r.Burst, r.Period)
+}
+
+// ParseRate parses a rate such as "100/1m": the burst and the period it is
+// refilled over. "0" and "" are the zero Rate.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Rate{}, nil
+	}
+	burst, period, found := strings.Cut(s, "/")
+	if !found {
+		return Rate{}, fmt.Errorf("invalid rate %q: want requests/period, such as 100/1m", s)
+	}
+	var rate Rate
+	var err error
+	if rate.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || rate.Burst < 0 {
+		return Rate{}, fmt.Errorf("invalid requests in rate %q", s)
+	}
+	if rate.Period, err = time.ParseDuration(strings.TrimSpace(period)); err != nil || rate.Period <= 0 {
+		return Rate{}, fmt.Errorf("invalid period in rate %q", s)
+	}
+	return rate, nil
+}
+
+// Decision is the outcome of taking a token from a bucket
+type Decision struct {
+	// Allowed is set when a token was taken
+	Allowed bool
+	// Remaining is the whole tokens left
+	Remaining int
+	// RetryAfter is how long until a token is available, when none was
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Limiter takes tokens from token buckets shared by the rate limiter
+type Limiter interface {
+	// Allow takes a token from the bucket of key, refilled at rate
+	Allow(ctx context.Context, key string, rate Rate) (Decision, error)
+}
+
+// decide describes a bucket of rate left with tokens
+func decide(rate Rate, tokens float64, allowed bool) Decision {
+	perToken := rate.Period / time.Duration(rate.Burst)
+	decision := Decision{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(rate.Burst) - tokens) * float64(perToken)),
+	}
+	if !allowed {
+		decision.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	return decision
+}
+
+// refill returns the tokens of a bucket of rate that held tokens elapsed ago
+func refill(rate Rate, tokens float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+	return math.Min(float64(rate.Burst), tokens+float64(rate.Burst)*elapsed.Seconds()/rate.Period.Seconds())
+}
+
+// bucket is a token bucket in memory
+type bucket struct {
+	updated time.Time
+	// full is when the bucket is full again, and can be forgotten
+	full   time.Time
+	tokens float64
+}
+
+// Allow takes a token from the bucket of key
+func (s *MemoryStore) Allow(ctx context.Context, key string, rate Rate) (Decision, error) {
+	if !rate.Enabled() {
+		return Decision{Allowed: true}, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.cleanup(now)
+
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(rate.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = refill(rate, b.tokens, now.Sub(b.updated))
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	decision := decide(rate, b.tokens, allowed)
+	b.full = now.Add(decision.Reset)
+	return decision, nil
+}
@@ -0,0 +1,127 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	rate, err := ratelimit.ParseRate("100/1m")
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.Rate{Burst: 100, Period: time.Minute}, rate)
+	assert.Equal(t, "100/1m0s", rate.String())
+
+	for _, disabled := range []string{"", "0"} {
+		rate, err := ratelimit.ParseRate(disabled)
+		require.NoError(t, err)
+		assert.False(t, rate.Enabled())
+	}
+	for _, invalid := range []string{"100", "x/1m", "100/x", "100/0s", "-1/1m"} {
+		_, err := ratelimit.ParseRate(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// limiters returns a limiter of each kind
+func limiters(t *testing.T) map[string]ratelimit.Limiter {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return map[string]ratelimit.Limiter{
+		"Memory": ratelimit.NewMemoryStore(),
+		"Redis":  ratelimit.NewRedisStore(client, "test:"),
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	rate := ratelimit.Rate{Burst: 3, Period: time.Hour}
+	for name, limiter := range limiters(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for want := 2; want >= 0; want-- {
+				decision, err := limiter.Allow(ctx, "ip:1.2.3.4", rate)
+				require.NoError(t, err)
+				assert.True(t, decision.Allowed)
+				assert.Equal(t, want, decision.Remaining)
+			}
+
+			decision, err := limiter.Allow(ctx, "ip:1.2.3.4", rate)
+			require.NoError(t, err)
+			assert.False(t, decision.Allowed, "the bucket is empty")
+			assert.Zero(t, decision.Remaining)
+			assert.InDelta(t, 20*time.Minute, decision.RetryAfter, float64(time.Minute), "one token refills in a third of the period")
+			assert.InDelta(t, time.Hour, decision.Reset, float64(time.Minute))
+
+			decision, err = limiter.Allow(ctx, "ip:5.6.7.8", rate)
+			require.NoError(t, err)
+			assert.True(t, decision.Allowed, "other keys have their own bucket")
+
+			decision, err = limiter.Allow(ctx, "ip:1.2.3.4", ratelimit.Rate{})
+			require.NoError(t, err)
+			assert.True(t, decision.Allowed, "the zero rate limits nothing")
+		})
+	}
+}
+
+func TestLimiterRefills(t *testing.T) {
+	rate := ratelimit.Rate{Burst: 2, Period: 100 * time.Millisecond}
+	for name, limiter := range limiters(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for range 2 {
+				decision, err := limiter.Allow(ctx, "user:alice", rate)
+				require.NoError(t, err)
+				require.True(t, decision.Allowed)
+			}
+			decision, err := limiter.Allow(ctx, "user:alice", rate)
+			require.NoError(t, err)
+			require.False(t, decision.Allowed)
+
+			time.Sleep(decision.RetryAfter + 10*time.Millisecond)
+			decision, err = limiter.Allow(ctx, "user:alice", rate)
+			require.NoError(t, err)
+			assert.True(t, decision.Allowed, "a token was refilled")
+		})
+	}
+}
+
+func TestRedisStoreCountsAndLocks(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	store := ratelimit.NewRedisStore(client, "test:")
+	ctx := context.Background()
+
+	for want := 1; want <= 3; want++ {
+		count, err := store.Incr(ctx, "login:alice", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, want, count)
+	}
+	server.FastForward(2 * time.Minute)
+	count, err := store.Incr(ctx, "login:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "a new window starts once the last one ends")
+
+	remaining, err := store.LockedFor(ctx, "login:alice")
+	require.NoError(t, err)
+	assert.Zero(t, remaining)
+	require.NoError(t, store.Lock(ctx, "login:alice", time.Minute))
+	remaining, err = store.LockedFor(ctx, "login:alice")
+	require.NoError(t, err)
+	assert.Greater(t, remaining, 30*time.Second)
+
+	require.NoError(t, store.Reset(ctx, "login:alice"))
+	remaining, err = store.LockedFor(ctx, "login:alice")
+	require.NoError(t, err)
+	assert.Zero(t, remaining)
+	count, err = store.Incr(ctx, "login:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// LockoutsTotal counts lockouts issued by brute-force guards
+	LockoutsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_lockouts_total",
+			Help: "Total number of temporary lockouts issued by scope",
+		},
+		[]string{"scope"},
+	)
+
+	// LockedOutRequestsTotal counts requests rejected because of an active lockout
+	LockedOutRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_locked_out_requests_total",
+			Help: "Total number of requests rejected due to an active lockout by scope",
+		},
+		[]string{"scope"},
+	)
+)
+
+// Guard throttles failed attempts per key (client IP, account, link, ...) and
+// locks a key out temporarily once it exceeds the allowed number of failures
+type Guard struct {
+	store       Store
+	scope       string
+	maxAttempts int
+	window      time.Duration
+	lockout     time.Duration
+}
+
+// NewGuard creates a Guard that locks a key for lockout after maxAttempts
+// failures within window. Keys are namespaced by scope inside the store.
+func NewGuard(store Store, scope string, maxAttempts int, window, lockout time.Duration) *Guard {
+	return &Guard{
+		store:       store,
+		scope:       scope,
+		maxAttempts: maxAttempts,
+		window:      window,
+		lockout:     lockout,
+	}
+}
+
+// key namespaces a guard key in the shared store
+func (g *Guard) key(k string) string {
+	return "guard:" + g.scope + ":" + k
+}
+
+// Check returns the longest remaining lockout among the given keys, or zero if
+// none of them is locked
+func (g *Guard) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	var longest time.Duration
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		remaining, err := g.store.LockedFor(ctx, g.key(k))
+		if err != nil {
+			return 0, err
+		}
+		if remaining > longest {
+			longest = remaining
+		}
+	}
+	if longest > 0 {
+		LockedOutRequestsTotal.WithLabelValues(g.scope).Inc()
+	}
+	return longest, nil
+}
+
+// Fail records a failed attempt for each key and locks the keys that exceeded the limit
+func (g *Guard) Fail(ctx context.Context, keys ...string) error {
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		count, err := g.store.Incr(ctx, g.key(k), g.window)
+		if err != nil {
+			return err
+		}
+		if count >= g.maxAttempts {
+			if err := g.store.Lock(ctx, g.key(k), g.lockout); err != nil {
+				return err
+			}
+			LockoutsTotal.WithLabelValues(g.scope).Inc()
+		}
+	}
+	return nil
+}
+
+// Reset clears failures and lockouts for each key, typically after a success
+func (g *Guard) Reset(ctx context.Context, keys ...string) error {
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		if err := g.store.Reset(ctx, g.key(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardLocksOutAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	guard := ratelimit.NewGuard(ratelimit.NewMemoryStore(), "test", 3, time.Minute, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, guard.Fail(ctx, "ip:1.2.3.4"))
+		remaining, err := guard.Check(ctx, "ip:1.2.3.4")
+		require.NoError(t, err)
+		assert.Zero(t, remaining, "should not be locked before reaching the limit")
+	}
+
+	require.NoError(t, guard.Fail(ctx, "ip:1.2.3.4"))
+	remaining, err := guard.Check(ctx, "ip:1.2.3.4")
+	require.NoError(t, err)
+	assert.Greater(t, remaining, time.Duration(0))
+
+	// Other keys are unaffected
+	remaining, err = guard.Check(ctx, "ip:5.6.7.8")
+	require.NoError(t, err)
+	assert.Zero(t, remaining)
+
+	// Reset lifts the lockout
+	require.NoError(t, guard.Reset(ctx, "ip:1.2.3.4"))
+	remaining, err = guard.Check(ctx, "ip:1.2.3.4")
+	require.NoError(t, err)
+	assert.Zero(t, remaining)
+}
+
+func TestMemoryStoreWindowExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := ratelimit.NewMemoryStore()
+
+	count, err := store.Incr(ctx, "k", 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = store.Incr(ctx, "k", 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	time.Sleep(30 * time.Millisecond)
+	count, err = store.Incr(ctx, "k", 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "counter should restart in a new window")
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisIncr counts in KEYS[1], starting a window of ARGV[1] milliseconds
+// with the first count
+var redisIncr = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// redisAllow takes a token from the bucket in KEYS[1] of ARGV[1] tokens
+// refilled over ARGV[2] milliseconds, at the time in ARGV[3] in
+// milliseconds. It returns whether it took a token and the tokens left,
+// as a string since Lua numbers are returned as integers.
+var redisAllow = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if not tokens then
+	tokens = burst
+	updated = now
+end
+if now > updated then
+	tokens = math.min(burst, tokens + (now - updated) * burst / period)
+	updated = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(updated))
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore is a Store and Limiter in Redis, shared by every replica
+// connected to it, so limits and lockouts hold across replicas and
+// deploys. Buckets are refilled by the clock of the replica taking a
+// token, which keeps working with Redis servers that cannot read their
+// own clock in scripts.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// Ensure RedisStore implements Store and Limiter
+var (
+	_ Store   = (*RedisStore)(nil)
+	_ Limiter = (*RedisStore)(nil)
+)
+
+// NewRedisStore creates a RedisStore keeping its keys under prefix
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Incr increments the counter for key and returns the count within the current window
+func (s *RedisStore) Incr(ctx context.Context, key string, window time.Duration) (int, error) {
+	count, err := redisIncr.Run(ctx, s.client, []string{s.prefix + "counter:" + key}, window.Milliseconds()).Int()
+	if err != nil {
+		return 0, fmt.Errorf("incrementing rate limit counter: %w", err)
+	}
+	return count, nil
+}
+
+// Reset clears the counter and lockout for key. Each key is deleted on its
+// own, since a Redis cluster keeps them in different slots.
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.prefix+"counter:"+key)
+		pipe.Del(ctx, s.prefix+"lock:"+key)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("resetting rate limit counter: %w", err)
+	}
+	return nil
+}
+
+// Lock locks key for the given duration
+func (s *RedisStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	if err := s.client.Set(ctx, s.prefix+"lock:"+key, 1, d).Err(); err != nil {
+		return fmt.Errorf("locking rate limit key: %w", err)
+	}
+	return nil
+}
+
+// LockedFor returns the remaining lockout for key, or zero if it is not locked
+func (s *RedisStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	remaining, err := s.client.PTTL(ctx, s.prefix+"lock:"+key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("reading rate limit lockout: %w", err)
+	}
+	// Missing keys have a negative TTL
+	return max(remaining, 0), nil
+}
+
+// Allow takes a token from the bucket of key
+func (s *RedisStore) Allow(ctx context.Context, key string, rate Rate) (Decision, error) {
+	if !rate.Enabled() {
+		return Decision{Allowed: true}, nil
+	}
+	result, err := redisAllow.Run(ctx, s.client, []string{s.prefix + "bucket:" + key},
+		rate.Burst, rate.Period.Milliseconds(), time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return Decision{}, fmt.Errorf("taking rate limit token: %w", err)
+	}
+	if len(result) != 2 {
+		return Decision{}, fmt.Errorf("unexpected rate limit result %v", result)
+	}
+	allowed, _ := result[0].(int64)
+	left, _ := result[1].(string)
+	tokens, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return Decision{}, fmt.Errorf("unexpected rate limit tokens %q: %w", left, err)
+	}
+	return decide(rate, tokens, allowed == 1), nil
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps fixed-window counters and lockouts shared by the rate limiter and
+// the brute-force guards
+type Store interface {
+	// Incr increments the counter for key and returns the count within the current window
+	Incr(ctx context.Context, key string, window time.Duration) (int, error)
+	// Reset clears the counter and lockout for key
+	Reset(ctx context.Context, key string) error
+	// Lock locks key for the given duration
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// LockedFor returns the remaining lockout for key, or zero if it is not locked
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+}
+
+// counter is a fixed-window counter
+type counter struct {
+	windowEnd time.Time
+	count     int
+}
+
+// MemoryStore is an in-process Store and Limiter. Counters and buckets are
+// per instance and reset on restart.
+type MemoryStore struct {
+	counters map[string]*counter
+	locks    map[string]time.Time
+	buckets  map[string]*bucket
+	mutex    sync.Mutex
+	ops      int
+}
+
+// Ensure MemoryStore implements Store and Limiter
+var (
+	_ Store   = (*MemoryStore)(nil)
+	_ Limiter = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]*counter),
+		locks:    make(map[string]time.Time),
+		buckets:  make(map[string]*bucket),
+	}
+}
+
+// Incr increments the counter for key and returns the count within the current window
+func (s *MemoryStore) Incr(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.cleanup(now)
+
+	c, exists := s.counters[key]
+	if !exists || !now.Before(c.windowEnd) {
+		c = &counter{windowEnd: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.count++
+	return c.count, nil
+}
+
+// Reset clears the counter and lockout for key
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.counters, key)
+	delete(s.locks, key)
+	return nil
+}
+
+// Lock locks key for the given duration
+func (s *MemoryStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.locks[key] = time.Now().Add(d)
+	return nil
+}
+
+// LockedFor returns the remaining lockout for key, or zero if it is not locked
+func (s *MemoryStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	until, exists := s.locks[key]
+	if !exists {
+		return 0, nil
+	}
+	remaining := time.Until(until)
+	if remaining <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+// cleanup removes expired counters, locks and full buckets every 1000
+// operations.
+// The caller must hold the mutex.
+func (s *MemoryStore) cleanup(now time.Time) {
+	s.ops++
+	if s.ops%1000 != 0 {
+		return
+	}
+	for key, c := range s.counters {
+		if !now.Before(c.windowEnd) {
+			delete(s.counters, key)
+		}
+	}
+	for key, until := range s.locks {
+		if !now.Before(until) {
+			delete(s.locks, key)
+		}
+	}
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
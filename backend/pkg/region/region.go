@@ -0,0 +1,78 @@
+// Package region decides which deployment region a request is served for,
+// so a link can send visitors to the destination of their region, such as
+// EU users to eu.wiki.company.com.
+//
+// The region comes from a header set by the load balancer, or from the
+// client's country mapped to a region, whichever the deployment configures.
+package region
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// namePattern is the form of region names: lowercase letters, digits and
+// hyphens, starting with a letter, such as "eu" or "us-east"
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// Normalize returns name as a region name, or "" if it is not one
+func Normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !namePattern.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// Resolver decides the region of a request. country is the client's ISO
+// country code, or "" when it is not known. An unknown region is "".
+type Resolver interface {
+	Region(r *http.Request, country string) string
+}
+
+// Header resolves the region from the request header of that name, as set by
+// the load balancer in front of the server
+type Header string
+
+// Region implements Resolver
+func (h Header) Region(r *http.Request, _ string) string {
+	return Normalize(r.Header.Get(string(h)))
+}
+
+// Countries resolves the region from the client's country, keyed by ISO
+// country code
+type Countries map[string]string
+
+// Region implements Resolver
+func (c Countries) Region(_ *http.Request, country string) string {
+	return c[strings.ToUpper(country)]
+}
+
+// ParseCountries parses "country=region" pairs, such as "DE=eu" and "US=us"
+func ParseCountries(pairs []string) (Countries, error) {
+	countries := make(Countries, len(pairs))
+	for _, pair := range pairs {
+		country, name, ok := strings.Cut(pair, "=")
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !ok || len(country) != 2 || Normalize(name) == "" {
+			return nil, fmt.Errorf("invalid country region %q: want a pair such as DE=eu", pair)
+		}
+		countries[country] = Normalize(name)
+	}
+	return countries, nil
+}
+
+// Chain asks each resolver in turn and returns the first region found
+type Chain []Resolver
+
+// Region implements Resolver
+func (c Chain) Region(r *http.Request, country string) string {
+	for _, resolver := range c {
+		if name := resolver.Region(r, country); name != "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package region
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvers(t *testing.T) {
+	countries, err := ParseCountries([]string{"de=EU", " FR = eu", "US=us"})
+	require.NoError(t, err)
+	assert.Equal(t, Countries{"DE": "eu", "FR": "eu", "US": "us"}, countries)
+
+	_, err = ParseCountries([]string{"Germany=eu"})
+	assert.Error(t, err)
+	_, err = ParseCountries([]string{"DE"})
+	assert.Error(t, err)
+	_, err = ParseCountries([]string{"DE=eu west"})
+	assert.Error(t, err)
+
+	resolver := Chain{Header("X-Client-Region"), countries}
+	req, _ := http.NewRequest(http.MethodGet, "/docs", nil)
+	assert.Equal(t, "eu", resolver.Region(req, "de"))
+	assert.Equal(t, "", resolver.Region(req, "JP"))
+	assert.Equal(t, "", resolver.Region(req, ""))
+
+	// The load balancer's header wins, and must name a region
+	req.Header.Set("X-Client-Region", "APAC")
+	assert.Equal(t, "apac", resolver.Region(req, "DE"))
+	req.Header.Set("X-Client-Region", "<script>")
+	assert.Equal(t, "eu", resolver.Region(req, "DE"))
+}
@@ -0,0 +1,232 @@
+// Package retention keeps analytics data from growing without bound.
+//
+// The daily clicks in link statistics are rolled up into monthly totals once
+// they are older than the daily retention, and the raw click events of links
+// are deleted once they are older than the event retention. A Job applies
+// both to every link, either once (cmd/cleanup) or periodically in the
+// background of the server.
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+)
+
+// DefaultInterval is how often the job runs in the background by default
+const DefaultInterval = 24 * time.Hour
+
+// jobName names the job in the background job metrics
+const jobName = "analytics-retention"
+
+var log = logger.For("retention")
+
+var (
+	rolledUpDays = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "golink_retention_days_rolled_up_total",
+		Help: "Total number of daily click counts rolled up into monthly totals",
+	})
+	deletedClickEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "golink_retention_click_events_deleted_total",
+		Help: "Total number of click events deleted past their retention",
+	})
+)
+
+// Policy says how long analytics data is kept in full. Zero keeps it forever.
+type Policy struct {
+	// DailyStats is how long the clicks of each day are kept before they are
+	// rolled up into the month's total
+	DailyStats time.Duration
+	// ClickEvents is how long raw click events are kept
+	ClickEvents time.Duration
+}
+
+// Enabled reports whether the policy removes anything
+func (p Policy) Enabled() bool {
+	return p.DailyStats > 0 || p.ClickEvents > 0
+}
+
+// Store lists links and updates their statistics
+type Store interface {
+	GetAll(ctx context.Context) ([]*models.Link, error)
+	GetLinkStats(ctx context.Context, short string) (*models.LinkStats, error)
+	UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) error
+}
+
+// ClickEvents deletes the click events of a link
+type ClickEvents interface {
+	// DeleteBefore deletes the click events of a link before before and
+	// returns how many it deleted
+	DeleteBefore(ctx context.Context, short string, before time.Time) (int, error)
+}
+
+// Result counts what one run of the job removed
+type Result struct {
+	Links         int
+	RolledUpDays  int
+	DeletedEvents int
+}
+
+// Option configures a Job
+type Option func(*Job)
+
+// WithInterval sets how often the job runs in the background
+func WithInterval(interval time.Duration) Option {
+	return func(j *Job) {
+		if interval > 0 {
+			j.interval = interval
+		}
+	}
+}
+
+// WithClickEvents deletes the click events past the policy's retention from
+// events. Without it click events are left alone.
+func WithClickEvents(events ClickEvents) Option {
+	return func(j *Job) {
+		j.events = events
+	}
+}
+
+// Job applies a retention policy to the analytics data of every link
+type Job struct {
+	store    Store
+	events   ClickEvents
+	policy   Policy
+	now      func() time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+	interval time.Duration
+}
+
+// NewJob creates a job applying policy to the links of store
+func NewJob(store Store, policy Policy, opts ...Option) *Job {
+	j := &Job{
+		store:    store,
+		policy:   policy,
+		now:      time.Now,
+		interval: DefaultInterval,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// Run applies the policy to every link once. A link that fails is logged and
+// skipped, so one bad link does not hold back the others.
+func (j *Job) Run(ctx context.Context) (Result, error) {
+	var result Result
+	if !j.policy.Enabled() {
+		return result, nil
+	}
+	links, err := j.store.GetAll(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	now := j.now().UTC()
+	for _, link := range links {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Links++
+		if j.policy.DailyStats > 0 {
+			days, err := j.rollUp(ctx, link.Short, now.Add(-j.policy.DailyStats))
+			if err != nil {
+				log.Error("Failed to roll up daily clicks", err, logger.Fields{"short": link.Short})
+			}
+			result.RolledUpDays += days
+		}
+		if j.policy.ClickEvents > 0 && j.events != nil {
+			deleted, err := j.events.DeleteBefore(ctx, link.Short, now.Add(-j.policy.ClickEvents))
+			if err != nil {
+				log.Error("Failed to delete old click events", err, logger.Fields{"short": link.Short})
+			}
+			result.DeletedEvents += deleted
+			deletedClickEvents.Add(float64(deleted))
+		}
+	}
+
+	log.Info("Applied analytics retention", logger.Fields{
+		"links":         result.Links,
+		"rolledUpDays":  result.RolledUpDays,
+		"deletedEvents": result.DeletedEvents,
+	})
+	return result, nil
+}
+
+// rollUp rolls the daily clicks of a link before cutoff's month up into
+// monthly totals. Statistics with nothing to roll up are not written.
+func (j *Job) rollUp(ctx context.Context, short string, cutoff time.Time) (int, error) {
+	stats, err := j.store.GetLinkStats(ctx, short)
+	if err != nil {
+		// Links that were never clicked may have no stats at all
+		if errors.Is(err, errors.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if stats.Clone().RollUp(cutoff) == 0 {
+		return 0, nil
+	}
+
+	var days int
+	if err := j.store.UpdateLinkStats(ctx, short, func(stats *models.LinkStats) {
+		days = stats.RollUp(cutoff)
+	}); err != nil {
+		return 0, err
+	}
+	rolledUpDays.Add(float64(days))
+	return days, nil
+}
+
+// Start applies the policy in the background until Stop. The first run
+// starts right away.
+func (j *Job) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.done = make(chan struct{})
+	go j.run(ctx)
+	return nil
+}
+
+// Stop ends the background runs, waiting for the current one to finish
+func (j *Job) Stop(ctx context.Context) error {
+	if j.cancel == nil {
+		return nil
+	}
+	j.cancel()
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run applies the policy once per interval
+func (j *Job) run(ctx context.Context) {
+	defer close(j.done)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := j.Run(ctx); ctx.Err() == nil {
+			jobs.Record(jobName, err)
+			if err != nil {
+				log.Error("Failed to apply analytics retention", err, logger.Fields{"job": jobName})
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// fakeStore keeps links and their statistics in maps
+type fakeStore struct {
+	stats   map[string]*models.LinkStats
+	links   []*models.Link
+	updates int
+}
+
+func (f *fakeStore) GetAll(ctx context.Context) ([]*models.Link, error) {
+	return f.links, nil
+}
+
+func (f *fakeStore) GetLinkStats(ctx context.Context, short string) (*models.LinkStats, error) {
+	stats, ok := f.stats[short]
+	if !ok {
+		return nil, errors.NewNotFound(fmt.Sprintf("Stats for link '%s' not found", short))
+	}
+	return stats.Clone(), nil
+}
+
+func (f *fakeStore) UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) error {
+	f.updates++
+	update(f.stats[short])
+	return nil
+}
+
+// fakeEvents keeps the times of click events by link
+type fakeEvents map[string][]time.Time
+
+func (f fakeEvents) DeleteBefore(ctx context.Context, short string, before time.Time) (int, error) {
+	var kept []time.Time
+	for _, at := range f[short] {
+		if !at.Before(before) {
+			kept = append(kept, at)
+		}
+	}
+	deleted := len(f[short]) - len(kept)
+	f[short] = kept
+	return deleted, nil
+}
+
+func TestJobRun(t *testing.T) {
+	now := time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)
+	old := models.NewLinkStats("old")
+	old.ClicksByDate = map[string]int{"2026-01-10": 2, "2026-02-01": 1, "2026-04-30": 5}
+	recent := models.NewLinkStats("recent")
+	recent.ClicksByDate = map[string]int{"2026-04-01": 3}
+	store := &fakeStore{
+		links: []*models.Link{
+			models.NewLink("old", "https://example.com/old", "user1"),
+			models.NewLink("recent", "https://example.com/recent", "user1"),
+			models.NewLink("unclicked", "https://example.com/unclicked", "user1"),
+		},
+		stats: map[string]*models.LinkStats{"old": old, "recent": recent},
+	}
+	events := fakeEvents{"old": {now.AddDate(0, 0, -40), now.AddDate(0, 0, -10)}}
+
+	job := NewJob(store, Policy{DailyStats: 60 * 24 * time.Hour, ClickEvents: 30 * 24 * time.Hour}, WithClickEvents(events))
+	job.now = func() time.Time { return now }
+	result, err := job.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Result{Links: 3, RolledUpDays: 2, DeletedEvents: 1}, result)
+	assert.Equal(t, map[string]int{"2026-01": 2, "2026-02": 1}, old.ClicksByMonth)
+	assert.Equal(t, map[string]int{"2026-04-30": 5}, old.ClicksByDate)
+	assert.Equal(t, 1, store.updates, "statistics with nothing to roll up are not written")
+	assert.Len(t, events["old"], 1)
+
+	// A policy keeping everything leaves the data alone
+	result, err = NewJob(store, Policy{}).Run(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, result)
+}
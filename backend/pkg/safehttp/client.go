@@ -0,0 +1,234 @@
+// Package safehttp provides an HTTP client for fetching user-supplied URLs.
+//
+// Every outbound request made on behalf of a link (previews, titles, link
+// checks, reputation lookups) must go through this package so that a link
+// cannot be used to reach the server's own network. The client:
+//
+//   - rejects non-http(s) URLs and hostnames such as localhost or *.internal,
+//   - checks the resolved IP of every connection, so DNS rebinding cannot
+//     swap a public address for a private one after validation,
+//   - re-validates every redirect and caps how many are followed,
+//   - bounds the total time of a request and the size of response bodies.
+//
+// When an egress proxy is configured the proxy makes the connection, so the
+// destination is additionally resolved locally and refused if any of its
+// addresses is private. Lookup failures are ignored in that case because the
+// proxy may be the only component able to resolve external names.
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Default limits for outbound requests
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultMaxRedirects = 5
+	DefaultMaxBodyBytes = 1 << 20 // 1 MiB
+)
+
+// Errors returned for requests the client refuses to make or finish
+var (
+	ErrSchemeNotAllowed = errors.New("safehttp: only http and https URLs may be fetched")
+	ErrBlockedHost      = errors.New("safehttp: host is not allowed")
+	ErrBlockedAddress   = errors.New("safehttp: address is not allowed")
+	ErrTooManyRedirects = errors.New("safehttp: too many redirects")
+	ErrBodyTooLarge     = errors.New("safehttp: response body too large")
+)
+
+// Options configures a Client. Zero limits fall back to the defaults.
+type Options struct {
+	Timeout      time.Duration
+	MaxBodyBytes int64
+	MaxRedirects int
+	// UserAgent is sent with every request when set
+	UserAgent string
+	// Proxy selects an egress proxy per request, as in http.Transport.
+	// Connections to the proxies it returns are exempt from the address check.
+	Proxy func(*http.Request) (*url.URL, error)
+	// AllowPrivateNetworks disables the host and address checks. It exists for
+	// tests against local servers and must not be enabled in production.
+	AllowPrivateNetworks bool
+}
+
+// DefaultOptions returns the options used when none are configured
+func DefaultOptions() Options {
+	return Options{
+		Timeout:      DefaultTimeout,
+		MaxBodyBytes: DefaultMaxBodyBytes,
+		MaxRedirects: DefaultMaxRedirects,
+		UserAgent:    "golink",
+	}
+}
+
+// Client fetches untrusted URLs with SSRF protections applied
+type Client struct {
+	client *http.Client
+	opts   Options
+	// proxies holds the host:port of every proxy handed to the transport
+	proxies sync.Map
+}
+
+// New creates a Client with the given options
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.MaxRedirects < 0 {
+		opts.MaxRedirects = 0
+	}
+
+	c := &Client{opts: opts}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.Timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	guarded := *dialer
+	if !opts.AllowPrivateNetworks {
+		guarded.Control = func(network, address string, _ syscall.RawConn) error {
+			return checkDialAddress(address)
+		}
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if _, isProxy := c.proxies.Load(address); isProxy {
+				return dialer.DialContext(ctx, network, address)
+			}
+			return guarded.DialContext(ctx, network, address)
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+	}
+	if opts.Proxy != nil {
+		transport.Proxy = c.proxy
+	}
+
+	c.client = &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return c.checkURL(req.URL)
+		},
+	}
+	return c
+}
+
+// Get fetches rawURL. The caller must close the response body, which fails
+// with ErrBodyTooLarge once more than the configured maximum has been read.
+func (c *Client) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req after validating its URL; see Get for how the body is bounded
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if err := c.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+	if c.opts.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: c.opts.MaxBodyBytes}
+	return resp, nil
+}
+
+// proxy selects the egress proxy for req. A proxied destination is resolved
+// here because the address check at dial time only sees the proxy.
+func (c *Client) proxy(req *http.Request) (*url.URL, error) {
+	proxyURL, err := c.opts.Proxy(req)
+	if err != nil || proxyURL == nil {
+		return proxyURL, err
+	}
+
+	if !c.opts.AllowPrivateNetworks {
+		addrs, err := net.DefaultResolver.LookupNetIP(req.Context(), "ip", req.URL.Hostname())
+		if err == nil {
+			for _, addr := range addrs {
+				if err := CheckAddr(addr); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	c.proxies.Store(canonicalHostPort(proxyURL), struct{}{})
+	return proxyURL, nil
+}
+
+// canonicalHostPort returns host:port for a proxy URL, filling in the default port
+func canonicalHostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// checkURL validates the scheme and hostname of a URL about to be requested
+func (c *Client) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: %q", ErrSchemeNotAllowed, u.Scheme)
+	}
+	if c.opts.AllowPrivateNetworks {
+		return nil
+	}
+	return CheckHostname(u.Hostname())
+}
+
+// limitedBody fails reads once more than remaining bytes have been consumed,
+// rather than silently truncating a body the caller would then misparse
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+// Read reads from the body, returning ErrBodyTooLarge past the limit
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// Read one byte past the limit to tell an exact fit from an overflow
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,181 @@
+package safehttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHostname(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		wantErr error
+	}{
+		{name: "Public name", host: "example.com"},
+		{name: "Trailing dot", host: "example.com."},
+		{name: "Public IP", host: "93.184.216.34"},
+		{name: "Localhost", host: "localhost", wantErr: ErrBlockedHost},
+		{name: "Localhost uppercase", host: "LOCALHOST.", wantErr: ErrBlockedHost},
+		{name: "Localhost subdomain", host: "app.localhost", wantErr: ErrBlockedHost},
+		{name: "Metadata name", host: "metadata.google.internal", wantErr: ErrBlockedHost},
+		{name: "mDNS name", host: "printer.local", wantErr: ErrBlockedHost},
+		{name: "Dotless name", host: "intranet", wantErr: ErrBlockedHost},
+		{name: "Empty", host: "", wantErr: ErrBlockedHost},
+		{name: "Loopback IP", host: "127.0.0.1", wantErr: ErrBlockedAddress},
+		{name: "IPv6 loopback", host: "::1", wantErr: ErrBlockedAddress},
+		{name: "Bracketed IPv6 loopback", host: "[::1]", wantErr: ErrBlockedAddress},
+		{name: "Metadata IP", host: "169.254.169.254", wantErr: ErrBlockedAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckHostname(tt.host)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCheckAddr(t *testing.T) {
+	blocked := []string{
+		"0.0.0.0", "10.1.2.3", "100.64.0.1", "127.0.0.1", "169.254.169.254", "172.16.0.1",
+		"192.168.1.1", "198.18.0.1", "224.0.0.1", "255.255.255.255",
+		"::", "::1", "::ffff:127.0.0.1", "::ffff:10.0.0.1", "fc00::1", "fe80::1", "ff02::1", "64:ff9b::a00:1",
+	}
+	for _, s := range blocked {
+		assert.ErrorIs(t, CheckAddr(netip.MustParseAddr(s)), ErrBlockedAddress, s)
+	}
+
+	allowed := []string{"8.8.8.8", "93.184.216.34", "2606:4700:4700::1111"}
+	for _, s := range allowed {
+		assert.NoError(t, CheckAddr(netip.MustParseAddr(s)), s)
+	}
+}
+
+func TestClientRejectsUnsafeURLs(t *testing.T) {
+	client := New(DefaultOptions())
+	ctx := context.Background()
+
+	_, err := client.Get(ctx, "file:///etc/passwd")
+	assert.ErrorIs(t, err, ErrSchemeNotAllowed)
+
+	_, err = client.Get(ctx, "http://localhost:8080/")
+	assert.ErrorIs(t, err, ErrBlockedHost)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err = client.Get(ctx, server.URL)
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+
+	// Bypass the URL check to prove the dialer refuses a resolved private address
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	_, err = client.client.Transport.RoundTrip(req)
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+}
+
+func TestClientRedirectLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/file":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		default:
+			_, _ = io.WriteString(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	opts := DefaultOptions()
+	opts.AllowPrivateNetworks = true
+	opts.MaxRedirects = 2
+	client := New(opts)
+	ctx := context.Background()
+
+	resp, err := client.Get(ctx, server.URL+"/ok")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	resp.Body.Close()
+
+	_, err = client.Get(ctx, server.URL+"/loop")
+	assert.ErrorIs(t, err, ErrTooManyRedirects)
+
+	_, err = client.Get(ctx, server.URL+"/file")
+	assert.ErrorIs(t, err, ErrSchemeNotAllowed)
+}
+
+func TestClientBodyLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("a", 100))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		limit   int64
+		wantErr bool
+	}{
+		{name: "Within limit", limit: 1000},
+		{name: "Exact fit", limit: 100},
+		{name: "Too large", limit: 99, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := New(Options{AllowPrivateNetworks: true, MaxBodyBytes: tt.limit})
+			resp, err := client.Get(context.Background(), server.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBodyTooLarge)
+				assert.LessOrEqual(t, int64(len(body)), tt.limit)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, body, 100)
+		})
+	}
+}
+
+func TestClientThroughProxy(t *testing.T) {
+	// The proxy runs on loopback, which the client must still be able to reach
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "proxied "+r.URL.String())
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	opts := DefaultOptions()
+	opts.Proxy = http.ProxyURL(proxyURL)
+	client := New(opts)
+	ctx := context.Background()
+
+	resp, err := client.Get(ctx, "http://upstream.invalid/page")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "proxied http://upstream.invalid/page", string(body))
+
+	_, err = client.Get(ctx, "http://10.0.0.1/")
+	assert.ErrorIs(t, err, ErrBlockedAddress, "destinations are still checked when proxied")
+}
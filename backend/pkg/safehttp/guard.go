@@ -0,0 +1,106 @@
+package safehttp
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// blockedHostnames are names that resolve to the local machine or to cloud
+// metadata services regardless of what DNS says
+var blockedHostnames = map[string]bool{
+	"localhost":                true,
+	"localhost.localdomain":    true,
+	"ip6-localhost":            true,
+	"ip6-loopback":             true,
+	"metadata":                 true,
+	"metadata.google.internal": true,
+	"instance-data":            true,
+}
+
+// blockedHostSuffixes are domains reserved for loopback or private use
+var blockedHostSuffixes = []string{
+	".localhost",
+	".local",
+	".internal",
+	".home.arpa",
+}
+
+// blockedPrefixes lists non-public ranges that netip's helpers do not cover
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, can embed private IPv4
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// CheckHostname rejects hostnames that refer to the local machine or private
+// infrastructure by name. IP literals are checked with CheckAddr.
+func CheckHostname(host string) error {
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	if name == "" {
+		return fmt.Errorf("%w: empty host", ErrBlockedHost)
+	}
+
+	if addr, err := netip.ParseAddr(strings.Trim(name, "[]")); err == nil {
+		return CheckAddr(addr)
+	}
+
+	if blockedHostnames[name] {
+		return fmt.Errorf("%w: %s", ErrBlockedHost, host)
+	}
+	for _, suffix := range blockedHostSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return fmt.Errorf("%w: %s", ErrBlockedHost, host)
+		}
+	}
+	// A dotless name is resolved through the local search domains
+	if !strings.Contains(name, ".") {
+		return fmt.Errorf("%w: %s is not a fully qualified name", ErrBlockedHost, host)
+	}
+	return nil
+}
+
+// CheckAddr rejects loopback, private, link-local (including cloud metadata at
+// 169.254.169.254), multicast and otherwise non-public addresses
+func CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+		}
+	}
+	return nil
+}
+
+// checkDialAddress checks the address a connection is about to be made to.
+// It runs after DNS resolution, so a name that passed CheckHostname but
+// resolves (or re-resolves) to a private address is still refused.
+func checkDialAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	return CheckAddr(addr)
+}
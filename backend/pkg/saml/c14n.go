@@ -0,0 +1,155 @@
+package saml
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// algExcC14N is Exclusive XML Canonicalization without comments, the only
+// canonicalization signatures may use
+const algExcC14N = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+// canonicalize writes the subtree of e in Exclusive XML Canonicalization,
+// leaving out the element omit (the signature of an enveloped signature).
+// Namespaces are declared where they are first used, and the prefixes of
+// inclusive, "#default" standing for the default namespace, wherever they
+// are in scope.
+func canonicalize(e, omit *element, inclusive []string) (string, error) {
+	var b strings.Builder
+	c := canonicalizer{b: &b, omit: omit, inclusive: map[string]bool{}}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		c.inclusive[prefix] = true
+	}
+	if err := c.element(e, map[string]string{}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+type canonicalizer struct {
+	b         *strings.Builder
+	omit      *element
+	inclusive map[string]bool
+}
+
+// element writes e, given the namespaces declared by its output ancestors
+func (c canonicalizer) element(e *element, rendered map[string]string) error {
+	// Namespaces e uses, and the inclusive ones in scope
+	used := map[string]bool{e.prefix: true}
+	for _, a := range e.attrs {
+		if a.prefix != "" && a.prefix != "xml" {
+			used[a.prefix] = true
+		}
+	}
+	for prefix := range c.inclusive {
+		if _, ok := e.lookupNamespace(prefix); ok {
+			used[prefix] = true
+		}
+	}
+
+	declared := map[string]string{}
+	for prefix := range used {
+		space, ok := e.lookupNamespace(prefix)
+		if !ok {
+			return fmt.Errorf("undeclared namespace prefix %q", prefix)
+		}
+		if rendered[prefix] != space {
+			declared[prefix] = space
+		}
+	}
+	if len(declared) > 0 {
+		rendered = maps.Clone(rendered)
+		for prefix, space := range declared {
+			rendered[prefix] = space
+		}
+	}
+
+	name := e.local
+	if e.prefix != "" {
+		name = e.prefix + ":" + e.local
+	}
+	c.b.WriteString("<" + name)
+	prefixes := make([]string, 0, len(declared))
+	for prefix := range declared {
+		prefixes = append(prefixes, prefix)
+	}
+	slices.Sort(prefixes)
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			c.b.WriteString(` xmlns="` + escapeAttr(declared[prefix]) + `"`)
+		} else {
+			c.b.WriteString(" xmlns:" + prefix + `="` + escapeAttr(declared[prefix]) + `"`)
+		}
+	}
+
+	// Attributes in order of namespace, then local name
+	type qualified struct {
+		attr
+		space string
+	}
+	attrs := make([]qualified, 0, len(e.attrs))
+	for _, a := range e.attrs {
+		var space string
+		if a.prefix != "" {
+			space, _ = e.lookupNamespace(a.prefix)
+		}
+		attrs = append(attrs, qualified{attr: a, space: space})
+	}
+	slices.SortFunc(attrs, func(a, b qualified) int {
+		if n := strings.Compare(a.space, b.space); n != 0 {
+			return n
+		}
+		return strings.Compare(a.local, b.local)
+	})
+	for _, a := range attrs {
+		c.b.WriteString(" ")
+		if a.prefix != "" {
+			c.b.WriteString(a.prefix + ":")
+		}
+		c.b.WriteString(a.local + `="` + escapeAttr(a.value) + `"`)
+	}
+	c.b.WriteString(">")
+
+	for _, child := range e.children {
+		switch child := child.(type) {
+		case *element:
+			if child == c.omit {
+				continue
+			}
+			if err := c.element(child, rendered); err != nil {
+				return err
+			}
+		case string:
+			c.b.WriteString(escapeText(child))
+		case procInst:
+			c.b.WriteString("<?" + child.target)
+			if child.inst != "" {
+				c.b.WriteString(" " + child.inst)
+			}
+			c.b.WriteString("?>")
+		}
+	}
+	c.b.WriteString("</" + name + ">")
+	return nil
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// escapeText escapes character data as canonical XML does
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// escapeAttr escapes an attribute value as canonical XML does
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
@@ -0,0 +1,431 @@
+// Package saml signs users in through a SAML 2.0 identity provider, for
+// organizations whose single sign-on only speaks SAML.
+//
+// Only what a service provider needs for that is implemented: its metadata,
+// authentication requests over the HTTP-Redirect binding, and responses over
+// the HTTP-POST binding. Requests are not signed. Responses must answer a
+// request the service provider made, and the response or its assertion must
+// carry an enveloped RSA signature, canonicalized with Exclusive XML
+// Canonicalization, from a certificate of the identity provider's metadata.
+// Encrypted assertions and single logout are not supported.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+)
+
+// MaxClockSkew is how far the clocks of the identity provider and the
+// service provider may disagree on the validity of an assertion
+const MaxClockSkew = 3 * time.Minute
+
+// Protocol values
+const (
+	bindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer    = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// IdentityProvider is the identity provider users sign in with, as its
+// metadata describes it
+type IdentityProvider struct {
+	// EntityID identifies the identity provider; it issues the assertions
+	EntityID string
+	// SSOURL is where authentication requests are redirected to
+	SSOURL string
+	// Certificates sign the responses; several are listed while rotating
+	Certificates []*x509.Certificate
+}
+
+// LoadIdentityProvider reads the metadata of an identity provider from a file
+func LoadIdentityProvider(path string) (*IdentityProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity provider metadata: %w", err)
+	}
+	return ParseIdentityProvider(data)
+}
+
+// ParseIdentityProvider reads the metadata of an identity provider: its
+// entity ID, its single sign-on service for the HTTP-Redirect binding and
+// its signing certificates
+func ParseIdentityProvider(metadata []byte) (*IdentityProvider, error) {
+	root, err := parseXML(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if !root.is(nsMetadata, "EntityDescriptor") {
+		return nil, errors.New("identity provider metadata must be an EntityDescriptor")
+	}
+	descriptor := root.child(nsMetadata, "IDPSSODescriptor")
+	if descriptor == nil {
+		return nil, errors.New("metadata does not describe an identity provider")
+	}
+
+	idp := &IdentityProvider{EntityID: root.attr("entityID")}
+	for _, service := range descriptor.childElements(nsMetadata, "SingleSignOnService") {
+		if service.attr("Binding") == bindingRedirect {
+			idp.SSOURL = service.attr("Location")
+			break
+		}
+	}
+	for _, key := range descriptor.childElements(nsMetadata, "KeyDescriptor") {
+		if use := key.attr("use"); use != "" && use != "signing" {
+			continue
+		}
+		keyInfo := key.child(nsDSig, "KeyInfo")
+		if keyInfo == nil {
+			continue
+		}
+		for _, data := range keyInfo.childElements(nsDSig, "X509Data") {
+			for _, encoded := range data.childElements(nsDSig, "X509Certificate") {
+				der, err := decodeBase64(encoded.text())
+				if err != nil {
+					return nil, fmt.Errorf("malformed identity provider certificate: %w", err)
+				}
+				certificate, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, fmt.Errorf("malformed identity provider certificate: %w", err)
+				}
+				idp.Certificates = append(idp.Certificates, certificate)
+			}
+		}
+	}
+
+	switch {
+	case idp.EntityID == "":
+		return nil, errors.New("identity provider metadata has no entityID")
+	case idp.SSOURL == "":
+		return nil, errors.New("identity provider has no single sign-on service for the HTTP-Redirect binding")
+	case len(idp.Certificates) == 0:
+		return nil, errors.New("identity provider metadata has no signing certificate")
+	}
+	return idp, nil
+}
+
+// ServiceProvider is this service as a SAML service provider
+type ServiceProvider struct {
+	idp *IdentityProvider
+	now func() time.Time
+	// EntityID identifies the service provider to the identity provider
+	EntityID string
+	// ACSURL is the assertion consumer service the identity provider posts
+	// its responses to
+	ACSURL string
+}
+
+// New creates a service provider identified by entityID, receiving responses
+// at acsURL, for users of idp
+func New(entityID, acsURL string, idp *IdentityProvider) *ServiceProvider {
+	return &ServiceProvider{EntityID: entityID, ACSURL: acsURL, idp: idp, now: time.Now}
+}
+
+// metadata is the SP metadata document
+type metadata struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	SP       struct {
+		AuthnRequestsSigned  bool   `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned bool   `xml:"WantAssertionsSigned,attr"`
+		Protocols            string `xml:"protocolSupportEnumeration,attr"`
+		ACS                  struct {
+			Binding   string `xml:"Binding,attr"`
+			Location  string `xml:"Location,attr"`
+			Index     int    `xml:"index,attr"`
+			IsDefault bool   `xml:"isDefault,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+// Metadata returns the metadata document identity providers are configured
+// with
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	var m metadata
+	m.EntityID = sp.EntityID
+	m.SP.WantAssertionsSigned = true
+	m.SP.Protocols = nsProtocol
+	m.SP.ACS.Binding = bindingPOST
+	m.SP.ACS.Location = sp.ACSURL
+	m.SP.ACS.IsDefault = true
+
+	data, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// authnRequest is an authentication request
+type authnRequest struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID           string   `xml:"ID,attr"`
+	Version      string   `xml:"Version,attr"`
+	IssueInstant string   `xml:"IssueInstant,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	ACSURL       string   `xml:"AssertionConsumerServiceURL,attr"`
+	Binding      string   `xml:"ProtocolBinding,attr"`
+	Issuer       struct {
+		XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+		Value   string   `xml:",chardata"`
+	}
+}
+
+// AuthnRequestURL returns the URL of the identity provider that asks it to
+// authenticate a user, and the ID of the request, which the response must
+// answer. relayState is sent back with the response.
+func (sp *ServiceProvider) AuthnRequestURL(relayState string) (redirectURL, requestID string, err error) {
+	requestID, err = newID()
+	if err != nil {
+		return "", "", err
+	}
+	request := authnRequest{
+		ID:           requestID,
+		Version:      "2.0",
+		IssueInstant: sp.now().UTC().Format(time.RFC3339),
+		Destination:  sp.idp.SSOURL,
+		ACSURL:       sp.ACSURL,
+		Binding:      bindingPOST,
+	}
+	request.Issuer.Value = sp.EntityID
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The HTTP-Redirect binding deflates the request
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return "", "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", "", err
+	}
+
+	u, err := url.Parse(sp.idp.SSOURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid single sign-on URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		query.Set("RelayState", relayState)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), requestID, nil
+}
+
+// newID returns a random ID for a request; IDs may not start with a digit
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// Assertion is what the identity provider asserts about the user
+type Assertion struct {
+	// Attributes holds the values of each attribute, by name and by
+	// friendly name
+	Attributes map[string][]string
+	// NameID identifies the user at the identity provider
+	NameID string
+	// SessionIndex identifies the user's session at the identity provider
+	SessionIndex string
+}
+
+// Attribute returns the first value of the first of names the assertion has
+func (a *Assertion) Attribute(names ...string) string {
+	for _, name := range names {
+		if values := a.Attributes[name]; len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// ParseResponse validates a base64-encoded response posted to the assertion
+// consumer service in answer to the request with requestID, and returns its
+// assertion
+func (sp *ServiceProvider) ParseResponse(encoded, requestID string) (*Assertion, error) {
+	if requestID == "" {
+		return nil, errors.New("no request to answer")
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed response encoding: %w", err)
+	}
+	response, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := response.ids(); err != nil {
+		return nil, err
+	}
+
+	if !response.is(nsProtocol, "Response") || response.attr("Version") != "2.0" {
+		return nil, errors.New("not a SAML 2.0 response")
+	}
+	if destination := response.attr("Destination"); destination != "" && destination != sp.ACSURL {
+		return nil, fmt.Errorf("response is for %q", destination)
+	}
+	if response.attr("InResponseTo") != requestID {
+		return nil, errors.New("response does not answer the request")
+	}
+	if issuer := response.child(nsAssertion, "Issuer"); issuer != nil && issuer.text() != sp.idp.EntityID {
+		return nil, fmt.Errorf("response is issued by %q", issuer.text())
+	}
+	if err := checkStatus(response); err != nil {
+		return nil, err
+	}
+
+	if response.child(nsAssertion, "EncryptedAssertion") != nil {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := response.childElements(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("response must have exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	// The response or the assertion must be signed, and any signature valid
+	responseErr := verifySignature(response, sp.idp.Certificates)
+	if responseErr != nil && !errors.Is(responseErr, errNotSigned) {
+		return nil, fmt.Errorf("invalid response signature: %w", responseErr)
+	}
+	assertionErr := verifySignature(assertion, sp.idp.Certificates)
+	if assertionErr != nil && !errors.Is(assertionErr, errNotSigned) {
+		return nil, fmt.Errorf("invalid assertion signature: %w", assertionErr)
+	}
+	if responseErr != nil && assertionErr != nil {
+		return nil, errors.New("neither the response nor its assertion is signed")
+	}
+
+	return sp.readAssertion(assertion, requestID)
+}
+
+// checkStatus fails unless the response reports success
+func checkStatus(response *element) error {
+	var code string
+	if status := response.child(nsProtocol, "Status"); status != nil {
+		if statusCode := status.child(nsProtocol, "StatusCode"); statusCode != nil {
+			code = statusCode.attr("Value")
+		}
+	}
+	if code != statusSuccess {
+		return fmt.Errorf("identity provider did not authenticate the user: %s", code)
+	}
+	return nil
+}
+
+// readAssertion validates a signed assertion and reads it
+func (sp *ServiceProvider) readAssertion(assertion *element, requestID string) (*Assertion, error) {
+	now := sp.now()
+	if issuer := assertion.child(nsAssertion, "Issuer"); issuer == nil || issuer.text() != sp.idp.EntityID {
+		return nil, errors.New("assertion is not issued by the identity provider")
+	}
+
+	subject := assertion.child(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, errors.New("assertion without a subject")
+	}
+	nameID := subject.child(nsAssertion, "NameID")
+	if nameID == nil || nameID.text() == "" {
+		return nil, errors.New("assertion without a NameID")
+	}
+	if !sp.confirmed(subject, requestID, now) {
+		return nil, errors.New("assertion subject is not confirmed for this service")
+	}
+
+	if conditions := assertion.child(nsAssertion, "Conditions"); conditions != nil {
+		if err := checkValidity(conditions, now); err != nil {
+			return nil, err
+		}
+		for _, restriction := range conditions.childElements(nsAssertion, "AudienceRestriction") {
+			audiences := restriction.childElements(nsAssertion, "Audience")
+			if !slices.ContainsFunc(audiences, func(audience *element) bool { return audience.text() == sp.EntityID }) {
+				return nil, errors.New("assertion is for another audience")
+			}
+		}
+	}
+
+	result := &Assertion{NameID: nameID.text(), Attributes: map[string][]string{}}
+	if statement := assertion.child(nsAssertion, "AuthnStatement"); statement != nil {
+		result.SessionIndex = statement.attr("SessionIndex")
+	}
+	for _, statement := range assertion.childElements(nsAssertion, "AttributeStatement") {
+		for _, attribute := range statement.childElements(nsAssertion, "Attribute") {
+			var values []string
+			for _, value := range attribute.childElements(nsAssertion, "AttributeValue") {
+				values = append(values, value.text())
+			}
+			for _, name := range []string{attribute.attr("Name"), attribute.attr("FriendlyName")} {
+				if name != "" {
+					result.Attributes[name] = append(result.Attributes[name], values...)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// confirmed reports whether a bearer confirmation of subject lets it be
+// used in answer to requestID at the assertion consumer service
+func (sp *ServiceProvider) confirmed(subject *element, requestID string, now time.Time) bool {
+	for _, confirmation := range subject.childElements(nsAssertion, "SubjectConfirmation") {
+		if confirmation.attr("Method") != methodBearer {
+			continue
+		}
+		data := confirmation.child(nsAssertion, "SubjectConfirmationData")
+		if data == nil || data.attr("Recipient") != sp.ACSURL || data.attr("NotOnOrAfter") == "" {
+			continue
+		}
+		if inResponseTo := data.attr("InResponseTo"); inResponseTo != "" && inResponseTo != requestID {
+			continue
+		}
+		if checkValidity(data, now) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkValidity fails when now is outside the NotBefore and NotOnOrAfter
+// attributes of e, allowing for clock skew
+func checkValidity(e *element, now time.Time) error {
+	if value := e.attr("NotBefore"); value != "" {
+		notBefore, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("malformed NotBefore: %w", err)
+		}
+		if now.Add(MaxClockSkew).Before(notBefore) {
+			return errors.New("assertion is not valid yet")
+		}
+	}
+	if value := e.attr("NotOnOrAfter"); value != "" {
+		notOnOrAfter, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("malformed NotOnOrAfter: %w", err)
+		}
+		if !now.Add(-MaxClockSkew).Before(notOnOrAfter) {
+			return errors.New("assertion has expired")
+		}
+	}
+	return nil
+}
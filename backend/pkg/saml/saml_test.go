@@ -0,0 +1,256 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIdPEntityID = "https://idp.example.com/metadata"
+	testSPEntityID  = "https://go.example.com/api/auth/saml/metadata"
+	testACSURL      = "https://go.example.com/api/auth/saml/acs"
+	testRequestID   = "_request1"
+)
+
+// testNow is the time responses are checked at
+var testNow = time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestIdP creates an identity provider signing with a new key
+func newTestIdP(t *testing.T) (*IdentityProvider, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    testNow.Add(-time.Hour),
+		NotAfter:     testNow.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &IdentityProvider{
+		EntityID:     testIdPEntityID,
+		SSOURL:       "https://idp.example.com/sso?tenant=acme",
+		Certificates: []*x509.Certificate{certificate},
+	}, key
+}
+
+// newTestSP creates a service provider for idp whose clock reads testNow
+func newTestSP(idp *IdentityProvider) *ServiceProvider {
+	sp := New(testSPEntityID, testACSURL, idp)
+	sp.now = func() time.Time { return testNow }
+	return sp
+}
+
+// testAssertion is an assertion as an identity provider issues it. The
+// namespaces it uses are declared on the response.
+func testAssertion(id, nameID, audience string) string {
+	return fmt.Sprintf(`<saml:Assertion ID="%s" IssueInstant="2030-01-01T12:00:00Z" Version="2.0">
+    <saml:Issuer>%s</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">%s</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="%s" NotOnOrAfter="2030-01-01T12:05:00Z" Recipient="%s"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="2030-01-01T11:59:00Z" NotOnOrAfter="2030-01-01T12:05:00Z">
+      <saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AuthnStatement AuthnInstant="2030-01-01T12:00:00Z" SessionIndex="_session1"/>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress" FriendlyName="email">
+        <saml:AttributeValue xsi:type="xs:string">ann@example.com</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="displayName"><saml:AttributeValue>Ann &amp; Co</saml:AttributeValue></saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>`, id, testIdPEntityID, nameID, testRequestID, testACSURL, audience)
+}
+
+// testResponse wraps assertions in a successful response to the test request
+func testResponse(assertions string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" Destination="%s" ID="_response1" InResponseTo="%s" IssueInstant="2030-01-01T12:00:00Z" Version="2.0">
+  <saml:Issuer>%s</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+  %s
+</samlp:Response>`, testACSURL, testRequestID, testIdPEntityID, assertions)
+}
+
+// sign inserts an enveloped signature by key of the element with id after
+// its Issuer. SignedInfo is written in canonical form, so what is signed
+// does not depend on the canonicalization under test.
+func sign(t *testing.T, document, id string, key *rsa.PrivateKey) string {
+	t.Helper()
+	root, err := parseXML([]byte(document))
+	require.NoError(t, err)
+	ids, err := root.ids()
+	require.NoError(t, err)
+	signed, err := canonicalize(ids[id], nil, []string{"xs"})
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte(signed))
+
+	signedInfo := `<ds:SignedInfo><ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:CanonicalizationMethod>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"></ds:SignatureMethod>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms><ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></ds:Transform>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"><ec:InclusiveNamespaces xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="xs"></ec:InclusiveNamespaces></ds:Transform></ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></ds:DigestMethod>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference></ds:SignedInfo>`
+	canonicalSignedInfo := strings.Replace(signedInfo, "<ds:SignedInfo>",
+		`<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">`, 1)
+	hashed := sha256.Sum256([]byte(canonicalSignedInfo))
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	require.NoError(t, err)
+
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + signedInfo +
+		"<ds:SignatureValue>\n" + base64.StdEncoding.EncodeToString(value) + "\n</ds:SignatureValue></ds:Signature>"
+	start := strings.Index(document, `ID="`+id+`"`)
+	require.GreaterOrEqual(t, start, 0)
+	issuerEnd := start + strings.Index(document[start:], "</saml:Issuer>") + len("</saml:Issuer>")
+	return document[:issuerEnd] + signature + document[issuerEnd:]
+}
+
+func encode(document string) string {
+	return base64.StdEncoding.EncodeToString([]byte(document))
+}
+
+func TestCanonicalize(t *testing.T) {
+	root, err := parseXML([]byte(`<?xml version="1.0"?>
+<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns:unused="urn:unused" xmlns="urn:default">
+  <!-- comments are dropped -->
+  <a:child z="1" b:y="2" a:x="3" xmlns:c="urn:c"><plain note="a&quot;b&#9;">1 &lt; 2 &amp;&#13; 3 > 2</plain><a:empty/></a:child>
+</a:root>`))
+	require.NoError(t, err)
+	child := root.child("urn:a", "child")
+	require.NotNil(t, child)
+
+	canonical, err := canonicalize(child, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `<a:child xmlns:a="urn:a" xmlns:b="urn:b" z="1" a:x="3" b:y="2">`+
+		`<plain xmlns="urn:default" note="a&quot;b&#x9;">1 &lt; 2 &amp;&#xD; 3 &gt; 2</plain><a:empty></a:empty></a:child>`, canonical)
+
+	canonical, err = canonicalize(child, nil, []string{"unused", "#default"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(canonical, `<a:child xmlns="urn:default" xmlns:a="urn:a" xmlns:b="urn:b" xmlns:unused="urn:unused" `),
+		"inclusive prefixes are declared where in scope: %s", canonical)
+	assert.Contains(t, canonical, `<plain note=`, "namespaces already declared are not repeated")
+}
+
+func TestParseResponse(t *testing.T) {
+	idp, key := newTestIdP(t)
+	sp := newTestSP(idp)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	signedAssertion := sign(t, testResponse(testAssertion("_assertion1", "ann@example.com", testSPEntityID)), "_assertion1", key)
+	assertion, err := sp.ParseResponse(encode(signedAssertion), testRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "ann@example.com", assertion.NameID)
+	assert.Equal(t, "_session1", assertion.SessionIndex)
+	assert.Equal(t, "ann@example.com", assertion.Attribute("mail", "email"))
+	assert.Equal(t, "Ann & Co", assertion.Attribute("displayName"))
+
+	signedResponse := sign(t, testResponse(testAssertion("_assertion1", "ann@example.com", testSPEntityID)), "_response1", key)
+	_, err = sp.ParseResponse(encode(signedResponse), testRequestID)
+	assert.NoError(t, err, "a signed response covers its assertion")
+
+	invalid := map[string]string{
+		"unsigned": testResponse(testAssertion("_assertion1", "ann@example.com", testSPEntityID)),
+		"tampered": strings.Replace(signedAssertion, ">ann@example.com</saml:NameID>", ">admin@example.com</saml:NameID>", 1),
+		"other key": sign(t, testResponse(testAssertion("_assertion1", "ann@example.com", testSPEntityID)),
+			"_assertion1", otherKey),
+		"other audience": sign(t, testResponse(testAssertion("_assertion1", "ann@example.com", "https://other.example.com")),
+			"_assertion1", key),
+		"wrapped": strings.Replace(signedAssertion, "<samlp:Status>",
+			testAssertion("_assertion1", "admin@example.com", testSPEntityID)+"<samlp:Status>", 1),
+		"second assertion": strings.Replace(signedAssertion, "<samlp:Status>",
+			testAssertion("_assertion2", "admin@example.com", testSPEntityID)+"<samlp:Status>", 1),
+		"failed": strings.Replace(signedAssertion, "status:Success", "status:Responder", 1),
+		"dtd":    strings.Replace(signedAssertion, "<samlp:Response", `<!DOCTYPE r [<!ENTITY e "x">]><samlp:Response`, 1),
+	}
+	for name, document := range invalid {
+		_, err := sp.ParseResponse(encode(document), testRequestID)
+		assert.Error(t, err, name)
+	}
+
+	_, err = sp.ParseResponse(encode(signedAssertion), "_otherRequest")
+	assert.Error(t, err, "responses must answer the request")
+
+	sp.now = func() time.Time { return testNow.Add(time.Hour) }
+	_, err = sp.ParseResponse(encode(signedAssertion), testRequestID)
+	assert.Error(t, err, "expired assertions are rejected")
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	idp, _ := newTestIdP(t)
+	sp := newTestSP(idp)
+
+	redirect, requestID, err := sp.AuthnRequestURL("state")
+	require.NoError(t, err)
+	u, err := url.Parse(redirect)
+	require.NoError(t, err)
+	assert.Equal(t, "idp.example.com", u.Host)
+	assert.Equal(t, "acme", u.Query().Get("tenant"), "the query of the SSO URL is kept")
+	assert.Equal(t, "state", u.Query().Get("RelayState"))
+
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.NoError(t, err)
+	request, err := parseXML(data)
+	require.NoError(t, err)
+	assert.True(t, request.is(nsProtocol, "AuthnRequest"))
+	assert.Equal(t, requestID, request.attr("ID"))
+	assert.Equal(t, testACSURL, request.attr("AssertionConsumerServiceURL"))
+	assert.Equal(t, testSPEntityID, request.child(nsAssertion, "Issuer").text())
+}
+
+func TestMetadata(t *testing.T) {
+	idp, _ := newTestIdP(t)
+	sp := newTestSP(idp)
+
+	data, err := sp.Metadata()
+	require.NoError(t, err)
+	root, err := parseXML(data)
+	require.NoError(t, err)
+	assert.Equal(t, testSPEntityID, root.attr("entityID"))
+	acs := root.child(nsMetadata, "SPSSODescriptor").child(nsMetadata, "AssertionConsumerService")
+	assert.Equal(t, testACSURL, acs.attr("Location"))
+	assert.Equal(t, bindingPOST, acs.attr("Binding"))
+
+	// Identity provider metadata round trips its certificate
+	certificate := base64.StdEncoding.EncodeToString(idp.Certificates[0].Raw)
+	parsed, err := ParseIdentityProvider([]byte(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + testIdPEntityID + `">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing"><ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>` + certificate + `</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`))
+	require.NoError(t, err)
+	assert.Equal(t, testIdPEntityID, parsed.EntityID)
+	assert.Equal(t, "https://idp.example.com/sso", parsed.SSOURL)
+	require.Len(t, parsed.Certificates, 1)
+	assert.True(t, parsed.Certificates[0].Equal(idp.Certificates[0]))
+
+	_, err = ParseIdentityProvider([]byte(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="x"/>`))
+	assert.Error(t, err)
+}
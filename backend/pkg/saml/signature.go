@@ -0,0 +1,167 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	// Register the hashes signatures may use
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Algorithms of the signatures accepted. SHA-1 is not.
+const (
+	algEnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algSHA256             = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512             = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+var (
+	signatureHashes = map[string]crypto.Hash{algRSASHA256: crypto.SHA256, algRSASHA512: crypto.SHA512}
+	digestHashes    = map[string]crypto.Hash{algSHA256: crypto.SHA256, algSHA512: crypto.SHA512}
+)
+
+// errNotSigned is returned for an element without a signature
+var errNotSigned = errors.New("not signed")
+
+// verifySignature checks the enveloped signature of e, which must cover e
+// and nothing else, against the identity provider's certificates. The key
+// info of the signature is ignored: only the configured certificates are
+// trusted.
+func verifySignature(e *element, certificates []*x509.Certificate) error {
+	signatures := e.childElements(nsDSig, "Signature")
+	switch {
+	case len(signatures) == 0:
+		return errNotSigned
+	case len(signatures) > 1:
+		return errors.New("more than one signature")
+	}
+	signature := signatures[0]
+
+	signedInfo := signature.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("signature without SignedInfo")
+	}
+	c14nMethod := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != algExcC14N {
+		return errors.New("unsupported canonicalization method")
+	}
+	signatureMethod := signedInfo.child(nsDSig, "SignatureMethod")
+	if signatureMethod == nil {
+		return errors.New("signature without SignatureMethod")
+	}
+	hash, ok := signatureHashes[signatureMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported signature method %q", signatureMethod.attr("Algorithm"))
+	}
+
+	if err := verifyReference(e, signature, signedInfo); err != nil {
+		return err
+	}
+
+	canonical, err := canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod))
+	if err != nil {
+		return err
+	}
+	value := signature.child(nsDSig, "SignatureValue")
+	if value == nil {
+		return errors.New("signature without SignatureValue")
+	}
+	signed, err := decodeBase64(value.text())
+	if err != nil {
+		return fmt.Errorf("malformed SignatureValue: %w", err)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(canonical))
+	digest := hasher.Sum(nil)
+	for _, certificate := range certificates {
+		key, ok := certificate.PublicKey.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(key, hash, digest, signed) == nil {
+			return nil
+		}
+	}
+	return errors.New("signature does not match the identity provider's certificates")
+}
+
+// verifyReference checks that the only reference of signedInfo is to e,
+// transformed as an enveloped signature, and that its digest matches
+func verifyReference(e, signature, signedInfo *element) error {
+	references := signedInfo.childElements(nsDSig, "Reference")
+	if len(references) != 1 {
+		return errors.New("signature must have exactly one reference")
+	}
+	reference := references[0]
+	if id := e.attr("ID"); id == "" || reference.attr("URI") != "#"+id {
+		return errors.New("signature does not reference the signed element")
+	}
+
+	var enveloped bool
+	var inclusive []string
+	if transforms := reference.child(nsDSig, "Transforms"); transforms != nil {
+		for _, transform := range transforms.childElements(nsDSig, "Transform") {
+			switch transform.attr("Algorithm") {
+			case algEnvelopedSignature:
+				enveloped = true
+			case algExcC14N:
+				inclusive = inclusivePrefixes(transform)
+			default:
+				return fmt.Errorf("unsupported transform %q", transform.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped {
+		return errors.New("signature is not enveloped")
+	}
+
+	digestMethod := reference.child(nsDSig, "DigestMethod")
+	if digestMethod == nil {
+		return errors.New("reference without DigestMethod")
+	}
+	hash, ok := digestHashes[digestMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %q", digestMethod.attr("Algorithm"))
+	}
+	digestValue := reference.child(nsDSig, "DigestValue")
+	if digestValue == nil {
+		return errors.New("reference without DigestValue")
+	}
+	expected, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("malformed DigestValue: %w", err)
+	}
+
+	canonical, err := canonicalize(e, signature, inclusive)
+	if err != nil {
+		return err
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(canonical))
+	if subtle.ConstantTimeCompare(hasher.Sum(nil), expected) != 1 {
+		return errors.New("digest does not match the signed element")
+	}
+	return nil
+}
+
+// inclusivePrefixes returns the PrefixList of the InclusiveNamespaces of an
+// exclusive canonicalization method
+func inclusivePrefixes(method *element) []string {
+	for _, child := range method.children {
+		if child, ok := child.(*element); ok && child.is(algExcC14N, "InclusiveNamespaces") {
+			return strings.Fields(child.attr("PrefixList"))
+		}
+	}
+	return nil
+}
+
+// decodeBase64 decodes base64 that may be broken over lines
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,201 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Namespaces of the elements read and written
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	nsDSig      = "http://www.w3.org/2000/09/xmldsig#"
+	nsXML       = "http://www.w3.org/XML/1998/namespace"
+)
+
+// element is an XML element as written, with the prefixes of its name and
+// attributes kept unresolved, as signatures are computed over them
+type element struct {
+	parent   *element
+	prefix   string
+	local    string
+	attrs    []attr
+	nsDecls  []attr
+	children []any
+}
+
+// attr is an attribute, or a namespace declaration whose local name is the
+// prefix declared ("" for the default namespace)
+type attr struct {
+	prefix string
+	local  string
+	value  string
+}
+
+// procInst is a processing instruction inside the document's root
+type procInst struct {
+	target string
+	inst   string
+}
+
+// parseXML reads a document into its root element. Documents with a DTD are
+// rejected, so entities cannot be declared.
+func parseXML(data []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *element
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed XML: %w", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, errors.New("malformed XML: more than one root element")
+			}
+			e := &element{parent: current, prefix: token.Name.Space, local: token.Name.Local}
+			for _, a := range token.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					e.nsDecls = append(e.nsDecls, attr{local: a.Name.Local, value: a.Value})
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					e.nsDecls = append(e.nsDecls, attr{value: a.Value})
+				default:
+					e.attrs = append(e.attrs, attr{prefix: a.Name.Space, local: a.Name.Local, value: a.Value})
+				}
+			}
+			if current == nil {
+				root = e
+			} else {
+				current.children = append(current.children, e)
+			}
+			current = e
+		case xml.EndElement:
+			if current == nil || token.Name.Space != current.prefix || token.Name.Local != current.local {
+				return nil, errors.New("malformed XML: mismatched end element")
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, string(token))
+			}
+		case xml.ProcInst:
+			if current != nil {
+				current.children = append(current.children, procInst{target: token.Target, inst: string(token.Inst)})
+			}
+		case xml.Directive:
+			return nil, errors.New("XML with a DTD is not accepted")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("malformed XML: incomplete document")
+	}
+	return root, nil
+}
+
+// lookupNamespace returns the namespace bound to prefix where e is
+func (e *element) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for scope := e; scope != nil; scope = scope.parent {
+		for _, decl := range scope.nsDecls {
+			if decl.local == prefix {
+				return decl.value, true
+			}
+		}
+	}
+	return "", prefix == ""
+}
+
+// space returns the namespace of e's name
+func (e *element) space() string {
+	space, _ := e.lookupNamespace(e.prefix)
+	return space
+}
+
+// is reports whether e is named local in namespace space
+func (e *element) is(space, local string) bool {
+	return e.local == local && e.space() == space
+}
+
+// attr returns the value of e's attribute named local without a namespace
+func (e *element) attr(local string) string {
+	for _, a := range e.attrs {
+		if a.prefix == "" && a.local == local {
+			return a.value
+		}
+	}
+	return ""
+}
+
+// childElements returns e's child elements named local in namespace space
+func (e *element) childElements(space, local string) []*element {
+	var found []*element
+	for _, child := range e.children {
+		if child, ok := child.(*element); ok && child.is(space, local) {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+// child returns e's first child element named local in namespace space
+func (e *element) child(space, local string) *element {
+	if found := e.childElements(space, local); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+// text returns the character data of e and its descendants, trimmed
+func (e *element) text() string {
+	var b strings.Builder
+	var collect func(*element)
+	collect = func(e *element) {
+		for _, child := range e.children {
+			switch child := child.(type) {
+			case string:
+				b.WriteString(child)
+			case *element:
+				collect(child)
+			}
+		}
+	}
+	collect(e)
+	return strings.TrimSpace(b.String())
+}
+
+// ids returns the elements of e's tree by ID attribute, failing when an ID
+// is used twice, which would let a signature cover another element than the
+// one read
+func (e *element) ids() (map[string]*element, error) {
+	found := map[string]*element{}
+	var walk func(*element) error
+	walk = func(e *element) error {
+		if id := e.attr("ID"); id != "" {
+			if _, duplicate := found[id]; duplicate {
+				return fmt.Errorf("ID %q is used twice", id)
+			}
+			found[id] = e
+		}
+		for _, child := range e.children {
+			if child, ok := child.(*element); ok {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return found, walk(e)
+}
@@ -0,0 +1,198 @@
+// Package sandbox keeps the developer sandbox: a namespace in which anyone
+// may create links to try the service out without claiming real short codes.
+//
+// Links in the sandbox expire a fixed time after they are created, stay out
+// of search and trending, and are purged by a Sweeper once they expire, so
+// experiments never pile up in the shared namespace.
+package sandbox
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+)
+
+// DefaultNamespace is the namespace of the sandbox by default
+const DefaultNamespace = "sandbox"
+
+// DefaultTTL is how long a sandbox link lives by default
+const DefaultTTL = 24 * time.Hour
+
+// DefaultSweepInterval is how often expired sandbox links are purged by default
+const DefaultSweepInterval = 10 * time.Minute
+
+// jobName names the sweeper in the background job metrics
+const jobName = "sandbox-sweeper"
+
+var log = logger.For("sandbox")
+
+var purgedLinks = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "golink_sandbox_links_purged_total",
+	Help: "Total number of expired sandbox links purged",
+})
+
+// Policy describes the sandbox namespace. The zero Policy has no sandbox.
+type Policy struct {
+	// Namespace is the first segment of sandbox short codes, such as
+	// "sandbox" for "sandbox/demo"
+	Namespace string
+	// TTL is how long after its creation a sandbox link expires
+	TTL time.Duration
+}
+
+// DefaultPolicy returns the sandbox policy used when none is configured
+func DefaultPolicy() Policy {
+	return Policy{Namespace: DefaultNamespace, TTL: DefaultTTL}
+}
+
+// Enabled reports whether the policy has a sandbox
+func (p Policy) Enabled() bool {
+	return p.Namespace != "" && p.TTL > 0
+}
+
+// Contains reports whether short lies in the sandbox
+func (p Policy) Contains(short string) bool {
+	if !p.Enabled() {
+		return false
+	}
+	namespace, _, found := strings.Cut(short, "/")
+	return found && strings.EqualFold(namespace, p.Namespace)
+}
+
+// Expiry returns when a sandbox link created at createdAt expires: at the
+// requested time if that comes first, and TTL after its creation otherwise
+func (p Policy) Expiry(createdAt, requested time.Time) time.Time {
+	limit := createdAt.Add(p.TTL)
+	if !requested.IsZero() && requested.Before(limit) {
+		return requested
+	}
+	return limit
+}
+
+// Store lists and purges the links of a namespace
+type Store interface {
+	GetByNamespace(ctx context.Context, namespace string) ([]*models.Link, error)
+	Purge(ctx context.Context, short string) error
+}
+
+// Option configures a Sweeper
+type Option func(*Sweeper)
+
+// WithInterval sets how often expired sandbox links are purged
+func WithInterval(interval time.Duration) Option {
+	return func(s *Sweeper) {
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+// Sweeper purges expired sandbox links in the background
+type Sweeper struct {
+	store    Store
+	policy   Policy
+	now      func() time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+	interval time.Duration
+}
+
+// NewSweeper creates a sweeper for the sandbox of policy
+func NewSweeper(store Store, policy Policy, opts ...Option) *Sweeper {
+	s := &Sweeper{
+		store:    store,
+		policy:   policy,
+		now:      time.Now,
+		interval: DefaultSweepInterval,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Sweep permanently deletes the sandbox links that have expired, including
+// ones whose stored expiry is missing or later than the policy allows, and
+// returns how many it deleted
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	if !s.policy.Enabled() {
+		return 0, nil
+	}
+	links, err := s.store.GetByNamespace(ctx, s.policy.Namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	purged := 0
+	for _, link := range links {
+		if now.Before(s.policy.Expiry(link.CreatedAt, link.ExpiresAt)) {
+			continue
+		}
+		if err := s.store.Purge(ctx, link.Short); err != nil {
+			if errors.Is(err, errors.ErrNotFound) {
+				continue
+			}
+			return purged, err
+		}
+		purged++
+		purgedLinks.Inc()
+		log.Info("Purged expired sandbox link", logger.Fields{
+			"short":     link.Short,
+			"createdBy": link.CreatedBy,
+		})
+	}
+	return purged, nil
+}
+
+// Start purges expired sandbox links in the background until Stop. The first
+// sweep runs right away.
+func (s *Sweeper) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.run(ctx)
+	return nil
+}
+
+// Stop ends the background sweeps, waiting for the current one to finish
+func (s *Sweeper) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run sweeps once per interval
+func (s *Sweeper) run(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.Sweep(ctx); ctx.Err() == nil {
+			jobs.Record(jobName, err)
+			if err != nil {
+				log.Error("Failed to purge expired sandbox links", err, logger.Fields{"job": jobName})
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// fakeStore keeps links in a map
+type fakeStore struct {
+	links map[string]*models.Link
+}
+
+func (f *fakeStore) GetByNamespace(ctx context.Context, namespace string) ([]*models.Link, error) {
+	var links []*models.Link
+	for _, link := range f.links {
+		if strings.HasPrefix(link.Short, namespace+"/") {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (f *fakeStore) Purge(ctx context.Context, short string) error {
+	if _, ok := f.links[short]; !ok {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	delete(f.links, short)
+	return nil
+}
+
+func TestPolicy(t *testing.T) {
+	policy := DefaultPolicy()
+	assert.True(t, policy.Contains("sandbox/demo"))
+	assert.True(t, policy.Contains("Sandbox/demo/x"))
+	assert.False(t, policy.Contains("sandbox"))
+	assert.False(t, policy.Contains("sandboxes/demo"))
+	assert.False(t, Policy{}.Contains("sandbox/demo"))
+
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, created.Add(DefaultTTL), policy.Expiry(created, time.Time{}))
+	assert.Equal(t, created.Add(DefaultTTL), policy.Expiry(created, created.Add(48*time.Hour)))
+	assert.Equal(t, created.Add(time.Hour), policy.Expiry(created, created.Add(time.Hour)))
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	link := func(short string, age time.Duration, expires time.Time) *models.Link {
+		l := models.NewLink(short, "https://example.com", "user1")
+		l.CreatedAt = now.Add(-age)
+		l.ExpiresAt = expires
+		return l
+	}
+	store := &fakeStore{links: map[string]*models.Link{
+		"sandbox/fresh":   link("sandbox/fresh", time.Hour, now.Add(23*time.Hour)),
+		"sandbox/old":     link("sandbox/old", 25*time.Hour, time.Time{}),
+		"sandbox/early":   link("sandbox/early", time.Hour, now.Add(-time.Minute)),
+		"sandbox/tamper":  link("sandbox/tamper", 30*time.Hour, now.Add(time.Hour)),
+		"team/old-enough": link("team/old-enough", 48*time.Hour, time.Time{}),
+	}}
+	s := NewSweeper(store, DefaultPolicy())
+	s.now = func() time.Time { return now }
+
+	purged, err := s.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, purged)
+	assert.Contains(t, store.links, "sandbox/fresh")
+	assert.Contains(t, store.links, "team/old-enough")
+	assert.Len(t, store.links, 2)
+
+	// A disabled sandbox is left alone
+	purged, err = NewSweeper(store, Policy{}).Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+}
@@ -0,0 +1,232 @@
+// Package settings exports the settings of an environment as one versioned
+// JSON document and imports it into another, so staging can be set up like
+// production.
+//
+// A document holds the portable environment variables of the server (see
+// config.PortableSettings), the registered webhooks and the log levels.
+// Environment variables only take effect when the server is started with
+// them, so importing reports the ones that differ instead of changing them;
+// webhooks and log levels are applied at once. Webhook secrets are never
+// exported: imported webhooks get secrets of their own.
+package settings
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/config"
+	"github.com/Okabe-Junya/golink-backend/pkg/webhook"
+	"github.com/google/uuid"
+)
+
+// Version is the version of the documents this package writes and reads
+const Version = 1
+
+// Document is an exported set of settings
+type Document struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Env        map[string]string `json:"env"`
+	Webhooks   []Webhook         `json:"webhooks"`
+	// LogLevels is only exported by a running server
+	LogLevels *LogLevels `json:"log_levels,omitempty"`
+}
+
+// Webhook is a registered webhook without its ID and secret
+type Webhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+}
+
+// LogLevels is the global log level and format with the per-component
+// overrides, as served at /api/admin/log-levels
+type LogLevels struct {
+	Components map[string]string `json:"components"`
+	Level      string            `json:"level,omitempty"`
+	Format     string            `json:"format,omitempty"`
+}
+
+// Export builds a document from the portable environment and the webhooks
+// in store, which may be nil
+func Export(ctx context.Context, env map[string]string, store interfaces.WebhookStore) (*Document, error) {
+	doc := &Document{
+		Version:    Version,
+		ExportedAt: time.Now().UTC(),
+		Env:        env,
+		Webhooks:   []Webhook{},
+	}
+	if doc.Env == nil {
+		doc.Env = map[string]string{}
+	}
+	if store == nil {
+		return doc, nil
+	}
+	webhooks, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range webhooks {
+		doc.Webhooks = append(doc.Webhooks, Webhook{URL: hook.URL, Events: hook.Events, Active: hook.Active})
+	}
+	return doc, nil
+}
+
+// Validate checks that the document can be imported
+func (d *Document) Validate() error {
+	if d.Version != Version {
+		return fmt.Errorf("unsupported settings document version %d, expected %d", d.Version, Version)
+	}
+	for key := range d.Env {
+		if !slices.Contains(config.PortableSettings, key) {
+			return fmt.Errorf("'%s' is not a portable setting", key)
+		}
+	}
+	for _, hook := range d.Webhooks {
+		target, err := url.Parse(hook.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("webhook url '%s' must be an absolute http or https URL", hook.URL)
+		}
+		if len(hook.Events) == 0 {
+			return fmt.Errorf("webhook '%s' needs at least one event", hook.URL)
+		}
+		for _, event := range hook.Events {
+			if !models.IsWebhookEvent(event) {
+				return fmt.Errorf("webhook '%s' has unknown event type '%s'", hook.URL, event)
+			}
+		}
+	}
+	return nil
+}
+
+// EnvChange is an environment variable whose imported value differs from
+// the current one. An empty value means the variable is unset.
+type EnvChange struct {
+	Key      string `json:"key"`
+	Current  string `json:"current"`
+	Imported string `json:"imported"`
+}
+
+// DiffEnv returns the portable settings whose values in imported differ from
+// current, sorted by key
+func DiffEnv(current, imported map[string]string) []EnvChange {
+	changes := []EnvChange{}
+	keys := make(map[string]bool)
+	for key := range current {
+		keys[key] = true
+	}
+	for key := range imported {
+		keys[key] = true
+	}
+	for key := range keys {
+		if current[key] != imported[key] {
+			changes = append(changes, EnvChange{Key: key, Current: current[key], Imported: imported[key]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// WebhookChange reports what importing did with a webhook. Secret is only
+// set for webhooks the import created.
+type WebhookChange struct {
+	URL    string `json:"url"`
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// Actions of WebhookChange
+const (
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+)
+
+// ImportWebhooks registers the webhooks of the document in store, matching
+// existing ones by URL. Matching webhooks keep their secret; webhooks not in
+// the document are left alone. With dryRun nothing is stored.
+func ImportWebhooks(ctx context.Context, store interfaces.WebhookStore, webhooks []Webhook, userID string, dryRun bool) ([]WebhookChange, error) {
+	existing, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byURL := make(map[string]*models.Webhook, len(existing))
+	for _, hook := range existing {
+		byURL[hook.URL] = hook
+	}
+
+	changes := []WebhookChange{}
+	now := time.Now()
+	for _, imported := range webhooks {
+		hook, found := byURL[imported.URL]
+		if found {
+			change := WebhookChange{URL: hook.URL, ID: hook.ID, Action: ActionUnchanged}
+			if hook.Active != imported.Active || !slices.Equal(hook.Events, imported.Events) {
+				change.Action = ActionUpdated
+				hook.Events = slices.Clone(imported.Events)
+				hook.Active = imported.Active
+				hook.UpdatedAt = now
+				if !dryRun {
+					if err := store.Update(ctx, hook); err != nil {
+						return changes, err
+					}
+				}
+			}
+			changes = append(changes, change)
+			continue
+		}
+
+		hook = &models.Webhook{
+			ID:        uuid.NewString(),
+			URL:       imported.URL,
+			Events:    slices.Clone(imported.Events),
+			Active:    imported.Active,
+			CreatedBy: userID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		change := WebhookChange{URL: hook.URL, Action: ActionCreated}
+		if !dryRun {
+			if hook.Secret, err = webhook.NewSecret(); err != nil {
+				return changes, err
+			}
+			if err := store.Create(ctx, hook); err != nil {
+				return changes, err
+			}
+			change.ID, change.Secret = hook.ID, hook.Secret
+		}
+		byURL[hook.URL] = hook
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// EnvFile renders env as KEY=value lines sorted by key, quoting values that
+// need it, for the environment file of a deployment
+func EnvFile(env map[string]string) []byte {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		value := env[key]
+		if strings.ContainsAny(value, " \t\"'#$\\\n") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", key, value)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,122 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := repositories.NewMemoryWebhookStore()
+	require.NoError(t, source.Create(ctx, &models.Webhook{
+		ID: "1", URL: "https://hooks.example.com/a", Secret: "production-secret",
+		Events: []string{models.WebhookEvents.LinkCreated}, Active: true,
+	}))
+
+	doc, err := Export(ctx, map[string]string{"RESERVED_SHORT_CODES": "admin,api"}, source)
+	require.NoError(t, err)
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "production-secret")
+
+	var imported Document
+	require.NoError(t, json.Unmarshal(data, &imported))
+	require.NoError(t, imported.Validate())
+
+	target := repositories.NewMemoryWebhookStore()
+	require.NoError(t, target.Create(ctx, &models.Webhook{
+		ID: "2", URL: "https://hooks.example.com/b", Secret: "staging-secret",
+		Events: []string{models.WebhookEvents.LinkDeleted}, Active: true,
+	}))
+	imported.Webhooks = append(imported.Webhooks, Webhook{
+		URL: "https://hooks.example.com/b", Events: []string{models.WebhookEvents.LinkDeleted}, Active: false,
+	})
+
+	// A dry run reports the changes without making them
+	changes, err := ImportWebhooks(ctx, target, imported.Webhooks, "admin", true)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, ActionCreated, changes[0].Action)
+	assert.Empty(t, changes[0].Secret)
+	assert.Equal(t, ActionUpdated, changes[1].Action)
+	webhooks, _ := target.List(ctx)
+	assert.Len(t, webhooks, 1)
+	assert.True(t, webhooks[0].Active)
+
+	changes, err = ImportWebhooks(ctx, target, imported.Webhooks, "admin", false)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, ActionCreated, changes[0].Action)
+	assert.Len(t, changes[0].Secret, 64, "created webhooks get a secret of their own")
+	assert.Equal(t, ActionUpdated, changes[1].Action)
+
+	created, err := target.Get(ctx, changes[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/a", created.URL)
+	assert.Equal(t, changes[0].Secret, created.Secret)
+	updated, err := target.Get(ctx, "2")
+	require.NoError(t, err)
+	assert.False(t, updated.Active)
+	assert.Equal(t, "staging-secret", updated.Secret, "existing webhooks keep their secret")
+
+	// Importing again changes nothing
+	changes, err = ImportWebhooks(ctx, target, imported.Webhooks, "admin", false)
+	require.NoError(t, err)
+	for _, change := range changes {
+		assert.Equal(t, ActionUnchanged, change.Action)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     Document
+		wantErr string
+	}{
+		{name: "Valid", doc: Document{Version: Version, Env: map[string]string{"SHORT_CODE_LENGTH": "8"}}},
+		{name: "Unknown version", doc: Document{Version: Version + 1}, wantErr: "version"},
+		{name: "Secret setting", doc: Document{Version: Version, Env: map[string]string{"JWT_SECRET": "x"}}, wantErr: "not a portable setting"},
+		{name: "Relative webhook URL", doc: Document{Version: Version, Webhooks: []Webhook{{URL: "/hooks", Events: []string{"link.created"}}}}, wantErr: "absolute"},
+		{name: "Webhook without events", doc: Document{Version: Version, Webhooks: []Webhook{{URL: "https://hooks.example.com"}}}, wantErr: "at least one event"},
+		{name: "Unknown event", doc: Document{Version: Version, Webhooks: []Webhook{{URL: "https://hooks.example.com", Events: []string{"link.clicked"}}}}, wantErr: "unknown event"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.doc.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestDiffEnv(t *testing.T) {
+	changes := DiffEnv(
+		map[string]string{"SHORT_CODE_LENGTH": "6", "LINK_PREVIEWS": "true", "SANDBOX_TTL": "24h"},
+		map[string]string{"SHORT_CODE_LENGTH": "8", "SANDBOX_TTL": "24h", "URL_MAX_LENGTH": "4096"},
+	)
+	assert.Equal(t, []EnvChange{
+		{Key: "LINK_PREVIEWS", Current: "true", Imported: ""},
+		{Key: "SHORT_CODE_LENGTH", Current: "6", Imported: "8"},
+		{Key: "URL_MAX_LENGTH", Current: "", Imported: "4096"},
+	}, changes)
+}
+
+func TestEnvFile(t *testing.T) {
+	env := map[string]string{
+		"SHORT_CODE_LENGTH":    "8",
+		"URL_BLOCKED_PATTERNS": `^https?://[^/]*\.example$`,
+		"SANDBOX_NAMESPACE":    "try",
+	}
+	assert.Equal(t, "SANDBOX_NAMESPACE=try\nSHORT_CODE_LENGTH=8\nURL_BLOCKED_PATTERNS=\"^https?://[^/]*\\\\.example$\"\n", string(EnvFile(env)))
+}
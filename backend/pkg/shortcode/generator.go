@@ -0,0 +1,63 @@
+package shortcode
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+const (
+	// DefaultLength is the length of generated short codes
+	DefaultLength = 6
+	// DefaultAlphabet omits characters that are easily confused (0/o, 1/l)
+	DefaultAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+)
+
+// validAlphabet matches the characters allowed in short codes
+var validAlphabet = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// Generator produces random short codes
+type Generator struct {
+	alphabet []rune
+	length   int
+}
+
+// NewGenerator creates a Generator for codes of the given length drawn from alphabet
+func NewGenerator(length int, alphabet string) (*Generator, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("short code length must be positive, got %d", length)
+	}
+	if !validAlphabet.MatchString(alphabet) {
+		return nil, fmt.Errorf("short code alphabet must contain only letters, numbers, and hyphens")
+	}
+
+	// Deduplicate so every character is equally likely
+	seen := make(map[rune]bool)
+	var runes []rune
+	for _, c := range alphabet {
+		if !seen[c] {
+			seen[c] = true
+			runes = append(runes, c)
+		}
+	}
+	if len(runes) < 2 {
+		return nil, fmt.Errorf("short code alphabet must contain at least two distinct characters")
+	}
+
+	return &Generator{alphabet: runes, length: length}, nil
+}
+
+// Generate returns a new random short code
+func (g *Generator) Generate() (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+	code := make([]rune, g.length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate short code: %w", err)
+		}
+		code[i] = g.alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
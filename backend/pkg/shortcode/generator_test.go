@@ -0,0 +1,117 @@
+package shortcode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGenerator(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		length   int
+		wantErr  bool
+	}{
+		{name: "Defaults", length: DefaultLength, alphabet: DefaultAlphabet},
+		{name: "Zero length", length: 0, alphabet: DefaultAlphabet, wantErr: true},
+		{name: "Empty alphabet", length: 6, alphabet: "", wantErr: true},
+		{name: "Invalid characters", length: 6, alphabet: "abc/?", wantErr: true},
+		{name: "Single distinct character", length: 6, alphabet: "aaaa", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGenerator(tt.length, tt.alphabet)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	gen, err := NewGenerator(8, "ab")
+	require.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		code, err := gen.Generate()
+		require.NoError(t, err)
+		assert.Len(t, code, 8)
+		assert.Empty(t, strings.Trim(code, "ab"), "code %q uses characters outside the alphabet", code)
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 1, "codes should be random")
+}
+
+func TestReserved(t *testing.T) {
+	reserved := NewReserved("Wiki", " ", "")
+
+	assert.True(t, reserved.Contains("api"), "built-in codes are always reserved")
+	assert.True(t, reserved.Contains("METRICS"), "matching is case-insensitive")
+	assert.True(t, reserved.Contains("wiki"), "extra codes are added")
+	assert.False(t, reserved.Contains("docs"))
+	assert.False(t, reserved.Contains(""))
+}
+
+func TestNewStrategy(t *testing.T) {
+	for _, name := range Strategies() {
+		strategy, err := NewStrategy(name, DefaultLength, DefaultAlphabet)
+		require.NoError(t, err, name)
+		code, err := strategy.Generate()
+		require.NoError(t, err, name)
+		assert.Regexp(t, `^[a-z0-9]+(-[a-z0-9]+)?$`, code, name)
+	}
+	_, err := NewStrategy("uuid", DefaultLength, DefaultAlphabet)
+	assert.Error(t, err)
+	_, err = NewStrategy(StrategyPronounceable, 0, DefaultAlphabet)
+	assert.Error(t, err)
+}
+
+func TestPronounceable(t *testing.T) {
+	p, err := NewPronounceable(7)
+	require.NoError(t, err)
+	code, err := p.Generate()
+	require.NoError(t, err)
+	assert.Len(t, code, 7)
+	for i, c := range code {
+		letters := consonants
+		if i%2 == 1 {
+			letters = vowels
+		}
+		assert.Contains(t, letters, string(c), "character %d of %q", i, code)
+	}
+}
+
+func TestSequential(t *testing.T) {
+	s, err := NewSequential(3, "0123456789", 7)
+	require.NoError(t, err)
+	var codes []string
+	for range 4 {
+		code, err := s.Generate()
+		require.NoError(t, err)
+		codes = append(codes, code)
+	}
+	// The Luhn check digits of 07, 08, 09 and 10
+	assert.Equal(t, []string{"075", "083", "091", "109"}, codes)
+	for _, code := range codes {
+		assert.True(t, s.Valid(code), code)
+	}
+	assert.False(t, s.Valid("076"), "a wrong check digit")
+	assert.False(t, s.Valid("705"), "swapped digits")
+	assert.False(t, s.Valid("0a5"), "a character outside the alphabet")
+}
+
+func TestWordPairs(t *testing.T) {
+	code, err := NewWordPairs().Generate()
+	require.NoError(t, err)
+	adjective, noun, ok := strings.Cut(code, "-")
+	require.True(t, ok, code)
+	assert.Contains(t, adjectives, adjective)
+	assert.Contains(t, nouns, noun)
+}
@@ -0,0 +1,32 @@
+package shortcode
+
+import "strings"
+
+// DefaultReserved lists short codes that would shadow the service's own routes
+// or well-known paths requested by browsers and crawlers
+var DefaultReserved = []string{
+	"admin", "api", "assets", "auth", "callback", "favicon", "health", "index",
+	"login", "logout", "manifest", "metrics", "readyz", "robots", "sitemap", "static",
+}
+
+// Reserved is a set of short codes users may not claim. Matching is
+// case-insensitive, since redirects for "API" and "api" are easily confused.
+type Reserved map[string]bool
+
+// NewReserved returns the default reserved codes plus any extra ones
+func NewReserved(extra ...string) Reserved {
+	reserved := make(Reserved, len(DefaultReserved)+len(extra))
+	for _, list := range [][]string{DefaultReserved, extra} {
+		for _, code := range list {
+			if code = strings.ToLower(strings.TrimSpace(code)); code != "" {
+				reserved[code] = true
+			}
+		}
+	}
+	return reserved
+}
+
+// Contains reports whether short is reserved
+func (r Reserved) Contains(short string) bool {
+	return r[strings.ToLower(short)]
+}
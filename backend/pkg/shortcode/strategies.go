@@ -0,0 +1,225 @@
+package shortcode
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Short code generation strategies
+const (
+	// StrategyRandom draws every character from the alphabet, such as "k3xq9m"
+	StrategyRandom = "random"
+	// StrategyPronounceable alternates consonants and vowels, such as "bakotu"
+	StrategyPronounceable = "pronounceable"
+	// StrategySequential counts up in the alphabet and appends a check
+	// character, such as "2b7k"
+	StrategySequential = "sequential"
+	// StrategyWords pairs an adjective with a noun, such as "brave-otter"
+	StrategyWords = "words"
+)
+
+// DefaultStrategy is the strategy used unless another one is configured
+const DefaultStrategy = StrategyRandom
+
+// Strategy produces short codes for links created without one
+type Strategy interface {
+	Generate() (string, error)
+}
+
+// Strategies returns the names of the built-in strategies, sorted
+func Strategies() []string {
+	names := []string{StrategyRandom, StrategyPronounceable, StrategySequential, StrategyWords}
+	sort.Strings(names)
+	return names
+}
+
+// NewStrategy creates the built-in strategy of that name. Random and
+// sequential codes are drawn from alphabet; random and pronounceable codes
+// have the given length, and sequential ones at least that length.
+func NewStrategy(name string, length int, alphabet string) (Strategy, error) {
+	switch name {
+	case StrategyRandom:
+		return NewGenerator(length, alphabet)
+	case StrategyPronounceable:
+		return NewPronounceable(length)
+	case StrategySequential:
+		// Counting from the current time keeps numbers increasing across
+		// restarts, as long as fewer than one code a second is generated
+		return NewSequential(length, alphabet, uint64(time.Now().Unix()))
+	case StrategyWords:
+		return NewWordPairs(), nil
+	}
+	return nil, fmt.Errorf("unknown short code strategy %q: want one of %s", name, strings.Join(Strategies(), ", "))
+}
+
+// randomIndex returns a uniformly random index below n
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate short code: %w", err)
+	}
+	return int(i.Int64()), nil
+}
+
+// Pronounceable produces codes of alternating consonants and vowels, which
+// are easy to say aloud and to remember
+type Pronounceable struct {
+	length int
+}
+
+// Letters pronounceable codes are made of; "l" and "o" are left out as
+// they are easily confused with "1" and "0"
+const (
+	consonants = "bcdfghjkmnprstvwz"
+	vowels     = "aeiu"
+)
+
+// NewPronounceable creates a Pronounceable strategy for codes of the given length
+func NewPronounceable(length int) (*Pronounceable, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("short code length must be positive, got %d", length)
+	}
+	return &Pronounceable{length: length}, nil
+}
+
+// Generate returns a new pronounceable short code
+func (p *Pronounceable) Generate() (string, error) {
+	code := make([]byte, p.length)
+	for i := range code {
+		letters := consonants
+		if i%2 == 1 {
+			letters = vowels
+		}
+		n, err := randomIndex(len(letters))
+		if err != nil {
+			return "", err
+		}
+		code[i] = letters[n]
+	}
+	return string(code), nil
+}
+
+// Sequential produces consecutive codes, each the next number written in
+// the alphabet followed by a check character, so a mistyped code is most
+// likely not another link's. Numbers are not shared between instances;
+// codes already taken are skipped when the link is stored.
+type Sequential struct {
+	alphabet []rune
+	length   int
+	next     uint64
+	mutex    sync.Mutex
+}
+
+// NewSequential creates a Sequential strategy counting from start in
+// alphabet. Codes are padded to at least length characters, including the
+// check character.
+func NewSequential(length int, alphabet string, start uint64) (*Sequential, error) {
+	g, err := NewGenerator(length, alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return &Sequential{alphabet: g.alphabet, length: length, next: start}, nil
+}
+
+// Generate returns the next short code
+func (s *Sequential) Generate() (string, error) {
+	s.mutex.Lock()
+	n := s.next
+	s.next++
+	s.mutex.Unlock()
+
+	base := uint64(len(s.alphabet))
+	var digits []rune
+	for n > 0 || len(digits) < s.length-1 {
+		digits = append([]rune{s.alphabet[n%base]}, digits...)
+		n /= base
+	}
+	return string(digits) + string(s.checkCharacter(digits)), nil
+}
+
+// Valid reports whether code ends in the check character of its digits
+func (s *Sequential) Valid(code string) bool {
+	runes := []rune(code)
+	if len(runes) < 2 {
+		return false
+	}
+	for _, c := range runes[:len(runes)-1] {
+		if s.index(c) < 0 {
+			return false
+		}
+	}
+	return s.checkCharacter(runes[:len(runes)-1]) == runes[len(runes)-1]
+}
+
+// checkCharacter computes the Luhn mod N check character of digits, which
+// catches every single mistyped character and most swapped neighbours
+func (s *Sequential) checkCharacter(digits []rune) rune {
+	base := len(s.alphabet)
+	factor, sum := 2, 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		addend := factor * s.index(digits[i])
+		sum += addend/base + addend%base
+		factor = 3 - factor
+	}
+	return s.alphabet[(base-sum%base)%base]
+}
+
+// index returns the value of c in the alphabet, or -1 if it is not in it
+func (s *Sequential) index(c rune) int {
+	for i, a := range s.alphabet {
+		if a == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// WordPairs produces codes of an adjective and a noun, such as "brave-otter"
+type WordPairs struct{}
+
+// Words word pairs are made of
+var (
+	adjectives = []string{
+		"amber", "bold", "brave", "breezy", "bright", "calm", "clever", "cosmic",
+		"crisp", "curious", "daring", "deep", "eager", "early", "fancy", "fast",
+		"fluffy", "gentle", "giant", "golden", "grand", "happy", "honest", "humble",
+		"icy", "jolly", "keen", "kind", "lively", "lucky", "mellow", "merry",
+		"mighty", "misty", "modest", "noble", "polite", "proud", "quick", "quiet",
+		"rapid", "rosy", "royal", "rusty", "shiny", "silent", "silver", "sleepy",
+		"smooth", "snowy", "solid", "steady", "sunny", "swift", "tidy", "tiny",
+		"vivid", "warm", "wild", "wise", "witty", "young", "zesty", "zippy",
+	}
+	nouns = []string{
+		"badger", "beacon", "bison", "brook", "canyon", "cedar", "comet", "coral",
+		"crane", "dolphin", "eagle", "ember", "falcon", "fern", "fjord", "forest",
+		"fox", "galaxy", "garden", "glacier", "harbor", "hawk", "heron", "island",
+		"jaguar", "koala", "lagoon", "lantern", "lemur", "lion", "lotus", "meadow",
+		"meteor", "moose", "nebula", "oak", "ocean", "orbit", "otter", "owl",
+		"panda", "pebble", "pine", "planet", "prairie", "quartz", "raven", "reef",
+		"river", "robin", "rocket", "saturn", "sequoia", "sparrow", "summit", "tiger",
+		"tundra", "valley", "violet", "walrus", "willow", "wombat", "yak", "zebra",
+	}
+)
+
+// NewWordPairs creates a WordPairs strategy
+func NewWordPairs() *WordPairs {
+	return &WordPairs{}
+}
+
+// Generate returns a new word pair
+func (WordPairs) Generate() (string, error) {
+	a, err := randomIndex(len(adjectives))
+	if err != nil {
+		return "", err
+	}
+	n, err := randomIndex(len(nouns))
+	if err != nil {
+		return "", err
+	}
+	return adjectives[a] + "-" + nouns[n], nil
+}
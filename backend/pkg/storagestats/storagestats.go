@@ -0,0 +1,221 @@
+// Package storagestats keeps a picture of how the storage grows: how many
+// documents each collection holds, which statistics documents are the
+// largest and how many records point at links that no longer exist.
+//
+// Inspecting a collection reads every document in it, so the collector
+// refreshes one collection per interval instead of all of them at once; the
+// snapshot it serves mixes results of different ages, each stamped with the
+// time it was computed.
+package storagestats
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+)
+
+// DefaultInterval is how often a collection is inspected by default
+const DefaultInterval = 5 * time.Minute
+
+// DefaultLargest is how many of the largest documents are kept per collection
+const DefaultLargest = 10
+
+// jobName names the collector in the background job metrics
+const jobName = "storage-stats"
+
+var log = logger.For("storagestats")
+
+// DocumentSize is the estimated stored size of one document
+type DocumentSize struct {
+	ID    string `json:"id"`
+	Bytes int64  `json:"bytes"`
+}
+
+// CollectionStats describes one collection as of ComputedAt
+type CollectionStats struct {
+	ComputedAt time.Time `json:"computed_at"`
+	Name       string    `json:"name"`
+	// Error is why the last inspection failed; the counts are then those of
+	// the inspection before it, if any
+	Error string `json:"error,omitempty"`
+	// Largest lists the largest documents, for collections whose documents
+	// grow with use
+	Largest   []DocumentSize `json:"largest,omitempty"`
+	Documents int64          `json:"documents"`
+	Bytes     int64          `json:"bytes"`
+	// Orphans counts the documents of a link that no longer exists
+	Orphans int64 `json:"orphans"`
+}
+
+// Snapshot is the latest statistics of every collection
+type Snapshot struct {
+	// UpdatedAt is when the most recent collection was inspected
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Collections []CollectionStats `json:"collections"`
+	// Complete is false until every collection has been inspected once
+	Complete bool `json:"complete"`
+}
+
+// Inspector computes the statistics of the collections of one storage backend
+type Inspector interface {
+	// Collections names the collections to inspect
+	Collections() []string
+	// Inspect counts the documents of a collection, keeping its limit largest
+	Inspect(ctx context.Context, collection string, limit int) (CollectionStats, error)
+}
+
+// Option configures a Collector
+type Option func(*Collector)
+
+// WithInterval sets how often a collection is inspected
+func WithInterval(interval time.Duration) Option {
+	return func(c *Collector) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
+
+// WithLargest sets how many of the largest documents are kept per collection
+func WithLargest(n int) Option {
+	return func(c *Collector) {
+		if n >= 0 {
+			c.largest = n
+		}
+	}
+}
+
+// Collector inspects the collections of an Inspector in turn in the
+// background and keeps the latest result of each
+type Collector struct {
+	inspector Inspector
+	now       func() time.Time
+	stats     map[string]CollectionStats
+	cancel    context.CancelFunc
+	done      chan struct{}
+	interval  time.Duration
+	largest   int
+	next      int
+	mutex     sync.RWMutex
+}
+
+// NewCollector creates a collector for the collections of inspector
+func NewCollector(inspector Inspector, opts ...Option) *Collector {
+	c := &Collector{
+		inspector: inspector,
+		now:       time.Now,
+		stats:     make(map[string]CollectionStats),
+		interval:  DefaultInterval,
+		largest:   DefaultLargest,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Refresh inspects the next collection in turn
+func (c *Collector) Refresh(ctx context.Context) error {
+	collections := c.inspector.Collections()
+	if len(collections) == 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	name := collections[c.next%len(collections)]
+	c.next = (c.next + 1) % len(collections)
+	c.mutex.Unlock()
+
+	stats, err := c.inspector.Inspect(ctx, name, c.largest)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		// Keep the last good counts, marked with why they are stale
+		previous := c.stats[name]
+		previous.Name = name
+		previous.Error = err.Error()
+		c.stats[name] = previous
+		return err
+	}
+	stats.Name = name
+	stats.ComputedAt = c.now()
+	c.stats[name] = stats
+	return nil
+}
+
+// Snapshot returns the latest statistics, and false before any collection
+// has been inspected
+func (c *Collector) Snapshot() (Snapshot, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var snapshot Snapshot
+	if len(c.stats) == 0 {
+		return snapshot, false
+	}
+	snapshot.Complete = true
+	for _, name := range c.inspector.Collections() {
+		stats, ok := c.stats[name]
+		if !ok || stats.ComputedAt.IsZero() {
+			snapshot.Complete = false
+			if !ok {
+				continue
+			}
+		}
+		if stats.ComputedAt.After(snapshot.UpdatedAt) {
+			snapshot.UpdatedAt = stats.ComputedAt
+		}
+		snapshot.Collections = append(snapshot.Collections, stats)
+	}
+	sort.Slice(snapshot.Collections, func(i, j int) bool {
+		return snapshot.Collections[i].Name < snapshot.Collections[j].Name
+	})
+	return snapshot, true
+}
+
+// Start inspects the collections in the background until Stop. The first
+// collection is inspected right away.
+func (c *Collector) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go c.run(ctx)
+	return nil
+}
+
+// Stop ends the background inspection, waiting for the current one to finish
+func (c *Collector) Stop(ctx context.Context) error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run inspects one collection per interval
+func (c *Collector) run(ctx context.Context) {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Refresh(ctx); ctx.Err() == nil {
+			jobs.Record(jobName, err)
+			if err != nil {
+				log.Error("Failed to compute storage statistics", err, logger.Fields{"job": jobName})
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
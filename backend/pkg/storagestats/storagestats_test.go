@@ -0,0 +1,79 @@
+package storagestats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInspector returns canned statistics, or err when set
+type fakeInspector struct {
+	err       error
+	documents map[string]int64
+	inspected []string
+}
+
+func (f *fakeInspector) Collections() []string {
+	return []string{"links", "link_stats"}
+}
+
+func (f *fakeInspector) Inspect(ctx context.Context, collection string, limit int) (CollectionStats, error) {
+	f.inspected = append(f.inspected, collection)
+	if f.err != nil {
+		return CollectionStats{}, f.err
+	}
+	return CollectionStats{Documents: f.documents[collection]}, nil
+}
+
+func TestCollectorRefreshesInTurn(t *testing.T) {
+	inspector := &fakeInspector{documents: map[string]int64{"links": 3, "link_stats": 2}}
+	c := NewCollector(inspector)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, ok := c.Snapshot()
+	assert.False(t, ok)
+
+	require.NoError(t, c.Refresh(ctx))
+	snapshot, ok := c.Snapshot()
+	require.True(t, ok)
+	assert.False(t, snapshot.Complete)
+	require.Len(t, snapshot.Collections, 1)
+	assert.Equal(t, "links", snapshot.Collections[0].Name)
+	assert.Equal(t, int64(3), snapshot.Collections[0].Documents)
+
+	require.NoError(t, c.Refresh(ctx))
+	snapshot, _ = c.Snapshot()
+	assert.True(t, snapshot.Complete)
+	assert.Equal(t, now, snapshot.UpdatedAt)
+	assert.Equal(t, []string{"links", "link_stats"}, inspector.inspected)
+
+	// A failed inspection keeps the last counts and says why they are stale
+	inspector.err = errors.New("deadline exceeded")
+	assert.Error(t, c.Refresh(ctx))
+	snapshot, _ = c.Snapshot()
+	require.Len(t, snapshot.Collections, 2)
+	assert.Equal(t, "links", snapshot.Collections[1].Name)
+	assert.Equal(t, int64(3), snapshot.Collections[1].Documents)
+	assert.Equal(t, "deadline exceeded", snapshot.Collections[1].Error)
+	assert.True(t, snapshot.Complete)
+}
+
+func TestCollectorStartStop(t *testing.T) {
+	inspector := &fakeInspector{}
+	c := NewCollector(inspector, WithInterval(time.Hour))
+	require.NoError(t, c.Start(context.Background()))
+	assert.Eventually(t, func() bool {
+		_, ok := c.Snapshot()
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, c.Stop(ctx))
+}
@@ -0,0 +1,158 @@
+// Package urlnorm puts destination URLs in a canonical form before they are
+// stored, so one destination is always stored the same way and links that
+// share it are recognized as duplicates.
+//
+// Only the parts of a URL that never change where it leads are rewritten: the
+// scheme and host are lowercased and default ports dropped. The path and
+// fragment are kept byte for byte, so template placeholders such as {id}
+// survive, and an empty path is left empty so links stored before
+// normalization still match. Tracking query parameters are optionally removed.
+package urlnorm
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DefaultTrackingParams are the query parameters that only track where a
+// click came from. A trailing * matches every parameter with that prefix.
+var DefaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid",
+	"mc_cid", "mc_eid", "_hsenc", "_hsmi", "igshid", "yclid",
+}
+
+// defaultPorts are the ports implied by each scheme
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalizer rewrites URLs into canonical form
+type Normalizer struct {
+	// TrackingParams are removed from the query when StripTracking is set
+	TrackingParams []string
+	StripTracking  bool
+}
+
+// Default returns the normalizer used when none is configured; it keeps
+// tracking parameters
+func Default() Normalizer {
+	return Normalizer{TrackingParams: DefaultTrackingParams}
+}
+
+// Normalize returns raw in canonical form. Strings that are not absolute
+// URLs are only trimmed, leaving their rejection to URL validation.
+func (n Normalizer) Normalize(raw string) string {
+	raw = strings.TrimSpace(raw)
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || scheme == "" {
+		return raw
+	}
+	scheme = strings.ToLower(scheme)
+
+	// The authority runs up to the path, query or fragment
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	authority, tail := rest[:end], rest[end:]
+	userinfo, host := "", authority
+	if at := strings.LastIndex(authority, "@"); at >= 0 {
+		userinfo, host = authority[:at+1], authority[at+1:]
+	}
+	host = stripDefaultPort(strings.ToLower(host), scheme)
+
+	if n.StripTracking {
+		tail = n.stripTracking(tail)
+	}
+	return scheme + "://" + userinfo + host + tail
+}
+
+// stripDefaultPort drops the port the scheme implies, and an empty port
+func stripDefaultPort(host, scheme string) string {
+	i := strings.LastIndex(host, ":")
+	// A colon inside brackets belongs to an IPv6 address, not a port
+	if i < 0 || strings.LastIndex(host, "]") > i {
+		return host
+	}
+	if port := host[i+1:]; port == "" || port == defaultPorts[scheme] {
+		return host[:i]
+	}
+	return host
+}
+
+// stripTracking removes tracking parameters from the query of a path,
+// keeping the order and encoding of the others
+func (n Normalizer) stripTracking(tail string) string {
+	tail, fragment, hasFragment := strings.Cut(tail, "#")
+	path, query, hasQuery := strings.Cut(tail, "?")
+	if hasQuery {
+		var kept []string
+		for _, pair := range strings.Split(query, "&") {
+			if pair != "" && !n.isTracking(pair) {
+				kept = append(kept, pair)
+			}
+		}
+		tail = path
+		if len(kept) > 0 {
+			tail += "?" + strings.Join(kept, "&")
+		}
+	}
+	if hasFragment {
+		tail += "#" + fragment
+	}
+	return tail
+}
+
+// isTracking reports whether a key=value pair is a tracking parameter
+func (n Normalizer) isTracking(pair string) bool {
+	key, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		key = unescaped
+	}
+	key = strings.ToLower(key)
+	for _, param := range n.TrackingParams {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+	return false
+}
+
+// Equivalence decides which destinations lead to the same place even though
+// they are stored differently, to find links that could be merged. Unlike
+// normalization it may conflate URLs that differ in principle, so it is only
+// used to compare them and never to rewrite them.
+type Equivalence struct {
+	Normalizer
+	// IgnoreScheme treats http and https as the same destination
+	IgnoreScheme bool
+	// IgnoreTrailingSlash treats a path with a trailing slash as the same as
+	// the path without it
+	IgnoreTrailingSlash bool
+}
+
+// Key returns a string that is equal for equivalent destinations
+func (e Equivalence) Key(raw string) string {
+	key := e.Normalize(raw)
+	scheme, rest, ok := strings.Cut(key, "://")
+	if !ok {
+		return key
+	}
+	if e.IgnoreScheme && (scheme == "http" || scheme == "https") {
+		scheme = "https"
+	}
+	if e.IgnoreTrailingSlash {
+		end := strings.IndexAny(rest, "?#")
+		if end < 0 {
+			end = len(rest)
+		}
+		rest = strings.TrimRight(rest[:end], "/") + rest[end:]
+	}
+	return scheme + "://" + rest
+}
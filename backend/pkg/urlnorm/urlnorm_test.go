@@ -0,0 +1,78 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		strip bool
+		want  string
+	}{
+		{name: "Whitespace", raw: "  https://example.com/docs \n", want: "https://example.com/docs"},
+		{name: "Scheme and host case", raw: "HTTPS://Docs.Example.COM/Guide/Intro", want: "https://docs.example.com/Guide/Intro"},
+		{name: "Default HTTPS port", raw: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "Default HTTP port", raw: "http://example.com:80?q=1", want: "http://example.com?q=1"},
+		{name: "Other port kept", raw: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "Port of the other scheme kept", raw: "https://example.com:80/a", want: "https://example.com:80/a"},
+		{name: "Empty port", raw: "https://example.com:/a", want: "https://example.com/a"},
+		{name: "Empty path kept", raw: "https://Example.com", want: "https://example.com"},
+		{name: "Userinfo kept", raw: "https://User@Example.com:443/a", want: "https://User@example.com/a"},
+		{name: "IPv6 host", raw: "http://[::1]:80/a", want: "http://[::1]/a"},
+		{name: "IPv6 host without port", raw: "http://[::1]/a", want: "http://[::1]/a"},
+		{name: "Template placeholders kept", raw: "https://Jira.example.com/browse/{id}", want: "https://jira.example.com/browse/{id}"},
+		{name: "Encoding kept", raw: "https://example.com/a%2Fb?q=a%20b#Top", want: "https://example.com/a%2Fb?q=a%20b#Top"},
+		{name: "Tracking kept by default", raw: "https://example.com/?utm_source=mail", want: "https://example.com/?utm_source=mail"},
+		{
+			name:  "Tracking stripped",
+			raw:   "https://example.com/post?id=7&utm_source=mail&UTM_Medium=x&fbclid=abc#comments",
+			strip: true,
+			want:  "https://example.com/post?id=7#comments",
+		},
+		{name: "Only tracking", raw: "https://example.com/post?gclid=1&utm_campaign=x", strip: true, want: "https://example.com/post"},
+		{name: "Encoded tracking key", raw: "https://example.com/?utm%5Fsource=x&a=1", strip: true, want: "https://example.com/?a=1"},
+		{name: "Not a URL", raw: " javascript:alert(1) ", want: "javascript:alert(1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := Default()
+			n.StripTracking = tt.strip
+			assert.Equal(t, tt.want, n.Normalize(tt.raw))
+		})
+	}
+}
+
+func TestEquivalenceKey(t *testing.T) {
+	loose := Equivalence{Normalizer: Default(), IgnoreScheme: true, IgnoreTrailingSlash: true}
+	loose.StripTracking = true
+
+	same := [][]string{
+		{"http://Example.com/docs", "https://example.com/docs/", "https://example.com:443/docs?utm_source=mail"},
+		{"https://example.com", "https://example.com/", "http://example.com:80/"},
+		{"https://example.com/a/?q=1#top", "http://example.com/a?q=1#top"},
+	}
+	for _, urls := range same {
+		for _, u := range urls[1:] {
+			assert.Equal(t, loose.Key(urls[0]), loose.Key(u), u)
+		}
+	}
+
+	different := [][2]string{
+		{"https://example.com/docs", "https://example.com/Docs"},
+		{"https://example.com/a?q=1", "https://example.com/a?q=2"},
+		{"ftp://example.com/a", "https://example.com/a"},
+	}
+	for _, pair := range different {
+		assert.NotEqual(t, loose.Key(pair[0]), loose.Key(pair[1]), pair[1])
+	}
+
+	// Without the options only normalization applies
+	strict := Equivalence{Normalizer: Default()}
+	assert.NotEqual(t, strict.Key("http://example.com/a"), strict.Key("https://example.com/a"))
+	assert.NotEqual(t, strict.Key("https://example.com/a/"), strict.Key("https://example.com/a"))
+	assert.NotEqual(t, strict.Key("https://example.com/a?utm_source=x"), strict.Key("https://example.com/a"))
+}
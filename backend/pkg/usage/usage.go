@@ -0,0 +1,195 @@
+// Package usage counts how often product features are used, to guide which
+// ones to improve. Only coarse events are counted, such as "a link was
+// created through the API" or "search was used", never who used a feature
+// or on what: an event is a name and a count per day, with no user, link,
+// address or other detail attached.
+//
+// Counting is on unless turned off with PRODUCT_METRICS=false, and clients
+// opt out of it per request with the Global Privacy Control (Sec-GPC: 1) or
+// Do Not Track (DNT: 1) header.
+package usage
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+)
+
+// Events counted. Links created are counted per channel: "ui" for the web
+// app, "cli" for scripts and command-line tools, "api" for API tokens.
+const (
+	EventLinkCreatedUI  = "link_created_ui"
+	EventLinkCreatedCLI = "link_created_cli"
+	EventLinkCreatedAPI = "link_created_api"
+	EventSearch         = "search"
+	EventBulkResolve    = "bulk_resolve"
+)
+
+// DateLayout is the layout of the days events are counted by, in UTC
+const DateLayout = "2006-01-02"
+
+// DefaultFlushInterval is how often counts are written by default
+const DefaultFlushInterval = time.Minute
+
+// jobName names the recorder in the background job metrics
+const jobName = "product-metrics"
+
+var log = logger.For("usage")
+
+// Store adds counted events to the totals of their day
+type Store interface {
+	Add(ctx context.Context, day string, counts map[string]int64) error
+}
+
+// OptedOut reports whether the client of r opted out of being counted
+func OptedOut(r *http.Request) bool {
+	return strings.TrimSpace(r.Header.Get("Sec-GPC")) == "1" || strings.TrimSpace(r.Header.Get("DNT")) == "1"
+}
+
+// LinkCreatedEvent returns the event of a link created by the request:
+// through the API with an API token, from a browser, or else from a script
+// or command-line tool
+func LinkCreatedEvent(r *http.Request, apiToken bool) string {
+	switch {
+	case apiToken:
+		return EventLinkCreatedAPI
+	case strings.HasPrefix(r.UserAgent(), "Mozilla/"):
+		return EventLinkCreatedUI
+	default:
+		return EventLinkCreatedCLI
+	}
+}
+
+// Option configures a Recorder
+type Option func(*Recorder)
+
+// WithFlushInterval sets how often counts are written
+func WithFlushInterval(interval time.Duration) Option {
+	return func(r *Recorder) {
+		if interval > 0 {
+			r.interval = interval
+		}
+	}
+}
+
+// Recorder counts events in memory and adds them to the store in the
+// background. Counts not yet written are lost if the process crashes.
+type Recorder struct {
+	store    Store
+	now      func() time.Time
+	counts   map[string]map[string]int64
+	cancel   context.CancelFunc
+	done     chan struct{}
+	interval time.Duration
+	mutex    sync.Mutex
+}
+
+// NewRecorder creates a recorder adding counts to store
+func NewRecorder(store Store, opts ...Option) *Recorder {
+	r := &Recorder{
+		store:    store,
+		now:      time.Now,
+		counts:   make(map[string]map[string]int64),
+		interval: DefaultFlushInterval,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Record counts one event today. A nil Recorder counts nothing.
+func (r *Recorder) Record(event string) {
+	if r == nil {
+		return
+	}
+	day := r.now().UTC().Format(DateLayout)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.counts[day] == nil {
+		r.counts[day] = make(map[string]int64)
+	}
+	r.counts[day][event]++
+}
+
+// Flush adds the counts recorded so far to the store. Counts that fail to
+// be written are kept for the next flush.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mutex.Lock()
+	pending := r.counts
+	r.counts = make(map[string]map[string]int64)
+	r.mutex.Unlock()
+
+	var firstErr error
+	for day, counts := range pending {
+		if err := r.store.Add(ctx, day, counts); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			r.restore(day, counts)
+		}
+	}
+	return firstErr
+}
+
+// restore puts counts that failed to be written back
+func (r *Recorder) restore(day string, counts map[string]int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.counts[day] == nil {
+		r.counts[day] = maps.Clone(counts)
+		return
+	}
+	for event, n := range counts {
+		r.counts[day][event] += n
+	}
+}
+
+// Start writes the counts in the background until Stop
+func (r *Recorder) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.run(ctx)
+	return nil
+}
+
+// Stop ends the background writing, writing the remaining counts
+func (r *Recorder) Stop(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return r.Flush(ctx)
+}
+
+// run flushes the counts every interval until ctx is canceled
+func (r *Recorder) run(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Flush(ctx); ctx.Err() == nil {
+				jobs.Record(jobName, err)
+				if err != nil {
+					log.Error("Failed to write product metrics", err, logger.Fields{"job": jobName})
+				}
+			}
+		}
+	}
+}
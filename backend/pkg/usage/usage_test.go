@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	err  error
+	days map[string]map[string]int64
+}
+
+func (s *fakeStore) Add(_ context.Context, day string, counts map[string]int64) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.days == nil {
+		s.days = make(map[string]map[string]int64)
+	}
+	if s.days[day] == nil {
+		s.days[day] = make(map[string]int64)
+	}
+	for event, n := range counts {
+		s.days[day][event] += n
+	}
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	store := &fakeStore{}
+	recorder := NewRecorder(store)
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	recorder.Record(EventSearch)
+	recorder.Record(EventSearch)
+	recorder.Record(EventLinkCreatedUI)
+	now = now.Add(2 * time.Hour)
+	recorder.Record(EventSearch)
+
+	// Counts that fail to be written are kept for the next flush
+	store.err = errors.New("unavailable")
+	require.Error(t, recorder.Flush(ctx))
+	recorder.Record(EventSearch)
+	store.err = nil
+	require.NoError(t, recorder.Flush(ctx))
+
+	assert.Equal(t, map[string]map[string]int64{
+		"2026-03-01": {EventSearch: 2, EventLinkCreatedUI: 1},
+		"2026-03-02": {EventSearch: 2},
+	}, store.days)
+
+	require.NoError(t, recorder.Flush(ctx))
+	assert.Equal(t, int64(2), store.days["2026-03-02"][EventSearch], "flushed counts are not written twice")
+
+	var disabled *Recorder
+	assert.NotPanics(t, func() { disabled.Record(EventSearch) })
+}
+
+func TestOptedOut(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/api/links/search", nil)
+	assert.False(t, OptedOut(req))
+	req.Header.Set("DNT", "1")
+	assert.True(t, OptedOut(req))
+	req.Header.Del("DNT")
+	req.Header.Set("Sec-GPC", "1")
+	assert.True(t, OptedOut(req))
+}
+
+func TestLinkCreatedEvent(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/api/links", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64)")
+	assert.Equal(t, EventLinkCreatedUI, LinkCreatedEvent(req, false))
+	assert.Equal(t, EventLinkCreatedAPI, LinkCreatedEvent(req, true))
+	req.Header.Set("User-Agent", "curl/8.5.0")
+	assert.Equal(t, EventLinkCreatedCLI, LinkCreatedEvent(req, false))
+}
@@ -0,0 +1,121 @@
+// Package useragent classifies User-Agent headers into the browser, operating
+// system and device type breakdowns of link statistics.
+//
+// Statistics depend only on the Parser interface, so the built-in rules can be
+// swapped for a more thorough parser without touching the click pipeline.
+package useragent
+
+import (
+	"strings"
+)
+
+// Device types
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// Other is reported for a non-empty User-Agent that matches no known family
+const Other = "Other"
+
+// Info is what a User-Agent header reveals about the client
+type Info struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+// Parser classifies User-Agent headers. Implementations report empty fields
+// for an empty header and Other for families they do not know.
+type Parser interface {
+	Parse(ua string) Info
+}
+
+// Rules is the built-in Parser. It recognizes the common browsers, operating
+// systems and crawlers by the tokens they send.
+type Rules struct{}
+
+// Default is the parser used when none is configured
+var Default Parser = Rules{}
+
+// rule maps a User-Agent token to the family it identifies. Rules are tried
+// in order, so tokens that other clients also send come last.
+type rule struct {
+	token  string
+	family string
+}
+
+var browserRules = []rule{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"opr/", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+var osRules = []rule{
+	{"windows", "Windows"},
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"ipod", "iOS"},
+	{"mac os x", "macOS"},
+	{"android", "Android"},
+	{"cros", "ChromeOS"},
+	{"linux", "Linux"},
+}
+
+var botTokens = []string{"bot", "crawler", "spider", "slurp", "preview", "curl/", "wget/", "python-requests", "go-http-client"}
+
+// Parse classifies a User-Agent header with the Default parser
+func Parse(ua string) Info {
+	return Default.Parse(ua)
+}
+
+// Parse classifies a User-Agent header. Fields are empty when the header is,
+// and Other when it names an unknown family.
+func (Rules) Parse(ua string) Info {
+	if strings.TrimSpace(ua) == "" {
+		return Info{}
+	}
+	lower := strings.ToLower(ua)
+	return Info{
+		Browser: match(lower, browserRules),
+		OS:      match(lower, osRules),
+		Device:  device(lower),
+	}
+}
+
+// match returns the family of the first rule whose token ua contains
+func match(ua string, rules []rule) string {
+	for _, r := range rules {
+		if strings.Contains(ua, r.token) {
+			return r.family
+		}
+	}
+	return Other
+}
+
+// device returns the device type of a lowercased User-Agent
+func device(ua string) string {
+	for _, token := range botTokens {
+		if strings.Contains(ua, token) {
+			return DeviceBot
+		}
+	}
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return DeviceTablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		return DeviceMobile
+	}
+	return DeviceDesktop
+}
@@ -0,0 +1,103 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of the public keys passkeys may have
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key types and curves
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+	coseCurveP256  = 1
+	coseCurveEd255 = 6
+)
+
+// publicKey is a credential public key with its algorithm
+type publicKey struct {
+	key crypto.PublicKey
+	alg int64
+}
+
+// parsePublicKey parses a COSE_Key as stored with a credential
+func parsePublicKey(data []byte) (*publicKey, error) {
+	item, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	return publicKeyFromCOSE(item)
+}
+
+// publicKeyFromCOSE converts a decoded COSE_Key into a public key
+func publicKeyFromCOSE(item any) (*publicKey, error) {
+	fields, ok := item.(map[any]any)
+	if !ok {
+		return nil, errors.New("public key is not a COSE key")
+	}
+	kty, _ := fields[int64(1)].(int64)
+	alg, _ := fields[int64(3)].(int64)
+	param := func(label int64) []byte {
+		value, _ := fields[label].([]byte)
+		return value
+	}
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		x, y := param(-2), param(-3)
+		if crv, _ := fields[int64(-1)].(int64); crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("ES256 key is not a P-256 point")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		// Only on-curve points survive the conversion to an ECDH key
+		if _, err := key.ECDH(); err != nil {
+			return nil, errors.New("ES256 key is not on the curve")
+		}
+		return &publicKey{key: key, alg: alg}, nil
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		x := param(-2)
+		if crv, _ := fields[int64(-1)].(int64); crv != coseCurveEd255 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("EdDSA key is not an Ed25519 key")
+		}
+		return &publicKey{key: ed25519.PublicKey(x), alg: alg}, nil
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, e := param(-1), param(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("RS256 key must have a modulus of at least 2048 bits")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		return &publicKey{key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, alg: alg}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", kty, alg)
+	}
+}
+
+// verify checks sig over data
+func (k *publicKey) verify(data, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,404 @@
+// Package webauthn registers passkeys and verifies the assertions made with
+// them, as a second factor for accounts that already signed in.
+//
+// Only what a relying party needs for that is implemented. Attestation is
+// not requested and attestation statements are not verified: a passkey is
+// trusted because a signed-in user registered it, not because of the model
+// of its authenticator. Options and credentials use the JSON encoding of
+// WebAuthn Level 3, with binary fields in unpadded base64url, so browsers
+// can pass them through PublicKeyCredential.parseCreationOptionsFromJSON and
+// toJSON.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Timeout is how long browsers are asked to wait for the user
+const Timeout = 5 * time.Minute
+
+// Flags of authenticator data
+const (
+	flagUserPresent   = 0x01
+	flagAttestedData  = 0x40
+	flagExtensionData = 0x80
+)
+
+// Client data types of registrations and assertions
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+// ErrSignCount reports an assertion whose signature counter did not
+// advance, which happens when an authenticator has been cloned
+var ErrSignCount = errors.New("signature counter did not increase")
+
+// RelyingParty is the service passkeys are registered with
+type RelyingParty struct {
+	// ID is the domain passkeys are scoped to, such as "go.example.com"
+	ID string
+	// Name is shown to users while they register a passkey
+	Name string
+	// Origins lists the origins of the pages allowed to use passkeys, such
+	// as "https://go.example.com"
+	Origins []string
+}
+
+// User is the account a passkey is registered for
+type User struct {
+	// ID identifies the account; it must not contain personal information
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a registered passkey
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE_Key of the passkey
+	PublicKey []byte
+	SignCount uint32
+}
+
+// Descriptor names a credential in options
+type Descriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// descriptors returns the descriptors of the credential IDs
+func descriptors(ids [][]byte) []Descriptor {
+	result := make([]Descriptor, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, Descriptor{Type: "public-key", ID: encode(id)})
+	}
+	return result
+}
+
+// CreationOptions are the options of navigator.credentials.create
+type CreationOptions struct {
+	RP struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	Challenge        string `json:"challenge"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int64        `json:"timeout"`
+	ExcludeCredentials     []Descriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// RequestOptions are the options of navigator.credentials.get
+type RequestOptions struct {
+	Challenge        string       `json:"challenge"`
+	RPID             string       `json:"rpId"`
+	AllowCredentials []Descriptor `json:"allowCredentials"`
+	UserVerification string       `json:"userVerification"`
+	Timeout          int64        `json:"timeout"`
+}
+
+// CreationOptions returns the options registering a passkey for user,
+// excluding the credentials the user already has
+func (rp RelyingParty) CreationOptions(challenge []byte, user User, exclude [][]byte) CreationOptions {
+	var options CreationOptions
+	options.RP.ID, options.RP.Name = rp.ID, rp.Name
+	options.User.ID, options.User.Name, options.User.DisplayName = encode(user.ID), user.Name, user.DisplayName
+	options.Challenge = encode(challenge)
+	for _, alg := range []int{AlgES256, AlgEdDSA, AlgRS256} {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+	options.Timeout = Timeout.Milliseconds()
+	options.ExcludeCredentials = descriptors(exclude)
+	options.AuthenticatorSelection.ResidentKey = "preferred"
+	options.AuthenticatorSelection.UserVerification = "preferred"
+	options.Attestation = "none"
+	return options
+}
+
+// RequestOptions returns the options asserting one of the allowed credentials
+func (rp RelyingParty) RequestOptions(challenge []byte, allow [][]byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        encode(challenge),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "preferred",
+		Timeout:          Timeout.Milliseconds(),
+	}
+}
+
+// CredentialResponse is a PublicKeyCredential as sent by the browser
+type CredentialResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON string `json:"clientDataJSON"`
+		// AttestationObject is set by registrations
+		AttestationObject string `json:"attestationObject,omitempty"`
+		// AuthenticatorData and Signature are set by assertions
+		AuthenticatorData string `json:"authenticatorData,omitempty"`
+		Signature         string `json:"signature,omitempty"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// clientData is the decoded client data of a response
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// CredentialID returns the ID of the credential that made the response
+func (c *CredentialResponse) CredentialID() ([]byte, error) {
+	id, err := decode(c.RawID)
+	if err != nil || len(id) == 0 {
+		return nil, errors.New("credential has no valid ID")
+	}
+	return id, nil
+}
+
+// Challenge returns the challenge the response answers, so the caller can
+// look up or check it before verifying the response
+func (c *CredentialResponse) Challenge() ([]byte, error) {
+	data, _, err := c.clientData()
+	if err != nil {
+		return nil, err
+	}
+	return decode(data.Challenge)
+}
+
+// clientData decodes the client data of the response
+func (c *CredentialResponse) clientData() (*clientData, []byte, error) {
+	raw, err := decode(c.Response.ClientDataJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid client data: %w", err)
+	}
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, nil, fmt.Errorf("invalid client data: %w", err)
+	}
+	return &data, raw, nil
+}
+
+// verifyClientData checks the client data of a response of the given type
+// to challenge, returning its raw bytes
+func (rp RelyingParty) verifyClientData(c *CredentialResponse, ceremony string, challenge []byte) ([]byte, error) {
+	if c.Type != "public-key" {
+		return nil, fmt.Errorf("unsupported credential type '%s'", c.Type)
+	}
+	data, raw, err := c.clientData()
+	if err != nil {
+		return nil, err
+	}
+	if data.Type != ceremony {
+		return nil, fmt.Errorf("client data type is '%s', expected '%s'", data.Type, ceremony)
+	}
+	got, err := decode(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return nil, errors.New("response does not answer the challenge")
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return nil, fmt.Errorf("origin '%s' is not allowed", data.Origin)
+	}
+	return raw, nil
+}
+
+// authenticatorData is decoded authenticator data
+type authenticatorData struct {
+	credentialID []byte
+	publicKey    []byte
+	rpIDHash     []byte
+	signCount    uint32
+	flags        byte
+}
+
+// parseAuthenticatorData decodes authenticator data, including the attested
+// credential when present
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+	parsed := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+	if parsed.flags&flagAttestedData != 0 {
+		// AAGUID, credential ID length and credential ID
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data is too short")
+		}
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if length == 0 || len(rest) < length {
+			return nil, errors.New("invalid credential ID in attested credential data")
+		}
+		parsed.credentialID = rest[:length]
+		rest = rest[length:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		parsed.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if parsed.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extension data: %w", err)
+		}
+		rest = after
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("authenticator data has trailing bytes")
+	}
+	return parsed, nil
+}
+
+// verifyAuthenticatorData checks that the data is scoped to the relying
+// party and that the user was present
+func (rp RelyingParty) verifyAuthenticatorData(data *authenticatorData) error {
+	hash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.rpIDHash, hash[:]) {
+		return errors.New("credential is scoped to another relying party")
+	}
+	if data.flags&flagUserPresent == 0 {
+		return errors.New("user was not present")
+	}
+	return nil
+}
+
+// VerifyRegistration verifies the response of navigator.credentials.create
+// to challenge and returns the registered passkey
+func (rp RelyingParty) VerifyRegistration(c *CredentialResponse, challenge []byte) (*Credential, error) {
+	if _, err := rp.verifyClientData(c, typeCreate, challenge); err != nil {
+		return nil, err
+	}
+	raw, err := decode(c.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	item, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	attestation, _ := item.(map[any]any)
+	authData, _ := attestation["authData"].([]byte)
+	if authData == nil {
+		return nil, errors.New("attestation object has no authenticator data")
+	}
+
+	data, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(data); err != nil {
+		return nil, err
+	}
+	if data.credentialID == nil {
+		return nil, errors.New("registration has no attested credential")
+	}
+	if id, err := c.CredentialID(); err != nil || !bytes.Equal(id, data.credentialID) {
+		return nil, errors.New("credential ID does not match the attested credential")
+	}
+	if _, err := parsePublicKey(data.publicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:        slices.Clone(data.credentialID),
+		PublicKey: slices.Clone(data.publicKey),
+		SignCount: data.signCount,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of navigator.credentials.get to
+// challenge, made with credential, and returns the credential's new
+// signature count. A counter that did not advance fails with ErrSignCount;
+// authenticators that keep no counter always report zero.
+func (rp RelyingParty) VerifyAssertion(c *CredentialResponse, challenge []byte, credential Credential) (uint32, error) {
+	clientData, err := rp.verifyClientData(c, typeGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+	if id, err := c.CredentialID(); err != nil || !bytes.Equal(id, credential.ID) {
+		return 0, errors.New("response was made with another credential")
+	}
+	authData, err := decode(c.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("invalid authenticator data: %w", err)
+	}
+	data, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(data); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	signature, err := decode(c.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("invalid signature: %w", err)
+	}
+	clientHash := sha256.Sum256(clientData)
+	if !key.verify(append(slices.Clone(authData), clientHash[:]...), signature) {
+		return 0, errors.New("invalid signature")
+	}
+
+	if (data.signCount != 0 || credential.SignCount != 0) && data.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+	return data.signCount, nil
+}
+
+// encode encodes binary fields as unpadded base64url
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decode decodes a base64url field, with or without padding
+func decode(field string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(field, "="))
+}
+
+// EncodeID encodes a credential ID as it is stored and sent
+func EncodeID(id []byte) string {
+	return encode(id)
+}
+
+// DecodeID decodes a credential ID encoded by EncodeID
+func DecodeID(id string) ([]byte, error) {
+	return decode(id)
+}
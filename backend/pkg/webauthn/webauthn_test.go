@@ -0,0 +1,176 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRP = RelyingParty{ID: "go.example.com", Name: "GoLink", Origins: []string{"https://go.example.com"}}
+
+// encodeCBOR encodes the values authenticators send, with map keys in
+// canonical order
+func encodeCBOR(value any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		default:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		}
+	}
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[any]any:
+		var entries [][2][]byte
+		for key, item := range v {
+			entries = append(entries, [2][]byte{encodeCBOR(key), encodeCBOR(item)})
+		}
+		sort.Slice(entries, func(i, j int) bool { return string(entries[i][0]) < string(entries[j][0]) })
+		out := head(5, uint64(len(entries)))
+		for _, entry := range entries {
+			out = append(append(out, entry[0]...), entry[1]...)
+		}
+		return out
+	}
+	panic("unsupported value")
+}
+
+// authenticator is a software passkey
+type authenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &authenticator{key: key, id: []byte("credential-1")}
+}
+
+func (a *authenticator) clientData(ceremony string, challenge []byte, origin string) []byte {
+	data, _ := json.Marshal(clientData{Type: ceremony, Challenge: encode(challenge), Origin: origin})
+	return data
+}
+
+func (a *authenticator) authData(rpID string, flags byte, attested bool) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	data := append(hash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, encodeCBOR(map[any]any{
+			1: coseKeyTypeEC2, 3: AlgES256, -1: coseCurveP256,
+			-2: a.key.X.FillBytes(make([]byte, 32)), -3: a.key.Y.FillBytes(make([]byte, 32)),
+		})...)
+	}
+	return data
+}
+
+func (a *authenticator) register(challenge []byte) *CredentialResponse {
+	var resp CredentialResponse
+	resp.ID, resp.RawID, resp.Type = encode(a.id), encode(a.id), "public-key"
+	resp.Response.ClientDataJSON = encode(a.clientData(typeCreate, challenge, testRP.Origins[0]))
+	resp.Response.AttestationObject = encode(encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": a.authData(testRP.ID, flagUserPresent|flagAttestedData, true),
+	}))
+	return &resp
+}
+
+func (a *authenticator) assert(t *testing.T, challenge []byte, rpID, origin string) *CredentialResponse {
+	a.signCount++
+	clientData := a.clientData(typeGet, challenge, origin)
+	authData := a.authData(rpID, flagUserPresent, false)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	var resp CredentialResponse
+	resp.ID, resp.RawID, resp.Type = encode(a.id), encode(a.id), "public-key"
+	resp.Response.ClientDataJSON = encode(clientData)
+	resp.Response.AuthenticatorData = encode(authData)
+	resp.Response.Signature = encode(sig)
+	return &resp
+}
+
+func TestRegisterAndAssert(t *testing.T) {
+	device := newAuthenticator(t)
+	challenge := []byte("registration-challenge")
+
+	resp := device.register(challenge)
+	got, err := resp.Challenge()
+	require.NoError(t, err)
+	assert.Equal(t, challenge, got)
+
+	credential, err := testRP.VerifyRegistration(resp, challenge)
+	require.NoError(t, err)
+	assert.Equal(t, device.id, credential.ID)
+
+	_, err = testRP.VerifyRegistration(resp, []byte("another-challenge"))
+	assert.Error(t, err, "a registration answers one challenge only")
+
+	login := []byte("assertion-challenge")
+	count, err := testRP.VerifyAssertion(device.assert(t, login, testRP.ID, testRP.Origins[0]), login, *credential)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), count)
+	credential.SignCount = count
+
+	t.Run("Wrong origin", func(t *testing.T) {
+		_, err := testRP.VerifyAssertion(device.assert(t, login, testRP.ID, "https://evil.example"), login, *credential)
+		assert.ErrorContains(t, err, "origin")
+	})
+	t.Run("Wrong relying party", func(t *testing.T) {
+		_, err := testRP.VerifyAssertion(device.assert(t, login, "evil.example", testRP.Origins[0]), login, *credential)
+		assert.ErrorContains(t, err, "relying party")
+	})
+	t.Run("Tampered signature", func(t *testing.T) {
+		resp := device.assert(t, login, testRP.ID, testRP.Origins[0])
+		resp.Response.ClientDataJSON = encode(device.clientData(typeGet, login, testRP.Origins[0]+"/"))
+		_, err := testRP.VerifyAssertion(resp, login, *credential)
+		assert.Error(t, err)
+	})
+	t.Run("Cloned authenticator", func(t *testing.T) {
+		device.signCount = 0
+		_, err := testRP.VerifyAssertion(device.assert(t, login, testRP.ID, testRP.Origins[0]), login, *credential)
+		assert.ErrorIs(t, err, ErrSignCount)
+	})
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"Empty":             {},
+		"Truncated string":  {0x45, 'a'},
+		"Huge array":        {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"Indefinite length": {0x5f},
+		"Float":             {0xf9, 0x3c, 0x00},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := decodeCBOR(data)
+			assert.Error(t, err)
+		})
+	}
+}
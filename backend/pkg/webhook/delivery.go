@@ -0,0 +1,375 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Header names set on outbound deliveries in addition to the signature
+const (
+	EventHeader    = "X-Golink-Event"
+	DeliveryHeader = "X-Golink-Delivery"
+)
+
+// Defaults applied to zero dispatcher options
+const (
+	DefaultMaxAttempts     = 5
+	DefaultRetryBackoff    = 2 * time.Second
+	DefaultMaxRetryBackoff = time.Minute
+	DefaultWorkers         = 4
+	DefaultBufferSize      = 1000
+)
+
+var (
+	// DeliveriesTotal counts the deliveries that ended, by result
+	DeliveriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_webhook_deliveries_total",
+			Help: "Total number of webhook deliveries, by result",
+		},
+		[]string{"result"},
+	)
+
+	// DeliveryAttemptsTotal counts every request made to a webhook
+	DeliveryAttemptsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "golink_webhook_delivery_attempts_total",
+			Help: "Total number of requests made to deliver webhooks, including retries",
+		},
+	)
+
+	// EventsDroppedTotal counts the events no webhook received, by reason
+	EventsDroppedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_webhook_events_dropped_total",
+			Help: "Total number of link events dropped before delivery, by reason",
+		},
+		[]string{"reason"},
+	)
+)
+
+// Results of deliveries and reasons events are dropped
+const (
+	resultDelivered = "delivered"
+	resultFailed    = "failed"
+	resultRejected  = "rejected"
+	resultAbandoned = "abandoned"
+
+	dropBufferFull = "buffer_full"
+	dropStopped    = "stopped"
+	dropListFailed = "list_failed"
+)
+
+var log = logger.For("webhook")
+
+// Event is a change to a link, delivered as the JSON body of a webhook
+// request. The same ID is sent with every attempt, so receivers can ignore
+// retries of a delivery they already processed.
+type Event struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	OccurredAt time.Time    `json:"occurred_at"`
+	Actor      string       `json:"actor,omitempty"`
+	Link       *models.Link `json:"link"`
+	// PreviousShort is the short code a renamed link had before
+	PreviousShort string `json:"previous_short,omitempty"`
+}
+
+// NewEvent creates an event of type eventType about link
+func NewEvent(eventType string, link *models.Link, actor string) Event {
+	return Event{
+		ID:         newDeliveryID(),
+		Type:       eventType,
+		OccurredAt: time.Now(),
+		Actor:      actor,
+		Link:       link,
+	}
+}
+
+// Subscriptions lists the webhooks events may be delivered to
+type Subscriptions interface {
+	List(ctx context.Context) ([]*models.Webhook, error)
+}
+
+// Doer sends HTTP requests, such as a safehttp.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Dispatcher delivers link events to the webhooks subscribed to them in the
+// background. Publishing never blocks: when the queue is full the event is
+// dropped and counted. A delivery is retried with exponential backoff after
+// network errors, 429 and 5xx responses; other responses end it.
+type Dispatcher struct {
+	hooks       Subscriptions
+	client      Doer
+	events      chan Event
+	deliveries  chan delivery
+	quit        chan struct{}
+	done        chan struct{}
+	sleep       func(time.Duration, <-chan struct{}) bool
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	workers     int
+	mutex       sync.RWMutex
+	started     bool
+	stopping    bool
+}
+
+// delivery is one event on its way to one webhook
+type delivery struct {
+	event   Event
+	webhook *models.Webhook
+}
+
+// DispatcherOption configures a Dispatcher
+type DispatcherOption func(*Dispatcher)
+
+// WithMaxAttempts sets how many requests are made for a delivery before it
+// is given up
+func WithMaxAttempts(attempts int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if attempts > 0 {
+			d.maxAttempts = attempts
+		}
+	}
+}
+
+// WithRetryBackoff sets the wait before the first retry, which doubles with
+// every further retry up to maxBackoff
+func WithRetryBackoff(backoff, maxBackoff time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		if backoff > 0 {
+			d.backoff = backoff
+		}
+		if maxBackoff > 0 {
+			d.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// WithWorkers sets how many deliveries are made at once
+func WithWorkers(workers int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if workers > 0 {
+			d.workers = workers
+		}
+	}
+}
+
+// WithBufferSize sets how many events wait for delivery before new ones are dropped
+func WithBufferSize(size int) DispatcherOption {
+	return func(d *Dispatcher) {
+		if size > 0 {
+			d.events = make(chan Event, size)
+		}
+	}
+}
+
+// NewDispatcher creates a dispatcher delivering events to the webhooks in
+// hooks through client
+func NewDispatcher(hooks Subscriptions, client Doer, opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		hooks:       hooks,
+		client:      client,
+		events:      make(chan Event, DefaultBufferSize),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+		sleep:       sleep,
+		maxAttempts: DefaultMaxAttempts,
+		backoff:     DefaultRetryBackoff,
+		maxBackoff:  DefaultMaxRetryBackoff,
+		workers:     DefaultWorkers,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.deliveries = make(chan delivery, d.workers)
+	return d
+}
+
+// Publish queues an event for the webhooks subscribed to its type
+func (d *Dispatcher) Publish(event Event) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.stopping {
+		EventsDroppedTotal.WithLabelValues(dropStopped).Inc()
+		return
+	}
+	select {
+	case d.events <- event:
+	default:
+		EventsDroppedTotal.WithLabelValues(dropBufferFull).Inc()
+		log.Warn("Webhook queue full, dropping event", logger.Fields{"event": event.Type, "eventID": event.ID})
+	}
+}
+
+// Start starts the workers
+func (d *Dispatcher) Start(context.Context) error {
+	d.mutex.Lock()
+	d.started = true
+	d.mutex.Unlock()
+
+	var workers sync.WaitGroup
+	for range d.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range d.deliveries {
+				d.deliver(job)
+			}
+		}()
+	}
+	go func() {
+		d.fanOut()
+		close(d.deliveries)
+		workers.Wait()
+		close(d.done)
+	}()
+	return nil
+}
+
+// Stop stops accepting events and waits for the queued ones to be
+// delivered, giving up when ctx is done. Deliveries waiting for a retry are
+// abandoned rather than holding up the shutdown.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mutex.Lock()
+	if d.stopping {
+		d.mutex.Unlock()
+		return nil
+	}
+	d.stopping = true
+	started := d.started
+	// No Publish holds the read lock now, so closing the queue is safe
+	close(d.events)
+	close(d.quit)
+	d.mutex.Unlock()
+
+	if !started {
+		return nil
+	}
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fanOut turns each queued event into a delivery per subscribed webhook
+// until the queue is closed and drained
+func (d *Dispatcher) fanOut() {
+	for event := range d.events {
+		webhooks, err := d.hooks.List(context.Background())
+		if err != nil {
+			EventsDroppedTotal.WithLabelValues(dropListFailed).Inc()
+			log.Error("Failed to list webhooks", err, logger.Fields{"event": event.Type, "eventID": event.ID})
+			continue
+		}
+		for _, webhook := range webhooks {
+			if webhook.Subscribes(event.Type) {
+				d.deliveries <- delivery{event: event, webhook: webhook}
+			}
+		}
+	}
+}
+
+// deliver sends the event to the webhook, retrying failed attempts
+func (d *Dispatcher) deliver(job delivery) {
+	fields := logger.Fields{"webhookID": job.webhook.ID, "event": job.event.Type, "eventID": job.event.ID}
+	body, err := json.Marshal(job.event)
+	if err != nil {
+		DeliveriesTotal.WithLabelValues(resultFailed).Inc()
+		log.Error("Failed to encode webhook event", err, fields)
+		return
+	}
+
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.attempt(job, body)
+		if err == nil {
+			DeliveriesTotal.WithLabelValues(resultDelivered).Inc()
+			return
+		}
+		fields["attempt"] = attempt
+		fields["error"] = err.Error()
+		if !retry {
+			DeliveriesTotal.WithLabelValues(resultRejected).Inc()
+			log.Warn("Webhook rejected delivery", fields)
+			return
+		}
+		if attempt >= d.maxAttempts {
+			DeliveriesTotal.WithLabelValues(resultFailed).Inc()
+			log.Warn("Giving up webhook delivery", fields)
+			return
+		}
+		if !d.sleep(wait, d.quit) {
+			DeliveriesTotal.WithLabelValues(resultAbandoned).Inc()
+			log.Warn("Abandoning webhook delivery on shutdown", fields)
+			return
+		}
+		wait = min(2*wait, d.maxBackoff)
+	}
+}
+
+// attempt makes one request for a delivery, reporting whether a failure is
+// worth retrying. Each attempt is signed anew, so it carries a fresh nonce.
+func (d *Dispatcher) attempt(job delivery, body []byte) (bool, error) {
+	DeliveryAttemptsTotal.Inc()
+	req, err := http.NewRequest(http.MethodPost, job.webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, job.event.Type)
+	req.Header.Set(DeliveryHeader, job.event.ID)
+	if err := NewSigner(job.webhook.Secret).SignRequest(req.Header, body); err != nil {
+		return false, err
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, MaxBodyBytes))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook responded %d", resp.StatusCode)
+}
+
+// sleep waits for d, returning false if quit is closed first
+func sleep(d time.Duration, quit <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-quit:
+		return false
+	}
+}
+
+// newDeliveryID returns 128 random bits as hex
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticSubscriptions lists a fixed set of webhooks
+type staticSubscriptions []*models.Webhook
+
+func (s staticSubscriptions) List(context.Context) ([]*models.Webhook, error) {
+	return s, nil
+}
+
+// receiver records the deliveries a test server accepted, answering with
+// the queued statuses first
+type receiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	status := http.StatusNoContent
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) count() int {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return len(rc.requests)
+}
+
+// runDispatcher delivers events to hooks without waiting between retries
+func runDispatcher(t *testing.T, hooks staticSubscriptions, events ...Event) {
+	t.Helper()
+	d := NewDispatcher(hooks, http.DefaultClient, WithMaxAttempts(3), WithWorkers(1))
+	d.sleep = func(time.Duration, <-chan struct{}) bool { return true }
+	require.NoError(t, d.Start(context.Background()))
+	for _, event := range events {
+		d.Publish(event)
+	}
+	require.NoError(t, d.Stop(context.Background()))
+}
+
+func TestDispatcherDeliversSignedEvents(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	hooks := staticSubscriptions{
+		{ID: "all", URL: server.URL, Secret: "secret", Active: true,
+			Events: []string{models.WebhookEvents.LinkCreated, models.WebhookEvents.LinkDeleted}},
+		{ID: "inactive", URL: server.URL, Secret: "secret", Active: false,
+			Events: []string{models.WebhookEvents.LinkCreated}},
+	}
+	link := &models.Link{ID: "id-1", Short: "docs", URL: "https://example.com"}
+	created := NewEvent(models.WebhookEvents.LinkCreated, link, "alice")
+	runDispatcher(t, hooks, created, NewEvent(models.WebhookEvents.LinkUpdated, link, "alice"))
+
+	require.Equal(t, 1, rc.count(), "only the active webhook subscribed to the event receives it")
+	req := rc.requests[0]
+	assert.Equal(t, models.WebhookEvents.LinkCreated, req.Header.Get(EventHeader))
+	assert.Equal(t, created.ID, req.Header.Get(DeliveryHeader))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.NoError(t, NewVerifier([]string{"secret"}).Verify(context.Background(), req.Header, rc.bodies[0]))
+
+	var payload Event
+	require.NoError(t, json.Unmarshal(rc.bodies[0], &payload))
+	assert.Equal(t, created.ID, payload.ID)
+	assert.Equal(t, "docs", payload.Link.Short)
+	assert.Equal(t, "alice", payload.Actor)
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+	}{
+		{name: "Server errors are retried", statuses: []int{http.StatusBadGateway, http.StatusInternalServerError}, want: 3},
+		{name: "Rate limits are retried", statuses: []int{http.StatusTooManyRequests}, want: 2},
+		{name: "Attempts are bounded", statuses: []int{500, 500, 500, 500}, want: 3},
+		{name: "Client errors are not retried", statuses: []int{http.StatusGone}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{statuses: tt.statuses}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			hooks := staticSubscriptions{{ID: "hook", URL: server.URL, Secret: "secret", Active: true,
+				Events: []string{models.WebhookEvents.LinkDeleted}}}
+			runDispatcher(t, hooks, NewEvent(models.WebhookEvents.LinkDeleted, &models.Link{Short: "docs"}, "alice"))
+
+			require.Equal(t, tt.want, rc.count())
+			first := rc.requests[0]
+			for _, req := range rc.requests[1:] {
+				assert.Equal(t, first.Header.Get(DeliveryHeader), req.Header.Get(DeliveryHeader), "retries keep the delivery ID")
+				assert.NotEqual(t, first.Header.Get(NonceHeader), req.Header.Get(NonceHeader), "retries are signed anew")
+			}
+		})
+	}
+}
+
+func TestDispatcherStopAbandonsRetries(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	hooks := staticSubscriptions{{ID: "hook", URL: server.URL, Secret: "secret", Active: true,
+		Events: []string{models.WebhookEvents.LinkCreated}}}
+	d := NewDispatcher(hooks, http.DefaultClient, WithRetryBackoff(time.Hour, time.Hour))
+	require.NoError(t, d.Start(context.Background()))
+	d.Publish(NewEvent(models.WebhookEvents.LinkCreated, &models.Link{Short: "docs"}, "alice"))
+	require.Eventually(t, func() bool { return rc.count() == 1 }, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, d.Stop(ctx))
+	assert.Equal(t, 1, rc.count())
+
+	// Events published after stopping are dropped
+	d.Publish(NewEvent(models.WebhookEvents.LinkCreated, &models.Link{Short: "docs"}, "alice"))
+	assert.Equal(t, 1, rc.count())
+}
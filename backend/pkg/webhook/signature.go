@@ -0,0 +1,241 @@
+// Package webhook implements the signature scheme shared by every webhook
+// golink sends or receives, and the dispatcher delivering link events to the
+// webhooks admins registered.
+//
+// A signed request carries three headers:
+//
+//	X-Golink-Timestamp: 1700000000
+//	X-Golink-Nonce:     5f2b9c0e7d4a41b8a6c3e1f09d8b7a65
+//	X-Golink-Signature: v1=<hex HMAC-SHA256 of "v1:<timestamp>:<nonce>:<body>">
+//
+// The signature header may list several comma-separated values so a secret can
+// be rotated without dropping deliveries. A receiver accepts a request only if
+// one signature matches, the timestamp lies within the replay window and the
+// nonce has not been seen within that window.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+)
+
+// Header names used by the signature scheme
+const (
+	TimestampHeader = "X-Golink-Timestamp"
+	NonceHeader     = "X-Golink-Nonce"
+	SignatureHeader = "X-Golink-Signature"
+)
+
+const (
+	// DefaultReplayWindow is how far a timestamp may be from the receiver's clock
+	DefaultReplayWindow = 5 * time.Minute
+	// MaxBodyBytes bounds the request bodies the middleware reads for verification
+	MaxBodyBytes = 1 << 20 // 1 MiB
+
+	signatureVersion = "v1"
+	maxNonceLength   = 128
+)
+
+// Errors returned when a request fails verification
+var (
+	ErrMissingSignature = errors.New("webhook: missing signature headers")
+	ErrInvalidTimestamp = errors.New("webhook: invalid timestamp")
+	ErrStaleTimestamp   = errors.New("webhook: timestamp outside the replay window")
+	ErrInvalidNonce     = errors.New("webhook: invalid nonce")
+	ErrInvalidSignature = errors.New("webhook: signature mismatch")
+	ErrReplayed         = errors.New("webhook: nonce already used")
+)
+
+// Sign computes the v1 signature of a request body
+func Sign(secret []byte, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signatureVersion + ":" + timestamp + ":" + nonce + ":"))
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signer signs outbound webhook requests
+type Signer struct {
+	now    func() time.Time
+	secret []byte
+}
+
+// NewSigner creates a Signer for the given shared secret
+func NewSigner(secret string) *Signer {
+	return &Signer{now: time.Now, secret: []byte(secret)}
+}
+
+// SignRequest sets the timestamp, a fresh nonce and the signature on h
+func (s *Signer) SignRequest(h http.Header, body []byte) error {
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	h.Set(TimestampHeader, timestamp)
+	h.Set(NonceHeader, nonce)
+	h.Set(SignatureHeader, Sign(s.secret, timestamp, nonce, body))
+	return nil
+}
+
+// NonceStore remembers nonces for the replay window. ratelimit.Store satisfies
+// it, so nonces can share whatever store the rate limiter uses.
+type NonceStore interface {
+	// Incr increments the counter for key and returns the count within the current window
+	Incr(ctx context.Context, key string, window time.Duration) (int, error)
+}
+
+// Verifier checks signed inbound webhook requests
+type Verifier struct {
+	nonces  NonceStore
+	now     func() time.Time
+	secrets [][]byte
+	window  time.Duration
+}
+
+// VerifierOption configures a Verifier
+type VerifierOption func(*Verifier)
+
+// WithReplayWindow sets how old (or how far in the future) a timestamp may be
+func WithReplayWindow(window time.Duration) VerifierOption {
+	return func(v *Verifier) {
+		if window > 0 {
+			v.window = window
+		}
+	}
+}
+
+// WithNonceStore sets where used nonces are remembered. The default is an
+// in-process store, which does not catch replays sent to another instance.
+func WithNonceStore(store NonceStore) VerifierOption {
+	return func(v *Verifier) {
+		v.nonces = store
+	}
+}
+
+// NewVerifier creates a Verifier accepting signatures made with any of the
+// given secrets. Empty secrets are ignored.
+func NewVerifier(secrets []string, opts ...VerifierOption) *Verifier {
+	v := &Verifier{
+		nonces: ratelimit.NewMemoryStore(),
+		now:    time.Now,
+		window: DefaultReplayWindow,
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			v.secrets = append(v.secrets, []byte(secret))
+		}
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Verify checks the signature headers against body. The nonce is only
+// recorded once the signature is valid, so forged requests cannot burn nonces.
+func (v *Verifier) Verify(ctx context.Context, h http.Header, body []byte) error {
+	timestamp := h.Get(TimestampHeader)
+	nonce := h.Get(NonceHeader)
+	signatures := h.Get(SignatureHeader)
+	if timestamp == "" || nonce == "" || signatures == "" {
+		return ErrMissingSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidTimestamp, timestamp)
+	}
+	skew := v.now().Sub(time.Unix(unix, 0))
+	if skew > v.window || skew < -v.window {
+		return fmt.Errorf("%w: off by %s", ErrStaleTimestamp, skew.Round(time.Second))
+	}
+	if len(nonce) > maxNonceLength {
+		return ErrInvalidNonce
+	}
+
+	if !v.matches(timestamp, nonce, body, signatures) {
+		return ErrInvalidSignature
+	}
+
+	// A nonce must stay remembered for as long as its timestamp is accepted,
+	// which is the window on either side of the receiver's clock
+	seen, err := v.nonces.Incr(ctx, "webhook-nonce:"+nonce, 2*v.window)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook nonce: %w", err)
+	}
+	if seen > 1 {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// matches reports whether any listed signature was made with a known secret
+func (v *Verifier) matches(timestamp, nonce string, body []byte, signatures string) bool {
+	for _, secret := range v.secrets {
+		expected := []byte(Sign(secret, timestamp, nonce, body))
+		for _, signature := range strings.Split(signatures, ",") {
+			if hmac.Equal([]byte(strings.TrimSpace(signature)), expected) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware rejects requests that fail verification with 401 and restores
+// the body for the next handler otherwise
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+		if err != nil {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if err := v.Verify(r.Context(), r.Header, body); err != nil {
+			logger.Warn("Rejected webhook request", logger.Fields{
+				"path":  r.URL.Path,
+				"error": err.Error(),
+			})
+			http.Error(w, "Invalid webhook signature", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewSecret returns a random shared secret of 256 bits, as hex
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newNonce returns 128 random bits as hex
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook nonce: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,163 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signedHeader(t *testing.T, secret string, body []byte) http.Header {
+	t.Helper()
+	h := http.Header{}
+	require.NoError(t, NewSigner(secret).SignRequest(h, body))
+	return h
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"link.created"}`)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		header  func() http.Header
+		body    []byte
+		wantErr error
+	}{
+		{
+			name:   "Valid signature",
+			header: func() http.Header { return signedHeader(t, "current", body) },
+			body:   body,
+		},
+		{
+			name:   "Previous secret during rotation",
+			header: func() http.Header { return signedHeader(t, "previous", body) },
+			body:   body,
+		},
+		{
+			name: "One of several signatures matches",
+			header: func() http.Header {
+				h := signedHeader(t, "current", body)
+				h.Set(SignatureHeader, "v1=deadbeef, "+h.Get(SignatureHeader))
+				return h
+			},
+			body: body,
+		},
+		{
+			name:    "Unknown secret",
+			header:  func() http.Header { return signedHeader(t, "attacker", body) },
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Tampered body",
+			header:  func() http.Header { return signedHeader(t, "current", body) },
+			body:    []byte(`{"event":"link.deleted"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "Missing nonce",
+			header: func() http.Header {
+				h := signedHeader(t, "current", body)
+				h.Del(NonceHeader)
+				return h
+			},
+			body:    body,
+			wantErr: ErrMissingSignature,
+		},
+		{
+			name: "Malformed timestamp",
+			header: func() http.Header {
+				h := signedHeader(t, "current", body)
+				h.Set(TimestampHeader, "yesterday")
+				return h
+			},
+			body:    body,
+			wantErr: ErrInvalidTimestamp,
+		},
+		{
+			name: "Stale timestamp",
+			header: func() http.Header {
+				timestamp := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+				h := http.Header{}
+				h.Set(TimestampHeader, timestamp)
+				h.Set(NonceHeader, "n1")
+				h.Set(SignatureHeader, Sign([]byte("current"), timestamp, "n1", body))
+				return h
+			},
+			body:    body,
+			wantErr: ErrStaleTimestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewVerifier([]string{"current", "previous", ""})
+			err := verifier.Verify(ctx, tt.header(), tt.body)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	body := []byte("payload")
+	verifier := NewVerifier([]string{"secret"}, WithReplayWindow(time.Minute))
+	h := signedHeader(t, "secret", body)
+
+	require.NoError(t, verifier.Verify(context.Background(), h, body))
+	assert.ErrorIs(t, verifier.Verify(context.Background(), h, body), ErrReplayed)
+
+	// A forged request must not consume a nonce
+	forged := signedHeader(t, "secret", body)
+	forgedNonce := forged.Get(NonceHeader)
+	forged.Set(SignatureHeader, "v1=00")
+	assert.ErrorIs(t, verifier.Verify(context.Background(), forged, body), ErrInvalidSignature)
+
+	genuine := signedHeader(t, "secret", body)
+	genuine.Set(NonceHeader, forgedNonce)
+	genuine.Set(SignatureHeader, Sign([]byte("secret"), genuine.Get(TimestampHeader), forgedNonce, body))
+	assert.NoError(t, verifier.Verify(context.Background(), genuine, body))
+}
+
+func TestVerifierReplayWindow(t *testing.T) {
+	body := []byte("payload")
+	signer := NewSigner("secret")
+	signer.now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	h := http.Header{}
+	require.NoError(t, signer.SignRequest(h, body))
+
+	assert.NoError(t, NewVerifier([]string{"secret"}).Verify(context.Background(), h, body))
+	assert.ErrorIs(t, NewVerifier([]string{"secret"}, WithReplayWindow(time.Minute)).Verify(context.Background(), h, body), ErrStaleTimestamp)
+}
+
+func TestMiddleware(t *testing.T) {
+	verifier := NewVerifier([]string{"secret"})
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+
+	body := "hello"
+	req := httptest.NewRequest(http.MethodPost, "/hooks/test", strings.NewReader(body))
+	req.Header = signedHeader(t, "secret", []byte(body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, body, rr.Body.String(), "the verified body is passed on")
+
+	req = httptest.NewRequest(http.MethodPost, "/hooks/test", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// APITokenRepository stores API tokens in Firestore. The usage of each token
+// in a month is a document of its own, "{id}_{month}", in a second collection.
+type APITokenRepository struct {
+	client          *firestore.Client
+	collection      string
+	usageCollection string
+}
+
+// Ensure APITokenRepository implements APITokenStore
+var _ interfaces.APITokenStore = (*APITokenRepository)(nil)
+
+// NewAPITokenRepository creates a new APITokenRepository
+func NewAPITokenRepository(client *firestore.Client) *APITokenRepository {
+	return &APITokenRepository{
+		client:          client,
+		collection:      "api_tokens",
+		usageCollection: "api_token_usage",
+	}
+}
+
+// Create stores a new API token
+func (r *APITokenRepository) Create(ctx context.Context, token *models.APIToken) error {
+	_, err := r.client.Collection(r.collection).Doc(token.ID).Set(ctx, token)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error creating API token: %w", err))
+	}
+	return nil
+}
+
+// Get retrieves an API token by its ID
+func (r *APITokenRepository) Get(ctx context.Context, id string) (*models.APIToken, error) {
+	doc, err := r.client.Collection(r.collection).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, errors.NewNotFound(fmt.Sprintf("API token '%s' not found", id))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving API token: %w", err))
+	}
+
+	var token models.APIToken
+	if err := doc.DataTo(&token); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error converting API token data: %w", err))
+	}
+
+	return &token, nil
+}
+
+// ListByUser retrieves all API tokens belonging to a user
+func (r *APITokenRepository) ListByUser(ctx context.Context, userID string) ([]*models.APIToken, error) {
+	iter := r.client.Collection(r.collection).Where("user_id", "==", userID).Documents(ctx)
+	var tokens []*models.APIToken
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving API tokens: %w", err))
+		}
+
+		var token models.APIToken
+		if err := doc.DataTo(&token); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, nil
+}
+
+// Revoke marks an API token as revoked
+func (r *APITokenRepository) Revoke(ctx context.Context, id string) error {
+	_, err := r.client.Collection(r.collection).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "revoked_at", Value: time.Now()},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return errors.NewNotFound(fmt.Sprintf("API token '%s' not found", id))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error revoking API token: %w", err))
+	}
+	return nil
+}
+
+// AddUsage counts one request of the token in month and returns the requests
+// of the month so far. The count is read and written in one transaction, so
+// concurrent requests of one token are counted exactly.
+func (r *APITokenRepository) AddUsage(ctx context.Context, id, month string) (int, error) {
+	tokenRef := r.client.Collection(r.collection).Doc(id)
+	usageRef := r.client.Collection(r.usageCollection).Doc(id + "_" + month)
+	var requests int
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		current, err := usageRequests(tx.Get(usageRef))
+		if err != nil {
+			return err
+		}
+		requests = current + 1
+		if err := tx.Set(usageRef, map[string]any{
+			"token_id": id,
+			"month":    month,
+			"requests": requests,
+		}); err != nil {
+			return err
+		}
+		return tx.Update(tokenRef, []firestore.Update{{Path: "last_used_at", Value: time.Now()}})
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return 0, errors.NewNotFound(fmt.Sprintf("API token '%s' not found", id))
+		}
+		return 0, errors.NewInternalError(fmt.Errorf("Error recording API token usage: %w", err))
+	}
+	return requests, nil
+}
+
+// Usage returns the requests of the token in month
+func (r *APITokenRepository) Usage(ctx context.Context, id, month string) (int, error) {
+	requests, err := usageRequests(r.client.Collection(r.usageCollection).Doc(id + "_" + month).Get(ctx))
+	if err != nil {
+		return 0, errors.NewInternalError(fmt.Errorf("Error retrieving API token usage: %w", err))
+	}
+	return requests, nil
+}
+
+// usageRequests returns the requests counted in a usage document, which
+// counts none until the token is first used in the month
+func usageRequests(doc *firestore.DocumentSnapshot, err error) (int, error) {
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var usage struct {
+		Requests int `firestore:"requests"`
+	}
+	if err := doc.DataTo(&usage); err != nil {
+		return 0, err
+	}
+	return usage.Requests, nil
+}
@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/cache"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+)
+
+// DefaultLinkCacheTTL is how long a link stays in the link cache by default
+const DefaultLinkCacheTTL = 5 * time.Minute
+
+// linkCacheKey is the key of a link in the cache
+func linkCacheKey(short string) string {
+	return "link:" + short
+}
+
+// CachedLinkRepository keeps the links looked up with a context allowed by
+// cache.Allow in a cache, such as Redis shared by all replicas or the
+// memory of this one. Every other read goes to the wrapped repository, and
+// every change made through this repository removes the changed links from
+// the cache. Caches can be stacked, a small one in memory in front of a
+// shared one; a change then goes through, and invalidates, each of them.
+//
+// Click counts change without invalidating the cache, so cached links may
+// report fewer clicks for up to the TTL. Click limits are unaffected, since
+// the repository enforces them when counting. A link changed while another
+// request is caching it may stay stale for up to the TTL as well.
+type CachedLinkRepository struct {
+	interfaces.LinkRepositoryInterface
+	store cache.Store
+	name  string
+	ttl   time.Duration
+}
+
+// Ensure CachedLinkRepository implements LinkRepositoryInterface
+var _ interfaces.LinkRepositoryInterface = (*CachedLinkRepository)(nil)
+
+// NewCachedLinkRepository wraps repo with a link cache in store, keeping
+// links for ttl, or DefaultLinkCacheTTL when ttl is not positive. The name
+// labels the cache's lookups in golink_link_cache_requests_total.
+func NewCachedLinkRepository(repo interfaces.LinkRepositoryInterface, name string, store cache.Store, ttl time.Duration) *CachedLinkRepository {
+	if ttl <= 0 {
+		ttl = DefaultLinkCacheTTL
+	}
+	return &CachedLinkRepository{LinkRepositoryInterface: repo, store: store, name: name, ttl: ttl}
+}
+
+// GetByShort retrieves a link, from the cache if ctx allows it
+func (r *CachedLinkRepository) GetByShort(ctx context.Context, short string) (*models.Link, error) {
+	if !cache.Allowed(ctx) {
+		return r.LinkRepositoryInterface.GetByShort(ctx, short)
+	}
+
+	key := linkCacheKey(short)
+	if data, found, err := r.store.Get(ctx, key); err != nil {
+		repoLog.Warn("Failed to read link cache", logger.Fields{"short": short, "error": err.Error()})
+	} else if found {
+		var link models.Link
+		// Gob keeps the fields left out of JSON, so the link can be written back
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&link); err == nil {
+			LinkCacheRequestsTotal.WithLabelValues(r.name, "hit").Inc()
+			return &link, nil
+		}
+		repoLog.Warn("Dropping undecodable cached link", logger.Fields{"short": short})
+	}
+
+	LinkCacheRequestsTotal.WithLabelValues(r.name, "miss").Inc()
+	link, err := r.LinkRepositoryInterface.GetByShort(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(link); err != nil {
+		repoLog.Error("Failed to encode link for the cache", err, logger.Fields{"short": short})
+		return link, nil
+	}
+	if err := r.store.Set(ctx, key, data.Bytes(), r.ttl); err != nil {
+		repoLog.Warn("Failed to write link cache", logger.Fields{"short": short, "error": err.Error()})
+	}
+	return link, nil
+}
+
+// CheckAccess checks whether a user can access a link, reading the link
+// like GetByShort
+func (r *CachedLinkRepository) CheckAccess(ctx context.Context, short string, userID string) (bool, error) {
+	if !cache.Allowed(ctx) {
+		return r.LinkRepositoryInterface.CheckAccess(ctx, short, userID)
+	}
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return false, err
+	}
+	return link.CanAccessAs(userID, groups.FromContext(ctx)), nil
+}
+
+// invalidate removes links from the cache. A failure is only logged; the
+// links expire from the cache within the TTL.
+func (r *CachedLinkRepository) invalidate(ctx context.Context, shorts ...string) {
+	keys := make([]string, len(shorts))
+	for i, short := range shorts {
+		keys[i] = linkCacheKey(short)
+	}
+	// The change is made even if the request is canceled now
+	if err := r.store.Delete(context.WithoutCancel(ctx), keys...); err != nil {
+		repoLog.Error("Failed to invalidate cached links", err, logger.Fields{"shorts": shorts})
+	}
+}
+
+// Update updates a link and removes it from the cache
+func (r *CachedLinkRepository) Update(ctx context.Context, link *models.Link) error {
+	defer r.invalidate(ctx, link.Short)
+	return r.LinkRepositoryInterface.Update(ctx, link)
+}
+
+// Delete deletes a link and removes it from the cache
+func (r *CachedLinkRepository) Delete(ctx context.Context, short string) error {
+	defer r.invalidate(ctx, short)
+	return r.LinkRepositoryInterface.Delete(ctx, short)
+}
+
+// Restore restores a deleted link and removes it from the cache
+func (r *CachedLinkRepository) Restore(ctx context.Context, short string) error {
+	defer r.invalidate(ctx, short)
+	return r.LinkRepositoryInterface.Restore(ctx, short)
+}
+
+// Purge permanently deletes a link and removes it from the cache
+func (r *CachedLinkRepository) Purge(ctx context.Context, short string) error {
+	defer r.invalidate(ctx, short)
+	return r.LinkRepositoryInterface.Purge(ctx, short)
+}
+
+// Rename renames a link and removes both short codes from the cache
+func (r *CachedLinkRepository) Rename(ctx context.Context, short, newShort string) (*models.Link, error) {
+	defer r.invalidate(ctx, short, newShort)
+	return r.LinkRepositoryInterface.Rename(ctx, short, newShort)
+}
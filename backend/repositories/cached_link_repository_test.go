@@ -0,0 +1,99 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/cache"
+	"github.com/Okabe-Junya/golink-backend/pkg/consistency"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedLinkRepository(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	source := repositories.NewMemoryLinkRepository()
+	repo := repositories.NewCachedLinkRepository(source, "shared", cache.NewRedisStore(client, "test:"), time.Minute)
+	ctx := context.Background()
+	cached := cache.Allow(ctx)
+
+	link := models.NewLink("docs", "https://docs.example.com", "user1")
+	require.NoError(t, repo.Create(ctx, link))
+
+	got, err := repo.GetByShort(cached, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, link.URL, got.URL)
+	assert.Equal(t, models.LinkSchemaVersion, got.SchemaVersion, "fields left out of JSON survive the cache")
+	assert.True(t, server.Exists("test:link:docs"))
+
+	// A change made behind the cache's back is only seen by uncached reads
+	changed := link.Clone()
+	changed.URL = "https://elsewhere.example.com"
+	require.NoError(t, source.Update(ctx, changed))
+	got, _ = repo.GetByShort(cached, "docs")
+	assert.Equal(t, link.URL, got.URL)
+	got, _ = repo.GetByShort(ctx, "docs")
+	assert.Equal(t, changed.URL, got.URL)
+	got, _ = repo.GetByShort(cache.Allow(consistency.WithStrong(ctx)), "docs")
+	assert.Equal(t, changed.URL, got.URL, "strong reads skip the cache")
+
+	// Changes made through the repository invalidate the cache
+	changed.URL = "https://new.example.com"
+	require.NoError(t, repo.Update(ctx, changed))
+	got, _ = repo.GetByShort(cached, "docs")
+	assert.Equal(t, changed.URL, got.URL)
+
+	_, err = repo.Rename(ctx, "docs", "documents")
+	require.NoError(t, err)
+	assert.False(t, server.Exists("test:link:docs"))
+	got, err = repo.GetByShort(cached, "documents")
+	require.NoError(t, err)
+	assert.Equal(t, changed.URL, got.URL)
+
+	require.NoError(t, repo.Delete(ctx, "documents"))
+	_, err = repo.GetByShort(cached, "documents")
+	assert.Error(t, err)
+
+	t.Run("Redis down", func(t *testing.T) {
+		require.NoError(t, repo.Create(ctx, models.NewLink("wiki", "https://wiki.example.com", "user1")))
+		server.Close()
+		got, err := repo.GetByShort(cached, "wiki")
+		require.NoError(t, err, "lookups fall back to the repository")
+		assert.Equal(t, "https://wiki.example.com", got.URL)
+	})
+}
+
+func TestCachedLinkRepository_Stacked(t *testing.T) {
+	source := repositories.NewMemoryLinkRepository()
+	shared := cache.NewMemoryStore(0)
+	hot := cache.NewMemoryStore(10)
+	repo := repositories.NewCachedLinkRepository(
+		repositories.NewCachedLinkRepository(source, "shared", shared, time.Minute), "hot", hot, time.Minute)
+	ctx := context.Background()
+	cached := cache.Allow(ctx)
+
+	link := models.NewLink("docs", "https://docs.example.com", "user1")
+	require.NoError(t, repo.Create(ctx, link))
+	_, err := repo.GetByShort(cached, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, 1, hot.Len())
+	assert.Equal(t, 1, shared.Len())
+
+	// A change invalidates every cache it goes through
+	changed := link.Clone()
+	changed.URL = "https://new.example.com"
+	require.NoError(t, repo.Update(ctx, changed))
+	assert.Equal(t, 0, hot.Len())
+	assert.Equal(t, 0, shared.Len())
+	got, err := repo.GetByShort(cached, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, changed.URL, got.URL)
+}
@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// ClickEventRepository stores the click stream of each link in Firestore, in
+// a clicks subcollection of the link's document
+type ClickEventRepository struct {
+	client        *firestore.Client
+	collection    string
+	subcollection string
+}
+
+// Ensure ClickEventRepository implements ClickEventStore
+var _ interfaces.ClickEventStore = (*ClickEventRepository)(nil)
+
+// NewClickEventRepository creates a new ClickEventRepository
+func NewClickEventRepository(client *firestore.Client) *ClickEventRepository {
+	return &ClickEventRepository{
+		client:        client,
+		collection:    "links",
+		subcollection: "clicks",
+	}
+}
+
+// clicks returns the click stream collection of a link
+func (r *ClickEventRepository) clicks(short string) *firestore.CollectionRef {
+	return r.client.Collection(r.collection).Doc(ShortDocID(short)).Collection(r.subcollection)
+}
+
+// Send stores a batch of click events, each under a generated ID
+func (r *ClickEventRepository) Send(ctx context.Context, events []models.ClickEvent) error {
+	for start := 0; start < len(events); start += maxBatchWrites {
+		batch := r.client.Batch()
+		for _, event := range events[start:min(start+maxBatchWrites, len(events))] {
+			batch.Create(r.clicks(event.Short).NewDoc(), event)
+		}
+		if err := commitBatch(ctx, batch, "click_events"); err != nil {
+			return errors.NewInternalError(fmt.Errorf("Error storing click events: %w", err))
+		}
+	}
+	return nil
+}
+
+// ListByShort returns the click events of a link at or after since, oldest first
+func (r *ClickEventRepository) ListByShort(ctx context.Context, short string, since time.Time) ([]*models.ClickEvent, error) {
+	iter := r.clicks(short).Where("time", ">=", since).OrderBy("time", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var events []*models.ClickEvent
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return events, nil
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving click events: %w", err))
+		}
+		var event models.ClickEvent
+		if err := doc.DataTo(&event); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		events = append(events, &event)
+	}
+}
+
+// DeleteByShort forgets the click stream of a link
+func (r *ClickEventRepository) DeleteByShort(ctx context.Context, short string) error {
+	refs, err := r.clicks(short).DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error retrieving click events: %w", err))
+	}
+	return r.deleteAll(ctx, refs)
+}
+
+// MoveShort files the click stream of a renamed link under its new short code
+func (r *ClickEventRepository) MoveShort(ctx context.Context, short, newShort string) error {
+	docs, err := r.clicks(short).Documents(ctx).GetAll()
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error retrieving click events: %w", err))
+	}
+	moves := make([]documentMove, len(docs))
+	for i, doc := range docs {
+		data := doc.Data()
+		data["short"] = newShort
+		moves[i] = documentMove{from: doc.Ref, to: r.clicks(newShort).Doc(doc.Ref.ID), data: data}
+	}
+	return moveDocuments(ctx, r.client, moves, "click events")
+}
+
+// DeleteBefore deletes the click events of a link before before and returns
+// how many it deleted
+func (r *ClickEventRepository) DeleteBefore(ctx context.Context, short string, before time.Time) (int, error) {
+	docs, err := r.clicks(short).Where("time", "<", before).Select().Documents(ctx).GetAll()
+	if err != nil {
+		return 0, errors.NewInternalError(fmt.Errorf("Error retrieving click events: %w", err))
+	}
+	refs := make([]*firestore.DocumentRef, len(docs))
+	for i, doc := range docs {
+		refs[i] = doc.Ref
+	}
+	if err := r.deleteAll(ctx, refs); err != nil {
+		return 0, err
+	}
+	return len(refs), nil
+}
+
+// deleteAll deletes the documents in batches
+func (r *ClickEventRepository) deleteAll(ctx context.Context, refs []*firestore.DocumentRef) error {
+	for start := 0; start < len(refs); start += maxBatchWrites {
+		batch := r.client.Batch()
+		for _, ref := range refs[start:min(start+maxBatchWrites, len(refs))] {
+			batch.Delete(ref)
+		}
+		if err := commitBatch(ctx, batch, "click_events"); err != nil {
+			return errors.NewInternalError(fmt.Errorf("Error deleting click events: %w", err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package repositories_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/Okabe-Junya/golink-backend/repositories/mocks"
+	"github.com/Okabe-Junya/golink-backend/repositories/repotest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestConformance runs the conformance suite against every repository:
+// those in memory, SQLite and Redis, in an in-process server, always, and
+// PostgreSQL and Firestore when POSTGRES_TEST_URL and
+// FIRESTORE_EMULATOR_HOST point at a database to test against.
+func TestConformance(t *testing.T) {
+	factories := map[string]repotest.Factory{
+		"Memory":    func(*testing.T) interfaces.LinkRepositoryInterface { return repositories.NewMemoryLinkRepository() },
+		"Mock":      func(*testing.T) interfaces.LinkRepositoryInterface { return mocks.NewMockLinkRepository() },
+		"SQLite":    func(t *testing.T) interfaces.LinkRepositoryInterface { return newSQLiteTestRepository(t) },
+		"Redis":     func(t *testing.T) interfaces.LinkRepositoryInterface { return newRedisTestRepository(t) },
+		"Postgres":  func(t *testing.T) interfaces.LinkRepositoryInterface { return newPostgresTestRepository(t) },
+		"Firestore": func(t *testing.T) interfaces.LinkRepositoryInterface { return newFirestoreTestRepository(t) },
+	}
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			repotest.Run(t, factory)
+		})
+	}
+}
+
+// newFirestoreTestRepository returns a repository on a new project of the
+// Firestore emulator at FIRESTORE_EMULATOR_HOST, skipping the test when it
+// is not set
+func newFirestoreTestRepository(t *testing.T) *repositories.LinkRepository {
+	t.Helper()
+	return repositories.NewLinkRepository(newFirestoreTestClient(t))
+}
+
+// newFirestoreTestClient returns a client of a new project of the Firestore
+// emulator at FIRESTORE_EMULATOR_HOST, skipping the test when it is not set
+func newFirestoreTestClient(t *testing.T) *firestore.Client {
+	t.Helper()
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	// Each project of the emulator is a separate, empty database
+	project := fmt.Sprintf("golink-test-%d", time.Now().UnixNano())
+	client, err := firestore.NewClient(context.Background(), project)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// TestFirestoreOrphanClaim checks that a short code claim left behind by an
+// interrupted write, pointing at a link that is gone or has moved on, does
+// not keep the short code taken. Only Firestore keeps claims apart from the
+// links, so the other repositories cannot leave one behind.
+func TestFirestoreOrphanClaim(t *testing.T) {
+	client := newFirestoreTestClient(t)
+	repo := repositories.NewLinkRepository(client)
+	ctx := context.Background()
+	plant := func(short, linkID string) {
+		_, err := client.Collection("link_shorts").Doc(repositories.ShortDocID(short)).Set(ctx, map[string]interface{}{
+			"link_id": linkID,
+			"short":   short,
+		})
+		require.NoError(t, err)
+	}
+
+	// A claim of a missing link
+	plant("docs", models.NewLinkID())
+	_, err := repo.GetByShort(ctx, "docs")
+	require.ErrorIs(t, err, errors.ErrNotFound)
+	require.NoError(t, repo.Create(ctx, models.NewLink("docs", "https://docs.example.com", "user1")))
+	link, err := repo.GetByShort(ctx, "docs")
+	require.NoError(t, err)
+	require.Equal(t, "https://docs.example.com", link.URL)
+
+	// A claim of a link now using another short code, taken over by a rename
+	plant("wiki", link.ID)
+	renamed, err := repo.Rename(ctx, "docs", "wiki")
+	require.NoError(t, err)
+	require.Equal(t, "wiki", renamed.Short)
+
+	// Purging releases the claim along with the link
+	require.NoError(t, repo.Delete(ctx, "wiki"))
+	require.NoError(t, repo.Purge(ctx, "wiki"))
+	_, err = client.Collection("link_shorts").Doc("wiki").Get(ctx)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.ErrorIs(t, repo.Purge(ctx, "wiki"), errors.ErrNotFound)
+}
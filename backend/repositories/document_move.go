@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// documentMove rewrites one document under a new reference
+type documentMove struct {
+	from *firestore.DocumentRef
+	to   *firestore.DocumentRef
+	data any
+}
+
+// moveDocuments stores each document under its new reference and deletes it
+// under the old one, in batches. A document's write and the deletion of its
+// old copy share a batch, so an interrupted move leaves no document both
+// behind and moved.
+func moveDocuments(ctx context.Context, client *firestore.Client, moves []documentMove, what string) error {
+	const perBatch = maxBatchWrites / 2
+	for start := 0; start < len(moves); start += perBatch {
+		batch := client.Batch()
+		for _, move := range moves[start:min(start+perBatch, len(moves))] {
+			batch.Set(move.to, move.data)
+			batch.Delete(move.from)
+		}
+		if err := commitBatch(ctx, batch, strings.ReplaceAll(what, " ", "_")); err != nil {
+			return errors.NewInternalError(fmt.Errorf("Error moving %s: %w", what, err))
+		}
+	}
+	return nil
+}
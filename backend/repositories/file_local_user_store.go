@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// FileLocalUserStore keeps local accounts in a JSON file, so self-hosted
+// deployments need no database for them. The file is read on every lookup,
+// so accounts changed with the users command apply without a restart.
+type FileLocalUserStore struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// Ensure FileLocalUserStore implements LocalUserStore
+var _ interfaces.LocalUserStore = (*FileLocalUserStore)(nil)
+
+// NewFileLocalUserStore creates a store backed by the file at path, which
+// is created on the first save
+func NewFileLocalUserStore(path string) *FileLocalUserStore {
+	return &FileLocalUserStore{path: path}
+}
+
+// load reads every account from the file; a missing file has none
+func (s *FileLocalUserStore) load() (map[string]*models.LocalUser, error) {
+	users := make(map[string]*models.LocalUser)
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local users: %w", err)
+	}
+
+	var list []*models.LocalUser
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse local users in %s: %w", s.path, err)
+	}
+	for _, user := range list {
+		users[user.Username] = user
+	}
+	return users, nil
+}
+
+// store replaces the file with the given accounts. The file is written
+// beside the old one and renamed over it, so readers never see half of it.
+func (s *FileLocalUserStore) store(users map[string]*models.LocalUser) error {
+	data, err := json.MarshalIndent(sortLocalUsers(users), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".users-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write local users: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	// Password hashes are for the server's eyes only
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write local users: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write local users: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write local users: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write local users: %w", err)
+	}
+	return nil
+}
+
+// Get returns an account
+func (s *FileLocalUserStore) Get(ctx context.Context, username string) (*models.LocalUser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	users, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	user, ok := users[username]
+	if !ok {
+		return nil, errors.NewNotFound(fmt.Sprintf("User '%s' not found", username))
+	}
+	return user, nil
+}
+
+// Save creates or replaces an account
+func (s *FileLocalUserStore) Save(ctx context.Context, user *models.LocalUser) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	saved := *user
+	users[user.Username] = &saved
+	return s.store(users)
+}
+
+// Delete removes an account
+func (s *FileLocalUserStore) Delete(ctx context.Context, username string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	users, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := users[username]; !ok {
+		return errors.NewNotFound(fmt.Sprintf("User '%s' not found", username))
+	}
+	delete(users, username)
+	return s.store(users)
+}
+
+// List returns every account, ordered by username
+func (s *FileLocalUserStore) List(ctx context.Context) ([]*models.LocalUser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	users, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return sortLocalUsers(users), nil
+}
+
+// sortLocalUsers lists accounts ordered by username
+func sortLocalUsers(users map[string]*models.LocalUser) []*models.LocalUser {
+	list := make([]*models.LocalUser, 0, len(users))
+	for _, user := range users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return list
+}
@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLocalUserStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	store := NewFileLocalUserStore(path)
+	ctx := context.Background()
+
+	users, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, users, "a missing file has no accounts")
+
+	require.NoError(t, store.Save(ctx, &models.LocalUser{Username: "bob", PasswordHash: "hash-b"}))
+	require.NoError(t, store.Save(ctx, &models.LocalUser{Username: "alice", PasswordHash: "hash-a"}))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "password hashes are not world-readable")
+
+	// Another store on the same file, like the users command, sees the accounts
+	user, err := NewFileLocalUserStore(path).Get(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "hash-a", user.PasswordHash)
+
+	users, err = store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "alice", users[0].Username)
+
+	require.NoError(t, store.Delete(ctx, "alice"))
+	_, err = store.Get(ctx, "alice")
+	assert.ErrorIs(t, err, errors.ErrNotFound)
+	assert.ErrorIs(t, store.Delete(ctx, "alice"), errors.ErrNotFound)
+}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/firestoreindex"
+)
+
+// expiredLinksIndex serves GetExpiredLinks, which filters on two fields
+var expiredLinksIndex = firestoreindex.Index{
+	Collection: "links",
+	Query:      "GetExpiredLinks",
+	Fields: []firestoreindex.Field{
+		{Path: "is_expired", Order: firestoreindex.OrderAscending},
+		{Path: "expires_at", Order: firestoreindex.OrderAscending},
+	},
+}
+
+// countByUserIndex serves CountByUser, which counts a user's links in the trash
+var countByUserIndex = firestoreindex.Index{
+	Collection: "links",
+	Query:      "CountByUser",
+	Fields: []firestoreindex.Field{
+		{Path: "created_by", Order: firestoreindex.OrderAscending},
+		{Path: "deleted_at", Order: firestoreindex.OrderAscending},
+	},
+}
+
+// countByAccessLevelIndex serves CountByAccessLevel, which counts the links
+// of an access level in the trash
+var countByAccessLevelIndex = firestoreindex.Index{
+	Collection: "links",
+	Query:      "CountByAccessLevel",
+	Fields: []firestoreindex.Field{
+		{Path: "access_level", Order: firestoreindex.OrderAscending},
+		{Path: "deleted_at", Order: firestoreindex.OrderAscending},
+	},
+}
+
+// listFilterFields are the fields List filters links on, as indexed
+var listFilterFields = map[string]firestoreindex.Field{
+	"created_by":   {Path: "created_by", Order: firestoreindex.OrderAscending},
+	"access_level": {Path: "access_level", Order: firestoreindex.OrderAscending},
+	"tags":         {Path: "tags", ArrayConfig: firestoreindex.ArrayContains},
+	"is_expired":   {Path: "is_expired", Order: firestoreindex.OrderAscending},
+}
+
+// listOrderFields are the fields List orders links by, by order
+var listOrderFields = map[string]firestoreindex.Field{
+	models.LinkOrderShort:  {Path: "short", Order: firestoreindex.OrderAscending},
+	models.LinkOrderNewest: {Path: "created_at", Order: firestoreindex.OrderDescending},
+	models.LinkOrderClicks: {Path: "click_count", Order: firestoreindex.OrderDescending},
+}
+
+// listIndex serves List filtering on one field and ordering links by
+// another. Firestore serves queries filtering on several fields by merging
+// the indexes of each.
+func listIndex(filter firestoreindex.Field, order string) firestoreindex.Index {
+	orderField := listOrderFields[order]
+	return firestoreindex.Index{
+		Collection: "links",
+		Query:      "List by " + filter.Path + ", ordered by " + orderField.Path,
+		Fields:     []firestoreindex.Field{filter, orderField},
+	}
+}
+
+// listIndexes are the indexes List needs, one per filter and order
+func listIndexes() []firestoreindex.Index {
+	var indexes []firestoreindex.Index
+	for _, filter := range []string{"created_by", "access_level", "tags", "is_expired"} {
+		for _, order := range []string{models.LinkOrderShort, models.LinkOrderNewest, models.LinkOrderClicks} {
+			indexes = append(indexes, listIndex(listFilterFields[filter], order))
+		}
+	}
+	return indexes
+}
+
+// FirestoreIndexes is the manifest of composite indexes the Firestore
+// repositories' queries need. Queries on a single field are served by
+// Firestore's automatic indexes and are not listed. Add an entry here with
+// every query that combines filters on different fields, or an equality
+// filter with an order on another field.
+var FirestoreIndexes = append([]firestoreindex.Index{
+	expiredLinksIndex,
+	countByUserIndex,
+	countByAccessLevelIndex,
+}, listIndexes()...)
@@ -0,0 +1,19 @@
+package repositories_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/firestoreindex"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirestoreIndexesFileIsCurrent(t *testing.T) {
+	want, err := firestoreindex.FirebaseJSON(repositories.FirestoreIndexes)
+	require.NoError(t, err)
+	got, err := os.ReadFile("../firestore.indexes.json")
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got), "run make firestore-indexes after changing repositories/indexes.go")
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// lease is the Firestore document of a lease
+type lease struct {
+	ExpiresAt time.Time `firestore:"expires_at"`
+	Holder    string    `firestore:"holder"`
+}
+
+// LeaseRepository grants leases stored in Firestore
+type LeaseRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure LeaseRepository implements LeaseStore
+var _ interfaces.LeaseStore = (*LeaseRepository)(nil)
+
+// NewLeaseRepository creates a new LeaseRepository
+func NewLeaseRepository(client *firestore.Client) *LeaseRepository {
+	return &LeaseRepository{
+		client:     client,
+		collection: "leases",
+	}
+}
+
+// Acquire takes or renews a lease. The lease is read and written in one
+// transaction, so two servers never both take it.
+func (r *LeaseRepository) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	ref := r.client.Collection(r.collection).Doc(name)
+	var acquired bool
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		acquired = false
+		now := time.Now()
+		doc, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			var current lease
+			if err := doc.DataTo(&current); err != nil {
+				return err
+			}
+			if current.Holder != holder && now.Before(current.ExpiresAt) {
+				return nil
+			}
+		}
+		acquired = true
+		return tx.Set(ref, lease{ExpiresAt: now.Add(ttl), Holder: holder})
+	})
+	if err != nil {
+		return false, errors.NewInternalError(fmt.Errorf("Error acquiring lease: %w", err))
+	}
+	return acquired, nil
+}
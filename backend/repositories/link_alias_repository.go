@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LinkAliasRepository stores link aliases in Firestore, one document per alias
+type LinkAliasRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure LinkAliasRepository implements LinkAliasStore
+var _ interfaces.LinkAliasStore = (*LinkAliasRepository)(nil)
+
+// NewLinkAliasRepository creates a new LinkAliasRepository
+func NewLinkAliasRepository(client *firestore.Client) *LinkAliasRepository {
+	return &LinkAliasRepository{
+		client:     client,
+		collection: "link_aliases",
+	}
+}
+
+// Create stores an alias. Aliases are keyed by their own code, so two
+// concurrent requests cannot both claim it.
+func (r *LinkAliasRepository) Create(ctx context.Context, alias *models.LinkAlias) error {
+	_, err := r.client.Collection(r.collection).Doc(ShortDocID(alias.Alias)).Create(ctx, alias)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return errors.NewAlreadyExists(fmt.Sprintf("Alias '%s' already exists", alias.Alias))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error creating link alias: %w", err))
+	}
+	return nil
+}
+
+// Get retrieves an alias by its code
+func (r *LinkAliasRepository) Get(ctx context.Context, alias string) (*models.LinkAlias, error) {
+	doc, err := r.client.Collection(r.collection).Doc(ShortDocID(alias)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, errors.NewNotFound(fmt.Sprintf("Alias '%s' not found", alias))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link alias: %w", err))
+	}
+
+	var a models.LinkAlias
+	if err := doc.DataTo(&a); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error converting link alias data: %w", err))
+	}
+	return &a, nil
+}
+
+// ListByShort returns the aliases of a link, oldest first
+func (r *LinkAliasRepository) ListByShort(ctx context.Context, short string) ([]*models.LinkAlias, error) {
+	iter := r.client.Collection(r.collection).Where("short", "==", short).Documents(ctx)
+	var aliases []*models.LinkAlias
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link aliases: %w", err))
+		}
+
+		var alias models.LinkAlias
+		if err := doc.DataTo(&alias); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		aliases = append(aliases, &alias)
+	}
+
+	sortAliases(aliases)
+	return aliases, nil
+}
+
+// Delete removes an alias
+func (r *LinkAliasRepository) Delete(ctx context.Context, alias string) error {
+	if _, err := r.Get(ctx, alias); err != nil {
+		return err
+	}
+	if _, err := r.client.Collection(r.collection).Doc(ShortDocID(alias)).Delete(ctx); err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error deleting link alias: %w", err))
+	}
+	return nil
+}
+
+// DeleteByShort removes every alias of a link
+func (r *LinkAliasRepository) DeleteByShort(ctx context.Context, short string) error {
+	aliases, err := r.ListByShort(ctx, short)
+	if err != nil {
+		return err
+	}
+	for _, a := range aliases {
+		if _, err := r.client.Collection(r.collection).Doc(ShortDocID(a.Alias)).Delete(ctx); err != nil {
+			return errors.NewInternalError(fmt.Errorf("Error deleting link alias: %w", err))
+		}
+	}
+	return nil
+}
+
+// sortAliases orders aliases oldest first
+func sortAliases(aliases []*models.LinkAlias) {
+	sort.Slice(aliases, func(i, j int) bool {
+		if !aliases[i].CreatedAt.Equal(aliases[j].CreatedAt) {
+			return aliases[i].CreatedAt.Before(aliases[j].CreatedAt)
+		}
+		return aliases[i].Alias < aliases[j].Alias
+	})
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// LinkReferenceRepository stores link references in Firestore
+type LinkReferenceRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure LinkReferenceRepository implements LinkReferenceStore
+var _ interfaces.LinkReferenceStore = (*LinkReferenceRepository)(nil)
+
+// NewLinkReferenceRepository creates a new LinkReferenceRepository
+func NewLinkReferenceRepository(client *firestore.Client) *LinkReferenceRepository {
+	return &LinkReferenceRepository{
+		client:     client,
+		collection: "link_references",
+	}
+}
+
+// ReplaceDocument sets the references made by one document in a single batch
+func (r *LinkReferenceRepository) ReplaceDocument(ctx context.Context, documentURL string, refs []*models.LinkReference) error {
+	existing, err := r.query(ctx, r.client.Collection(r.collection).Where("document_url", "==", documentURL))
+	if err != nil {
+		return err
+	}
+
+	batch := r.client.Batch()
+	kept := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		id := referenceDocID(ref.Short, documentURL)
+		kept[id] = true
+		batch.Set(r.client.Collection(r.collection).Doc(id), ref)
+	}
+	for _, ref := range existing {
+		if id := referenceDocID(ref.Short, documentURL); !kept[id] {
+			batch.Delete(r.client.Collection(r.collection).Doc(id))
+		}
+	}
+	if len(refs) == 0 && len(existing) == 0 {
+		return nil
+	}
+
+	if err := commitBatch(ctx, batch, r.collection); err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error storing link references: %w", err))
+	}
+	return nil
+}
+
+// ListByShort returns the references to a link, most frequent first
+func (r *LinkReferenceRepository) ListByShort(ctx context.Context, short string) ([]*models.LinkReference, error) {
+	refs, err := r.query(ctx, r.client.Collection(r.collection).Where("short", "==", short))
+	if err != nil {
+		return nil, err
+	}
+	sortReferences(refs)
+	return refs, nil
+}
+
+// query collects the references matched by q
+func (r *LinkReferenceRepository) query(ctx context.Context, q firestore.Query) ([]*models.LinkReference, error) {
+	iter := q.Documents(ctx)
+	var refs []*models.LinkReference
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link references: %w", err))
+		}
+
+		var ref models.LinkReference
+		if err := doc.DataTo(&ref); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		refs = append(refs, &ref)
+	}
+	return refs, nil
+}
+
+// referenceDocID returns the document ID of a link reference. Document URLs
+// may contain slashes, so the pair is hashed into a valid ID.
+func referenceDocID(short, documentURL string) string {
+	sum := sha256.Sum256([]byte(short + "\x00" + documentURL))
+	return hex.EncodeToString(sum[:16])
+}
+
+// sortReferences orders references by count, most frequent first, then by document
+func sortReferences(refs []*models.LinkReference) {
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Count != refs[j].Count {
+			return refs[i].Count > refs[j].Count
+		}
+		return refs[i].DocumentURL < refs[j].DocumentURL
+	})
+}
@@ -3,21 +3,46 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
 	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
 	"github.com/Okabe-Junya/golink-backend/models"
 	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/firestoreindex"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/jobs"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
 	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// LinkRepository handles database operations for links
+// repoLog logs storage events of the repositories
+var repoLog = logger.For("repository")
+
+// maxBatchReads is the most documents read in one batched read
+const maxBatchReads = 100
+
+// LinkRepository handles database operations for links. Link documents are
+// keyed by the link's ID; a claim document per short code in the "link_shorts"
+// collection points to the link using it, keeping short codes unique and
+// letting links change their short code. Links stored before IDs were
+// assigned are still keyed by their short code until they are migrated.
 type LinkRepository struct {
 	client     *firestore.Client
 	collection string
+	shorts     string
+}
+
+// shortClaim is the document claiming a short code for a link
+type shortClaim struct {
+	LinkID string `firestore:"link_id"`
+	Short  string `firestore:"short"`
 }
 
 // Ensure LinkRepository implements LinkRepositoryInterface
@@ -28,14 +53,26 @@ func NewLinkRepository(client *firestore.Client) *LinkRepository {
 	return &LinkRepository{
 		client:     client,
 		collection: "links",
+		shorts:     "link_shorts",
 	}
 }
 
+// ShortDocID returns the document ID of a link's documents. Firestore treats
+// slashes in IDs as path separators, so the slashes of namespaced short codes
+// are stored as '~', which short codes cannot contain.
+func ShortDocID(short string) string {
+	return strings.ReplaceAll(short, "/", "~")
+}
+
 // Create adds a new link to the database
-func (r *LinkRepository) Create(ctx context.Context, link *models.Link) error {
-	// Check if the link already exists
-	existingLink, err := r.GetByShort(ctx, link.Short)
+func (r *LinkRepository) Create(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("create", time.Now(), &err)
+	// Check if the link already exists; a trashed link keeps its short code until purged
+	existingLink, err := r.get(ctx, link.Short)
 	if err == nil && existingLink != nil {
+		if existingLink.IsDeleted() {
+			return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' is in the trash; restore it or wait until it is purged", link.Short))
+		}
 		return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", link.Short))
 	}
 
@@ -46,33 +83,197 @@ func (r *LinkRepository) Create(ctx context.Context, link *models.Link) error {
 		}
 	}
 
-	// Set the timestamps
+	// Set the ID, timestamps and schema version
+	if link.ID == "" {
+		link.ID = models.NewLinkID()
+	}
 	now := time.Now()
 	link.CreatedAt = now
 	link.UpdatedAt = now
+	link.SchemaVersion = models.LinkSchemaVersion
 
-	// Create the link
-	_, err = r.client.Collection(r.collection).Doc(link.Short).Set(ctx, link)
+	// Claim the short code along with creating the link; the transaction
+	// fails if another request claimed the short code meanwhile
+	err = r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		taken, err := r.txShortTaken(tx, link.Short)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", link.Short))
+		}
+		if err := tx.Set(r.claimRef(link.Short), shortClaim{LinkID: link.ID, Short: link.Short}); err != nil {
+			return err
+		}
+		return tx.Create(r.client.Collection(r.collection).Doc(link.ID), link)
+	})
 	if err != nil {
+		if errors.Is(err, errors.ErrAlreadyExists) {
+			return err
+		}
+		if status.Code(err) == codes.AlreadyExists {
+			return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", link.Short))
+		}
 		return errors.NewInternalError(fmt.Errorf("Error creating link: %w", err))
 	}
 
 	return nil
 }
 
-// GetByShort retrieves a link by its short code
-func (r *LinkRepository) GetByShort(ctx context.Context, short string) (*models.Link, error) {
-	doc, err := r.client.Collection(r.collection).Doc(short).Get(ctx)
+// GetByShort retrieves a link by its short code. Links in the trash are not found.
+func (r *LinkRepository) GetByShort(ctx context.Context, short string) (_ *models.Link, err error) {
+	defer observeOperation("get_by_short", time.Now(), &err)
+	link, err := r.get(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+	if link.IsDeleted() {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	return link, nil
+}
+
+// GetByShorts retrieves links by their short codes in two batched reads,
+// one of their claims and one of their documents
+func (r *LinkRepository) GetByShorts(ctx context.Context, shorts []string) (_ map[string]*models.Link, err error) {
+	defer observeOperation("get_by_shorts", time.Now(), &err)
+	shorts = slices.Compact(slices.Sorted(slices.Values(shorts)))
+	claimRefs := make([]*firestore.DocumentRef, len(shorts))
+	for i, short := range shorts {
+		claimRefs[i] = r.claimRef(short)
+	}
+	claims, err := r.getAll(ctx, claimRefs)
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving short code claims: %w", err))
+	}
+	refs := make([]*firestore.DocumentRef, len(shorts))
+	for i, short := range shorts {
+		if refs[i], err = r.claimedRef(short, claims[i], nil); err != nil {
+			return nil, err
+		}
+	}
+	docs, err := r.getAll(ctx, refs)
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+
+	links := make(map[string]*models.Link, len(shorts))
+	for i, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		link, err := decodeLink(doc)
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error converting link data: %w", err))
+		}
+		// A claim left behind by an interrupted write must not lend its short code
+		if link.Short != shorts[i] || link.IsDeleted() {
+			continue
+		}
+		links[link.Short] = link
+	}
+	return links, nil
+}
+
+// getAll reads documents in batches of at most maxBatchReads, returning
+// them in the order of refs
+func (r *LinkRepository) getAll(ctx context.Context, refs []*firestore.DocumentRef) ([]*firestore.DocumentSnapshot, error) {
+	docs := make([]*firestore.DocumentSnapshot, 0, len(refs))
+	for start := 0; start < len(refs); start += maxBatchReads {
+		batch, err := r.client.GetAll(ctx, refs[start:min(start+maxBatchReads, len(refs))])
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, batch...)
+	}
+	return docs, nil
+}
+
+// claimRef returns the document claiming a short code
+func (r *LinkRepository) claimRef(short string) *firestore.DocumentRef {
+	return r.client.Collection(r.shorts).Doc(ShortDocID(short))
+}
+
+// linkRef returns the document of the link with the given short code
+func (r *LinkRepository) linkRef(ctx context.Context, short string) (*firestore.DocumentRef, error) {
+	claim, err := r.claimRef(short).Get(ctx)
+	return r.claimedRef(short, claim, err)
+}
+
+// txLinkRef returns the document of the link with the given short code
+// within a transaction
+func (r *LinkRepository) txLinkRef(tx *firestore.Transaction, short string) (*firestore.DocumentRef, error) {
+	claim, err := tx.Get(r.claimRef(short))
+	return r.claimedRef(short, claim, err)
+}
+
+// txShortTaken reports, within a transaction, whether a link uses the short
+// code. A claim whose link is missing or has moved on to another short code
+// was left behind by an interrupted write, and may be taken over.
+func (r *LinkRepository) txShortTaken(tx *firestore.Transaction, short string) (bool, error) {
+	ref, err := r.txLinkRef(tx, short)
+	if err != nil {
+		return false, err
+	}
+	doc, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	link, err := decodeLink(doc)
+	if err != nil {
+		return false, err
+	}
+	return link.Short == short, nil
+}
+
+// claimedRef follows the claim of a short code, as read with err, to the
+// document of the link using it. A short code without a claim may belong to
+// a link stored before IDs were assigned, whose document is keyed by it.
+func (r *LinkRepository) claimedRef(short string, doc *firestore.DocumentSnapshot, err error) (*firestore.DocumentRef, error) {
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving short code claim: %w", err))
+	}
+	if !doc.Exists() {
+		return r.client.Collection(r.collection).Doc(ShortDocID(short)), nil
+	}
+	var claim shortClaim
+	if err := doc.DataTo(&claim); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error converting short code claim: %w", err))
+	}
+	return r.client.Collection(r.collection).Doc(claim.LinkID), nil
+}
+
+// get retrieves a link by its short code, including links in the trash
+func (r *LinkRepository) get(ctx context.Context, short string) (*models.Link, error) {
+	_, link, err := r.find(ctx, short)
+	return link, err
+}
+
+// find retrieves a link and its document by short code, including links in
+// the trash
+func (r *LinkRepository) find(ctx context.Context, short string) (*firestore.DocumentRef, *models.Link, error) {
+	ref, err := r.linkRef(ctx, short)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := ref.Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+			return nil, nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
 		}
-		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link: %w", err))
+		return nil, nil, errors.NewInternalError(fmt.Errorf("Error retrieving link: %w", err))
 	}
 
-	var link models.Link
-	if err := doc.DataTo(&link); err != nil {
-		return nil, errors.NewInternalError(fmt.Errorf("Error converting link data: %w", err))
+	link, err := decodeLink(doc)
+	if err != nil {
+		return nil, nil, errors.NewInternalError(fmt.Errorf("Error converting link data: %w", err))
+	}
+	// A claim left behind by an interrupted write must not lend its short code
+	if link.Short != short {
+		return nil, nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
 	}
 
 	// Update expiry status if needed
@@ -81,48 +282,84 @@ func (r *LinkRepository) GetByShort(ctx context.Context, short string) (*models.
 		// Persist in the background on a *copy*: the background writer mutates
 		// UpdatedAt and marshals the struct while the caller concurrently reads the
 		// returned pointer, so they must not share the same *Link (data race).
-		linkCopy := link
+		linkCopy := link.Clone()
 		go func() {
 			bgCtx := context.Background()
-			if err := r.Update(bgCtx, &linkCopy); err != nil {
-				// We're in a goroutine, so we can't return the error
-				// Ideally, we would log this error
+			err := r.Update(bgCtx, linkCopy)
+			jobs.Record("link-expiry", err)
+			if err != nil {
+				repoLog.Error("Failed to mark link expired", err, logger.Fields{"job": "link-expiry", "short": linkCopy.Short})
 			}
 		}()
 	}
 
-	return &link, nil
+	return ref, link, nil
 }
 
 // GetAll retrieves all links
-func (r *LinkRepository) GetAll(ctx context.Context) ([]*models.Link, error) {
-	iter := r.client.Collection(r.collection).Documents(ctx)
-	var links []*models.Link
+func (r *LinkRepository) GetAll(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_all", time.Now(), &err)
+	// One link past the cap tells whether links were left out
+	limit := linkcap.Max(ctx)
+	if limit > 0 {
+		limit++
+	}
+	links, err := collectLinksUpTo(r.client.Collection(r.collection).Documents(ctx), false, limit, "Error retrieving links")
+	if err != nil {
+		return nil, err
+	}
+	return linkcap.Apply(ctx, links), nil
+}
 
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
-		}
+// List retrieves the links a query selects. Firestore filters the links by
+// field and orders them, served by the composite indexes of listIndexes;
+// access and archival are checked as the links stream in, until enough
+// were found.
+func (r *LinkRepository) List(ctx context.Context, query models.LinkQuery) (_ []*models.Link, err error) {
+	defer observeOperation("list", time.Now(), &err)
+	q := r.client.Collection(r.collection).Query
+	var filters []firestoreindex.Field
+	if query.CreatedBy != "" {
+		q = q.Where("created_by", "==", query.CreatedBy)
+		filters = append(filters, listFilterFields["created_by"])
+	}
+	if query.AccessLevel != "" {
+		q = q.Where("access_level", "==", query.AccessLevel)
+		filters = append(filters, listFilterFields["access_level"])
+	}
+	if query.Tag != "" {
+		q = q.Where("tags", "array-contains", models.NormalizeTag(query.Tag))
+		filters = append(filters, listFilterFields["tags"])
+	}
+	if query.Expired != nil {
+		q = q.Where("is_expired", "==", *query.Expired)
+		filters = append(filters, listFilterFields["is_expired"])
+	}
+	order := listOrderFields[query.OrderBy]
+	direction := firestore.Asc
+	if order.Order == firestoreindex.OrderDescending {
+		direction = firestore.Desc
+	}
+	q = q.OrderBy(order.Path, direction)
 
-		var link models.Link
-		if err := doc.DataTo(&link); err != nil {
-			// Log error but continue with next document
-			continue
+	links, err := collectMatchingLinks(q.Documents(ctx), query.Matches, listLimit(ctx, query.Limit), "Error listing links")
+	if err != nil {
+		if len(filters) > 0 {
+			err = firestoreindex.CheckQueryError(err, listIndex(filters[0], query.OrderBy))
 		}
-		links = append(links, &link)
+		return nil, err
 	}
-
-	return links, nil
+	return linkcap.Apply(ctx, links), nil
 }
 
 // Update updates an existing link
-func (r *LinkRepository) Update(ctx context.Context, link *models.Link) error {
+func (r *LinkRepository) Update(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("update", time.Now(), &err)
 	// Check if the link exists
-	_, err := r.GetByShort(ctx, link.Short)
+	ref, existing, err := r.find(ctx, link.Short)
+	if err == nil && existing.IsDeleted() {
+		err = errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+	}
 	if err != nil {
 		if errors.Is(err, errors.ErrNotFound) {
 			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
@@ -130,11 +367,19 @@ func (r *LinkRepository) Update(ctx context.Context, link *models.Link) error {
 		return errors.Wrap(err, "Error checking if link exists")
 	}
 
-	// Update the timestamp
+	// Overwriting a document from a newer schema would drop fields this server doesn't know
+	if existing.SchemaVersion > models.LinkSchemaVersion {
+		return errors.NewInternalError(fmt.Errorf("link '%s' has schema version %d, newer than supported version %d",
+			link.Short, existing.SchemaVersion, models.LinkSchemaVersion))
+	}
+
+	// Update the timestamp and store in the current schema; the ID never changes
+	link.ID = existing.ID
 	link.UpdatedAt = time.Now()
+	link.SchemaVersion = models.LinkSchemaVersion
 
 	// Update the link
-	_, err = r.client.Collection(r.collection).Doc(link.Short).Set(ctx, link)
+	_, err = ref.Set(ctx, link)
 	if err != nil {
 		return errors.NewInternalError(fmt.Errorf("Error updating link: %w", err))
 	}
@@ -142,10 +387,14 @@ func (r *LinkRepository) Update(ctx context.Context, link *models.Link) error {
 	return nil
 }
 
-// Delete removes a link by its short code
-func (r *LinkRepository) Delete(ctx context.Context, short string) error {
-	// Check if the link exists
-	_, err := r.GetByShort(ctx, short)
+// Delete moves a link to the trash by its short code
+func (r *LinkRepository) Delete(ctx context.Context, short string) (err error) {
+	defer observeOperation("delete", time.Now(), &err)
+	// Check if the link exists and is not already in the trash
+	ref, link, err := r.find(ctx, short)
+	if err == nil && link.IsDeleted() {
+		err = errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
 	if err != nil {
 		if errors.Is(err, errors.ErrNotFound) {
 			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
@@ -153,8 +402,11 @@ func (r *LinkRepository) Delete(ctx context.Context, short string) error {
 		return errors.Wrap(err, "Error checking if link exists")
 	}
 
-	// Delete the link
-	_, err = r.client.Collection(r.collection).Doc(short).Delete(ctx)
+	now := time.Now()
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "deleted_at", Value: now},
+		{Path: "updated_at", Value: now},
+	})
 	if err != nil {
 		return errors.NewInternalError(fmt.Errorf("Error deleting link: %w", err))
 	}
@@ -162,16 +414,211 @@ func (r *LinkRepository) Delete(ctx context.Context, short string) error {
 	return nil
 }
 
+// GetDeleted retrieves all links in the trash
+func (r *LinkRepository) GetDeleted(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_deleted", time.Now(), &err)
+	// Live links have no deleted_at field, so only trashed links match
+	query := r.client.Collection(r.collection).Where("deleted_at", ">", time.Time{})
+	return collectLinks(query.Documents(ctx), true, "Error retrieving deleted links")
+}
+
+// GetDeletedByShort retrieves a link in the trash by its short code
+func (r *LinkRepository) GetDeletedByShort(ctx context.Context, short string) (_ *models.Link, err error) {
+	defer observeOperation("get_deleted_by_short", time.Now(), &err)
+	link, err := r.get(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+	if !link.IsDeleted() {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+	}
+	return link, nil
+}
+
+// Restore moves a link out of the trash
+func (r *LinkRepository) Restore(ctx context.Context, short string) (err error) {
+	defer observeOperation("restore", time.Now(), &err)
+	ref, link, err := r.find(ctx, short)
+	if err != nil {
+		return err
+	}
+	if !link.IsDeleted() {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+	}
+
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "deleted_at", Value: firestore.Delete},
+		{Path: "updated_at", Value: time.Now()},
+	})
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error restoring link: %w", err))
+	}
+
+	return nil
+}
+
+// Purge permanently removes a link, its short code claim and its statistics
+// in a transaction, so that no claim is left pointing at a removed link
+func (r *LinkRepository) Purge(ctx context.Context, short string) (err error) {
+	defer observeOperation("purge", time.Now(), &err)
+	err = r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref, err := r.txLinkRef(tx, short)
+		if err != nil {
+			return err
+		}
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+			}
+			return err
+		}
+		link, err := decodeLink(doc)
+		if err != nil {
+			return err
+		}
+		if link.Short != short {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+
+		if err := tx.Delete(ref); err != nil {
+			return err
+		}
+		if err := tx.Delete(r.claimRef(short)); err != nil {
+			return err
+		}
+		return tx.Delete(r.client.Collection("link_stats").Doc(ShortDocID(short)))
+	})
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			return err
+		}
+		return errors.NewInternalError(fmt.Errorf("Error purging link: %w", err))
+	}
+	return nil
+}
+
+// Rename changes a link's short code in a transaction: the new code is
+// claimed and the old one released, and the link's statistics move along. A
+// link stored before IDs were assigned is given one, since its document was
+// keyed by the old code.
+func (r *LinkRepository) Rename(ctx context.Context, short, newShort string) (_ *models.Link, err error) {
+	defer observeOperation("rename", time.Now(), &err)
+	stats := r.client.Collection("link_stats")
+	var renamed *models.Link
+	err = r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref, err := r.txLinkRef(tx, short)
+		if err != nil {
+			return err
+		}
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+			}
+			return err
+		}
+		link, err := decodeLink(doc)
+		if err != nil {
+			return err
+		}
+		if link.Short != short || link.IsDeleted() {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		if link.SchemaVersion > models.LinkSchemaVersion {
+			return fmt.Errorf("link '%s' has schema version %d, newer than supported version %d",
+				short, link.SchemaVersion, models.LinkSchemaVersion)
+		}
+
+		// The new code must be free, also of links still keyed by their code
+		taken, err := r.txShortTaken(tx, newShort)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", newShort))
+		}
+		statsDoc, err := tx.Get(stats.Doc(ShortDocID(short)))
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		legacy := ref.ID == ShortDocID(short)
+		if legacy {
+			link.ID = models.NewLinkID()
+		}
+		link.Short = newShort
+		link.UpdatedAt = time.Now()
+		link.SchemaVersion = models.LinkSchemaVersion
+
+		if err := tx.Set(r.claimRef(newShort), shortClaim{LinkID: link.ID, Short: newShort}); err != nil {
+			return err
+		}
+		if err := tx.Delete(r.claimRef(short)); err != nil {
+			return err
+		}
+		if legacy {
+			if err := tx.Delete(ref); err != nil {
+				return err
+			}
+			ref = r.client.Collection(r.collection).Doc(link.ID)
+		}
+		if err := tx.Set(ref, link); err != nil {
+			return err
+		}
+		if statsDoc != nil && statsDoc.Exists() {
+			data := statsDoc.Data()
+			data["short"] = newShort
+			if err := tx.Set(stats.Doc(ShortDocID(newShort)), data); err != nil {
+				return err
+			}
+			if err := tx.Delete(statsDoc.Ref); err != nil {
+				return err
+			}
+		}
+		renamed = link
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) || errors.Is(err, errors.ErrAlreadyExists) {
+			return nil, err
+		}
+		// Another request claimed the new code meanwhile
+		if status.Code(err) == codes.AlreadyExists {
+			return nil, errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", newShort))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error renaming link: %w", err))
+	}
+	return renamed, nil
+}
+
 // IncrementClickCount increments the click count for a link.
 //
 // This fires from a background goroutine on every redirect, so a read-modify-write
 // of the whole document would lose increments under concurrency and, worse, clobber
 // a concurrent edit (URL/access-level change) with a stale snapshot. Update only the
 // counter field via an atomic server-side increment instead.
-func (r *LinkRepository) IncrementClickCount(ctx context.Context, short string) error {
-	_, err := r.client.Collection(r.collection).Doc(short).Update(ctx, []firestore.Update{
+//
+// Links with a click limit are counted in a transaction that fails with a Gone
+// error once the limit is reached, so concurrent clicks cannot overshoot it.
+func (r *LinkRepository) IncrementClickCount(ctx context.Context, short string) (err error) {
+	defer observeOperation("increment_click_count", time.Now(), &err)
+	ref, link, err := r.find(ctx, short)
+	if err != nil {
+		return err
+	}
+	if link.IsDeleted() {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	if link.MaxClicks > 0 {
+		return r.incrementLimitedClickCount(ctx, ref, short)
+	}
+
+	now := time.Now()
+	_, err = ref.Update(ctx, []firestore.Update{
 		{Path: "click_count", Value: firestore.Increment(1)},
-		{Path: "updated_at", Value: time.Now()},
+		{Path: "updated_at", Value: now},
+		{Path: "last_clicked_at", Value: now},
 	})
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
@@ -183,147 +630,232 @@ func (r *LinkRepository) IncrementClickCount(ctx context.Context, short string)
 	return nil
 }
 
-// GetByAccessLevel retrieves links by access level
-func (r *LinkRepository) GetByAccessLevel(ctx context.Context, accessLevel string) ([]*models.Link, error) {
-	query := r.client.Collection(r.collection).Where("access_level", "==", accessLevel)
-	iter := query.Documents(ctx)
-	var links []*models.Link
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
+// incrementLimitedClickCount counts a click on a link with a click limit
+func (r *LinkRepository) incrementLimitedClickCount(ctx context.Context, ref *firestore.DocumentRef, short string) error {
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
 		if err != nil {
-			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links by access level: %w", err))
+			if status.Code(err) == codes.NotFound {
+				return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+			}
+			return err
 		}
 
 		var link models.Link
 		if err := doc.DataTo(&link); err != nil {
-			// Log error but continue with next document
-			continue
+			return err
+		}
+		if link.IsDeleted() {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		if link.ClickLimitReached() {
+			return errors.NewGone(fmt.Sprintf("Link '%s' has reached its click limit", short))
 		}
-		links = append(links, &link)
-	}
 
-	return links, nil
+		now := time.Now()
+		return tx.Update(ref, []firestore.Update{
+			{Path: "click_count", Value: firestore.Increment(1)},
+			{Path: "updated_at", Value: now},
+			{Path: "last_clicked_at", Value: now},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) || errors.Is(err, errors.ErrGone) {
+			return err
+		}
+		return errors.NewInternalError(fmt.Errorf("Error updating click count: %w", err))
+	}
+	return nil
 }
 
-// GetByUser retrieves links created by a specific user
-func (r *LinkRepository) GetByUser(ctx context.Context, userID string) ([]*models.Link, error) {
-	query := r.client.Collection(r.collection).Where("created_by", "==", userID)
-	iter := query.Documents(ctx)
-	var links []*models.Link
+// RecordRolloutClick counts a click on one variant of the link's rollout. It
+// runs in a transaction so a click racing a rollback cannot recreate the
+// removed rollout as a bare counter.
+func (r *LinkRepository) RecordRolloutClick(ctx context.Context, short, variant string) (err error) {
+	defer observeOperation("record_rollout_click", time.Now(), &err)
+	field := "rollout.primary_clicks"
+	if variant == models.RolloutVariants.Canary {
+		field = "rollout.canary_clicks"
+	}
 
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
+	err = r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref, err := r.txLinkRef(tx, short)
+		if err != nil {
+			return err
 		}
+		doc, err := tx.Get(ref)
 		if err != nil {
-			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links by user: %w", err))
+			if status.Code(err) == codes.NotFound {
+				return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+			}
+			return err
 		}
-
-		var link models.Link
-		if err := doc.DataTo(&link); err != nil {
-			// Log error but continue with next document
-			continue
+		if rollout, _ := doc.Data()["rollout"].(map[string]interface{}); rollout == nil {
+			return nil
+		}
+		return tx.Update(ref, []firestore.Update{{Path: field, Value: firestore.Increment(1)}})
+	})
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			return err
 		}
-		links = append(links, &link)
+		return errors.NewInternalError(fmt.Errorf("Error recording rollout click: %w", err))
 	}
-
-	return links, nil
+	return nil
 }
 
-// CheckAccess determines if a user has access to a link
-func (r *LinkRepository) CheckAccess(ctx context.Context, short string, userID string) (bool, error) {
-	link, err := r.GetByShort(ctx, short)
+// UpdatePopularity stores the link's popularity score fields. Only those
+// fields are written, so the periodic scoring job cannot undo a concurrent edit.
+func (r *LinkRepository) UpdatePopularity(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("update_popularity", time.Now(), &err)
+	ref, err := r.linkRef(ctx, link.Short)
 	if err != nil {
-		return false, err // Already wrapped by GetByShort
+		return err
 	}
-
-	// Public links are accessible to everyone
-	if link.AccessLevel == models.AccessLevels.Public {
-		return true, nil
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "popularity_score", Value: link.PopularityScore},
+		{Path: "scored_at", Value: link.ScoredAt},
+		{Path: "scored_clicks", Value: link.ScoredClicks},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error updating popularity score: %w", err))
 	}
+	return nil
+}
 
-	// Private links are only accessible to the creator
-	if link.AccessLevel == models.AccessLevels.Private {
-		return link.CreatedBy == userID, nil
-	}
+// GetByAccessLevel retrieves links by access level
+func (r *LinkRepository) GetByAccessLevel(ctx context.Context, accessLevel string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_access_level", time.Now(), &err)
+	query := r.client.Collection(r.collection).Where("access_level", "==", accessLevel)
+	return collectLinks(query.Documents(ctx), false, "Error retrieving links by access level")
+}
 
-	// Restricted links are accessible to the creator and allowed users
-	if link.AccessLevel == models.AccessLevels.Restricted {
-		if link.CreatedBy == userID {
-			return true, nil
-		}
+// GetByUser retrieves links created by a specific user
+func (r *LinkRepository) GetByUser(ctx context.Context, userID string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_user", time.Now(), &err)
+	query := r.client.Collection(r.collection).Where("created_by", "==", userID)
+	return collectLinks(query.Documents(ctx), false, "Error retrieving links by user")
+}
 
-		// Check if the user is in the allowed users list
-		for _, allowedUser := range link.AllowedUsers {
-			if allowedUser == userID {
-				return true, nil
-			}
-		}
+// Ping reads at most one link document to check that Firestore answers
+func (r *LinkRepository) Ping(ctx context.Context) (err error) {
+	defer observeOperation("ping", time.Now(), &err)
+	_, err = r.client.Collection(r.collection).Limit(1).Documents(ctx).Next()
+	if err == iterator.Done {
+		return nil
 	}
+	return err
+}
 
-	return false, nil
+// CountAll counts the links outside the trash with aggregation queries
+func (r *LinkRepository) CountAll(ctx context.Context) (_ int, err error) {
+	defer observeOperation("count_all", time.Now(), &err)
+	return r.count(ctx, r.client.Collection(r.collection).Query, nil)
 }
 
-// GetExpiredLinks retrieves all expired links
-func (r *LinkRepository) GetExpiredLinks(ctx context.Context) ([]*models.Link, error) {
-	now := time.Now()
-	query := r.client.Collection(r.collection).Where("expires_at", "<", now).Where("is_expired", "==", false)
-	iter := query.Documents(ctx)
-	var links []*models.Link
+// CountByUser counts the links outside the trash created by a user
+func (r *LinkRepository) CountByUser(ctx context.Context, userID string) (_ int, err error) {
+	defer observeOperation("count_by_user", time.Now(), &err)
+	query := r.client.Collection(r.collection).Where("created_by", "==", userID)
+	return r.count(ctx, query, &countByUserIndex)
+}
 
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving expired links: %w", err))
-		}
+// CountByAccessLevel counts the links outside the trash with an access level
+func (r *LinkRepository) CountByAccessLevel(ctx context.Context, accessLevel string) (_ int, err error) {
+	defer observeOperation("count_by_access_level", time.Now(), &err)
+	query := r.client.Collection(r.collection).Where("access_level", "==", accessLevel)
+	return r.count(ctx, query, &countByAccessLevelIndex)
+}
 
-		var link models.Link
-		if err := doc.DataTo(&link); err != nil {
-			// Log error but continue with next document
-			continue
+// count counts the live links among those query selects: all of them less
+// those in the trash, each counted by Firestore without reading the
+// documents. index serves counting those in the trash, when it needs one.
+func (r *LinkRepository) count(ctx context.Context, query firestore.Query, index *firestoreindex.Index) (int, error) {
+	total, err := aggregateCount(ctx, query)
+	if err != nil {
+		return 0, errors.NewInternalError(fmt.Errorf("Error counting links: %w", err))
+	}
+	// Live links have no deleted_at field, so only trashed links match
+	deleted, err := aggregateCount(ctx, query.Where("deleted_at", ">", time.Time{}))
+	if err != nil {
+		if index != nil {
+			err = firestoreindex.CheckQueryError(err, *index)
 		}
-		links = append(links, &link)
+		return 0, errors.NewInternalError(fmt.Errorf("Error counting deleted links: %w", err))
 	}
+	return int(total - deleted), nil
+}
 
-	return links, nil
+// aggregateCount counts the documents query selects
+func aggregateCount(ctx context.Context, query firestore.Query) (int64, error) {
+	result, err := query.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count, ok := result["count"].(*firestorepb.Value)
+	if !ok {
+		return 0, fmt.Errorf("unexpected count result %T", result["count"])
+	}
+	return count.GetIntegerValue(), nil
 }
 
-// GetLinksByExpiryStatus retrieves links by their expiry status
-func (r *LinkRepository) GetLinksByExpiryStatus(ctx context.Context, isExpired bool) ([]*models.Link, error) {
-	query := r.client.Collection(r.collection).Where("is_expired", "==", isExpired)
-	iter := query.Documents(ctx)
-	var links []*models.Link
+// GetByTag retrieves links carrying a tag
+func (r *LinkRepository) GetByTag(ctx context.Context, tag string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_tag", time.Now(), &err)
+	query := r.client.Collection(r.collection).Where("tags", "array-contains", models.NormalizeTag(tag))
+	return collectLinks(query.Documents(ctx), false, "Error retrieving links by tag")
+}
 
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links by expiry status: %w", err))
-		}
+// GetByURL retrieves links pointing at exactly the given destination. The
+// single-field index Firestore keeps on "url" serves the query.
+func (r *LinkRepository) GetByURL(ctx context.Context, url string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_url", time.Now(), &err)
+	query := r.client.Collection(r.collection).Where("url", "==", url)
+	return collectLinks(query.Documents(ctx), false, "Error retrieving links by URL")
+}
 
-		var link models.Link
-		if err := doc.DataTo(&link); err != nil {
-			// Log error but continue with next document
-			continue
-		}
-		links = append(links, &link)
+// GetByNamespace retrieves links whose short codes lie below a namespace. It
+// ranges over short codes starting with "namespace/"; '0' sorts right after '/'.
+func (r *LinkRepository) GetByNamespace(ctx context.Context, namespace string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_namespace", time.Now(), &err)
+	query := r.client.Collection(r.collection).
+		Where("short", ">=", namespace+"/").
+		Where("short", "<", namespace+"0")
+	return collectLinks(query.Documents(ctx), false, "Error retrieving links by namespace")
+}
+
+// CheckAccess determines if a user has access to a link
+func (r *LinkRepository) CheckAccess(ctx context.Context, short string, userID string) (_ bool, err error) {
+	defer observeOperation("check_access", time.Now(), &err)
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return false, err // Already wrapped by GetByShort
 	}
+	return link.CanAccessAs(userID, groups.FromContext(ctx)), nil
+}
 
-	return links, nil
+// GetExpiredLinks retrieves all expired links
+func (r *LinkRepository) GetExpiredLinks(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_expired_links", time.Now(), &err)
+	now := time.Now()
+	query := r.client.Collection(r.collection).Where("expires_at", "<", now).Where("is_expired", "==", false)
+	links, err := collectLinks(query.Documents(ctx), false, "Error retrieving expired links")
+	return links, firestoreindex.CheckQueryError(err, expiredLinksIndex)
+}
+
+// GetLinksByExpiryStatus retrieves links by their expiry status
+func (r *LinkRepository) GetLinksByExpiryStatus(ctx context.Context, isExpired bool) (_ []*models.Link, err error) {
+	defer observeOperation("get_links_by_expiry_status", time.Now(), &err)
+	query := r.client.Collection(r.collection).Where("is_expired", "==", isExpired)
+	return collectLinks(query.Documents(ctx), false, "Error retrieving links by expiry status")
 }
 
 // GetLinkStats retrieves statistics for a link
-func (r *LinkRepository) GetLinkStats(ctx context.Context, short string) (*models.LinkStats, error) {
+func (r *LinkRepository) GetLinkStats(ctx context.Context, short string) (_ *models.LinkStats, err error) {
+	defer observeOperation("get_link_stats", time.Now(), &err)
 	// Check if the link exists
 	link, err := r.GetByShort(ctx, short)
 	if err != nil {
@@ -331,12 +863,12 @@ func (r *LinkRepository) GetLinkStats(ctx context.Context, short string) (*model
 	}
 
 	// Check if stats document exists
-	statsDoc, err := r.client.Collection("link_stats").Doc(short).Get(ctx)
+	statsDoc, err := r.client.Collection("link_stats").Doc(ShortDocID(short)).Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			// Create new stats if not found
 			stats := models.NewLinkStats(short)
-			_, err = r.client.Collection("link_stats").Doc(short).Set(ctx, stats)
+			_, err = r.client.Collection("link_stats").Doc(ShortDocID(short)).Set(ctx, stats)
 			if err != nil {
 				return nil, errors.NewInternalError(fmt.Errorf("Error creating link stats: %w", err))
 			}
@@ -346,13 +878,215 @@ func (r *LinkRepository) GetLinkStats(ctx context.Context, short string) (*model
 	}
 
 	// Parse stats document
-	var stats models.LinkStats
-	if err := statsDoc.DataTo(&stats); err != nil {
+	stats, _, err := models.DecodeLinkStats(statsDoc.Data())
+	if err != nil {
 		return nil, errors.NewInternalError(fmt.Errorf("Error converting link stats data: %w", err))
 	}
 
 	// Update total clicks from link
 	stats.TotalClicks = link.ClickCount
 
-	return &stats, nil
+	return stats, nil
+}
+
+// CompactLinkStats folds a link's daily clicks into yearly totals in a
+// transaction, so clicks recorded while the job runs are not lost. The
+// archive function may run more than once if the transaction is retried.
+func (r *LinkRepository) CompactLinkStats(ctx context.Context, short string, at time.Time, archive StatsArchiveFunc) (_ *models.LinkStats, err error) {
+	defer observeOperation("compact_link_stats", time.Now(), &err)
+	ref := r.client.Collection("link_stats").Doc(ShortDocID(short))
+	var stats *models.LinkStats
+	err = r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return errors.NewNotFound(fmt.Sprintf("Stats of link '%s' not found", short))
+			}
+			return err
+		}
+		stats, _, err = models.DecodeLinkStats(doc.Data())
+		if err != nil {
+			return err
+		}
+		compacted, err := compactStats(ctx, stats, at, archive)
+		if err != nil || !compacted {
+			return err
+		}
+		return tx.Set(ref, stats)
+	})
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			return nil, err
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error compacting link stats: %w", err))
+	}
+	return stats, nil
+}
+
+// UpdateLinkStats applies update to a link's statistics in a transaction, so
+// concurrent updates are not lost. Statistics are created on the first
+// update; update may run more than once if the transaction is retried.
+func (r *LinkRepository) UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) (err error) {
+	defer observeOperation("update_link_stats", time.Now(), &err)
+	ref := r.client.Collection("link_stats").Doc(ShortDocID(short))
+	err = r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// Statistics of purged links would never be cleaned up
+		link, err := r.txLinkRef(tx, short)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Get(link); err != nil {
+			if status.Code(err) == codes.NotFound {
+				return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+			}
+			return err
+		}
+		stats, err := txLinkStats(tx, ref, short)
+		if err != nil {
+			return err
+		}
+		update(stats)
+		return tx.Set(ref, stats)
+	})
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			return err
+		}
+		return errors.NewInternalError(fmt.Errorf("Error updating link stats: %w", err))
+	}
+	return nil
+}
+
+// MergeLinkStats moves the statistics and click count of the duplicate link
+// into those of the canonical link in a transaction, so clicks recorded on
+// either while the merge runs are not lost. The duplicate's statistics are
+// deleted and its click count reset, so merging it again adds nothing; the
+// duplicate itself is left to the caller.
+func (r *LinkRepository) MergeLinkStats(ctx context.Context, canonical, duplicate string) (err error) {
+	defer observeOperation("merge_link_stats", time.Now(), &err)
+	stats := r.client.Collection("link_stats")
+	err = r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		duplicateRef, err := r.txLinkRef(tx, duplicate)
+		if err != nil {
+			return err
+		}
+		canonicalRef, err := r.txLinkRef(tx, canonical)
+		if err != nil {
+			return err
+		}
+		linkDoc, err := tx.Get(duplicateRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", duplicate))
+			}
+			return err
+		}
+		from, err := txLinkStats(tx, stats.Doc(ShortDocID(duplicate)), duplicate)
+		if err != nil {
+			return err
+		}
+		into, err := txLinkStats(tx, stats.Doc(ShortDocID(canonical)), canonical)
+		if err != nil {
+			return err
+		}
+		link, err := decodeLink(linkDoc)
+		if err != nil {
+			return err
+		}
+
+		into.Absorb(from)
+		if err := tx.Set(stats.Doc(ShortDocID(canonical)), into); err != nil {
+			return err
+		}
+		if err := tx.Delete(stats.Doc(ShortDocID(duplicate))); err != nil {
+			return err
+		}
+		// The duplicate's clicks now count once, towards the canonical link
+		if err := tx.Update(duplicateRef, []firestore.Update{
+			{Path: "click_count", Value: 0},
+		}); err != nil {
+			return err
+		}
+		return tx.Update(canonicalRef, []firestore.Update{
+			{Path: "click_count", Value: firestore.Increment(link.ClickCount)},
+			{Path: "updated_at", Value: time.Now()},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, errors.ErrNotFound) {
+			return err
+		}
+		return errors.NewInternalError(fmt.Errorf("Error merging link stats: %w", err))
+	}
+	return nil
+}
+
+// txLinkStats reads a link's statistics within a transaction; a link that was
+// never clicked has empty ones
+func txLinkStats(tx *firestore.Transaction, ref *firestore.DocumentRef, short string) (*models.LinkStats, error) {
+	doc, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return models.NewLinkStats(short), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stats, _, err := models.DecodeLinkStats(doc.Data())
+	return stats, err
+}
+
+// collectLinks decodes every link document from iter. Links in the trash are
+// skipped unless deleted is true, in which case only trashed links are returned.
+func collectLinks(iter *firestore.DocumentIterator, deleted bool, errMsg string) ([]*models.Link, error) {
+	return collectLinksUpTo(iter, deleted, 0, errMsg)
+}
+
+// collectLinksUpTo is collectLinks stopping after limit links, or reading
+// every document when limit is zero
+func collectLinksUpTo(iter *firestore.DocumentIterator, deleted bool, limit int, errMsg string) ([]*models.Link, error) {
+	return collectMatchingLinks(iter, func(link *models.Link) bool { return link.IsDeleted() == deleted }, limit, errMsg)
+}
+
+// collectMatchingLinks decodes the link documents from iter that match,
+// stopping after limit links, or reading every document when limit is zero
+func collectMatchingLinks(iter *firestore.DocumentIterator, match func(*models.Link) bool, limit int, errMsg string) ([]*models.Link, error) {
+	defer iter.Stop()
+	var links []*models.Link
+
+	for limit == 0 || len(links) < limit {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("%s: %w", errMsg, err))
+		}
+
+		link, err := decodeLink(doc)
+		if err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		if !match(link) {
+			continue
+		}
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// decodeLink decodes a link document, upgrading documents stored with an older schema
+func decodeLink(doc *firestore.DocumentSnapshot) (*models.Link, error) {
+	link, version, err := models.DecodeLink(doc.Data())
+	if err != nil {
+		return nil, err
+	}
+	if version > models.LinkSchemaVersion {
+		repoLog.Warn("Link document has a newer schema version than this server", logger.Fields{
+			"short":          doc.Ref.ID,
+			"schema_version": version,
+		})
+	}
+	return link, nil
 }
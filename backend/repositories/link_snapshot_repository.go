@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LinkSnapshotRepository stores link snapshots in Firestore
+type LinkSnapshotRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure LinkSnapshotRepository implements LinkSnapshotStore
+var _ interfaces.LinkSnapshotStore = (*LinkSnapshotRepository)(nil)
+
+// NewLinkSnapshotRepository creates a new LinkSnapshotRepository
+func NewLinkSnapshotRepository(client *firestore.Client) *LinkSnapshotRepository {
+	return &LinkSnapshotRepository{
+		client:     client,
+		collection: "link_snapshots",
+	}
+}
+
+// Create stores a snapshot under the next ID for its link. Snapshot documents
+// are keyed by short code and ID, so two concurrent snapshots cannot both
+// claim the same ID; the loser gets an AlreadyExists error.
+func (r *LinkSnapshotRepository) Create(ctx context.Context, snapshot *models.LinkSnapshot) error {
+	snapshots, err := r.ListByShort(ctx, snapshot.Short)
+	if err != nil {
+		return err
+	}
+	snapshot.ID = 1
+	if len(snapshots) > 0 {
+		snapshot.ID = snapshots[0].ID + 1
+	}
+
+	_, err = r.client.Collection(r.collection).Doc(snapshotDocID(snapshot.Short, snapshot.ID)).Create(ctx, snapshot)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return errors.NewAlreadyExists(fmt.Sprintf("Snapshot %d of link '%s' already exists", snapshot.ID, snapshot.Short))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error creating link snapshot: %w", err))
+	}
+	return nil
+}
+
+// ListByShort returns a link's snapshots, newest first
+func (r *LinkSnapshotRepository) ListByShort(ctx context.Context, short string) ([]*models.LinkSnapshot, error) {
+	iter := r.client.Collection(r.collection).Where("short", "==", short).Documents(ctx)
+	var snapshots []*models.LinkSnapshot
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link snapshots: %w", err))
+		}
+
+		var snapshot models.LinkSnapshot
+		if err := doc.DataTo(&snapshot); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+// Get retrieves one snapshot of a link
+func (r *LinkSnapshotRepository) Get(ctx context.Context, short string, id int) (*models.LinkSnapshot, error) {
+	doc, err := r.client.Collection(r.collection).Doc(snapshotDocID(short, id)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, errors.NewNotFound(fmt.Sprintf("Snapshot %d of link '%s' not found", id, short))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link snapshot: %w", err))
+	}
+
+	var snapshot models.LinkSnapshot
+	if err := doc.DataTo(&snapshot); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error converting link snapshot data: %w", err))
+	}
+	return &snapshot, nil
+}
+
+// Delete removes one snapshot of a link
+func (r *LinkSnapshotRepository) Delete(ctx context.Context, short string, id int) error {
+	if _, err := r.client.Collection(r.collection).Doc(snapshotDocID(short, id)).Delete(ctx); err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error deleting link snapshot: %w", err))
+	}
+	return nil
+}
+
+// DeleteByShort removes every snapshot of a link
+func (r *LinkSnapshotRepository) DeleteByShort(ctx context.Context, short string) error {
+	snapshots, err := r.ListByShort(ctx, short)
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if err := r.Delete(ctx, short, s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveShort files the snapshots of a renamed link under its new short code
+func (r *LinkSnapshotRepository) MoveShort(ctx context.Context, short, newShort string) error {
+	snapshots, err := r.ListByShort(ctx, short)
+	if err != nil {
+		return err
+	}
+	moves := make([]documentMove, len(snapshots))
+	for i, s := range snapshots {
+		moves[i].from = r.client.Collection(r.collection).Doc(snapshotDocID(short, s.ID))
+		s.Short = newShort
+		moves[i].to = r.client.Collection(r.collection).Doc(snapshotDocID(newShort, s.ID))
+		moves[i].data = s
+	}
+	return moveDocuments(ctx, r.client, moves, "link snapshots")
+}
+
+// snapshotDocID returns the document ID of a link snapshot
+func snapshotDocID(short string, id int) string {
+	return fmt.Sprintf("%s@%d", ShortDocID(short), id)
+}
+
+// sortSnapshots orders snapshots newest first
+func sortSnapshots(snapshots []*models.LinkSnapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ID > snapshots[j].ID
+	})
+}
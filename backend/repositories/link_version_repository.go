@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LinkVersionRepository stores link edit history in Firestore
+type LinkVersionRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure LinkVersionRepository implements LinkVersionStore
+var _ interfaces.LinkVersionStore = (*LinkVersionRepository)(nil)
+
+// NewLinkVersionRepository creates a new LinkVersionRepository
+func NewLinkVersionRepository(client *firestore.Client) *LinkVersionRepository {
+	return &LinkVersionRepository{
+		client:     client,
+		collection: "link_versions",
+	}
+}
+
+// Create stores a version under the next version number for its link. Version
+// documents are keyed by short code and number, so two concurrent edits cannot
+// both claim the same number; the loser gets an AlreadyExists error.
+func (r *LinkVersionRepository) Create(ctx context.Context, version *models.LinkVersion) error {
+	versions, err := r.ListByShort(ctx, version.Short)
+	if err != nil {
+		return err
+	}
+	version.Version = 1
+	if len(versions) > 0 {
+		version.Version = versions[0].Version + 1
+	}
+
+	_, err = r.client.Collection(r.collection).Doc(versionDocID(version.Short, version.Version)).Create(ctx, version)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return errors.NewAlreadyExists(fmt.Sprintf("Version %d of link '%s' already exists", version.Version, version.Short))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error creating link version: %w", err))
+	}
+	return nil
+}
+
+// ListByShort returns a link's versions, newest first
+func (r *LinkVersionRepository) ListByShort(ctx context.Context, short string) ([]*models.LinkVersion, error) {
+	iter := r.client.Collection(r.collection).Where("short", "==", short).Documents(ctx)
+	var versions []*models.LinkVersion
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link versions: %w", err))
+		}
+
+		var version models.LinkVersion
+		if err := doc.DataTo(&version); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		versions = append(versions, &version)
+	}
+
+	sortVersions(versions)
+	return versions, nil
+}
+
+// Get retrieves one version of a link
+func (r *LinkVersionRepository) Get(ctx context.Context, short string, version int) (*models.LinkVersion, error) {
+	doc, err := r.client.Collection(r.collection).Doc(versionDocID(short, version)).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, errors.NewNotFound(fmt.Sprintf("Version %d of link '%s' not found", version, short))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link version: %w", err))
+	}
+
+	var v models.LinkVersion
+	if err := doc.DataTo(&v); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error converting link version data: %w", err))
+	}
+	return &v, nil
+}
+
+// DeleteByShort removes the whole history of a link
+func (r *LinkVersionRepository) DeleteByShort(ctx context.Context, short string) error {
+	versions, err := r.ListByShort(ctx, short)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if _, err := r.client.Collection(r.collection).Doc(versionDocID(short, v.Version)).Delete(ctx); err != nil {
+			return errors.NewInternalError(fmt.Errorf("Error deleting link version: %w", err))
+		}
+	}
+	return nil
+}
+
+// MoveShort files the history of a renamed link under its new short code
+func (r *LinkVersionRepository) MoveShort(ctx context.Context, short, newShort string) error {
+	versions, err := r.ListByShort(ctx, short)
+	if err != nil {
+		return err
+	}
+	moves := make([]documentMove, len(versions))
+	for i, v := range versions {
+		moves[i].from = r.client.Collection(r.collection).Doc(versionDocID(short, v.Version))
+		v.Short = newShort
+		moves[i].to = r.client.Collection(r.collection).Doc(versionDocID(newShort, v.Version))
+		moves[i].data = v
+	}
+	return moveDocuments(ctx, r.client, moves, "link versions")
+}
+
+// versionDocID returns the document ID of a link version
+func versionDocID(short string, version int) string {
+	return fmt.Sprintf("%s@%d", ShortDocID(short), version)
+}
+
+// sortVersions orders versions newest first
+func sortVersions(versions []*models.LinkVersion) {
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+}
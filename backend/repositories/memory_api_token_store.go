@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemoryAPITokenStore keeps API tokens and their usage in process memory.
+// Tokens are lost on restart and are not shared between replicas, so it is
+// meant for single-instance deployments and tests.
+type MemoryAPITokenStore struct {
+	tokens map[string]*models.APIToken
+	// usage counts requests by token ID and month
+	usage map[string]map[string]int
+	mutex sync.RWMutex
+}
+
+// Ensure MemoryAPITokenStore implements APITokenStore
+var _ interfaces.APITokenStore = (*MemoryAPITokenStore)(nil)
+
+// NewMemoryAPITokenStore creates a new MemoryAPITokenStore
+func NewMemoryAPITokenStore() *MemoryAPITokenStore {
+	return &MemoryAPITokenStore{
+		tokens: make(map[string]*models.APIToken),
+		usage:  make(map[string]map[string]int),
+	}
+}
+
+// copyToken returns a copy of token that shares no slices with it
+func copyToken(token *models.APIToken) *models.APIToken {
+	tokenCopy := *token
+	tokenCopy.Scopes = slices.Clone(token.Scopes)
+	return &tokenCopy
+}
+
+// Create stores a new API token
+func (s *MemoryAPITokenStore) Create(ctx context.Context, token *models.APIToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens[token.ID] = copyToken(token)
+	return nil
+}
+
+// Get retrieves an API token by its ID
+func (s *MemoryAPITokenStore) Get(ctx context.Context, id string) (*models.APIToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	token, exists := s.tokens[id]
+	if !exists {
+		return nil, errors.NewNotFound(fmt.Sprintf("API token '%s' not found", id))
+	}
+	return copyToken(token), nil
+}
+
+// ListByUser retrieves all API tokens belonging to a user
+func (s *MemoryAPITokenStore) ListByUser(ctx context.Context, userID string) ([]*models.APIToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var tokens []*models.APIToken
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, copyToken(token))
+		}
+	}
+	return tokens, nil
+}
+
+// Revoke marks an API token as revoked
+func (s *MemoryAPITokenStore) Revoke(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, exists := s.tokens[id]
+	if !exists {
+		return errors.NewNotFound(fmt.Sprintf("API token '%s' not found", id))
+	}
+	token.RevokedAt = time.Now()
+	return nil
+}
+
+// AddUsage counts one request of the token in month and returns the requests
+// of the month so far
+func (s *MemoryAPITokenStore) AddUsage(ctx context.Context, id, month string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, exists := s.tokens[id]
+	if !exists {
+		return 0, errors.NewNotFound(fmt.Sprintf("API token '%s' not found", id))
+	}
+	token.LastUsedAt = time.Now()
+	if s.usage[id] == nil {
+		s.usage[id] = make(map[string]int)
+	}
+	s.usage[id][month]++
+	return s.usage[id][month], nil
+}
+
+// Usage returns the requests of the token in month
+func (s *MemoryAPITokenStore) Usage(ctx context.Context, id, month string) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if _, exists := s.tokens[id]; !exists {
+		return 0, errors.NewNotFound(fmt.Sprintf("API token '%s' not found", id))
+	}
+	return s.usage[id][month], nil
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// MemoryClickEventStore keeps the click stream of each link in process
+// memory. It is lost on restart, so it is meant for local development and
+// tests.
+type MemoryClickEventStore struct {
+	// events maps a short code to its click events in the order they arrived
+	events map[string][]models.ClickEvent
+	mutex  sync.RWMutex
+}
+
+// Ensure MemoryClickEventStore implements ClickEventStore
+var _ interfaces.ClickEventStore = (*MemoryClickEventStore)(nil)
+
+// NewMemoryClickEventStore creates a new MemoryClickEventStore
+func NewMemoryClickEventStore() *MemoryClickEventStore {
+	return &MemoryClickEventStore{
+		events: make(map[string][]models.ClickEvent),
+	}
+}
+
+// Send stores a batch of click events
+func (s *MemoryClickEventStore) Send(ctx context.Context, events []models.ClickEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, event := range events {
+		s.events[event.Short] = append(s.events[event.Short], event)
+	}
+	return nil
+}
+
+// ListByShort returns the click events of a link at or after since, oldest first
+func (s *MemoryClickEventStore) ListByShort(ctx context.Context, short string, since time.Time) ([]*models.ClickEvent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var events []*models.ClickEvent
+	for _, event := range s.events[short] {
+		if !event.Time.Before(since) {
+			events = append(events, &event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
+
+// DeleteByShort forgets the click stream of a link
+func (s *MemoryClickEventStore) DeleteByShort(ctx context.Context, short string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.events, short)
+	return nil
+}
+
+// MoveShort files the click stream of a renamed link under its new short code
+func (s *MemoryClickEventStore) MoveShort(ctx context.Context, short, newShort string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events, exists := s.events[short]
+	if !exists {
+		return nil
+	}
+	for i := range events {
+		events[i].Short = newShort
+	}
+	s.events[newShort] = append(s.events[newShort], events...)
+	delete(s.events, short)
+	return nil
+}
+
+// DeleteBefore deletes the click events of a link before before and returns
+// how many it deleted
+func (s *MemoryClickEventStore) DeleteBefore(ctx context.Context, short string, before time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var kept []models.ClickEvent
+	for _, event := range s.events[short] {
+		if !event.Time.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	deleted := len(s.events[short]) - len(kept)
+	if len(kept) == 0 {
+		delete(s.events, short)
+	} else {
+		s.events[short] = kept
+	}
+	return deleted, nil
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemoryLinkAliasStore keeps link aliases in process memory. They are lost on
+// restart, so it is meant for local development and tests.
+type MemoryLinkAliasStore struct {
+	aliases map[string]models.LinkAlias
+	mutex   sync.RWMutex
+}
+
+// Ensure MemoryLinkAliasStore implements LinkAliasStore
+var _ interfaces.LinkAliasStore = (*MemoryLinkAliasStore)(nil)
+
+// NewMemoryLinkAliasStore creates a new MemoryLinkAliasStore
+func NewMemoryLinkAliasStore() *MemoryLinkAliasStore {
+	return &MemoryLinkAliasStore{
+		aliases: make(map[string]models.LinkAlias),
+	}
+}
+
+// Create stores an alias
+func (s *MemoryLinkAliasStore) Create(ctx context.Context, alias *models.LinkAlias) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.aliases[alias.Alias]; exists {
+		return errors.NewAlreadyExists(fmt.Sprintf("Alias '%s' already exists", alias.Alias))
+	}
+	s.aliases[alias.Alias] = *alias.Clone()
+	return nil
+}
+
+// Get retrieves an alias by its code
+func (s *MemoryLinkAliasStore) Get(ctx context.Context, alias string) (*models.LinkAlias, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	a, exists := s.aliases[alias]
+	if !exists {
+		return nil, errors.NewNotFound(fmt.Sprintf("Alias '%s' not found", alias))
+	}
+	return a.Clone(), nil
+}
+
+// ListByShort returns the aliases of a link, oldest first
+func (s *MemoryLinkAliasStore) ListByShort(ctx context.Context, short string) ([]*models.LinkAlias, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	aliases := []*models.LinkAlias{}
+	for _, a := range s.aliases {
+		if a.Short == short {
+			aliases = append(aliases, a.Clone())
+		}
+	}
+	sortAliases(aliases)
+	return aliases, nil
+}
+
+// Delete removes an alias
+func (s *MemoryLinkAliasStore) Delete(ctx context.Context, alias string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.aliases[alias]; !exists {
+		return errors.NewNotFound(fmt.Sprintf("Alias '%s' not found", alias))
+	}
+	delete(s.aliases, alias)
+	return nil
+}
+
+// DeleteByShort removes every alias of a link
+func (s *MemoryLinkAliasStore) DeleteByShort(ctx context.Context, short string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for alias, a := range s.aliases {
+		if a.Short == short {
+			delete(s.aliases, alias)
+		}
+	}
+	return nil
+}
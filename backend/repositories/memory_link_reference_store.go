@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// MemoryLinkReferenceStore keeps link references in process memory. They are
+// lost on restart, so it is meant for local development and tests.
+type MemoryLinkReferenceStore struct {
+	// refs maps a document URL to its references keyed by short code
+	refs  map[string]map[string]models.LinkReference
+	mutex sync.RWMutex
+}
+
+// Ensure MemoryLinkReferenceStore implements LinkReferenceStore
+var _ interfaces.LinkReferenceStore = (*MemoryLinkReferenceStore)(nil)
+
+// NewMemoryLinkReferenceStore creates a new MemoryLinkReferenceStore
+func NewMemoryLinkReferenceStore() *MemoryLinkReferenceStore {
+	return &MemoryLinkReferenceStore{
+		refs: make(map[string]map[string]models.LinkReference),
+	}
+}
+
+// ReplaceDocument sets the references made by one document
+func (s *MemoryLinkReferenceStore) ReplaceDocument(ctx context.Context, documentURL string, refs []*models.LinkReference) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(refs) == 0 {
+		delete(s.refs, documentURL)
+		return nil
+	}
+	doc := make(map[string]models.LinkReference, len(refs))
+	for _, ref := range refs {
+		doc[ref.Short] = *ref
+	}
+	s.refs[documentURL] = doc
+	return nil
+}
+
+// ListByShort returns the references to a link, most frequent first
+func (s *MemoryLinkReferenceStore) ListByShort(ctx context.Context, short string) ([]*models.LinkReference, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	refs := []*models.LinkReference{}
+	for _, doc := range s.refs {
+		if ref, ok := doc[short]; ok {
+			refs = append(refs, &ref)
+		}
+	}
+	sortReferences(refs)
+	return refs, nil
+}
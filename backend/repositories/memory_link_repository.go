@@ -0,0 +1,415 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+)
+
+// MemoryLinkRepository is an in-process link repository. Data is lost on restart,
+// so it is meant for local development, single-binary demos and tests.
+// Links are cloned on the way in and out, so callers never alias stored state.
+type MemoryLinkRepository struct {
+	links map[string]*models.Link
+	stats map[string]*models.LinkStats
+	mutex sync.RWMutex
+}
+
+// Ensure MemoryLinkRepository implements both repository interfaces
+var (
+	_ interfaces.LinkRepositoryInterface = (*MemoryLinkRepository)(nil)
+	_ LinkRepositoryInterface            = (*MemoryLinkRepository)(nil)
+)
+
+// NewMemoryLinkRepository creates a new MemoryLinkRepository
+func NewMemoryLinkRepository() *MemoryLinkRepository {
+	return &MemoryLinkRepository{
+		links: make(map[string]*models.Link),
+		stats: make(map[string]*models.LinkStats),
+	}
+}
+
+// Create adds a new link
+func (r *MemoryLinkRepository) Create(ctx context.Context, link *models.Link) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if existing, exists := r.links[link.Short]; exists {
+		if existing.IsDeleted() {
+			return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' is in the trash; restore it or wait until it is purged", link.Short))
+		}
+		return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", link.Short))
+	}
+
+	if link.ID == "" {
+		link.ID = models.NewLinkID()
+	}
+	now := time.Now()
+	link.CreatedAt = now
+	link.UpdatedAt = now
+
+	r.links[link.Short] = link.Clone()
+	return nil
+}
+
+// GetByShort retrieves a link by its short code. Links in the trash are not found.
+func (r *MemoryLinkRepository) GetByShort(ctx context.Context, short string) (*models.Link, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	link, exists := r.links[short]
+	if !exists || link.IsDeleted() {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+
+	// Update expiry status if needed
+	if link.IsLinkExpired() && !link.IsExpired {
+		link.IsExpired = true
+		link.UpdatedAt = time.Now()
+	}
+
+	return link.Clone(), nil
+}
+
+// GetByShorts retrieves links by their short codes
+func (r *MemoryLinkRepository) GetByShorts(ctx context.Context, shorts []string) (map[string]*models.Link, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	links := make(map[string]*models.Link, len(shorts))
+	for _, short := range shorts {
+		if link, exists := r.links[short]; exists && !link.IsDeleted() {
+			links[short] = link.Clone()
+		}
+	}
+	return links, nil
+}
+
+// GetAll retrieves all links
+func (r *MemoryLinkRepository) GetAll(ctx context.Context) ([]*models.Link, error) {
+	return linkcap.Apply(ctx, r.filter(func(*models.Link) bool { return true })), nil
+}
+
+// List retrieves the links a query selects
+func (r *MemoryLinkRepository) List(ctx context.Context, query models.LinkQuery) ([]*models.Link, error) {
+	links := r.filter(query.Matches)
+	query.Sort(links)
+	return limitLinks(ctx, links, query.Limit), nil
+}
+
+// Update updates an existing link
+func (r *MemoryLinkRepository) Update(ctx context.Context, link *models.Link) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	existing, exists := r.links[link.Short]
+	if !exists || existing.IsDeleted() {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+	}
+
+	link.ID = existing.ID
+	link.UpdatedAt = time.Now()
+	r.links[link.Short] = link.Clone()
+	return nil
+}
+
+// Delete moves a link to the trash by its short code
+func (r *MemoryLinkRepository) Delete(ctx context.Context, short string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	link, exists := r.links[short]
+	if !exists || link.IsDeleted() {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	now := time.Now()
+	link.DeletedAt = now
+	link.UpdatedAt = now
+	return nil
+}
+
+// GetDeleted retrieves all links in the trash
+func (r *MemoryLinkRepository) GetDeleted(ctx context.Context) ([]*models.Link, error) {
+	return r.collect(func(l *models.Link) bool { return l.IsDeleted() }), nil
+}
+
+// GetDeletedByShort retrieves a link in the trash by its short code
+func (r *MemoryLinkRepository) GetDeletedByShort(ctx context.Context, short string) (*models.Link, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	link, exists := r.links[short]
+	if !exists || !link.IsDeleted() {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+	}
+	return link.Clone(), nil
+}
+
+// Restore moves a link out of the trash
+func (r *MemoryLinkRepository) Restore(ctx context.Context, short string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	link, exists := r.links[short]
+	if !exists || !link.IsDeleted() {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+	}
+	link.DeletedAt = time.Time{}
+	link.UpdatedAt = time.Now()
+	return nil
+}
+
+// Purge permanently removes a link and its statistics
+func (r *MemoryLinkRepository) Purge(ctx context.Context, short string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.links[short]; !exists {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	delete(r.links, short)
+	delete(r.stats, short)
+	return nil
+}
+
+// Rename changes a link's short code, moving its statistics along
+func (r *MemoryLinkRepository) Rename(ctx context.Context, short, newShort string) (*models.Link, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	link, exists := r.links[short]
+	if !exists || link.IsDeleted() {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	if _, taken := r.links[newShort]; taken {
+		return nil, errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", newShort))
+	}
+
+	link.Short = newShort
+	link.UpdatedAt = time.Now()
+	delete(r.links, short)
+	r.links[newShort] = link
+	if stats, exists := r.stats[short]; exists {
+		stats.Short = newShort
+		delete(r.stats, short)
+		r.stats[newShort] = stats
+	}
+	return link.Clone(), nil
+}
+
+// IncrementClickCount increments the click count for a link
+func (r *MemoryLinkRepository) IncrementClickCount(ctx context.Context, short string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	link, exists := r.links[short]
+	if !exists || link.IsDeleted() {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	if link.ClickLimitReached() {
+		return errors.NewGone(fmt.Sprintf("Link '%s' has reached its click limit", short))
+	}
+	now := time.Now()
+	link.ClickCount++
+	link.UpdatedAt = now
+	link.LastClickedAt = now
+	return nil
+}
+
+// RecordRolloutClick counts a click on one variant of the link's rollout
+func (r *MemoryLinkRepository) RecordRolloutClick(ctx context.Context, short, variant string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	link, exists := r.links[short]
+	if !exists || link.IsDeleted() {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	if link.Rollout == nil {
+		return nil
+	}
+	if variant == models.RolloutVariants.Canary {
+		link.Rollout.CanaryClicks++
+	} else {
+		link.Rollout.PrimaryClicks++
+	}
+	return nil
+}
+
+// UpdatePopularity stores the link's popularity score fields
+func (r *MemoryLinkRepository) UpdatePopularity(ctx context.Context, link *models.Link) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored, exists := r.links[link.Short]
+	if !exists {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+	}
+	stored.PopularityScore = link.PopularityScore
+	stored.ScoredAt = link.ScoredAt
+	stored.ScoredClicks = link.ScoredClicks
+	return nil
+}
+
+// GetByAccessLevel retrieves links by access level
+func (r *MemoryLinkRepository) GetByAccessLevel(ctx context.Context, accessLevel string) ([]*models.Link, error) {
+	return r.filter(func(l *models.Link) bool { return l.AccessLevel == accessLevel }), nil
+}
+
+// GetByUser retrieves links created by a specific user
+func (r *MemoryLinkRepository) GetByUser(ctx context.Context, userID string) ([]*models.Link, error) {
+	return r.filter(func(l *models.Link) bool { return l.CreatedBy == userID }), nil
+}
+
+// Ping always succeeds, the links being in memory
+func (r *MemoryLinkRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// CountAll counts the links outside the trash
+func (r *MemoryLinkRepository) CountAll(ctx context.Context) (int, error) {
+	return r.count(func(*models.Link) bool { return true }), nil
+}
+
+// CountByUser counts the links outside the trash created by a user
+func (r *MemoryLinkRepository) CountByUser(ctx context.Context, userID string) (int, error) {
+	return r.count(func(l *models.Link) bool { return l.CreatedBy == userID }), nil
+}
+
+// CountByAccessLevel counts the links outside the trash with an access level
+func (r *MemoryLinkRepository) CountByAccessLevel(ctx context.Context, accessLevel string) (int, error) {
+	return r.count(func(l *models.Link) bool { return l.AccessLevel == accessLevel }), nil
+}
+
+// GetByTag retrieves links carrying a tag
+func (r *MemoryLinkRepository) GetByTag(ctx context.Context, tag string) ([]*models.Link, error) {
+	return r.filter(func(l *models.Link) bool { return l.HasTag(tag) }), nil
+}
+
+// GetByURL retrieves links pointing at exactly the given destination
+func (r *MemoryLinkRepository) GetByURL(ctx context.Context, url string) ([]*models.Link, error) {
+	return r.filter(func(l *models.Link) bool { return l.URL == url }), nil
+}
+
+// GetByNamespace retrieves links whose short codes lie below a namespace
+func (r *MemoryLinkRepository) GetByNamespace(ctx context.Context, namespace string) ([]*models.Link, error) {
+	return r.filter(func(l *models.Link) bool { return l.InNamespace(namespace) }), nil
+}
+
+// CheckAccess determines if a user has access to a link
+func (r *MemoryLinkRepository) CheckAccess(ctx context.Context, short string, userID string) (bool, error) {
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return false, err
+	}
+	return link.CanAccessAs(userID, groups.FromContext(ctx)), nil
+}
+
+// GetExpiredLinks retrieves links that are past their expiry but not yet flagged
+func (r *MemoryLinkRepository) GetExpiredLinks(ctx context.Context) ([]*models.Link, error) {
+	now := time.Now()
+	return r.filter(func(l *models.Link) bool {
+		return !l.ExpiresAt.IsZero() && l.ExpiresAt.Before(now) && !l.IsExpired
+	}), nil
+}
+
+// GetLinksByExpiryStatus retrieves links by their expiry status
+func (r *MemoryLinkRepository) GetLinksByExpiryStatus(ctx context.Context, isExpired bool) ([]*models.Link, error) {
+	return r.filter(func(l *models.Link) bool { return l.IsExpired == isExpired }), nil
+}
+
+// GetLinkStats retrieves statistics for a link
+func (r *MemoryLinkRepository) GetLinkStats(ctx context.Context, short string) (*models.LinkStats, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	link, exists := r.links[short]
+	if !exists || link.IsDeleted() {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+
+	stats, exists := r.stats[short]
+	if !exists {
+		stats = models.NewLinkStats(short)
+		r.stats[short] = stats
+	}
+
+	statsCopy := stats.Clone()
+	statsCopy.TotalClicks = link.ClickCount
+	return statsCopy, nil
+}
+
+// UpdateLinkStats applies update to a link's statistics, creating them on
+// the first update
+func (r *MemoryLinkRepository) UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.links[short]; !exists {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	stats, exists := r.stats[short]
+	if !exists {
+		stats = models.NewLinkStats(short)
+		r.stats[short] = stats
+	}
+	update(stats)
+	return nil
+}
+
+// CompactLinkStats folds a link's daily clicks into yearly totals
+func (r *MemoryLinkRepository) CompactLinkStats(ctx context.Context, short string, at time.Time, archive StatsArchiveFunc) (*models.LinkStats, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stats, exists := r.stats[short]
+	if !exists {
+		return nil, errors.NewNotFound(fmt.Sprintf("Stats of link '%s' not found", short))
+	}
+	compacted := stats.Clone()
+	if ok, err := compactStats(ctx, compacted, at, archive); err != nil || !ok {
+		return stats.Clone(), err
+	}
+	r.stats[short] = compacted
+	return compacted.Clone(), nil
+}
+
+// filter returns copies of all links outside the trash matching the predicate
+func (r *MemoryLinkRepository) filter(match func(*models.Link) bool) []*models.Link {
+	return r.collect(func(l *models.Link) bool { return !l.IsDeleted() && match(l) })
+}
+
+// count counts the links outside the trash matching the predicate
+func (r *MemoryLinkRepository) count(match func(*models.Link) bool) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	count := 0
+	for _, link := range r.links {
+		if !link.IsDeleted() && match(link) {
+			count++
+		}
+	}
+	return count
+}
+
+// collect returns copies of all links, trashed or not, matching the predicate
+func (r *MemoryLinkRepository) collect(match func(*models.Link) bool) []*models.Link {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var links []*models.Link
+	for _, link := range r.links {
+		if match(link) {
+			links = append(links, link.Clone())
+		}
+	}
+	return links
+}
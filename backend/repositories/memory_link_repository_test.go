@@ -0,0 +1,89 @@
+package repositories_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepositoryStatsCopies(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryLinkRepository()
+	require.NoError(t, repo.Create(ctx, createTestLink("team", "https://example.com", "user1")))
+
+	stats, err := repo.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	stats.Browsers["Firefox"] = 99
+
+	stats, err = repo.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	assert.Empty(t, stats.Browsers)
+}
+
+func TestMemoryRepositoryUpdateLinkStats(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryLinkRepository()
+	require.NoError(t, repo.Create(ctx, createTestLink("team", "https://example.com", "user1")))
+
+	record := func(stats *models.LinkStats) { stats.RecordClick("Firefox", "Linux", "JP", "github.com", "desktop") }
+	require.NoError(t, repo.UpdateLinkStats(ctx, "team", record))
+	require.NoError(t, repo.UpdateLinkStats(ctx, "team", record))
+
+	stats, err := repo.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"Firefox": 2}, stats.Browsers)
+	assert.Equal(t, map[string]int{"github.com": 2}, stats.ReferringSites)
+
+	err = repo.UpdateLinkStats(ctx, "missing", record)
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+}
+
+func TestMemoryRepositoryCompactLinkStats(t *testing.T) {
+	ctx := context.Background()
+	repo := repositories.NewMemoryLinkRepository()
+	require.NoError(t, repo.Create(ctx, createTestLink("team", "https://example.com", "user1")))
+
+	_, err := repo.CompactLinkStats(ctx, "team", time.Now(), nil)
+	assert.True(t, errors.Is(err, errors.ErrNotFound), "links without stats have nothing to compact")
+
+	_, err = repo.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+
+	failing := func(ctx context.Context, stats *models.LinkStats) (string, error) {
+		return "", fmt.Errorf("bucket not found")
+	}
+	_, err = repo.CompactLinkStats(ctx, "team", time.Now(), failing)
+	require.Error(t, err)
+	stats, err := repo.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	assert.True(t, stats.CompactedAt.IsZero(), "stats are only compacted once archived")
+
+	archived := 0
+	archive := func(ctx context.Context, stats *models.LinkStats) (string, error) {
+		archived++
+		return "gs://archive/team.json", nil
+	}
+	at := time.Now()
+	stats, err = repo.CompactLinkStats(ctx, "team", at, archive)
+	require.NoError(t, err)
+	assert.Equal(t, models.LinkStatsStatusCompacted, stats.Status)
+	assert.Equal(t, "gs://archive/team.json", stats.ArchiveURI)
+
+	// Compacted stats without new daily clicks are left alone
+	stats, err = repo.CompactLinkStats(ctx, "team", at.Add(time.Hour), archive)
+	require.NoError(t, err)
+	assert.True(t, stats.CompactedAt.Equal(at))
+	assert.Equal(t, 1, archived)
+}
+
+func TestShortDocID(t *testing.T) {
+	assert.Equal(t, "docs", repositories.ShortDocID("docs"))
+	assert.Equal(t, "team~infra~oncall", repositories.ShortDocID("team/infra/oncall"))
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemoryLinkSnapshotStore keeps link snapshots in process memory. Snapshots
+// are lost on restart, so it is meant for local development and tests.
+type MemoryLinkSnapshotStore struct {
+	snapshots map[string][]*models.LinkSnapshot
+	mutex     sync.RWMutex
+}
+
+// Ensure MemoryLinkSnapshotStore implements LinkSnapshotStore
+var _ interfaces.LinkSnapshotStore = (*MemoryLinkSnapshotStore)(nil)
+
+// NewMemoryLinkSnapshotStore creates a new MemoryLinkSnapshotStore
+func NewMemoryLinkSnapshotStore() *MemoryLinkSnapshotStore {
+	return &MemoryLinkSnapshotStore{
+		snapshots: make(map[string][]*models.LinkSnapshot),
+	}
+}
+
+// Create stores a snapshot under the next ID for its link
+func (s *MemoryLinkSnapshotStore) Create(ctx context.Context, snapshot *models.LinkSnapshot) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshots := s.snapshots[snapshot.Short]
+	snapshot.ID = 1
+	if len(snapshots) > 0 {
+		snapshot.ID = snapshots[len(snapshots)-1].ID + 1
+	}
+	s.snapshots[snapshot.Short] = append(snapshots, cloneSnapshot(snapshot))
+	return nil
+}
+
+// ListByShort returns a link's snapshots, newest first
+func (s *MemoryLinkSnapshotStore) ListByShort(ctx context.Context, short string) ([]*models.LinkSnapshot, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	snapshots := make([]*models.LinkSnapshot, 0, len(s.snapshots[short]))
+	for _, snapshot := range s.snapshots[short] {
+		snapshots = append(snapshots, cloneSnapshot(snapshot))
+	}
+	sortSnapshots(snapshots)
+	return snapshots, nil
+}
+
+// Get retrieves one snapshot of a link
+func (s *MemoryLinkSnapshotStore) Get(ctx context.Context, short string, id int) (*models.LinkSnapshot, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, snapshot := range s.snapshots[short] {
+		if snapshot.ID == id {
+			return cloneSnapshot(snapshot), nil
+		}
+	}
+	return nil, errors.NewNotFound(fmt.Sprintf("Snapshot %d of link '%s' not found", id, short))
+}
+
+// Delete removes one snapshot of a link
+func (s *MemoryLinkSnapshotStore) Delete(ctx context.Context, short string, id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshots := s.snapshots[short]
+	for i, snapshot := range snapshots {
+		if snapshot.ID == id {
+			s.snapshots[short] = append(snapshots[:i:i], snapshots[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// DeleteByShort removes every snapshot of a link
+func (s *MemoryLinkSnapshotStore) DeleteByShort(ctx context.Context, short string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.snapshots, short)
+	return nil
+}
+
+// MoveShort files the snapshots of a renamed link under its new short code
+func (s *MemoryLinkSnapshotStore) MoveShort(ctx context.Context, short, newShort string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshots, exists := s.snapshots[short]
+	if !exists {
+		return nil
+	}
+	for _, snapshot := range snapshots {
+		snapshot.Short = newShort
+	}
+	s.snapshots[newShort] = snapshots
+	delete(s.snapshots, short)
+	return nil
+}
+
+// cloneSnapshot returns a copy of a snapshot that shares no mutable state with it
+func cloneSnapshot(snapshot *models.LinkSnapshot) *models.LinkSnapshot {
+	clone := *snapshot
+	clone.Link = snapshot.Link.Clone()
+	return &clone
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemoryLinkVersionStore keeps link edit history in process memory. History is
+// lost on restart, so it is meant for local development and tests.
+type MemoryLinkVersionStore struct {
+	versions map[string][]*models.LinkVersion
+	mutex    sync.RWMutex
+}
+
+// Ensure MemoryLinkVersionStore implements LinkVersionStore
+var _ interfaces.LinkVersionStore = (*MemoryLinkVersionStore)(nil)
+
+// NewMemoryLinkVersionStore creates a new MemoryLinkVersionStore
+func NewMemoryLinkVersionStore() *MemoryLinkVersionStore {
+	return &MemoryLinkVersionStore{
+		versions: make(map[string][]*models.LinkVersion),
+	}
+}
+
+// Create stores a version under the next version number for its link
+func (s *MemoryLinkVersionStore) Create(ctx context.Context, version *models.LinkVersion) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	version.Version = len(s.versions[version.Short]) + 1
+	s.versions[version.Short] = append(s.versions[version.Short], cloneVersion(version))
+	return nil
+}
+
+// ListByShort returns a link's versions, newest first
+func (s *MemoryLinkVersionStore) ListByShort(ctx context.Context, short string) ([]*models.LinkVersion, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	versions := make([]*models.LinkVersion, 0, len(s.versions[short]))
+	for _, v := range s.versions[short] {
+		versions = append(versions, cloneVersion(v))
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// Get retrieves one version of a link
+func (s *MemoryLinkVersionStore) Get(ctx context.Context, short string, version int) (*models.LinkVersion, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	versions := s.versions[short]
+	if version < 1 || version > len(versions) {
+		return nil, errors.NewNotFound(fmt.Sprintf("Version %d of link '%s' not found", version, short))
+	}
+	return cloneVersion(versions[version-1]), nil
+}
+
+// DeleteByShort removes the whole history of a link
+func (s *MemoryLinkVersionStore) DeleteByShort(ctx context.Context, short string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.versions, short)
+	return nil
+}
+
+// MoveShort files the history of a renamed link under its new short code
+func (s *MemoryLinkVersionStore) MoveShort(ctx context.Context, short, newShort string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	versions, exists := s.versions[short]
+	if !exists {
+		return nil
+	}
+	for _, v := range versions {
+		v.Short = newShort
+	}
+	s.versions[newShort] = versions
+	delete(s.versions, short)
+	return nil
+}
+
+// cloneVersion returns a copy of v that shares no mutable state with it
+func cloneVersion(v *models.LinkVersion) *models.LinkVersion {
+	clone := *v
+	clone.Previous = v.Previous.Clone()
+	clone.ChangedFields = append([]string{}, v.ChangedFields...)
+	return &clone
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemoryLocalUserStore keeps local accounts in process memory. They are lost
+// on restart, so it is meant for tests.
+type MemoryLocalUserStore struct {
+	users map[string]models.LocalUser
+	mutex sync.RWMutex
+}
+
+// Ensure MemoryLocalUserStore implements LocalUserStore
+var _ interfaces.LocalUserStore = (*MemoryLocalUserStore)(nil)
+
+// NewMemoryLocalUserStore creates a new MemoryLocalUserStore
+func NewMemoryLocalUserStore() *MemoryLocalUserStore {
+	return &MemoryLocalUserStore{
+		users: make(map[string]models.LocalUser),
+	}
+}
+
+// Get returns an account
+func (s *MemoryLocalUserStore) Get(ctx context.Context, username string) (*models.LocalUser, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, errors.NewNotFound(fmt.Sprintf("User '%s' not found", username))
+	}
+	return &user, nil
+}
+
+// Save creates or replaces an account
+func (s *MemoryLocalUserStore) Save(ctx context.Context, user *models.LocalUser) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.users[user.Username] = *user
+	return nil
+}
+
+// Delete removes an account
+func (s *MemoryLocalUserStore) Delete(ctx context.Context, username string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.users[username]; !ok {
+		return errors.NewNotFound(fmt.Sprintf("User '%s' not found", username))
+	}
+	delete(s.users, username)
+	return nil
+}
+
+// List returns every account, ordered by username
+func (s *MemoryLocalUserStore) List(ctx context.Context) ([]*models.LocalUser, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := make([]*models.LocalUser, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, &user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
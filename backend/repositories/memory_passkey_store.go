@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemoryPasskeyStore keeps passkeys and recovery codes in process memory.
+// They are lost on restart, so it is meant for tests and local development.
+type MemoryPasskeyStore struct {
+	passkeys map[string]*models.Passkey
+	// recoveryCodes holds the unused recovery code hashes by user ID
+	recoveryCodes map[string][]string
+	mutex         sync.RWMutex
+}
+
+// Ensure MemoryPasskeyStore implements PasskeyStore
+var _ interfaces.PasskeyStore = (*MemoryPasskeyStore)(nil)
+
+// NewMemoryPasskeyStore creates a new MemoryPasskeyStore
+func NewMemoryPasskeyStore() *MemoryPasskeyStore {
+	return &MemoryPasskeyStore{
+		passkeys:      make(map[string]*models.Passkey),
+		recoveryCodes: make(map[string][]string),
+	}
+}
+
+// copyPasskey returns a copy of passkey that shares no slices with it
+func copyPasskey(passkey *models.Passkey) *models.Passkey {
+	passkeyCopy := *passkey
+	passkeyCopy.PublicKey = slices.Clone(passkey.PublicKey)
+	return &passkeyCopy
+}
+
+// Create stores a new passkey
+func (s *MemoryPasskeyStore) Create(ctx context.Context, passkey *models.Passkey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.passkeys[passkey.ID]; exists {
+		return errors.NewAlreadyExists("Passkey is already registered")
+	}
+	s.passkeys[passkey.ID] = copyPasskey(passkey)
+	return nil
+}
+
+// ListByUser retrieves the passkeys of a user
+func (s *MemoryPasskeyStore) ListByUser(ctx context.Context, userID string) ([]*models.Passkey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var passkeys []*models.Passkey
+	for _, passkey := range s.passkeys {
+		if passkey.UserID == userID {
+			passkeys = append(passkeys, copyPasskey(passkey))
+		}
+	}
+	return passkeys, nil
+}
+
+// RecordUse stores the signature count and last use of a passkey
+func (s *MemoryPasskeyStore) RecordUse(ctx context.Context, passkey *models.Passkey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, exists := s.passkeys[passkey.ID]
+	if !exists {
+		return errors.NewNotFound("Passkey not found")
+	}
+	stored.SignCount = passkey.SignCount
+	stored.LastUsedAt = passkey.LastUsedAt
+	return nil
+}
+
+// Delete removes a passkey
+func (s *MemoryPasskeyStore) Delete(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.passkeys[id]; !exists {
+		return errors.NewNotFound("Passkey not found")
+	}
+	delete(s.passkeys, id)
+	return nil
+}
+
+// SetRecoveryCodes replaces the user's recovery codes
+func (s *MemoryPasskeyStore) SetRecoveryCodes(ctx context.Context, codes *models.RecoveryCodes) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.recoveryCodes[codes.UserID] = slices.Clone(codes.Hashes)
+	return nil
+}
+
+// UseRecoveryCode removes the code with hash from the user's recovery codes
+func (s *MemoryPasskeyStore) UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	hashes := s.recoveryCodes[userID]
+	index := slices.Index(hashes, hash)
+	if index < 0 {
+		return false, nil
+	}
+	s.recoveryCodes[userID] = slices.Delete(hashes, index, index+1)
+	return true, nil
+}
+
+// RemainingRecoveryCodes returns how many unused recovery codes the user has
+func (s *MemoryPasskeyStore) RemainingRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.recoveryCodes[userID]), nil
+}
@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// MemoryProductMetricsStore keeps the daily totals of product feature usage
+// in process memory. Totals are lost on restart, so it is meant for
+// single-instance deployments and tests.
+type MemoryProductMetricsStore struct {
+	days  map[string]map[string]int64
+	mutex sync.RWMutex
+}
+
+// Ensure MemoryProductMetricsStore implements ProductMetricsStore
+var _ interfaces.ProductMetricsStore = (*MemoryProductMetricsStore)(nil)
+
+// NewMemoryProductMetricsStore creates a new MemoryProductMetricsStore
+func NewMemoryProductMetricsStore() *MemoryProductMetricsStore {
+	return &MemoryProductMetricsStore{
+		days: make(map[string]map[string]int64),
+	}
+}
+
+// Add adds counts of events to the totals of a day
+func (s *MemoryProductMetricsStore) Add(ctx context.Context, day string, counts map[string]int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.days[day] == nil {
+		s.days[day] = make(map[string]int64)
+	}
+	for event, n := range counts {
+		s.days[day][event] += n
+	}
+	return nil
+}
+
+// List returns the totals of the days from through to, oldest first
+func (s *MemoryProductMetricsStore) List(ctx context.Context, from, to string) ([]*models.ProductMetricsDay, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	days := []*models.ProductMetricsDay{}
+	for day, events := range s.days {
+		if day >= from && day <= to {
+			days = append(days, &models.ProductMetricsDay{Date: day, Events: maps.Clone(events)})
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days, nil
+}
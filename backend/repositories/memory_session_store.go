@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemorySessionStore keeps sessions in process memory. Sessions are lost on
+// restart and are not shared between replicas, so it is meant for single-instance
+// deployments and tests.
+type MemorySessionStore struct {
+	sessions map[string]*models.Session
+	mutex    sync.RWMutex
+}
+
+// Ensure MemorySessionStore implements SessionStore
+var _ interfaces.SessionStore = (*MemorySessionStore)(nil)
+
+// NewMemorySessionStore creates a new MemorySessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*models.Session),
+	}
+}
+
+// Create stores a new session
+func (s *MemorySessionStore) Create(ctx context.Context, session *models.Session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sessionCopy := *session
+	s.sessions[session.ID] = &sessionCopy
+	return nil
+}
+
+// Get retrieves a session by its ID
+func (s *MemorySessionStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	session, exists := s.sessions[id]
+	if !exists {
+		return nil, errors.NewNotFound(fmt.Sprintf("Session '%s' not found", id))
+	}
+	sessionCopy := *session
+	return &sessionCopy, nil
+}
+
+// ListByUser retrieves all sessions belonging to a user
+func (s *MemorySessionStore) ListByUser(ctx context.Context, userID string) ([]*models.Session, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var sessions []*models.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessionCopy := *session
+			sessions = append(sessions, &sessionCopy)
+		}
+	}
+	return sessions, nil
+}
+
+// Revoke marks a session as revoked
+func (s *MemorySessionStore) Revoke(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists {
+		return errors.NewNotFound(fmt.Sprintf("Session '%s' not found", id))
+	}
+	session.RevokedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// MemoryUserClickStore keeps per-user click histories in process memory.
+// They are lost on restart, so it is meant for local development and tests.
+type MemoryUserClickStore struct {
+	// clicks maps a user ID to their history keyed by short code
+	clicks map[string]map[string]models.UserLinkClicks
+	mutex  sync.RWMutex
+}
+
+// Ensure MemoryUserClickStore implements UserClickStore
+var _ interfaces.UserClickStore = (*MemoryUserClickStore)(nil)
+
+// NewMemoryUserClickStore creates a new MemoryUserClickStore
+func NewMemoryUserClickStore() *MemoryUserClickStore {
+	return &MemoryUserClickStore{
+		clicks: make(map[string]map[string]models.UserLinkClicks),
+	}
+}
+
+// RecordClick counts a click by userID on the link short
+func (s *MemoryUserClickStore) RecordClick(ctx context.Context, userID, short string, at time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	history, ok := s.clicks[userID]
+	if !ok {
+		history = make(map[string]models.UserLinkClicks)
+		s.clicks[userID] = history
+	}
+	entry := history[short]
+	entry.UserID = userID
+	entry.Short = short
+	entry.Clicks++
+	entry.LastClickedAt = at
+	history[short] = entry
+	return nil
+}
+
+// ListByUser returns a user's click history, most recent first
+func (s *MemoryUserClickStore) ListByUser(ctx context.Context, userID string) ([]*models.UserLinkClicks, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	clicks := []*models.UserLinkClicks{}
+	for _, entry := range s.clicks[userID] {
+		clicks = append(clicks, &entry)
+	}
+	sortUserClicks(clicks)
+	return clicks, nil
+}
+
+// DeleteByUser forgets a user's whole click history
+func (s *MemoryUserClickStore) DeleteByUser(ctx context.Context, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.clicks, userID)
+	return nil
+}
+
+// DeleteBefore forgets every history entry last clicked before cutoff
+func (s *MemoryUserClickStore) DeleteBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	deleted := 0
+	for userID, history := range s.clicks {
+		for short, entry := range history {
+			if entry.LastClickedAt.Before(cutoff) {
+				delete(history, short)
+				deleted++
+			}
+		}
+		if len(history) == 0 {
+			delete(s.clicks, userID)
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// MemoryUserFavoriteStore keeps users' favorite links in process memory.
+// They are lost on restart, so it is meant for local development and tests.
+type MemoryUserFavoriteStore struct {
+	// favorites maps a user ID to their favorites keyed by short code
+	favorites map[string]map[string]models.UserFavorite
+	mutex     sync.RWMutex
+}
+
+// Ensure MemoryUserFavoriteStore implements UserFavoriteStore
+var _ interfaces.UserFavoriteStore = (*MemoryUserFavoriteStore)(nil)
+
+// NewMemoryUserFavoriteStore creates a new MemoryUserFavoriteStore
+func NewMemoryUserFavoriteStore() *MemoryUserFavoriteStore {
+	return &MemoryUserFavoriteStore{
+		favorites: make(map[string]map[string]models.UserFavorite),
+	}
+}
+
+// Add favorites a link, keeping the time an existing favorite was added
+func (s *MemoryUserFavoriteStore) Add(ctx context.Context, userID, short string, at time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	favorites, ok := s.favorites[userID]
+	if !ok {
+		favorites = make(map[string]models.UserFavorite)
+		s.favorites[userID] = favorites
+	}
+	if _, exists := favorites[short]; !exists {
+		favorites[short] = models.UserFavorite{AddedAt: at, UserID: userID, Short: short}
+	}
+	return nil
+}
+
+// Remove unfavorites a link
+func (s *MemoryUserFavoriteStore) Remove(ctx context.Context, userID, short string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.favorites[userID], short)
+	if len(s.favorites[userID]) == 0 {
+		delete(s.favorites, userID)
+	}
+	return nil
+}
+
+// ListByUser returns a user's favorites, most recently added first
+func (s *MemoryUserFavoriteStore) ListByUser(ctx context.Context, userID string) ([]*models.UserFavorite, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	favorites := []*models.UserFavorite{}
+	for _, favorite := range s.favorites[userID] {
+		favorites = append(favorites, &favorite)
+	}
+	sortUserFavorites(favorites)
+	return favorites, nil
+}
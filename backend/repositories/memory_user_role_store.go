@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemoryUserRoleStore keeps the roles of users in process memory. Roles are
+// lost on restart and are not shared between replicas, so it is meant for
+// single-instance deployments and tests.
+type MemoryUserRoleStore struct {
+	roles map[string]models.UserRole
+	mutex sync.RWMutex
+}
+
+// Ensure MemoryUserRoleStore implements UserRoleStore
+var _ interfaces.UserRoleStore = (*MemoryUserRoleStore)(nil)
+
+// NewMemoryUserRoleStore creates a new MemoryUserRoleStore
+func NewMemoryUserRoleStore() *MemoryUserRoleStore {
+	return &MemoryUserRoleStore{
+		roles: make(map[string]models.UserRole),
+	}
+}
+
+// Get retrieves the role of the user with email
+func (s *MemoryUserRoleStore) Get(ctx context.Context, email string) (*models.UserRole, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	role, exists := s.roles[email]
+	if !exists {
+		return nil, errors.NewNotFound(fmt.Sprintf("User '%s' not found", email))
+	}
+	return &role, nil
+}
+
+// List returns the roles of every user, by email
+func (s *MemoryUserRoleStore) List(ctx context.Context) ([]*models.UserRole, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	roles := make([]*models.UserRole, 0, len(s.roles))
+	for _, role := range s.roles {
+		roles = append(roles, &role)
+	}
+	sortUserRoles(roles)
+	return roles, nil
+}
+
+// Set creates or replaces the role of a user
+func (s *MemoryUserRoleStore) Set(ctx context.Context, role *models.UserRole) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.roles[role.Email] = *role
+	return nil
+}
+
+// Delete removes the role of the user with email
+func (s *MemoryUserRoleStore) Delete(ctx context.Context, email string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.roles[email]; !exists {
+		return errors.NewNotFound(fmt.Sprintf("User '%s' not found", email))
+	}
+	delete(s.roles, email)
+	return nil
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+)
+
+// MemoryWebhookStore keeps webhooks in process memory. Webhooks are lost on
+// restart and are not shared between replicas, so it is meant for
+// single-instance deployments and tests.
+type MemoryWebhookStore struct {
+	webhooks map[string]*models.Webhook
+	mutex    sync.RWMutex
+}
+
+// Ensure MemoryWebhookStore implements WebhookStore
+var _ interfaces.WebhookStore = (*MemoryWebhookStore)(nil)
+
+// NewMemoryWebhookStore creates a new MemoryWebhookStore
+func NewMemoryWebhookStore() *MemoryWebhookStore {
+	return &MemoryWebhookStore{
+		webhooks: make(map[string]*models.Webhook),
+	}
+}
+
+// Create stores a new webhook
+func (s *MemoryWebhookStore) Create(ctx context.Context, webhook *models.Webhook) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.webhooks[webhook.ID]; exists {
+		return errors.NewAlreadyExists(fmt.Sprintf("Webhook '%s' already exists", webhook.ID))
+	}
+	s.webhooks[webhook.ID] = webhook.Clone()
+	return nil
+}
+
+// Get retrieves a webhook by its ID
+func (s *MemoryWebhookStore) Get(ctx context.Context, id string) (*models.Webhook, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	webhook, exists := s.webhooks[id]
+	if !exists {
+		return nil, errors.NewNotFound(fmt.Sprintf("Webhook '%s' not found", id))
+	}
+	return webhook.Clone(), nil
+}
+
+// List returns every webhook, oldest first
+func (s *MemoryWebhookStore) List(ctx context.Context) ([]*models.Webhook, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	webhooks := make([]*models.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook.Clone())
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+// Update replaces a webhook
+func (s *MemoryWebhookStore) Update(ctx context.Context, webhook *models.Webhook) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.webhooks[webhook.ID]; !exists {
+		return errors.NewNotFound(fmt.Sprintf("Webhook '%s' not found", webhook.ID))
+	}
+	s.webhooks[webhook.ID] = webhook.Clone()
+	return nil
+}
+
+// Delete removes a webhook
+func (s *MemoryWebhookStore) Delete(ctx context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.webhooks[id]; !exists {
+		return errors.NewNotFound(fmt.Sprintf("Webhook '%s' not found", id))
+	}
+	delete(s.webhooks, id)
+	return nil
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// OperationDuration measures the duration of link repository operations
+	OperationDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "golink_repository_operation_duration_seconds",
+			Help:    "Duration of link repository operations in seconds, by operation",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+
+	// OperationErrorsTotal counts the link repository operations that failed
+	// in the database. Expected outcomes like a missing link are not errors.
+	OperationErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_repository_errors_total",
+			Help: "Total number of link repository operations failing in the database, by operation",
+		},
+		[]string{"operation"},
+	)
+
+	// BatchCommitFailuresTotal counts the Firestore write batches that
+	// failed to commit, whose writes are all lost
+	BatchCommitFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_firestore_batch_failures_total",
+			Help: "Total number of Firestore write batches that failed to commit, by collection",
+		},
+		[]string{"collection"},
+	)
+
+	// LinkCacheRequestsTotal counts the link lookups that may be served from
+	// a link cache, by cache and whether they were
+	LinkCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_link_cache_requests_total",
+			Help: "Total number of cacheable link lookups by cache (hot or shared) and result (hit or miss)",
+		},
+		[]string{"cache", "result"},
+	)
+
+	// WriteThroughFailuresTotal counts the link changes stored in Redis that
+	// could not be written through to durable storage
+	WriteThroughFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "golink_link_write_through_failures_total",
+			Help: "Total number of link changes stored in Redis that failed to be written through to durable storage, by operation",
+		},
+		[]string{"operation"},
+	)
+)
+
+// observeOperation records an operation started at start that returned
+// *err. It is deferred at the start of the operation.
+func observeOperation(operation string, start time.Time, err *error) {
+	OperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if *err != nil && errors.GetStatusCode(*err) >= 500 {
+		OperationErrorsTotal.WithLabelValues(operation).Inc()
+	}
+}
+
+// commitBatch commits a batch of writes to collection, counting and logging
+// a failure
+func commitBatch(ctx context.Context, batch *firestore.WriteBatch, collection string) error {
+	if _, err := batch.Commit(ctx); err != nil {
+		BatchCommitFailuresTotal.WithLabelValues(collection).Inc()
+		repoLog.Error("Failed to commit write batch", err, logger.Fields{"collection": collection})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+-- Links are keyed by their stable ID. Short codes are unique among all
+-- links, those in the trash included, which keep their code until purged.
+-- The columns hold what links are looked up, filtered and counted by; data
+-- holds the whole link as JSON, and the columns win where both have a field.
+CREATE TABLE links (
+    id               text PRIMARY KEY,
+    short            text NOT NULL UNIQUE,
+    url              text NOT NULL,
+    created_by       text NOT NULL DEFAULT '',
+    access_level     text NOT NULL DEFAULT '',
+    tags             text[] NOT NULL DEFAULT '{}',
+    click_count      bigint NOT NULL DEFAULT 0,
+    max_clicks       bigint NOT NULL DEFAULT 0,
+    last_clicked_at  timestamptz,
+    popularity_score double precision NOT NULL DEFAULT 0,
+    scored_at        timestamptz,
+    scored_clicks    bigint NOT NULL DEFAULT 0,
+    expires_at       timestamptz,
+    is_expired       boolean NOT NULL DEFAULT false,
+    created_at       timestamptz NOT NULL,
+    updated_at       timestamptz NOT NULL,
+    deleted_at       timestamptz,
+    data             jsonb NOT NULL
+);
+
+CREATE INDEX links_short_prefix ON links (short text_pattern_ops);
+CREATE INDEX links_created_by ON links (created_by);
+CREATE INDEX links_access_level ON links (access_level);
+CREATE INDEX links_url ON links (url);
+CREATE INDEX links_tags ON links USING gin (tags);
+CREATE INDEX links_expires_at ON links (expires_at) WHERE expires_at IS NOT NULL;
+
+-- Statistics follow their link when it is renamed and go when it is purged
+CREATE TABLE link_stats (
+    link_id text PRIMARY KEY REFERENCES links (id) ON DELETE CASCADE,
+    data    jsonb NOT NULL
+);
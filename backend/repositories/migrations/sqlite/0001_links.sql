@@ -0,0 +1,36 @@
+-- Links are keyed by their stable ID. Short codes are unique among all
+-- links, those in the trash included, which keep their code until purged.
+-- The columns hold what links are looked up, filtered and counted by; data
+-- holds the whole link as JSON, and the columns win where both have a field.
+-- Times are Unix nanoseconds, NULL when unset; tags are a JSON array.
+CREATE TABLE links (
+    id               TEXT PRIMARY KEY,
+    short            TEXT NOT NULL UNIQUE,
+    url              TEXT NOT NULL,
+    created_by       TEXT NOT NULL DEFAULT '',
+    access_level     TEXT NOT NULL DEFAULT '',
+    tags             TEXT NOT NULL DEFAULT '[]',
+    click_count      INTEGER NOT NULL DEFAULT 0,
+    max_clicks       INTEGER NOT NULL DEFAULT 0,
+    last_clicked_at  INTEGER,
+    popularity_score REAL NOT NULL DEFAULT 0,
+    scored_at        INTEGER,
+    scored_clicks    INTEGER NOT NULL DEFAULT 0,
+    expires_at       INTEGER,
+    is_expired       INTEGER NOT NULL DEFAULT 0,
+    created_at       INTEGER NOT NULL,
+    updated_at       INTEGER NOT NULL,
+    deleted_at       INTEGER,
+    data             TEXT NOT NULL
+);
+
+CREATE INDEX links_created_by ON links (created_by);
+CREATE INDEX links_access_level ON links (access_level);
+CREATE INDEX links_url ON links (url);
+CREATE INDEX links_expires_at ON links (expires_at) WHERE expires_at IS NOT NULL;
+
+-- Statistics follow their link when it is renamed and go when it is purged
+CREATE TABLE link_stats (
+    link_id TEXT PRIMARY KEY REFERENCES links (id) ON DELETE CASCADE,
+    data    TEXT NOT NULL
+);
@@ -4,24 +4,33 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Okabe-Junya/golink-backend/interfaces"
 	"github.com/Okabe-Junya/golink-backend/models"
+	apperrors "github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
 )
 
 // Ensure MockLinkRepository implements LinkRepositoryInterface
 var _ interfaces.LinkRepositoryInterface = (*MockLinkRepository)(nil)
 
-// MockLinkRepository is a mock implementation of the LinkRepository
+// MockLinkRepository is a mock implementation of the LinkRepository.
+// Like the real repositories it stores and returns copies, so tests catch
+// handlers that rely on mutating a returned link.
 type MockLinkRepository struct {
 	links map[string]*models.Link
+	stats map[string]*models.LinkStats
+	mutex sync.RWMutex
 }
 
 // NewMockLinkRepository creates a new mock link repository
 func NewMockLinkRepository() *MockLinkRepository {
 	return &MockLinkRepository{
 		links: make(map[string]*models.Link),
+		stats: make(map[string]*models.LinkStats),
 	}
 }
 
@@ -55,67 +64,238 @@ func (m *MockLinkRepository) Create(ctx context.Context, link *models.Link) erro
 		return errors.New("invalid access level")
 	}
 
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if _, exists := m.links[link.Short]; exists {
-		return errors.New("link already exists")
+		return apperrors.NewAlreadyExists("link already exists")
 	}
-	m.links[link.Short] = link
+	m.links[link.Short] = link.Clone()
 	return nil
 }
 
 // GetByShort retrieves a link by its short code
 func (m *MockLinkRepository) GetByShort(ctx context.Context, short string) (*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
 	link, exists := m.links[short]
-	if !exists {
-		return nil, errors.New("link not found")
+	if !exists || link.IsDeleted() {
+		return nil, apperrors.NewNotFound("link not found")
 	}
-	return link, nil
+	return link.Clone(), nil
+}
+
+// GetByShorts retrieves links by their short codes
+func (m *MockLinkRepository) GetByShorts(ctx context.Context, shorts []string) (map[string]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	links := make(map[string]*models.Link, len(shorts))
+	for _, short := range shorts {
+		if link, exists := m.links[short]; exists && !link.IsDeleted() {
+			links[short] = link.Clone()
+		}
+	}
+	return links, nil
 }
 
 // GetAll retrieves all links
 func (m *MockLinkRepository) GetAll(ctx context.Context) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
 	var links []*models.Link
 	for _, link := range m.links {
-		links = append(links, link)
+		if !link.IsDeleted() {
+			links = append(links, link.Clone())
+		}
 	}
-	return links, nil
+	return linkcap.Apply(ctx, links), nil
+}
+
+// List retrieves the links a query selects
+func (m *MockLinkRepository) List(ctx context.Context, query models.LinkQuery) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var links []*models.Link
+	for _, link := range m.links {
+		if query.Matches(link) {
+			links = append(links, link.Clone())
+		}
+	}
+	query.Sort(links)
+	if query.Limit > 0 && len(links) > query.Limit {
+		links = links[:query.Limit]
+	}
+	return linkcap.Apply(ctx, links), nil
 }
 
 // Update updates an existing link
 func (m *MockLinkRepository) Update(ctx context.Context, link *models.Link) error {
-	if _, exists := m.links[link.Short]; !exists {
-		return errors.New("link not found")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if existing, exists := m.links[link.Short]; !exists || existing.IsDeleted() {
+		return apperrors.NewNotFound("link not found")
 	}
 	link.UpdatedAt = time.Now()
-	m.links[link.Short] = link
+	m.links[link.Short] = link.Clone()
 	return nil
 }
 
-// Delete removes a link by its short code
+// Delete moves a link to the trash by its short code
 func (m *MockLinkRepository) Delete(ctx context.Context, short string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, exists := m.links[short]
+	if !exists || link.IsDeleted() {
+		return apperrors.NewNotFound("link not found")
+	}
+	link.DeletedAt = time.Now()
+	return nil
+}
+
+// GetDeleted retrieves all links in the trash
+func (m *MockLinkRepository) GetDeleted(ctx context.Context) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var links []*models.Link
+	for _, link := range m.links {
+		if link.IsDeleted() {
+			links = append(links, link.Clone())
+		}
+	}
+	return links, nil
+}
+
+// GetDeletedByShort retrieves a link in the trash by its short code
+func (m *MockLinkRepository) GetDeletedByShort(ctx context.Context, short string) (*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	link, exists := m.links[short]
+	if !exists || !link.IsDeleted() {
+		return nil, apperrors.NewNotFound("link not in trash")
+	}
+	return link.Clone(), nil
+}
+
+// Restore moves a link out of the trash
+func (m *MockLinkRepository) Restore(ctx context.Context, short string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, exists := m.links[short]
+	if !exists || !link.IsDeleted() {
+		return apperrors.NewNotFound("link not in trash")
+	}
+	link.DeletedAt = time.Time{}
+	return nil
+}
+
+// Purge permanently removes a link
+func (m *MockLinkRepository) Purge(ctx context.Context, short string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if _, exists := m.links[short]; !exists {
-		return errors.New("link not found")
+		return apperrors.NewNotFound("link not found")
 	}
 	delete(m.links, short)
+	delete(m.stats, short)
 	return nil
 }
 
+// Rename changes a link's short code, moving its statistics along
+func (m *MockLinkRepository) Rename(ctx context.Context, short, newShort string) (*models.Link, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, exists := m.links[short]
+	if !exists || link.IsDeleted() {
+		return nil, apperrors.NewNotFound("link not found")
+	}
+	if _, taken := m.links[newShort]; taken {
+		return nil, apperrors.NewAlreadyExists("link already exists")
+	}
+	link.Short = newShort
+	delete(m.links, short)
+	m.links[newShort] = link
+	if stats, exists := m.stats[short]; exists {
+		stats.Short = newShort
+		delete(m.stats, short)
+		m.stats[newShort] = stats
+	}
+	return link.Clone(), nil
+}
+
 // IncrementClickCount increments the click count for a link
 func (m *MockLinkRepository) IncrementClickCount(ctx context.Context, short string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	link, exists := m.links[short]
 	if !exists {
-		return errors.New("link not found")
+		return apperrors.NewNotFound("link not found")
+	}
+	if link.ClickLimitReached() {
+		return apperrors.NewGone("link has reached its click limit")
 	}
+	now := time.Now()
 	link.ClickCount++
-	link.UpdatedAt = time.Now()
+	link.UpdatedAt = now
+	link.LastClickedAt = now
+	return nil
+}
+
+// RecordRolloutClick counts a click on one variant of the link's rollout
+func (m *MockLinkRepository) RecordRolloutClick(ctx context.Context, short, variant string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	link, exists := m.links[short]
+	if !exists {
+		return apperrors.NewNotFound("link not found")
+	}
+	if link.Rollout == nil {
+		return nil
+	}
+	if variant == models.RolloutVariants.Canary {
+		link.Rollout.CanaryClicks++
+	} else {
+		link.Rollout.PrimaryClicks++
+	}
+	return nil
+}
+
+// UpdatePopularity stores the link's popularity score fields
+func (m *MockLinkRepository) UpdatePopularity(ctx context.Context, link *models.Link) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, exists := m.links[link.Short]
+	if !exists {
+		return apperrors.NewNotFound("link not found")
+	}
+	stored.PopularityScore = link.PopularityScore
+	stored.ScoredAt = link.ScoredAt
+	stored.ScoredClicks = link.ScoredClicks
 	return nil
 }
 
 // GetByAccessLevel retrieves links by access level
 func (m *MockLinkRepository) GetByAccessLevel(ctx context.Context, accessLevel string) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
 	var links []*models.Link
 	for _, link := range m.links {
-		if link.AccessLevel == accessLevel {
-			links = append(links, link)
+		if !link.IsDeleted() && link.AccessLevel == accessLevel {
+			links = append(links, link.Clone())
 		}
 	}
 	return links, nil
@@ -123,45 +303,166 @@ func (m *MockLinkRepository) GetByAccessLevel(ctx context.Context, accessLevel s
 
 // GetByUser retrieves links created by a specific user
 func (m *MockLinkRepository) GetByUser(ctx context.Context, userID string) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
 	var links []*models.Link
 	for _, link := range m.links {
-		if link.CreatedBy == userID {
-			links = append(links, link)
+		if !link.IsDeleted() && link.CreatedBy == userID {
+			links = append(links, link.Clone())
 		}
 	}
 	return links, nil
 }
 
-// CheckAccess determines if a user has access to a link
-func (m *MockLinkRepository) CheckAccess(ctx context.Context, short string, userID string) (bool, error) {
-	link, exists := m.links[short]
-	if !exists {
-		return false, errors.New("link not found")
+// Ping always succeeds
+func (m *MockLinkRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// GetExpiredLinks retrieves the links past their expiry not yet flagged expired
+func (m *MockLinkRepository) GetExpiredLinks(ctx context.Context) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := time.Now()
+	var links []*models.Link
+	for _, link := range m.links {
+		if !link.IsDeleted() && !link.IsExpired && !link.ExpiresAt.IsZero() && link.ExpiresAt.Before(now) {
+			links = append(links, link.Clone())
+		}
 	}
+	return links, nil
+}
 
-	// Public links are accessible to everyone
-	if link.AccessLevel == models.AccessLevels.Public {
-		return true, nil
+// GetLinksByExpiryStatus retrieves links by their expiry status
+func (m *MockLinkRepository) GetLinksByExpiryStatus(ctx context.Context, isExpired bool) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var links []*models.Link
+	for _, link := range m.links {
+		if !link.IsDeleted() && link.IsExpired == isExpired {
+			links = append(links, link.Clone())
+		}
 	}
+	return links, nil
+}
+
+// CountAll counts the links outside the trash
+func (m *MockLinkRepository) CountAll(ctx context.Context) (int, error) {
+	return m.count(func(*models.Link) bool { return true }), nil
+}
+
+// CountByUser counts the links outside the trash created by a user
+func (m *MockLinkRepository) CountByUser(ctx context.Context, userID string) (int, error) {
+	return m.count(func(link *models.Link) bool { return link.CreatedBy == userID }), nil
+}
+
+// CountByAccessLevel counts the links outside the trash with an access level
+func (m *MockLinkRepository) CountByAccessLevel(ctx context.Context, accessLevel string) (int, error) {
+	return m.count(func(link *models.Link) bool { return link.AccessLevel == accessLevel }), nil
+}
+
+// count counts the links outside the trash matching the predicate
+func (m *MockLinkRepository) count(match func(*models.Link) bool) int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 
-	// Private links are only accessible to the creator
-	if link.AccessLevel == models.AccessLevels.Private {
-		return link.CreatedBy == userID, nil
+	count := 0
+	for _, link := range m.links {
+		if !link.IsDeleted() && match(link) {
+			count++
+		}
 	}
+	return count
+}
 
-	// Restricted links are accessible to the creator and allowed users
-	if link.AccessLevel == models.AccessLevels.Restricted {
-		if link.CreatedBy == userID {
-			return true, nil
+// GetByTag retrieves links carrying a tag
+func (m *MockLinkRepository) GetByTag(ctx context.Context, tag string) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var links []*models.Link
+	for _, link := range m.links {
+		if !link.IsDeleted() && link.HasTag(tag) {
+			links = append(links, link.Clone())
 		}
+	}
+	return links, nil
+}
+
+// GetByURL retrieves links pointing at exactly the given destination
+func (m *MockLinkRepository) GetByURL(ctx context.Context, url string) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var links []*models.Link
+	for _, link := range m.links {
+		if !link.IsDeleted() && link.URL == url {
+			links = append(links, link.Clone())
+		}
+	}
+	return links, nil
+}
+
+// GetByNamespace retrieves links whose short codes lie below a namespace
+func (m *MockLinkRepository) GetByNamespace(ctx context.Context, namespace string) ([]*models.Link, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 
-		// Check if the user is in the allowed users list
-		for _, allowedUser := range link.AllowedUsers {
-			if allowedUser == userID {
-				return true, nil
-			}
+	var links []*models.Link
+	for _, link := range m.links {
+		if !link.IsDeleted() && link.InNamespace(namespace) {
+			links = append(links, link.Clone())
 		}
 	}
+	return links, nil
+}
+
+// CheckAccess determines if a user has access to a link
+func (m *MockLinkRepository) CheckAccess(ctx context.Context, short string, userID string) (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 
-	return false, nil
+	link, exists := m.links[short]
+	if !exists || link.IsDeleted() {
+		return false, apperrors.NewNotFound("link not found")
+	}
+	return link.CanAccessAs(userID, groups.FromContext(ctx)), nil
+}
+
+// GetLinkStats retrieves a copy of the statistics of a link
+func (m *MockLinkRepository) GetLinkStats(ctx context.Context, short string) (*models.LinkStats, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	link, exists := m.links[short]
+	if !exists || link.IsDeleted() {
+		return nil, apperrors.NewNotFound("link not found")
+	}
+	stats, exists := m.stats[short]
+	if !exists {
+		stats = models.NewLinkStats(short)
+	}
+	stats = stats.Clone()
+	stats.TotalClicks = link.ClickCount
+	return stats, nil
+}
+
+// UpdateLinkStats applies update to the statistics of a link
+func (m *MockLinkRepository) UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.links[short]; !exists {
+		return apperrors.NewNotFound("link not found")
+	}
+	stats, exists := m.stats[short]
+	if !exists {
+		stats = models.NewLinkStats(short)
+		m.stats[short] = stats
+	}
+	update(stats)
+	return nil
 }
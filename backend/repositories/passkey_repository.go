@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PasskeyRepository stores passkeys in Firestore, keyed by a hash of their
+// credential ID, which may be too long for a document ID. The recovery codes
+// of each user are one document in a second collection.
+type PasskeyRepository struct {
+	client        *firestore.Client
+	collection    string
+	recoveryCodes string
+}
+
+// Ensure PasskeyRepository implements PasskeyStore
+var _ interfaces.PasskeyStore = (*PasskeyRepository)(nil)
+
+// NewPasskeyRepository creates a new PasskeyRepository
+func NewPasskeyRepository(client *firestore.Client) *PasskeyRepository {
+	return &PasskeyRepository{
+		client:        client,
+		collection:    "passkeys",
+		recoveryCodes: "passkey_recovery_codes",
+	}
+}
+
+// passkeyDocID returns the document ID of the passkey with credential ID id
+func passkeyDocID(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(hash[:])
+}
+
+// Create stores a new passkey
+func (r *PasskeyRepository) Create(ctx context.Context, passkey *models.Passkey) error {
+	_, err := r.client.Collection(r.collection).Doc(passkeyDocID(passkey.ID)).Create(ctx, passkey)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return errors.NewAlreadyExists("Passkey is already registered")
+		}
+		return errors.NewInternalError(fmt.Errorf("Error creating passkey: %w", err))
+	}
+	return nil
+}
+
+// ListByUser retrieves the passkeys of a user
+func (r *PasskeyRepository) ListByUser(ctx context.Context, userID string) ([]*models.Passkey, error) {
+	iter := r.client.Collection(r.collection).Where("user_id", "==", userID).Documents(ctx)
+	var passkeys []*models.Passkey
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving passkeys: %w", err))
+		}
+
+		var passkey models.Passkey
+		if err := doc.DataTo(&passkey); err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error converting passkey data: %w", err))
+		}
+		passkeys = append(passkeys, &passkey)
+	}
+
+	return passkeys, nil
+}
+
+// RecordUse stores the signature count and last use of a passkey
+func (r *PasskeyRepository) RecordUse(ctx context.Context, passkey *models.Passkey) error {
+	_, err := r.client.Collection(r.collection).Doc(passkeyDocID(passkey.ID)).Update(ctx, []firestore.Update{
+		{Path: "sign_count", Value: passkey.SignCount},
+		{Path: "last_used_at", Value: passkey.LastUsedAt},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return errors.NewNotFound("Passkey not found")
+		}
+		return errors.NewInternalError(fmt.Errorf("Error recording passkey use: %w", err))
+	}
+	return nil
+}
+
+// Delete removes a passkey
+func (r *PasskeyRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.client.Collection(r.collection).Doc(passkeyDocID(id)).Delete(ctx, firestore.Exists)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return errors.NewNotFound("Passkey not found")
+		}
+		return errors.NewInternalError(fmt.Errorf("Error deleting passkey: %w", err))
+	}
+	return nil
+}
+
+// SetRecoveryCodes replaces the user's recovery codes
+func (r *PasskeyRepository) SetRecoveryCodes(ctx context.Context, codes *models.RecoveryCodes) error {
+	if _, err := r.client.Collection(r.recoveryCodes).Doc(codes.UserID).Set(ctx, codes); err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error storing recovery codes: %w", err))
+	}
+	return nil
+}
+
+// UseRecoveryCode removes the code with hash from the user's recovery codes
+// in a transaction, so a code cannot be used twice concurrently
+func (r *PasskeyRepository) UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error) {
+	ref := r.client.Collection(r.recoveryCodes).Doc(userID)
+	used := false
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		used = false
+		codes, err := recoveryCodes(tx.Get(ref))
+		if err != nil || codes == nil {
+			return err
+		}
+		index := slices.Index(codes.Hashes, hash)
+		if index < 0 {
+			return nil
+		}
+		used = true
+		return tx.Update(ref, []firestore.Update{
+			{Path: "hashes", Value: slices.Delete(codes.Hashes, index, index+1)},
+		})
+	})
+	if err != nil {
+		return false, errors.NewInternalError(fmt.Errorf("Error using recovery code: %w", err))
+	}
+	return used, nil
+}
+
+// RemainingRecoveryCodes returns how many unused recovery codes the user has
+func (r *PasskeyRepository) RemainingRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	codes, err := recoveryCodes(r.client.Collection(r.recoveryCodes).Doc(userID).Get(ctx))
+	if err != nil {
+		return 0, errors.NewInternalError(fmt.Errorf("Error retrieving recovery codes: %w", err))
+	}
+	if codes == nil {
+		return 0, nil
+	}
+	return len(codes.Hashes), nil
+}
+
+// recoveryCodes decodes a recovery codes document, which is missing until
+// the user's first passkey is registered
+func recoveryCodes(doc *firestore.DocumentSnapshot, err error) (*models.RecoveryCodes, error) {
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var codes models.RecoveryCodes
+	if err := doc.DataTo(&codes); err != nil {
+		return nil, err
+	}
+	return &codes, nil
+}
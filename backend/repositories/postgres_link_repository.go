@@ -0,0 +1,668 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresLinkRepository stores links and their statistics in PostgreSQL,
+// for deployments without Firebase. Each link is a row of the links table
+// (see migrations/postgres): the fields links are looked up and counted by
+// are columns, and the whole link is a JSON document. Statistics are keyed
+// by the link's ID, so they follow the link when it is renamed.
+type PostgresLinkRepository struct {
+	pool *pgxpool.Pool
+}
+
+// Ensure PostgresLinkRepository implements both repository interfaces
+var (
+	_ interfaces.LinkRepositoryInterface = (*PostgresLinkRepository)(nil)
+	_ LinkRepositoryInterface            = (*PostgresLinkRepository)(nil)
+)
+
+// NewPostgresLinkRepository creates a link repository in the database of
+// pool, whose schema is migrated with MigratePostgres
+func NewPostgresLinkRepository(pool *pgxpool.Pool) *PostgresLinkRepository {
+	return &PostgresLinkRepository{pool: pool}
+}
+
+// linkColumns are the columns of a link row, in the order of linkValues and scanLink
+const linkColumns = `short, id, url, created_by, access_level, tags, click_count, max_clicks,
+	last_clicked_at, popularity_score, scored_at, scored_clicks, expires_at, is_expired,
+	created_at, updated_at, deleted_at, data`
+
+// linkOrderClauses are the ORDER BY clauses of the orders of LinkQuery
+var linkOrderClauses = map[string]string{
+	models.LinkOrderShort:  "short",
+	models.LinkOrderNewest: "created_at DESC, short",
+	models.LinkOrderClicks: "click_count DESC, short",
+}
+
+// pgUniqueViolation is the SQLSTATE of a unique constraint violation
+const pgUniqueViolation = "23505"
+
+// linkValues returns the column values of a link
+func linkValues(link *models.Link) ([]any, error) {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+	tags := link.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return []any{
+		link.Short, link.ID, link.URL, link.CreatedBy, link.AccessLevel, tags, link.ClickCount, link.MaxClicks,
+		nullTime(link.LastClickedAt), link.PopularityScore, nullTime(link.ScoredAt), link.ScoredClicks,
+		nullTime(link.ExpiresAt), link.IsExpired, link.CreatedAt, link.UpdatedAt, nullTime(link.DeletedAt), data,
+	}, nil
+}
+
+// scanLink reads a link row selected with linkColumns
+func scanLink(row pgx.Row) (*models.Link, error) {
+	var (
+		link                                          models.Link
+		short, id, url, createdBy, accessLevel        string
+		tags                                          []string
+		clickCount, maxClicks, scoredClicks           int
+		popularityScore                               float64
+		lastClickedAt, scoredAt, expiresAt, deletedAt *time.Time
+		isExpired                                     bool
+		createdAt, updatedAt                          time.Time
+		data                                          []byte
+	)
+	if err := row.Scan(&short, &id, &url, &createdBy, &accessLevel, &tags, &clickCount, &maxClicks,
+		&lastClickedAt, &popularityScore, &scoredAt, &scoredClicks, &expiresAt, &isExpired,
+		&createdAt, &updatedAt, &deletedAt, &data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &link); err != nil {
+		return nil, err
+	}
+
+	// The columns are kept up to date by statements that leave data alone
+	link.Short, link.ID, link.URL, link.CreatedBy, link.AccessLevel = short, id, url, createdBy, accessLevel
+	link.Tags, link.ClickCount, link.MaxClicks, link.ScoredClicks = tags, clickCount, maxClicks, scoredClicks
+	link.PopularityScore, link.IsExpired = popularityScore, isExpired
+	link.LastClickedAt, link.ScoredAt = timeValue(lastClickedAt), timeValue(scoredAt)
+	link.ExpiresAt, link.DeletedAt = timeValue(expiresAt), timeValue(deletedAt)
+	link.CreatedAt, link.UpdatedAt = createdAt, updatedAt
+	link.SchemaVersion = models.LinkSchemaVersion
+	if link.AllowedUsers == nil {
+		link.AllowedUsers = []string{}
+	}
+	return &link, nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// timeValue reads NULL as the zero time
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
+
+// internalError wraps database errors, passing the repository's own errors through
+func internalError(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	if errors.GetStatusCode(err) < 500 {
+		return err
+	}
+	return errors.NewInternalError(fmt.Errorf("%s: %w", message, err))
+}
+
+// Create adds a new link
+func (r *PostgresLinkRepository) Create(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("create", time.Now(), &err)
+	if link.ID == "" {
+		link.ID = models.NewLinkID()
+	}
+	now := time.Now()
+	link.CreatedAt = now
+	link.UpdatedAt = now
+	link.SchemaVersion = models.LinkSchemaVersion
+
+	values, err := linkValues(link)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error encoding link: %w", err))
+	}
+	tag, err := r.pool.Exec(ctx, `INSERT INTO links (`+linkColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT (short) DO NOTHING`, values...)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error creating link: %w", err))
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	// A trashed link keeps its short code until purged
+	var deletedAt *time.Time
+	if err := r.pool.QueryRow(ctx, "SELECT deleted_at FROM links WHERE short = $1", link.Short).Scan(&deletedAt); err == nil && deletedAt != nil {
+		return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' is in the trash; restore it or wait until it is purged", link.Short))
+	}
+	return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", link.Short))
+}
+
+// GetByShort retrieves a link by its short code. Links in the trash are not
+// found. A link found past its expiry is flagged expired.
+func (r *PostgresLinkRepository) GetByShort(ctx context.Context, short string) (_ *models.Link, err error) {
+	defer observeOperation("get_by_short", time.Now(), &err)
+	link, err := scanLink(r.pool.QueryRow(ctx, "SELECT "+linkColumns+" FROM links WHERE short = $1 AND deleted_at IS NULL", short))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link: %w", err))
+	}
+
+	if link.IsLinkExpired() && !link.IsExpired {
+		link.IsExpired = true
+		link.UpdatedAt = time.Now()
+		if _, err := r.pool.Exec(ctx, "UPDATE links SET is_expired = true, updated_at = $2 WHERE id = $1",
+			link.ID, link.UpdatedAt); err != nil {
+			repoLog.Warn("Failed to mark link expired", logger.Fields{"short": short, "error": err.Error()})
+		}
+	}
+	return link, nil
+}
+
+// GetByShorts retrieves links by their short codes in one query
+func (r *PostgresLinkRepository) GetByShorts(ctx context.Context, shorts []string) (_ map[string]*models.Link, err error) {
+	defer observeOperation("get_by_shorts", time.Now(), &err)
+	links, err := r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE short = ANY($1) AND deleted_at IS NULL", shorts)
+	if err != nil {
+		return nil, err
+	}
+	return linksByShort(links), nil
+}
+
+// List retrieves the links a query selects. The database filters the links
+// by column and orders them; access and archival, which are only kept in
+// data, are checked as the rows stream in, until enough were found.
+func (r *PostgresLinkRepository) List(ctx context.Context, query models.LinkQuery) (_ []*models.Link, err error) {
+	defer observeOperation("list", time.Now(), &err)
+	where, args := []string{"deleted_at IS NULL"}, []any{}
+	filter := func(condition string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(condition, len(args)))
+	}
+	if query.CreatedBy != "" {
+		filter("created_by = $%d", query.CreatedBy)
+	}
+	if query.AccessLevel != "" {
+		filter("access_level = $%d", query.AccessLevel)
+	}
+	if query.Tag != "" {
+		filter("tags @> $%d", []string{models.NormalizeTag(query.Tag)})
+	}
+	if query.Expired != nil {
+		filter("is_expired = $%d", *query.Expired)
+	}
+	links, err := r.queryMatching(ctx, query.Matches, listLimit(ctx, query.Limit), "SELECT "+linkColumns+
+		" FROM links WHERE "+strings.Join(where, " AND ")+" ORDER BY "+linkOrderClauses[query.OrderBy], args...)
+	if err != nil {
+		return nil, err
+	}
+	return linkcap.Apply(ctx, links), nil
+}
+
+// GetAll retrieves all links outside the trash, up to the cap of ctx
+func (r *PostgresLinkRepository) GetAll(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_all", time.Now(), &err)
+	// One link past the cap tells whether links were left out
+	query := "SELECT " + linkColumns + " FROM links WHERE deleted_at IS NULL ORDER BY short"
+	args := []any{}
+	if limit := linkcap.Max(ctx); limit > 0 {
+		query += " LIMIT $1"
+		args = append(args, limit+1)
+	}
+	links, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return linkcap.Apply(ctx, links), nil
+}
+
+// Update updates an existing link, keeping its ID
+func (r *PostgresLinkRepository) Update(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("update", time.Now(), &err)
+	link.UpdatedAt = time.Now()
+	link.SchemaVersion = models.LinkSchemaVersion
+	values, err := linkValues(link)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error encoding link: %w", err))
+	}
+	// The link keeps the ID of its row; everything else is overwritten
+	values = append(values[:1], values[2:]...)
+	err = r.pool.QueryRow(ctx, `UPDATE links SET (url, created_by, access_level, tags, click_count, max_clicks,
+			last_clicked_at, popularity_score, scored_at, scored_clicks, expires_at, is_expired,
+			created_at, updated_at, deleted_at, data)
+		= ($2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		WHERE short = $1 AND deleted_at IS NULL
+		RETURNING id`, values...).Scan(&link.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error updating link: %w", err))
+	}
+	return nil
+}
+
+// Delete moves a link to the trash by its short code
+func (r *PostgresLinkRepository) Delete(ctx context.Context, short string) (err error) {
+	defer observeOperation("delete", time.Now(), &err)
+	tag, err := r.pool.Exec(ctx, "UPDATE links SET deleted_at = $2, updated_at = $2 WHERE short = $1 AND deleted_at IS NULL",
+		short, time.Now())
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error deleting link: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	return nil
+}
+
+// GetDeleted retrieves all links in the trash
+func (r *PostgresLinkRepository) GetDeleted(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_deleted", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE deleted_at IS NOT NULL ORDER BY short")
+}
+
+// GetDeletedByShort retrieves a link in the trash by its short code
+func (r *PostgresLinkRepository) GetDeletedByShort(ctx context.Context, short string) (_ *models.Link, err error) {
+	defer observeOperation("get_deleted_by_short", time.Now(), &err)
+	link, err := scanLink(r.pool.QueryRow(ctx, "SELECT "+linkColumns+" FROM links WHERE short = $1 AND deleted_at IS NOT NULL", short))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving deleted link: %w", err))
+	}
+	return link, nil
+}
+
+// Restore moves a link out of the trash
+func (r *PostgresLinkRepository) Restore(ctx context.Context, short string) (err error) {
+	defer observeOperation("restore", time.Now(), &err)
+	tag, err := r.pool.Exec(ctx, "UPDATE links SET deleted_at = NULL, updated_at = $2 WHERE short = $1 AND deleted_at IS NOT NULL",
+		short, time.Now())
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error restoring link: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+	}
+	return nil
+}
+
+// Purge permanently removes a link and, with it, its statistics
+func (r *PostgresLinkRepository) Purge(ctx context.Context, short string) (err error) {
+	defer observeOperation("purge", time.Now(), &err)
+	tag, err := r.pool.Exec(ctx, "DELETE FROM links WHERE short = $1", short)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error purging link: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	return nil
+}
+
+// Rename changes a link's short code. Its ID, and so its statistics, stay.
+func (r *PostgresLinkRepository) Rename(ctx context.Context, short, newShort string) (_ *models.Link, err error) {
+	defer observeOperation("rename", time.Now(), &err)
+	link, err := scanLink(r.pool.QueryRow(ctx, `UPDATE links SET short = $2, updated_at = $3
+		WHERE short = $1 AND deleted_at IS NULL RETURNING `+linkColumns, short, newShort, time.Now()))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		case isUniqueViolation(err):
+			return nil, errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", newShort))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error renaming link: %w", err))
+	}
+	return link, nil
+}
+
+// IncrementClickCount counts a click on a link in one statement, which
+// also enforces the link's click limit
+func (r *PostgresLinkRepository) IncrementClickCount(ctx context.Context, short string) (err error) {
+	defer observeOperation("increment_click_count", time.Now(), &err)
+	tag, err := r.pool.Exec(ctx, `UPDATE links SET click_count = click_count + 1, updated_at = $2, last_clicked_at = $2
+		WHERE short = $1 AND deleted_at IS NULL AND (max_clicks = 0 OR click_count < max_clicks)`, short, time.Now())
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error updating click count: %w", err))
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	// Tell a missing link from one that reached its click limit
+	var limited bool
+	err = r.pool.QueryRow(ctx, "SELECT max_clicks > 0 FROM links WHERE short = $1 AND deleted_at IS NULL", short).Scan(&limited)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	case err != nil:
+		return errors.NewInternalError(fmt.Errorf("Error updating click count: %w", err))
+	case limited:
+		return errors.NewGone(fmt.Sprintf("Link '%s' has reached its click limit", short))
+	}
+	return nil
+}
+
+// RecordRolloutClick counts a click on one variant of the link's rollout
+func (r *PostgresLinkRepository) RecordRolloutClick(ctx context.Context, short, variant string) (err error) {
+	defer observeOperation("record_rollout_click", time.Now(), &err)
+	err = pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		link, err := scanLink(tx.QueryRow(ctx, "SELECT "+linkColumns+" FROM links WHERE short = $1 AND deleted_at IS NULL FOR UPDATE", short))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+			}
+			return err
+		}
+		if link.Rollout == nil {
+			return nil
+		}
+		if variant == models.RolloutVariants.Canary {
+			link.Rollout.CanaryClicks++
+		} else {
+			link.Rollout.PrimaryClicks++
+		}
+		data, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE links SET data = $2 WHERE id = $1", link.ID, data)
+		return err
+	})
+	return internalError(err, "Error recording rollout click")
+}
+
+// UpdatePopularity stores the link's popularity score fields. Only those
+// columns are written, so the periodic scoring job cannot undo a concurrent edit.
+func (r *PostgresLinkRepository) UpdatePopularity(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("update_popularity", time.Now(), &err)
+	tag, err := r.pool.Exec(ctx, "UPDATE links SET popularity_score = $2, scored_at = $3, scored_clicks = $4 WHERE short = $1",
+		link.Short, link.PopularityScore, nullTime(link.ScoredAt), link.ScoredClicks)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error updating popularity score: %w", err))
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+	}
+	return nil
+}
+
+// GetByAccessLevel retrieves links by access level
+func (r *PostgresLinkRepository) GetByAccessLevel(ctx context.Context, accessLevel string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_access_level", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE access_level = $1 AND deleted_at IS NULL ORDER BY short", accessLevel)
+}
+
+// GetByUser retrieves links created by a specific user
+func (r *PostgresLinkRepository) GetByUser(ctx context.Context, userID string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_user", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE created_by = $1 AND deleted_at IS NULL ORDER BY short", userID)
+}
+
+// Ping checks that the database answers
+func (r *PostgresLinkRepository) Ping(ctx context.Context) (err error) {
+	defer observeOperation("ping", time.Now(), &err)
+	return r.pool.Ping(ctx)
+}
+
+// CountAll counts the links outside the trash
+func (r *PostgresLinkRepository) CountAll(ctx context.Context) (_ int, err error) {
+	defer observeOperation("count_all", time.Now(), &err)
+	return r.count(ctx, "SELECT count(*) FROM links WHERE deleted_at IS NULL")
+}
+
+// CountByUser counts the links outside the trash created by a user
+func (r *PostgresLinkRepository) CountByUser(ctx context.Context, userID string) (_ int, err error) {
+	defer observeOperation("count_by_user", time.Now(), &err)
+	return r.count(ctx, "SELECT count(*) FROM links WHERE created_by = $1 AND deleted_at IS NULL", userID)
+}
+
+// CountByAccessLevel counts the links outside the trash with an access level
+func (r *PostgresLinkRepository) CountByAccessLevel(ctx context.Context, accessLevel string) (_ int, err error) {
+	defer observeOperation("count_by_access_level", time.Now(), &err)
+	return r.count(ctx, "SELECT count(*) FROM links WHERE access_level = $1 AND deleted_at IS NULL", accessLevel)
+}
+
+// count runs a query counting links
+func (r *PostgresLinkRepository) count(ctx context.Context, query string, args ...any) (int, error) {
+	var count int
+	if err := r.pool.QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, errors.NewInternalError(fmt.Errorf("Error counting links: %w", err))
+	}
+	return count, nil
+}
+
+// GetByTag retrieves links carrying a tag
+func (r *PostgresLinkRepository) GetByTag(ctx context.Context, tag string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_tag", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE tags @> $1 AND deleted_at IS NULL ORDER BY short", []string{tag})
+}
+
+// GetByURL retrieves links pointing at exactly the given destination
+func (r *PostgresLinkRepository) GetByURL(ctx context.Context, url string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_url", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE url = $1 AND deleted_at IS NULL ORDER BY short", url)
+}
+
+// GetByNamespace retrieves links whose short codes lie below a namespace
+func (r *PostgresLinkRepository) GetByNamespace(ctx context.Context, namespace string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_namespace", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+` FROM links WHERE short LIKE $1 ESCAPE '\' AND deleted_at IS NULL ORDER BY short`,
+		escapeLike(namespace)+"/%")
+}
+
+// CheckAccess determines if a user has access to a link
+func (r *PostgresLinkRepository) CheckAccess(ctx context.Context, short string, userID string) (bool, error) {
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return false, err
+	}
+	return link.CanAccessAs(userID, groups.FromContext(ctx)), nil
+}
+
+// GetExpiredLinks retrieves links that are past their expiry but not yet flagged
+func (r *PostgresLinkRepository) GetExpiredLinks(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_expired_links", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+` FROM links
+		WHERE expires_at < $1 AND NOT is_expired AND deleted_at IS NULL ORDER BY short`, time.Now())
+}
+
+// GetLinksByExpiryStatus retrieves links by their expiry status
+func (r *PostgresLinkRepository) GetLinksByExpiryStatus(ctx context.Context, isExpired bool) (_ []*models.Link, err error) {
+	defer observeOperation("get_links_by_expiry_status", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE is_expired = $1 AND deleted_at IS NULL ORDER BY short", isExpired)
+}
+
+// GetLinkStats retrieves statistics for a link
+func (r *PostgresLinkRepository) GetLinkStats(ctx context.Context, short string) (_ *models.LinkStats, err error) {
+	defer observeOperation("get_link_stats", time.Now(), &err)
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err = r.pool.QueryRow(ctx, "SELECT data FROM link_stats WHERE link_id = $1", link.ID).Scan(&data)
+	var stats *models.LinkStats
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		stats = models.NewLinkStats(short)
+	case err != nil:
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link stats: %w", err))
+	default:
+		if stats, err = decodeJSONStats(data, short); err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error converting link stats data: %w", err))
+		}
+	}
+
+	// Update total clicks from link
+	stats.TotalClicks = link.ClickCount
+	return stats, nil
+}
+
+// UpdateLinkStats applies update to a link's statistics in a transaction,
+// creating them on the first update
+func (r *PostgresLinkRepository) UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) (err error) {
+	defer observeOperation("update_link_stats", time.Now(), &err)
+	err = pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		stats, id, err := r.lockStats(ctx, tx, short, true)
+		if err != nil {
+			return err
+		}
+		update(stats)
+		return saveStats(ctx, tx, id, stats)
+	})
+	return internalError(err, "Error updating link stats")
+}
+
+// CompactLinkStats folds a link's daily clicks into yearly totals in a
+// transaction, so clicks recorded while the job runs wait for it
+func (r *PostgresLinkRepository) CompactLinkStats(ctx context.Context, short string, at time.Time, archive StatsArchiveFunc) (_ *models.LinkStats, err error) {
+	defer observeOperation("compact_link_stats", time.Now(), &err)
+	var result *models.LinkStats
+	err = pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		stats, id, err := r.lockStats(ctx, tx, short, false)
+		if err != nil {
+			return err
+		}
+		compacted := stats.Clone()
+		if ok, err := compactStats(ctx, compacted, at, archive); err != nil || !ok {
+			result = stats
+			return err
+		}
+		result = compacted
+		return saveStats(ctx, tx, id, compacted)
+	})
+	if err != nil {
+		return result, internalError(err, "Error compacting link stats")
+	}
+	return result, nil
+}
+
+// lockStats reads a link's statistics for update in tx, with the link's ID.
+// Missing statistics are created when create is set and not found otherwise.
+func (r *PostgresLinkRepository) lockStats(ctx context.Context, tx pgx.Tx, short string, create bool) (*models.LinkStats, string, error) {
+	var id string
+	if err := tx.QueryRow(ctx, "SELECT id FROM links WHERE short = $1", short).Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		return nil, "", err
+	}
+	if create {
+		// Concurrent first updates wait for the row created here
+		data, err := json.Marshal(models.NewLinkStats(short))
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO link_stats (link_id, data) VALUES ($1, $2) ON CONFLICT (link_id) DO NOTHING", id, data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var data []byte
+	if err := tx.QueryRow(ctx, "SELECT data FROM link_stats WHERE link_id = $1 FOR UPDATE", id).Scan(&data); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", errors.NewNotFound(fmt.Sprintf("Stats of link '%s' not found", short))
+		}
+		return nil, "", err
+	}
+	stats, err := decodeJSONStats(data, short)
+	return stats, id, err
+}
+
+// saveStats writes a link's statistics in tx
+func saveStats(ctx context.Context, tx pgx.Tx, id string, stats *models.LinkStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, "UPDATE link_stats SET data = $2 WHERE link_id = $1", id, data)
+	return err
+}
+
+// decodeJSONStats decodes the statistics of the link now named short
+func decodeJSONStats(data []byte, short string) (*models.LinkStats, error) {
+	var stats models.LinkStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, err
+	}
+	stats.Short = short
+	stats.SchemaVersion = models.LinkStatsSchemaVersion
+	return &stats, nil
+}
+
+// query retrieves the links of a query selecting linkColumns
+func (r *PostgresLinkRepository) query(ctx context.Context, query string, args ...any) ([]*models.Link, error) {
+	return r.queryMatching(ctx, func(*models.Link) bool { return true }, 0, query, args...)
+}
+
+// queryMatching runs a query of links, keeping those that match until it
+// has limit links, or reading every row when limit is zero
+func (r *PostgresLinkRepository) queryMatching(ctx context.Context, match func(*models.Link) bool, limit int, query string, args ...any) ([]*models.Link, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+	defer rows.Close()
+
+	var links []*models.Link
+	for (limit == 0 || len(links) < limit) && rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error decoding link: %w", err))
+		}
+		if match(link) {
+			links = append(links, link)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+	return links, nil
+}
@@ -0,0 +1,42 @@
+package repositories_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPostgresTestRepository returns a repository on the empty, migrated
+// database at POSTGRES_TEST_URL, skipping the test when it is not set
+func newPostgresTestRepository(t *testing.T) *repositories.PostgresLinkRepository {
+	t.Helper()
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL is not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	_, err = repositories.MigratePostgres(ctx, pool)
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, "TRUNCATE links, link_stats")
+	require.NoError(t, err)
+	return repositories.NewPostgresLinkRepository(pool)
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	migrations, err := repositories.PostgresMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version, migration.Name)
+		assert.NotEmpty(t, migration.SQL, migration.Name)
+	}
+}
@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMigrationFiles are the schema migrations of the PostgreSQL
+// storage, named <version>_<name>.sql and applied in version order
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrationFiles embed.FS
+
+// postgresMigrationLock is the advisory lock held while migrating, so
+// concurrent runs apply each migration once
+const postgresMigrationLock = 7265746
+
+// PostgresMigration is one schema change of the PostgreSQL storage
+type PostgresMigration struct {
+	Name    string
+	SQL     string
+	Version int
+}
+
+// PostgresMigrations returns the schema migrations, oldest first
+func PostgresMigrations() ([]PostgresMigration, error) {
+	files, err := fs.Glob(postgresMigrationFiles, "migrations/postgres/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]PostgresMigration, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version prefix", file)
+		}
+		sql, err := postgresMigrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, PostgresMigration{Name: name, SQL: string(sql), Version: version})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// PendingPostgresMigrations returns the migrations the database lacks
+func PendingPostgresMigrations(ctx context.Context, pool *pgxpool.Pool) ([]PostgresMigration, error) {
+	migrations, err := PostgresMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedPostgresMigrations(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	var pending []PostgresMigration
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigratePostgres applies the pending migrations, each in its own
+// transaction, and returns those it applied
+func MigratePostgres(ctx context.Context, pool *pgxpool.Pool) ([]PostgresMigration, error) {
+	migrations, err := PostgresMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	var applied []PostgresMigration
+	for _, migration := range migrations {
+		done, err := applyPostgresMigration(ctx, pool, migration)
+		if err != nil {
+			return applied, fmt.Errorf("applying migration %s: %w", migration.Name, err)
+		}
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// applyPostgresMigration applies a migration unless it was applied already,
+// reporting whether it applied it
+func applyPostgresMigration(ctx context.Context, pool *pgxpool.Pool, migration PostgresMigration) (bool, error) {
+	var done bool
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)",
+			migration.Version).Scan(&exists); err != nil || exists {
+			return err
+		}
+		if _, err := tx.Exec(ctx, migration.SQL); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+			migration.Version, migration.Name); err != nil {
+			return err
+		}
+		done = true
+		return nil
+	})
+	return done, err
+}
+
+// appliedPostgresMigrations returns the versions of the applied migrations
+func appliedPostgresMigrations(ctx context.Context, pool *pgxpool.Pool) (map[int]bool, error) {
+	applied := make(map[int]bool)
+	var exists bool
+	if err := pool.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return applied, nil
+	}
+	rows, err := pool.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// ProductMetricsRepository stores the daily totals of product feature usage
+// in Firestore, one document per day
+type ProductMetricsRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure ProductMetricsRepository implements ProductMetricsStore
+var _ interfaces.ProductMetricsStore = (*ProductMetricsRepository)(nil)
+
+// NewProductMetricsRepository creates a new ProductMetricsRepository
+func NewProductMetricsRepository(client *firestore.Client) *ProductMetricsRepository {
+	return &ProductMetricsRepository{
+		client:     client,
+		collection: "product_metrics",
+	}
+}
+
+// Add adds counts of events to the totals of a day. The counts are
+// incremented in place, so every replica can add its own.
+func (r *ProductMetricsRepository) Add(ctx context.Context, day string, counts map[string]int64) error {
+	events := make(map[string]any, len(counts))
+	for event, n := range counts {
+		events[event] = firestore.Increment(n)
+	}
+	_, err := r.client.Collection(r.collection).Doc(day).Set(ctx, map[string]any{
+		"date":   day,
+		"events": events,
+	}, firestore.MergeAll)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error adding product metrics: %w", err))
+	}
+	return nil
+}
+
+// List returns the totals of the days from through to, oldest first
+func (r *ProductMetricsRepository) List(ctx context.Context, from, to string) ([]*models.ProductMetricsDay, error) {
+	iter := r.client.Collection(r.collection).
+		Where("date", ">=", from).
+		Where("date", "<=", to).
+		OrderBy("date", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	days := []*models.ProductMetricsDay{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving product metrics: %w", err))
+		}
+		var day models.ProductMetricsDay
+		if err := doc.DataTo(&day); err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error converting product metrics data: %w", err))
+		}
+		days = append(days, &day)
+	}
+	return days, nil
+}
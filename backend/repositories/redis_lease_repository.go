@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisAcquireLease takes the lease in KEYS[1] for the holder in ARGV[1]
+// for ARGV[2] milliseconds, unless another holder has it. It returns 1
+// when it took the lease and 0 otherwise.
+var redisAcquireLease = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// RedisLeaseRepository grants leases stored in Redis, each a key holding
+// its holder that expires with the lease
+type RedisLeaseRepository struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// Ensure RedisLeaseRepository implements LeaseStore
+var _ interfaces.LeaseStore = (*RedisLeaseRepository)(nil)
+
+// NewRedisLeaseRepository creates a RedisLeaseRepository whose keys start
+// with prefix, or DefaultRedisKeyPrefix when it is empty
+func NewRedisLeaseRepository(client redis.UniversalClient, prefix string) *RedisLeaseRepository {
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	return &RedisLeaseRepository{client: client, prefix: prefix}
+}
+
+// Acquire takes or renews a lease in one script, so two servers never
+// both take it
+func (r *RedisLeaseRepository) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	acquired, err := redisAcquireLease.Run(ctx, r.client, []string{r.prefix + "lease:" + name}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, errors.NewInternalError(fmt.Errorf("Error acquiring lease: %w", err))
+	}
+	return acquired == 1, nil
+}
@@ -0,0 +1,42 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisLeaseRepositoryAcquire(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	leases := repositories.NewRedisLeaseRepository(client, "")
+	ctx := context.Background()
+
+	acquired, err := leases.Acquire(ctx, "sweep", "server-a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = leases.Acquire(ctx, "sweep", "server-b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, acquired, "held by another server")
+
+	acquired, err = leases.Acquire(ctx, "sweep", "server-a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "renewed by its holder")
+
+	acquired, err = leases.Acquire(ctx, "other", "server-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "leases are independent")
+
+	server.FastForward(2 * time.Minute)
+	acquired, err = leases.Acquire(ctx, "sweep", "server-b", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, acquired, "taken over once expired")
+}
@@ -0,0 +1,904 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisKeyPrefix prefixes the keys of the Redis link storage. The
+// hash tag in braces puts every key in the same slot of a Redis cluster,
+// which the repository's transactions need.
+const DefaultRedisKeyPrefix = "{golink}:"
+
+// redisTxRetries bounds the retries of a transaction whose keys changed
+// while it ran
+const redisTxRetries = 10
+
+// redisIncrementClicks counts a click on the link hash in KEYS[1] at the
+// time in ARGV[1], unless the link reached its click limit. It returns 1
+// when it counted the click, 0 when the link is missing or in the trash
+// and -1 when it reached its limit.
+var redisIncrementClicks = redis.NewScript(`
+local deleted = redis.call('HGET', KEYS[1], 'deleted')
+if not deleted or deleted == '1' then
+	return 0
+end
+local max = tonumber(redis.call('HGET', KEYS[1], 'max_clicks'))
+if max > 0 and tonumber(redis.call('HGET', KEYS[1], 'click_count')) >= max then
+	return -1
+end
+redis.call('HINCRBY', KEYS[1], 'click_count', 1)
+redis.call('HSET', KEYS[1], 'last_clicked_at', ARGV[1], 'updated_at', ARGV[1])
+return 1
+`)
+
+// RedisLinkRepository stores links and their statistics in Redis, for
+// deployments where redirect latency matters more than rich queries. A
+// redirect reads one hash, and a click is counted by one script, without
+// a transaction. Lookups other than by short code or namespace read every
+// link and filter them, like MemoryLinkRepository.
+//
+// Each link is a hash of its JSON document and of the fields counted in
+// place, such as click_count; sorted sets list the short codes of the
+// links and of the trash. Statistics are JSON keyed by the link's ID, so
+// they follow the link when it is renamed.
+//
+// Redis may lose recent writes when it restarts. With WithWriteThrough,
+// every change is also written to a durable repository, and Preload
+// copies the links back into an empty Redis.
+type RedisLinkRepository struct {
+	client redis.UniversalClient
+	// durable receives every change after Redis, or is nil
+	durable LinkRepositoryInterface
+	prefix  string
+}
+
+// Ensure RedisLinkRepository implements both repository interfaces
+var (
+	_ interfaces.LinkRepositoryInterface = (*RedisLinkRepository)(nil)
+	_ LinkRepositoryInterface            = (*RedisLinkRepository)(nil)
+)
+
+// RedisLinkOption configures a RedisLinkRepository
+type RedisLinkOption func(*RedisLinkRepository)
+
+// WithWriteThrough writes every change to durable as well, once it is
+// stored in Redis. Failures to write to durable are logged and counted in
+// golink_link_write_through_failures_total, and do not fail the change.
+func WithWriteThrough(durable LinkRepositoryInterface) RedisLinkOption {
+	return func(r *RedisLinkRepository) {
+		r.durable = durable
+	}
+}
+
+// NewRedisLinkRepository creates a link repository storing links in Redis
+// under keys starting with prefix, or DefaultRedisKeyPrefix when it is empty
+func NewRedisLinkRepository(client redis.UniversalClient, prefix string, opts ...RedisLinkOption) *RedisLinkRepository {
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	r := &RedisLinkRepository{client: client, prefix: prefix}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// linkKey is the key of the hash of the link named short
+func (r *RedisLinkRepository) linkKey(short string) string {
+	return r.prefix + "link:" + short
+}
+
+// statsKey is the key of the statistics of the link with the ID
+func (r *RedisLinkRepository) statsKey(id string) string {
+	return r.prefix + "stats:" + id
+}
+
+// liveKey is the key of the sorted set of the short codes outside the trash
+func (r *RedisLinkRepository) liveKey() string {
+	return r.prefix + "links"
+}
+
+// trashKey is the key of the sorted set of the short codes in the trash
+func (r *RedisLinkRepository) trashKey() string {
+	return r.prefix + "trash"
+}
+
+// redisLinkFields returns the hash fields of a link
+func redisLinkFields(link *models.Link) (map[string]any, error) {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+	deleted := "0"
+	if link.IsDeleted() {
+		deleted = "1"
+	}
+	return map[string]any{
+		"id":              link.ID,
+		"data":            data,
+		"click_count":     link.ClickCount,
+		"max_clicks":      link.MaxClicks,
+		"scored_clicks":   link.ScoredClicks,
+		"last_clicked_at": redisTime(link.LastClickedAt),
+		"updated_at":      redisTime(link.UpdatedAt),
+		"deleted":         deleted,
+	}, nil
+}
+
+// decodeRedisLink decodes the hash fields of a link, returning nil for a
+// missing link
+func decodeRedisLink(fields map[string]string) (*models.Link, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	var link models.Link
+	if err := json.Unmarshal([]byte(fields["data"]), &link); err != nil {
+		return nil, err
+	}
+
+	// The counted fields change without rewriting data
+	var err error
+	if link.ClickCount, err = strconv.Atoi(fields["click_count"]); err != nil {
+		return nil, err
+	}
+	if link.ScoredClicks, err = strconv.Atoi(fields["scored_clicks"]); err != nil {
+		return nil, err
+	}
+	if link.LastClickedAt, err = redisTimeValue(fields["last_clicked_at"]); err != nil {
+		return nil, err
+	}
+	if link.UpdatedAt, err = redisTimeValue(fields["updated_at"]); err != nil {
+		return nil, err
+	}
+	link.SchemaVersion = models.LinkSchemaVersion
+	if link.AllowedUsers == nil {
+		link.AllowedUsers = []string{}
+	}
+	return &link, nil
+}
+
+// redisTime stores a time as Unix nanoseconds and the zero time as 0
+func redisTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// redisTimeValue reads a time stored by redisTime
+func redisTimeValue(s string) (time.Time, error) {
+	nanos, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || nanos == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+// read retrieves the link named short, or nil when it is missing
+func (r *RedisLinkRepository) read(ctx context.Context, c redis.HashCmdable, short string) (*models.Link, error) {
+	fields, err := c.HGetAll(ctx, r.linkKey(short)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeRedisLink(fields)
+}
+
+// save queues the writes storing link in pipe
+func (r *RedisLinkRepository) save(ctx context.Context, pipe redis.Pipeliner, link *models.Link) error {
+	fields, err := redisLinkFields(link)
+	if err != nil {
+		return err
+	}
+	pipe.HSet(ctx, r.linkKey(link.Short), fields)
+	member := redis.Z{Member: link.Short}
+	if link.IsDeleted() {
+		pipe.ZRem(ctx, r.liveKey(), link.Short)
+		pipe.ZAdd(ctx, r.trashKey(), member)
+	} else {
+		pipe.ZRem(ctx, r.trashKey(), link.Short)
+		pipe.ZAdd(ctx, r.liveKey(), member)
+	}
+	return nil
+}
+
+// watch runs fn in an optimistic transaction on keys, retrying it when
+// the keys change before it commits
+func (r *RedisLinkRepository) watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	for range redisTxRetries {
+		err := r.client.Watch(ctx, fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("keys %v kept changing during the transaction", keys)
+}
+
+// modify stores the link change returns for the stored link named short,
+// which is nil when it is missing, in a transaction. change returns an
+// error to leave the link alone.
+func (r *RedisLinkRepository) modify(ctx context.Context, short string, change func(stored *models.Link) (*models.Link, error)) (*models.Link, error) {
+	var result *models.Link
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		stored, err := r.read(ctx, tx, short)
+		if err != nil {
+			return err
+		}
+		link, err := change(stored)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return r.save(ctx, pipe, link)
+		})
+		result = link
+		return err
+	}, r.linkKey(short))
+	return result, err
+}
+
+// modifyLive applies change to the link named short outside the trash
+func (r *RedisLinkRepository) modifyLive(ctx context.Context, short string, change func(link *models.Link)) (*models.Link, error) {
+	return r.modify(ctx, short, func(link *models.Link) (*models.Link, error) {
+		if link == nil || link.IsDeleted() {
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		change(link)
+		return link, nil
+	})
+}
+
+// writeThrough applies write to the durable repository, if any. The write
+// outlives the request, so a client going away cannot skip it.
+func (r *RedisLinkRepository) writeThrough(ctx context.Context, operation, short string, write func(ctx context.Context, durable LinkRepositoryInterface) error) {
+	if r.durable == nil {
+		return
+	}
+	if err := write(context.WithoutCancel(ctx), r.durable); err != nil {
+		WriteThroughFailuresTotal.WithLabelValues(operation).Inc()
+		repoLog.Error("Failed to write link change through to durable storage", err, logger.Fields{
+			"operation": operation,
+			"short":     short,
+		})
+	}
+}
+
+// Create adds a new link
+func (r *RedisLinkRepository) Create(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("create", time.Now(), &err)
+	if link.ID == "" {
+		link.ID = models.NewLinkID()
+	}
+	now := time.Now()
+	link.CreatedAt = now
+	link.UpdatedAt = now
+	link.SchemaVersion = models.LinkSchemaVersion
+
+	_, err = r.modify(ctx, link.Short, func(existing *models.Link) (*models.Link, error) {
+		switch {
+		case existing == nil:
+			return link.Clone(), nil
+		case existing.IsDeleted():
+			return nil, errors.NewAlreadyExists(fmt.Sprintf("Link '%s' is in the trash; restore it or wait until it is purged", link.Short))
+		}
+		return nil, errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", link.Short))
+	})
+	if err != nil {
+		return internalError(err, "Error creating link")
+	}
+	r.writeThrough(ctx, "create", link.Short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.Create(ctx, link.Clone())
+	})
+	return nil
+}
+
+// GetByShort retrieves a link by its short code. Links in the trash are not
+// found. A link found past its expiry is flagged expired.
+func (r *RedisLinkRepository) GetByShort(ctx context.Context, short string) (_ *models.Link, err error) {
+	defer observeOperation("get_by_short", time.Now(), &err)
+	link, err := r.read(ctx, r.client, short)
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link: %w", err))
+	}
+	if link == nil || link.IsDeleted() {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+
+	if link.IsLinkExpired() && !link.IsExpired {
+		link.IsExpired = true
+		if _, err := r.modifyLive(ctx, short, func(stored *models.Link) { stored.IsExpired = true }); err != nil {
+			repoLog.Warn("Failed to mark link expired", logger.Fields{"short": short, "error": err.Error()})
+		}
+	}
+	return link, nil
+}
+
+// GetByShorts retrieves links by their short codes in one round trip
+func (r *RedisLinkRepository) GetByShorts(ctx context.Context, shorts []string) (_ map[string]*models.Link, err error) {
+	defer observeOperation("get_by_shorts", time.Now(), &err)
+	links, err := r.readAll(ctx, shorts)
+	if err != nil {
+		return nil, err
+	}
+	return linksByShort(slices.DeleteFunc(links, (*models.Link).IsDeleted)), nil
+}
+
+// GetAll retrieves all links outside the trash, up to the cap of ctx
+func (r *RedisLinkRepository) GetAll(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_all", time.Now(), &err)
+	// One link past the cap tells whether links were left out
+	stop := int64(-1)
+	if limit := linkcap.Max(ctx); limit > 0 {
+		stop = int64(limit)
+	}
+	shorts, err := r.client.ZRange(ctx, r.liveKey(), 0, stop).Result()
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+	links, err := r.readAll(ctx, shorts)
+	if err != nil {
+		return nil, err
+	}
+	return linkcap.Apply(ctx, links), nil
+}
+
+// List retrieves the links a query selects, reading every link and
+// filtering them here
+func (r *RedisLinkRepository) List(ctx context.Context, query models.LinkQuery) (_ []*models.Link, err error) {
+	defer observeOperation("list", time.Now(), &err)
+	links, err := r.filter(ctx, query.Matches)
+	if err != nil {
+		return nil, err
+	}
+	query.Sort(links)
+	return limitLinks(ctx, links, query.Limit), nil
+}
+
+// Update updates an existing link, keeping its ID
+func (r *RedisLinkRepository) Update(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("update", time.Now(), &err)
+	link.UpdatedAt = time.Now()
+	link.SchemaVersion = models.LinkSchemaVersion
+	_, err = r.modify(ctx, link.Short, func(stored *models.Link) (*models.Link, error) {
+		if stored == nil || stored.IsDeleted() {
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+		}
+		link.ID = stored.ID
+		return link.Clone(), nil
+	})
+	if err != nil {
+		return internalError(err, "Error updating link")
+	}
+	r.writeThrough(ctx, "update", link.Short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.Update(ctx, link.Clone())
+	})
+	return nil
+}
+
+// Delete moves a link to the trash by its short code
+func (r *RedisLinkRepository) Delete(ctx context.Context, short string) (err error) {
+	defer observeOperation("delete", time.Now(), &err)
+	_, err = r.modifyLive(ctx, short, func(link *models.Link) {
+		now := time.Now()
+		link.DeletedAt = now
+		link.UpdatedAt = now
+	})
+	if err != nil {
+		return internalError(err, "Error deleting link")
+	}
+	r.writeThrough(ctx, "delete", short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.Delete(ctx, short)
+	})
+	return nil
+}
+
+// GetDeleted retrieves all links in the trash
+func (r *RedisLinkRepository) GetDeleted(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_deleted", time.Now(), &err)
+	shorts, err := r.client.ZRange(ctx, r.trashKey(), 0, -1).Result()
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving deleted links: %w", err))
+	}
+	return r.readAll(ctx, shorts)
+}
+
+// GetDeletedByShort retrieves a link in the trash by its short code
+func (r *RedisLinkRepository) GetDeletedByShort(ctx context.Context, short string) (_ *models.Link, err error) {
+	defer observeOperation("get_deleted_by_short", time.Now(), &err)
+	link, err := r.read(ctx, r.client, short)
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving deleted link: %w", err))
+	}
+	if link == nil || !link.IsDeleted() {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+	}
+	return link, nil
+}
+
+// Restore moves a link out of the trash
+func (r *RedisLinkRepository) Restore(ctx context.Context, short string) (err error) {
+	defer observeOperation("restore", time.Now(), &err)
+	_, err = r.modify(ctx, short, func(link *models.Link) (*models.Link, error) {
+		if link == nil || !link.IsDeleted() {
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+		}
+		link.DeletedAt = time.Time{}
+		link.UpdatedAt = time.Now()
+		return link, nil
+	})
+	if err != nil {
+		return internalError(err, "Error restoring link")
+	}
+	r.writeThrough(ctx, "restore", short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.Restore(ctx, short)
+	})
+	return nil
+}
+
+// Purge permanently removes a link and, with it, its statistics
+func (r *RedisLinkRepository) Purge(ctx context.Context, short string) (err error) {
+	defer observeOperation("purge", time.Now(), &err)
+	key := r.linkKey(short)
+	err = r.watch(ctx, func(tx *redis.Tx) error {
+		link, err := r.read(ctx, tx, short)
+		if err != nil {
+			return err
+		}
+		if link == nil {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key, r.statsKey(link.ID))
+			pipe.ZRem(ctx, r.liveKey(), short)
+			pipe.ZRem(ctx, r.trashKey(), short)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return internalError(err, "Error purging link")
+	}
+	r.writeThrough(ctx, "purge", short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.Purge(ctx, short)
+	})
+	return nil
+}
+
+// Rename changes a link's short code. Its ID, and so its statistics, stay.
+func (r *RedisLinkRepository) Rename(ctx context.Context, short, newShort string) (_ *models.Link, err error) {
+	defer observeOperation("rename", time.Now(), &err)
+	var renamed *models.Link
+	err = r.watch(ctx, func(tx *redis.Tx) error {
+		link, err := r.read(ctx, tx, short)
+		if err != nil {
+			return err
+		}
+		if link == nil || link.IsDeleted() {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		taken, err := tx.Exists(ctx, r.linkKey(newShort)).Result()
+		if err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", newShort))
+		}
+
+		link.Short = newShort
+		link.UpdatedAt = time.Now()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, r.linkKey(short))
+			pipe.ZRem(ctx, r.liveKey(), short)
+			return r.save(ctx, pipe, link)
+		})
+		renamed = link
+		return err
+	}, r.linkKey(short), r.linkKey(newShort))
+	if err != nil {
+		return nil, internalError(err, "Error renaming link")
+	}
+	r.writeThrough(ctx, "rename", short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		_, err := durable.Rename(ctx, short, newShort)
+		return err
+	})
+	return renamed, nil
+}
+
+// IncrementClickCount counts a click on a link in one script, which also
+// enforces the link's click limit
+func (r *RedisLinkRepository) IncrementClickCount(ctx context.Context, short string) (err error) {
+	defer observeOperation("increment_click_count", time.Now(), &err)
+	counted, err := redisIncrementClicks.Run(ctx, r.client, []string{r.linkKey(short)}, time.Now().UnixNano()).Int()
+	switch {
+	case err != nil:
+		return errors.NewInternalError(fmt.Errorf("Error updating click count: %w", err))
+	case counted == 0:
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	case counted < 0:
+		return errors.NewGone(fmt.Sprintf("Link '%s' has reached its click limit", short))
+	}
+	r.writeThrough(ctx, "increment_click_count", short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.IncrementClickCount(ctx, short)
+	})
+	return nil
+}
+
+// RecordRolloutClick counts a click on one variant of the link's rollout
+func (r *RedisLinkRepository) RecordRolloutClick(ctx context.Context, short, variant string) (err error) {
+	defer observeOperation("record_rollout_click", time.Now(), &err)
+	_, err = r.modifyLive(ctx, short, func(link *models.Link) {
+		switch {
+		case link.Rollout == nil:
+		case variant == models.RolloutVariants.Canary:
+			link.Rollout.CanaryClicks++
+		default:
+			link.Rollout.PrimaryClicks++
+		}
+	})
+	if err != nil {
+		return internalError(err, "Error recording rollout click")
+	}
+	r.writeThrough(ctx, "record_rollout_click", short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.RecordRolloutClick(ctx, short, variant)
+	})
+	return nil
+}
+
+// UpdatePopularity stores the link's popularity score fields. Only those
+// fields are written, so the periodic scoring job cannot undo a concurrent edit.
+func (r *RedisLinkRepository) UpdatePopularity(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("update_popularity", time.Now(), &err)
+	_, err = r.modify(ctx, link.Short, func(stored *models.Link) (*models.Link, error) {
+		if stored == nil {
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+		}
+		stored.PopularityScore = link.PopularityScore
+		stored.ScoredAt = link.ScoredAt
+		stored.ScoredClicks = link.ScoredClicks
+		return stored, nil
+	})
+	if err != nil {
+		return internalError(err, "Error updating popularity score")
+	}
+	r.writeThrough(ctx, "update_popularity", link.Short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.UpdatePopularity(ctx, link)
+	})
+	return nil
+}
+
+// GetByAccessLevel retrieves links by access level
+func (r *RedisLinkRepository) GetByAccessLevel(ctx context.Context, accessLevel string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_access_level", time.Now(), &err)
+	return r.filter(ctx, func(l *models.Link) bool { return l.AccessLevel == accessLevel })
+}
+
+// GetByUser retrieves links created by a specific user
+func (r *RedisLinkRepository) GetByUser(ctx context.Context, userID string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_user", time.Now(), &err)
+	return r.filter(ctx, func(l *models.Link) bool { return l.CreatedBy == userID })
+}
+
+// Ping checks that Redis answers
+func (r *RedisLinkRepository) Ping(ctx context.Context) (err error) {
+	defer observeOperation("ping", time.Now(), &err)
+	return r.client.Ping(ctx).Err()
+}
+
+// CountAll counts the links outside the trash, which the live set holds
+func (r *RedisLinkRepository) CountAll(ctx context.Context) (_ int, err error) {
+	defer observeOperation("count_all", time.Now(), &err)
+	count, err := r.client.ZCard(ctx, r.liveKey()).Result()
+	if err != nil {
+		return 0, errors.NewInternalError(fmt.Errorf("Error counting links: %w", err))
+	}
+	return int(count), nil
+}
+
+// CountByUser counts the links outside the trash created by a user,
+// reading every link
+func (r *RedisLinkRepository) CountByUser(ctx context.Context, userID string) (_ int, err error) {
+	defer observeOperation("count_by_user", time.Now(), &err)
+	links, err := r.filter(ctx, func(l *models.Link) bool { return l.CreatedBy == userID })
+	return len(links), err
+}
+
+// CountByAccessLevel counts the links outside the trash with an access
+// level, reading every link
+func (r *RedisLinkRepository) CountByAccessLevel(ctx context.Context, accessLevel string) (_ int, err error) {
+	defer observeOperation("count_by_access_level", time.Now(), &err)
+	links, err := r.filter(ctx, func(l *models.Link) bool { return l.AccessLevel == accessLevel })
+	return len(links), err
+}
+
+// GetByTag retrieves links carrying a tag
+func (r *RedisLinkRepository) GetByTag(ctx context.Context, tag string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_tag", time.Now(), &err)
+	return r.filter(ctx, func(l *models.Link) bool { return l.HasTag(tag) })
+}
+
+// GetByURL retrieves links pointing at exactly the given destination
+func (r *RedisLinkRepository) GetByURL(ctx context.Context, url string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_url", time.Now(), &err)
+	return r.filter(ctx, func(l *models.Link) bool { return l.URL == url })
+}
+
+// GetByNamespace retrieves links whose short codes lie below a namespace,
+// reading only those from the sorted set of short codes
+func (r *RedisLinkRepository) GetByNamespace(ctx context.Context, namespace string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_namespace", time.Now(), &err)
+	// Short codes below the namespace sort from "namespace/" up to "namespace0"
+	shorts, err := r.client.ZRangeByLex(ctx, r.liveKey(), &redis.ZRangeBy{
+		Min: "[" + namespace + "/",
+		Max: "(" + namespace + "0",
+	}).Result()
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+	return r.readAll(ctx, shorts)
+}
+
+// CheckAccess determines if a user has access to a link
+func (r *RedisLinkRepository) CheckAccess(ctx context.Context, short string, userID string) (bool, error) {
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return false, err
+	}
+	return link.CanAccessAs(userID, groups.FromContext(ctx)), nil
+}
+
+// GetExpiredLinks retrieves links that are past their expiry but not yet flagged
+func (r *RedisLinkRepository) GetExpiredLinks(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_expired_links", time.Now(), &err)
+	now := time.Now()
+	return r.filter(ctx, func(l *models.Link) bool {
+		return !l.ExpiresAt.IsZero() && l.ExpiresAt.Before(now) && !l.IsExpired
+	})
+}
+
+// GetLinksByExpiryStatus retrieves links by their expiry status
+func (r *RedisLinkRepository) GetLinksByExpiryStatus(ctx context.Context, isExpired bool) (_ []*models.Link, err error) {
+	defer observeOperation("get_links_by_expiry_status", time.Now(), &err)
+	return r.filter(ctx, func(l *models.Link) bool { return l.IsExpired == isExpired })
+}
+
+// GetLinkStats retrieves statistics for a link
+func (r *RedisLinkRepository) GetLinkStats(ctx context.Context, short string) (_ *models.LinkStats, err error) {
+	defer observeOperation("get_link_stats", time.Now(), &err)
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := r.client.Get(ctx, r.statsKey(link.ID)).Bytes()
+	var stats *models.LinkStats
+	switch {
+	case errors.Is(err, redis.Nil):
+		stats = models.NewLinkStats(short)
+	case err != nil:
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link stats: %w", err))
+	default:
+		if stats, err = decodeJSONStats(data, short); err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error converting link stats data: %w", err))
+		}
+	}
+
+	// Update total clicks from link
+	stats.TotalClicks = link.ClickCount
+	return stats, nil
+}
+
+// UpdateLinkStats applies update to a link's statistics in a transaction,
+// creating them on the first update
+func (r *RedisLinkRepository) UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) (err error) {
+	defer observeOperation("update_link_stats", time.Now(), &err)
+	_, err = r.modifyStats(ctx, short, func(stats *models.LinkStats) (*models.LinkStats, error) {
+		// Updated in a copy, as the stats are only written when they change
+		updated := models.NewLinkStats(short)
+		if stats != nil {
+			updated = stats.Clone()
+		}
+		update(updated)
+		return updated, nil
+	})
+	if err != nil {
+		return internalError(err, "Error updating link stats")
+	}
+	r.writeThrough(ctx, "update_link_stats", short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+		return durable.UpdateLinkStats(ctx, short, update)
+	})
+	return nil
+}
+
+// CompactLinkStats folds a link's daily clicks into yearly totals in a
+// transaction, retried when clicks are recorded meanwhile
+func (r *RedisLinkRepository) CompactLinkStats(ctx context.Context, short string, at time.Time, archive StatsArchiveFunc) (_ *models.LinkStats, err error) {
+	defer observeOperation("compact_link_stats", time.Now(), &err)
+	compacted := false
+	result, err := r.modifyStats(ctx, short, func(stats *models.LinkStats) (*models.LinkStats, error) {
+		if stats == nil {
+			return nil, errors.NewNotFound(fmt.Sprintf("Stats of link '%s' not found", short))
+		}
+		result := stats.Clone()
+		ok, err := compactStats(ctx, result, at, archive)
+		if err != nil || !ok {
+			return stats, err
+		}
+		compacted = true
+		return result, nil
+	})
+	if err != nil {
+		return result, internalError(err, "Error compacting link stats")
+	}
+	if compacted {
+		// The durable copy is compacted alike, pointing at the same archive
+		archiveURI := result.ArchiveURI
+		r.writeThrough(ctx, "compact_link_stats", short, func(ctx context.Context, durable LinkRepositoryInterface) error {
+			_, err := durable.CompactLinkStats(ctx, short, at, func(context.Context, *models.LinkStats) (string, error) {
+				return archiveURI, nil
+			})
+			return err
+		})
+	}
+	return result, nil
+}
+
+// modifyStats stores the statistics change returns for the stored
+// statistics of the link named short, which are nil when missing, in a
+// transaction. The link may be in the trash.
+func (r *RedisLinkRepository) modifyStats(ctx context.Context, short string, change func(stats *models.LinkStats) (*models.LinkStats, error)) (*models.LinkStats, error) {
+	id, err := r.client.HGet(ctx, r.linkKey(short), "id").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result *models.LinkStats
+	key := r.statsKey(id)
+	err = r.watch(ctx, func(tx *redis.Tx) error {
+		// The link may have been renamed or purged since its ID was read
+		current, err := tx.HGet(ctx, r.linkKey(short), "id").Result()
+		if errors.Is(err, redis.Nil) || current != id {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		if err != nil {
+			return err
+		}
+
+		var stats *models.LinkStats
+		data, err := tx.Get(ctx, key).Bytes()
+		switch {
+		case errors.Is(err, redis.Nil):
+		case err != nil:
+			return err
+		default:
+			if stats, err = decodeJSONStats(data, short); err != nil {
+				return err
+			}
+		}
+		changed, err := change(stats)
+		result = changed
+		if err != nil || changed == stats {
+			return err
+		}
+		encoded, err := json.Marshal(changed)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, encoded, 0)
+			return nil
+		})
+		return err
+	}, r.linkKey(short), key)
+	return result, err
+}
+
+// Preload copies the links, those in the trash included, and the
+// statistics of the write-through repository into Redis when Redis holds
+// no links, such as after it lost its data, and returns how many links it
+// copied. It does nothing without write-through.
+func (r *RedisLinkRepository) Preload(ctx context.Context) (int, error) {
+	if r.durable == nil {
+		return 0, nil
+	}
+	live, err := r.client.ZCard(ctx, r.liveKey()).Result()
+	if err != nil {
+		return 0, err
+	}
+	trashed, err := r.client.ZCard(ctx, r.trashKey()).Result()
+	if err != nil {
+		return 0, err
+	}
+	if live+trashed > 0 {
+		return 0, nil
+	}
+
+	links, err := r.durable.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := r.durable.GetDeleted(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, link := range append(links, deleted...) {
+		var stats []byte
+		if !link.IsDeleted() {
+			linkStats, err := r.durable.GetLinkStats(ctx, link.Short)
+			if err != nil {
+				return 0, err
+			}
+			if stats, err = json.Marshal(linkStats); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if stats != nil {
+				pipe.Set(ctx, r.statsKey(link.ID), stats, 0)
+			}
+			return r.save(ctx, pipe, link)
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(links) + len(deleted), nil
+}
+
+// filter retrieves the links outside the trash matching the predicate
+func (r *RedisLinkRepository) filter(ctx context.Context, match func(*models.Link) bool) ([]*models.Link, error) {
+	shorts, err := r.client.ZRange(ctx, r.liveKey(), 0, -1).Result()
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+	links, err := r.readAll(ctx, shorts)
+	if err != nil {
+		return nil, err
+	}
+	var matched []*models.Link
+	for _, link := range links {
+		if match(link) {
+			matched = append(matched, link)
+		}
+	}
+	return matched, nil
+}
+
+// readAll retrieves the links named shorts in one round trip, skipping
+// those removed since the short codes were listed
+func (r *RedisLinkRepository) readAll(ctx context.Context, shorts []string) ([]*models.Link, error) {
+	cmds := make([]*redis.MapStringStringCmd, len(shorts))
+	if _, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, short := range shorts {
+			cmds[i] = pipe.HGetAll(ctx, r.linkKey(short))
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+
+	links := make([]*models.Link, 0, len(shorts))
+	for _, cmd := range cmds {
+		link, err := decodeRedisLink(cmd.Val())
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error decoding link: %w", err))
+		}
+		if link != nil {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,83 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRedisTestClient returns a client of a new in-process Redis server
+func newRedisTestClient(t *testing.T) *redis.Client {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// newRedisTestRepository returns a repository on a new in-process Redis server
+func newRedisTestRepository(t *testing.T, opts ...repositories.RedisLinkOption) *repositories.RedisLinkRepository {
+	t.Helper()
+	return repositories.NewRedisLinkRepository(newRedisTestClient(t), "", opts...)
+}
+
+func TestRedisLinkRepositoryWriteThrough(t *testing.T) {
+	durable := repositories.NewMemoryLinkRepository()
+	repo := newRedisTestRepository(t, repositories.WithWriteThrough(durable))
+	ctx := context.Background()
+
+	link := createTestLink("docs", "https://docs.example.com", "user1")
+	link.ID = models.NewLinkID()
+	require.NoError(t, repo.Create(ctx, link))
+	require.NoError(t, repo.Create(ctx, createTestLink("wiki", "https://wiki.example.com", "user1")))
+	require.NoError(t, repo.IncrementClickCount(ctx, "docs"))
+	require.NoError(t, repo.UpdateLinkStats(ctx, "docs", func(stats *models.LinkStats) {
+		stats.RecordClickAt(time.Now().UTC(), "", "", "", "", "")
+	}))
+	_, err := repo.Rename(ctx, "docs", "documentation")
+	require.NoError(t, err)
+	require.NoError(t, repo.Delete(ctx, "wiki"))
+
+	mirrored, err := durable.GetByShort(ctx, "documentation")
+	require.NoError(t, err)
+	assert.Equal(t, link.ID, mirrored.ID)
+	assert.Equal(t, 1, mirrored.ClickCount)
+	stats, err := durable.GetLinkStats(ctx, "documentation")
+	require.NoError(t, err)
+	assert.Len(t, stats.ClicksByDate, 1)
+	_, err = durable.GetDeletedByShort(ctx, "wiki")
+	require.NoError(t, err)
+
+	archive := func(context.Context, *models.LinkStats) (string, error) { return "gs://archive/documentation", nil }
+	_, err = repo.CompactLinkStats(ctx, "documentation", time.Now().UTC(), archive)
+	require.NoError(t, err)
+	stats, err = durable.GetLinkStats(ctx, "documentation")
+	require.NoError(t, err)
+	assert.Equal(t, "gs://archive/documentation", stats.ArchiveURI, "the durable copy points at the same archive")
+
+	// A Redis that lost its data is filled from the durable repository
+	empty := newRedisTestRepository(t, repositories.WithWriteThrough(durable))
+	copied, err := empty.Preload(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, copied)
+	restored, err := empty.GetByShort(ctx, "documentation")
+	require.NoError(t, err)
+	assert.Equal(t, link.ID, restored.ID)
+	assert.Equal(t, 1, restored.ClickCount)
+	restoredStats, err := empty.GetLinkStats(ctx, "documentation")
+	require.NoError(t, err)
+	assert.Equal(t, "gs://archive/documentation", restoredStats.ArchiveURI)
+	_, err = empty.GetDeletedByShort(ctx, "wiki")
+	require.NoError(t, err)
+
+	copied, err = empty.Preload(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, copied, "a Redis holding links is left alone")
+}
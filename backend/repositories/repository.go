@@ -2,8 +2,10 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
 )
 
 // LinkRepositoryInterface defines the interface for link repository operations
@@ -16,24 +18,78 @@ type LinkRepositoryInterface interface {
 	// GetByShort retrieves a link by its short code
 	GetByShort(ctx context.Context, short string) (*models.Link, error)
 
+	// GetByShorts retrieves the links with the given short codes in as few
+	// reads as the storage allows, keyed by short code. Short codes of
+	// missing or trashed links are left out. Unlike GetByShort, it does not
+	// flag links past their expiry.
+	GetByShorts(ctx context.Context, shorts []string) (map[string]*models.Link, error)
+
 	// GetAll retrieves all links
 	GetAll(ctx context.Context) ([]*models.Link, error)
 
+	// List retrieves the links a query selects, in its order, up to its
+	// limit and the cap of ctx
+	List(ctx context.Context, query models.LinkQuery) ([]*models.Link, error)
+
 	// Update updates an existing link
 	Update(ctx context.Context, link *models.Link) error
 
-	// Delete removes a link by its short code
+	// Delete moves a link to the trash by its short code. Trashed links are
+	// hidden from every other read method except GetDeleted and GetDeletedByShort.
 	Delete(ctx context.Context, short string) error
 
+	// GetDeleted retrieves all links in the trash
+	GetDeleted(ctx context.Context) ([]*models.Link, error)
+
+	// GetDeletedByShort retrieves a link in the trash by its short code
+	GetDeletedByShort(ctx context.Context, short string) (*models.Link, error)
+
+	// Restore moves a link out of the trash
+	Restore(ctx context.Context, short string) error
+
+	// Purge permanently removes a link, whether or not it is in the trash
+	Purge(ctx context.Context, short string) error
+
+	// Rename changes a link's short code atomically, keeping its ID and moving
+	// its statistics along. It fails with an already exists error if the new
+	// short code is taken.
+	Rename(ctx context.Context, short, newShort string) (*models.Link, error)
+
 	// IncrementClickCount increments the click count for a link
 	IncrementClickCount(ctx context.Context, short string) error
 
+	// RecordRolloutClick counts a click on one variant of the link's rollout.
+	// Clicks arriving after the rollout was removed are dropped.
+	RecordRolloutClick(ctx context.Context, short, variant string) error
+
+	// UpdatePopularity stores the link's popularity score fields without
+	// touching the rest of the link
+	UpdatePopularity(ctx context.Context, link *models.Link) error
+
 	// GetByAccessLevel retrieves links by access level
 	GetByAccessLevel(ctx context.Context, accessLevel string) ([]*models.Link, error)
 
 	// GetByUser retrieves links created by a specific user
 	GetByUser(ctx context.Context, userID string) ([]*models.Link, error)
 
+	// Ping checks that the store answers, reading at most one link
+	Ping(ctx context.Context) error
+
+	// CountAll counts the links outside the trash without reading them
+	CountAll(ctx context.Context) (int, error)
+
+	// CountByUser counts the links outside the trash created by a user
+	CountByUser(ctx context.Context, userID string) (int, error)
+
+	// CountByAccessLevel counts the links outside the trash with an access level
+	CountByAccessLevel(ctx context.Context, accessLevel string) (int, error)
+
+	// GetByTag retrieves links carrying a tag
+	GetByTag(ctx context.Context, tag string) ([]*models.Link, error)
+
+	// GetByURL retrieves links pointing at exactly the given destination
+	GetByURL(ctx context.Context, url string) ([]*models.Link, error)
+
 	// CheckAccess determines if a user has access to a link
 	CheckAccess(ctx context.Context, short string, userID string) (bool, error)
 
@@ -45,4 +101,63 @@ type LinkRepositoryInterface interface {
 
 	// GetLinkStats retrieves statistics for a link
 	GetLinkStats(ctx context.Context, short string) (*models.LinkStats, error)
+
+	// UpdateLinkStats applies update to a link's statistics atomically,
+	// creating them on the first update
+	UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) error
+
+	// CompactLinkStats folds a link's daily clicks into yearly totals. When
+	// archive is set, the full statistics are handed to it first and only
+	// compacted once it succeeded. Stats without daily clicks are left alone.
+	CompactLinkStats(ctx context.Context, short string, at time.Time, archive StatsArchiveFunc) (*models.LinkStats, error)
+}
+
+// StatsArchiveFunc stores a copy of a link's full statistics in cold
+// storage and returns where it was stored
+type StatsArchiveFunc func(ctx context.Context, stats *models.LinkStats) (string, error)
+
+// listLimit returns how many links a listing with the given limit reads:
+// the limit, or one link past the cap of ctx, which tells whether links
+// were left out, when that is fewer
+func listLimit(ctx context.Context, limit int) int {
+	if max := linkcap.Max(ctx); max > 0 && (limit == 0 || limit > max) {
+		return max + 1
+	}
+	return limit
+}
+
+// limitLinks returns the first of the sorted links a listing with the given
+// limit returns, marking ctx truncated when its cap left links out
+func limitLinks(ctx context.Context, links []*models.Link, limit int) []*models.Link {
+	if n := listLimit(ctx, limit); n > 0 && len(links) > n {
+		links = links[:n]
+	}
+	return linkcap.Apply(ctx, links)
+}
+
+// linksByShort keys links by their short codes
+func linksByShort(links []*models.Link) map[string]*models.Link {
+	byShort := make(map[string]*models.Link, len(links))
+	for _, link := range links {
+		byShort[link.Short] = link
+	}
+	return byShort
+}
+
+// compactStats archives and then compacts stats, reporting whether there
+// was anything to compact
+func compactStats(ctx context.Context, stats *models.LinkStats, at time.Time, archive StatsArchiveFunc) (bool, error) {
+	if len(stats.ClicksByDate) == 0 && stats.Status == models.LinkStatsStatusCompacted {
+		return false, nil
+	}
+	var archiveURI string
+	if archive != nil {
+		uri, err := archive(ctx, stats)
+		if err != nil {
+			return false, err
+		}
+		archiveURI = uri
+	}
+	stats.Compact(at, archiveURI)
+	return true, nil
 }
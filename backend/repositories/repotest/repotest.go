@@ -0,0 +1,581 @@
+// Package repotest is a conformance suite for link repositories. It runs the
+// same behavioral tests against any implementation, so a new storage
+// backend proves it behaves like the others:
+//
+//	func TestConformance(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) interfaces.LinkRepositoryInterface {
+//			return newEmptyRepository(t)
+//		})
+//	}
+//
+// Repositories that also implement repositories.LinkRepositoryInterface are
+// tested on expiry and the compaction of statistics as well.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty repository. It is called once per test, and
+// registers any cleanup with t.
+type Factory func(t *testing.T) interfaces.LinkRepositoryInterface
+
+// tests are the behavioral tests of the suite, by name
+var tests = []struct {
+	run  func(t *testing.T, repo interfaces.LinkRepositoryInterface)
+	name string
+}{
+	{name: "CreateAndRead", run: testCreateAndRead},
+	{name: "GetByShorts", run: testGetByShorts},
+	{name: "Count", run: testCount},
+	{name: "List", run: testList},
+	{name: "Update", run: testUpdate},
+	{name: "ReturnsCopies", run: testReturnsCopies},
+	{name: "SoftDelete", run: testSoftDelete},
+	{name: "ClickLimit", run: testClickLimit},
+	{name: "GetByNamespace", run: testGetByNamespace},
+	{name: "GetByURL", run: testGetByURL},
+	{name: "Rename", run: testRename},
+	{name: "Stats", run: testStats},
+	{name: "Expiry", run: testExpiry},
+	{name: "CompactStats", run: testCompactStats},
+}
+
+// Run runs the suite, each test against a new repository from newRepo
+func Run(t *testing.T, newRepo Factory) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepo(t))
+		})
+	}
+}
+
+// newLink returns a link to create
+func newLink(short, url, userID string) *models.Link {
+	return &models.Link{
+		ID:        short,
+		Short:     short,
+		URL:       url,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+// shortsOf returns the short codes of links
+func shortsOf(links []*models.Link) []string {
+	shorts := []string{}
+	for _, link := range links {
+		shorts = append(shorts, link.Short)
+	}
+	return shorts
+}
+
+// withExpiry returns repo as a repository answering expiry and compaction
+// queries, skipping the test when it is not one
+func withExpiry(t *testing.T, repo interfaces.LinkRepositoryInterface) repositories.LinkRepositoryInterface {
+	t.Helper()
+	full, ok := repo.(repositories.LinkRepositoryInterface)
+	if !ok {
+		t.Skipf("%T does not implement repositories.LinkRepositoryInterface", repo)
+	}
+	return full
+}
+
+// testCreateAndRead checks that created links are read back whole, by
+// every lookup, and that short codes are unique
+func testCreateAndRead(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	link := newLink("docs", "https://docs.example.com", "user1")
+	link.Tags = []string{"eng", "docs"}
+	link.AllowedUsers = []string{"user2"}
+	link.AccessLevel = models.AccessLevels.Restricted
+	require.NoError(t, repo.Create(ctx, link))
+	assert.NotEmpty(t, link.ID)
+	assert.True(t, errors.Is(repo.Create(ctx, newLink("docs", "https://example.com", "user2")), errors.ErrAlreadyExists))
+	require.NoError(t, repo.Create(ctx, newLink("wiki", "https://wiki.example.com", "user2")))
+
+	stored, err := repo.GetByShort(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, link.ID, stored.ID)
+	assert.Equal(t, "https://docs.example.com", stored.URL)
+	assert.Equal(t, []string{"eng", "docs"}, stored.Tags)
+	assert.Equal(t, []string{"user2"}, stored.AllowedUsers)
+	assert.WithinDuration(t, link.CreatedAt, stored.CreatedAt, time.Millisecond)
+	_, err = repo.GetByShort(ctx, "missing")
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+
+	all, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"docs", "wiki"}, shortsOf(all))
+	byTag, err := repo.GetByTag(ctx, "eng")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs"}, shortsOf(byTag))
+	byTag, err = repo.GetByTag(ctx, "en")
+	require.NoError(t, err)
+	assert.Empty(t, byTag, "tags match whole")
+	byUser, err := repo.GetByUser(ctx, "user2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wiki"}, shortsOf(byUser))
+	byLevel, err := repo.GetByAccessLevel(ctx, models.AccessLevels.Restricted)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs"}, shortsOf(byLevel))
+
+	allowed, err := repo.CheckAccess(ctx, "docs", "user2")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, err = repo.CheckAccess(ctx, "docs", "user3")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+// testGetByShorts checks that batch lookups find every live link asked for,
+// once, and leave out the rest
+func testGetByShorts(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	for _, short := range []string{"docs", "wiki", "team/docs", "trashed"} {
+		require.NoError(t, repo.Create(ctx, newLink(short, "https://example.com", "user1")))
+	}
+	require.NoError(t, repo.Delete(ctx, "trashed"))
+
+	links, err := repo.GetByShorts(ctx, []string{"docs", "team/docs", "docs", "trashed", "missing"})
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "docs", links["docs"].Short)
+	assert.Equal(t, "team/docs", links["team/docs"].Short)
+
+	links, err = repo.GetByShorts(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+// testCount checks that counts match the links outside the trash
+func testCount(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	for _, link := range []*models.Link{
+		newLink("docs", "https://example.com", "user1"),
+		newLink("wiki", "https://example.com", "user1"),
+		newLink("team", "https://example.com", "user2"),
+		newLink("trashed", "https://example.com", "user1"),
+	} {
+		if link.Short == "team" {
+			link.AccessLevel = models.AccessLevels.Private
+		} else {
+			link.AccessLevel = models.AccessLevels.Public
+		}
+		require.NoError(t, repo.Create(ctx, link))
+	}
+	require.NoError(t, repo.Delete(ctx, "trashed"))
+
+	count, err := repo.CountAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	count, err = repo.CountByUser(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = repo.CountByUser(ctx, "nobody")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	count, err = repo.CountByAccessLevel(ctx, models.AccessLevels.Public)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = repo.CountByAccessLevel(ctx, models.AccessLevels.Private)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+// testList checks that listings select links by every filter, in each
+// order, up to their limit
+func testList(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	created := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	add := func(short, userID, accessLevel string, tags []string, clicks int, change func(*models.Link)) {
+		t.Helper()
+		link := newLink(short, "https://example.com", userID)
+		link.AccessLevel = accessLevel
+		link.Tags = tags
+		created = created.Add(time.Minute)
+		link.CreatedAt = created
+		if change != nil {
+			change(link)
+		}
+		require.NoError(t, repo.Create(ctx, link))
+		for range clicks {
+			require.NoError(t, repo.IncrementClickCount(ctx, short))
+		}
+	}
+	add("alpha", "user1", models.AccessLevels.Public, []string{"eng"}, 3, nil)
+	add("bravo", "user1", models.AccessLevels.Private, []string{"eng", "ops"}, 1, nil)
+	add("charlie", "user2", models.AccessLevels.Public, nil, 5, nil)
+	add("delta", "user2", models.AccessLevels.Restricted, []string{"eng"}, 0, func(link *models.Link) {
+		link.AllowedUsers = []string{"user1"}
+	})
+	add("echo", "user2", models.AccessLevels.Public, []string{"eng"}, 2, func(link *models.Link) {
+		link.IsExpired = true
+	})
+	add("foxtrot", "user1", models.AccessLevels.Public, []string{"eng"}, 0, func(link *models.Link) {
+		link.Archive("user1", time.Now())
+	})
+	add("golf", "user1", models.AccessLevels.Public, []string{"eng"}, 0, nil)
+	require.NoError(t, repo.Delete(ctx, "golf"))
+
+	expired, current := true, false
+	tests := []struct {
+		query models.LinkQuery
+		name  string
+		want  []string
+	}{
+		{name: "Every link", want: []string{"alpha", "bravo", "charlie", "delta", "echo"}},
+		{name: "Creator", query: models.LinkQuery{CreatedBy: "user1"}, want: []string{"alpha", "bravo"}},
+		{name: "Access level", query: models.LinkQuery{AccessLevel: models.AccessLevels.Public}, want: []string{"alpha", "charlie", "echo"}},
+		{name: "Tag", query: models.LinkQuery{Tag: " ENG "}, want: []string{"alpha", "bravo", "delta", "echo"}},
+		{name: "Expired", query: models.LinkQuery{Expired: &expired}, want: []string{"echo"}},
+		{name: "Not expired", query: models.LinkQuery{Expired: &current, Tag: "eng"}, want: []string{"alpha", "bravo", "delta"}},
+		{name: "Several filters", query: models.LinkQuery{CreatedBy: "user2", Tag: "eng", AccessLevel: models.AccessLevels.Public}, want: []string{"echo"}},
+		{name: "Visible to a user", query: models.LinkQuery{VisibleTo: "user2"}, want: []string{"alpha", "charlie", "delta", "echo"}},
+		{name: "Archived", query: models.LinkQuery{Archived: true}, want: []string{"foxtrot"}},
+		{name: "Newest", query: models.LinkQuery{OrderBy: models.LinkOrderNewest}, want: []string{"echo", "delta", "charlie", "bravo", "alpha"}},
+		{name: "Most clicked", query: models.LinkQuery{OrderBy: models.LinkOrderClicks, CreatedBy: "user2"}, want: []string{"charlie", "echo", "delta"}},
+		{name: "Limit", query: models.LinkQuery{OrderBy: models.LinkOrderClicks, Limit: 2}, want: []string{"charlie", "alpha"}},
+		{name: "Limit after access", query: models.LinkQuery{VisibleTo: "user2", Tag: "eng", Limit: 2}, want: []string{"alpha", "delta"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, err := repo.List(ctx, tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, shortsOf(links))
+		})
+	}
+}
+
+// testUpdate checks that updates replace the link, keeping its ID
+func testUpdate(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	link := newLink("docs", "https://docs.example.com", "user1")
+	link.ID = models.NewLinkID()
+	require.NoError(t, repo.Create(ctx, link))
+
+	stored, err := repo.GetByShort(ctx, "docs")
+	require.NoError(t, err)
+	stored.URL = "https://docs.example.org"
+	require.NoError(t, repo.Update(ctx, stored))
+	updated, err := repo.GetByShort(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, "https://docs.example.org", updated.URL)
+	assert.Equal(t, link.ID, updated.ID)
+
+	assert.True(t, errors.Is(repo.Update(ctx, newLink("missing", "https://example.com", "user1")), errors.ErrNotFound))
+}
+
+// testReturnsCopies checks that no repository lets callers alias its
+// internal state, either through the link passed to Create/Update or
+// through links returned by reads.
+func testReturnsCopies(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	link := newLink("team", "https://example.com", "user1")
+	link.AccessLevel = models.AccessLevels.Restricted
+	link.AllowedUsers = []string{"user2"}
+	require.NoError(t, repo.Create(ctx, link))
+
+	// Mutating the created link after the fact
+	link.URL = "https://evil.example.com"
+	link.AllowedUsers[0] = "mallory"
+	assertStored(t, repo)
+
+	// Mutating links returned by every read path
+	got, err := repo.GetByShort(ctx, "team")
+	require.NoError(t, err)
+	got.URL = "https://evil.example.com"
+	got.AllowedUsers[0] = "mallory"
+	assertStored(t, repo)
+
+	lists := map[string]func() ([]*models.Link, error){
+		"GetAll":           func() ([]*models.Link, error) { return repo.GetAll(ctx) },
+		"GetByUser":        func() ([]*models.Link, error) { return repo.GetByUser(ctx, "user1") },
+		"GetByAccessLevel": func() ([]*models.Link, error) { return repo.GetByAccessLevel(ctx, models.AccessLevels.Restricted) },
+	}
+	for method, list := range lists {
+		links, err := list()
+		require.NoError(t, err, method)
+		require.Len(t, links, 1, method)
+		links[0].ClickCount = 1000
+		links[0].AllowedUsers = append(links[0].AllowedUsers[:0], "mallory")
+		assertStored(t, repo)
+	}
+
+	// Mutating a link after passing it to Update
+	got, err = repo.GetByShort(ctx, "team")
+	require.NoError(t, err)
+	got.ExpiresAt = time.Now().Add(time.Hour)
+	require.NoError(t, repo.Update(ctx, got))
+	got.AllowedUsers[0] = "mallory"
+	assertStored(t, repo)
+}
+
+// assertStored verifies the stored "team" link still has its original values
+func assertStored(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	t.Helper()
+	stored, err := repo.GetByShort(context.Background(), "team")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", stored.URL)
+	assert.Equal(t, []string{"user2"}, stored.AllowedUsers)
+	assert.Equal(t, 0, stored.ClickCount)
+}
+
+// testSoftDelete checks the trash lifecycle: deleted links disappear from
+// reads, keep their short code and come back unchanged when restored.
+func testSoftDelete(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, newLink("team", "https://example.com", "user1")))
+	require.NoError(t, repo.Create(ctx, newLink("other", "https://example.org", "user1")))
+
+	require.NoError(t, repo.Delete(ctx, "team"))
+	assert.Error(t, repo.Delete(ctx, "team"), "already in the trash")
+
+	_, err := repo.GetByShort(ctx, "team")
+	assert.Error(t, err)
+	all, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+	byUser, err := repo.GetByUser(ctx, "user1")
+	require.NoError(t, err)
+	assert.Len(t, byUser, 1)
+	assert.Error(t, repo.Create(ctx, newLink("team", "https://example.net", "user2")),
+		"trashed links keep their short code")
+
+	trash, err := repo.GetDeleted(ctx)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, "team", trash[0].Short)
+	assert.True(t, trash[0].IsDeleted())
+
+	_, err = repo.GetDeletedByShort(ctx, "other")
+	assert.Error(t, err, "live links are not in the trash")
+	assert.Error(t, repo.Restore(ctx, "other"))
+
+	require.NoError(t, repo.Restore(ctx, "team"))
+	restored, err := repo.GetByShort(ctx, "team")
+	require.NoError(t, err)
+	assert.False(t, restored.IsDeleted())
+	assert.Equal(t, "https://example.com", restored.URL)
+
+	require.NoError(t, repo.Purge(ctx, "team"))
+	_, err = repo.GetByShort(ctx, "team")
+	assert.Error(t, err)
+	_, err = repo.GetDeletedByShort(ctx, "team")
+	assert.Error(t, err)
+}
+
+// testClickLimit checks that concurrent clicks never push a link past its
+// click limit
+func testClickLimit(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	link := newLink("once", "https://example.com", "user1")
+	link.MaxClicks = 3
+	require.NoError(t, repo.Create(ctx, link))
+
+	var wg sync.WaitGroup
+	var counted, refused atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.IncrementClickCount(ctx, "once")
+			switch {
+			case err == nil:
+				counted.Add(1)
+			case errors.Is(err, errors.ErrGone):
+				refused.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(3), counted.Load())
+	assert.Equal(t, int32(17), refused.Load())
+	stored, err := repo.GetByShort(ctx, "once")
+	require.NoError(t, err)
+	assert.Equal(t, 3, stored.ClickCount)
+	assert.True(t, stored.ClickLimitReached())
+	assert.True(t, errors.Is(repo.IncrementClickCount(ctx, "missing"), errors.ErrNotFound))
+}
+
+// testGetByNamespace checks that only live links below the namespace are found
+func testGetByNamespace(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	for _, short := range []string{"team", "team/docs", "team/infra/oncall", "teams/docs", "team/trashed"} {
+		require.NoError(t, repo.Create(ctx, newLink(short, "https://example.com", "user1")))
+	}
+	require.NoError(t, repo.Delete(ctx, "team/trashed"))
+
+	links, err := repo.GetByNamespace(ctx, "team")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"team/docs", "team/infra/oncall"}, shortsOf(links))
+}
+
+// testGetByURL checks that only live links to exactly the URL are found
+func testGetByURL(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, newLink("docs", "https://docs.example.com", "user1")))
+	require.NoError(t, repo.Create(ctx, newLink("documentation", "https://docs.example.com", "user2")))
+	require.NoError(t, repo.Create(ctx, newLink("docs-old", "https://docs.example.com", "user1")))
+	require.NoError(t, repo.Create(ctx, newLink("wiki", "https://docs.example.com/wiki", "user1")))
+	require.NoError(t, repo.Delete(ctx, "docs-old"))
+
+	links, err := repo.GetByURL(ctx, "https://docs.example.com")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"docs", "documentation"}, shortsOf(links))
+}
+
+// testRename checks that renamed links keep their ID and statistics
+func testRename(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	link := newLink("docs", "https://docs.example.com", "user1")
+	link.ID = models.NewLinkID()
+	require.NoError(t, repo.Create(ctx, link))
+	require.NoError(t, repo.Create(ctx, newLink("wiki", "https://wiki.example.com", "user1")))
+	require.NoError(t, repo.UpdateLinkStats(ctx, "docs", func(stats *models.LinkStats) {
+		stats.RecordClickAt(time.Now().UTC(), "", "", "", "", "")
+	}))
+
+	_, err := repo.Rename(ctx, "docs", "wiki")
+	assert.True(t, errors.Is(err, errors.ErrAlreadyExists))
+	_, err = repo.Rename(ctx, "missing", "other")
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+
+	renamed, err := repo.Rename(ctx, "docs", "documentation")
+	require.NoError(t, err)
+	assert.Equal(t, link.ID, renamed.ID)
+	assert.Equal(t, "documentation", renamed.Short)
+
+	_, err = repo.GetByShort(ctx, "docs")
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+	stored, err := repo.GetByShort(ctx, "documentation")
+	require.NoError(t, err)
+	assert.Equal(t, link.ID, stored.ID)
+	stats, err := repo.GetLinkStats(ctx, "documentation")
+	require.NoError(t, err)
+	assert.Equal(t, "documentation", stats.Short)
+	assert.Len(t, stats.ClicksByDate, 1)
+}
+
+// testStats checks that statistics accumulate updates, report the link's
+// clicks and go with the link when it is purged
+func testStats(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, newLink("team", "https://example.com", "user1")))
+
+	stats, err := repo.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	assert.Zero(t, stats.TotalClicks)
+	assert.Empty(t, stats.ClicksByDate)
+
+	record := func(stats *models.LinkStats) { stats.RecordClick("Firefox", "Linux", "JP", "github.com", "desktop") }
+	require.NoError(t, repo.IncrementClickCount(ctx, "team"))
+	require.NoError(t, repo.UpdateLinkStats(ctx, "team", record))
+	require.NoError(t, repo.IncrementClickCount(ctx, "team"))
+	require.NoError(t, repo.UpdateLinkStats(ctx, "team", record))
+
+	stats, err = repo.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.TotalClicks)
+	assert.Equal(t, map[string]int{"Firefox": 2}, stats.Browsers)
+	assert.Equal(t, map[string]int{"github.com": 2}, stats.ReferringSites)
+	clicked, err := repo.GetByShort(ctx, "team")
+	require.NoError(t, err)
+	assert.Equal(t, 2, clicked.ClickCount)
+	assert.False(t, clicked.LastClickedAt.IsZero())
+
+	assert.True(t, errors.Is(repo.UpdateLinkStats(ctx, "missing", record), errors.ErrNotFound))
+
+	require.NoError(t, repo.Purge(ctx, "team"))
+	_, err = repo.GetLinkStats(ctx, "team")
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+	require.NoError(t, repo.Create(ctx, newLink("team", "https://example.com", "user1")))
+	stats, err = repo.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	assert.Empty(t, stats.Browsers, "a link created again starts without statistics")
+}
+
+// testExpiry checks that links past their expiry are found until flagged,
+// and that reading one flags it
+func testExpiry(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	full := withExpiry(t, repo)
+	ctx := context.Background()
+	expired := newLink("old", "https://example.com", "user1")
+	expired.ExpiresAt = time.Now().Add(-time.Hour)
+	require.NoError(t, full.Create(ctx, expired))
+	current := newLink("new", "https://example.com", "user1")
+	current.ExpiresAt = time.Now().Add(time.Hour)
+	require.NoError(t, full.Create(ctx, current))
+	require.NoError(t, full.Create(ctx, newLink("forever", "https://example.com", "user1")))
+
+	links, err := full.GetExpiredLinks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old"}, shortsOf(links))
+
+	_, err = full.GetByShort(ctx, "old")
+	require.NoError(t, err)
+	links, err = full.GetLinksByExpiryStatus(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old"}, shortsOf(links), "reading an expired link flags it")
+	links, err = full.GetExpiredLinks(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+// testCompactStats checks that statistics are only compacted once archived,
+// and only while they have daily clicks
+func testCompactStats(t *testing.T, repo interfaces.LinkRepositoryInterface) {
+	full := withExpiry(t, repo)
+	ctx := context.Background()
+	require.NoError(t, full.Create(ctx, newLink("team", "https://example.com", "user1")))
+	require.NoError(t, full.UpdateLinkStats(ctx, "team", func(stats *models.LinkStats) {
+		stats.RecordClickAt(time.Now().UTC(), "", "", "", "", "")
+	}))
+
+	failing := func(ctx context.Context, stats *models.LinkStats) (string, error) {
+		return "", fmt.Errorf("bucket not found")
+	}
+	_, err := full.CompactLinkStats(ctx, "team", time.Now(), failing)
+	require.Error(t, err)
+	stats, err := full.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	assert.True(t, stats.CompactedAt.IsZero(), "stats are only compacted once archived")
+
+	archived := 0
+	archive := func(ctx context.Context, stats *models.LinkStats) (string, error) {
+		archived++
+		return "gs://archive/team.json", nil
+	}
+	at := time.Now().UTC()
+	stats, err = full.CompactLinkStats(ctx, "team", at, archive)
+	require.NoError(t, err)
+	assert.Equal(t, models.LinkStatsStatusCompacted, stats.Status)
+	assert.Equal(t, "gs://archive/team.json", stats.ArchiveURI)
+	assert.Empty(t, stats.ClicksByDate)
+
+	// Compacted stats without new daily clicks are left alone
+	stats, err = full.CompactLinkStats(ctx, "team", at.Add(time.Hour), archive)
+	require.NoError(t, err)
+	assert.True(t, stats.CompactedAt.Equal(at))
+	assert.Equal(t, 1, archived)
+	stored, err := full.GetLinkStats(ctx, "team")
+	require.NoError(t, err)
+	assert.Equal(t, "gs://archive/team.json", stored.ArchiveURI)
+}
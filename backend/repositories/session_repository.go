@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SessionRepository stores sessions in Firestore
+type SessionRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure SessionRepository implements SessionStore
+var _ interfaces.SessionStore = (*SessionRepository)(nil)
+
+// NewSessionRepository creates a new SessionRepository
+func NewSessionRepository(client *firestore.Client) *SessionRepository {
+	return &SessionRepository{
+		client:     client,
+		collection: "sessions",
+	}
+}
+
+// Create stores a new session
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	_, err := r.client.Collection(r.collection).Doc(session.ID).Set(ctx, session)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error creating session: %w", err))
+	}
+	return nil
+}
+
+// Get retrieves a session by its ID
+func (r *SessionRepository) Get(ctx context.Context, id string) (*models.Session, error) {
+	doc, err := r.client.Collection(r.collection).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, errors.NewNotFound(fmt.Sprintf("Session '%s' not found", id))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving session: %w", err))
+	}
+
+	var session models.Session
+	if err := doc.DataTo(&session); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error converting session data: %w", err))
+	}
+
+	return &session, nil
+}
+
+// ListByUser retrieves all sessions belonging to a user
+func (r *SessionRepository) ListByUser(ctx context.Context, userID string) ([]*models.Session, error) {
+	iter := r.client.Collection(r.collection).Where("user_id", "==", userID).Documents(ctx)
+	var sessions []*models.Session
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving sessions: %w", err))
+		}
+
+		var session models.Session
+		if err := doc.DataTo(&session); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, nil
+}
+
+// Revoke marks a session as revoked
+func (r *SessionRepository) Revoke(ctx context.Context, id string) error {
+	_, err := r.client.Collection(r.collection).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "revoked_at", Value: time.Now()},
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return errors.NewNotFound(fmt.Sprintf("Session '%s' not found", id))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error revoking session: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,649 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/logger"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/linkcap"
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteLinkRepository stores links and their statistics in a local SQLite
+// file, so a single server needs no database service. The tables mirror
+// those of PostgresLinkRepository (see migrations/sqlite).
+type SQLiteLinkRepository struct {
+	db *sql.DB
+}
+
+// Ensure SQLiteLinkRepository implements both repository interfaces
+var (
+	_ interfaces.LinkRepositoryInterface = (*SQLiteLinkRepository)(nil)
+	_ LinkRepositoryInterface            = (*SQLiteLinkRepository)(nil)
+)
+
+// NewSQLiteLinkRepository creates a link repository in a database opened
+// with OpenSQLite
+func NewSQLiteLinkRepository(db *sql.DB) *SQLiteLinkRepository {
+	return &SQLiteLinkRepository{db: db}
+}
+
+// sqliteLinkValues returns the column values of a link, in the order of linkColumns
+func sqliteLinkValues(link *models.Link) ([]any, error) {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+	tags := link.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	encodedTags, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	return []any{
+		link.Short, link.ID, link.URL, link.CreatedBy, link.AccessLevel, string(encodedTags), link.ClickCount, link.MaxClicks,
+		sqliteTime(link.LastClickedAt), link.PopularityScore, sqliteTime(link.ScoredAt), link.ScoredClicks,
+		sqliteTime(link.ExpiresAt), link.IsExpired, link.CreatedAt.UnixNano(), link.UpdatedAt.UnixNano(),
+		sqliteTime(link.DeletedAt), string(data),
+	}, nil
+}
+
+// scanSQLiteLink reads a link row selected with linkColumns
+func scanSQLiteLink(row interface{ Scan(...any) error }) (*models.Link, error) {
+	var (
+		link                                          models.Link
+		short, id, url, createdBy, accessLevel, tags  string
+		clickCount, maxClicks, scoredClicks           int
+		popularityScore                               float64
+		lastClickedAt, scoredAt, expiresAt, deletedAt sql.NullInt64
+		isExpired                                     bool
+		createdAt, updatedAt                          int64
+		data                                          string
+	)
+	if err := row.Scan(&short, &id, &url, &createdBy, &accessLevel, &tags, &clickCount, &maxClicks,
+		&lastClickedAt, &popularityScore, &scoredAt, &scoredClicks, &expiresAt, &isExpired,
+		&createdAt, &updatedAt, &deletedAt, &data); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &link); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tags), &link.Tags); err != nil {
+		return nil, err
+	}
+
+	// The columns are kept up to date by statements that leave data alone
+	link.Short, link.ID, link.URL, link.CreatedBy, link.AccessLevel = short, id, url, createdBy, accessLevel
+	link.ClickCount, link.MaxClicks, link.ScoredClicks = clickCount, maxClicks, scoredClicks
+	link.PopularityScore, link.IsExpired = popularityScore, isExpired
+	link.LastClickedAt, link.ScoredAt = sqliteTimeValue(lastClickedAt), sqliteTimeValue(scoredAt)
+	link.ExpiresAt, link.DeletedAt = sqliteTimeValue(expiresAt), sqliteTimeValue(deletedAt)
+	link.CreatedAt, link.UpdatedAt = time.Unix(0, createdAt).UTC(), time.Unix(0, updatedAt).UTC()
+	link.SchemaVersion = models.LinkSchemaVersion
+	if link.AllowedUsers == nil {
+		link.AllowedUsers = []string{}
+	}
+	return &link, nil
+}
+
+// sqliteTime stores a time as Unix nanoseconds and the zero time as NULL
+func sqliteTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+// sqliteTimeValue reads NULL as the zero time
+func sqliteTimeValue(t sql.NullInt64) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, t.Int64).UTC()
+}
+
+// isSQLiteUniqueViolation reports whether err is a unique constraint violation
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// Create adds a new link
+func (r *SQLiteLinkRepository) Create(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("create", time.Now(), &err)
+	if link.ID == "" {
+		link.ID = models.NewLinkID()
+	}
+	now := time.Now()
+	link.CreatedAt = now
+	link.UpdatedAt = now
+	link.SchemaVersion = models.LinkSchemaVersion
+
+	values, err := sqliteLinkValues(link)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error encoding link: %w", err))
+	}
+	result, err := r.db.ExecContext(ctx, `INSERT INTO links (`+linkColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (short) DO NOTHING`, values...)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error creating link: %w", err))
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	// A trashed link keeps its short code until purged
+	var deletedAt sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, "SELECT deleted_at FROM links WHERE short = ?", link.Short).Scan(&deletedAt); err == nil && deletedAt.Valid {
+		return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' is in the trash; restore it or wait until it is purged", link.Short))
+	}
+	return errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", link.Short))
+}
+
+// GetByShort retrieves a link by its short code. Links in the trash are not
+// found. A link found past its expiry is flagged expired.
+func (r *SQLiteLinkRepository) GetByShort(ctx context.Context, short string) (_ *models.Link, err error) {
+	defer observeOperation("get_by_short", time.Now(), &err)
+	link, err := scanSQLiteLink(r.db.QueryRowContext(ctx, "SELECT "+linkColumns+" FROM links WHERE short = ? AND deleted_at IS NULL", short))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link: %w", err))
+	}
+
+	if link.IsLinkExpired() && !link.IsExpired {
+		link.IsExpired = true
+		link.UpdatedAt = time.Now()
+		if _, err := r.db.ExecContext(ctx, "UPDATE links SET is_expired = 1, updated_at = ? WHERE id = ?",
+			link.UpdatedAt.UnixNano(), link.ID); err != nil {
+			repoLog.Warn("Failed to mark link expired", logger.Fields{"short": short, "error": err.Error()})
+		}
+	}
+	return link, nil
+}
+
+// GetByShorts retrieves links by their short codes in one query, passing
+// them as a JSON array rather than one parameter each, of which SQLite
+// accepts a limited number
+func (r *SQLiteLinkRepository) GetByShorts(ctx context.Context, shorts []string) (_ map[string]*models.Link, err error) {
+	defer observeOperation("get_by_shorts", time.Now(), &err)
+	encoded, err := json.Marshal(shorts)
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error encoding short codes: %w", err))
+	}
+	links, err := r.query(ctx, "SELECT "+linkColumns+` FROM links
+		WHERE short IN (SELECT value FROM json_each(?)) AND deleted_at IS NULL`, string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	return linksByShort(links), nil
+}
+
+// List retrieves the links a query selects. The database filters the links
+// by column and orders them; access and archival, which are only kept in
+// data, are checked as the rows stream in, until enough were found.
+func (r *SQLiteLinkRepository) List(ctx context.Context, query models.LinkQuery) (_ []*models.Link, err error) {
+	defer observeOperation("list", time.Now(), &err)
+	where, args := []string{"deleted_at IS NULL"}, []any{}
+	filter := func(condition string, arg any) {
+		where = append(where, condition)
+		args = append(args, arg)
+	}
+	if query.CreatedBy != "" {
+		filter("created_by = ?", query.CreatedBy)
+	}
+	if query.AccessLevel != "" {
+		filter("access_level = ?", query.AccessLevel)
+	}
+	if query.Tag != "" {
+		filter("EXISTS (SELECT 1 FROM json_each(links.tags) WHERE json_each.value = ?)", models.NormalizeTag(query.Tag))
+	}
+	if query.Expired != nil {
+		filter("is_expired = ?", *query.Expired)
+	}
+	links, err := r.queryMatching(ctx, query.Matches, listLimit(ctx, query.Limit), "SELECT "+linkColumns+
+		" FROM links WHERE "+strings.Join(where, " AND ")+" ORDER BY "+linkOrderClauses[query.OrderBy], args...)
+	if err != nil {
+		return nil, err
+	}
+	return linkcap.Apply(ctx, links), nil
+}
+
+// GetAll retrieves all links outside the trash, up to the cap of ctx
+func (r *SQLiteLinkRepository) GetAll(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_all", time.Now(), &err)
+	// One link past the cap tells whether links were left out
+	query := "SELECT " + linkColumns + " FROM links WHERE deleted_at IS NULL ORDER BY short"
+	args := []any{}
+	if limit := linkcap.Max(ctx); limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+	links, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return linkcap.Apply(ctx, links), nil
+}
+
+// Update updates an existing link, keeping its ID
+func (r *SQLiteLinkRepository) Update(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("update", time.Now(), &err)
+	link.UpdatedAt = time.Now()
+	link.SchemaVersion = models.LinkSchemaVersion
+	values, err := sqliteLinkValues(link)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error encoding link: %w", err))
+	}
+	// The link keeps the ID of its row; everything else is overwritten
+	values = append(values[2:], values[0])
+	err = r.db.QueryRowContext(ctx, `UPDATE links SET url = ?, created_by = ?, access_level = ?, tags = ?,
+			click_count = ?, max_clicks = ?, last_clicked_at = ?, popularity_score = ?, scored_at = ?,
+			scored_clicks = ?, expires_at = ?, is_expired = ?, created_at = ?, updated_at = ?, deleted_at = ?, data = ?
+		WHERE short = ? AND deleted_at IS NULL
+		RETURNING id`, values...).Scan(&link.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error updating link: %w", err))
+	}
+	return nil
+}
+
+// Delete moves a link to the trash by its short code
+func (r *SQLiteLinkRepository) Delete(ctx context.Context, short string) (err error) {
+	defer observeOperation("delete", time.Now(), &err)
+	now := time.Now().UnixNano()
+	result, err := r.db.ExecContext(ctx, "UPDATE links SET deleted_at = ?, updated_at = ? WHERE short = ? AND deleted_at IS NULL",
+		now, now, short)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error deleting link: %w", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	return nil
+}
+
+// GetDeleted retrieves all links in the trash
+func (r *SQLiteLinkRepository) GetDeleted(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_deleted", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE deleted_at IS NOT NULL ORDER BY short")
+}
+
+// GetDeletedByShort retrieves a link in the trash by its short code
+func (r *SQLiteLinkRepository) GetDeletedByShort(ctx context.Context, short string) (_ *models.Link, err error) {
+	defer observeOperation("get_deleted_by_short", time.Now(), &err)
+	link, err := scanSQLiteLink(r.db.QueryRowContext(ctx, "SELECT "+linkColumns+" FROM links WHERE short = ? AND deleted_at IS NOT NULL", short))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving deleted link: %w", err))
+	}
+	return link, nil
+}
+
+// Restore moves a link out of the trash
+func (r *SQLiteLinkRepository) Restore(ctx context.Context, short string) (err error) {
+	defer observeOperation("restore", time.Now(), &err)
+	result, err := r.db.ExecContext(ctx, "UPDATE links SET deleted_at = NULL, updated_at = ? WHERE short = ? AND deleted_at IS NOT NULL",
+		time.Now().UnixNano(), short)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error restoring link: %w", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' is not in the trash", short))
+	}
+	return nil
+}
+
+// Purge permanently removes a link and, with it, its statistics
+func (r *SQLiteLinkRepository) Purge(ctx context.Context, short string) (err error) {
+	defer observeOperation("purge", time.Now(), &err)
+	result, err := r.db.ExecContext(ctx, "DELETE FROM links WHERE short = ?", short)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error purging link: %w", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	}
+	return nil
+}
+
+// Rename changes a link's short code. Its ID, and so its statistics, stay.
+func (r *SQLiteLinkRepository) Rename(ctx context.Context, short, newShort string) (_ *models.Link, err error) {
+	defer observeOperation("rename", time.Now(), &err)
+	link, err := scanSQLiteLink(r.db.QueryRowContext(ctx, `UPDATE links SET short = ?, updated_at = ?
+		WHERE short = ? AND deleted_at IS NULL RETURNING `+linkColumns, newShort, time.Now().UnixNano(), short))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		case isSQLiteUniqueViolation(err):
+			return nil, errors.NewAlreadyExists(fmt.Sprintf("Link '%s' already exists", newShort))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error renaming link: %w", err))
+	}
+	return link, nil
+}
+
+// IncrementClickCount counts a click on a link in one statement, which
+// also enforces the link's click limit
+func (r *SQLiteLinkRepository) IncrementClickCount(ctx context.Context, short string) (err error) {
+	defer observeOperation("increment_click_count", time.Now(), &err)
+	now := time.Now().UnixNano()
+	result, err := r.db.ExecContext(ctx, `UPDATE links SET click_count = click_count + 1, updated_at = ?, last_clicked_at = ?
+		WHERE short = ? AND deleted_at IS NULL AND (max_clicks = 0 OR click_count < max_clicks)`, now, now, short)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error updating click count: %w", err))
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	// Tell a missing link from one that reached its click limit
+	var limited bool
+	err = r.db.QueryRowContext(ctx, "SELECT max_clicks > 0 FROM links WHERE short = ? AND deleted_at IS NULL", short).Scan(&limited)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+	case err != nil:
+		return errors.NewInternalError(fmt.Errorf("Error updating click count: %w", err))
+	case limited:
+		return errors.NewGone(fmt.Sprintf("Link '%s' has reached its click limit", short))
+	}
+	return nil
+}
+
+// RecordRolloutClick counts a click on one variant of the link's rollout
+func (r *SQLiteLinkRepository) RecordRolloutClick(ctx context.Context, short, variant string) (err error) {
+	defer observeOperation("record_rollout_click", time.Now(), &err)
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		link, err := scanSQLiteLink(tx.QueryRowContext(ctx, "SELECT "+linkColumns+" FROM links WHERE short = ? AND deleted_at IS NULL", short))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+			}
+			return err
+		}
+		if link.Rollout == nil {
+			return nil
+		}
+		if variant == models.RolloutVariants.Canary {
+			link.Rollout.CanaryClicks++
+		} else {
+			link.Rollout.PrimaryClicks++
+		}
+		data, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE links SET data = ? WHERE id = ?", string(data), link.ID)
+		return err
+	})
+	return internalError(err, "Error recording rollout click")
+}
+
+// UpdatePopularity stores the link's popularity score fields. Only those
+// columns are written, so the periodic scoring job cannot undo a concurrent edit.
+func (r *SQLiteLinkRepository) UpdatePopularity(ctx context.Context, link *models.Link) (err error) {
+	defer observeOperation("update_popularity", time.Now(), &err)
+	result, err := r.db.ExecContext(ctx, "UPDATE links SET popularity_score = ?, scored_at = ?, scored_clicks = ? WHERE short = ?",
+		link.PopularityScore, sqliteTime(link.ScoredAt), link.ScoredClicks, link.Short)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error updating popularity score: %w", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", link.Short))
+	}
+	return nil
+}
+
+// GetByAccessLevel retrieves links by access level
+func (r *SQLiteLinkRepository) GetByAccessLevel(ctx context.Context, accessLevel string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_access_level", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE access_level = ? AND deleted_at IS NULL ORDER BY short", accessLevel)
+}
+
+// GetByUser retrieves links created by a specific user
+func (r *SQLiteLinkRepository) GetByUser(ctx context.Context, userID string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_user", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE created_by = ? AND deleted_at IS NULL ORDER BY short", userID)
+}
+
+// Ping checks that the database answers
+func (r *SQLiteLinkRepository) Ping(ctx context.Context) (err error) {
+	defer observeOperation("ping", time.Now(), &err)
+	return r.db.PingContext(ctx)
+}
+
+// CountAll counts the links outside the trash
+func (r *SQLiteLinkRepository) CountAll(ctx context.Context) (_ int, err error) {
+	defer observeOperation("count_all", time.Now(), &err)
+	return r.count(ctx, "SELECT count(*) FROM links WHERE deleted_at IS NULL")
+}
+
+// CountByUser counts the links outside the trash created by a user
+func (r *SQLiteLinkRepository) CountByUser(ctx context.Context, userID string) (_ int, err error) {
+	defer observeOperation("count_by_user", time.Now(), &err)
+	return r.count(ctx, "SELECT count(*) FROM links WHERE created_by = ? AND deleted_at IS NULL", userID)
+}
+
+// CountByAccessLevel counts the links outside the trash with an access level
+func (r *SQLiteLinkRepository) CountByAccessLevel(ctx context.Context, accessLevel string) (_ int, err error) {
+	defer observeOperation("count_by_access_level", time.Now(), &err)
+	return r.count(ctx, "SELECT count(*) FROM links WHERE access_level = ? AND deleted_at IS NULL", accessLevel)
+}
+
+// count runs a query counting links
+func (r *SQLiteLinkRepository) count(ctx context.Context, query string, args ...any) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, errors.NewInternalError(fmt.Errorf("Error counting links: %w", err))
+	}
+	return count, nil
+}
+
+// GetByTag retrieves links carrying a tag
+func (r *SQLiteLinkRepository) GetByTag(ctx context.Context, tag string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_tag", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+` FROM links
+		WHERE EXISTS (SELECT 1 FROM json_each(links.tags) WHERE json_each.value = ?) AND deleted_at IS NULL ORDER BY short`, tag)
+}
+
+// GetByURL retrieves links pointing at exactly the given destination
+func (r *SQLiteLinkRepository) GetByURL(ctx context.Context, url string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_url", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE url = ? AND deleted_at IS NULL ORDER BY short", url)
+}
+
+// GetByNamespace retrieves links whose short codes lie below a namespace
+func (r *SQLiteLinkRepository) GetByNamespace(ctx context.Context, namespace string) (_ []*models.Link, err error) {
+	defer observeOperation("get_by_namespace", time.Now(), &err)
+	// substr compares bytes, unlike LIKE, which ignores the case of ASCII letters
+	prefix := namespace + "/"
+	return r.query(ctx, "SELECT "+linkColumns+` FROM links
+		WHERE substr(short, 1, length(?)) = ? AND deleted_at IS NULL ORDER BY short`, prefix, prefix)
+}
+
+// CheckAccess determines if a user has access to a link
+func (r *SQLiteLinkRepository) CheckAccess(ctx context.Context, short string, userID string) (bool, error) {
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return false, err
+	}
+	return link.CanAccessAs(userID, groups.FromContext(ctx)), nil
+}
+
+// GetExpiredLinks retrieves links that are past their expiry but not yet flagged
+func (r *SQLiteLinkRepository) GetExpiredLinks(ctx context.Context) (_ []*models.Link, err error) {
+	defer observeOperation("get_expired_links", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+` FROM links
+		WHERE expires_at < ? AND NOT is_expired AND deleted_at IS NULL ORDER BY short`, time.Now().UnixNano())
+}
+
+// GetLinksByExpiryStatus retrieves links by their expiry status
+func (r *SQLiteLinkRepository) GetLinksByExpiryStatus(ctx context.Context, isExpired bool) (_ []*models.Link, err error) {
+	defer observeOperation("get_links_by_expiry_status", time.Now(), &err)
+	return r.query(ctx, "SELECT "+linkColumns+" FROM links WHERE is_expired = ? AND deleted_at IS NULL ORDER BY short", isExpired)
+}
+
+// GetLinkStats retrieves statistics for a link
+func (r *SQLiteLinkRepository) GetLinkStats(ctx context.Context, short string) (_ *models.LinkStats, err error) {
+	defer observeOperation("get_link_stats", time.Now(), &err)
+	link, err := r.GetByShort(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err = r.db.QueryRowContext(ctx, "SELECT data FROM link_stats WHERE link_id = ?", link.ID).Scan(&data)
+	var stats *models.LinkStats
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		stats = models.NewLinkStats(short)
+	case err != nil:
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving link stats: %w", err))
+	default:
+		if stats, err = decodeJSONStats(data, short); err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error converting link stats data: %w", err))
+		}
+	}
+
+	// Update total clicks from link
+	stats.TotalClicks = link.ClickCount
+	return stats, nil
+}
+
+// UpdateLinkStats applies update to a link's statistics in a transaction,
+// creating them on the first update
+func (r *SQLiteLinkRepository) UpdateLinkStats(ctx context.Context, short string, update func(*models.LinkStats)) (err error) {
+	defer observeOperation("update_link_stats", time.Now(), &err)
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		stats, id, err := readSQLiteStats(ctx, tx, short, true)
+		if err != nil {
+			return err
+		}
+		update(stats)
+		return saveSQLiteStats(ctx, tx, id, stats)
+	})
+	return internalError(err, "Error updating link stats")
+}
+
+// CompactLinkStats folds a link's daily clicks into yearly totals in a
+// transaction, so clicks recorded while the job runs wait for it
+func (r *SQLiteLinkRepository) CompactLinkStats(ctx context.Context, short string, at time.Time, archive StatsArchiveFunc) (_ *models.LinkStats, err error) {
+	defer observeOperation("compact_link_stats", time.Now(), &err)
+	var result *models.LinkStats
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		stats, id, err := readSQLiteStats(ctx, tx, short, false)
+		if err != nil {
+			return err
+		}
+		compacted := stats.Clone()
+		if ok, err := compactStats(ctx, compacted, at, archive); err != nil || !ok {
+			result = stats
+			return err
+		}
+		result = compacted
+		return saveSQLiteStats(ctx, tx, id, compacted)
+	})
+	if err != nil {
+		return result, internalError(err, "Error compacting link stats")
+	}
+	return result, nil
+}
+
+// inTx runs fn in a transaction. Transactions begin immediately (see
+// OpenSQLite), so they hold the write lock from their first read.
+func (r *SQLiteLinkRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// readSQLiteStats reads a link's statistics in tx, with the link's ID.
+// Missing statistics are created when create is set and not found otherwise.
+func readSQLiteStats(ctx context.Context, tx *sql.Tx, short string, create bool) (*models.LinkStats, string, error) {
+	var id string
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM links WHERE short = ?", short).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
+		}
+		return nil, "", err
+	}
+
+	var data []byte
+	err := tx.QueryRowContext(ctx, "SELECT data FROM link_stats WHERE link_id = ?", id).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && create:
+		return models.NewLinkStats(short), id, nil
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, "", errors.NewNotFound(fmt.Sprintf("Stats of link '%s' not found", short))
+	case err != nil:
+		return nil, "", err
+	}
+	stats, err := decodeJSONStats(data, short)
+	return stats, id, err
+}
+
+// saveSQLiteStats writes a link's statistics in tx
+func saveSQLiteStats(ctx context.Context, tx *sql.Tx, id string, stats *models.LinkStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO link_stats (link_id, data) VALUES (?, ?)
+		ON CONFLICT (link_id) DO UPDATE SET data = excluded.data`, id, string(data))
+	return err
+}
+
+// query retrieves the links of a query selecting linkColumns
+func (r *SQLiteLinkRepository) query(ctx context.Context, query string, args ...any) ([]*models.Link, error) {
+	return r.queryMatching(ctx, func(*models.Link) bool { return true }, 0, query, args...)
+}
+
+// queryMatching runs a query of links, keeping those that match until it
+// has limit links, or reading every row when limit is zero
+func (r *SQLiteLinkRepository) queryMatching(ctx context.Context, match func(*models.Link) bool, limit int, query string, args ...any) ([]*models.Link, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+	defer rows.Close()
+
+	var links []*models.Link
+	for (limit == 0 || len(links) < limit) && rows.Next() {
+		link, err := scanSQLiteLink(rows)
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error decoding link: %w", err))
+		}
+		if match(link) {
+			links = append(links, link)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving links: %w", err))
+	}
+	return links, nil
+}
@@ -0,0 +1,36 @@
+package repositories_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQLiteTestRepository returns a repository on a new database file
+func newSQLiteTestRepository(t *testing.T) *repositories.SQLiteLinkRepository {
+	t.Helper()
+	db, err := repositories.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "golink.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return repositories.NewSQLiteLinkRepository(db)
+}
+
+func TestOpenSQLiteReopens(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "golink.db")
+	db, err := repositories.OpenSQLite(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, repositories.NewSQLiteLinkRepository(db).Create(ctx, createTestLink("docs", "https://docs.example.com", "user1")))
+	require.NoError(t, db.Close())
+
+	db, err = repositories.OpenSQLite(ctx, path)
+	require.NoError(t, err, "migrations are applied once")
+	defer db.Close()
+	link, err := repositories.NewSQLiteLinkRepository(db).GetByShort(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, "https://docs.example.com", link.URL)
+}
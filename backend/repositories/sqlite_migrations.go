@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Okabe-Junya/golink-backend/logger"
+	// Registers the "sqlite3" driver of database/sql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteMigrationFiles are the schema migrations of the SQLite storage,
+// named <version>_<name>.sql and applied in version order. The database's
+// user_version is the version of the last migration applied.
+//
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrationFiles embed.FS
+
+// OpenSQLite opens the SQLite database at path, creating it when missing,
+// and applies its pending schema migrations. The database allows one writer
+// at a time; writers wait for each other instead of failing.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on&_txlock=immediate"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrateSQLite applies the pending migrations, each in its own transaction
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	files, err := fs.Glob(sqliteMigrationFiles, "migrations/sqlite/*.sql")
+	if err != nil {
+		return err
+	}
+	type migration struct {
+		name    string
+		version int
+	}
+	migrations := make([]migration, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("migration %s has no version prefix", file)
+		}
+		migrations = append(migrations, migration{name: name, version: version})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	for _, m := range migrations {
+		script, err := sqliteMigrationFiles.ReadFile("migrations/sqlite/" + m.name + ".sql")
+		if err != nil {
+			return err
+		}
+		applied, err := applySQLiteMigration(ctx, db, m.version, string(script))
+		if err != nil {
+			return fmt.Errorf("applying migration %s: %w", m.name, err)
+		}
+		if applied {
+			repoLog.Info("Applied SQLite migration", logger.Fields{"version": m.version, "name": m.name})
+		}
+	}
+	return nil
+}
+
+// applySQLiteMigration applies a migration unless the database is at its
+// version already, reporting whether it applied it
+func applySQLiteMigration(ctx context.Context, db *sql.DB, version int, script string) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current int
+	if err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&current); err != nil {
+		return false, err
+	}
+	if current >= version {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
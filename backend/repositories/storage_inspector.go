@@ -0,0 +1,181 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/pkg/storagestats"
+	"google.golang.org/api/iterator"
+)
+
+// storageCollections are the collections inspected for storage statistics,
+// mapped to the field naming the link each document belongs to. Statistics
+// are keyed by the link's short code instead, and sessions belong to none.
+var storageCollections = map[string]string{
+	"links":            "",
+	"link_shorts":      "short",
+	"link_stats":       "",
+	"link_versions":    "short",
+	"link_snapshots":   "short",
+	"link_aliases":     "short",
+	"link_references":  "short",
+	"user_favorites":   "short",
+	"user_link_clicks": "short",
+	"sessions":         "",
+}
+
+// largestCollections are the collections whose documents grow with use, and
+// whose largest documents are reported
+var largestCollections = map[string]bool{
+	"link_stats": true,
+}
+
+// FirestoreStorageInspector computes storage statistics of the Firestore
+// collections by reading every document in them
+type FirestoreStorageInspector struct {
+	client *firestore.Client
+}
+
+// Ensure FirestoreStorageInspector implements Inspector
+var _ storagestats.Inspector = (*FirestoreStorageInspector)(nil)
+
+// NewFirestoreStorageInspector creates a new FirestoreStorageInspector
+func NewFirestoreStorageInspector(client *firestore.Client) *FirestoreStorageInspector {
+	return &FirestoreStorageInspector{client: client}
+}
+
+// Collections names the inspected collections
+func (i *FirestoreStorageInspector) Collections() []string {
+	names := make([]string, 0, len(storageCollections))
+	for name := range storageCollections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Inspect counts the documents of a collection and estimates their size.
+// Documents of a link that is not in the links collection, trashed links
+// included, are counted as orphans.
+func (i *FirestoreStorageInspector) Inspect(ctx context.Context, collection string, limit int) (storagestats.CollectionStats, error) {
+	stats := storagestats.CollectionStats{Name: collection}
+	linkField, known := storageCollections[collection]
+	if !known {
+		return stats, fmt.Errorf("unknown collection %q", collection)
+	}
+
+	var links map[string]bool
+	if collection == "link_stats" || linkField != "" {
+		var err error
+		if links, err = i.linkShortIDs(ctx); err != nil {
+			return stats, err
+		}
+	}
+
+	var sizes []storagestats.DocumentSize
+	iter := i.client.Collection(collection).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("Error reading %s: %w", collection, err)
+		}
+
+		size := documentSize(doc)
+		stats.Documents++
+		stats.Bytes += size
+		if largestCollections[collection] && limit > 0 {
+			sizes = append(sizes, storagestats.DocumentSize{ID: doc.Ref.ID, Bytes: size})
+		}
+
+		switch {
+		case collection == "link_stats":
+			if !links[doc.Ref.ID] {
+				stats.Orphans++
+			}
+		case linkField != "":
+			short, _ := doc.Data()[linkField].(string)
+			if !links[ShortDocID(short)] {
+				stats.Orphans++
+			}
+		}
+	}
+
+	sort.Slice(sizes, func(a, b int) bool { return sizes[a].Bytes > sizes[b].Bytes })
+	if len(sizes) > limit {
+		sizes = sizes[:limit]
+	}
+	stats.Largest = sizes
+	return stats, nil
+}
+
+// linkShortIDs returns the short codes of every link as document IDs,
+// reading no other fields
+func (i *FirestoreStorageInspector) linkShortIDs(ctx context.Context) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	iter := i.client.Collection("links").Select("short").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading links: %w", err)
+		}
+		short, _ := doc.Data()["short"].(string)
+		ids[ShortDocID(short)] = true
+	}
+}
+
+// documentSize estimates the stored size of a document the way Firestore
+// documents it: the size of its name, its fields and 32 bytes of overhead
+func documentSize(doc *firestore.DocumentSnapshot) int64 {
+	size := int64(16 + 32)
+	for ref := doc.Ref; ref != nil; ref = ref.Parent.Parent {
+		size += int64(len(ref.ID)+1) + int64(len(ref.Parent.ID)+1)
+	}
+	for field, value := range doc.Data() {
+		size += int64(len(field)+1) + valueSize(value)
+	}
+	return size
+}
+
+// valueSize is the stored size of a Firestore field value
+func valueSize(value any) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 1
+	case bool:
+		return 1
+	case string:
+		return int64(len(v) + 1)
+	case []byte:
+		return int64(len(v))
+	case int64, float64, time.Time:
+		return 8
+	case *firestore.DocumentRef:
+		return int64(len(v.Path) + 1)
+	case map[string]any:
+		var size int64
+		for key, item := range v {
+			size += int64(len(key)+1) + valueSize(item)
+		}
+		return size
+	case []any:
+		var size int64
+		for _, item := range v {
+			size += valueSize(item)
+		}
+		return size
+	default:
+		// Geo points
+		return 16
+	}
+}
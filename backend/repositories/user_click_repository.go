@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// maxBatchWrites is the most writes Firestore accepts in one batch
+const maxBatchWrites = 500
+
+// UserClickRepository stores per-user click histories in Firestore
+type UserClickRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure UserClickRepository implements UserClickStore
+var _ interfaces.UserClickStore = (*UserClickRepository)(nil)
+
+// NewUserClickRepository creates a new UserClickRepository
+func NewUserClickRepository(client *firestore.Client) *UserClickRepository {
+	return &UserClickRepository{
+		client:     client,
+		collection: "user_link_clicks",
+	}
+}
+
+// RecordClick counts a click with an atomic increment, creating the entry on
+// the user's first click on the link
+func (r *UserClickRepository) RecordClick(ctx context.Context, userID, short string, at time.Time) error {
+	_, err := r.client.Collection(r.collection).Doc(userLinkDocID(userID, short)).Set(ctx, map[string]interface{}{
+		"user_id":         userID,
+		"short":           short,
+		"clicks":          firestore.Increment(1),
+		"last_clicked_at": at,
+	}, firestore.MergeAll)
+	if err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error recording user click: %w", err))
+	}
+	return nil
+}
+
+// ListByUser returns a user's click history, most recent first
+func (r *UserClickRepository) ListByUser(ctx context.Context, userID string) ([]*models.UserLinkClicks, error) {
+	clicks, _, err := r.query(ctx, r.client.Collection(r.collection).Where("user_id", "==", userID))
+	if err != nil {
+		return nil, err
+	}
+	sortUserClicks(clicks)
+	return clicks, nil
+}
+
+// DeleteByUser forgets a user's whole click history
+func (r *UserClickRepository) DeleteByUser(ctx context.Context, userID string) error {
+	_, refs, err := r.query(ctx, r.client.Collection(r.collection).Where("user_id", "==", userID))
+	if err != nil {
+		return err
+	}
+	return r.deleteAll(ctx, refs)
+}
+
+// DeleteBefore forgets every history entry last clicked before cutoff
+func (r *UserClickRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	_, refs, err := r.query(ctx, r.client.Collection(r.collection).Where("last_clicked_at", "<", cutoff))
+	if err != nil {
+		return 0, err
+	}
+	if err := r.deleteAll(ctx, refs); err != nil {
+		return 0, err
+	}
+	return len(refs), nil
+}
+
+// deleteAll deletes the given documents in as few batches as possible
+func (r *UserClickRepository) deleteAll(ctx context.Context, refs []*firestore.DocumentRef) error {
+	for start := 0; start < len(refs); start += maxBatchWrites {
+		batch := r.client.Batch()
+		for _, ref := range refs[start:min(start+maxBatchWrites, len(refs))] {
+			batch.Delete(ref)
+		}
+		if err := commitBatch(ctx, batch, r.collection); err != nil {
+			return errors.NewInternalError(fmt.Errorf("Error deleting user clicks: %w", err))
+		}
+	}
+	return nil
+}
+
+// query collects the history entries matched by q along with their documents
+func (r *UserClickRepository) query(ctx context.Context, q firestore.Query) ([]*models.UserLinkClicks, []*firestore.DocumentRef, error) {
+	iter := q.Documents(ctx)
+	var clicks []*models.UserLinkClicks
+	var refs []*firestore.DocumentRef
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.NewInternalError(fmt.Errorf("Error retrieving user clicks: %w", err))
+		}
+		refs = append(refs, doc.Ref)
+
+		var entry models.UserLinkClicks
+		if err := doc.DataTo(&entry); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		clicks = append(clicks, &entry)
+	}
+	return clicks, refs, nil
+}
+
+// userLinkDocID returns the document ID of a user's entry for a link, such
+// as a history entry or a favorite. Namespaced short codes contain slashes,
+// so the pair is hashed.
+func userLinkDocID(userID, short string) string {
+	sum := sha256.Sum256([]byte(userID + "\x00" + short))
+	return hex.EncodeToString(sum[:16])
+}
+
+// sortUserClicks orders history entries by their last click, most recent first
+func sortUserClicks(clicks []*models.UserLinkClicks) {
+	sort.Slice(clicks, func(i, j int) bool {
+		if !clicks[i].LastClickedAt.Equal(clicks[j].LastClickedAt) {
+			return clicks[i].LastClickedAt.After(clicks[j].LastClickedAt)
+		}
+		return clicks[i].Short < clicks[j].Short
+	})
+}
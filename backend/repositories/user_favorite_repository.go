@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UserFavoriteRepository stores users' favorite links in Firestore
+type UserFavoriteRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure UserFavoriteRepository implements UserFavoriteStore
+var _ interfaces.UserFavoriteStore = (*UserFavoriteRepository)(nil)
+
+// NewUserFavoriteRepository creates a new UserFavoriteRepository
+func NewUserFavoriteRepository(client *firestore.Client) *UserFavoriteRepository {
+	return &UserFavoriteRepository{
+		client:     client,
+		collection: "user_favorites",
+	}
+}
+
+// Add favorites a link. Create fails on an existing favorite, which keeps
+// the time it was first added.
+func (r *UserFavoriteRepository) Add(ctx context.Context, userID, short string, at time.Time) error {
+	_, err := r.client.Collection(r.collection).Doc(userLinkDocID(userID, short)).Create(ctx, &models.UserFavorite{
+		AddedAt: at,
+		UserID:  userID,
+		Short:   short,
+	})
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return errors.NewInternalError(fmt.Errorf("Error adding favorite: %w", err))
+	}
+	return nil
+}
+
+// Remove unfavorites a link
+func (r *UserFavoriteRepository) Remove(ctx context.Context, userID, short string) error {
+	_, err := r.client.Collection(r.collection).Doc(userLinkDocID(userID, short)).Delete(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return errors.NewInternalError(fmt.Errorf("Error removing favorite: %w", err))
+	}
+	return nil
+}
+
+// ListByUser returns a user's favorites, most recently added first
+func (r *UserFavoriteRepository) ListByUser(ctx context.Context, userID string) ([]*models.UserFavorite, error) {
+	iter := r.client.Collection(r.collection).Where("user_id", "==", userID).Documents(ctx)
+	favorites := []*models.UserFavorite{}
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving favorites: %w", err))
+		}
+
+		var favorite models.UserFavorite
+		if err := doc.DataTo(&favorite); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		favorites = append(favorites, &favorite)
+	}
+	sortUserFavorites(favorites)
+	return favorites, nil
+}
+
+// sortUserFavorites orders favorites by when they were added, most recent first
+func sortUserFavorites(favorites []*models.UserFavorite) {
+	sort.Slice(favorites, func(i, j int) bool {
+		if !favorites[i].AddedAt.Equal(favorites[j].AddedAt) {
+			return favorites[i].AddedAt.After(favorites[j].AddedAt)
+		}
+		return favorites[i].Short < favorites[j].Short
+	})
+}
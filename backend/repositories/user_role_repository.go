@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UserRoleRepository stores the roles of users in Firestore, one document per
+// user in the users collection, keyed by email
+type UserRoleRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure UserRoleRepository implements UserRoleStore
+var _ interfaces.UserRoleStore = (*UserRoleRepository)(nil)
+
+// NewUserRoleRepository creates a new UserRoleRepository
+func NewUserRoleRepository(client *firestore.Client) *UserRoleRepository {
+	return &UserRoleRepository{
+		client:     client,
+		collection: "users",
+	}
+}
+
+// Get retrieves the role of the user with email
+func (r *UserRoleRepository) Get(ctx context.Context, email string) (*models.UserRole, error) {
+	doc, err := r.client.Collection(r.collection).Doc(email).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, errors.NewNotFound(fmt.Sprintf("User '%s' not found", email))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving user: %w", err))
+	}
+
+	var role models.UserRole
+	if err := doc.DataTo(&role); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error converting user data: %w", err))
+	}
+	return &role, nil
+}
+
+// List returns the roles of every user, by email
+func (r *UserRoleRepository) List(ctx context.Context) ([]*models.UserRole, error) {
+	iter := r.client.Collection(r.collection).Documents(ctx)
+	var roles []*models.UserRole
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving users: %w", err))
+		}
+
+		var role models.UserRole
+		if err := doc.DataTo(&role); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		roles = append(roles, &role)
+	}
+
+	sortUserRoles(roles)
+	return roles, nil
+}
+
+// Set creates or replaces the role of a user
+func (r *UserRoleRepository) Set(ctx context.Context, role *models.UserRole) error {
+	if _, err := r.client.Collection(r.collection).Doc(role.Email).Set(ctx, role); err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error storing user: %w", err))
+	}
+	return nil
+}
+
+// Delete removes the role of the user with email
+func (r *UserRoleRepository) Delete(ctx context.Context, email string) error {
+	if _, err := r.Get(ctx, email); err != nil {
+		return err
+	}
+	if _, err := r.client.Collection(r.collection).Doc(email).Delete(ctx); err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error deleting user: %w", err))
+	}
+	return nil
+}
+
+// sortUserRoles orders roles by email
+func sortUserRoles(roles []*models.UserRole) {
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Email < roles[j].Email
+	})
+}
@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WebhookRepository stores webhooks in Firestore, one document per webhook
+type WebhookRepository struct {
+	client     *firestore.Client
+	collection string
+}
+
+// Ensure WebhookRepository implements WebhookStore
+var _ interfaces.WebhookStore = (*WebhookRepository)(nil)
+
+// NewWebhookRepository creates a new WebhookRepository
+func NewWebhookRepository(client *firestore.Client) *WebhookRepository {
+	return &WebhookRepository{
+		client:     client,
+		collection: "webhooks",
+	}
+}
+
+// Create stores a new webhook
+func (r *WebhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	_, err := r.client.Collection(r.collection).Doc(webhook.ID).Create(ctx, webhook)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return errors.NewAlreadyExists(fmt.Sprintf("Webhook '%s' already exists", webhook.ID))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error creating webhook: %w", err))
+	}
+	return nil
+}
+
+// Get retrieves a webhook by its ID
+func (r *WebhookRepository) Get(ctx context.Context, id string) (*models.Webhook, error) {
+	doc, err := r.client.Collection(r.collection).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, errors.NewNotFound(fmt.Sprintf("Webhook '%s' not found", id))
+		}
+		return nil, errors.NewInternalError(fmt.Errorf("Error retrieving webhook: %w", err))
+	}
+
+	var webhook models.Webhook
+	if err := doc.DataTo(&webhook); err != nil {
+		return nil, errors.NewInternalError(fmt.Errorf("Error converting webhook data: %w", err))
+	}
+	return &webhook, nil
+}
+
+// List returns every webhook, oldest first
+func (r *WebhookRepository) List(ctx context.Context) ([]*models.Webhook, error) {
+	iter := r.client.Collection(r.collection).Documents(ctx)
+	var webhooks []*models.Webhook
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewInternalError(fmt.Errorf("Error retrieving webhooks: %w", err))
+		}
+
+		var webhook models.Webhook
+		if err := doc.DataTo(&webhook); err != nil {
+			// Log error but continue with next document
+			continue
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+// Update replaces a webhook
+func (r *WebhookRepository) Update(ctx context.Context, webhook *models.Webhook) error {
+	ref := r.client.Collection(r.collection).Doc(webhook.ID)
+	err := r.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(ref); err != nil {
+			return err
+		}
+		return tx.Set(ref, webhook)
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return errors.NewNotFound(fmt.Sprintf("Webhook '%s' not found", webhook.ID))
+		}
+		return errors.NewInternalError(fmt.Errorf("Error updating webhook: %w", err))
+	}
+	return nil
+}
+
+// Delete removes a webhook
+func (r *WebhookRepository) Delete(ctx context.Context, id string) error {
+	if _, err := r.Get(ctx, id); err != nil {
+		return err
+	}
+	if _, err := r.client.Collection(r.collection).Doc(id).Delete(ctx); err != nil {
+		return errors.NewInternalError(fmt.Errorf("Error deleting webhook: %w", err))
+	}
+	return nil
+}
+
+// sortWebhooks orders webhooks oldest first
+func sortWebhooks(webhooks []*models.Webhook) {
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+}
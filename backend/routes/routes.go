@@ -8,9 +8,15 @@ import (
 
 	"github.com/Okabe-Junya/golink-backend/auth"
 	"github.com/Okabe-Junya/golink-backend/handlers"
+	"github.com/Okabe-Junya/golink-backend/interfaces"
 	"github.com/Okabe-Junya/golink-backend/logger"
 	"github.com/Okabe-Junya/golink-backend/middleware"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/pkg/capture"
+	"github.com/Okabe-Junya/golink-backend/pkg/groups"
+	"github.com/Okabe-Junya/golink-backend/pkg/lifecycle"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/Okabe-Junya/golink-backend/pkg/webhook"
 )
 
 // Router handles HTTP routing
@@ -18,15 +24,126 @@ type Router struct {
 	linkHandler      *handlers.LinkHandler
 	healthHandler    *handlers.HealthHandler
 	analyticsHandler *handlers.AnalyticsHandler
+	rateLimiter      ratelimit.Limiter
+	indexerVerifier  *webhook.Verifier
+	lifecycle        *lifecycle.Manager
+	doctor           handlers.Diagnoser
+	storageStats     handlers.StorageStatsSource
+	capture          *capture.Recorder
+	webhooks         interfaces.WebhookStore
+	settings         map[string]string
+	productMetrics   interfaces.ProductMetricsStore
+	rateLimits       middleware.RateLimitPolicy
+	maxLinks         int
+	groups           *groups.Service
+}
+
+// RouterOption configures optional Router dependencies
+type RouterOption func(*Router)
+
+// WithRateLimiter limits requests per client IP and per user as policy
+// says, with the buckets of limiter, which may be shared with other
+// components or replicas
+func WithRateLimiter(limiter ratelimit.Limiter, policy middleware.RateLimitPolicy) RouterOption {
+	return func(r *Router) {
+		r.rateLimiter = limiter
+		r.rateLimits = policy
+	}
+}
+
+// WithIndexerVerifier accepts link reference reports from external indexers
+// whose requests pass the verifier's signature check
+func WithIndexerVerifier(verifier *webhook.Verifier) RouterOption {
+	return func(r *Router) {
+		r.indexerVerifier = verifier
+	}
+}
+
+// WithLifecycle serves the readiness of the manager's components at /readyz
+func WithLifecycle(manager *lifecycle.Manager) RouterOption {
+	return func(r *Router) {
+		r.lifecycle = manager
+	}
+}
+
+// WithDoctor serves the configuration checks of the doctor at /api/admin/doctor
+func WithDoctor(d handlers.Diagnoser) RouterOption {
+	return func(r *Router) {
+		r.doctor = d
+	}
+}
+
+// WithStorageStats serves the storage statistics of the source at
+// /api/admin/storage/stats
+func WithStorageStats(source handlers.StorageStatsSource) RouterOption {
+	return func(r *Router) {
+		r.storageStats = source
+	}
+}
+
+// WithCapture records the requests matching the recorder's debug capture
+// sessions, which are managed at /api/admin/captures
+func WithCapture(recorder *capture.Recorder) RouterOption {
+	return func(r *Router) {
+		r.capture = recorder
+	}
+}
+
+// WithWebhookStore serves the management of the webhooks link events are
+// delivered to at /api/webhooks
+func WithWebhookStore(store interfaces.WebhookStore) RouterOption {
+	return func(r *Router) {
+		r.webhooks = store
+	}
+}
+
+// WithSettings serves the export and import of the server's settings, with
+// env as its portable environment, at /api/admin/settings
+func WithSettings(env map[string]string) RouterOption {
+	return func(r *Router) {
+		r.settings = env
+	}
+}
+
+// WithProductMetrics serves the daily product feature usage in the store at
+// /api/admin/product-metrics
+func WithProductMetrics(store interfaces.ProductMetricsStore) RouterOption {
+	return func(r *Router) {
+		r.productMetrics = store
+	}
+}
+
+// WithMaxLinks caps the links each request loads when it lists every link;
+// zero leaves requests uncapped
+func WithMaxLinks(limit int) RouterOption {
+	return func(r *Router) {
+		r.maxLinks = limit
+	}
+}
+
+// WithGroups looks up the groups of each request's user with service, so
+// links restricted to groups admit their members
+func WithGroups(service *groups.Service) RouterOption {
+	return func(r *Router) {
+		r.groups = service
+	}
 }
 
 // NewRouter creates a new Router
-func NewRouter(linkHandler *handlers.LinkHandler, healthHandler *handlers.HealthHandler, analyticsHandler *handlers.AnalyticsHandler) *Router {
-	return &Router{
+func NewRouter(linkHandler *handlers.LinkHandler, healthHandler *handlers.HealthHandler, analyticsHandler *handlers.AnalyticsHandler, opts ...RouterOption) *Router {
+	r := &Router{
 		linkHandler:      linkHandler,
 		healthHandler:    healthHandler,
 		analyticsHandler: analyticsHandler,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.rateLimiter == nil {
+		r.rateLimiter = ratelimit.NewMemoryStore()
+		r.rateLimits = middleware.DefaultRateLimitPolicy()
+	}
+	return r
 }
 
 // SetupRoutes configures the HTTP routes
@@ -34,8 +151,8 @@ func (r *Router) SetupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
 	// API routes
-	mux.HandleFunc("/api/links", r.handleLinks)
-	mux.HandleFunc("/api/links/", func(w http.ResponseWriter, req *http.Request) {
+	mux.Handle("/api/links", requireEditorToWrite(http.HandlerFunc(r.handleLinks)))
+	mux.Handle("/api/links/", requireEditorToWrite(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		path := req.URL.Path[len("/api/links/"):]
 
 		// Handle bulk deletion of expired links
@@ -44,6 +161,106 @@ func (r *Router) SetupRoutes() http.Handler {
 			return
 		}
 
+		// Handle bulk resolution of many short codes
+		if path == "resolve" {
+			r.linkHandler.ResolveLinks(w, req)
+			return
+		}
+
+		// Handle the caller's favorite links
+		if path == "favorites" {
+			r.linkHandler.GetFavorites(w, req)
+			return
+		}
+		if strings.HasSuffix(path, "/favorite") {
+			r.linkHandler.HandleLinkFavorite(w, req)
+			return
+		}
+
+		// Handle archiving and unarchiving
+		if strings.HasSuffix(path, "/archive") {
+			r.linkHandler.HandleLinkArchive(w, req)
+			return
+		}
+
+		// Handle pointing a superseded link to its successor
+		if strings.HasSuffix(path, "/deprecation") {
+			r.linkHandler.HandleLinkDeprecation(w, req)
+			return
+		}
+
+		// Handle changing a link's short code
+		if strings.HasSuffix(path, "/rename") {
+			r.linkHandler.HandleLinkRename(w, req)
+			return
+		}
+
+		// Handle search and autocomplete
+		if path == "search" {
+			r.linkHandler.SearchLinks(w, req)
+			return
+		}
+
+		// Handle the trash of soft-deleted links
+		if path == "trash" {
+			r.linkHandler.GetTrash(w, req)
+			return
+		}
+		// Handle saved link configurations; checked before the trash since
+		// restoring a snapshot also ends in /restore
+		if strings.HasSuffix(path, "/snapshot") || strings.HasSuffix(path, "/snapshot/restore") {
+			r.linkHandler.HandleLinkSnapshots(w, req)
+			return
+		}
+		if strings.HasSuffix(path, "/restore") {
+			r.linkHandler.RestoreLink(w, req)
+			return
+		}
+		if strings.HasSuffix(path, "/undo-delete") {
+			r.linkHandler.UndoDelete(w, req)
+			return
+		}
+
+		// Handle link edit history
+		if strings.HasSuffix(path, "/history") {
+			r.linkHandler.GetLinkHistory(w, req)
+			return
+		}
+		if strings.HasSuffix(path, "/rollback") {
+			r.linkHandler.RollbackLink(w, req)
+			return
+		}
+
+		// Handle documents referencing a link
+		if strings.HasSuffix(path, "/references") {
+			r.linkHandler.GetLinkReferences(w, req)
+			return
+		}
+
+		// Handle gradual moves to a new destination
+		if strings.HasSuffix(path, "/rollout") {
+			r.linkHandler.HandleLinkRollout(w, req)
+			return
+		}
+
+		// Handle rich card metadata of a link's destination
+		if strings.HasSuffix(path, "/preview") {
+			r.linkHandler.GetLinkPreview(w, req)
+			return
+		}
+
+		// Handle handing a link over to another user
+		if strings.HasSuffix(path, "/transfer") || strings.HasSuffix(path, "/transfer/accept") {
+			r.linkHandler.HandleLinkTransfer(w, req)
+			return
+		}
+
+		// Handle additional short codes of a link
+		if strings.HasSuffix(path, "/aliases") || strings.Contains(path, "/aliases/") {
+			r.linkHandler.HandleLinkAliases(w, req)
+			return
+		}
+
 		// Handle individual link operations
 		switch req.Method {
 		case http.MethodGet:
@@ -55,24 +272,86 @@ func (r *Router) SetupRoutes() http.Handler {
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})
+	})))
+
+	// Routes about the signed-in user
+	mux.HandleFunc("/api/me/click-history", r.linkHandler.HandleClickHistory)
+
+	// Namespace routes
+	mux.HandleFunc("/api/namespaces/", r.linkHandler.ListNamespaceLinks)
+
+	// Tooling routes
+	mux.HandleFunc("/api/tools/validate-doc", r.linkHandler.ValidateDoc)
+
+	// Inbound webhooks authenticate by signature instead of a user session
+	if r.indexerVerifier != nil {
+		mux.Handle("/api/hooks/references", r.indexerVerifier.Middleware(http.HandlerFunc(r.linkHandler.ReportReferences)))
+	}
 
 	// Analytics routes
 	mux.HandleFunc("/api/analytics/links/", r.handleAnalyticsByShort)
 	mux.HandleFunc("/api/analytics/top", r.handleTopLinks)
+	mux.HandleFunc("/api/analytics/compare", r.analyticsHandler.CompareLinks)
+	mux.HandleFunc("/api/analytics/summary", r.analyticsHandler.GetSummary)
+	mux.HandleFunc("/api/analytics/deprecated", r.analyticsHandler.GetDeprecatedLinks)
 
 	// Auth routes
 	mux.HandleFunc("/api/auth/login", auth.HandleLogin)
 	mux.HandleFunc("/api/auth/callback", auth.HandleCallback)
+	mux.HandleFunc("/api/auth/saml/metadata", auth.HandleSAMLMetadata)
+	mux.HandleFunc("/api/auth/saml/acs", auth.HandleSAMLACS)
 	mux.HandleFunc("/api/auth/logout", auth.HandleLogout)
 	mux.HandleFunc("/api/auth/user", r.handleCurrentUser)
+	mux.HandleFunc("/api/auth/sessions", auth.HandleListSessions)
+	mux.HandleFunc("/api/auth/sessions/", auth.HandleRevokeSession)
+	mux.HandleFunc("/api/auth/tokens", auth.HandleAPITokens)
+	mux.HandleFunc("/api/auth/tokens/", auth.HandleAPIToken)
+	mux.HandleFunc("/api/apikeys", auth.HandleAPITokens)
+	mux.HandleFunc("/api/apikeys/", auth.HandleAPIToken)
+	mux.HandleFunc("/api/auth/passkeys", auth.HandlePasskeys)
+	mux.HandleFunc("/api/auth/passkeys/", auth.HandlePasskey)
+	mux.HandleFunc("/api/auth/step-up", auth.HandleStepUp)
+	mux.HandleFunc("/api/auth/step-up/options", auth.HandleStepUp)
+
+	// Webhook routes
+	if r.webhooks != nil {
+		mux.HandleFunc("/api/webhooks", handlers.HandleWebhooks(r.webhooks))
+		mux.HandleFunc("/api/webhooks/", handlers.HandleWebhook(r.webhooks))
+	}
+
+	// Admin routes
+	requireAdmin := middleware.RequireRole(models.RoleAdmin)
+	mux.Handle("/api/admin/users", requireAdmin(http.HandlerFunc(auth.HandleUserRoles)))
+	mux.Handle("/api/admin/users/", requireAdmin(http.HandlerFunc(auth.HandleUserRole)))
+	mux.HandleFunc("/api/admin/auth/failures", auth.HandleRecentLoginFailures)
+	mux.HandleFunc("/api/admin/log-levels", handlers.HandleLogLevels)
+	if r.doctor != nil {
+		mux.HandleFunc("/api/admin/doctor", handlers.HandleDoctor(r.doctor))
+	}
+	if r.storageStats != nil {
+		mux.HandleFunc("/api/admin/storage/stats", handlers.HandleStorageStats(r.storageStats))
+	}
+	if r.settings != nil {
+		mux.HandleFunc("/api/admin/settings", handlers.HandleSettings(r.settings, r.webhooks))
+	}
+	if r.productMetrics != nil {
+		mux.HandleFunc("/api/admin/product-metrics", handlers.HandleProductMetrics(r.productMetrics))
+	}
+	if r.capture != nil {
+		mux.HandleFunc("/api/admin/captures", handlers.HandleCaptures(r.capture))
+		mux.HandleFunc("/api/admin/captures/", handlers.HandleCapture(r.capture))
+	}
 
 	// Health check endpoints
+	mux.HandleFunc("/livez", r.healthHandler.Liveness)
 	mux.HandleFunc("/health", r.healthHandler.SimpleHealthCheck)
 	mux.HandleFunc("/health/detailed", r.healthHandler.HealthCheck)
+	if r.lifecycle != nil {
+		mux.HandleFunc("/readyz", r.lifecycle.ServeReadyz)
+	}
 
 	// Metrics endpoint (Prometheus)
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", middleware.MetricsHandler())
 
 	// Redirect route (catch-all)
 	mux.HandleFunc("/", r.handleRedirect)
@@ -81,14 +360,75 @@ func (r *Router) SetupRoutes() http.Handler {
 		"endpoints": []string{
 			"/api/links",
 			"/api/links/{short}",
+			"/api/links/resolve",
+			"/api/links/search",
+			"/api/links/favorites",
+			"/api/links/trash",
+			"/api/links/{short}/restore",
+			"/api/links/{short}/undo-delete",
+			"/api/links/{short}/history",
+			"/api/links/{short}/rollback",
+			"/api/links/{short}/snapshot",
+			"/api/links/{short}/snapshot/restore",
+			"/api/links/{short}/references",
+			"/api/links/{short}/rollout",
+			"/api/links/{short}/preview",
+			"/api/links/{short}/transfer",
+			"/api/links/{short}/transfer/accept",
+			"/api/links/{short}/favorite",
+			"/api/links/{short}/archive",
+			"/api/links/{short}/deprecation",
+			"/api/links/{short}/rename",
+			"/api/links/{short}/aliases",
+			"/api/links/{short}/aliases/{alias}",
+			"/api/me/click-history",
+			"/api/namespaces/{ns}/links",
+			"/api/tools/validate-doc",
+			"/api/hooks/references",
 			"/api/analytics/links/{short}",
+			"/api/analytics/links/{short}/timeseries",
+			"/api/analytics/links/{short}/forecast",
+			"/api/analytics/links/{short}/referrers",
 			"/api/analytics/top",
+			"/api/analytics/compare",
+			"/api/analytics/summary",
+			"/api/analytics/deprecated",
+			"/api/webhooks",
+			"/api/webhooks/{id}",
 			"/api/auth/login",
 			"/api/auth/callback",
+			"/api/auth/saml/metadata",
+			"/api/auth/saml/acs",
 			"/api/auth/logout",
 			"/api/auth/user",
+			"/api/auth/sessions",
+			"/api/auth/sessions/{id}",
+			"/api/auth/tokens",
+			"/api/auth/tokens/{id}",
+			"/api/auth/tokens/{id}/usage",
+			"/api/apikeys",
+			"/api/apikeys/{id}",
+			"/api/apikeys/{id}/usage",
+			"/api/auth/passkeys",
+			"/api/auth/passkeys/options",
+			"/api/auth/passkeys/recovery-codes",
+			"/api/auth/passkeys/{id}",
+			"/api/auth/step-up",
+			"/api/auth/step-up/options",
+			"/api/admin/users",
+			"/api/admin/users/{email}",
+			"/api/admin/auth/failures",
+			"/api/admin/log-levels",
+			"/api/admin/doctor",
+			"/api/admin/storage/stats",
+			"/api/admin/settings",
+			"/api/admin/product-metrics",
+			"/api/admin/captures",
+			"/api/admin/captures/{id}",
+			"/livez",
 			"/health",
 			"/health/detailed",
+			"/readyz",
 			"/metrics",
 			"/{short}",
 		},
@@ -108,9 +448,14 @@ func (r *Router) SetupRoutes() http.Handler {
 	// 4. Cache middleware for faster responses
 	// 5. CORS middleware so headers are always set
 	// 6. SecurityHeaders middleware
-	// 7. RateLimit middleware
+	// 7. RateLimit middleware, per client IP
 	// 8. Error middleware for consistent error handling
-	// 9. Auth middleware last
+	// 9. LinkCap middleware to cap the links a request loads
+	// 10. API token middleware to authenticate and limit API tokens
+	// 11. Auth middleware
+	// 12. Groups middleware to look up the groups of the user
+	// 13. RateLimit middleware, per user once they are known
+	// 14. Debug capture middleware last, so it sees who made the request
 
 	// Chain all middlewares
 	middlewares := []middleware.Middleware{
@@ -120,18 +465,61 @@ func (r *Router) SetupRoutes() http.Handler {
 		middleware.CacheMiddleware,
 		middleware.CORS([]string{corsOrigin}),
 		middleware.SecurityHeaders(),
-		middleware.RateLimit(),
+		middleware.RateLimitPerIP(r.rateLimiter, r.rateLimits),
 		middleware.ErrorHandler,
+		middleware.LinkCap(r.maxLinks),
+		auth.APITokenMiddleware,
+		auth.AuthMiddleware,
 	}
-
-	// Only apply auth middleware if not in test mode
-	if os.Getenv("TEST_MODE") != "true" {
-		middlewares = append(middlewares, auth.AuthMiddleware)
+	if r.groups != nil {
+		middlewares = append(middlewares, r.groups.Middleware(requestUserEmail))
+	}
+	middlewares = append(middlewares, middleware.RateLimitPerUser(r.rateLimiter, r.rateLimits, requestUserID))
+	if r.capture != nil {
+		middlewares = append(middlewares, r.capture.Middleware(requestUserID))
 	}
 
 	return middleware.Chain(mux, middlewares...)
 }
 
+// requireEditorToWrite lets viewers read links through next, while only
+// editors and admins may change them. It guards every route under /api/links,
+// which are all the routes that change links. Resolving links and keeping
+// favorites change no link, so viewers may do both. Signed-out requests are
+// left to the auth middleware and the handlers.
+func requireEditorToWrite(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions,
+			req.URL.Path == "/api/links/resolve",
+			strings.HasSuffix(req.URL.Path, "/favorite"):
+		default:
+			user, err := auth.GetCurrentUser(req)
+			if err == nil && !models.RoleIncludes(auth.RoleOf(req.Context(), user), models.RoleEditor) {
+				http.Error(w, "The editor role is required", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// requestUserID returns the ID of the user a request was authenticated as
+func requestUserID(req *http.Request) string {
+	if user, ok := req.Context().Value("user").(*auth.User); ok && user != nil {
+		return user.ID
+	}
+	return ""
+}
+
+// requestUserEmail returns the email of the user making the request, or ""
+func requestUserEmail(req *http.Request) string {
+	if user, err := auth.GetUserFromRequest(req); err == nil {
+		return user.Email
+	}
+	return ""
+}
+
 // handleCurrentUser handles /api/auth/user requests
 func (r *Router) handleCurrentUser(w http.ResponseWriter, req *http.Request) {
 	// Only GET requests are allowed
@@ -147,12 +535,15 @@ func (r *Router) handleCurrentUser(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	current := *user
+	current.Role = auth.RoleOf(req.Context(), user)
+
 	// Return user info as JSON
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	// We can just use the json encoding from the auth package since it already has json tags
-	if err := json.NewEncoder(w).Encode(user); err != nil {
+	if err := json.NewEncoder(w).Encode(current); err != nil {
 		logger.Error("Failed to encode user", err, nil)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
@@ -170,7 +561,8 @@ func (r *Router) handleLinks(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// handleAnalyticsByShort handles /api/analytics/links/{short} requests
+// handleAnalyticsByShort handles /api/analytics/links/{short} requests and
+// those of its timeseries, forecast and referrers subresources
 func (r *Router) handleAnalyticsByShort(w http.ResponseWriter, req *http.Request) {
 	// Extract the short code from the URL
 	path := req.URL.Path
@@ -179,6 +571,19 @@ func (r *Router) handleAnalyticsByShort(w http.ResponseWriter, req *http.Request
 		return
 	}
 
+	if strings.HasSuffix(path, "/timeseries") {
+		r.analyticsHandler.GetLinkTimeSeries(w, req)
+		return
+	}
+	if strings.HasSuffix(path, "/forecast") {
+		r.analyticsHandler.GetLinkForecast(w, req)
+		return
+	}
+	if strings.HasSuffix(path, "/referrers") {
+		r.analyticsHandler.GetLinkReferrers(w, req)
+		return
+	}
+
 	switch req.Method {
 	case http.MethodGet:
 		r.analyticsHandler.GetLinkStats(w, req)
@@ -201,8 +606,10 @@ func (r *Router) handleTopLinks(w http.ResponseWriter, req *http.Request) {
 func (r *Router) handleRedirect(w http.ResponseWriter, req *http.Request) {
 	// Skip API routes, metrics and health check
 	if strings.HasPrefix(req.URL.Path, "/api/") ||
+		req.URL.Path == "/livez" ||
 		req.URL.Path == "/health" ||
 		req.URL.Path == "/health/detailed" ||
+		req.URL.Path == "/readyz" ||
 		req.URL.Path == "/metrics" || req.URL.Path == "/" {
 		http.NotFound(w, req)
 		return
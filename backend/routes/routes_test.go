@@ -5,20 +5,30 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
+	"github.com/Okabe-Junya/golink-backend/auth"
 	"github.com/Okabe-Junya/golink-backend/handlers"
 	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/Okabe-Junya/golink-backend/repositories"
 	"github.com/Okabe-Junya/golink-backend/repositories/mocks"
 	"github.com/Okabe-Junya/golink-backend/routes"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupTestRouter() http.Handler {
-	// Skip authentication for testing
-	os.Setenv("TEST_MODE", "true")
-	defer os.Unsetenv("TEST_MODE")
+// testProxySecret is the secret of the authenticating proxy trusted by tests
+const testProxySecret = "test-proxy-secret"
+
+// signInAs makes req a request of the user, sent through the trusted test proxy
+func signInAs(req *http.Request, userID string) {
+	req.Header.Set("X-User-ID", userID)
+	req.Header.Set(auth.ProxySecretHeader, testProxySecret)
+}
+
+func setupTestRouter(t *testing.T) http.Handler {
+	// Requests name their user through signInAs
+	auth.SetTrustedProxyAuth([]string{testProxySecret})
+	t.Cleanup(func() { auth.SetTrustedProxyAuth(nil) })
 
 	// モックリポジトリを作成
 	mockRepo := mocks.NewMockLinkRepository()
@@ -40,7 +50,7 @@ func TestRoutes(t *testing.T) {
 	// middleware emits its headers.
 	const testOrigin = "http://localhost:3001"
 	t.Setenv("CORS_ORIGIN", testOrigin)
-	handler := setupTestRouter()
+	handler := setupTestRouter(t)
 
 	tests := []struct {
 		body           interface{}
@@ -60,6 +70,15 @@ func TestRoutes(t *testing.T) {
 				"status": "healthy",
 			},
 		},
+		{
+			name:           "Liveness",
+			method:         http.MethodGet,
+			path:           "/livez",
+			expectedStatus: http.StatusOK,
+			expectedBody: map[string]string{
+				"status": "alive",
+			},
+		},
 		{
 			name:   "Create Link",
 			method: http.MethodPost,
@@ -133,7 +152,7 @@ func TestRoutes(t *testing.T) {
 			assert.NoError(t, err)
 
 			if tc.userID != "" {
-				req.Header.Set("X-User-ID", tc.userID)
+				signInAs(req, tc.userID)
 			}
 			if bodyBytes != nil {
 				req.Header.Set("Content-Type", "application/json")
@@ -149,7 +168,8 @@ func TestRoutes(t *testing.T) {
 			assert.Equal(t, testOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
 			assert.Equal(t, "GET, POST, PUT, DELETE, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
 			assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
-			assert.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "X-User-ID")
+			// Browsers are not invited to send the proxy's identity headers
+			assert.NotContains(t, rr.Header().Get("Access-Control-Allow-Headers"), "X-User-ID")
 			// Check response body for specific cases
 			if tc.expectedBody != nil {
 				var responseBody map[string]string
@@ -165,7 +185,7 @@ func TestRoutes(t *testing.T) {
 }
 
 func TestEndToEndLinkOperations(t *testing.T) {
-	handler := setupTestRouter()
+	handler := setupTestRouter(t)
 
 	// Test user identifier
 	userID := "test-user"
@@ -180,7 +200,7 @@ func TestEndToEndLinkOperations(t *testing.T) {
 
 	req, _ := http.NewRequest(http.MethodPost, "/api/links", bytes.NewBuffer(bodyBytes))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-User-ID", userID)
+	signInAs(req, userID)
 
 	rr := httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
@@ -188,7 +208,7 @@ func TestEndToEndLinkOperations(t *testing.T) {
 
 	// 2. Retrieve the created link
 	req, _ = http.NewRequest(http.MethodGet, "/api/links/test-link", nil)
-	req.Header.Set("X-User-ID", userID)
+	signInAs(req, userID)
 
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
@@ -208,7 +228,7 @@ func TestEndToEndLinkOperations(t *testing.T) {
 
 	req, _ = http.NewRequest(http.MethodPut, "/api/links/test-link", bytes.NewBuffer(bodyBytes))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-User-ID", userID)
+	signInAs(req, userID)
 
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
@@ -216,7 +236,7 @@ func TestEndToEndLinkOperations(t *testing.T) {
 
 	// 4. Verify the update
 	req, _ = http.NewRequest(http.MethodGet, "/api/links/test-link", nil)
-	req.Header.Set("X-User-ID", userID)
+	signInAs(req, userID)
 
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
@@ -228,7 +248,7 @@ func TestEndToEndLinkOperations(t *testing.T) {
 
 	// 5. Delete the link
 	req, _ = http.NewRequest(http.MethodDelete, "/api/links/test-link", nil)
-	req.Header.Set("X-User-ID", userID)
+	signInAs(req, userID)
 
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
@@ -236,13 +256,49 @@ func TestEndToEndLinkOperations(t *testing.T) {
 
 	// 6. Verify the deletion
 	req, _ = http.NewRequest(http.MethodGet, "/api/links/test-link", nil)
-	req.Header.Set("X-User-ID", userID)
+	signInAs(req, userID)
 
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
+func TestRoles(t *testing.T) {
+	roles := repositories.NewMemoryUserRoleStore()
+	auth.SetRoleStore(roles, models.RoleViewer)
+	auth.SetAdminEmails([]string{"admin@example.com"})
+	t.Cleanup(func() {
+		auth.SetRoleStore(nil, models.RoleEditor)
+		auth.SetAdminEmails(nil)
+	})
+	handler := setupTestRouter(t)
+
+	send := func(method, path, email string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		signInAs(req, email)
+		req.Header.Set("X-User-Email", email)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	link := map[string]string{"short": "roles", "url": "https://example.com"}
+
+	// Viewers read links but cannot create them or take one over
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/api/links", "viewer@example.com", link).Code)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/api/links/roles/transfer/accept", "viewer@example.com", nil).Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/links", "viewer@example.com", nil).Code)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/api/admin/users", "viewer@example.com", nil).Code)
+
+	// Admins promote them to editors
+	rr := send(http.MethodPut, "/api/admin/users/viewer@example.com", "admin@example.com", map[string]string{"role": models.RoleEditor})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusCreated, send(http.MethodPost, "/api/links", "viewer@example.com", link).Code)
+
+	rr = send(http.MethodGet, "/api/auth/user", "viewer@example.com", nil)
+	assert.Contains(t, rr.Body.String(), `"role":"editor"`)
+}
+
 func TestCORSMiddleware(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -285,7 +341,7 @@ func TestCORSMiddleware(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Setenv("CORS_ORIGIN", tc.corsOrigin)
-			handler := setupTestRouter()
+			handler := setupTestRouter(t)
 
 			req, _ := http.NewRequest(http.MethodOptions, "/api/links", nil)
 			if tc.requestOrigin != "" {
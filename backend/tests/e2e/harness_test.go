@@ -0,0 +1,202 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/handlers"
+	"github.com/Okabe-Junya/golink-backend/middleware"
+	"github.com/Okabe-Junya/golink-backend/pkg/ratelimit"
+	"github.com/Okabe-Junya/golink-backend/pkg/shortcode"
+	"github.com/Okabe-Junya/golink-backend/pkg/webhook"
+	"github.com/Okabe-Junya/golink-backend/repositories"
+	"github.com/Okabe-Junya/golink-backend/routes"
+	"github.com/stretchr/testify/require"
+)
+
+// harnessOrigin is the frontend origin allowed by the harness CORS configuration
+const harnessOrigin = "http://frontend.test"
+
+// harnessIndexerSecret signs link reference reports sent to the harness
+const harnessIndexerSecret = "harness-indexer-secret"
+
+// harness boots the production router (routes.SetupRoutes) with the in-memory
+// repository, authentication enabled and a fake OAuth provider standing in for
+// Google, so auth, CORS, rate limiting and redirects are exercised together.
+type harness struct {
+	server   *httptest.Server
+	provider *httptest.Server
+	repo     *repositories.MemoryLinkRepository
+	sessions *repositories.MemorySessionStore
+}
+
+// newFakeOAuthProvider serves the token and userinfo endpoints of an OAuth
+// provider. The authorization code is the email of the user logging in, and is
+// handed back as the access token.
+func newFakeOAuthProvider() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("code") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": r.Form.Get("code"),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		email := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if email == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":             strings.Split(email, "@")[0],
+			"email":          email,
+			"name":           email,
+			"verified_email": true,
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+// newHarness starts the full router and the fake OAuth provider
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	h := &harness{
+		provider: newFakeOAuthProvider(),
+		repo:     repositories.NewMemoryLinkRepository(),
+		sessions: repositories.NewMemorySessionStore(),
+	}
+
+	// The router is built after the server URL is known, because the OAuth
+	// redirect URL and frontend URL point back at the server itself.
+	var handler http.Handler
+	h.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(func() {
+		h.server.Close()
+		h.provider.Close()
+		auth.SetSessionStore(nil, 0)
+	})
+
+	t.Setenv("AUTH_DISABLED", "false")
+	t.Setenv("GOOGLE_CLIENT_ID", "harness-client")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "harness-secret")
+	t.Setenv("GOOGLE_ALLOWED_DOMAIN", "example.com")
+	t.Setenv("SESSION_SECRET_KEY", "harness-session-secret")
+	t.Setenv("OAUTH_AUTH_URL", h.provider.URL+"/authorize")
+	t.Setenv("OAUTH_TOKEN_URL", h.provider.URL+"/token")
+	t.Setenv("OAUTH_USERINFO_URL", h.provider.URL+"/userinfo")
+	t.Setenv("OAUTH_REDIRECT_URL", h.server.URL+"/api/auth/callback")
+	t.Setenv("FRONTEND_URL", harnessOrigin+"/")
+	t.Setenv("CORS_ORIGIN", harnessOrigin)
+
+	require.NoError(t, auth.InitSessionManager())
+	require.NoError(t, auth.InitAuth())
+	auth.SetSessionStore(h.sessions, 0)
+
+	generator, err := shortcode.NewGenerator(shortcode.DefaultLength, shortcode.DefaultAlphabet)
+	require.NoError(t, err)
+
+	router := routes.NewRouter(
+		handlers.NewLinkHandler(h.repo,
+			handlers.WithShortCodeGenerator(generator),
+			handlers.WithVersionStore(repositories.NewMemoryLinkVersionStore()),
+			handlers.WithReferenceStore(repositories.NewMemoryLinkReferenceStore()),
+		),
+		handlers.NewHealthHandler(h.repo),
+		handlers.NewAnalyticsHandler(h.repo),
+		routes.WithRateLimiter(ratelimit.NewMemoryStore(), middleware.DefaultRateLimitPolicy()),
+		routes.WithIndexerVerifier(webhook.NewVerifier([]string{harnessIndexerSecret})),
+	)
+	handler = router.SetupRoutes()
+
+	return h
+}
+
+// client returns an HTTP client with its own cookie jar that does not follow redirects
+func (h *harness) client(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	return &http.Client{
+		Jar:     jar,
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// login runs the OAuth flow against the fake provider and returns the callback response
+func (h *harness) login(t *testing.T, client *http.Client, email string) *http.Response {
+	t.Helper()
+
+	resp := h.do(t, client, http.MethodGet, "/api/auth/login", nil, nil)
+	require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+
+	authURL, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, h.provider.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+
+	query := url.Values{
+		"state": {authURL.Query().Get("state")},
+		"code":  {email},
+	}
+	return h.do(t, client, http.MethodGet, "/api/auth/callback?"+query.Encode(), nil, nil)
+}
+
+// do sends a request to the harness server, JSON-encoding body if present
+func (h *harness) do(t *testing.T, client *http.Client, method, path string, body interface{}, headers map[string]string) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, h.server.URL+path, reader)
+	require.NoError(t, err)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// sessionCookie returns the session token stored in the client's cookie jar
+func (h *harness) sessionCookie(t *testing.T, client *http.Client) string {
+	t.Helper()
+	u, err := url.Parse(h.server.URL)
+	require.NoError(t, err)
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == "session_token" {
+			return c.Value
+		}
+	}
+	return ""
+}
@@ -140,10 +140,15 @@ func (r *MockLinkRepository) IncrementClickCount(ctx context.Context, short stri
 	if !exists {
 		return errors.NewNotFound(fmt.Sprintf("Link '%s' not found", short))
 	}
+	if link.ClickLimitReached() {
+		return errors.NewGone(fmt.Sprintf("Link '%s' has reached its click limit", short))
+	}
 
 	// Increment the click count
+	now := time.Now()
 	link.ClickCount++
-	link.UpdatedAt = time.Now()
+	link.UpdatedAt = now
+	link.LastClickedAt = now
 
 	return nil
 }
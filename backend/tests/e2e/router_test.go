@@ -0,0 +1,325 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/pkg/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRouterAuthFlow logs in through the fake provider and checks that the
+// session is honored by the real AuthMiddleware and revoked on logout
+func TestRouterAuthFlow(t *testing.T) {
+	h := newHarness(t)
+	client := h.client(t)
+
+	resp := h.do(t, client, http.MethodGet, "/api/links", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "API requires a session")
+
+	resp = h.login(t, client, "alice@example.com")
+	require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, harnessOrigin+"/", resp.Header.Get("Location"))
+
+	token := h.sessionCookie(t, client)
+	require.NotEmpty(t, token)
+
+	resp = h.do(t, client, http.MethodGet, "/api/auth/user", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var user map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&user))
+	assert.Equal(t, "alice@example.com", user["email"])
+
+	resp = h.do(t, client, http.MethodPost, "/api/auth/logout", nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// A copy of the old token must not work after logout
+	replay := h.client(t)
+	resp = h.do(t, replay, http.MethodGet, "/api/auth/user", nil, map[string]string{
+		"Cookie": "session_token=" + token,
+	})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// TestRouterLoginRejections covers callbacks that must not create a session
+func TestRouterLoginRejections(t *testing.T) {
+	h := newHarness(t)
+
+	t.Run("Foreign domain", func(t *testing.T) {
+		client := h.client(t)
+		resp := h.login(t, client, "mallory@evil.test")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Empty(t, h.sessionCookie(t, client))
+	})
+
+	t.Run("Forged state", func(t *testing.T) {
+		client := h.client(t)
+		resp := h.do(t, client, http.MethodGet, "/api/auth/login", nil, nil)
+		require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+
+		resp = h.do(t, client, http.MethodGet, "/api/auth/callback?state=forged&code=alice@example.com", nil, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Empty(t, h.sessionCookie(t, client))
+	})
+}
+
+// TestRouterCreateAndRedirect creates links through the API and follows them
+// through the catch-all redirect route
+func TestRouterCreateAndRedirect(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.client(t)
+	h.login(t, alice, "alice@example.com")
+	bob := h.client(t)
+	h.login(t, bob, "bob@example.com")
+
+	resp := h.do(t, alice, http.MethodPost, "/api/links", map[string]string{
+		"short": "docs",
+		"url":   "https://docs.example.com",
+	}, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = h.do(t, alice, http.MethodPost, "/api/links", map[string]string{
+		"short":        "secret",
+		"url":          "https://secret.example.com",
+		"access_level": "Private",
+	}, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = h.do(t, bob, http.MethodGet, "/docs", nil, nil)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "https://docs.example.com", resp.Header.Get("Location"))
+
+	resp = h.do(t, bob, http.MethodGet, "/secret", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "private link is owner-only")
+
+	resp = h.do(t, alice, http.MethodGet, "/secret", nil, nil)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	// Anonymous visitors are sent to login, also when served from the cache
+	for i := 0; i < 2; i++ {
+		resp = h.do(t, h.client(t), http.MethodGet, "/docs", nil, nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		assert.Equal(t, "/api/auth/login", resp.Header.Get("Location"))
+	}
+
+	resp = h.do(t, bob, http.MethodDelete, "/api/links/docs", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "only the creator can delete")
+}
+
+// TestRouterTrashAndRestore deletes a link, finds it in the creator's trash and
+// restores it so it redirects again
+func TestRouterTrashAndRestore(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.client(t)
+	h.login(t, alice, "alice@example.com")
+	bob := h.client(t)
+	h.login(t, bob, "bob@example.com")
+
+	resp := h.do(t, alice, http.MethodPost, "/api/links", map[string]string{
+		"short": "wiki",
+		"url":   "https://wiki.example.com",
+	}, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = h.do(t, alice, http.MethodDelete, "/api/links/wiki", nil, nil)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = h.do(t, alice, http.MethodGet, "/wiki", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "deleted links stop redirecting")
+
+	var trash []map[string]interface{}
+	resp = h.do(t, alice, http.MethodGet, "/api/links/trash", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&trash))
+	require.Len(t, trash, 1)
+	assert.Equal(t, "wiki", trash[0]["short"])
+	assert.NotEmpty(t, trash[0]["deleted_at"])
+
+	resp = h.do(t, bob, http.MethodGet, "/api/links/trash", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	trash = nil
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&trash))
+	assert.Empty(t, trash, "the trash only shows the caller's links")
+
+	resp = h.do(t, bob, http.MethodPost, "/api/links/wiki/restore", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "only the creator can restore")
+
+	resp = h.do(t, alice, http.MethodPost, "/api/links/wiki/restore", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = h.do(t, alice, http.MethodGet, "/wiki", nil, nil)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "https://wiki.example.com", resp.Header.Get("Location"))
+
+	resp = h.do(t, alice, http.MethodPost, "/api/links/wiki/restore", nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "restored links are no longer in the trash")
+}
+
+// TestRouterHistoryAndRollback edits a link twice, lists its history and rolls
+// back the first edit
+func TestRouterHistoryAndRollback(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.client(t)
+	h.login(t, alice, "alice@example.com")
+	bob := h.client(t)
+	h.login(t, bob, "bob@example.com")
+
+	resp := h.do(t, alice, http.MethodPost, "/api/links", map[string]string{
+		"short": "roadmap",
+		"url":   "https://v1.example.com",
+	}, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = h.do(t, alice, http.MethodPut, "/api/links/roadmap", map[string]string{"url": "https://v2.example.com"}, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = h.do(t, alice, http.MethodPut, "/api/links/roadmap", map[string]string{"title": "Roadmap"}, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var history []struct {
+		ChangedBy     string   `json:"changed_by"`
+		ChangedFields []string `json:"changed_fields"`
+		Version       int      `json:"version"`
+	}
+	resp = h.do(t, alice, http.MethodGet, "/api/links/roadmap/history", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history, 2)
+	assert.Equal(t, 2, history[0].Version, "newest first")
+	assert.Equal(t, []string{"title"}, history[0].ChangedFields)
+	assert.Equal(t, []string{"url"}, history[1].ChangedFields)
+	assert.NotEmpty(t, history[1].ChangedBy)
+
+	resp = h.do(t, bob, http.MethodGet, "/api/links/roadmap/history", nil, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "history is creator-only")
+	resp = h.do(t, bob, http.MethodPost, "/api/links/roadmap/rollback", map[string]int{"version": 1}, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "rollback is creator-only")
+
+	resp = h.do(t, alice, http.MethodPost, "/api/links/roadmap/rollback", map[string]int{"version": 9}, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	var link map[string]interface{}
+	resp = h.do(t, alice, http.MethodPost, "/api/links/roadmap/rollback", map[string]int{"version": 1}, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&link))
+	assert.Equal(t, "https://v1.example.com", link["url"])
+	assert.Equal(t, "", link["title"], "rolling back version 1 also reverts later changes")
+
+	resp = h.do(t, alice, http.MethodGet, "/roadmap", nil, nil)
+	assert.Equal(t, "https://v1.example.com", resp.Header.Get("Location"))
+
+	history = nil
+	resp = h.do(t, alice, http.MethodGet, "/api/links/roadmap/history", nil, nil)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history, 3, "the rollback is recorded as a version")
+	assert.ElementsMatch(t, []string{"url", "title"}, history[0].ChangedFields)
+}
+
+func TestRouterLinkReferences(t *testing.T) {
+	h := newHarness(t)
+
+	alice := h.client(t)
+	h.login(t, alice, "alice@example.com")
+	resp := h.do(t, alice, http.MethodPost, "/api/links", map[string]string{
+		"short": "oncall",
+		"url":   "https://oncall.example.com",
+	}, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Indexers have no session; they sign each report instead
+	report := func(body map[string]interface{}, secret string) *http.Response {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		headers := http.Header{}
+		require.NoError(t, webhook.NewSigner(secret).SignRequest(headers, payload))
+		signed := map[string]string{}
+		for k := range headers {
+			signed[k] = headers.Get(k)
+		}
+		return h.do(t, http.DefaultClient, http.MethodPost, "/api/hooks/references", body, signed)
+	}
+
+	runbook := map[string]interface{}{
+		"source":       "wiki",
+		"document_url": "https://wiki.example.com/Runbook",
+		"references":   map[string]int{"oncall": 3, "missing": 1},
+	}
+	resp = report(runbook, "wrong-secret")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = report(runbook, harnessIndexerSecret)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = report(map[string]interface{}{
+		"source":       "wiki",
+		"document_url": "https://wiki.example.com/Onboarding",
+		"references":   map[string]int{"oncall": 1},
+	}, harnessIndexerSecret)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var refs struct {
+		References []struct {
+			DocumentURL string `json:"document_url"`
+			Count       int    `json:"count"`
+		} `json:"references"`
+		Documents int `json:"documents"`
+		Total     int `json:"total_references"`
+	}
+	resp = h.do(t, alice, http.MethodGet, "/api/links/oncall/references", nil, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&refs))
+	assert.Equal(t, 2, refs.Documents)
+	assert.Equal(t, 4, refs.Total)
+	assert.Equal(t, "https://wiki.example.com/Runbook", refs.References[0].DocumentURL, "most frequent first")
+
+	// A new report for a document replaces the old one
+	runbook["references"] = map[string]int{"oncall": 0}
+	resp = report(runbook, harnessIndexerSecret)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = h.do(t, alice, http.MethodGet, "/api/links/oncall/references", nil, nil)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&refs))
+	assert.Equal(t, 1, refs.Documents)
+	assert.Equal(t, 1, refs.Total)
+}
+
+// TestRouterCORS checks preflight handling for allowed and foreign origins
+func TestRouterCORS(t *testing.T) {
+	h := newHarness(t)
+	client := h.client(t)
+
+	resp := h.do(t, client, http.MethodOptions, "/api/links", nil, map[string]string{
+		"Origin":                        harnessOrigin,
+		"Access-Control-Request-Method": http.MethodPost,
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, harnessOrigin, resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+
+	resp = h.do(t, client, http.MethodOptions, "/api/links", nil, map[string]string{
+		"Origin":                        "https://evil.test",
+		"Access-Control-Request-Method": http.MethodPost,
+	})
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+// TestRouterRateLimit exhausts the per-IP budget of the API and expects a
+// 429, while health checks stay exempt
+func TestRouterRateLimit(t *testing.T) {
+	h := newHarness(t)
+	client := h.client(t)
+
+	for i := 0; i < 100; i++ {
+		resp := h.do(t, client, http.MethodGet, "/api/links", nil, nil)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode, "request %d", i+1)
+	}
+
+	resp := h.do(t, client, http.MethodGet, "/api/links", nil, nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	assert.Equal(t, "100", resp.Header.Get("RateLimit-Limit"))
+
+	resp = h.do(t, client, http.MethodGet, "/health", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,192 @@
+// Package fixtures provides builders for test data and golden-file
+// comparison of JSON API responses.
+package fixtures
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Okabe-Junya/golink-backend/auth"
+	"github.com/Okabe-Junya/golink-backend/models"
+)
+
+// Epoch is the fixed creation time of built fixtures, so responses are reproducible
+var Epoch = time.Date(2025, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+// LinkBuilder builds models.Link values for tests
+type LinkBuilder struct {
+	link models.Link
+}
+
+// Link starts a public link with the given short code, created by "user1"
+func Link(short string) *LinkBuilder {
+	return &LinkBuilder{link: models.Link{
+		ID:           short,
+		Short:        short,
+		URL:          "https://example.com/" + short,
+		CreatedBy:    "user1",
+		AccessLevel:  models.AccessLevels.Public,
+		AllowedUsers: []string{},
+		Tags:         []string{},
+		CreatedAt:    Epoch,
+		UpdatedAt:    Epoch,
+
+		SchemaVersion: models.LinkSchemaVersion,
+	}}
+}
+
+// URL sets the target URL
+func (b *LinkBuilder) URL(url string) *LinkBuilder {
+	b.link.URL = url
+	return b
+}
+
+// CreatedBy sets the creator's user ID
+func (b *LinkBuilder) CreatedBy(userID string) *LinkBuilder {
+	b.link.CreatedBy = userID
+	return b
+}
+
+// Title sets the title and description
+func (b *LinkBuilder) Title(title, description string) *LinkBuilder {
+	b.link.Title = title
+	b.link.Description = description
+	return b
+}
+
+// Tags sets the tags
+func (b *LinkBuilder) Tags(tags ...string) *LinkBuilder {
+	b.link.Tags = append([]string{}, tags...)
+	return b
+}
+
+// Private makes the link visible to its creator only
+func (b *LinkBuilder) Private() *LinkBuilder {
+	b.link.AccessLevel = models.AccessLevels.Private
+	b.link.AllowedUsers = []string{}
+	return b
+}
+
+// Restricted makes the link visible to its creator and the given users
+func (b *LinkBuilder) Restricted(userIDs ...string) *LinkBuilder {
+	b.link.AccessLevel = models.AccessLevels.Restricted
+	b.link.AllowedUsers = append([]string{}, userIDs...)
+	return b
+}
+
+// Clicks sets the click count
+func (b *LinkBuilder) Clicks(n int) *LinkBuilder {
+	b.link.ClickCount = n
+	return b
+}
+
+// ExpiresAt sets the expiry time
+func (b *LinkBuilder) ExpiresAt(t time.Time) *LinkBuilder {
+	b.link.ExpiresAt = t
+	return b
+}
+
+// Expired marks the link as already expired
+func (b *LinkBuilder) Expired() *LinkBuilder {
+	b.link.ExpiresAt = Epoch.Add(time.Hour)
+	b.link.IsExpired = true
+	return b
+}
+
+// Build returns a new link; the builder can be reused
+func (b *LinkBuilder) Build() *models.Link {
+	return b.link.Clone()
+}
+
+// StatsBuilder builds models.LinkStats values for tests
+type StatsBuilder struct {
+	stats models.LinkStats
+}
+
+// Stats starts empty statistics for the given short code
+func Stats(short string) *StatsBuilder {
+	stats := models.NewLinkStats(short)
+	stats.CreatedAt = Epoch
+	return &StatsBuilder{stats: *stats}
+}
+
+// Click records a click on the given day (YYYY-MM-DD) with its referrer, browser and country
+func (b *StatsBuilder) Click(day, referrer, browser, country string) *StatsBuilder {
+	b.stats.TotalClicks++
+	b.stats.ClicksByDate[day]++
+	if referrer != "" {
+		b.stats.ReferringSites[referrer]++
+	}
+	if browser != "" {
+		b.stats.Browsers[browser]++
+	}
+	if country != "" {
+		b.stats.Countries[country]++
+	}
+	if t, err := time.Parse("2006-01-02", day); err == nil && t.After(b.stats.LastClickedAt) {
+		b.stats.LastClickedAt = t
+	}
+	return b
+}
+
+// UniqueClicks sets the number of unique clicks
+func (b *StatsBuilder) UniqueClicks(n int) *StatsBuilder {
+	b.stats.UniqueClicks = n
+	return b
+}
+
+// Build returns new statistics; the builder can be reused
+func (b *StatsBuilder) Build() *models.LinkStats {
+	stats := b.stats
+	stats.ReferringSites = copyCounts(b.stats.ReferringSites)
+	stats.Browsers = copyCounts(b.stats.Browsers)
+	stats.OperatingSystems = copyCounts(b.stats.OperatingSystems)
+	stats.Countries = copyCounts(b.stats.Countries)
+	stats.ClicksByDate = copyCounts(b.stats.ClicksByDate)
+	stats.DeviceTypes = copyCounts(b.stats.DeviceTypes)
+	return &stats
+}
+
+// copyCounts copies a counter map
+func copyCounts(m map[string]int) map[string]int {
+	c := make(map[string]int, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// UserBuilder builds authenticated users for tests
+type UserBuilder struct {
+	user auth.User
+}
+
+// User starts a verified user whose ID is the local part of the email
+func User(email string) *UserBuilder {
+	local, domain, _ := strings.Cut(email, "@")
+	return &UserBuilder{user: auth.User{
+		ID:            local,
+		Email:         email,
+		Name:          local,
+		Domain:        domain,
+		VerifiedEmail: true,
+	}}
+}
+
+// ID overrides the user ID
+func (b *UserBuilder) ID(id string) *UserBuilder {
+	b.user.ID = id
+	return b
+}
+
+// Name sets the display name
+func (b *UserBuilder) Name(name string) *UserBuilder {
+	b.user.Name = name
+	return b
+}
+
+// Build returns a new user; the builder can be reused
+func (b *UserBuilder) Build() *auth.User {
+	user := b.user
+	return &user
+}
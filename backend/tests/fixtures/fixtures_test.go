@@ -0,0 +1,44 @@
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/Okabe-Junya/golink-backend/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildersReturnIndependentValues(t *testing.T) {
+	links := Link("team").Restricted("user2")
+	first, second := links.Build(), links.Build()
+	first.AllowedUsers[0] = "mallory"
+	assert.Equal(t, []string{"user2"}, second.AllowedUsers)
+	assert.Equal(t, models.AccessLevels.Restricted, second.AccessLevel)
+
+	stats := Stats("team").Click("2025-01-02", "github.com", "Firefox", "JP")
+	a, b := stats.Build(), stats.Build()
+	a.Browsers["Firefox"] = 99
+	assert.Equal(t, 1, b.Browsers["Firefox"])
+	assert.Equal(t, 1, b.TotalClicks)
+
+	user := User("alice@example.com").Build()
+	assert.Equal(t, "alice", user.ID)
+	assert.Equal(t, "example.com", user.Domain)
+}
+
+func TestRedact(t *testing.T) {
+	value := map[string]interface{}{
+		"created_at": "2025-01-01T09:00:00Z",
+		"expires_at": "0001-01-01T00:00:00Z",
+		"age_days":   1.5,
+		"short":      "docs",
+		"items":      []interface{}{map[string]interface{}{"updated_at": "2025-01-01T09:00:00.123+09:00"}},
+	}
+
+	got := redact(value, map[string]bool{"age_days": true}).(map[string]interface{})
+
+	assert.Equal(t, Redacted, got["created_at"])
+	assert.Equal(t, "0001-01-01T00:00:00Z", got["expires_at"], "zero time stays visible")
+	assert.Equal(t, Redacted, got["age_days"])
+	assert.Equal(t, "docs", got["short"])
+	assert.Equal(t, Redacted, got["items"].([]interface{})[0].(map[string]interface{})["updated_at"])
+}
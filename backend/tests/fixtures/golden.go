@@ -0,0 +1,103 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// update rewrites golden files instead of comparing against them:
+//
+//	go test ./handlers -update
+var update = flag.Bool("update", false, "update golden files")
+
+// Redacted replaces values that differ between runs
+const Redacted = "<redacted>"
+
+// AssertGoldenJSON compares a JSON response body with testdata/golden/<name>.json.
+// Timestamps, and the values of any keys in redactKeys, are replaced with
+// Redacted before comparison so only the response shape and stable values matter.
+func AssertGoldenJSON(t *testing.T, name string, body []byte, redactKeys ...string) {
+	t.Helper()
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		t.Fatalf("response is not valid JSON: %v\n%s", err, body)
+	}
+
+	keys := make(map[string]bool, len(redactKeys))
+	for _, k := range redactKeys {
+		keys[k] = true
+	}
+
+	// Object keys are encoded in sorted order, so the output is stable
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(redact(value, keys)); err != nil {
+		t.Fatalf("failed to encode normalized response: %v", err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("response does not match %s (run with -update to accept)\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
+
+// redact replaces timestamps and values of the given keys throughout a decoded JSON value
+func redact(value interface{}, keys map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if keys[k] {
+				v[k] = Redacted
+				continue
+			}
+			v[k] = redact(child, keys)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redact(child, keys)
+		}
+		return v
+	case string:
+		if isTimestamp(v) {
+			return Redacted
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// isTimestamp reports whether s is an RFC 3339 timestamp, excluding the zero time
+// so that unset fields remain visible in golden files
+func isTimestamp(s string) bool {
+	if !strings.ContainsRune(s, 'T') {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil && !t.IsZero()
+}
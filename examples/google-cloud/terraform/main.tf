@@ -93,6 +93,12 @@ resource "google_cloud_run_v2_service" "backend" {
         value = google_cloud_run_v2_service.backend.uri
       }
 
+      # Cloud Run's front end appends the client address to X-Forwarded-For
+      env {
+        name  = "TRUSTED_PROXY_HOPS"
+        value = "1"
+      }
+
       env {
         name  = "CORS_ORIGIN"
         value = "https://${google_cloud_run_v2_service.frontend.uri}"
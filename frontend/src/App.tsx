@@ -1,7 +1,7 @@
 import type React from "react"
 import { useState, useEffect, useCallback } from "react"
 import axios, { type AxiosError } from "axios"
-import type { Link } from "./types/link"
+import type { DeletionImpact, Link } from "./types/link"
 import { Navbar } from "./components/Navbar"
 import { LinkForm } from "./components/LinkForm"
 import { LinkList } from "./components/LinkList"
@@ -15,6 +15,13 @@ const APP_DOMAIN = import.meta.env.VITE_DOMAIN || "localhost:3001"
 // Configure Axios default settings
 axios.defaults.withCredentials = true
 
+// deletionImpact extracts the impact from a delete that needs confirmation
+const deletionImpact = (error: unknown): DeletionImpact | undefined => {
+  const response = (error as AxiosError).response
+  if (response?.status !== 409) return undefined
+  return (response.data as { impact?: DeletionImpact }).impact
+}
+
 const AppContent: React.FC = () => {
   const [url, setUrl] = useState<string>("")
   const [short, setShort] = useState<string>("")
@@ -156,7 +163,21 @@ const AppContent: React.FC = () => {
     setSuccess(null)
 
     try {
-      await axios.delete(`${API_BASE_URL}/links/${shortCode}`)
+      try {
+        await axios.delete(`${API_BASE_URL}/links/${shortCode}`)
+      } catch (error: unknown) {
+        // Links still in use need a second, forced confirmation
+        const impact = deletionImpact(error)
+        if (!impact) throw error
+        const message =
+          `go/${shortCode} is still in use: ${impact.click_count} clicks` +
+          (impact.recently_clicked ? " (followed recently)" : "") +
+          `, referenced by ${impact.documents} documents. Delete anyway?`
+        if (!window.confirm(message)) return
+        await axios.delete(`${API_BASE_URL}/links/${shortCode}`, {
+          params: { force: "true" },
+        })
+      }
       setSuccess("Link deleted successfully!")
       fetchLinks()
     } catch (error: unknown) {
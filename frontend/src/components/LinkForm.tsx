@@ -151,13 +151,13 @@ export const LinkForm: React.FC<LinkFormProps> = ({
                 required
                 disabled={editMode || loading}
                 aria-describedby="shortCodeHint"
-                pattern="[a-zA-Z0-9-_]+"
-                title="Only letters, numbers, hyphens and underscores are allowed"
+                pattern="[a-zA-Z0-9-_]+(/[a-zA-Z0-9-_]+){0,2}"
+                title="Only letters, numbers, hyphens and underscores are allowed, optionally namespaced as team/name"
               />
             </div>
             <span id="shortCodeHint" className="label-text-alt mt-2">
               Use a memorable word or phrase (letters, numbers, hyphens and
-              underscores only)
+              underscores only), optionally in a namespace such as team/docs
             </span>
           </div>
           <div className="form-control mb-4">
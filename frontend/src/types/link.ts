@@ -11,3 +11,12 @@ export type Link = {
   expires_at?: string
   is_expired: boolean
 }
+
+/** Traffic and references reported when deleting a link still in use */
+export type DeletionImpact = {
+  click_count: number
+  last_clicked_at?: string
+  recently_clicked: boolean
+  documents: number
+  total_references: number
+}